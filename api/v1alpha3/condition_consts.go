@@ -0,0 +1,409 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+// Conditions and condition Reasons for the PacketCluster object.
+
+const (
+	// EndpointReadyCondition reports on the reservation of the control plane ip.
+	EndpointReadyCondition clusterv1.ConditionType = "EndpointReady"
+
+	// InvalidIPReservationScopeReason (Severity=Error) documents a PacketCluster whose
+	// ip reservation scope is inconsistent with its location or endpoint strategy.
+	InvalidIPReservationScopeReason = "InvalidIPReservationScope"
+	// InvalidLocationReason (Severity=Error) documents a PacketCluster that
+	// sets neither a facility nor a metro, or no facility for a facility
+	// scoped ip reservation.
+	InvalidLocationReason = "InvalidLocation"
+	// InvalidIPReservationMetadataReason (Severity=Error) documents a PacketCluster
+	// whose ip reservation tags or description template are invalid.
+	InvalidIPReservationMetadataReason = "InvalidIPReservationMetadata"
+	// InvalidNetworkPolicyReason (Severity=Error) documents a PacketCluster
+	// whose network policy has an invalid range or port.
+	InvalidNetworkPolicyReason = "InvalidNetworkPolicy"
+	// InvalidRegistriesReason (Severity=Error) documents a PacketCluster
+	// whose registry mirrors or insecure registries are not valid hosts or
+	// URLs.
+	InvalidRegistriesReason = "InvalidRegistries"
+	// InvalidNetworkingReason (Severity=Error) documents a PacketCluster
+	// whose networking fields depend on, or exclude, one another, e.g.
+	// kube-vip in BGP mode without BGP sessions on the control plane.
+	InvalidNetworkingReason = "InvalidNetworking"
+	// IPReservationFailedReason (Severity=Warning) documents a PacketCluster
+	// controller failing to reserve the control plane ip.
+	IPReservationFailedReason = "IPReservationFailed"
+	// IPOwnedByAnotherClusterReason (Severity=Error) documents a PacketCluster
+	// whose control plane ip belongs to another cluster with the same
+	// namespace and name, and which does not adopt existing ips.
+	IPOwnedByAnotherClusterReason = "IPOwnedByAnotherCluster"
+
+	// CloudIntegrationReadyCondition reports on the ClusterResourceSet
+	// installing the cloud integration in the workload cluster, and on its
+	// credentials. It is set only when the cloud integration is enabled, and
+	// is not part of the Ready summary.
+	CloudIntegrationReadyCondition clusterv1.ConditionType = "CloudIntegrationReady"
+
+	// CloudIntegrationFailedReason (Severity=Error or Warning when it can be
+	// retried) documents a failure rendering or creating the cloud integration.
+	CloudIntegrationFailedReason = "CloudIntegrationFailed"
+
+	// WaitingForControlPlaneReason (Severity=Info) documents a cloud
+	// integration waiting for the control plane of the workload cluster to
+	// write its credentials.
+	WaitingForControlPlaneReason = "WaitingForControlPlane"
+
+	// MaintenanceModeCondition is true while the PacketCluster is in maintenance
+	// mode: no new device is created for its machines.
+	MaintenanceModeCondition clusterv1.ConditionType = "MaintenanceMode"
+
+	// APIPermissionsVerifiedCondition reports on the permissions of the API
+	// key in the project of the PacketCluster. It is set only when the
+	// permissions are probed.
+	APIPermissionsVerifiedCondition clusterv1.ConditionType = "APIPermissionsVerified"
+
+	// MissingAPIPermissionsReason (Severity=Error) documents an API key lacking
+	// permissions in the project of the PacketCluster, such as a read only key.
+	MissingAPIPermissionsReason = "MissingAPIPermissions"
+
+	// ProjectSettingsVerifiedCondition reports on the project of the
+	// PacketCluster still having the settings the cluster relies on: BGP
+	// enabled when needed and its ProjectRequirements. It is set only when
+	// the cluster relies on some and the settings are verified.
+	ProjectSettingsVerifiedCondition clusterv1.ConditionType = "ProjectSettingsVerified"
+
+	// ProjectSettingsDriftedReason (Severity=Warning) documents a project
+	// whose settings were changed out of band, e.g. an SSH key deleted.
+	ProjectSettingsDriftedReason = "ProjectSettingsDrifted"
+	// ProjectSettingsCheckFailedReason (Severity=Warning) documents a failure
+	// reading the settings of the project.
+	ProjectSettingsCheckFailedReason = "ProjectSettingsCheckFailed"
+
+	// InfrastructureAnomalyFreeCondition reports on the resources of the
+	// PacketCluster wasting money: devices of the cluster no PacketMachine
+	// owns, machines of autoscaled node groups billed monthly, and hardware
+	// reservations idle for too long. It is set only when the anomalies are
+	// analyzed.
+	InfrastructureAnomalyFreeCondition clusterv1.ConditionType = "InfrastructureAnomalyFree"
+
+	// InfrastructureAnomaliesFoundReason (Severity=Warning) documents
+	// resources of the cluster wasting money.
+	InfrastructureAnomaliesFoundReason = "InfrastructureAnomaliesFound"
+	// AnomalyAnalysisFailedReason (Severity=Warning) documents a failure
+	// reading the resources of the project of the cluster.
+	AnomalyAnalysisFailedReason = "AnomalyAnalysisFailed"
+
+	// MetroConfiguredCondition reports on the PacketCluster setting a metro.
+	// Clusters that only set a facility are deprecated.
+	MetroConfiguredCondition clusterv1.ConditionType = "MetroConfigured"
+
+	// FacilityDeprecatedReason (Severity=Warning) documents a PacketCluster
+	// that sets a facility and no metro.
+	FacilityDeprecatedReason = "FacilityDeprecated"
+
+	// DeviceCreationAllowedCondition reports on the devices of the cluster
+	// being created. It is set once the creations got stopped after repeated
+	// failures, true again after the cooldown, and is not part of the Ready
+	// summary.
+	DeviceCreationAllowedCondition clusterv1.ConditionType = "DeviceCreationAllowed"
+
+	// BGPConfiguredCondition reports on BGP being enabled on the project of
+	// the PacketCluster as configured. It is set only when the PacketCluster
+	// configures BGP, and is not part of the Ready summary.
+	BGPConfiguredCondition clusterv1.ConditionType = "BGPConfigured"
+	// BGPConfigFailedReason (Severity=Warning) documents a failure enabling
+	// BGP on the project, or reading its password.
+	BGPConfigFailedReason = "BGPConfigFailed"
+	// BGPConfigPendingReason (Severity=Info) documents a BGP configuration
+	// requested but not enabled by Packet yet.
+	BGPConfigPendingReason = "BGPConfigPending"
+	// BGPConfigMismatchReason (Severity=Warning) documents a project whose BGP
+	// configuration differs from the one of the PacketCluster. Packet can not
+	// update it.
+	BGPConfigMismatchReason = "BGPConfigMismatch"
+
+	// ProjectReadyCondition reports on the dedicated project of the
+	// PacketCluster being created. It is set only when the PacketCluster has
+	// a dedicated project.
+	ProjectReadyCondition clusterv1.ConditionType = "ProjectReady"
+	// InvalidDedicatedProjectReason (Severity=Error) documents a PacketCluster
+	// that sets neither a project nor a dedicated one, or whose dedicated
+	// project can not be created as configured, e.g. without an organization.
+	InvalidDedicatedProjectReason = "InvalidDedicatedProject"
+	// ProjectCreationFailedReason (Severity=Warning) documents a failure
+	// creating the dedicated project of the PacketCluster.
+	ProjectCreationFailedReason = "ProjectCreationFailed"
+)
+
+// Conditions and condition Reasons shared by the PacketCluster and the
+// PacketMachine objects.
+
+const (
+	// DNSRecordsReadyCondition reports on the registration of the addresses
+	// in the DNS zone of the cluster. It is set only when a zone is configured,
+	// and is not part of the Ready summary: DNS failures do not block provisioning.
+	DNSRecordsReadyCondition clusterv1.ConditionType = "DNSRecordsReady"
+
+	// DNSRegistrationFailedReason (Severity=Warning) documents a failure
+	// creating or updating the DNS records.
+	DNSRegistrationFailedReason = "DNSRegistrationFailed"
+)
+
+// Conditions and condition Reasons for the PacketMachine object.
+
+const (
+	// DeviceReadyCondition reports on the current status of the Packet device.
+	// Ready indicates the device is active.
+	DeviceReadyCondition clusterv1.ConditionType = "DeviceReady"
+
+	// WaitingForClusterInfrastructureReason (Severity=Info) documents a PacketMachine
+	// waiting for the cluster infrastructure to be ready before creating a device.
+	WaitingForClusterInfrastructureReason = "WaitingForClusterInfrastructure"
+	// WaitingForBootstrapDataReason (Severity=Info) documents a PacketMachine
+	// waiting for usable bootstrap data before creating a device.
+	WaitingForBootstrapDataReason = "WaitingForBootstrapData"
+	// WaitingForTemplateValuesReason (Severity=Info) documents a PacketMachine
+	// waiting for the ConfigMaps and Secrets its userdata template values are
+	// read from before creating a device.
+	WaitingForTemplateValuesReason = "WaitingForTemplateValues"
+	// WaitingForBootProfileReason (Severity=Info) documents a PacketMachine
+	// waiting for the PacketBootProfile it boots to exist before creating a
+	// device.
+	WaitingForBootProfileReason = "WaitingForBootProfile"
+	// WaitingForTemplateReason (Severity=Warning) documents a PacketMachine
+	// waiting for the PacketMachineTemplate it references to exist and be
+	// granted to its namespace before creating a device.
+	WaitingForTemplateReason = "WaitingForTemplate"
+	// MaintenanceModeReason (Severity=Info) documents a PacketMachine not
+	// getting a device because its PacketCluster is in maintenance mode.
+	MaintenanceModeReason = "MaintenanceMode"
+	// DeviceProvisioningReason (Severity=Info) documents a device being provisioned.
+	DeviceProvisioningReason = "DeviceProvisioning"
+	// DeviceProvisionFailedReason (Severity=Error or Warning when it can be
+	// retried) documents a device that failed to be created or provisioned.
+	DeviceProvisionFailedReason = "DeviceProvisionFailed"
+	// DeviceNotFoundReason (Severity=Error) documents a device deleted outside
+	// of the cluster api.
+	DeviceNotFoundReason = "DeviceNotFound"
+	// ProtectedReservationReason (Severity=Warning) documents a device not
+	// deleted because its hardware reservation is protected.
+	ProtectedReservationReason = "ProtectedReservation"
+	// DeviceLockedReason (Severity=Warning) documents a device not deleted
+	// because it was locked by a user, the machine not asking for a lock.
+	DeviceLockedReason = "DeviceLocked"
+	// DeleteProtectedReason (Severity=Warning) documents a device not deleted
+	// because its cluster is being deleted while delete protected.
+	DeleteProtectedReason = "DeleteProtected"
+	// DeviceNotManagedReason (Severity=Warning) documents a device left
+	// untouched because it does not carry the uid tag of the cluster.
+	DeviceNotManagedReason = "DeviceNotManaged"
+	// WaitingForBillingHourEndReason (Severity=Info) documents the device of a
+	// deleted PacketMachine kept until the end of its billing hour.
+	WaitingForBillingHourEndReason = "WaitingForBillingHourEnd"
+	// CreateCircuitOpenReason (Severity=Warning) documents the device
+	// creations of a cluster stopped for a cooldown after they failed
+	// repeatedly, on the PacketCluster and on its PacketMachines waiting for
+	// a device.
+	CreateCircuitOpenReason = "CreateCircuitOpen"
+	// NoCapacityReason (Severity=Warning) documents a PacketMachine whose
+	// machine type has no capacity left in the facilities it can be placed in.
+	NoCapacityReason = "NoCapacity"
+	// QuotaExceededReason (Severity=Warning) documents a PacketMachine whose
+	// device would exceed a PacketResourceQuota of its namespace.
+	QuotaExceededReason = "QuotaExceeded"
+
+	// NetworkConfiguredCondition reports on the assignment of the control
+	// plane ip to the device, and on the device addresses.
+	NetworkConfiguredCondition clusterv1.ConditionType = "NetworkConfigured"
+
+	// ElasticIPAssignmentFailedReason (Severity=Warning) documents a failure
+	// assigning the control plane ip to the device.
+	ElasticIPAssignmentFailedReason = "ElasticIPAssignmentFailed"
+	// BGPSessionFailedReason (Severity=Warning) documents a failure creating
+	// the BGP session of a control plane device.
+	BGPSessionFailedReason = "BGPSessionFailed"
+	// VRFPortsFailedReason (Severity=Warning) documents a failure attaching
+	// the port of the device to the VLANs of its VRFs, or a VRF missing from
+	// the cluster (Severity=Error).
+	VRFPortsFailedReason = "VRFPortsFailed"
+
+	// BootstrapSucceededCondition reports on the device calling back once its
+	// bootstrap completed. It is set only when the bootstrap callback is enabled.
+	BootstrapSucceededCondition clusterv1.ConditionType = "BootstrapSucceeded"
+
+	// WaitingForBootstrapCallbackReason (Severity=Info) documents a device
+	// that did not call back yet.
+	WaitingForBootstrapCallbackReason = "WaitingForBootstrapCallback"
+	// BootstrapTimedOutReason (Severity=Error) documents a device that did not
+	// call back within the bootstrap timeout.
+	BootstrapTimedOutReason = "BootstrapTimedOut"
+
+	// UserDataVerifiedCondition reports on the userdata stored by Packet for
+	// the device matching the one rendered by the controller.
+	UserDataVerifiedCondition clusterv1.ConditionType = "UserDataVerified"
+
+	// UserDataMismatchReason (Severity=Error) documents a device whose stored
+	// userdata differs from the rendered one, e.g. truncated.
+	UserDataMismatchReason = "UserDataMismatch"
+)
+
+const (
+	// DeviceRequestSyncedCondition reports on the spec of a PacketMachine
+	// still matching the request its device was created with.
+	DeviceRequestSyncedCondition clusterv1.ConditionType = "DeviceRequestSynced"
+
+	// DeviceRequestDriftedReason (Severity=Warning) documents a PacketMachine
+	// whose spec changed since its device was created, the device keeps the
+	// configuration it was created with.
+	DeviceRequestDriftedReason = "DeviceRequestDrifted"
+)
+
+const (
+	// RescueModeCondition is true while the device of a PacketMachine runs
+	// the rescue operating system. It is not part of the Ready summary.
+	RescueModeCondition clusterv1.ConditionType = "RescueMode"
+
+	// DeviceActionFailedReason (Severity=Warning) documents a failure
+	// rebooting the device into rescue mode.
+	DeviceActionFailedReason = "DeviceActionFailed"
+)
+
+const (
+	// NodeInitializedCondition reports on the removal of the startup taint
+	// from the node of a PacketMachine. It is set only for the PacketMachines
+	// with a startup taint, and is not part of the Ready summary.
+	NodeInitializedCondition clusterv1.ConditionType = "NodeInitialized"
+
+	// WaitingForNodeReason (Severity=Info) documents a PacketMachine whose
+	// Machine does not reference its node yet.
+	WaitingForNodeReason = "WaitingForNode"
+	// StartupTaintRemovalFailedReason (Severity=Warning) documents a failure
+	// removing the startup taint from the node in the workload cluster.
+	StartupTaintRemovalFailedReason = "StartupTaintRemovalFailed"
+)
+
+const (
+	// NodeJoinedCondition reports on the node of a PacketMachine registering
+	// with the workload cluster and becoming ready. It is set only with the
+	// node readiness check, and is part of the Ready summary then.
+	NodeJoinedCondition clusterv1.ConditionType = "NodeJoined"
+
+	// NodeNotRegisteredReason (Severity=Info) documents an active device
+	// whose kubelet did not register its node yet.
+	NodeNotRegisteredReason = "NodeNotRegistered"
+	// NodeCheckFailedReason (Severity=Warning) documents a failure reading
+	// the nodes of the workload cluster.
+	NodeCheckFailedReason = "NodeCheckFailed"
+)
+
+const (
+	// FailureDomainsDiscoveredCondition reports on the derivation of the
+	// failure domains of a PacketCluster from the hardware reservations of
+	// its project, or from its reservation affinities. It is set only when
+	// FailureDomainsFromReservations or ReservationAffinities are, and is not
+	// part of the Ready summary.
+	FailureDomainsDiscoveredCondition clusterv1.ConditionType = "FailureDomainsDiscovered"
+
+	// ReservationListFailedReason (Severity=Warning) documents a failure
+	// listing the hardware reservations of the project, the failure domains
+	// found before are kept.
+	ReservationListFailedReason = "ReservationListFailed"
+	// NoReservationsReason (Severity=Warning) documents a project without
+	// hardware reservations in the locations of the cluster.
+	NoReservationsReason = "NoReservations"
+	// InvalidReservationAffinityReason (Severity=Error) documents
+	// reservation affinities that overlap, the failure domains found before
+	// are kept.
+	InvalidReservationAffinityReason = "InvalidReservationAffinity"
+)
+
+const (
+	// InterconnectionsReadyCondition reports on the interconnections of a
+	// PacketCluster and their virtual circuits. It is set only when the
+	// PacketCluster declares interconnections, and is not part of the Ready
+	// summary.
+	InterconnectionsReadyCondition clusterv1.ConditionType = "InterconnectionsReady"
+
+	// InvalidInterconnectionReason (Severity=Error) documents an
+	// interconnection that can not be provisioned as declared, e.g. a
+	// dedicated one without NNI VLAN.
+	InvalidInterconnectionReason = "InvalidInterconnection"
+	// InterconnectionFailedReason (Severity=Warning) documents a failure
+	// creating an interconnection or its virtual circuits.
+	InterconnectionFailedReason = "InterconnectionFailed"
+	// VLANNotFoundReason (Severity=Warning) documents a VLAN missing from the
+	// metro of an interconnection, or of the metal gateway of a VRF.
+	VLANNotFoundReason = "VLANNotFound"
+	// InterconnectionPendingReason (Severity=Info) documents interconnections
+	// or virtual circuits not active yet, such as shared ones waiting for
+	// their token to be redeemed.
+	InterconnectionPendingReason = "InterconnectionPending"
+)
+
+const (
+	// VRFsReadyCondition reports on the VRFs of a PacketCluster and their
+	// metal gateways. It is set only when the PacketCluster declares VRFs,
+	// and is not part of the Ready summary.
+	VRFsReadyCondition clusterv1.ConditionType = "VRFsReady"
+
+	// InvalidVRFReason (Severity=Error) documents a VRF that can not be
+	// provisioned as declared, e.g. a metal gateway network outside of its
+	// IP ranges.
+	InvalidVRFReason = "InvalidVRF"
+	// VRFFailedReason (Severity=Warning) documents a failure creating a VRF,
+	// its IP reservations or its metal gateways.
+	VRFFailedReason = "VRFFailed"
+	// VRFPendingReason (Severity=Info) documents metal gateways not ready
+	// yet, the routes of their VRF are not propagated.
+	VRFPendingReason = "VRFPending"
+)
+
+const (
+	// NodesRebootedCondition reports on the nodes of a PacketCluster requiring
+	// a reboot being rebooted. It is set only with PatchReboots, and is not
+	// part of the Ready summary.
+	NodesRebootedCondition clusterv1.ConditionType = "NodesRebooted"
+
+	// PatchRebootInProgressReason (Severity=Info) documents the nodes of a
+	// failure domain being drained and rebooted.
+	PatchRebootInProgressReason = "PatchRebootInProgress"
+	// DrainBlockedReason (Severity=Warning) documents a node whose pods can
+	// not be evicted yet, e.g. as a PodDisruptionBudget does not allow it.
+	DrainBlockedReason = "DrainBlocked"
+	// PatchRebootFailedReason (Severity=Warning) documents a failure reaching
+	// the workload cluster or rebooting a device.
+	PatchRebootFailedReason = "PatchRebootFailed"
+)
+
+// Conditions and condition Reasons for the PacketMachineTemplate object.
+
+const (
+	// MachineDeploymentUpdatedCondition reports on a MachineDeployment being
+	// switched to the PacketMachineTemplate created by its plan migration.
+	MachineDeploymentUpdatedCondition clusterv1.ConditionType = "MachineDeploymentUpdated"
+	// MachinesMigratedCondition reports on the machines of a MachineDeployment
+	// being rolled out to the machine type of its plan migration.
+	MachinesMigratedCondition clusterv1.ConditionType = "MachinesMigrated"
+
+	// MachineDeploymentUpdateFailedReason (Severity=Warning) documents a
+	// failure referencing the template from the MachineDeployment.
+	MachineDeploymentUpdateFailedReason = "MachineDeploymentUpdateFailed"
+	// RollingOutReason (Severity=Info) documents machines still on the
+	// machine type migrated from.
+	RollingOutReason = "RollingOut"
+)
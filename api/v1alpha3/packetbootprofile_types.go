@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PacketBootProfileSpec defines the iPXE script devices booting the profile
+// chain to: a complete Script, or a Kernel with its Initrds and Args. The
+// script and the args are rendered as Go templates with the variables of the
+// PacketMachine, see the documentation of the iPXE server.
+type PacketBootProfileSpec struct {
+	// Kernel is the url of the kernel booted.
+	// +optional
+	Kernel string `json:"kernel,omitempty"`
+
+	// Initrds are the urls of the initrds loaded with the kernel.
+	// +optional
+	Initrds []string `json:"initrds,omitempty"`
+
+	// Args is the command line of the kernel.
+	// +optional
+	Args string `json:"args,omitempty"`
+
+	// Script is the iPXE script, starting with #!ipxe, replacing the one
+	// booting the Kernel.
+	// +optional
+	Script string `json:"script,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=packetbootprofiles,scope=Namespaced,categories=cluster-api
+// +kubebuilder:storageversion
+
+// PacketBootProfile is a boot profile of the iPXE server of the controller.
+// The devices of the PacketMachines of its namespace referencing it with
+// ipxeBootProfile boot the iPXE script the server renders for them.
+type PacketBootProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PacketBootProfileSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PacketBootProfileList contains a list of PacketBootProfile
+type PacketBootProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PacketBootProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PacketBootProfile{}, &PacketBootProfileList{})
+}
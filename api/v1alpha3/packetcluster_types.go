@@ -21,6 +21,55 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 )
 
+const (
+	// CloudIntegrationLabel is set on the Clusters whose PacketCluster
+	// enables the cloud integration, with the name of the PacketCluster, so
+	// that its ClusterResourceSet selects them.
+	CloudIntegrationLabel = "packetcluster.infrastructure.cluster.x-k8s.io/cloud-integration"
+
+	// ClusterFinalizer lets the PacketCluster controller delete the resources
+	// of its cleanup ledger, and the dedicated project of a cluster, before
+	// the PacketCluster goes away.
+	ClusterFinalizer = "packetcluster.infrastructure.cluster.x-k8s.io"
+
+	// ClusterUIDAnnotation is set by the controller on the PacketClusters
+	// with the UID their Packet resources are tagged with. clusterctl move
+	// copies it to the new PacketCluster, whose own UID differs, so that the
+	// moved cluster keeps recognising its resources.
+	ClusterUIDAnnotation = "metal.plural.sh/cluster-uid"
+
+	// RebootRequiredAnnotation is the default annotation of the nodes
+	// requiring a reboot, see PatchRebootPolicy.
+	RebootRequiredAnnotation = "metal.plural.sh/reboot-required"
+
+	// DeleteProtectionAnnotation, set to DeleteProtectionEnabled on a
+	// PacketCluster or its Cluster, rejects their deletion until removed.
+	// The devices of a protected cluster being deleted are kept.
+	DeleteProtectionAnnotation = "metal.plural.sh/delete-protection"
+	// DeleteProtectionEnabled is the value of the DeleteProtectionAnnotation
+	// enabling the protection.
+	DeleteProtectionEnabled = "enabled"
+
+	// PluralRegisterLabel, set to "true" on a PacketCluster, registers its
+	// cluster with the Plural console once its control plane is reachable.
+	PluralRegisterLabel = "metal.plural.sh/register"
+	// PluralHandleAnnotation sets the handle a cluster is registered with in
+	// the Plural console, the namespace and name of the PacketCluster joined
+	// with a dash by default.
+	PluralHandleAnnotation = "metal.plural.sh/plural-handle"
+	// PluralClusterIDAnnotation is set by the controller on the registered
+	// PacketClusters, with the id of their cluster in the Plural console.
+	PluralClusterIDAnnotation = "metal.plural.sh/plural-cluster-id"
+	// PluralRegistrationFinalizer lets the controller deregister the cluster
+	// of a PacketCluster from the Plural console before it goes away.
+	PluralRegistrationFinalizer = "metal.plural.sh/plural-registration"
+	// PluralAgentLabel is set on the registered Clusters, with the name of
+	// their PacketCluster, so that the ClusterResourceSet of the deploy
+	// token of the Plural deployment agent selects them. Add-on providers
+	// installing the agent chart may select the Clusters with it as well.
+	PluralAgentLabel = "metal.plural.sh/plural-agent"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -29,15 +78,161 @@ type PacketClusterSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// ProjectID represents the Packet Project where this cluster will be placed into
+	// ProjectID represents the Packet Project where this cluster will be placed into.
+	// It is set by the controller when the cluster has a dedicated project.
+	// +optional
 	ProjectID string `json:"projectID"`
 
+	// DedicatedProject makes the controller create a project for the cluster,
+	// and delete it with the cluster. ProjectID must be left empty, it is set
+	// to the created project.
+	// +optional
+	DedicatedProject *DedicatedProject `json:"dedicatedProject,omitempty"`
+
 	// Facility represents the Packet facility for this cluster
 	Facility string `json:"facility,omitempty"`
 
+	// Metro represents the Packet metro for this cluster. It is required when
+	// the control plane ip is reserved in the metro, and it is used to place
+	// devices that do not set a facility.
+	// +optional
+	Metro string `json:"metro,omitempty"`
+
 	// ControlPlaneEndpoint represents the endpoint used to communicate with the control plane.
 	// +optional
 	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint"`
+
+	// ControlPlaneEndpointStrategy selects how the control plane endpoint is
+	// exposed when control plane machines are spread across facilities.
+	// Defaults to a single ElasticIP reserved in the cluster facility.
+	// +kubebuilder:validation:Enum=ElasticIP;ElasticIPPerFacility;GlobalIP
+	// +optional
+	ControlPlaneEndpointStrategy ControlPlaneEndpointStrategy `json:"controlPlaneEndpointStrategy,omitempty"`
+
+	// IPReservationScope selects where the control plane ip is reserved.
+	// Defaults to the cluster facility, to the metro of a cluster without a
+	// facility, or to Global when the GlobalIP endpoint strategy is used.
+	// +kubebuilder:validation:Enum=Facility;Metro;Global
+	// +optional
+	IPReservationScope IPReservationScope `json:"ipReservationScope,omitempty"`
+
+	// IPReservationMetadata adds tags and a description to the ip
+	// reservations of the cluster. It applies to new reservations only.
+	// +optional
+	IPReservationMetadata *IPReservationMetadata `json:"ipReservationMetadata,omitempty"`
+
+	// PersistElasticIPOnDelete keeps the ip reservations of the cluster when
+	// it is deleted, tagged as parked. A new cluster with the same namespace
+	// and name reuses them, so that the DNS records and firewall rules
+	// pointing at its control plane stay valid across rebuilds.
+	// +optional
+	PersistElasticIPOnDelete bool `json:"persistElasticIPOnDelete,omitempty"`
+
+	// AdoptExistingIP lets the cluster reuse the ip reservations a deleted
+	// cluster with the same namespace and name left behind without parking
+	// them. Without it such ips are refused, and the endpoint is not ready.
+	// +optional
+	AdoptExistingIP bool `json:"adoptExistingIP,omitempty"`
+
+	// Maintenance freezes the infrastructure of the cluster: while true no new
+	// device is created, deletions and status updates keep going.
+	// +optional
+	Maintenance bool `json:"maintenance,omitempty"`
+
+	// DrainingMetros are metros the cluster is moving out of. Machines placed
+	// in them are preferred victims when a MachineSet with the
+	// PreferDrainingMetro scale in policy scales in.
+	// +optional
+	DrainingMetros []string `json:"drainingMetros,omitempty"`
+
+	// DNSZone registers the control plane endpoint and the machine addresses
+	// in DNS. The records are removed with the cluster and the machines.
+	// +optional
+	DNSZone *DNSZone `json:"dnsZone,omitempty"`
+
+	// CloudIntegration installs the cloud controller manager, and optionally
+	// the CSI driver, in the workload cluster. It requires the
+	// ClusterResourceSet feature of Cluster API.
+	// +optional
+	CloudIntegration *CloudIntegration `json:"cloudIntegration,omitempty"`
+
+	// NetworkPolicy renders host firewall rules into the userdata of the
+	// devices of the cluster. It applies to new devices only.
+	// +optional
+	NetworkPolicy *NetworkPolicy `json:"networkPolicy,omitempty"`
+
+	// AdvertiseAddress selects the address the API server of each control
+	// plane machine advertises, instead of leaving kubeadm to guess it on
+	// multi-homed devices. The selection is rendered into the userdata of
+	// new control plane devices as advertiseAddressCommand, and recorded in
+	// the status of their PacketMachine.
+	// +optional
+	AdvertiseAddress *AdvertiseAddressPolicy `json:"advertiseAddress,omitempty"`
+
+	// FailureDomainsFromReservations derives the failure domains of the
+	// cluster from the facilities of the hardware reservations of the
+	// project, within the metro of the cluster when it has one. The control
+	// plane is placed in the ones with free reservations.
+	// +optional
+	FailureDomainsFromReservations bool `json:"failureDomainsFromReservations,omitempty"`
+
+	// BGP enables BGP on the project of the cluster, for the devices to
+	// announce addresses such as a control plane VIP. Packet can not change
+	// the BGP configuration of a project once enabled.
+	// +optional
+	BGP *BGPConfig `json:"bgp,omitempty"`
+
+	// Interconnections are provisioned in the project of the cluster, with
+	// virtual circuits to VLANs of the cluster, for private connectivity to
+	// other clouds or datacenters. They are deleted with the cluster, or once
+	// removed from the list.
+	// +optional
+	Interconnections []Interconnection `json:"interconnections,omitempty"`
+
+	// KubeVIP renders a kube-vip static pod manifest announcing the control
+	// plane endpoint, for the userdata of the control plane machines to write
+	// to the manifests directory of the kubelet.
+	// +optional
+	KubeVIP *KubeVIPConfig `json:"kubeVIP,omitempty"`
+
+	// NodeCredentials mints short lived, project scoped API keys for the
+	// control plane machines, instead of rendering the API key of the
+	// controller into their userdata.
+	// +optional
+	NodeCredentials *NodeCredentialsPolicy `json:"nodeCredentials,omitempty"`
+
+	// PatchReboots reboots the nodes requiring it through the Packet API,
+	// one failure domain at a time. Their pods are evicted first, honoring
+	// the PodDisruptionBudgets of the workload cluster.
+	// +optional
+	PatchReboots *PatchRebootPolicy `json:"patchReboots,omitempty"`
+
+	// ProjectRequirements are verified periodically in the project of the
+	// cluster, along with BGP being enabled when the cluster needs it. See
+	// the ProjectSettingsVerified condition.
+	// +optional
+	ProjectRequirements *ProjectRequirements `json:"projectRequirements,omitempty"`
+
+	// Registries are the registry mirrors and insecure registries of every
+	// node group of the cluster. They are rendered into the userdata of new
+	// devices as template variables, and optionally as containerd
+	// configuration.
+	// +optional
+	Registries *RegistryConfig `json:"registries,omitempty"`
+
+	// ReservationAffinities restrict the hardware reservations the machines
+	// of a failure domain consume, e.g. the ones of a rack. Without
+	// FailureDomainsFromReservations, they are the failure domains of the
+	// cluster.
+	// +optional
+	ReservationAffinities []ReservationAffinity `json:"reservationAffinities,omitempty"`
+
+	// VRFs are created in the project of the cluster, with IP reservations
+	// for the networks of their metal gateways. Machines attach their ports
+	// to the VLANs of the metal gateways of the VRFs they name. They are
+	// deleted with the cluster, or once removed from the list.
+	// +optional
+	VRFs []VRF `json:"vrfs,omitempty"`
 }
 
 // PacketClusterStatus defines the observed state of PacketCluster
@@ -48,6 +243,64 @@ type PacketClusterStatus struct {
 	// Ready denotes that the cluster (infrastructure) is ready.
 	// +optional
 	Ready bool `json:"ready"`
+
+	// ProjectID is the dedicated project created for the cluster, if any.
+	// +optional
+	ProjectID string `json:"projectID,omitempty"`
+
+	// ControlPlaneTopology lists the facilities hosting control plane machines
+	// and the address reserved for the control plane in each of them.
+	// +optional
+	ControlPlaneTopology []ControlPlaneLocation `json:"controlPlaneTopology,omitempty"`
+
+	// CreatedResources is the cleanup ledger of the cluster: the ip
+	// reservations, metal gateways, VRFs and interconnections the controller
+	// created for it, recorded as soon as they are, and deleted with the
+	// cluster before it goes away.
+	// +optional
+	CreatedResources []CreatedResource `json:"createdResources,omitempty"`
+
+	// DeletionProgress reports the deletion of the devices of the cluster
+	// once it is being deleted.
+	// +optional
+	DeletionProgress *DeletionProgress `json:"deletionProgress,omitempty"`
+
+	// EgressIPs are the public addresses the workloads of the cluster may use
+	// as egress source: the public addresses of the devices of its machines
+	// and its control plane addresses. They are also published in the
+	// <cluster>-egress-ips ConfigMap.
+	// +optional
+	EgressIPs []string `json:"egressIPs,omitempty"`
+
+	// FailureDomains are the facilities hosting hardware reservations of the
+	// project, with FailureDomainsFromReservations. Their attributes count
+	// the reservations and the free ones.
+	// +optional
+	FailureDomains clusterv1.FailureDomains `json:"failureDomains,omitempty"`
+
+	// IdleHardwareReservations are the hardware reservations the machines of
+	// the cluster may provision on that no device runs on, with when they
+	// were first seen idle. They are tracked by the anomaly analysis, see the
+	// InfrastructureAnomalyFree condition.
+	// +optional
+	IdleHardwareReservations []IdleHardwareReservation `json:"idleHardwareReservations,omitempty"`
+
+	// Interconnections reports on the interconnections of the cluster.
+	// +optional
+	Interconnections []InterconnectionStatus `json:"interconnections,omitempty"`
+
+	// PatchReboot reports on the failure domain whose nodes are being
+	// rebooted, with PatchReboots.
+	// +optional
+	PatchReboot *PatchRebootStatus `json:"patchReboot,omitempty"`
+
+	// VRFs reports on the VRFs of the cluster and their metal gateways.
+	// +optional
+	VRFs []VRFStatus `json:"vrfs,omitempty"`
+
+	// Conditions defines current service state of the PacketCluster.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:subresource:status
@@ -62,6 +315,16 @@ type PacketCluster struct {
 	Status PacketClusterStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the list of conditions for a PacketCluster API object.
+func (c *PacketCluster) GetConditions() clusterv1.Conditions {
+	return c.Status.Conditions
+}
+
+// SetConditions will set the given conditions on a PacketCluster object.
+func (c *PacketCluster) SetConditions(conditions clusterv1.Conditions) {
+	c.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // PacketClusterList contains a list of PacketCluster
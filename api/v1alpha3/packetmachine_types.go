@@ -19,6 +19,7 @@ package v1alpha3
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	capierrors "sigs.k8s.io/cluster-api/errors"
 )
 
@@ -26,6 +27,94 @@ const (
 	// MachineFinalizer allows ReconcilePacketMachine to clean up Packet resources before
 	// removing it from the apiserver.
 	MachineFinalizer = "packetmachine.infrastructure.cluster.x-k8s.io"
+
+	// BootstrapCallbackAnnotation is set on a PacketMachine, with the time
+	// of the call, when its device calls back after completing its bootstrap.
+	BootstrapCallbackAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/bootstrap-callback"
+
+	// ReleaseProtectedReservationAnnotation allows the device of a
+	// PacketMachine to be deleted when it runs on a hardware reservation
+	// tagged protected. Without it the deletion of the PacketMachine waits.
+	ReleaseProtectedReservationAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/release-protected-reservation"
+
+	// AdoptDeviceAnnotation lets the controller manage the device of a
+	// PacketMachine that does not carry the uid tag of its cluster, such as a
+	// device provisioned manually or tagged for another cluster, when it only
+	// manages the tagged devices. The device gets tagged.
+	AdoptDeviceAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/adopt-device"
+
+	// DeviceRequestAnnotation holds the request, as JSON, the device of a
+	// PacketMachine was created with. The userdata is replaced by its digest.
+	DeviceRequestAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/device-request"
+	// RenderedUserDataHashAnnotation holds the digest of the userdata last
+	// rendered for a PacketMachine, with its secrets redacted: unlike the
+	// userDataHash of its status, it is the same for the machines of a node
+	// group rendering the same userdata with other join tokens.
+	RenderedUserDataHashAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/rendered-userdata-hash"
+	// UserDataChangedFromAnnotation holds the redacted digest of the userdata
+	// rendered before for the node group of a PacketMachine, when its own
+	// differs. The controller logs the diff of the two.
+	UserDataChangedFromAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/userdata-changed-from"
+
+	// MaxHourlyCostAnnotation is the most a device may cost per hour, in the
+	// currency of the Packet prices, e.g. "2.50". Set on a PacketMachine, a
+	// PacketMachineTemplate or a MachineDeployment, the admission webhook
+	// rejects the machine types costing more.
+	MaxHourlyCostAnnotation = "metal.plural.sh/max-hourly-cost"
+
+	// AutopsyLabel marks the ConfigMaps holding the diagnostics of a
+	// PacketMachine collected before its device was deleted. Its value is the
+	// name of the PacketMachine.
+	AutopsyLabel = "packetmachine.infrastructure.cluster.x-k8s.io/autopsy"
+	// AutopsyExpiresAnnotation is the time, as RFC3339, after which an autopsy
+	// ConfigMap is deleted.
+	AutopsyExpiresAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/autopsy-expires"
+
+	// ScaleInPolicyAnnotation opts a MachineSet, or the MachineDeployment it
+	// is copied from, in scale in hints. Its value is a comma separated list
+	// of ScaleInPreferences, applied in order to rank the Machines.
+	ScaleInPolicyAnnotation = "infrastructure.cluster.x-k8s.io/scale-in-policy"
+	// ScaleInCandidatesAnnotation sets how many Machines of a MachineSet get
+	// the delete-machine annotation ahead of a scale in. Defaults to 1.
+	ScaleInCandidatesAnnotation = "infrastructure.cluster.x-k8s.io/scale-in-candidates"
+	// ScaleInHintAnnotation marks the Machines the delete-machine annotation
+	// was set on by the controller, the other ones are left untouched.
+	ScaleInHintAnnotation = "infrastructure.cluster.x-k8s.io/scale-in-hint"
+
+	// DeletionGracePeriodAnnotation holds the time, as a duration such as
+	// 2h, the drain of a deleted Machine is held back for, e.g. to let long
+	// running batch jobs complete. It is set on the Machine, or on the
+	// template of its MachineDeployment.
+	DeletionGracePeriodAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/deletion-grace-period"
+	// DeletionGraceHookAnnotation is the pre-drain hook the controller sets on
+	// the Machines with a deletion grace period, and removes once it elapsed.
+	DeletionGraceHookAnnotation = clusterv1.PreDrainDeleteHookAnnotationPrefix + "/packet-deletion-grace"
+
+	// RescueAnnotation reboots the device of a PacketMachine into the rescue
+	// operating system, to recover a broken node. Removing it reboots the
+	// device from its disk.
+	RescueAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/rescue"
+	// BootOrderAnnotation sets the BootOrder of the device of a PacketMachine,
+	// disk or pxe. Without it the boot order of the device is left as is.
+	BootOrderAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/boot-order"
+
+	// StartupTaintKey is the key of the taint the nodes of the PacketMachines
+	// with StartupTaint register with. The controller removes it once their
+	// device is active and its addresses are published.
+	StartupTaintKey = "packetmachine.infrastructure.cluster.x-k8s.io/startup"
+
+	// NodeLabelPrefix prefixes the labels set on the nodes of the workload
+	// clusters from the facts of their devices: plan, metro, facility,
+	// hardware-reservation and lifecycle, spot or on-demand.
+	NodeLabelPrefix = "device.packet.infrastructure.cluster.x-k8s.io/"
+	// NodeLabelsAnnotation is set on a PacketMachine with the labels, as
+	// sorted key=value pairs, last set on its node from the facts of its
+	// device.
+	NodeLabelsAnnotation = "packetmachine.infrastructure.cluster.x-k8s.io/node-labels"
+
+	// FacilityAny lets the controller place the device of a PacketMachine in
+	// the facility with the most capacity left for its plan.
+	FacilityAny = "any"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -33,24 +122,67 @@ const (
 
 // PacketMachineSpec defines the desired state of PacketMachine
 type PacketMachineSpec struct {
-	OS           string   `json:"OS"`
-	BillingCycle string   `json:"billingCycle"`
-	MachineType  string   `json:"machineType"`
-	SshKeys      []string `json:"sshKeys,omitempty"`
+	// OS, BillingCycle and MachineType are required unless TemplateRef is
+	// set.
+	// +optional
+	OS string `json:"OS"`
+	// +optional
+	BillingCycle string `json:"billingCycle"`
+	// +optional
+	MachineType string   `json:"machineType"`
+	SshKeys     []string `json:"sshKeys,omitempty"`
 
 	// Facility represents the Packet facility for this cluster.
-	// Override from the PacketCluster spec.
+	// Override from the PacketCluster spec. `any` searches the facilities
+	// for capacity for the machine type and picks one, which is then
+	// recorded in the status. The search also happens when neither the
+	// PacketMachine nor the PacketCluster set a facility or a metro.
 	// +optional
 	Facility string `json:"facility,omitempty"`
 
+	// Facilities is a list of facilities machines created from this spec are
+	// spread across. Each new machine is placed in the facility hosting the
+	// fewest machines with the same role. Takes precedence over Facility.
+	// +optional
+	Facilities []string `json:"facilities,omitempty"`
+
+	// SpreadConstraints balance the machines of the node group across the
+	// facilities, or the metros, of Facilities, taking their capacity into
+	// account. Without them, each new machine is placed in the facility
+	// hosting the fewest machines with the same role, capacity or not.
+	// +optional
+	SpreadConstraints *SpreadConstraints `json:"spreadConstraints,omitempty"`
+
+	// Device references an existing device, provisioned outside of the
+	// cluster api, to adopt instead of creating a new one. The device is
+	// reinstalled with the bootstrap data of the machine and deleted with it.
+	// +optional
+	Device *DeviceReference `json:"device,omitempty"`
+
+	// ImageRef provisions the device from a prepared custom image instead of
+	// OS, which then only documents what the image is built from. Images
+	// with the node components preinstalled boot much faster than a stock
+	// operating system set up by the bootstrap data. The image must exist
+	// before the device is created.
+	// +optional
+	ImageRef *ImageReference `json:"imageRef,omitempty"`
+
 	// IPXEUrl can be used to set the pxe boot url when using custom OSes with this provider.
 	// Note that OS should also be set to "custom_ipxe" if using this value.
 	// +optional
 	IPXEUrl string `json:"ipxeURL,omitempty"`
 
+	// IPXEBootProfile is the name of a PacketBootProfile of the namespace.
+	// The device boots the iPXE script the iPXE server of the controller
+	// renders from it for the machine, instead of IPXEUrl. OS should also
+	// be set to "custom_ipxe".
+	// +optional
+	IPXEBootProfile string `json:"ipxeBootProfile,omitempty"`
+
 	// HardwareReservationID is the unique device hardware reservation ID, a comma separated list of
 	// hardware reservation IDs, or `next-available` to
 	// automatically let the Packet api determine one.
+	// +kubebuilder:validation:Pattern=`^((next-available|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})(,(next-available|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}))*)?$`
 	// +optional
 	HardwareReservationID string `json:"hardwareReservationID,omitempty"`
 
@@ -61,6 +193,79 @@ type PacketMachineSpec struct {
 	// Tags is an optional set of tags to add to Packet resources managed by the Packet provider.
 	// +optional
 	Tags Tags `json:"tags,omitempty"`
+
+	// NodeIPFamily selects the ip families of the device addresses reported
+	// in the status, and made available to the userdata template as
+	// nodeIPFamily. Defaults to dual, reporting every address.
+	// +kubebuilder:validation:Enum=ipv4;ipv6;dual
+	// +optional
+	NodeIPFamily NodeIPFamily `json:"nodeIPFamily,omitempty"`
+
+	// JoinEndpointOverride is the address, host or host:port, the machine
+	// joins the cluster through, made available to the userdata template as
+	// joinEndpoint. It lets the machine join through an internal load
+	// balancer or a split-horizon name while the control plane endpoint stays
+	// on the ElasticIP. Defaults to the control plane endpoint of the
+	// cluster.
+	// +optional
+	JoinEndpointOverride string `json:"joinEndpointOverride,omitempty"`
+
+	// StartupTaint makes the startup taint available to the userdata
+	// template as startupTaint, for the kubelet to register the node with,
+	// e.g. with the register-with-taints argument. The controller removes the
+	// taint from the node once the device is active and its addresses are
+	// published, so that no workload lands on a half configured node.
+	// +optional
+	StartupTaint bool `json:"startupTaint,omitempty"`
+
+	// TemplateRef references a PacketMachineTemplate, possibly in another
+	// namespace, the fields the machine leaves empty are taken from before
+	// its device gets created. A template in another namespace requires a
+	// PacketMachineTemplateGrant there allowing the namespace of the machine.
+	// +optional
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+
+	// TemplateValuesFrom declares variables of the userdata template read
+	// from ConfigMaps and Secrets in the namespace of the machine, such as
+	// registry mirrors, license keys or internal endpoints. They are rendered
+	// with {{ .values.<name> }}. The device is only created once every
+	// referenced key exists, unless its reference is optional.
+	// +optional
+	TemplateValuesFrom []TemplateValueSource `json:"templateValuesFrom,omitempty"`
+
+	// UserDataTemplateEngine renders the bootstrap data into the userdata of
+	// the device: go-template renders it as a Go template, envsubst
+	// substitutes the ${name} and $name variables, none sends it untouched.
+	// Defaults to go-template.
+	// +kubebuilder:validation:Enum=go-template;envsubst;none
+	// +optional
+	UserDataTemplateEngine UserDataTemplateEngine `json:"userdataTemplateEngine,omitempty"`
+
+	// DeviceDeletePolicy tells when the device is deleted once the machine
+	// is. EndOfBillingHour keeps an hourly billed device until the end of
+	// its current billing hour. Defaults to Immediate.
+	// +kubebuilder:validation:Enum=Immediate;EndOfBillingHour
+	// +optional
+	DeviceDeletePolicy DeviceDeletePolicy `json:"deviceDeletePolicy,omitempty"`
+
+	// LockDevice locks the device once provisioned, so that it can not be
+	// deleted from the console nor through the API by mistake. The
+	// controller unlocks it before deleting it with the machine.
+	// +optional
+	LockDevice bool `json:"lockDevice,omitempty"`
+
+	// VRFs are names of VRFs of the cluster. The VLANs of their metal
+	// gateways are attached to the bond0 port of the device, which keeps its
+	// public addresses in hybrid bonded mode.
+	// +optional
+	VRFs []string `json:"vrfs,omitempty"`
+
+	// GPU asks for a plan with GPUs, checked against the plans Packet
+	// offers, and optionally installs their driver. The GPU model and count
+	// of the plan are available to the userdata template as gpuModel and
+	// gpuCount.
+	// +optional
+	GPU *GPUSpec `json:"gpu,omitempty"`
 }
 
 // PacketMachineStatus defines the observed state of PacketMachine
@@ -75,10 +280,67 @@ type PacketMachineStatus struct {
 	// Addresses contains the Packet device associated addresses.
 	Addresses []corev1.NodeAddress `json:"addresses,omitempty"`
 
+	// DeviceAddresses details the addresses of the Packet device, telling the
+	// elastic ones apart from the ones natively assigned to the device.
+	// +optional
+	DeviceAddresses []DeviceAddress `json:"deviceAddresses,omitempty"`
+
+	// AdvertiseAddress is the address the API server of a control plane
+	// machine advertises, selected by the AdvertiseAddress of its cluster.
+	// +optional
+	AdvertiseAddress string `json:"advertiseAddress,omitempty"`
+
 	// InstanceStatus is the status of the Packet device instance for this machine.
 	// +optional
 	InstanceStatus *PacketResourceStatus `json:"instanceStatus,omitempty"`
 
+	// Facility is the Packet facility the device has been placed in.
+	// +optional
+	Facility string `json:"facility,omitempty"`
+
+	// Metro is the Packet metro the device has been placed in.
+	// +optional
+	Metro string `json:"metro,omitempty"`
+
+	// HardwareReservationID is the hardware reservation the device runs on,
+	// empty for an on-demand device.
+	// +optional
+	HardwareReservationID string `json:"hardwareReservationID,omitempty"`
+
+	// UserDataHash is the sha256 digest of the userdata rendered for the
+	// device, checked against the userdata Packet stored.
+	// +optional
+	UserDataHash string `json:"userDataHash,omitempty"`
+
+	// NodeAPIKey is the API key minted for the node of the machine, with the
+	// NodeCredentials of its cluster.
+	// +optional
+	NodeAPIKey *NodeAPIKeyStatus `json:"nodeAPIKey,omitempty"`
+
+	// Locked is true while the device is locked, by the controller with
+	// LockDevice or by a user.
+	// +optional
+	Locked bool `json:"locked,omitempty"`
+
+	// Rescue is true while the device runs the rescue operating system.
+	// +optional
+	Rescue bool `json:"rescue,omitempty"`
+
+	// BootOrder is where the device boots from.
+	// +optional
+	BootOrder BootOrder `json:"bootOrder,omitempty"`
+
+	// Timeline lists the significant steps of the lifecycle of the device,
+	// oldest first. Only the last MaxDeviceTimelineEvents are kept.
+	// +optional
+	Timeline []DeviceEvent `json:"timeline,omitempty"`
+
+	// ProvisioningDurations reports how long the device took to become
+	// active and the node to become ready, from the creation request of the
+	// device.
+	// +optional
+	ProvisioningDurations *ProvisioningDurations `json:"provisioningDurations,omitempty"`
+
 	// Any transient errors that occur during the reconciliation of Machines
 	// can be added as events to the Machine object and/or logged in the
 	// controller's output.
@@ -103,6 +365,61 @@ type PacketMachineStatus struct {
 	// controller's output.
 	// +optional
 	ErrorMessage *string `json:"errorMessage,omitempty"`
+
+	// Conditions defines current service state of the PacketMachine.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// DeviceEventType is a step of the lifecycle of a device.
+type DeviceEventType string
+
+const (
+	// DeviceEventCreateRequested is recorded when the device got requested.
+	DeviceEventCreateRequested = DeviceEventType("CreateRequested")
+	// DeviceEventProvisioning is recorded when Packet started provisioning
+	// the device.
+	DeviceEventProvisioning = DeviceEventType("Provisioning")
+	// DeviceEventActive is recorded when the device became active.
+	DeviceEventActive = DeviceEventType("Active")
+	// DeviceEventAddressAssigned is recorded when an elastic ip got assigned
+	// to the device.
+	DeviceEventAddressAssigned = DeviceEventType("AddressAssigned")
+	// DeviceEventReinstalling is recorded when Packet started reinstalling
+	// the device.
+	DeviceEventReinstalling = DeviceEventType("Reinstalling")
+	// DeviceEventDeleteRequested is recorded when the deletion of the device
+	// got requested.
+	DeviceEventDeleteRequested = DeviceEventType("DeleteRequested")
+
+	// MaxDeviceTimelineEvents is the number of events the timeline of a
+	// PacketMachine keeps.
+	MaxDeviceTimelineEvents = 16
+)
+
+// DeviceEvent is a step of the lifecycle of the device of a PacketMachine.
+type DeviceEvent struct {
+	// Type is the step the device went through.
+	Type DeviceEventType `json:"type"`
+
+	// Time is when the controller observed the step.
+	Time metav1.Time `json:"time"`
+
+	// Message details the step.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ProvisioningDurations reports how long the device of a PacketMachine took
+// to provision, from its creation request.
+type ProvisioningDurations struct {
+	// Active is the time the device took to become active.
+	// +optional
+	Active *metav1.Duration `json:"active,omitempty"`
+
+	// NodeReady is the time the node of the machine took to become ready.
+	// +optional
+	NodeReady *metav1.Duration `json:"nodeReady,omitempty"`
 }
 
 // +kubebuilder:subresource:status
@@ -124,6 +441,16 @@ type PacketMachine struct {
 	Status PacketMachineStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the list of conditions for a PacketMachine API object.
+func (m *PacketMachine) GetConditions() clusterv1.Conditions {
+	return m.Status.Conditions
+}
+
+// SetConditions will set the given conditions on a PacketMachine object.
+func (m *PacketMachine) SetConditions(conditions clusterv1.Conditions) {
+	m.Status.Conditions = conditions
+}
+
 // +kubebuilder:object:root=true
 
 // PacketMachineList contains a list of PacketMachine
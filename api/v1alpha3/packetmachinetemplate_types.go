@@ -18,6 +18,31 @@ package v1alpha3
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+const (
+	// CapacityAnnotation is set on a PacketMachineTemplate, when capacity
+	// publishing is enabled, with the best capacity level Packet reports for
+	// its machine type in the facilities its machines can be placed in:
+	// normal, limited or unavailable.
+	CapacityAnnotation = "packetmachinetemplate.infrastructure.cluster.x-k8s.io/capacity"
+	// CapacityCheckedAnnotation is set on a PacketMachineTemplate with the
+	// time, RFC3339 formatted, the CapacityAnnotation was last checked.
+	CapacityCheckedAnnotation = "packetmachinetemplate.infrastructure.cluster.x-k8s.io/capacity-checked"
+	// WarmPoolSizeAnnotation sets how many devices are kept provisioned, with
+	// the base operating system of a PacketMachineTemplate, for its new
+	// machines to claim instead of creating their own. It requires the warm
+	// pool controller.
+	WarmPoolSizeAnnotation = "packetmachinetemplate.infrastructure.cluster.x-k8s.io/warm-pool-size"
+	// PlanMigrationAnnotation is set on a MachineDeployment with the machine
+	// type to move its machines to. The plan migration controller clones its
+	// PacketMachineTemplate with that machine type and references the clone
+	// from the MachineDeployment, which rolls the machines out.
+	PlanMigrationAnnotation = "infrastructure.cluster.x-k8s.io/plan-migration"
+	// MigratedFromAnnotation is set on the PacketMachineTemplates created by
+	// a plan migration with the name of the template they were cloned from.
+	MigratedFromAnnotation = "packetmachinetemplate.infrastructure.cluster.x-k8s.io/migrated-from"
 )
 
 // PacketMachineTemplateSpec defines the desired state of PacketMachineTemplate
@@ -25,6 +50,40 @@ type PacketMachineTemplateSpec struct {
 	Template PacketMachineTemplateResource `json:"template"`
 }
 
+// PacketMachineTemplateStatus defines the observed state of PacketMachineTemplate
+type PacketMachineTemplateStatus struct {
+	// Migration reports on the plan migration that created the template, if
+	// any.
+	// +optional
+	Migration *PlanMigrationStatus `json:"migration,omitempty"`
+
+	// Conditions defines current service state of the PacketMachineTemplate.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// PlanMigrationStatus reports on the roll out of a MachineDeployment to the
+// machine type of a plan migration.
+type PlanMigrationStatus struct {
+	// MachineDeployment is the name of the migrated MachineDeployment.
+	MachineDeployment string `json:"machineDeployment"`
+
+	// FromMachineType is the machine type the machines are moved from.
+	FromMachineType string `json:"fromMachineType"`
+
+	// MachineType is the machine type the machines are moved to.
+	MachineType string `json:"machineType"`
+
+	// Replicas is the number of machines of the MachineDeployment.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// UpdatedReplicas is the number of machines already on the machine type.
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+}
+
+// +kubebuilder:subresource:status
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=packetmachinetemplates,scope=Namespaced,categories=cluster-api
 // +kubebuilder:storageversion
@@ -34,7 +93,18 @@ type PacketMachineTemplate struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec PacketMachineTemplateSpec `json:"spec,omitempty"`
+	Spec   PacketMachineTemplateSpec   `json:"spec,omitempty"`
+	Status PacketMachineTemplateStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the list of conditions for a PacketMachineTemplate API object.
+func (t *PacketMachineTemplate) GetConditions() clusterv1.Conditions {
+	return t.Status.Conditions
+}
+
+// SetConditions will set the given conditions on a PacketMachineTemplate object.
+func (t *PacketMachineTemplate) SetConditions(conditions clusterv1.Conditions) {
+	t.Status.Conditions = conditions
 }
 
 // +kubebuilder:object:root=true
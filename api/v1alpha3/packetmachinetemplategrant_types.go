@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PacketMachineTemplateGrantSpec defines the PacketMachines allowed to
+// reference the PacketMachineTemplates of the namespace of the grant.
+type PacketMachineTemplateGrantSpec struct {
+	// From lists the namespaces whose PacketMachines can reference the
+	// templates.
+	// +kubebuilder:validation:MinItems=1
+	From []TemplateGrantFrom `json:"from"`
+
+	// TemplateNames restricts the grant to the PacketMachineTemplates with
+	// these names. Every template of the namespace is granted when empty.
+	// +optional
+	TemplateNames []string `json:"templateNames,omitempty"`
+}
+
+// TemplateGrantFrom identifies the PacketMachines a grant applies to.
+type TemplateGrantFrom struct {
+	// Namespace is the namespace of the PacketMachines.
+	Namespace string `json:"namespace"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=packetmachinetemplategrants,scope=Namespaced,categories=cluster-api
+// +kubebuilder:storageversion
+
+// PacketMachineTemplateGrant allows the PacketMachines of other namespaces
+// to reference the PacketMachineTemplates of its namespace, so that a central
+// catalog of approved templates can be shared across namespaces. Like the
+// ReferenceGrant of the Gateway API, it lives in the namespace of the
+// templates: the owners of the catalog decide who uses it.
+type PacketMachineTemplateGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PacketMachineTemplateGrantSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PacketMachineTemplateGrantList contains a list of PacketMachineTemplateGrant
+type PacketMachineTemplateGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PacketMachineTemplateGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PacketMachineTemplateGrant{}, &PacketMachineTemplateGrantList{})
+}
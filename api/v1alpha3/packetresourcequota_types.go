@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PacketResourceQuotaSpec defines the limits of the devices of the
+// PacketMachines of a namespace. Unset limits do not apply.
+type PacketResourceQuotaSpec struct {
+	// MaxDevices is the number of devices the namespace can have.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxDevices *int32 `json:"maxDevices,omitempty"`
+
+	// MaxCores is the number of cores the devices of the namespace can have
+	// in total, the cores of a device being the CPU count Packet reports for
+	// its machine type.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxCores *int32 `json:"maxCores,omitempty"`
+
+	// MaxMonthlyDevices is the number of monthly billed devices the
+	// namespace can have.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxMonthlyDevices *int32 `json:"maxMonthlyDevices,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=packetresourcequotas,scope=Namespaced,categories=cluster-api
+// +kubebuilder:storageversion
+
+// PacketResourceQuota limits the devices the PacketMachines of its namespace
+// can create, as a cost guardrail for the tenants of a management cluster.
+// The PacketMachine controller checks every quota of the namespace before
+// creating a device.
+type PacketResourceQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PacketResourceQuotaSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PacketResourceQuotaList contains a list of PacketResourceQuota
+type PacketResourceQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PacketResourceQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PacketResourceQuota{}, &PacketResourceQuotaList{})
+}
@@ -17,6 +17,18 @@ limitations under the License.
 package v1alpha3
 
 const (
-	ControlPlaneTag = "kubernetes.io/role:master"
-	WorkerTag       = "kubernetes.io/role:node"
+	// ManagedTagPrefix is the namespace of the tags the provider manages on
+	// the Packet resources. The tags outside of it belong to the users and
+	// their tooling, and are left untouched.
+	ManagedTagPrefix = "cluster-api-provider-packet:"
+
+	// ControlPlaneTag and WorkerTag tag the devices with the role of their
+	// machine.
+	ControlPlaneTag = ManagedTagPrefix + "role:control-plane"
+	WorkerTag       = ManagedTagPrefix + "role:worker"
+
+	// LegacyControlPlaneTag and LegacyWorkerTag are the role tags, outside of
+	// the managed namespace, of the devices created by previous versions.
+	LegacyControlPlaneTag = "kubernetes.io/role:master"
+	LegacyWorkerTag       = "kubernetes.io/role:node"
 )
@@ -16,6 +16,11 @@ limitations under the License.
 
 package v1alpha3
 
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 // PacketResourceStatus describes the status of a Packet resource.
 type PacketResourceStatus string
 
@@ -31,6 +36,9 @@ var (
 	// PacketResourceStatusProvisioning represents a resource that got dequeued
 	// and it is activelly processed by a worker.
 	PacketResourceStatusProvisioning = PacketResourceStatus("provisioning")
+	// PacketResourceStatusReinstalling represents a device getting its
+	// operating system reinstalled, like an adopted device.
+	PacketResourceStatusReinstalling = PacketResourceStatus("reinstalling")
 	// PacketResourceStatusRunning represents a Packet resource already provisioned and in a active state.
 	PacketResourceStatusRunning = PacketResourceStatus("active")
 	// PacketResourceStatusErrored represents a Packet resource in a errored state.
@@ -42,8 +50,893 @@ var (
 // Tags defines a slice of tags.
 type Tags []string
 
+// ControlPlaneEndpointStrategy describes how the control plane endpoint is reserved.
+type ControlPlaneEndpointStrategy string
+
+var (
+	// ControlPlaneEndpointStrategyElasticIP reserves a single ElasticIP in the
+	// cluster facility. Control plane machines in other facilities can not hold it.
+	ControlPlaneEndpointStrategyElasticIP = ControlPlaneEndpointStrategy("ElasticIP")
+	// ControlPlaneEndpointStrategyElasticIPPerFacility reserves one ElasticIP in
+	// every facility hosting control plane machines. The cluster facility one is
+	// used as the control plane endpoint, the others are reported in the status
+	// so they can be published behind DNS or an external load balancer.
+	ControlPlaneEndpointStrategyElasticIPPerFacility = ControlPlaneEndpointStrategy("ElasticIPPerFacility")
+	// ControlPlaneEndpointStrategyGlobalIP reserves a global IPv4 that can be
+	// assigned to control plane machines in any facility.
+	ControlPlaneEndpointStrategyGlobalIP = ControlPlaneEndpointStrategy("GlobalIP")
+)
+
+// ControlPlaneLocation describes the control plane address reserved in a facility.
+type ControlPlaneLocation struct {
+	// Facility is the Packet facility hosting control plane machines.
+	// It is empty for global addresses.
+	// +optional
+	Facility string `json:"facility,omitempty"`
+
+	// Address is the IP reserved for the control plane in this facility.
+	Address string `json:"address"`
+
+	// Machines is the number of control plane machines placed in this facility.
+	// +optional
+	Machines int32 `json:"machines,omitempty"`
+}
+
 // PacketMachineTemplateResource describes the data needed to create am PacketMachine from a template
 type PacketMachineTemplateResource struct {
 	// Spec is the specification of the desired behavior of the machine.
 	Spec PacketMachineSpec `json:"spec"`
 }
+
+// IPReservationScope describes where the control plane ip is reserved, and so
+// which devices it can be assigned to.
+type IPReservationScope string
+
+var (
+	// IPReservationScopeFacility reserves a public IPv4 in the cluster facility.
+	// It can be assigned only to devices in that facility.
+	IPReservationScopeFacility = IPReservationScope("Facility")
+	// IPReservationScopeMetro reserves a public IPv4 in the cluster metro.
+	// It can be assigned to devices in any facility of that metro.
+	IPReservationScopeMetro = IPReservationScope("Metro")
+	// IPReservationScopeGlobal reserves a global IPv4 that can be assigned to
+	// devices anywhere.
+	IPReservationScopeGlobal = IPReservationScope("Global")
+)
+
+// NodeIPFamily describes the ip families a node is addressed with.
+type NodeIPFamily string
+
+var (
+	// NodeIPFamilyIPv4 reports only the IPv4 addresses of the device.
+	NodeIPFamilyIPv4 = NodeIPFamily("ipv4")
+	// NodeIPFamilyIPv6 reports only the IPv6 addresses of the device.
+	NodeIPFamilyIPv6 = NodeIPFamily("ipv6")
+	// NodeIPFamilyDual reports both the IPv4 and IPv6 addresses of the device.
+	NodeIPFamilyDual = NodeIPFamily("dual")
+)
+
+// UserDataTemplateEngine describes how the bootstrap data of a machine is
+// rendered into the userdata of its device.
+type UserDataTemplateEngine string
+
+var (
+	// UserDataTemplateEngineGoTemplate renders the bootstrap data as a Go
+	// template.
+	UserDataTemplateEngineGoTemplate = UserDataTemplateEngine("go-template")
+	// UserDataTemplateEngineEnvsubst substitutes the ${name} and $name
+	// variables of the bootstrap data, leaving the unknown ones untouched.
+	UserDataTemplateEngineEnvsubst = UserDataTemplateEngine("envsubst")
+	// UserDataTemplateEngineNone sends the bootstrap data untouched.
+	UserDataTemplateEngineNone = UserDataTemplateEngine("none")
+)
+
+// DeviceDeletePolicy tells when the device of a deleted PacketMachine is
+// deleted.
+type DeviceDeletePolicy string
+
+var (
+	// DeviceDeletePolicyImmediate deletes the device as soon as the
+	// PacketMachine is deleted.
+	DeviceDeletePolicyImmediate = DeviceDeletePolicy("Immediate")
+	// DeviceDeletePolicyEndOfBillingHour keeps an hourly billed device until
+	// the end of the billing hour already started.
+	DeviceDeletePolicyEndOfBillingHour = DeviceDeletePolicy("EndOfBillingHour")
+)
+
+// ScaleInPreference ranks the Machines of a MachineSet when choosing which
+// ones are deleted first on scale in.
+type ScaleInPreference string
+
+var (
+	// ScaleInPreferDrainingMetro prefers the machines placed in one of the
+	// draining metros of the PacketCluster.
+	ScaleInPreferDrainingMetro = ScaleInPreference("PreferDrainingMetro")
+	// ScaleInPreferOnDemand prefers the machines not running on reserved hardware.
+	ScaleInPreferOnDemand = ScaleInPreference("PreferOnDemand")
+	// ScaleInPreferOldest prefers the oldest machines.
+	ScaleInPreferOldest = ScaleInPreference("PreferOldest")
+)
+
+// DeviceAddress describes an address assigned to a Packet device.
+type DeviceAddress struct {
+	// Type is the node address type the address is reported with.
+	Type corev1.NodeAddressType `json:"type"`
+
+	// Address is the ip address.
+	Address string `json:"address"`
+
+	// CIDR is the prefix length of the network the address belongs to.
+	// +optional
+	CIDR int32 `json:"cidr,omitempty"`
+
+	// AddressFamily is 4 or 6.
+	AddressFamily int32 `json:"addressFamily"`
+
+	// Public is true for addresses reachable from internet.
+	Public bool `json:"public"`
+
+	// Management is true for the addresses Packet assigns natively to the
+	// device, false for the elastic ones assigned from an ip reservation.
+	Management bool `json:"management"`
+
+	// AssignmentID is the id of the assignment of the address to the device.
+	// +optional
+	AssignmentID string `json:"assignmentID,omitempty"`
+
+	// Announced is true for the addresses the device announces over BGP,
+	// such as a control plane VIP, rather than being assigned them.
+	// +optional
+	Announced bool `json:"announced,omitempty"`
+}
+
+// IPReservationMetadata is set on the ip reservations of a cluster so that
+// network inventory systems can tell why each of them exists.
+type IPReservationMetadata struct {
+	// Tags are added to the tags the controllers identify the reservations
+	// with. They must not start with cluster-api-provider-packet:.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+
+	// Description is a Go template rendered as the description of the
+	// reservations, with the .Cluster, .Namespace and .Purpose fields. Purpose
+	// is control-plane for the control plane ip and facility-control-plane for
+	// the per facility ones.
+	// +optional
+	Description string `json:"description,omitempty"`
+}
+
+// CloudIntegration installs the Equinix Metal cloud integration in the
+// workload cluster through a ClusterResourceSet.
+type CloudIntegration struct {
+	// APIKeySecretRef selects the key of a Secret, in the namespace of the
+	// cluster, holding the API key of the cloud controller manager and of the
+	// CSI driver. A new key is written to the workload cluster at the next
+	// reconcile.
+	APIKeySecretRef corev1.SecretKeySelector `json:"apiKeySecretRef"`
+
+	// CCMVersion is the version of cloud-provider-equinix-metal, the cloud
+	// controller manager. Defaults to v3.2.2.
+	// +optional
+	CCMVersion string `json:"ccmVersion,omitempty"`
+
+	// CSI installs the csi-packet CSI driver too. It requires the cluster
+	// facility to be set.
+	// +optional
+	CSI bool `json:"csi,omitempty"`
+
+	// CSIVersion is the version of csi-packet. Defaults to v1.1.0.
+	// +optional
+	CSIVersion string `json:"csiVersion,omitempty"`
+}
+
+// DeletionProgress reports how many of the devices of a cluster being deleted
+// are gone.
+type DeletionProgress struct {
+	// Total is the number of devices the cluster had when the deletion started.
+	Total int32 `json:"total"`
+
+	// Deleted is the number of devices deleted so far.
+	Deleted int32 `json:"deleted"`
+}
+
+// DeviceReference identifies an existing device by id or by hostname.
+type DeviceReference struct {
+	// ID is the id of the device.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Hostname is the hostname of the device in the cluster project.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// TemplateReference identifies a PacketMachineTemplate.
+type TemplateReference struct {
+	// Namespace is the namespace of the template, the namespace of the
+	// machine when empty.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the template.
+	Name string `json:"name"`
+}
+
+// ImageReference identifies a custom image devices are provisioned from.
+type ImageReference struct {
+	// Slug is the slug of the custom image, as listed with the operating
+	// systems the controller credential can provision.
+	Slug string `json:"slug"`
+}
+
+// DNSProvider is the integration managing the DNS records of a cluster.
+type DNSProvider string
+
+var (
+	// DNSProviderExternalDNS creates external-dns DNSEndpoint objects, which
+	// external-dns publishes to the DNS provider it is configured with, such
+	// as route53 or cloudflare.
+	DNSProviderExternalDNS = DNSProvider("ExternalDNS")
+)
+
+// DNSZone configures the registration of the cluster addresses in DNS.
+type DNSZone struct {
+	// Name is the zone the records are created in, e.g. clusters.example.com.
+	// The control plane gets api.<cluster>.<zone>, each machine
+	// <machine>.<cluster>.<zone> and <machine>.private.<cluster>.<zone>.
+	Name string `json:"name"`
+
+	// Provider manages the records. Defaults to ExternalDNS.
+	// +kubebuilder:validation:Enum=ExternalDNS
+	// +optional
+	Provider DNSProvider `json:"provider,omitempty"`
+
+	// TTL of the records in seconds, the provider default when unset.
+	// +optional
+	TTL int64 `json:"ttl,omitempty"`
+
+	// DeviceHostnames names the devices after their public record,
+	// <machine>.<cluster>.<zone>, instead of <machine>. It applies to the
+	// devices created after it is set.
+	// +optional
+	DeviceHostnames bool `json:"deviceHostnames,omitempty"`
+}
+
+// SpreadTopology is the location the machines of a node group are balanced
+// across.
+type SpreadTopology string
+
+var (
+	// SpreadTopologyFacility balances the machines across facilities.
+	SpreadTopologyFacility = SpreadTopology("Facility")
+	// SpreadTopologyMetro balances the machines across the metros of the
+	// facilities.
+	SpreadTopologyMetro = SpreadTopology("Metro")
+)
+
+// UnsatisfiableSpreadAction tells what happens to a machine when no location
+// allowed by the spread constraints has capacity for it.
+type UnsatisfiableSpreadAction string
+
+var (
+	// DoNotSchedule waits for capacity in a location allowed by the spread
+	// constraints.
+	DoNotSchedule = UnsatisfiableSpreadAction("DoNotSchedule")
+	// ScheduleAnyway places the machine in the least populated location with
+	// capacity, even if it exceeds the maximum skew.
+	ScheduleAnyway = UnsatisfiableSpreadAction("ScheduleAnyway")
+)
+
+// SpreadConstraints balances the machines of a node group, the Machines of a
+// MachineDeployment, of a MachineSet or of the control plane, across the
+// locations of a list of facilities.
+type SpreadConstraints struct {
+	// TopologyKey is the location the machines are balanced across.
+	// Defaults to Facility.
+	// +kubebuilder:validation:Enum=Facility;Metro
+	// +optional
+	TopologyKey SpreadTopology `json:"topologyKey,omitempty"`
+
+	// MaxSkew is the maximum difference between the numbers of machines of
+	// the node group in two locations. A new machine is only placed in a
+	// location with capacity for its machine type that keeps the skew within
+	// MaxSkew.
+	// +kubebuilder:validation:Minimum=1
+	MaxSkew int32 `json:"maxSkew"`
+
+	// WhenUnsatisfiable tells what happens when no location allowed by
+	// MaxSkew has capacity. Defaults to DoNotSchedule.
+	// +kubebuilder:validation:Enum=DoNotSchedule;ScheduleAnyway
+	// +optional
+	WhenUnsatisfiable UnsatisfiableSpreadAction `json:"whenUnsatisfiable,omitempty"`
+}
+
+// BootOrder tells where a device boots from.
+type BootOrder string
+
+var (
+	// BootOrderDisk boots the device from its disk, the network boot only
+	// being used to install its operating system.
+	BootOrderDisk = BootOrder("disk")
+	// BootOrderPXE always boots the device from the network, as with an ipxe
+	// script serving a live image.
+	BootOrderPXE = BootOrder("pxe")
+)
+
+// TemplateValueSource declares a variable of the userdata template whose value
+// is read from a key of a ConfigMap or of a Secret in the namespace of the
+// machine. Exactly one of ConfigMapKeyRef and SecretKeyRef is set.
+type TemplateValueSource struct {
+	// Name of the variable, rendered with {{ .values.<name> }}.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_]*$`
+	Name string `json:"name"`
+
+	// ConfigMapKeyRef selects a key of a ConfigMap.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// NetworkPolicy is the host firewall of the devices of a cluster, rendered
+// into their userdata. Packet has no managed firewall: the devices are
+// reachable on every port of their public addresses otherwise. Traffic from
+// the cluster nodes, loopback, ICMP and replies to the connections the
+// devices open are always allowed, anything not allowed is dropped.
+type NetworkPolicy struct {
+	// APIServerAllowedCIDRs are the source ranges allowed to reach the API
+	// server of the control plane devices, in addition to the private network
+	// of the project and NodeCIDRs. Any source is allowed when empty.
+	// +optional
+	APIServerAllowedCIDRs []string `json:"apiServerAllowedCIDRs,omitempty"`
+
+	// SSHAllowedCIDRs are the source ranges allowed to reach SSH. SSH is
+	// closed when empty, the out of band console keeps working.
+	// +optional
+	SSHAllowedCIDRs []string `json:"sshAllowedCIDRs,omitempty"`
+
+	// NodeCIDRs are ranges, in addition to the private network of the
+	// project, whose traffic is allowed on every port as the one of the
+	// cluster nodes. They have to include the public addresses of the
+	// devices when the nodes talk over the public network.
+	// +optional
+	NodeCIDRs []string `json:"nodeCIDRs,omitempty"`
+
+	// AllowedPorts are TCP ports open to any source, such as the ones of an
+	// ingress controller on the host network.
+	// +optional
+	AllowedPorts []int32 `json:"allowedPorts,omitempty"`
+}
+
+// BGPDeploymentType is the kind of BGP configuration of a project.
+type BGPDeploymentType string
+
+var (
+	// BGPDeploymentTypeLocal announces the addresses of the project with a
+	// private ASN.
+	BGPDeploymentTypeLocal = BGPDeploymentType("local")
+	// BGPDeploymentTypeGlobal announces addresses owned outside of Packet
+	// with a public ASN. Packet reviews such configurations before enabling
+	// them.
+	BGPDeploymentTypeGlobal = BGPDeploymentType("global")
+)
+
+// BGPConfig configures BGP on the project of a cluster and the BGP sessions
+// of its control plane devices.
+type BGPConfig struct {
+	// LocalASN is the ASN the devices announce addresses with. Defaults to
+	// 65000.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4294967295
+	// +optional
+	LocalASN int64 `json:"localASN,omitempty"`
+
+	// PasswordSecretRef selects the key of a Secret, in the namespace of the
+	// cluster, holding the md5 password of the BGP sessions. The sessions are
+	// not authenticated when unset.
+	// +optional
+	PasswordSecretRef *corev1.SecretKeySelector `json:"passwordSecretRef,omitempty"`
+
+	// DeploymentType is local or global. Defaults to local.
+	// +kubebuilder:validation:Enum=local;global
+	// +optional
+	DeploymentType BGPDeploymentType `json:"deploymentType,omitempty"`
+
+	// ControlPlaneSessions creates a BGP session on every control plane
+	// device, as required when the control plane endpoint is a VIP announced
+	// over BGP, e.g. by kube-vip.
+	// +optional
+	ControlPlaneSessions bool `json:"controlPlaneSessions,omitempty"`
+}
+
+// KubeVIPMode is how kube-vip announces the control plane endpoint.
+type KubeVIPMode string
+
+var (
+	// KubeVIPModeBGP announces the endpoint over the BGP sessions of the
+	// control plane devices.
+	KubeVIPModeBGP = KubeVIPMode("BGP")
+	// KubeVIPModeARP announces the endpoint with gratuitous ARP from the
+	// leader of the control plane devices.
+	KubeVIPModeARP = KubeVIPMode("ARP")
+)
+
+// KubeVIPConfig configures the kube-vip static pod manifest of the control
+// plane machines.
+type KubeVIPConfig struct {
+	// Mode is BGP or ARP. Defaults to BGP when the cluster enables BGP, ARP
+	// otherwise.
+	// +kubebuilder:validation:Enum=BGP;ARP
+	// +optional
+	Mode KubeVIPMode `json:"mode,omitempty"`
+
+	// Image is the kube-vip image. Defaults to
+	// ghcr.io/kube-vip/kube-vip:v0.4.0.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Interface is the interface kube-vip binds the endpoint to. Defaults to
+	// lo in BGP mode and bond0 in ARP mode.
+	// +optional
+	Interface string `json:"interface,omitempty"`
+}
+
+// DedicatedProject configures the project created for a cluster.
+type DedicatedProject struct {
+	// OrganizationID is the organization the project is created in. Defaults
+	// to the organization the controller is configured with.
+	// +optional
+	OrganizationID string `json:"organizationID,omitempty"`
+}
+
+// InterconnectionType is the kind of ports of an interconnection.
+type InterconnectionType string
+
+var (
+	// InterconnectionTypeShared is an Equinix Fabric connection. Its virtual
+	// circuits exist once its token is redeemed on the Fabric side.
+	InterconnectionTypeShared = InterconnectionType("shared")
+	// InterconnectionTypeDedicated is a port of the project, virtual circuits
+	// are created on it for the VLAN.
+	InterconnectionTypeDedicated = InterconnectionType("dedicated")
+)
+
+// Interconnection declares an interconnection of the project of a cluster
+// and the virtual circuits connecting its ports to a VLAN of the cluster.
+type Interconnection struct {
+	// Name identifies the interconnection within the cluster.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// Type is shared or dedicated. Defaults to shared.
+	// +kubebuilder:validation:Enum=shared;dedicated
+	// +optional
+	Type InterconnectionType `json:"type,omitempty"`
+
+	// Metro is where the interconnection is requested. Defaults to the metro
+	// of the cluster.
+	// +optional
+	Metro string `json:"metro,omitempty"`
+
+	// Redundant requests a primary and a secondary port. Defaults to a
+	// primary port only.
+	// +optional
+	Redundant bool `json:"redundant,omitempty"`
+
+	// Speed is the speed of a shared interconnection in bits per second,
+	// e.g. 50000000.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Speed int64 `json:"speed,omitempty"`
+
+	// VLAN is the VXLAN id of the VLAN of the project, in the metro of the
+	// interconnection, its virtual circuits connect to.
+	// +kubebuilder:validation:Minimum=2
+	// +kubebuilder:validation:Maximum=3999
+	VLAN int32 `json:"vlan"`
+
+	// NNIVLAN is the VLAN tag of the virtual circuits on the customer side
+	// of a dedicated interconnection. It is required for dedicated ones.
+	// +kubebuilder:validation:Minimum=2
+	// +kubebuilder:validation:Maximum=4094
+	// +optional
+	NNIVLAN int32 `json:"nniVLAN,omitempty"`
+}
+
+// InterconnectionStatus reports on an interconnection of a cluster.
+type InterconnectionStatus struct {
+	// Name is the name of the interconnection in the spec.
+	Name string `json:"name"`
+
+	// ID is the id of the interconnection.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Status is the status of the interconnection, e.g. active.
+	// +optional
+	Status string `json:"status,omitempty"`
+
+	// Token is redeemed on Equinix Fabric to connect a shared
+	// interconnection.
+	// +optional
+	Token string `json:"token,omitempty"`
+
+	// VirtualCircuits are the virtual circuits connecting the ports of the
+	// interconnection to the VLAN.
+	// +optional
+	VirtualCircuits []VirtualCircuitStatus `json:"virtualCircuits,omitempty"`
+}
+
+// VirtualCircuitStatus reports on a virtual circuit of an interconnection.
+type VirtualCircuitStatus struct {
+	// ID is the id of the virtual circuit.
+	ID string `json:"id"`
+
+	// Port is the role of the port of the virtual circuit, primary or
+	// secondary.
+	// +optional
+	Port string `json:"port,omitempty"`
+
+	// Status is the status of the virtual circuit, e.g. active.
+	// +optional
+	Status string `json:"status,omitempty"`
+}
+
+// VRF declares a VRF of the project of a cluster, the IP ranges it routes
+// and the metal gateways binding its IP reservations to VLANs of the
+// cluster.
+type VRF struct {
+	// Name identifies the VRF within the cluster.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+
+	// Metro is where the VRF is created. Defaults to the metro of the
+	// cluster.
+	// +optional
+	Metro string `json:"metro,omitempty"`
+
+	// LocalASN is the ASN the VRF peers with the devices and the virtual
+	// circuits attached to it.
+	// +kubebuilder:validation:Minimum=1
+	LocalASN int64 `json:"localASN"`
+
+	// IPRanges are the CIDRs the VRF routes. The networks of its metal
+	// gateways are reserved within them.
+	// +kubebuilder:validation:MinItems=1
+	IPRanges []string `json:"ipRanges"`
+
+	// MetalGateways bind networks of the VRF to VLANs of the project, for
+	// the devices attached to the VLANs to route through the VRF.
+	// +optional
+	MetalGateways []VRFMetalGateway `json:"metalGateways,omitempty"`
+}
+
+// VRFMetalGateway binds a network of a VRF to a VLAN.
+type VRFMetalGateway struct {
+	// VLAN is the VXLAN id of the VLAN of the project, in the metro of the
+	// VRF, the metal gateway serves.
+	// +kubebuilder:validation:Minimum=2
+	// +kubebuilder:validation:Maximum=3999
+	VLAN int32 `json:"vlan"`
+
+	// Network is the CIDR, within the IP ranges of the VRF, reserved for the
+	// metal gateway, e.g. 10.10.1.0/24.
+	Network string `json:"network"`
+}
+
+// VRFStatus reports on a VRF of a cluster.
+type VRFStatus struct {
+	// Name is the name of the VRF in the spec.
+	Name string `json:"name"`
+
+	// ID is the id of the VRF.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// MetalGateways reports on the metal gateways of the VRF.
+	// +optional
+	MetalGateways []VRFMetalGatewayStatus `json:"metalGateways,omitempty"`
+
+	// RoutesPropagated is true once every metal gateway of the VRF is ready,
+	// the routes of the VRF then reach the devices attached to their VLANs.
+	// +optional
+	RoutesPropagated bool `json:"routesPropagated,omitempty"`
+}
+
+// VRFMetalGatewayStatus reports on a metal gateway of a VRF.
+type VRFMetalGatewayStatus struct {
+	// VLAN is the VXLAN id of the VLAN of the metal gateway.
+	VLAN int32 `json:"vlan"`
+
+	// ID is the id of the metal gateway.
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// IPReservationID is the id of the IP reservation of the network of the
+	// metal gateway.
+	// +optional
+	IPReservationID string `json:"ipReservationID,omitempty"`
+
+	// State is the state of the metal gateway, e.g. ready.
+	// +optional
+	State string `json:"state,omitempty"`
+}
+
+// PatchRebootPolicy configures the reboot of the nodes of a cluster that
+// require one, e.g. after OS security patches.
+type PatchRebootPolicy struct {
+	// RebootRequiredAnnotation is the annotation of the nodes requiring a
+	// reboot, as set by kured or a similar agent. Defaults to
+	// metal.plural.sh/reboot-required.
+	// +optional
+	RebootRequiredAnnotation string `json:"rebootRequiredAnnotation,omitempty"`
+
+	// MaxUnavailable is how many nodes of a failure domain are drained and
+	// rebooted at once. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxUnavailable int32 `json:"maxUnavailable,omitempty"`
+
+	// CheckInterval is how often the nodes are checked for the annotation
+	// while none is rebooting. Defaults to 10m.
+	// +optional
+	CheckInterval *metav1.Duration `json:"checkInterval,omitempty"`
+}
+
+// PatchRebootStatus reports on the reboot of the nodes of a failure domain.
+type PatchRebootStatus struct {
+	// FailureDomain is the failure domain whose nodes are being rebooted.
+	FailureDomain string `json:"failureDomain"`
+
+	// Nodes are the nodes being drained or rebooted.
+	// +optional
+	Nodes []RebootingNode `json:"nodes,omitempty"`
+}
+
+// RebootingNode is a node being drained or rebooted.
+type RebootingNode struct {
+	// Name is the name of the node.
+	Name string `json:"name"`
+
+	// BootID is the boot id of the node before its reboot.
+	// +optional
+	BootID string `json:"bootID,omitempty"`
+
+	// RebootedAt is when the device of the node got rebooted, unset while
+	// the node is being drained.
+	// +optional
+	RebootedAt *metav1.Time `json:"rebootedAt,omitempty"`
+}
+
+// ReservationAffinityType tells whether the machines of a failure domain can
+// fall back on the reservations of other failure domains.
+type ReservationAffinityType string
+
+var (
+	// ReservationAffinityHard only creates the devices of the machines of
+	// the failure domain on its reservations.
+	ReservationAffinityHard = ReservationAffinityType("Hard")
+	// ReservationAffinitySoft creates the devices of the machines of the
+	// failure domain on its reservations first, then on the other
+	// reservations of their machine.
+	ReservationAffinitySoft = ReservationAffinityType("Soft")
+)
+
+// ReservationAffinity maps a failure domain to the hardware reservations
+// belonging to it.
+type ReservationAffinity struct {
+	// FailureDomain is the name of the failure domain.
+	// +kubebuilder:validation:MinLength=1
+	FailureDomain string `json:"failureDomain"`
+
+	// ReservationIDs are the hardware reservations of the failure domain.
+	// +kubebuilder:validation:MinItems=1
+	ReservationIDs []string `json:"reservationIDs"`
+
+	// Type is Hard or Soft. Defaults to Hard.
+	// +kubebuilder:validation:Enum=Hard;Soft
+	// +optional
+	Type ReservationAffinityType `json:"type,omitempty"`
+}
+
+// GPUDriver is the GPU driver installed on the devices of a machine.
+type GPUDriver string
+
+var (
+	// GPUDriverNone installs no driver, the image or the bootstrap data
+	// brings its own.
+	GPUDriverNone = GPUDriver("none")
+	// GPUDriverNVIDIA installs the NVIDIA driver and container toolkit, and
+	// makes the NVIDIA runtime the default runtime of containerd.
+	GPUDriverNVIDIA = GPUDriver("nvidia")
+)
+
+// GPUSpec asks for a plan with GPUs.
+type GPUSpec struct {
+	// Count is the minimum number of GPUs of the plan. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count int32 `json:"count,omitempty"`
+
+	// Model is matched, ignoring case, against the GPU model of the plan,
+	// e.g. A100 matches "NVIDIA A100 PCIE 40GB". Any model matches when
+	// empty.
+	// +optional
+	Model string `json:"model,omitempty"`
+
+	// Driver is the driver installed once the device is bootstrapped, nvidia
+	// or none. Defaults to none.
+	// +kubebuilder:validation:Enum=none;nvidia
+	// +optional
+	Driver GPUDriver `json:"driver,omitempty"`
+
+	// DriverVersion is the major version of the driver, e.g. 535. Defaults
+	// to the version the distribution recommends.
+	// +kubebuilder:validation:Pattern=`^[0-9]+$`
+	// +optional
+	DriverVersion string `json:"driverVersion,omitempty"`
+}
+
+// AddressPreference tells which addresses of a device are preferred.
+type AddressPreference string
+
+var (
+	// AddressPreferencePrivate prefers the addresses of the private network
+	// of the project.
+	AddressPreferencePrivate = AddressPreference("Private")
+	// AddressPreferencePublic prefers the addresses reachable from internet.
+	AddressPreferencePublic = AddressPreference("Public")
+)
+
+// AdvertiseAddressPolicy selects the address the API server of each control
+// plane machine advertises among the IPv4 addresses Packet assigns natively
+// to its device.
+type AdvertiseAddressPolicy struct {
+	// CIDRs are the ranges the address is picked from first, in order.
+	// +optional
+	CIDRs []string `json:"cidrs,omitempty"`
+
+	// Preference is Private or Public, the addresses picked when none is
+	// in CIDRs. Defaults to Private.
+	// +kubebuilder:validation:Enum=Private;Public
+	// +optional
+	Preference AddressPreference `json:"preference,omitempty"`
+}
+
+// CreatedResourceKind is the kind of a Packet resource the controller created
+// for a cluster.
+type CreatedResourceKind string
+
+var (
+	// CreatedResourceIPReservation is an ip reservation: the ElasticIP of the
+	// control plane, the one of a facility, or the network of a metal
+	// gateway.
+	CreatedResourceIPReservation = CreatedResourceKind("IPReservation")
+	// CreatedResourceMetalGateway is a metal gateway of a VRF.
+	CreatedResourceMetalGateway = CreatedResourceKind("MetalGateway")
+	// CreatedResourceVRF is a VRF.
+	CreatedResourceVRF = CreatedResourceKind("VRF")
+	// CreatedResourceInterconnection is an interconnection.
+	CreatedResourceInterconnection = CreatedResourceKind("Interconnection")
+)
+
+// CreatedResource is an entry of the cleanup ledger of a cluster, a Packet
+// resource the controller created for it and deletes with it.
+type CreatedResource struct {
+	// Kind is the kind of the resource.
+	// +kubebuilder:validation:Enum=IPReservation;MetalGateway;VRF;Interconnection
+	Kind CreatedResourceKind `json:"kind"`
+
+	// ID is the id of the resource.
+	ID string `json:"id"`
+
+	// FailureDomain is the facility or the metro the resource was created
+	// in, empty for global ones.
+	// +optional
+	FailureDomain string `json:"failureDomain,omitempty"`
+}
+
+// NodeCredentialsPolicy has the controller mint an API key of the project of
+// the cluster for every control plane machine, rendered into its userdata
+// instead of the API key of the controller.
+type NodeCredentialsPolicy struct {
+	// TTL is how long a minted key lives: the controller revokes it once
+	// elapsed. Keys live as long as their machine when unset, as the ones
+	// kube-vip uses in BGP mode must.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// ReadOnly mints read only keys, enough to read the metadata of the
+	// project, not to assign ips nor to change the BGP configuration.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+}
+
+// NodeAPIKeyStatus identifies the API key minted for the node of a machine.
+type NodeAPIKeyStatus struct {
+	// ID is the id of the API key, never its token.
+	ID string `json:"id"`
+
+	// ExpiresAt is when the key gets revoked, unset for the keys living as
+	// long as the machine.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// ProjectIPType is a type of ip reservation of a project.
+// +kubebuilder:validation:Enum=public_ipv4;private_ipv4;public_ipv6
+type ProjectIPType string
+
+const (
+	// ProjectIPTypePublicIPv4 are the public IPv4 blocks of a project.
+	ProjectIPTypePublicIPv4 = ProjectIPType("public_ipv4")
+	// ProjectIPTypePrivateIPv4 are the private IPv4 blocks of a project,
+	// which the private addresses of its devices come from.
+	ProjectIPTypePrivateIPv4 = ProjectIPType("private_ipv4")
+	// ProjectIPTypePublicIPv6 are the IPv6 blocks of a project, which the
+	// IPv6 addresses of its devices come from.
+	ProjectIPTypePublicIPv6 = ProjectIPType("public_ipv6")
+)
+
+// ProjectRequirements are the settings of the project of a cluster its
+// machines rely on but the controller does not manage. Changing them out of
+// band fails the next device creation, they are verified periodically
+// instead.
+type ProjectRequirements struct {
+	// IPTypes are the types of ip reservations the project must have in the
+	// metro, or facility, of the cluster, e.g. public_ipv6 for nodes with
+	// IPv6 addresses.
+	// +optional
+	IPTypes []ProjectIPType `json:"ipTypes,omitempty"`
+
+	// SSHKeys are the labels of the SSH keys the project must have, which
+	// the devices are created with.
+	// +optional
+	SSHKeys []string `json:"sshKeys,omitempty"`
+}
+
+// RegistryConfig configures the container registries the nodes of a cluster
+// pull images from, e.g. the mirrors of an air-gapped network.
+type RegistryConfig struct {
+	// Mirrors redirect the pulls from registries to mirrors.
+	// +optional
+	Mirrors []RegistryMirror `json:"mirrors,omitempty"`
+
+	// InsecureRegistries are the registries and mirrors, host or host:port,
+	// whose certificates are not verified.
+	// +optional
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"`
+
+	// ContainerdConfig adds the containerd hosts.toml files of the mirrors
+	// and insecure registries to the userdata of new devices. The containerd
+	// configuration of the image must set the config_path of the registries
+	// of the CRI plugin to /etc/containerd/certs.d.
+	// +optional
+	ContainerdConfig bool `json:"containerdConfig,omitempty"`
+}
+
+// RegistryMirror redirects the pulls from a registry to mirrors.
+type RegistryMirror struct {
+	// Registry is the registry mirrored, host or host:port, e.g. docker.io.
+	// _default mirrors every registry.
+	Registry string `json:"registry"`
+
+	// Endpoints are the URLs of the mirrors, tried in order before the
+	// registry itself.
+	// +kubebuilder:validation:MinItems=1
+	Endpoints []string `json:"endpoints"`
+}
+
+// IdleHardwareReservation is a hardware reservation a cluster may provision
+// on that no device runs on.
+type IdleHardwareReservation struct {
+	// ID is the id of the hardware reservation.
+	ID string `json:"id"`
+
+	// Since is when the reservation was first seen idle.
+	Since metav1.Time `json:"since"`
+}
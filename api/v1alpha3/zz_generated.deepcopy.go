@@ -22,31 +22,1107 @@ package v1alpha3
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	apiv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/errors"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdvertiseAddressPolicy) DeepCopyInto(out *AdvertiseAddressPolicy) {
+	*out = *in
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdvertiseAddressPolicy.
+func (in *AdvertiseAddressPolicy) DeepCopy() *AdvertiseAddressPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AdvertiseAddressPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPConfig) DeepCopyInto(out *BGPConfig) {
+	*out = *in
+	if in.PasswordSecretRef != nil {
+		in, out := &in.PasswordSecretRef, &out.PasswordSecretRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPConfig.
+func (in *BGPConfig) DeepCopy() *BGPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudIntegration) DeepCopyInto(out *CloudIntegration) {
+	*out = *in
+	in.APIKeySecretRef.DeepCopyInto(&out.APIKeySecretRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudIntegration.
+func (in *CloudIntegration) DeepCopy() *CloudIntegration {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudIntegration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControlPlaneLocation) DeepCopyInto(out *ControlPlaneLocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControlPlaneLocation.
+func (in *ControlPlaneLocation) DeepCopy() *ControlPlaneLocation {
+	if in == nil {
+		return nil
+	}
+	out := new(ControlPlaneLocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CreatedResource) DeepCopyInto(out *CreatedResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CreatedResource.
+func (in *CreatedResource) DeepCopy() *CreatedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(CreatedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSZone) DeepCopyInto(out *DNSZone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSZone.
+func (in *DNSZone) DeepCopy() *DNSZone {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DedicatedProject) DeepCopyInto(out *DedicatedProject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DedicatedProject.
+func (in *DedicatedProject) DeepCopy() *DedicatedProject {
+	if in == nil {
+		return nil
+	}
+	out := new(DedicatedProject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeletionProgress) DeepCopyInto(out *DeletionProgress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeletionProgress.
+func (in *DeletionProgress) DeepCopy() *DeletionProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(DeletionProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceAddress) DeepCopyInto(out *DeviceAddress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceAddress.
+func (in *DeviceAddress) DeepCopy() *DeviceAddress {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceAddress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceEvent) DeepCopyInto(out *DeviceEvent) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceEvent.
+func (in *DeviceEvent) DeepCopy() *DeviceEvent {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceEvent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceReference) DeepCopyInto(out *DeviceReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceReference.
+func (in *DeviceReference) DeepCopy() *DeviceReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GPUSpec) DeepCopyInto(out *GPUSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GPUSpec.
+func (in *GPUSpec) DeepCopy() *GPUSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GPUSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPReservationMetadata) DeepCopyInto(out *IPReservationMetadata) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPReservationMetadata.
+func (in *IPReservationMetadata) DeepCopy() *IPReservationMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(IPReservationMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdleHardwareReservation) DeepCopyInto(out *IdleHardwareReservation) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdleHardwareReservation.
+func (in *IdleHardwareReservation) DeepCopy() *IdleHardwareReservation {
+	if in == nil {
+		return nil
+	}
+	out := new(IdleHardwareReservation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageReference) DeepCopyInto(out *ImageReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageReference.
+func (in *ImageReference) DeepCopy() *ImageReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Interconnection) DeepCopyInto(out *Interconnection) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Interconnection.
+func (in *Interconnection) DeepCopy() *Interconnection {
+	if in == nil {
+		return nil
+	}
+	out := new(Interconnection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InterconnectionStatus) DeepCopyInto(out *InterconnectionStatus) {
+	*out = *in
+	if in.VirtualCircuits != nil {
+		in, out := &in.VirtualCircuits, &out.VirtualCircuits
+		*out = make([]VirtualCircuitStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InterconnectionStatus.
+func (in *InterconnectionStatus) DeepCopy() *InterconnectionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InterconnectionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeVIPConfig) DeepCopyInto(out *KubeVIPConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeVIPConfig.
+func (in *KubeVIPConfig) DeepCopy() *KubeVIPConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeVIPConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicy) DeepCopyInto(out *NetworkPolicy) {
+	*out = *in
+	if in.APIServerAllowedCIDRs != nil {
+		in, out := &in.APIServerAllowedCIDRs, &out.APIServerAllowedCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SSHAllowedCIDRs != nil {
+		in, out := &in.SSHAllowedCIDRs, &out.SSHAllowedCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeCIDRs != nil {
+		in, out := &in.NodeCIDRs, &out.NodeCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedPorts != nil {
+		in, out := &in.AllowedPorts, &out.AllowedPorts
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicy.
+func (in *NetworkPolicy) DeepCopy() *NetworkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeAPIKeyStatus) DeepCopyInto(out *NodeAPIKeyStatus) {
+	*out = *in
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeAPIKeyStatus.
+func (in *NodeAPIKeyStatus) DeepCopy() *NodeAPIKeyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeAPIKeyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeCredentialsPolicy) DeepCopyInto(out *NodeCredentialsPolicy) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeCredentialsPolicy.
+func (in *NodeCredentialsPolicy) DeepCopy() *NodeCredentialsPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeCredentialsPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketBootProfile) DeepCopyInto(out *PacketBootProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketBootProfile.
+func (in *PacketBootProfile) DeepCopy() *PacketBootProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketBootProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketBootProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketBootProfileList) DeepCopyInto(out *PacketBootProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PacketBootProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketBootProfileList.
+func (in *PacketBootProfileList) DeepCopy() *PacketBootProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketBootProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketBootProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketBootProfileSpec) DeepCopyInto(out *PacketBootProfileSpec) {
+	*out = *in
+	if in.Initrds != nil {
+		in, out := &in.Initrds, &out.Initrds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketBootProfileSpec.
+func (in *PacketBootProfileSpec) DeepCopy() *PacketBootProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketBootProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PacketCluster) DeepCopyInto(out *PacketCluster) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketCluster.
+func (in *PacketCluster) DeepCopy() *PacketCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketCluster) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketClusterList) DeepCopyInto(out *PacketClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PacketCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketClusterList.
+func (in *PacketClusterList) DeepCopy() *PacketClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketClusterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketClusterSpec) DeepCopyInto(out *PacketClusterSpec) {
+	*out = *in
+	if in.DedicatedProject != nil {
+		in, out := &in.DedicatedProject, &out.DedicatedProject
+		*out = new(DedicatedProject)
+		**out = **in
+	}
+	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.IPReservationMetadata != nil {
+		in, out := &in.IPReservationMetadata, &out.IPReservationMetadata
+		*out = new(IPReservationMetadata)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DrainingMetros != nil {
+		in, out := &in.DrainingMetros, &out.DrainingMetros
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DNSZone != nil {
+		in, out := &in.DNSZone, &out.DNSZone
+		*out = new(DNSZone)
+		**out = **in
+	}
+	if in.CloudIntegration != nil {
+		in, out := &in.CloudIntegration, &out.CloudIntegration
+		*out = new(CloudIntegration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NetworkPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AdvertiseAddress != nil {
+		in, out := &in.AdvertiseAddress, &out.AdvertiseAddress
+		*out = new(AdvertiseAddressPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BGP != nil {
+		in, out := &in.BGP, &out.BGP
+		*out = new(BGPConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Interconnections != nil {
+		in, out := &in.Interconnections, &out.Interconnections
+		*out = make([]Interconnection, len(*in))
+		copy(*out, *in)
+	}
+	if in.KubeVIP != nil {
+		in, out := &in.KubeVIP, &out.KubeVIP
+		*out = new(KubeVIPConfig)
+		**out = **in
+	}
+	if in.NodeCredentials != nil {
+		in, out := &in.NodeCredentials, &out.NodeCredentials
+		*out = new(NodeCredentialsPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PatchReboots != nil {
+		in, out := &in.PatchReboots, &out.PatchReboots
+		*out = new(PatchRebootPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProjectRequirements != nil {
+		in, out := &in.ProjectRequirements, &out.ProjectRequirements
+		*out = new(ProjectRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Registries != nil {
+		in, out := &in.Registries, &out.Registries
+		*out = new(RegistryConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReservationAffinities != nil {
+		in, out := &in.ReservationAffinities, &out.ReservationAffinities
+		*out = make([]ReservationAffinity, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VRFs != nil {
+		in, out := &in.VRFs, &out.VRFs
+		*out = make([]VRF, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketClusterSpec.
+func (in *PacketClusterSpec) DeepCopy() *PacketClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketClusterStatus) DeepCopyInto(out *PacketClusterStatus) {
+	*out = *in
+	if in.ControlPlaneTopology != nil {
+		in, out := &in.ControlPlaneTopology, &out.ControlPlaneTopology
+		*out = make([]ControlPlaneLocation, len(*in))
+		copy(*out, *in)
+	}
+	if in.CreatedResources != nil {
+		in, out := &in.CreatedResources, &out.CreatedResources
+		*out = make([]CreatedResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeletionProgress != nil {
+		in, out := &in.DeletionProgress, &out.DeletionProgress
+		*out = new(DeletionProgress)
+		**out = **in
+	}
+	if in.EgressIPs != nil {
+		in, out := &in.EgressIPs, &out.EgressIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = make(apiv1alpha3.FailureDomains, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.IdleHardwareReservations != nil {
+		in, out := &in.IdleHardwareReservations, &out.IdleHardwareReservations
+		*out = make([]IdleHardwareReservation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Interconnections != nil {
+		in, out := &in.Interconnections, &out.Interconnections
+		*out = make([]InterconnectionStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PatchReboot != nil {
+		in, out := &in.PatchReboot, &out.PatchReboot
+		*out = new(PatchRebootStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VRFs != nil {
+		in, out := &in.VRFs, &out.VRFs
+		*out = make([]VRFStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha3.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketClusterStatus.
+func (in *PacketClusterStatus) DeepCopy() *PacketClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachine) DeepCopyInto(out *PacketMachine) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachine.
+func (in *PacketMachine) DeepCopy() *PacketMachine {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachine)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketMachine) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineList) DeepCopyInto(out *PacketMachineList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PacketMachine, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineList.
+func (in *PacketMachineList) DeepCopy() *PacketMachineList {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketMachineList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineSpec) DeepCopyInto(out *PacketMachineSpec) {
+	*out = *in
+	if in.SshKeys != nil {
+		in, out := &in.SshKeys, &out.SshKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Facilities != nil {
+		in, out := &in.Facilities, &out.Facilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SpreadConstraints != nil {
+		in, out := &in.SpreadConstraints, &out.SpreadConstraints
+		*out = new(SpreadConstraints)
+		**out = **in
+	}
+	if in.Device != nil {
+		in, out := &in.Device, &out.Device
+		*out = new(DeviceReference)
+		**out = **in
+	}
+	if in.ImageRef != nil {
+		in, out := &in.ImageRef, &out.ImageRef
+		*out = new(ImageReference)
+		**out = **in
+	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(TemplateReference)
+		**out = **in
+	}
+	if in.TemplateValuesFrom != nil {
+		in, out := &in.TemplateValuesFrom, &out.TemplateValuesFrom
+		*out = make([]TemplateValueSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ProviderID != nil {
+		in, out := &in.ProviderID, &out.ProviderID
+		*out = new(string)
+		**out = **in
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(Tags, len(*in))
+		copy(*out, *in)
+	}
+	if in.VRFs != nil {
+		in, out := &in.VRFs, &out.VRFs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GPU != nil {
+		in, out := &in.GPU, &out.GPU
+		*out = new(GPUSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineSpec.
+func (in *PacketMachineSpec) DeepCopy() *PacketMachineSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineStatus) DeepCopyInto(out *PacketMachineStatus) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]v1.NodeAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeviceAddresses != nil {
+		in, out := &in.DeviceAddresses, &out.DeviceAddresses
+		*out = make([]DeviceAddress, len(*in))
+		copy(*out, *in)
+	}
+	if in.InstanceStatus != nil {
+		in, out := &in.InstanceStatus, &out.InstanceStatus
+		*out = new(PacketResourceStatus)
+		**out = **in
+	}
+	if in.NodeAPIKey != nil {
+		in, out := &in.NodeAPIKey, &out.NodeAPIKey
+		*out = new(NodeAPIKeyStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeline != nil {
+		in, out := &in.Timeline, &out.Timeline
+		*out = make([]DeviceEvent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ProvisioningDurations != nil {
+		in, out := &in.ProvisioningDurations, &out.ProvisioningDurations
+		*out = new(ProvisioningDurations)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ErrorReason != nil {
+		in, out := &in.ErrorReason, &out.ErrorReason
+		*out = new(errors.MachineStatusError)
+		**out = **in
+	}
+	if in.ErrorMessage != nil {
+		in, out := &in.ErrorMessage, &out.ErrorMessage
+		*out = new(string)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha3.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineStatus.
+func (in *PacketMachineStatus) DeepCopy() *PacketMachineStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplate) DeepCopyInto(out *PacketMachineTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplate.
+func (in *PacketMachineTemplate) DeepCopy() *PacketMachineTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketMachineTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateGrant) DeepCopyInto(out *PacketMachineTemplateGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateGrant.
+func (in *PacketMachineTemplateGrant) DeepCopy() *PacketMachineTemplateGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketMachineTemplateGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateGrantList) DeepCopyInto(out *PacketMachineTemplateGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PacketMachineTemplateGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateGrantList.
+func (in *PacketMachineTemplateGrantList) DeepCopy() *PacketMachineTemplateGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketMachineTemplateGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateGrantSpec) DeepCopyInto(out *PacketMachineTemplateGrantSpec) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]TemplateGrantFrom, len(*in))
+		copy(*out, *in)
+	}
+	if in.TemplateNames != nil {
+		in, out := &in.TemplateNames, &out.TemplateNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateGrantSpec.
+func (in *PacketMachineTemplateGrantSpec) DeepCopy() *PacketMachineTemplateGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateList) DeepCopyInto(out *PacketMachineTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PacketMachineTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateList.
+func (in *PacketMachineTemplateList) DeepCopy() *PacketMachineTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PacketMachineTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateResource) DeepCopyInto(out *PacketMachineTemplateResource) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateResource.
+func (in *PacketMachineTemplateResource) DeepCopy() *PacketMachineTemplateResource {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateSpec) DeepCopyInto(out *PacketMachineTemplateSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateSpec.
+func (in *PacketMachineTemplateSpec) DeepCopy() *PacketMachineTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketMachineTemplateStatus) DeepCopyInto(out *PacketMachineTemplateStatus) {
+	*out = *in
+	if in.Migration != nil {
+		in, out := &in.Migration, &out.Migration
+		*out = new(PlanMigrationStatus)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1alpha3.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateStatus.
+func (in *PacketMachineTemplateStatus) DeepCopy() *PacketMachineTemplateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PacketMachineTemplateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PacketResourceQuota) DeepCopyInto(out *PacketResourceQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketCluster.
-func (in *PacketCluster) DeepCopy() *PacketCluster {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketResourceQuota.
+func (in *PacketResourceQuota) DeepCopy() *PacketResourceQuota {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketCluster)
+	out := new(PacketResourceQuota)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *PacketCluster) DeepCopyObject() runtime.Object {
+func (in *PacketResourceQuota) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -54,31 +1130,31 @@ func (in *PacketCluster) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketClusterList) DeepCopyInto(out *PacketClusterList) {
+func (in *PacketResourceQuotaList) DeepCopyInto(out *PacketResourceQuotaList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]PacketCluster, len(*in))
+		*out = make([]PacketResourceQuota, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketClusterList.
-func (in *PacketClusterList) DeepCopy() *PacketClusterList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketResourceQuotaList.
+func (in *PacketResourceQuotaList) DeepCopy() *PacketResourceQuotaList {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketClusterList)
+	out := new(PacketResourceQuotaList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *PacketClusterList) DeepCopyObject() runtime.Object {
+func (in *PacketResourceQuotaList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
@@ -86,265 +1162,403 @@ func (in *PacketClusterList) DeepCopyObject() runtime.Object {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketClusterSpec) DeepCopyInto(out *PacketClusterSpec) {
+func (in *PacketResourceQuotaSpec) DeepCopyInto(out *PacketResourceQuotaSpec) {
 	*out = *in
-	out.ControlPlaneEndpoint = in.ControlPlaneEndpoint
+	if in.MaxDevices != nil {
+		in, out := &in.MaxDevices, &out.MaxDevices
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxCores != nil {
+		in, out := &in.MaxCores, &out.MaxCores
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxMonthlyDevices != nil {
+		in, out := &in.MaxMonthlyDevices, &out.MaxMonthlyDevices
+		*out = new(int32)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketClusterSpec.
-func (in *PacketClusterSpec) DeepCopy() *PacketClusterSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketResourceQuotaSpec.
+func (in *PacketResourceQuotaSpec) DeepCopy() *PacketResourceQuotaSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketClusterSpec)
+	out := new(PacketResourceQuotaSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketClusterStatus) DeepCopyInto(out *PacketClusterStatus) {
+func (in *PatchRebootPolicy) DeepCopyInto(out *PatchRebootPolicy) {
 	*out = *in
+	if in.CheckInterval != nil {
+		in, out := &in.CheckInterval, &out.CheckInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketClusterStatus.
-func (in *PacketClusterStatus) DeepCopy() *PacketClusterStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchRebootPolicy.
+func (in *PatchRebootPolicy) DeepCopy() *PatchRebootPolicy {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketClusterStatus)
+	out := new(PatchRebootPolicy)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachine) DeepCopyInto(out *PacketMachine) {
+func (in *PatchRebootStatus) DeepCopyInto(out *PatchRebootStatus) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	in.Status.DeepCopyInto(&out.Status)
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]RebootingNode, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachine.
-func (in *PacketMachine) DeepCopy() *PacketMachine {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchRebootStatus.
+func (in *PatchRebootStatus) DeepCopy() *PatchRebootStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachine)
+	out := new(PatchRebootStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *PacketMachine) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlanMigrationStatus) DeepCopyInto(out *PlanMigrationStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlanMigrationStatus.
+func (in *PlanMigrationStatus) DeepCopy() *PlanMigrationStatus {
+	if in == nil {
+		return nil
 	}
-	return nil
+	out := new(PlanMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineList) DeepCopyInto(out *PacketMachineList) {
+func (in *ProjectRequirements) DeepCopyInto(out *ProjectRequirements) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]PacketMachine, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.IPTypes != nil {
+		in, out := &in.IPTypes, &out.IPTypes
+		*out = make([]ProjectIPType, len(*in))
+		copy(*out, *in)
+	}
+	if in.SSHKeys != nil {
+		in, out := &in.SSHKeys, &out.SSHKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineList.
-func (in *PacketMachineList) DeepCopy() *PacketMachineList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProjectRequirements.
+func (in *ProjectRequirements) DeepCopy() *ProjectRequirements {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineList)
+	out := new(ProjectRequirements)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *PacketMachineList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProvisioningDurations) DeepCopyInto(out *ProvisioningDurations) {
+	*out = *in
+	if in.Active != nil {
+		in, out := &in.Active, &out.Active
+		*out = new(metav1.Duration)
+		**out = **in
 	}
-	return nil
+	if in.NodeReady != nil {
+		in, out := &in.NodeReady, &out.NodeReady
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProvisioningDurations.
+func (in *ProvisioningDurations) DeepCopy() *ProvisioningDurations {
+	if in == nil {
+		return nil
+	}
+	out := new(ProvisioningDurations)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineSpec) DeepCopyInto(out *PacketMachineSpec) {
+func (in *RebootingNode) DeepCopyInto(out *RebootingNode) {
 	*out = *in
-	if in.SshKeys != nil {
-		in, out := &in.SshKeys, &out.SshKeys
+	if in.RebootedAt != nil {
+		in, out := &in.RebootedAt, &out.RebootedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RebootingNode.
+func (in *RebootingNode) DeepCopy() *RebootingNode {
+	if in == nil {
+		return nil
+	}
+	out := new(RebootingNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryConfig) DeepCopyInto(out *RegistryConfig) {
+	*out = *in
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]RegistryMirror, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InsecureRegistries != nil {
+		in, out := &in.InsecureRegistries, &out.InsecureRegistries
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	if in.ProviderID != nil {
-		in, out := &in.ProviderID, &out.ProviderID
-		*out = new(string)
-		**out = **in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryConfig.
+func (in *RegistryConfig) DeepCopy() *RegistryConfig {
+	if in == nil {
+		return nil
 	}
-	if in.Tags != nil {
-		in, out := &in.Tags, &out.Tags
-		*out = make(Tags, len(*in))
+	out := new(RegistryConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryMirror) DeepCopyInto(out *RegistryMirror) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineSpec.
-func (in *PacketMachineSpec) DeepCopy() *PacketMachineSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryMirror.
+func (in *RegistryMirror) DeepCopy() *RegistryMirror {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineSpec)
+	out := new(RegistryMirror)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineStatus) DeepCopyInto(out *PacketMachineStatus) {
+func (in *ReservationAffinity) DeepCopyInto(out *ReservationAffinity) {
 	*out = *in
-	if in.Addresses != nil {
-		in, out := &in.Addresses, &out.Addresses
-		*out = make([]v1.NodeAddress, len(*in))
+	if in.ReservationIDs != nil {
+		in, out := &in.ReservationIDs, &out.ReservationIDs
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	if in.InstanceStatus != nil {
-		in, out := &in.InstanceStatus, &out.InstanceStatus
-		*out = new(PacketResourceStatus)
-		**out = **in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReservationAffinity.
+func (in *ReservationAffinity) DeepCopy() *ReservationAffinity {
+	if in == nil {
+		return nil
 	}
-	if in.ErrorReason != nil {
-		in, out := &in.ErrorReason, &out.ErrorReason
-		*out = new(errors.MachineStatusError)
-		**out = **in
+	out := new(ReservationAffinity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpreadConstraints) DeepCopyInto(out *SpreadConstraints) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpreadConstraints.
+func (in *SpreadConstraints) DeepCopy() *SpreadConstraints {
+	if in == nil {
+		return nil
 	}
-	if in.ErrorMessage != nil {
-		in, out := &in.ErrorMessage, &out.ErrorMessage
-		*out = new(string)
-		**out = **in
+	out := new(SpreadConstraints)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in Tags) DeepCopyInto(out *Tags) {
+	{
+		in := &in
+		*out = make(Tags, len(*in))
+		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineStatus.
-func (in *PacketMachineStatus) DeepCopy() *PacketMachineStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tags.
+func (in Tags) DeepCopy() Tags {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineStatus)
+	out := new(Tags)
 	in.DeepCopyInto(out)
-	return out
+	return *out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineTemplate) DeepCopyInto(out *PacketMachineTemplate) {
+func (in *TemplateGrantFrom) DeepCopyInto(out *TemplateGrantFrom) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplate.
-func (in *PacketMachineTemplate) DeepCopy() *PacketMachineTemplate {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateGrantFrom.
+func (in *TemplateGrantFrom) DeepCopy() *TemplateGrantFrom {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineTemplate)
+	out := new(TemplateGrantFrom)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *PacketMachineTemplate) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
+func (in *TemplateReference) DeepCopy() *TemplateReference {
+	if in == nil {
+		return nil
 	}
-	return nil
+	out := new(TemplateReference)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineTemplateList) DeepCopyInto(out *PacketMachineTemplateList) {
+func (in *TemplateValueSource) DeepCopyInto(out *TemplateValueSource) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]PacketMachineTemplate, len(*in))
-		for i := range *in {
-			(*in)[i].DeepCopyInto(&(*out)[i])
-		}
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateList.
-func (in *PacketMachineTemplateList) DeepCopy() *PacketMachineTemplateList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateValueSource.
+func (in *TemplateValueSource) DeepCopy() *TemplateValueSource {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineTemplateList)
+	out := new(TemplateValueSource)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *PacketMachineTemplateList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VRF) DeepCopyInto(out *VRF) {
+	*out = *in
+	if in.IPRanges != nil {
+		in, out := &in.IPRanges, &out.IPRanges
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
-	return nil
+	if in.MetalGateways != nil {
+		in, out := &in.MetalGateways, &out.MetalGateways
+		*out = make([]VRFMetalGateway, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VRF.
+func (in *VRF) DeepCopy() *VRF {
+	if in == nil {
+		return nil
+	}
+	out := new(VRF)
+	in.DeepCopyInto(out)
+	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineTemplateResource) DeepCopyInto(out *PacketMachineTemplateResource) {
+func (in *VRFMetalGateway) DeepCopyInto(out *VRFMetalGateway) {
 	*out = *in
-	in.Spec.DeepCopyInto(&out.Spec)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateResource.
-func (in *PacketMachineTemplateResource) DeepCopy() *PacketMachineTemplateResource {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VRFMetalGateway.
+func (in *VRFMetalGateway) DeepCopy() *VRFMetalGateway {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineTemplateResource)
+	out := new(VRFMetalGateway)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PacketMachineTemplateSpec) DeepCopyInto(out *PacketMachineTemplateSpec) {
+func (in *VRFMetalGatewayStatus) DeepCopyInto(out *VRFMetalGatewayStatus) {
 	*out = *in
-	in.Template.DeepCopyInto(&out.Template)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PacketMachineTemplateSpec.
-func (in *PacketMachineTemplateSpec) DeepCopy() *PacketMachineTemplateSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VRFMetalGatewayStatus.
+func (in *VRFMetalGatewayStatus) DeepCopy() *VRFMetalGatewayStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(PacketMachineTemplateSpec)
+	out := new(VRFMetalGatewayStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in Tags) DeepCopyInto(out *Tags) {
-	{
-		in := &in
-		*out = make(Tags, len(*in))
+func (in *VRFStatus) DeepCopyInto(out *VRFStatus) {
+	*out = *in
+	if in.MetalGateways != nil {
+		in, out := &in.MetalGateways, &out.MetalGateways
+		*out = make([]VRFMetalGatewayStatus, len(*in))
 		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tags.
-func (in Tags) DeepCopy() Tags {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VRFStatus.
+func (in *VRFStatus) DeepCopy() *VRFStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(Tags)
+	out := new(VRFStatus)
 	in.DeepCopyInto(out)
-	return *out
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualCircuitStatus) DeepCopyInto(out *VirtualCircuitStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualCircuitStatus.
+func (in *VirtualCircuitStatus) DeepCopy() *VirtualCircuitStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualCircuitStatus)
+	in.DeepCopyInto(out)
+	return out
 }
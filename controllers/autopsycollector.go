@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// AutopsyCollector periodically deletes the autopsy ConfigMaps, recorded by
+// the PacketMachine controller before deleting a device, once they expired.
+// It runs only on the leader, after the caches have synced.
+type AutopsyCollector struct {
+	client.Client
+	Log logr.Logger
+	// Reader lists the ConfigMaps from the API server: a cached list would
+	// have the manager watch every ConfigMap of the cluster.
+	Reader client.Reader
+
+	// Interval between two collections.
+	Interval time.Duration
+}
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=create;list;delete
+
+// Start implements manager.Runnable.
+func (c *AutopsyCollector) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.collect(context.Background())
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect deletes the expired autopsies. Failures are logged, the collection
+// is retried on the next tick.
+func (c *AutopsyCollector) collect(ctx context.Context) {
+	autopsies := &corev1.ConfigMapList{}
+	if err := c.Reader.List(ctx, autopsies, client.HasLabels{infrastructurev1alpha3.AutopsyLabel}); err != nil {
+		c.Log.Error(errors.Wrap(err, "failed to list the autopsy ConfigMaps"), "skipping autopsy collection")
+		return
+	}
+
+	now := time.Now()
+	for i := range autopsies.Items {
+		autopsy := &autopsies.Items[i]
+		if !packet.AutopsyExpired(autopsy.Annotations, now) {
+			continue
+		}
+		log := c.Log.WithValues("configmap", autopsy.Namespace+"/"+autopsy.Name)
+		if err := c.Delete(ctx, autopsy); err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "failed to delete the expired autopsy")
+			continue
+		}
+		log.Info("Deleted the expired autopsy")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// BootstrapCallbackPath is the path prefix of the bootstrap callback endpoint.
+// Devices call <prefix><namespace>/<packetmachine name> once cloud-init is done.
+const BootstrapCallbackPath = "/bootstrap/"
+
+// BootstrapCallbackServer serves the endpoint devices call once their
+// bootstrap completed. A call authenticated with the token of the
+// PacketMachine annotates it, which lets the PacketMachine controller mark
+// the BootstrapSucceeded condition.
+type BootstrapCallbackServer struct {
+	client.Client
+	Log  logr.Logger
+	Addr string
+
+	// CertDir holds the tls.crt and tls.key the endpoint is served with. The
+	// endpoint is served over plain HTTP when empty, for a TLS terminating
+	// ingress to front it.
+	CertDir string
+}
+
+// ValidateBootstrapCallbackURL rejects the callback urls the tokens would be
+// sent over in clear text to.
+func ValidateBootstrapCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an https url", callbackURL)
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every replica
+// serves the callbacks.
+func (s *BootstrapCallbackServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *BootstrapCallbackServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(BootstrapCallbackPath, s)
+	srv := &http.Server{
+		Addr:         s.Addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("starting bootstrap callback server", "addr", s.Addr, "tls", s.CertDir != "")
+		var err error
+		if s.CertDir != "" {
+			err = srv.ListenAndServeTLS(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	case err := <-errCh:
+		return err
+	}
+}
+
+func (s *BootstrapCallbackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, BootstrapCallbackPath), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	key := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	logger := s.Log.WithValues("packetmachine", key.String())
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	tokenSecret := &corev1.Secret{}
+	secretKey := types.NamespacedName{Namespace: key.Namespace, Name: scope.BootstrapCallbackSecretName(key.Name)}
+	if err := s.Get(ctx, secretKey, tokenSecret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logger.Error(err, "failed to get bootstrap callback secret")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	expected := tokenSecret.Data[scope.BootstrapCallbackTokenKey]
+	if len(expected) == 0 || subtle.ConstantTimeCompare(expected, []byte(token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	packetMachine := &infrastructurev1alpha3.PacketMachine{}
+	if err := s.Get(ctx, key, packetMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.NotFound(w, r)
+			return
+		}
+		logger.Error(err, "failed to get PacketMachine")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, ok := packetMachine.Annotations[infrastructurev1alpha3.BootstrapCallbackAnnotation]; !ok {
+		patch := client.MergeFrom(packetMachine.DeepCopy())
+		if packetMachine.Annotations == nil {
+			packetMachine.Annotations = map[string]string{}
+		}
+		packetMachine.Annotations[infrastructurev1alpha3.BootstrapCallbackAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		if err := s.Patch(ctx, packetMachine, patch); err != nil {
+			logger.Error(err, "failed to annotate PacketMachine")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("device reported a completed bootstrap")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
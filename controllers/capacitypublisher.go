@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// CapacityPublisher periodically annotates the PacketMachineTemplates with the
+// capacity Packet reports for their machine type where their machines can be
+// placed, so that the cluster autoscaler, or any scheduler choosing the node
+// group to grow, can avoid the ones whose machine type is sold out.
+// It runs only on the leader, after the caches have synced.
+type CapacityPublisher struct {
+	client.Client
+	Log          logr.Logger
+	PacketClient packet.CapacityService
+
+	// Interval between two publications.
+	Interval time.Duration
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetmachinetemplates,verbs=get;list;watch;patch
+
+// Start implements manager.Runnable.
+func (c *CapacityPublisher) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.publish(context.Background())
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish annotates every PacketMachineTemplate with the capacity of its
+// machine type. Failures are logged, the publication is retried on the next
+// tick.
+func (c *CapacityPublisher) publish(ctx context.Context) {
+	templates := &infrastructurev1alpha3.PacketMachineTemplateList{}
+	if err := c.List(ctx, templates); err != nil {
+		c.Log.Error(errors.Wrap(err, "failed to list PacketMachineTemplates"), "skipping capacity publication")
+		return
+	}
+	if len(templates.Items) == 0 {
+		return
+	}
+
+	report, err := c.PacketClient.CapacityReport()
+	if err != nil {
+		c.Log.Error(err, "failed to get the capacity report, skipping capacity publication")
+		return
+	}
+	metros, err := c.PacketClient.FacilityMetros()
+	if err != nil {
+		c.Log.Error(err, "failed to list the facilities, skipping capacity publication")
+		return
+	}
+
+	checked := time.Now().UTC().Format(time.RFC3339)
+	for i := range templates.Items {
+		template := &templates.Items[i]
+		machineSpec := template.Spec.Template.Spec
+		logger := c.Log.WithValues("packetmachinetemplate", template.Namespace+"/"+template.Name, "machineType", machineSpec.MachineType)
+
+		clusterSpec, err := templateClusterSpec(ctx, c.Client, template)
+		if err != nil {
+			logger.Error(err, "failed to get the PacketCluster of the template")
+			continue
+		}
+
+		capacity := packet.PlanCapacity(report, machineSpec.MachineType, packet.CandidateFacilities(machineSpec, clusterSpec, metros))
+		if previous := template.Annotations[infrastructurev1alpha3.CapacityAnnotation]; previous != capacity {
+			logger.Info("capacity of the machine type changed", "capacity", capacity, "previous", previous)
+		}
+
+		patch := client.MergeFrom(template.DeepCopy())
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[infrastructurev1alpha3.CapacityAnnotation] = capacity
+		template.Annotations[infrastructurev1alpha3.CapacityCheckedAnnotation] = checked
+		if err := c.Patch(ctx, template, patch); err != nil {
+			logger.Error(err, "failed to annotate the template with its capacity")
+		}
+	}
+}
+
+// templateClusterSpec returns the spec of the PacketCluster a template is used
+// in, an empty one when the template does not belong to a cluster yet.
+func templateClusterSpec(ctx context.Context, c client.Client, template *infrastructurev1alpha3.PacketMachineTemplate) (infrastructurev1alpha3.PacketClusterSpec, error) {
+	cluster, err := util.GetOwnerCluster(ctx, c, template.ObjectMeta)
+	if err != nil {
+		return infrastructurev1alpha3.PacketClusterSpec{}, err
+	}
+	if cluster == nil {
+		name, ok := template.Labels[clusterv1.ClusterLabelName]
+		if !ok {
+			return infrastructurev1alpha3.PacketClusterSpec{}, nil
+		}
+		if cluster, err = util.GetClusterByName(ctx, c, template.Namespace, name); err != nil {
+			return infrastructurev1alpha3.PacketClusterSpec{}, err
+		}
+	}
+	if cluster.Spec.InfrastructureRef == nil {
+		return infrastructurev1alpha3.PacketClusterSpec{}, nil
+	}
+
+	packetCluster := &infrastructurev1alpha3.PacketCluster{}
+	key := client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Spec.InfrastructureRef.Name}
+	if err := c.Get(ctx, key, packetCluster); err != nil {
+		return infrastructurev1alpha3.PacketClusterSpec{}, err
+	}
+	return packetCluster.Spec, nil
+}
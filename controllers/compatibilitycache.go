@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// CompatibilityCache periodically refreshes the compatibility matrix of the
+// plans and operating systems Packet offers, consulted by the PacketMachine
+// validation webhook and by the PacketMachine controller before creating a
+// device. It runs on every replica, the webhook servers included. The matrix
+// can be up to an interval old: the controller only warns about the devices
+// it does not allow, Packet has the last word.
+type CompatibilityCache struct {
+	Log          logr.Logger
+	PacketClient packet.CompatibilityService
+
+	// Reader lists the PacketClusters, whose projects can have custom or
+	// reserved plans of their own. It reads from the API server, the cache
+	// of the webhook servers is not started before the matrix is fetched.
+	Reader client.Reader
+
+	// Interval between two refreshes.
+	Interval time.Duration
+
+	mu     sync.RWMutex
+	matrix *packet.CompatibilityMatrix
+}
+
+// Start implements manager.Runnable.
+func (c *CompatibilityCache) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.refresh()
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, the webhook
+// servers do not take part in the leader election.
+func (c *CompatibilityCache) NeedLeaderElection() bool {
+	return false
+}
+
+// Matrix returns the latest compatibility matrix, nil until it is first
+// fetched.
+func (c *CompatibilityCache) Matrix() *packet.CompatibilityMatrix {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.matrix
+}
+
+// refresh fetches the compatibility matrix, with the plans of the projects of
+// the PacketClusters. On failure the previous one is kept and the refresh is
+// retried on the next tick.
+func (c *CompatibilityCache) refresh() {
+	packetClusters := &infrastructurev1alpha3.PacketClusterList{}
+	if err := c.Reader.List(context.Background(), packetClusters); err != nil {
+		c.Log.Error(err, "failed to list the PacketClusters, keeping the compatibility matrix")
+		return
+	}
+	seen := map[string]bool{}
+	projectIDs := []string{}
+	for _, packetCluster := range packetClusters.Items {
+		if projectID := packetCluster.Spec.ProjectID; projectID != "" && !seen[projectID] {
+			seen[projectID] = true
+			projectIDs = append(projectIDs, projectID)
+		}
+	}
+	sort.Strings(projectIDs)
+
+	matrix, err := c.PacketClient.CompatibilityMatrix(projectIDs)
+	if err != nil {
+		c.Log.Error(err, "failed to refresh the compatibility matrix")
+		return
+	}
+	c.mu.Lock()
+	c.matrix = matrix
+	c.mu.Unlock()
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// ControllerConfigReconciler loads the controller ConfigMap into the settings
+// the other controllers read, so that they are changed without a restart.
+// Invalid settings are reported with an event on the ConfigMap and the
+// previous ones stay in effect; deleting the ConfigMap restores the flags.
+type ControllerConfigReconciler struct {
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Config   *packet.ConfigStore
+	// ConfigMap is the namespace and name of the controller ConfigMap.
+	ConfigMap types.NamespacedName
+
+	reader cache.Cache
+}
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+
+func (r *ControllerConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("configmap", req.NamespacedName)
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.reader.Get(ctx, req.NamespacedName, configMap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		configMap.Data = nil
+	}
+
+	if err := r.Config.Update(configMap.Data); err != nil {
+		// retrying does not fix the ConfigMap, its next update is reconciled
+		logger.Error(err, "invalid controller configuration, keeping the current one")
+		r.Recorder.Eventf(configMap, corev1.EventTypeWarning, "InvalidConfiguration", "Invalid controller configuration: %v", err)
+		return ctrl.Result{}, nil
+	}
+	logger.Info("Loaded controller configuration", "settings", len(configMap.Data))
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager watches the controller ConfigMap through a cache of the
+// ConfigMaps of its namespace, the manager does not cache ConfigMaps.
+func (r *ControllerConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	var err error
+	r.reader, err = cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: r.ConfigMap.Namespace,
+	})
+	if err != nil {
+		return err
+	}
+	if err := mgr.Add(r.reader); err != nil {
+		return err
+	}
+
+	c, err := controller.New("controllerconfig", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	isConfigMap := func(namespace, name string) bool {
+		return namespace == r.ConfigMap.Namespace && name == r.ConfigMap.Name
+	}
+	return c.Watch(
+		source.NewKindWithCache(&corev1.ConfigMap{}, r.reader),
+		&handler.EnqueueRequestForObject{},
+		predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return isConfigMap(e.Meta.GetNamespace(), e.Meta.GetName()) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return isConfigMap(e.MetaNew.GetNamespace(), e.MetaNew.GetName()) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return isConfigMap(e.Meta.GetNamespace(), e.Meta.GetName()) },
+			GenericFunc: func(e event.GenericEvent) bool { return isConfigMap(e.Meta.GetNamespace(), e.Meta.GetName()) },
+		},
+	)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+const (
+	// PacketClusterDeletionValidationPath is the path the PacketCluster
+	// delete protection webhook is served on.
+	PacketClusterDeletionValidationPath = "/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetcluster-delete"
+	// ClusterDeletionValidationPath is the path the Cluster delete protection
+	// webhook is served on.
+	ClusterDeletionValidationPath = "/validate-cluster-x-k8s-io-v1alpha3-cluster-delete"
+)
+
+// DeleteProtectionValidator rejects the deletion of the PacketClusters, and
+// of the Clusters of the PacketClusters, that set the delete protection
+// annotation, as deleting a Cluster deletes the devices of its machines
+// before getting to its PacketCluster. Clusters of other infrastructure
+// providers are admitted.
+type DeleteProtectionValidator struct {
+	Client client.Client
+
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:webhook:verbs=delete,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetcluster-delete,mutating=false,failurePolicy=fail,groups=infrastructure.cluster.x-k8s.io,resources=packetclusters,versions=v1alpha3,name=deleteprotection.packetcluster.infrastructure.cluster.x-k8s.io
+// +kubebuilder:webhook:verbs=delete,path=/validate-cluster-x-k8s-io-v1alpha3-cluster-delete,mutating=false,failurePolicy=fail,groups=cluster.x-k8s.io,resources=clusters,versions=v1alpha3,name=deleteprotection.cluster.infrastructure.cluster.x-k8s.io
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *DeleteProtectionValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *DeleteProtectionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Delete {
+		return admission.Allowed("")
+	}
+
+	if req.Kind.Kind == "PacketCluster" {
+		packetCluster := &infrastructurev1alpha3.PacketCluster{}
+		if err := v.decoder.DecodeRaw(req.OldObject, packetCluster); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if packet.DeleteProtected(packetCluster) {
+			return admission.Denied(deleteProtectedMessage("PacketCluster", packetCluster.Name))
+		}
+		return admission.Allowed("")
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := v.decoder.DecodeRaw(req.OldObject, cluster); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	ref := cluster.Spec.InfrastructureRef
+	if ref == nil || ref.Kind != "PacketCluster" || ref.GroupVersionKind().Group != infrastructurev1alpha3.GroupVersion.Group {
+		return admission.Allowed("")
+	}
+	if packet.DeleteProtected(cluster) {
+		return admission.Denied(deleteProtectedMessage("Cluster", cluster.Name))
+	}
+	packetCluster := &infrastructurev1alpha3.PacketCluster{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: ref.Name}, packetCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Allowed("")
+		}
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if packet.DeleteProtected(packetCluster) {
+		return admission.Denied(deleteProtectedMessage("PacketCluster", packetCluster.Name))
+	}
+	return admission.Allowed("")
+}
+
+func deleteProtectedMessage(kind, name string) string {
+	return fmt.Sprintf("%s %s is delete protected: remove its %s annotation first", kind, name, infrastructurev1alpha3.DeleteProtectionAnnotation)
+}
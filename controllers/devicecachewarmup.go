@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// DeviceCacheWarmUp warms the device cache of the Packet client up at startup,
+// listing the devices of the project of every PacketCluster at once, so that
+// the first reconciliations of the PacketMachines do not read their devices
+// one by one. It runs before the manager starts, hence the PacketClusters read
+// from the API server, and the devices are cached for the ttl of the cache.
+type DeviceCacheWarmUp struct {
+	Reader       client.Reader
+	Log          logr.Logger
+	PacketClient packet.DeviceCacheService
+
+	// Namespace restricts the PacketClusters to a namespace, empty for all.
+	Namespace string
+}
+
+// WarmUp warms the cache up. Failures are logged and do not prevent the
+// manager from starting: the devices are then read one by one. The warm up
+// stops at the deadline of ctx, the projects left are then not cached.
+func (w *DeviceCacheWarmUp) WarmUp(ctx context.Context) {
+	packetClusters := &infrastructurev1alpha3.PacketClusterList{}
+	if err := w.Reader.List(ctx, packetClusters, client.InNamespace(w.Namespace)); err != nil {
+		w.Log.Error(errors.Wrap(err, "failed to list PacketClusters"), "skipping device cache warm up")
+		return
+	}
+
+	start := time.Now()
+	projects := map[string]bool{}
+	cached := 0
+	for _, packetCluster := range packetClusters.Items {
+		projectID := packetCluster.Spec.ProjectID
+		if projectID == "" || projects[projectID] {
+			continue
+		}
+		if ctx.Err() != nil {
+			w.Log.Info("Device cache warm up timed out, the devices left are read one by one", "projects", len(projects), "devices", cached, "duration", time.Since(start).Round(time.Millisecond).String())
+			return
+		}
+		projects[projectID] = true
+
+		devices, err := w.PacketClient.WarmDeviceCache(projectID)
+		if err != nil {
+			w.Log.Error(err, "failed to warm the device cache up", "project", projectID)
+			continue
+		}
+		cached += devices
+	}
+	w.Log.Info("Warmed the device cache up", "projects", len(projects), "devices", cached, "duration", time.Since(start).Round(time.Millisecond).String())
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// ElasticIPCollector periodically releases the ip reservations tagged for a
+// cluster that no longer exists, e.g. because its PacketCluster was deleted
+// while the controller was not running.
+// It runs only on the leader, after the caches have synced.
+type ElasticIPCollector struct {
+	client.Client
+	Log          logr.Logger
+	PacketClient packet.IPService
+
+	// Config holds the interval between two collections, zero disabling
+	// them, the minimum age of the released reservations, which protects the
+	// ones of clusters being created whose PacketCluster may not be in the
+	// cache yet, and whether the collection only logs what it would release.
+	Config *packet.ConfigStore
+	// Projects are collected in addition to the ones of the existing
+	// PacketClusters, which do not cover projects whose last cluster is gone.
+	Projects []string
+}
+
+// disabledCollectionInterval is how often a disabled collection checks
+// whether the configuration enabled it.
+const disabledCollectionInterval = time.Minute
+
+// Start implements manager.Runnable.
+func (c *ElasticIPCollector) Start(stop <-chan struct{}) error {
+	for {
+		interval := c.Config.Get().ElasticIPGCInterval
+		if interval > 0 {
+			c.collect(context.Background())
+		} else {
+			interval = disabledCollectionInterval
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// collect releases the stale reservations of every known project. Failures
+// are logged, the collection is retried on the next tick.
+func (c *ElasticIPCollector) collect(ctx context.Context) {
+	packetClusters := &infrastructurev1alpha3.PacketClusterList{}
+	if err := c.List(ctx, packetClusters); err != nil {
+		c.Log.Error(errors.Wrap(err, "failed to list PacketClusters"), "skipping elastic ip collection")
+		return
+	}
+
+	// Reservations are tagged with the namespace and the name of their
+	// cluster. The legacy ones only hold the name, they are kept as long as a
+	// cluster with that name exists in the project.
+	clusters := map[string]map[string]bool{}
+	for _, project := range c.Projects {
+		clusters[project] = map[string]bool{}
+	}
+	for _, packetCluster := range packetClusters.Items {
+		project := packetCluster.Spec.ProjectID
+		if clusters[project] == nil {
+			clusters[project] = map[string]bool{}
+		}
+		if name, ok := packetCluster.Labels[clusterv1.ClusterLabelName]; ok {
+			clusters[project][name] = true
+			clusters[project][packetCluster.Namespace+"/"+name] = true
+		}
+		for _, ref := range packetCluster.OwnerReferences {
+			if ref.Kind == "Cluster" {
+				clusters[project][ref.Name] = true
+				clusters[project][packetCluster.Namespace+"/"+ref.Name] = true
+			}
+		}
+	}
+
+	config := c.Config.Get()
+	now := time.Now()
+	for project, names := range clusters {
+		logger := c.Log.WithValues("project", project)
+
+		reservations, err := c.PacketClient.ListClusterIPs(project)
+		if err != nil {
+			logger.Error(err, "failed to list ip reservations")
+			continue
+		}
+		for _, r := range packet.StaleIPReservations(reservations, names, config.ElasticIPGCMinAge, now) {
+			ipLogger := logger.WithValues("ip", r.Address, "reservation", r.ID, "cluster", r.ClusterKey())
+			if config.ElasticIPGCDryRun {
+				ipLogger.Info("would release stale elastic ip (dry run)")
+				continue
+			}
+			if err := c.PacketClient.ReleaseIP(r.ID); err != nil {
+				ipLogger.Error(err, "failed to release stale elastic ip")
+				continue
+			}
+			ipLogger.Info("released stale elastic ip")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// IPXEScriptPath is the path prefix of the iPXE scripts of the iPXE server.
+// Devices boot <prefix><namespace>/<packetmachine name>/<packetmachine uid>,
+// the uid keeping the scripts of the other machines out of reach.
+const IPXEScriptPath = "/ipxe/"
+
+// IPXEServer serves the iPXE scripts of the PacketMachines with a boot
+// profile, rendered from their PacketBootProfile when the device boots.
+type IPXEServer struct {
+	client.Client
+	Log  logr.Logger
+	Addr string
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: every replica
+// serves the scripts.
+func (s *IPXEServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *IPXEServer) Start(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(IPXEScriptPath, s)
+	srv := &http.Server{
+		Addr:         s.Addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("starting iPXE server", "addr", s.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case <-stop:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(ctx)
+	case err := <-errCh:
+		return err
+	}
+}
+
+func (s *IPXEServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, IPXEScriptPath), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	key := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	logger := s.Log.WithValues("packetmachine", key.String())
+
+	ctx := r.Context()
+	packetMachine := &infrastructurev1alpha3.PacketMachine{}
+	if err := s.Get(ctx, key, packetMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.NotFound(w, r)
+			return
+		}
+		logger.Error(err, "failed to get PacketMachine")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	// a wrong uid is not told from a missing machine
+	if subtle.ConstantTimeCompare([]byte(packetMachine.UID), []byte(parts[2])) != 1 || packetMachine.Spec.IPXEBootProfile == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	profile := &infrastructurev1alpha3.PacketBootProfile{}
+	profileKey := types.NamespacedName{Namespace: key.Namespace, Name: packetMachine.Spec.IPXEBootProfile}
+	if err := s.Get(ctx, profileKey, profile); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("boot profile not found", "profile", profileKey.Name)
+			http.NotFound(w, r)
+			return
+		}
+		logger.Error(err, "failed to get PacketBootProfile")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	script, err := packet.RenderIPXEScript(profile.Spec, packet.IPXEScriptVariables(packetMachine))
+	if err != nil {
+		logger.Error(err, "failed to render boot profile", "profile", profileKey.Name)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("serving iPXE script", "profile", profileKey.Name)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(script))
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// MachineDeploymentValidationPath is the path the MachineDeployment budget
+// webhook is served on.
+const MachineDeploymentValidationPath = "/validate-cluster-x-k8s-io-v1alpha3-machinedeployment"
+
+// MachineDeploymentBudgetValidator rejects the MachineDeployments whose
+// PacketMachineTemplate has a machine type costing more than the
+// MaxHourlyCostAnnotation of the MachineDeployment. MachineDeployments of
+// other infrastructure providers, without the annotation, or whose template
+// does not exist yet are admitted, and so is everything until the
+// compatibility matrix is first fetched.
+type MachineDeploymentBudgetValidator struct {
+	Client        client.Client
+	Compatibility *CompatibilityCache
+
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-cluster-x-k8s-io-v1alpha3-machinedeployment,mutating=false,failurePolicy=ignore,groups=cluster.x-k8s.io,resources=machinedeployments,versions=v1alpha3,name=budget.machinedeployment.infrastructure.cluster.x-k8s.io
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *MachineDeploymentBudgetValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *MachineDeploymentBudgetValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	md := &clusterv1.MachineDeployment{}
+	if err := v.decoder.DecodeRaw(req.Object, md); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	budget, ok, err := packet.MaxHourlyCost(md.Annotations)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	ref := md.Spec.Template.Spec.InfrastructureRef
+	if !ok || ref.Kind != "PacketMachineTemplate" || ref.GroupVersionKind().Group != infrastructurev1alpha3.GroupVersion.Group {
+		return admission.Allowed("")
+	}
+	matrix := v.Compatibility.Matrix()
+	if matrix == nil {
+		return admission.Allowed("")
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = md.Namespace
+	}
+	template := &infrastructurev1alpha3.PacketMachineTemplate{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Allowed("")
+		}
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if err := matrix.CheckBudget(template.Spec.Template.Spec.MachineType, budget); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
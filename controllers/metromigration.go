@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// The modes of the MetroMigrator.
+const (
+	// MetroMigrationReport only reports the migration of every cluster.
+	MetroMigrationReport = "report"
+	// MetroMigrationApply also updates the spec of the clusters.
+	MetroMigrationApply = "apply"
+)
+
+// metroMigrationClient is the part of the Packet API the metro migration
+// works with.
+type metroMigrationClient interface {
+	packet.DeviceService
+	packet.CapacityService
+}
+
+// MetroMigrator moves, once at startup, the PacketClusters that only set a
+// facility to the metro of that facility. It sets their metro, unsets their
+// facility when their control plane ip is not reserved in it, and reports
+// the devices outside of the metro that must be recreated.
+// It runs only on the leader, after the caches have synced.
+type MetroMigrator struct {
+	client.Client
+	Log          logr.Logger
+	Recorder     record.EventRecorder
+	PacketClient metroMigrationClient
+	// Apply updates the clusters, otherwise the migrations are only
+	// reported.
+	Apply bool
+}
+
+// Start implements manager.Runnable. Failures are logged and do not prevent
+// the manager from running: the migration is retried on the next startup.
+func (m *MetroMigrator) Start(stop <-chan struct{}) error {
+	ctx := context.Background()
+
+	packetClusters := &infrastructurev1alpha3.PacketClusterList{}
+	if err := m.List(ctx, packetClusters); err != nil {
+		m.Log.Error(errors.Wrap(err, "failed to list PacketClusters"), "skipping metro migration")
+		return nil
+	}
+
+	var facilityMetros map[string]string
+	for i := range packetClusters.Items {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		packetCluster := &packetClusters.Items[i]
+		if packetCluster.Spec.Facility == "" || packetCluster.Spec.Metro != "" {
+			continue
+		}
+		logger := m.Log.WithValues("packetcluster", packetCluster.Namespace+"/"+packetCluster.Name)
+
+		cluster, err := util.GetOwnerCluster(ctx, m.Client, packetCluster.ObjectMeta)
+		if err != nil || cluster == nil {
+			logger.Info("OwnerCluster is not available, skipping metro migration")
+			continue
+		}
+
+		if facilityMetros == nil {
+			if facilityMetros, err = m.PacketClient.FacilityMetros(); err != nil {
+				m.Log.Error(err, "failed to list the metros of the facilities, skipping metro migration")
+				return nil
+			}
+		}
+		devices, err := m.PacketClient.GetClusterDevices(packetCluster.Spec.ProjectID, cluster.Name)
+		if err != nil {
+			logger.Error(err, "failed to list the devices of the cluster, skipping metro migration")
+			continue
+		}
+
+		migration, _, err := packet.PlanMetroMigration(packetCluster.Spec, facilityMetros, devices)
+		if err != nil {
+			logger.Error(err, "can not migrate the cluster to a metro")
+			continue
+		}
+		if err := m.migrate(ctx, packetCluster, migration); err != nil {
+			logger.Error(err, "failed to migrate the cluster to a metro")
+			continue
+		}
+		logger.Info("planned metro migration", "metro", migration.Metro, "clearFacility", migration.ClearFacility,
+			"recreateDevices", migration.RecreateDevices, "applied", m.Apply)
+	}
+	return nil
+}
+
+// migrate updates the spec of packetCluster when applying, and reports the
+// devices to recreate.
+func (m *MetroMigrator) migrate(ctx context.Context, packetCluster *infrastructurev1alpha3.PacketCluster, migration packet.MetroMigration) error {
+	facility := packetCluster.Spec.Facility
+	if m.Apply {
+		patch := client.MergeFrom(packetCluster.DeepCopy())
+		packetCluster.Spec.Metro = migration.Metro
+		if migration.ClearFacility {
+			packetCluster.Spec.Facility = ""
+		}
+		if err := m.Patch(ctx, packetCluster, patch); err != nil {
+			return err
+		}
+		m.Recorder.Eventf(packetCluster, corev1.EventTypeNormal, "MigratedToMetro", "Set metro %s, the metro of facility %s", migration.Metro, facility)
+	} else {
+		m.Recorder.Eventf(packetCluster, corev1.EventTypeNormal, "MetroMigrationPlanned", "The cluster would move to metro %s, the metro of facility %s", migration.Metro, facility)
+	}
+
+	if len(migration.RecreateDevices) != 0 {
+		m.Recorder.Eventf(packetCluster, corev1.EventTypeWarning, "DevicesOutsideMetro",
+			"Devices %s are outside of metro %s and must be recreated", strings.Join(migration.RecreateDevices, ", "), migration.Metro)
+	}
+	return nil
+}
@@ -18,49 +18,128 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/packethost/packngo"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/tools/record"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
 	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
 	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/addons"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/dns"
 	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/tracing"
 )
 
+// packetClusterClient is the part of the Packet API the PacketCluster
+// controller works with.
+type packetClusterClient interface {
+	packet.DeviceService
+	packet.IPService
+	packet.CapacityService
+	packet.BGPService
+	packet.ProjectService
+	packet.ReservationService
+	packet.InterconnectionService
+	packet.VRFService
+	packet.LedgerService
+	packet.Tracer
+}
+
 // PacketClusterReconciler reconciles a PacketCluster object
 type PacketClusterReconciler struct {
 	client.Client
 	Log          logr.Logger
 	Recorder     record.EventRecorder
 	Scheme       *runtime.Scheme
-	PacketClient *packet.PacketClient
+	PacketClient packetClusterClient
+
+	// APIReader reads the ConfigMaps the controller publishes from the API
+	// server, the manager does not cache ConfigMaps.
+	APIReader client.Reader
+
+	// Config holds the settings that can change while the controller runs:
+	// how many devices are deleted in parallel when a cluster gets deleted,
+	// zero leaving the deletion to the PacketMachines.
+	Config *packet.ConfigStore
+
+	// Permissions probes the permissions of the API key in the project of
+	// every cluster. Nil skips the probe.
+	Permissions *packet.PermissionChecker
+
+	// ProjectDrift verifies that the project of every cluster still has the
+	// settings the cluster relies on. Nil skips the verification.
+	ProjectDrift *packet.ProjectDriftChecker
+
+	// Anomalies looks for the resources of every cluster wasting money. Nil
+	// skips the analysis.
+	Anomalies *packet.AnomalyAnalyzer
+
+	// CreateBreaker is shared with the PacketMachine controller, which stops
+	// creating the devices of a cluster after repeated failures. Nil when the
+	// creations are never stopped.
+	CreateBreaker *packet.CreateBreaker
+
+	// ProjectOrganization is the organization the dedicated projects of the
+	// clusters are created in, unless they set their own.
+	ProjectOrganization string
+
+	// InventoryExport publishes the inventory of every cluster in a
+	// ConfigMap. The prices of the plans come from Compatibility, nil
+	// leaving the costs out.
+	InventoryExport bool
+	Compatibility   *CompatibilityCache
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetclusters/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinedeployments;machinesets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=clusterresourcesets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
+// +kubebuilder:rbac:groups=externaldns.k8s.io,resources=dnsendpoints,verbs=get;list;watch;create;update;patch
 
 func (r *PacketClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
-	ctx := context.Background()
+	ctx, span := tracing.Start(context.Background(), "PacketCluster.Reconcile", attribute.String("packetcluster", req.NamespacedName.String()))
+	defer func() { tracing.End(span, reterr) }()
+	r = r.withTracing(ctx)
 	logger := r.Log.WithValues("packetcluster", req.NamespacedName)
 
+	_, fetchSpan := tracing.Start(ctx, "FetchScopes")
+
 	// your logic here
 	packetcluster := &infrastructurev1alpha3.PacketCluster{}
 	if err := r.Get(ctx, req.NamespacedName, packetcluster); err != nil {
 		if apierrors.IsNotFound(err) {
+			fetchSpan.End()
 			return ctrl.Result{}, nil
 		}
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, err
 	}
 
@@ -69,11 +148,13 @@ func (r *PacketClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	// Fetch the Machine.
 	cluster, err := util.GetOwnerCluster(ctx, r.Client, packetcluster.ObjectMeta)
 	if err != nil {
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, err
 	}
 
 	if cluster == nil {
 		logger.Info("OwnerCluster is not set yet. Requeuing...")
+		fetchSpan.End()
 		return ctrl.Result{
 			Requeue:      true,
 			RequeueAfter: 2 * time.Second,
@@ -82,6 +163,7 @@ func (r *PacketClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 
 	if util.IsPaused(cluster, packetcluster) {
 		logger.Info("PacketCluster or linked Cluster is marked as paused. Won't reconcile")
+		fetchSpan.End()
 		return ctrl.Result{}, nil
 	}
 
@@ -93,66 +175,1217 @@ func (r *PacketClusterReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		PacketCluster: packetcluster,
 	})
 	if err != nil {
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, errors.Errorf("failed to create scope: %+v", err)
 	}
+	fetchSpan.End()
+
 	// Always close the scope when exiting this function so we can persist any PacketCluster changes.
 	defer func() {
-		if err := clusterScope.Close(); err != nil && reterr == nil {
+		_, patchSpan := tracing.Start(ctx, "PatchStatus")
+		err := clusterScope.Close()
+		tracing.End(patchSpan, err)
+		if err != nil && reterr == nil {
 			reterr = err
 		}
 	}()
 
 	// Handle deleted clusters
-	if !cluster.DeletionTimestamp.IsZero() {
+	if !cluster.DeletionTimestamp.IsZero() || !packetcluster.DeletionTimestamp.IsZero() {
 		return r.reconcileDelete(clusterScope)
 	}
 
-	return r.reconcileNormal(packetcluster, clusterScope)
+	result, err := r.reconcileNormal(packetcluster, clusterScope)
+	if requeue := r.reconcileCreateBreaker(clusterScope); requeue > 0 && (result.RequeueAfter == 0 || requeue < result.RequeueAfter) {
+		result.RequeueAfter = requeue
+	}
+	return result, err
+}
+
+// reconcileCreateBreaker reports on the device creations of the cluster being
+// stopped, and returns when to check again that they resumed.
+func (r *PacketClusterReconciler) reconcileCreateBreaker(clusterScope *scope.ClusterScope) time.Duration {
+	packetcluster := clusterScope.PacketCluster
+	if r.CreateBreaker == nil {
+		conditions.Delete(packetcluster, v1alpha3.DeviceCreationAllowedCondition)
+		return 0
+	}
+	until, cause := r.CreateBreaker.Open(clusterKey(clusterScope))
+	if !until.IsZero() {
+		conditions.MarkFalse(packetcluster, v1alpha3.DeviceCreationAllowedCondition, v1alpha3.CreateCircuitOpenReason, clusterv1.ConditionSeverityWarning,
+			"Stopped creating devices until %s after repeated failures: %s", until.Format(time.RFC3339), cause)
+		return time.Until(until)
+	}
+	if conditions.Has(packetcluster, v1alpha3.DeviceCreationAllowedCondition) {
+		conditions.MarkTrue(packetcluster, v1alpha3.DeviceCreationAllowedCondition)
+	}
+	return 0
 }
 
 func (r *PacketClusterReconciler) reconcileNormal(packetcluster *v1alpha3.PacketCluster, clusterScope *scope.ClusterScope) (ctrl.Result, error) {
-	if ipReserv, err := r.PacketClient.GetIPByClusterIdentifier(clusterScope.Namespace(), clusterScope.Name(), packetcluster.Spec.ProjectID); err == packet.ErrControlPlanEndpointNotFound {
+	if packetcluster.Spec.Maintenance {
+		conditions.MarkTrue(packetcluster, v1alpha3.MaintenanceModeCondition)
+	} else {
+		conditions.Delete(packetcluster, v1alpha3.MaintenanceModeCondition)
+	}
+
+	switch {
+	case packetcluster.Spec.Metro != "":
+		conditions.MarkTrue(packetcluster, v1alpha3.MetroConfiguredCondition)
+	case packetcluster.Spec.Facility != "":
+		conditions.MarkFalse(packetcluster, v1alpha3.MetroConfiguredCondition, v1alpha3.FacilityDeprecatedReason, clusterv1.ConditionSeverityWarning,
+			"Clusters that only set a facility are deprecated, set the metro of facility %s", packetcluster.Spec.Facility)
+	default:
+		conditions.Delete(packetcluster, v1alpha3.MetroConfiguredCondition)
+	}
+
+	if err := packet.ValidateClusterLocation(packetcluster.Spec); err != nil {
+		r.Log.Error(err, "invalid cluster location")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.InvalidLocationReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	if err := packet.ValidateIPReservationScope(packetcluster.Spec); err != nil {
+		r.Log.Error(err, "invalid ip reservation scope")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.InvalidIPReservationScopeReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	if err := packet.ValidateIPReservationMetadata(packetcluster.Spec.IPReservationMetadata); err != nil {
+		r.Log.Error(err, "invalid ip reservation metadata")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.InvalidIPReservationMetadataReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	if err := packet.ValidateNetworkPolicy(packetcluster.Spec.NetworkPolicy); err != nil {
+		r.Log.Error(err, "invalid network policy")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.InvalidNetworkPolicyReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	if err := packet.ValidateRegistries(packetcluster.Spec.Registries); err != nil {
+		r.Log.Error(err, "invalid registries")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.InvalidRegistriesReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	if err := packet.ValidateNetworkingDependencies(packetcluster.Spec); err != nil {
+		r.Log.Error(err, "invalid networking")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.InvalidNetworkingReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// the finalizer is set before anything gets created, for the cleanup
+	// ledger to be consumed once the cluster is deleted
+	controllerutil.AddFinalizer(packetcluster, v1alpha3.ClusterFinalizer)
+	// so is the UID the resources get tagged with, for clusterctl move to
+	// carry it to the new PacketCluster
+	packet.RecordClusterUID(packetcluster)
+
+	if err := r.reconcileProject(clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !r.reconcilePermissions(packetcluster) {
+		return ctrl.Result{RequeueAfter: r.Permissions.Interval}, nil
+	}
+
+	owner := packet.ClusterIPOwner(clusterScope)
+	ipReserv, err := r.PacketClient.GetIPByClusterIdentifier(owner, packetcluster.Spec.ProjectID)
+	switch {
+	case err == packet.ErrControlPlanEndpointNotFound:
 		// There is not an ElasticIP with the right tags, at this point we can create one
-		ip, err := r.PacketClient.CreateIP(clusterScope.Namespace(), clusterScope.Name(), packetcluster.Spec.ProjectID, packetcluster.Spec.Facility)
+		ipScope, location := packet.IPReservationLocation(packetcluster.Spec)
+		ip, err := r.PacketClient.CreateIP(owner, packetcluster.Spec.ProjectID, ipScope, location, packetcluster.Spec.IPReservationMetadata)
 		if err != nil {
 			r.Log.Error(err, "error reserving an ip")
+			conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.IPReservationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 			return ctrl.Result{}, err
 		}
+		recordIPReservation(clusterScope, ip, location)
 		clusterScope.PacketCluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{
-			Host: ip.To4().String(),
+			Host: ip.Address,
 			Port: 6443,
 		}
-	} else {
+	case errors.Is(err, packet.ErrIPOwnedByAnotherCluster):
+		// A deleted cluster with the same namespace and name left its ip
+		// behind, reusing it must be asked for.
+		r.Log.Error(err, "control plane ip belongs to another cluster")
+		conditions.MarkFalse(packetcluster, v1alpha3.EndpointReadyCondition, v1alpha3.IPOwnedByAnotherClusterReason, clusterv1.ConditionSeverityError, "%s", err.Error())
+		return ctrl.Result{}, err
+	case err != nil:
+		r.Log.Error(err, "error looking up the control plane ip")
+		return ctrl.Result{}, err
+	default:
 		// If there is an ElasticIP with the right tag just use it again
+		_, location := packet.IPReservationLocation(packetcluster.Spec)
+		recordIPReservation(clusterScope, ipReserv, location)
 		clusterScope.PacketCluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{
 			Host: ipReserv.Address,
 			Port: 6443,
 		}
 	}
+
+	conditions.MarkTrue(packetcluster, v1alpha3.EndpointReadyCondition)
+
+	r.reconcileDNSRecords(context.TODO(), clusterScope)
+	r.reconcileBGP(context.TODO(), clusterScope)
+	r.reconcileFailureDomains(context.TODO(), clusterScope)
+	r.reconcileInterconnections(clusterScope)
+	r.reconcileVRFs(clusterScope)
+	r.reconcileProjectDrift(clusterScope)
+	r.reconcileAnomalies(context.TODO(), clusterScope)
+
+	if err := r.reconcileControlPlaneTopology(context.TODO(), clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	clusterScope.PacketCluster.Status.Ready = true
-	return ctrl.Result{}, nil
+
+	// The cloud integration and the egress addresses do not hold the cluster
+	// infrastructure back, errors are retried once the PacketCluster is ready.
+	if err := r.reconcileCloudIntegration(context.TODO(), clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileEgressIPs(context.TODO(), clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileInventory(context.TODO(), clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+	requeue := r.reconcilePatchReboots(context.TODO(), clusterScope)
+	if r.ProjectDrift != nil && packet.ReliesOnProjectSettings(packetcluster.Spec) && (requeue == 0 || r.ProjectDrift.Interval < requeue) {
+		requeue = r.ProjectDrift.Interval
+	}
+	if r.Anomalies != nil && (requeue == 0 || r.Anomalies.Interval < requeue) {
+		requeue = r.Anomalies.Interval
+	}
+	return ctrl.Result{RequeueAfter: requeue}, nil
+}
+
+// reconcileProject creates the dedicated project of the cluster, if any, and
+// points the cluster at it. The finalizer keeps the PacketCluster until the
+// project is deleted.
+func (r *PacketClusterReconciler) reconcileProject(clusterScope *scope.ClusterScope) error {
+	packetcluster := clusterScope.PacketCluster
+	dedicated := packetcluster.Spec.DedicatedProject
+	if err := packet.ValidateDedicatedProject(packetcluster.Spec, r.ProjectOrganization); err != nil {
+		r.Log.Error(err, "invalid project")
+		conditions.MarkFalse(packetcluster, v1alpha3.ProjectReadyCondition, v1alpha3.InvalidDedicatedProjectReason, clusterv1.ConditionSeverityError, err.Error())
+		return err
+	}
+	if dedicated == nil {
+		conditions.Delete(packetcluster, v1alpha3.ProjectReadyCondition)
+		return nil
+	}
+
+	if packetcluster.Spec.ProjectID == "" {
+		// project keys can not create projects, no need to ask the API
+		if r.Permissions != nil && r.Permissions.Scope() == packet.KeyScopeProject {
+			err := fmt.Errorf("dedicated projects can only be created with a user api key, the controller uses a project key: %w", packet.ErrInvalidRequest)
+			r.Log.Error(err, "invalid dedicated project")
+			conditions.MarkFalse(packetcluster, v1alpha3.ProjectReadyCondition, v1alpha3.InvalidDedicatedProjectReason, clusterv1.ConditionSeverityError, err.Error())
+			return err
+		}
+		organizationID := dedicated.OrganizationID
+		if organizationID == "" {
+			organizationID = r.ProjectOrganization
+		}
+		name := packet.DedicatedProjectName(clusterScope.Namespace(), clusterScope.Name(), packet.ClusterUID(packetcluster))
+		project, err := r.PacketClient.EnsureClusterProject(organizationID, name)
+		if err != nil {
+			r.Log.Error(err, "error creating the dedicated project")
+			conditions.MarkFalse(packetcluster, v1alpha3.ProjectReadyCondition, v1alpha3.ProjectCreationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return err
+		}
+		packetcluster.Spec.ProjectID = project.ID
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "ProjectCreated", "Using dedicated project %s (%s)", name, project.ID)
+	}
+	packetcluster.Status.ProjectID = packetcluster.Spec.ProjectID
+	conditions.MarkTrue(packetcluster, v1alpha3.ProjectReadyCondition)
+	return nil
+}
+
+// reconcilePermissions probes the permissions of the API key in the project
+// of the cluster. It returns false when some are missing, as nothing would
+// get created in the project. Failures to probe them are only logged.
+func (r *PacketClusterReconciler) reconcilePermissions(packetcluster *v1alpha3.PacketCluster) bool {
+	if r.Permissions == nil {
+		return true
+	}
+	projectID := packetcluster.Spec.ProjectID
+	permissions, err := r.Permissions.Check(projectID)
+	if err != nil {
+		r.Log.Error(err, "failed to probe the permissions of the api key", "project", projectID)
+		return true
+	}
+	if missing := permissions.Missing(); len(missing) != 0 {
+		msg := fmt.Sprintf("The api key lacks the %s permissions in project %s", strings.Join(missing, ", "), projectID)
+		conditions.MarkFalse(packetcluster, v1alpha3.APIPermissionsVerifiedCondition, v1alpha3.MissingAPIPermissionsReason, clusterv1.ConditionSeverityError, msg)
+		r.Recorder.Event(packetcluster, corev1.EventTypeWarning, v1alpha3.MissingAPIPermissionsReason, msg)
+		return false
+	}
+	conditions.MarkTrue(packetcluster, v1alpha3.APIPermissionsVerifiedCondition)
+	return true
+}
+
+// reconcileProjectDrift verifies that the project of the cluster still has
+// the settings the cluster relies on, which can be changed out of band. A
+// drift is reported rather than failing the next device creation, it does
+// not hold the cluster back.
+func (r *PacketClusterReconciler) reconcileProjectDrift(clusterScope *scope.ClusterScope) {
+	packetcluster := clusterScope.PacketCluster
+	if r.ProjectDrift == nil || !packet.ReliesOnProjectSettings(packetcluster.Spec) {
+		conditions.Delete(packetcluster, v1alpha3.ProjectSettingsVerifiedCondition)
+		return
+	}
+
+	drift, err := r.ProjectDrift.Check(string(packetcluster.UID), packetcluster.Generation, packetcluster.Spec)
+	if err != nil {
+		clusterScope.Error(err, "failed to verify the project settings")
+		conditions.MarkFalse(packetcluster, v1alpha3.ProjectSettingsVerifiedCondition, v1alpha3.ProjectSettingsCheckFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	if len(drift) > 0 {
+		msg := fmt.Sprintf("The settings of project %s changed: %s", packetcluster.Spec.ProjectID, strings.Join(drift, "; "))
+		if conditions.GetMessage(packetcluster, v1alpha3.ProjectSettingsVerifiedCondition) != msg {
+			r.Recorder.Event(packetcluster, corev1.EventTypeWarning, v1alpha3.ProjectSettingsDriftedReason, msg)
+		}
+		conditions.MarkFalse(packetcluster, v1alpha3.ProjectSettingsVerifiedCondition, v1alpha3.ProjectSettingsDriftedReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		return
+	}
+	conditions.MarkTrue(packetcluster, v1alpha3.ProjectSettingsVerifiedCondition)
+}
+
+// reconcileAnomalies looks for the resources of the cluster wasting money. They
+// are reported rather than deleted, whether they are still needed is for the
+// platform team to tell, and do not hold the cluster back.
+func (r *PacketClusterReconciler) reconcileAnomalies(ctx context.Context, clusterScope *scope.ClusterScope) {
+	packetcluster := clusterScope.PacketCluster
+	if r.Anomalies == nil {
+		conditions.Delete(packetcluster, v1alpha3.InfrastructureAnomalyFreeCondition)
+		packetcluster.Status.IdleHardwareReservations = nil
+		return
+	}
+
+	machines, err := clusterScope.PacketMachines(ctx)
+	if err != nil {
+		clusterScope.Error(err, "failed to analyze the anomalies of the cluster")
+		return
+	}
+	autoscaled, err := r.autoscaledNodeGroups(ctx, clusterScope)
+	if err != nil {
+		clusterScope.Error(err, "failed to analyze the anomalies of the cluster")
+		return
+	}
+	anomalies, idle, err := r.Anomalies.Analyze(packet.AnomalyInput{Cluster: packetcluster, Machines: machines, Autoscaled: autoscaled})
+	if err != nil {
+		clusterScope.Error(err, "failed to analyze the anomalies of the cluster")
+		conditions.MarkFalse(packetcluster, v1alpha3.InfrastructureAnomalyFreeCondition, v1alpha3.AnomalyAnalysisFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	packetcluster.Status.IdleHardwareReservations = idle
+	if len(anomalies) > 0 {
+		msg := fmt.Sprintf("Resources of the cluster may be wasted: %s", strings.Join(anomalies, "; "))
+		if conditions.GetMessage(packetcluster, v1alpha3.InfrastructureAnomalyFreeCondition) != msg {
+			r.Recorder.Event(packetcluster, corev1.EventTypeWarning, v1alpha3.InfrastructureAnomaliesFoundReason, msg)
+		}
+		conditions.MarkFalse(packetcluster, v1alpha3.InfrastructureAnomalyFreeCondition, v1alpha3.InfrastructureAnomaliesFoundReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		return
+	}
+	conditions.MarkTrue(packetcluster, v1alpha3.InfrastructureAnomalyFreeCondition)
+}
+
+// autoscaledNodeGroups returns the MachineDeployments and MachineSets of the
+// cluster the cluster autoscaler scales.
+func (r *PacketClusterReconciler) autoscaledNodeGroups(ctx context.Context, clusterScope *scope.ClusterScope) (packet.NodeGroups, error) {
+	groups := packet.NodeGroups{Deployments: map[string]bool{}, Sets: map[string]bool{}}
+	selector := client.MatchingLabels{clusterv1.ClusterLabelName: clusterScope.Name()}
+
+	deployments := &clusterv1.MachineDeploymentList{}
+	if err := r.List(ctx, deployments, client.InNamespace(clusterScope.Namespace()), selector); err != nil {
+		return groups, errors.Wrap(err, "failed to list MachineDeployments")
+	}
+	for _, deployment := range deployments.Items {
+		groups.Deployments[deployment.Name] = packet.Autoscaled(deployment.Annotations)
+	}
+	sets := &clusterv1.MachineSetList{}
+	if err := r.List(ctx, sets, client.InNamespace(clusterScope.Namespace()), selector); err != nil {
+		return groups, errors.Wrap(err, "failed to list MachineSets")
+	}
+	for _, set := range sets.Items {
+		groups.Sets[set.Name] = packet.Autoscaled(set.Annotations)
+	}
+	return groups, nil
+}
+
+// reconcileCloudIntegration renders the cloud controller manager and CSI
+// driver manifests of the cluster into the Secrets of a ClusterResourceSet,
+// and labels the Cluster for the ClusterResourceSet to apply them. Their
+// credentials are written to the workload cluster at every reconcile, for a
+// new API key to reach it.
+func (r *PacketClusterReconciler) reconcileCloudIntegration(ctx context.Context, clusterScope *scope.ClusterScope) error {
+	integration := clusterScope.PacketCluster.Spec.CloudIntegration
+	if integration == nil {
+		return nil
+	}
+
+	ref := integration.APIKeySecretRef
+	apiKeySecret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: clusterScope.Namespace(), Name: ref.Name}, apiKeySecret); err != nil {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityWarning, "failed to get the API key of the cloud integration: %v", err)
+		return errors.Wrap(err, "failed to get the API key of the cloud integration")
+	}
+	apiKey := string(apiKeySecret.Data[ref.Key])
+	if apiKey == "" {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityError, "secret %s has no key %s", ref.Name, ref.Key)
+		return nil
+	}
+	spec := clusterScope.PacketCluster.Spec
+	cfg := addons.Config{
+		APIKey:     apiKey,
+		ProjectID:  spec.ProjectID,
+		Metro:      spec.Metro,
+		Facility:   spec.Facility,
+		EIPTag:     packet.ControlPlaneIPTag(clusterScope.Namespace(), clusterScope.Name()),
+		CCMVersion: integration.CCMVersion,
+		CSIVersion: integration.CSIVersion,
+	}
+	name := clusterScope.PacketCluster.Name + "-cloud-integration"
+	ccm, err := addons.CCMManifests(cfg)
+	if err != nil {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return nil
+	}
+	resources := []addons.Resource{{Name: name + "-ccm", Manifests: ccm}}
+	if integration.CSI {
+		csi, err := addons.CSIManifests(cfg)
+		if err != nil {
+			conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			return nil
+		}
+		resources = append(resources, addons.Resource{Name: name + "-csi", Manifests: csi})
+	}
+
+	owner := *metav1.NewControllerRef(clusterScope.PacketCluster, v1alpha3.GroupVersion.WithKind("PacketCluster"))
+	labels := map[string]string{clusterv1.ClusterLabelName: clusterScope.Name()}
+	selector := map[string]string{v1alpha3.CloudIntegrationLabel: clusterScope.PacketCluster.Name}
+	if err := addons.EnsureResourceSet(ctx, r.Client, clusterScope.Namespace(), name, owner, labels, selector, resources); err != nil {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return err
+	}
+
+	cluster := clusterScope.Cluster
+	if cluster.Labels[v1alpha3.CloudIntegrationLabel] != clusterScope.PacketCluster.Name {
+		patch := client.MergeFrom(cluster.DeepCopy())
+		if cluster.Labels == nil {
+			cluster.Labels = map[string]string{}
+		}
+		cluster.Labels[v1alpha3.CloudIntegrationLabel] = clusterScope.PacketCluster.Name
+		if err := r.Patch(ctx, cluster, patch); err != nil {
+			conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return errors.Wrap(err, "failed to label the Cluster for the cloud integration")
+		}
+	}
+
+	if !cluster.Status.ControlPlaneInitialized {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.WaitingForControlPlaneReason, clusterv1.ConditionSeverityInfo, "")
+		return nil
+	}
+	secrets, err := addons.CloudConfigSecrets(cfg, integration.CSI)
+	if err != nil {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return nil
+	}
+	workloadClient, err := remote.NewClusterClient(ctx, r.Client, util.ObjectKey(cluster), nil)
+	if err == nil {
+		err = addons.EnsureSecrets(ctx, workloadClient, secrets)
+	}
+	if err != nil {
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition, v1alpha3.CloudIntegrationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return errors.Wrap(err, "failed to write the credentials of the cloud integration")
+	}
+
+	conditions.MarkTrue(clusterScope.PacketCluster, v1alpha3.CloudIntegrationReadyCondition)
+	return nil
+}
+
+// reconcileEgressIPs publishes the addresses the workloads of the cluster may
+// use as egress source in the status and in the <cluster>-egress-ips
+// ConfigMap, for firewall allow-lists to be generated from.
+func (r *PacketClusterReconciler) reconcileEgressIPs(ctx context.Context, clusterScope *scope.ClusterScope) error {
+	machines, err := clusterScope.PacketMachines(ctx)
+	if err != nil {
+		return err
+	}
+	ips := packet.EgressIPs(clusterScope.PacketCluster, machines)
+	clusterScope.PacketCluster.Status.EgressIPs = nil
+	if len(ips) > 0 {
+		clusterScope.PacketCluster.Status.EgressIPs = ips
+	}
+
+	if err := r.publishConfigMap(ctx, clusterScope, clusterScope.Name()+"-egress-ips", packet.EgressConfigMapData(ips)); err != nil {
+		return errors.Wrap(err, "failed to publish the egress addresses of the cluster")
+	}
+	return nil
+}
+
+// reconcileInventory publishes the inventory of the cluster in the
+// <packetcluster>-inventory ConfigMap, as JSON and CSV, for CMDB and budgeting
+// systems to read.
+func (r *PacketClusterReconciler) reconcileInventory(ctx context.Context, clusterScope *scope.ClusterScope) error {
+	if !r.InventoryExport {
+		return nil
+	}
+	machines, err := clusterScope.PacketMachines(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := packet.InventoryConfigMapData(packet.ClusterInventory(clusterScope.PacketCluster, machines, r.Compatibility.Matrix()))
+	if err != nil {
+		return errors.Wrap(err, "failed to render the inventory of the cluster")
+	}
+
+	if err := r.publishConfigMap(ctx, clusterScope, clusterScope.Name()+"-inventory", data); err != nil {
+		return errors.Wrap(err, "failed to publish the inventory of the cluster")
+	}
+	return nil
+}
+
+// publishConfigMap creates the ConfigMap of the cluster with data, or updates
+// it. The ConfigMap is read from the API server: the manager does not cache
+// ConfigMaps, reading them through its client would start an informer on
+// every ConfigMap of the management cluster.
+func (r *PacketClusterReconciler) publishConfigMap(ctx context.Context, clusterScope *scope.ClusterScope, name string, data map[string]string) error {
+	configMap := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: clusterScope.Namespace(), Name: name}
+	err := r.APIReader.Get(ctx, key, configMap)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if !exists {
+		configMap.Namespace = key.Namespace
+		configMap.Name = key.Name
+	}
+
+	configMap.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(clusterScope.PacketCluster, v1alpha3.GroupVersion.WithKind("PacketCluster"))})
+	if configMap.Labels == nil {
+		configMap.Labels = map[string]string{}
+	}
+	configMap.Labels[clusterv1.ClusterLabelName] = clusterScope.Name()
+	configMap.Data = data
+
+	if exists {
+		return r.Update(ctx, configMap)
+	}
+	return r.Create(ctx, configMap)
+}
+
+// withTracing returns a copy of the reconciler whose Packet API calls are
+// traced as children of the span of ctx.
+func (r *PacketClusterReconciler) withTracing(ctx context.Context) *PacketClusterReconciler {
+	traced := *r
+	traced.PacketClient = r.PacketClient.WithContext(ctx)
+	return &traced
+}
+
+// reconcileDNSRecords registers the control plane endpoint in the DNS zone of
+// the cluster, if any. Failures are reported on the DNSRecordsReady condition
+// without holding the cluster back.
+func (r *PacketClusterReconciler) reconcileDNSRecords(ctx context.Context, clusterScope *scope.ClusterScope) {
+	zone := clusterScope.PacketCluster.Spec.DNSZone
+	if zone == nil {
+		return
+	}
+
+	records := dns.ControlPlaneRecords(zone, clusterScope.Name(), clusterScope.PacketCluster.Spec.ControlPlaneEndpoint.Host)
+	owner := *metav1.NewControllerRef(clusterScope.PacketCluster, v1alpha3.GroupVersion.WithKind("PacketCluster"))
+	labels := map[string]string{clusterv1.ClusterLabelName: clusterScope.Name()}
+	if err := dns.EnsureEndpoint(ctx, r.Client, clusterScope.Namespace(), clusterScope.Name()+"-apiserver", owner, labels, zone, records); err != nil {
+		clusterScope.Error(err, "failed to register the control plane endpoint in DNS")
+		conditions.MarkFalse(clusterScope.PacketCluster, v1alpha3.DNSRecordsReadyCondition, v1alpha3.DNSRegistrationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	conditions.MarkTrue(clusterScope.PacketCluster, v1alpha3.DNSRecordsReadyCondition)
+}
+
+// reconcileBGP enables BGP on the project of the cluster. Packet can not
+// change the configuration of a project once enabled, a differing one is only
+// reported. BGP does not hold the cluster infrastructure back.
+func (r *PacketClusterReconciler) reconcileBGP(ctx context.Context, clusterScope *scope.ClusterScope) {
+	packetcluster := clusterScope.PacketCluster
+	bgp := packetcluster.Spec.BGP
+	if bgp == nil {
+		conditions.Delete(packetcluster, v1alpha3.BGPConfiguredCondition)
+		return
+	}
+
+	password := ""
+	if ref := bgp.PasswordSecretRef; ref != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: packetcluster.Namespace, Name: ref.Name}, secret); err != nil {
+			clusterScope.Error(err, "failed to get the bgp password")
+			conditions.MarkFalse(packetcluster, v1alpha3.BGPConfiguredCondition, v1alpha3.BGPConfigFailedReason, clusterv1.ConditionSeverityWarning, "failed to get the bgp password: %v", err)
+			return
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			conditions.MarkFalse(packetcluster, v1alpha3.BGPConfiguredCondition, v1alpha3.BGPConfigFailedReason, clusterv1.ConditionSeverityWarning, "secret %s has no key %s", ref.Name, ref.Key)
+			return
+		}
+		password = string(value)
+	}
+	req := packet.BGPConfigRequest(bgp, password)
+
+	projectID := packetcluster.Spec.ProjectID
+	config, err := r.PacketClient.GetBGPConfig(projectID)
+	if err == nil && config == nil {
+		if err = r.PacketClient.EnableBGP(projectID, req); err == nil {
+			clusterScope.Info("Enabled BGP on the project", "project", projectID, "asn", req.Asn)
+			config, err = r.PacketClient.GetBGPConfig(projectID)
+		}
+	}
+	if err != nil {
+		clusterScope.Error(err, "failed to configure bgp")
+		conditions.MarkFalse(packetcluster, v1alpha3.BGPConfiguredCondition, v1alpha3.BGPConfigFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+
+	switch {
+	case config == nil || config.Status == "requested":
+		conditions.MarkFalse(packetcluster, v1alpha3.BGPConfiguredCondition, v1alpha3.BGPConfigPendingReason, clusterv1.ConditionSeverityInfo, "")
+	case packet.BGPConfigDrift(config, req) != "":
+		msg := packet.BGPConfigDrift(config, req)
+		if conditions.GetReason(packetcluster, v1alpha3.BGPConfiguredCondition) != v1alpha3.BGPConfigMismatchReason {
+			r.Recorder.Event(packetcluster, corev1.EventTypeWarning, v1alpha3.BGPConfigMismatchReason, msg)
+		}
+		conditions.MarkFalse(packetcluster, v1alpha3.BGPConfiguredCondition, v1alpha3.BGPConfigMismatchReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+	default:
+		conditions.MarkTrue(packetcluster, v1alpha3.BGPConfiguredCondition)
+	}
+}
+
+// reconcileFailureDomains derives the failure domains of the cluster from the
+// hardware reservations of its project, or from its reservation affinities.
+// Failures keep the failure domains found before and do not hold the cluster
+// back.
+func (r *PacketClusterReconciler) reconcileFailureDomains(ctx context.Context, clusterScope *scope.ClusterScope) {
+	packetcluster := clusterScope.PacketCluster
+	if err := packet.ValidateReservationAffinities(packetcluster.Spec); err != nil {
+		clusterScope.Error(err, "invalid reservation affinities")
+		conditions.MarkFalse(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition, v1alpha3.InvalidReservationAffinityReason, clusterv1.ConditionSeverityError, err.Error())
+		return
+	}
+	if !packetcluster.Spec.FailureDomainsFromReservations {
+		if len(packetcluster.Spec.ReservationAffinities) > 0 {
+			packetcluster.Status.FailureDomains = packet.AffinityFailureDomains(packetcluster.Spec.ReservationAffinities)
+			conditions.MarkTrue(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition)
+			return
+		}
+		packetcluster.Status.FailureDomains = nil
+		conditions.Delete(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition)
+		return
+	}
+
+	reservations, err := r.PacketClient.HardwareReservations(packetcluster.Spec.ProjectID)
+	if err != nil {
+		clusterScope.Error(err, "failed to list the hardware reservations")
+		conditions.MarkFalse(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition, v1alpha3.ReservationListFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	metros, err := r.PacketClient.FacilityMetros()
+	if err != nil {
+		clusterScope.Error(err, "failed to list the metros of the facilities")
+		conditions.MarkFalse(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition, v1alpha3.ReservationListFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	controlPlanes, err := clusterScope.MachineFacilities(ctx, true)
+	if err != nil {
+		clusterScope.Error(err, "failed to count the control plane machines")
+		conditions.MarkFalse(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition, v1alpha3.ReservationListFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+
+	domains := packet.ReservationFailureDomains(reservations, packetcluster.Spec.Metro, metros, controlPlanes)
+	packetcluster.Status.FailureDomains = domains
+	if len(domains) == 0 {
+		conditions.MarkFalse(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition, v1alpha3.NoReservationsReason, clusterv1.ConditionSeverityWarning,
+			"project %s has no hardware reservations in the locations of the cluster", packetcluster.Spec.ProjectID)
+		return
+	}
+	conditions.MarkTrue(packetcluster, v1alpha3.FailureDomainsDiscoveredCondition)
+}
+
+// reconcileInterconnections provisions the interconnections of the cluster
+// and connects their virtual circuits to its VLANs. The ones no longer
+// declared are deleted. Interconnections do not hold the cluster back.
+func (r *PacketClusterReconciler) reconcileInterconnections(clusterScope *scope.ClusterScope) {
+	packetcluster := clusterScope.PacketCluster
+	spec := packetcluster.Spec
+	// the status remembers the interconnections to delete once all are removed
+	if len(spec.Interconnections) == 0 && len(packetcluster.Status.Interconnections) == 0 {
+		conditions.Delete(packetcluster, v1alpha3.InterconnectionsReadyCondition)
+		return
+	}
+	if err := packet.ValidateInterconnections(spec); err != nil {
+		r.Log.Error(err, "invalid interconnections")
+		conditions.MarkFalse(packetcluster, v1alpha3.InterconnectionsReadyCondition, v1alpha3.InvalidInterconnectionReason, clusterv1.ConditionSeverityError, err.Error())
+		return
+	}
+
+	uid := packet.ClusterUID(packetcluster)
+	existing, err := r.PacketClient.ClusterInterconnections(spec.ProjectID, uid)
+	if err != nil {
+		clusterScope.Error(err, "failed to list the interconnections")
+		conditions.MarkFalse(packetcluster, v1alpha3.InterconnectionsReadyCondition, v1alpha3.InterconnectionFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	connections := map[string]*packngo.Connection{}
+	for i := range existing {
+		connections[packet.InterconnectionName(existing[i])] = &existing[i]
+	}
+
+	var failed, missing, pending []string
+	statuses := make([]v1alpha3.InterconnectionStatus, 0, len(spec.Interconnections))
+	for _, interconnection := range spec.Interconnections {
+		status := v1alpha3.InterconnectionStatus{Name: interconnection.Name}
+		metro := packet.InterconnectionMetro(spec, interconnection)
+		connection, ok := connections[interconnection.Name]
+		delete(connections, interconnection.Name)
+		if !ok {
+			if connection, err = r.PacketClient.CreateInterconnection(spec.ProjectID, uid, clusterScope.Name(), metro, interconnection); err != nil {
+				clusterScope.Error(err, "failed to create the interconnection", "interconnection", interconnection.Name)
+				failed = append(failed, err.Error())
+				statuses = append(statuses, status)
+				continue
+			}
+			r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "InterconnectionCreated", "Requested interconnection %s (%s)", interconnection.Name, connection.ID)
+		}
+		status.ID = connection.ID
+		packet.RecordCreatedResource(&packetcluster.Status, v1alpha3.CreatedResource{
+			Kind: v1alpha3.CreatedResourceInterconnection, ID: connection.ID, FailureDomain: metro,
+		})
+		status.Status = connection.Status
+		status.Token = connection.Token
+
+		vlan, err := r.PacketClient.ProjectVLAN(spec.ProjectID, metro, int(interconnection.VLAN))
+		switch {
+		case err != nil:
+			clusterScope.Error(err, "failed to look the vlan up", "interconnection", interconnection.Name)
+			failed = append(failed, err.Error())
+		case vlan == nil:
+			missing = append(missing, fmt.Sprintf("VLAN %d in metro %s", interconnection.VLAN, metro))
+		default:
+			status.VirtualCircuits, err = r.PacketClient.ConnectVirtualCircuits(spec.ProjectID, connection, vlan, int(interconnection.NNIVLAN))
+			if err != nil {
+				clusterScope.Error(err, "failed to connect the virtual circuits", "interconnection", interconnection.Name)
+				failed = append(failed, err.Error())
+			}
+		}
+		if !packet.InterconnectionReady(status, interconnection.Redundant) {
+			pending = append(pending, interconnection.Name)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// the ones left are no longer declared
+	for name, connection := range connections {
+		if err := r.PacketClient.DeleteInterconnection(connection.ID); err != nil {
+			clusterScope.Error(err, "failed to delete the interconnection", "interconnection", name)
+			failed = append(failed, err.Error())
+			statuses = append(statuses, v1alpha3.InterconnectionStatus{Name: name, ID: connection.ID, Status: connection.Status})
+			continue
+		}
+		packet.ForgetCreatedResource(&packetcluster.Status, v1alpha3.CreatedResourceInterconnection, connection.ID)
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "InterconnectionDeleted", "Deleted interconnection %s (%s)", name, connection.ID)
+	}
+
+	packetcluster.Status.Interconnections = nil
+	if len(statuses) > 0 {
+		packetcluster.Status.Interconnections = statuses
+	}
+	switch {
+	case len(failed) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.InterconnectionsReadyCondition, v1alpha3.InterconnectionFailedReason, clusterv1.ConditionSeverityWarning, "%s", strings.Join(failed, "; "))
+	case len(missing) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.InterconnectionsReadyCondition, v1alpha3.VLANNotFoundReason, clusterv1.ConditionSeverityWarning,
+			"project %s has no %s", spec.ProjectID, strings.Join(missing, ", "))
+	case len(pending) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.InterconnectionsReadyCondition, v1alpha3.InterconnectionPendingReason, clusterv1.ConditionSeverityInfo,
+			"waiting for interconnections %s to be active", strings.Join(pending, ", "))
+	case len(spec.Interconnections) == 0:
+		conditions.Delete(packetcluster, v1alpha3.InterconnectionsReadyCondition)
+	default:
+		conditions.MarkTrue(packetcluster, v1alpha3.InterconnectionsReadyCondition)
+	}
+}
+
+// reconcileDeleteInterconnections deletes the interconnections of a cluster
+// being deleted, before its dedicated project.
+func (r *PacketClusterReconciler) reconcileDeleteInterconnections(clusterScope *scope.ClusterScope) error {
+	packetcluster := clusterScope.PacketCluster
+	if len(packetcluster.Spec.Interconnections) == 0 && len(packetcluster.Status.Interconnections) == 0 {
+		return nil
+	}
+	connections, err := r.PacketClient.ClusterInterconnections(packetcluster.Spec.ProjectID, packet.ClusterUID(packetcluster))
+	if err != nil {
+		return err
+	}
+	for _, connection := range connections {
+		if err := r.PacketClient.DeleteInterconnection(connection.ID); err != nil {
+			return err
+		}
+		packet.ForgetCreatedResource(&packetcluster.Status, v1alpha3.CreatedResourceInterconnection, connection.ID)
+		clusterScope.Info("Deleted the interconnection", "interconnection", packet.InterconnectionName(connection), "id", connection.ID)
+	}
+	packetcluster.Status.Interconnections = nil
+	return nil
+}
+
+// reconcileVRFs provisions the VRFs of the cluster, the IP reservations of
+// the networks of their metal gateways and the metal gateways binding them to
+// VLANs. The ones no longer declared are deleted. VRFs do not hold the cluster
+// back.
+func (r *PacketClusterReconciler) reconcileVRFs(clusterScope *scope.ClusterScope) {
+	packetcluster := clusterScope.PacketCluster
+	spec := packetcluster.Spec
+	// the status remembers the vrfs to delete once all are removed
+	if len(spec.VRFs) == 0 && len(packetcluster.Status.VRFs) == 0 {
+		conditions.Delete(packetcluster, v1alpha3.VRFsReadyCondition)
+		return
+	}
+	if err := packet.ValidateVRFs(spec); err != nil {
+		r.Log.Error(err, "invalid vrfs")
+		conditions.MarkFalse(packetcluster, v1alpha3.VRFsReadyCondition, v1alpha3.InvalidVRFReason, clusterv1.ConditionSeverityError, err.Error())
+		return
+	}
+
+	uid := packet.ClusterUID(packetcluster)
+	existing, err := r.PacketClient.ClusterVRFs(spec.ProjectID, uid)
+	if err != nil {
+		clusterScope.Error(err, "failed to list the vrfs")
+		conditions.MarkFalse(packetcluster, v1alpha3.VRFsReadyCondition, v1alpha3.VRFFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	vrfs := map[string]*packet.VRF{}
+	for i := range existing {
+		vrfs[packet.VRFName(existing[i])] = &existing[i]
+	}
+
+	var failed, missing, pending []string
+	statuses := make([]v1alpha3.VRFStatus, 0, len(spec.VRFs))
+	for _, declared := range spec.VRFs {
+		status := v1alpha3.VRFStatus{Name: declared.Name}
+		metro := packet.VRFMetro(spec, declared)
+		vrf, ok := vrfs[declared.Name]
+		delete(vrfs, declared.Name)
+		if !ok {
+			if vrf, err = r.PacketClient.CreateVRF(spec.ProjectID, uid, clusterScope.Name(), metro, declared); err != nil {
+				clusterScope.Error(err, "failed to create the vrf", "vrf", declared.Name)
+				failed = append(failed, err.Error())
+				statuses = append(statuses, status)
+				continue
+			}
+			r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "VRFCreated", "Created VRF %s (%s)", declared.Name, vrf.ID)
+		}
+		status.ID = vrf.ID
+		packet.RecordCreatedResource(&packetcluster.Status, v1alpha3.CreatedResource{Kind: v1alpha3.CreatedResourceVRF, ID: vrf.ID, FailureDomain: metro})
+
+		keep := make([]string, 0, len(declared.MetalGateways))
+		complete := true
+		for _, gateway := range declared.MetalGateways {
+			vlan, err := r.PacketClient.ProjectVLAN(spec.ProjectID, metro, int(gateway.VLAN))
+			switch {
+			case err != nil:
+				clusterScope.Error(err, "failed to look the vlan up", "vrf", declared.Name)
+				failed = append(failed, err.Error())
+				complete = false
+				continue
+			case vlan == nil:
+				missing = append(missing, fmt.Sprintf("VLAN %d in metro %s", gateway.VLAN, metro))
+				complete = false
+				continue
+			}
+			gatewayStatus, err := r.PacketClient.EnsureVRFMetalGateway(spec.ProjectID, uid, vrf, vlan, gateway.Network)
+			if err != nil {
+				clusterScope.Error(err, "failed to create the metal gateway", "vrf", declared.Name, "vlan", gateway.VLAN)
+				failed = append(failed, err.Error())
+				complete = false
+				continue
+			}
+			packet.RecordCreatedResource(&packetcluster.Status, v1alpha3.CreatedResource{
+				Kind: v1alpha3.CreatedResourceIPReservation, ID: gatewayStatus.IPReservationID, FailureDomain: metro,
+			})
+			packet.RecordCreatedResource(&packetcluster.Status, v1alpha3.CreatedResource{
+				Kind: v1alpha3.CreatedResourceMetalGateway, ID: gatewayStatus.ID, FailureDomain: metro,
+			})
+			keep = append(keep, gatewayStatus.ID)
+			status.MetalGateways = append(status.MetalGateways, gatewayStatus)
+		}
+		// the metal gateways no longer declared are pruned once the declared
+		// ones are known, not to delete one failing to be looked up
+		if complete {
+			if err := r.PacketClient.PruneVRFMetalGateways(spec.ProjectID, vrf, keep); err != nil {
+				clusterScope.Error(err, "failed to delete the metal gateways no longer declared", "vrf", declared.Name)
+				failed = append(failed, err.Error())
+			}
+		}
+		status.RoutesPropagated = packet.VRFRoutesPropagated(status, len(declared.MetalGateways))
+		if !status.RoutesPropagated {
+			pending = append(pending, declared.Name)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// the ones left are no longer declared
+	for name, vrf := range vrfs {
+		if err := r.PacketClient.DeleteVRF(spec.ProjectID, vrf.ID); err != nil {
+			clusterScope.Error(err, "failed to delete the vrf", "vrf", name)
+			failed = append(failed, err.Error())
+			statuses = append(statuses, v1alpha3.VRFStatus{Name: name, ID: vrf.ID})
+			continue
+		}
+		forgetVRF(packetcluster, vrf.ID)
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "VRFDeleted", "Deleted VRF %s (%s)", name, vrf.ID)
+	}
+
+	packetcluster.Status.VRFs = nil
+	if len(statuses) > 0 {
+		packetcluster.Status.VRFs = statuses
+	}
+	switch {
+	case len(failed) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.VRFsReadyCondition, v1alpha3.VRFFailedReason, clusterv1.ConditionSeverityWarning, "%s", strings.Join(failed, "; "))
+	case len(missing) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.VRFsReadyCondition, v1alpha3.VLANNotFoundReason, clusterv1.ConditionSeverityWarning,
+			"project %s has no %s", spec.ProjectID, strings.Join(missing, ", "))
+	case len(pending) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.VRFsReadyCondition, v1alpha3.VRFPendingReason, clusterv1.ConditionSeverityInfo,
+			"waiting for the metal gateways of VRFs %s to be ready", strings.Join(pending, ", "))
+	case len(spec.VRFs) == 0:
+		conditions.Delete(packetcluster, v1alpha3.VRFsReadyCondition)
+	default:
+		conditions.MarkTrue(packetcluster, v1alpha3.VRFsReadyCondition)
+	}
+}
+
+// reconcileDeleteVRFs deletes the VRFs of a cluster being deleted, with
+// their metal gateways and IP reservations, before its dedicated project.
+func (r *PacketClusterReconciler) reconcileDeleteVRFs(clusterScope *scope.ClusterScope) error {
+	packetcluster := clusterScope.PacketCluster
+	if len(packetcluster.Spec.VRFs) == 0 && len(packetcluster.Status.VRFs) == 0 {
+		return nil
+	}
+	vrfs, err := r.PacketClient.ClusterVRFs(packetcluster.Spec.ProjectID, packet.ClusterUID(packetcluster))
+	if err != nil {
+		return err
+	}
+	for _, vrf := range vrfs {
+		if err := r.PacketClient.DeleteVRF(packetcluster.Spec.ProjectID, vrf.ID); err != nil {
+			return err
+		}
+		forgetVRF(packetcluster, vrf.ID)
+		clusterScope.Info("Deleted the vrf", "vrf", packet.VRFName(vrf), "id", vrf.ID)
+	}
+	packetcluster.Status.VRFs = nil
+	return nil
+}
+
+// reconcileControlPlaneTopology reports in the status the address reserved
+// for the control plane in every facility hosting control plane machines.
+// ElasticIPs for facilities other than the cluster one are reserved by the
+// PacketMachine controller when the first machine gets placed there.
+func (r *PacketClusterReconciler) reconcileControlPlaneTopology(ctx context.Context, clusterScope *scope.ClusterScope) error {
+	spec := clusterScope.PacketCluster.Spec
+
+	counts, err := clusterScope.MachineFacilities(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	primary := v1alpha3.ControlPlaneLocation{
+		Facility: spec.Facility,
+		Address:  spec.ControlPlaneEndpoint.Host,
+		Machines: int32(counts[spec.Facility]),
+	}
+	// metro and global ips are shared by the control plane machines of every facility
+	if ipScope, _ := packet.IPReservationLocation(spec); ipScope != v1alpha3.IPReservationScopeFacility {
+		primary.Facility = ""
+		primary.Machines = 0
+		for _, c := range counts {
+			primary.Machines += int32(c)
+		}
+	}
+	topology := []v1alpha3.ControlPlaneLocation{primary}
+
+	if spec.ControlPlaneEndpointStrategy == v1alpha3.ControlPlaneEndpointStrategyElasticIPPerFacility {
+		facilities := make([]string, 0, len(counts))
+		for facility := range counts {
+			if facility != spec.Facility {
+				facilities = append(facilities, facility)
+			}
+		}
+		sort.Strings(facilities)
+
+		for _, facility := range facilities {
+			ip, err := r.PacketClient.GetIPByFacilityIdentifier(packet.ClusterIPOwner(clusterScope), spec.ProjectID, facility)
+			switch {
+			case err == packet.ErrControlPlanEndpointNotFound:
+				continue
+			case err != nil:
+				return err
+			}
+			recordIPReservation(clusterScope, ip, facility)
+			topology = append(topology, v1alpha3.ControlPlaneLocation{
+				Facility: facility,
+				Address:  ip.Address,
+				Machines: int32(counts[facility]),
+			})
+		}
+	}
+
+	clusterScope.PacketCluster.Status.ControlPlaneTopology = topology
+	return nil
 }
 
 func (r *PacketClusterReconciler) reconcileDelete(clusterScope *scope.ClusterScope) (ctrl.Result, error) {
-	// Initially I created this handler to remove an elastic IP when a cluster
-	// gets delete, but it does not sound like a good idea.  It is better to
-	// leave to the users the ability to decide if they want to keep and resign
-	// the IP or if they do not need it anymore
+	if packet.DeleteProtected(clusterScope.PacketCluster, clusterScope.Cluster) {
+		clusterScope.Info("Cluster is delete protected, keeping its resources")
+		r.Recorder.Eventf(clusterScope.PacketCluster, corev1.EventTypeWarning, v1alpha3.DeleteProtectedReason,
+			"The cluster is delete protected, remove the %s annotation to delete its resources", v1alpha3.DeleteProtectionAnnotation)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	if r.ProjectDrift != nil {
+		r.ProjectDrift.Forget(string(clusterScope.PacketCluster.UID))
+	}
+	// The ip reservations of the cluster are released with the rest of its
+	// cleanup ledger, unless the users decide to keep and reassign them
+	if clusterScope.PacketCluster.Spec.PersistElasticIPOnDelete {
+		// parked reservations are not released by the ledger nor by the
+		// elastic ip collection
+		parked, err := r.PacketClient.ParkClusterIPs(clusterScope.Namespace(), clusterScope.Name(), clusterScope.PacketCluster.Spec.ProjectID)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if parked > 0 {
+			clusterScope.Info("Parked the ip reservations of the cluster", "reservations", parked)
+		}
+	}
+	if concurrency := r.Config.Get().ClusterDeletionConcurrency; concurrency > 0 {
+		if result, err := r.reconcileDeleteDevices(clusterScope, concurrency); err != nil || result != (ctrl.Result{}) {
+			return result, err
+		}
+	}
+	if err := r.reconcileDeleteInterconnections(clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileDeleteVRFs(clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileDeleteCreatedResources(clusterScope); err != nil {
+		return ctrl.Result{}, err
+	}
+	return r.reconcileDeleteProject(clusterScope)
+}
+
+// reconcileDeleteCreatedResources deletes what is left of the cleanup ledger
+// of the cluster once the PacketCluster itself is being deleted, after the
+// machines of the cluster are gone. The resources the steps above deleted,
+// or that are gone otherwise, are simply forgotten. The ledger keeps the ones
+// failing to be deleted, for the next attempt.
+func (r *PacketClusterReconciler) reconcileDeleteCreatedResources(clusterScope *scope.ClusterScope) error {
+	packetcluster := clusterScope.PacketCluster
+	if !controllerutil.ContainsFinalizer(packetcluster, v1alpha3.ClusterFinalizer) || packetcluster.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	for _, resource := range packet.CreatedResourcesTeardown(packetcluster.Status.CreatedResources) {
+		if err := r.PacketClient.ReleaseCreatedResource(packetcluster.Spec.ProjectID, resource); err != nil {
+			r.Recorder.Eventf(packetcluster, corev1.EventTypeWarning, "CreatedResourceDeletionFailed",
+				"Failed to delete %s %s: %v", resource.Kind, resource.ID, err)
+			return err
+		}
+		packet.ForgetCreatedResource(&packetcluster.Status, resource.Kind, resource.ID)
+		clusterScope.Info("Deleted a resource of the cleanup ledger", "kind", resource.Kind, "id", resource.ID, "failureDomain", resource.FailureDomain)
+	}
+	return nil
+}
+
+// recordIPReservation records in the cleanup ledger of the cluster an ip
+// reservation the controller made for it in failureDomain. Reservations tagged
+// with the UID of another cluster, or with none, were not, they are left out.
+func recordIPReservation(clusterScope *scope.ClusterScope, ip packngo.IPAddressReservation, failureDomain string) {
+	packetcluster := clusterScope.PacketCluster
+	if !packet.ItemsInList(ip.Tags, []string{packet.GenerateClusterUIDTag(packet.ClusterUID(packetcluster))}) {
+		return
+	}
+	packet.RecordCreatedResource(&packetcluster.Status, v1alpha3.CreatedResource{
+		Kind: v1alpha3.CreatedResourceIPReservation, ID: ip.ID, FailureDomain: failureDomain,
+	})
+}
+
+// forgetVRF removes a deleted VRF from the cleanup ledger of the cluster, with
+// the metal gateways and ip reservations its status reports, which are
+// deleted along with it.
+func forgetVRF(packetcluster *v1alpha3.PacketCluster, id string) {
+	for _, status := range packetcluster.Status.VRFs {
+		if status.ID != id {
+			continue
+		}
+		for _, gateway := range status.MetalGateways {
+			packet.ForgetCreatedResource(&packetcluster.Status, v1alpha3.CreatedResourceMetalGateway, gateway.ID)
+			packet.ForgetCreatedResource(&packetcluster.Status, v1alpha3.CreatedResourceIPReservation, gateway.IPReservationID)
+		}
+	}
+	packet.ForgetCreatedResource(&packetcluster.Status, v1alpha3.CreatedResourceVRF, id)
+}
+
+// reconcileDeleteProject deletes the dedicated project of the cluster once
+// the PacketCluster itself is being deleted, which Cluster API does after the
+// machines of the cluster are gone, and lets the PacketCluster go.
+func (r *PacketClusterReconciler) reconcileDeleteProject(clusterScope *scope.ClusterScope) (ctrl.Result, error) {
+	packetcluster := clusterScope.PacketCluster
+	if !controllerutil.ContainsFinalizer(packetcluster, v1alpha3.ClusterFinalizer) || packetcluster.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	if projectID := packetcluster.Spec.ProjectID; projectID != "" && packetcluster.Spec.DedicatedProject != nil {
+		name := packet.DedicatedProjectName(clusterScope.Namespace(), clusterScope.Name(), packet.ClusterUID(packetcluster))
+		remaining, err := r.PacketClient.DeleteClusterProject(projectID, name)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if remaining > 0 {
+			clusterScope.Info("Waiting for the devices of the dedicated project to be deleted", "project", projectID, "devices", remaining)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		clusterScope.Info("Deleted the dedicated project", "project", projectID)
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "ProjectDeleted", "Deleted dedicated project %s", projectID)
+	}
+	controllerutil.RemoveFinalizer(packetcluster, v1alpha3.ClusterFinalizer)
 	return ctrl.Result{}, nil
 }
 
-func (r *PacketClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+const deviceStateDeprovisioning = "deprovisioning"
+
+// reconcileDeleteDevices deletes the devices of the cluster in batches of
+// concurrency parallel requests, instead of waiting for every
+// PacketMachine to delete its own. The PacketMachines find their device gone
+// and just drop their finalizer. Only the devices tagged with the UID of the
+// cluster are deleted: the cluster tag does not tell apart the clusters with
+// the same name in other namespaces of the project, and the devices without
+// the UID tag are left to their PacketMachine.
+func (r *PacketClusterReconciler) reconcileDeleteDevices(clusterScope *scope.ClusterScope, concurrency int) (ctrl.Result, error) {
+	packetcluster := clusterScope.PacketCluster
+
+	clusterDevices, err := r.PacketClient.GetManagedClusterDevices(packetcluster.Spec.ProjectID, packet.ClusterUID(packetcluster))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// deleted devices stay listed for a while, and the locked ones and the
+	// ones running on protected hardware reservations are left to their
+	// PacketMachine, which only unlocks the devices it locked
+	devices := make([]packngo.Device, 0, len(clusterDevices))
+	protected := 0
+	locked := 0
+	reservations := map[string]bool{}
+	for _, device := range clusterDevices {
+		if device.State == deviceStateDeprovisioning {
+			continue
+		}
+		if device.Locked {
+			locked++
+			continue
+		}
+		if reservationID := packet.DeviceReservationID(&device); reservationID != "" {
+			if _, ok := reservations[reservationID]; !ok {
+				if reservations[reservationID], err = r.PacketClient.IsReservationProtected(reservationID); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			if reservations[reservationID] {
+				protected++
+				continue
+			}
+		}
+		devices = append(devices, device)
+	}
+
+	progress := packetcluster.Status.DeletionProgress
+	if progress == nil {
+		progress = &v1alpha3.DeletionProgress{}
+		packetcluster.Status.DeletionProgress = progress
+	}
+	// devices created after the deletion started are part of the total too
+	if remaining := int32(len(devices) + protected + locked); progress.Deleted+remaining > progress.Total {
+		progress.Total = progress.Deleted + remaining
+	}
+	if len(devices) == 0 {
+		if protected > 0 || locked > 0 {
+			clusterScope.Info("Waiting for the PacketMachines of locked devices and protected hardware reservations", "protected", protected, "locked", locked)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		progress.Deleted = progress.Total
+		return ctrl.Result{}, nil
+	}
+
+	if len(devices) > concurrency {
+		devices = devices[:concurrency]
+	}
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+
+	deleted, errs := r.PacketClient.DeleteDevices(ids, concurrency)
+	progress.Deleted += int32(deleted)
+	clusterScope.Info("Deleting cluster devices", "deleted", progress.Deleted, "total", progress.Total)
+	if len(errs) > 0 {
+		return ctrl.Result{}, kerrors.NewAggregate(errs)
+	}
+
+	// give the api some room before the next batch
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+// SetupWithManager registers the PacketCluster controller, options setting how
+// many PacketClusters are reconciled in parallel.
+func (r *PacketClusterReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1alpha3.PacketCluster{}).
+		WithOptions(options).
 		Watches(
 			&source.Kind{Type: &clusterv1.Cluster{}},
 			&handler.EnqueueRequestsFromMapFunc{
 				ToRequests: util.ClusterToInfrastructureMapFunc(infrastructurev1alpha3.GroupVersion.WithKind("PacketCluster")),
 			},
 		).
+		Watches(
+			&source.Kind{Type: &infrastructurev1alpha3.PacketMachine{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.packetMachineToPacketCluster),
+			},
+		).
 		Complete(r)
 }
 
+// packetMachineToPacketCluster maps a PacketMachine to the PacketCluster of
+// its cluster, so the control plane topology and the egress addresses stay
+// current.
+func (r *PacketClusterReconciler) packetMachineToPacketCluster(o handler.MapObject) []ctrl.Request {
+	labels := o.Meta.GetLabels()
+	if _, ok := labels[clusterv1.ClusterLabelName]; !ok {
+		return nil
+	}
+
+	cluster, err := util.GetClusterByName(context.TODO(), r.Client, o.Meta.GetNamespace(), labels[clusterv1.ClusterLabelName])
+	if err != nil || cluster.Spec.InfrastructureRef == nil {
+		return nil
+	}
+
+	return []ctrl.Request{{
+		NamespacedName: client.ObjectKey{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Spec.InfrastructureRef.Name,
+		},
+	}}
+}
+
 // MachineNotFound error representing that the requested device was not yet found
 type MachineNotFound struct {
 	err string
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// PacketClusterValidationPath is the path the PacketCluster validation
+// webhook is served on.
+const PacketClusterValidationPath = "/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetcluster"
+
+// PacketClusterValidator rejects the PacketClusters without a project, or
+// whose networking fields are invalid or inconsistent with one another, as
+// the controller would only report it on their conditions. Updates of PacketClusters that were already
+// invalid are admitted, for the controllers to keep updating them.
+type PacketClusterValidator struct {
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetcluster,mutating=false,failurePolicy=ignore,groups=infrastructure.cluster.x-k8s.io,resources=packetclusters,versions=v1alpha3,name=validation.packetcluster.infrastructure.cluster.x-k8s.io
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *PacketClusterValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *PacketClusterValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	packetCluster := &infrastructurev1alpha3.PacketCluster{}
+	if err := v.decoder.DecodeRaw(req.Object, packetCluster); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	err := validatePacketCluster(packetCluster.Spec)
+	if err == nil {
+		return admission.Allowed("")
+	}
+	if req.Operation == admissionv1beta1.Update {
+		old := &infrastructurev1alpha3.PacketCluster{}
+		if err := v.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if validatePacketCluster(old.Spec) != nil {
+			return admission.Allowed("")
+		}
+	}
+	return admission.Denied(err.Error())
+}
+
+// validatePacketCluster checks the fields of a PacketCluster the webhook
+// validates.
+func validatePacketCluster(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	if err := packet.ValidateProjectID(spec); err != nil {
+		return err
+	}
+	// the CEL rules of the CRD are dropped by the api servers older than 1.25
+	if err := packet.ValidateClusterLocation(spec); err != nil {
+		return err
+	}
+	if err := packet.ValidateNodeCredentials(spec); err != nil {
+		return err
+	}
+	return packet.ValidateClusterNetworking(spec)
+}
@@ -20,62 +20,172 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
-	"github.com/google/uuid"
 	"github.com/packethost/packngo"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
 	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/dns"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
 	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/tracing"
 
 	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
 )
 
 const (
-	force = true
+	// billingHourMargin is how long before the end of its billing hour a
+	// device kept until then gets deleted, so that its deletion completes
+	// before the next hour starts.
+	billingHourMargin = 5 * time.Minute
+
+	// ipAssignBaseDelay and ipAssignMaxDelay bound the delay between two
+	// attempts to assign the control plane ElasticIP to a device.
+	ipAssignBaseDelay = 5 * time.Second
+	ipAssignMaxDelay  = 2 * time.Minute
 )
 
+// packetMachineClient is the part of the Packet API the PacketMachine
+// controller works with.
+type packetMachineClient interface {
+	packet.DeviceService
+	packet.IPService
+	packet.CapacityService
+	packet.ImageService
+	packet.BGPService
+	packet.InterconnectionService
+	packet.VRFService
+	packet.NodeKeyService
+	packet.Tracer
+}
+
 // PacketMachineReconciler reconciles a PacketMachine object
 type PacketMachineReconciler struct {
 	client.Client
 	Log          logr.Logger
 	Recorder     record.EventRecorder
 	Scheme       *runtime.Scheme
-	PacketClient *packet.PacketClient
+	PacketClient packetMachineClient
+
+	// APIReader reads the ConfigMaps of the template values from the API
+	// server, the manager does not cache ConfigMaps.
+	APIReader client.Reader
+
+	// Config holds the settings that can change while the controller runs:
+	// the bootstrap token TTL, the bootstrap callback timeout, the autopsy
+	// TTL and the allowed machine types.
+	Config *packet.ConfigStore
+
+	// BootstrapCallbackURL is the base url of the bootstrap callback server,
+	// rendered in the userdata of the devices. Empty disables the callback.
+	BootstrapCallbackURL string
+
+	// IPXEServerURL is the base url devices reach the iPXE server at, the
+	// devices of the machines with a boot profile boot its scripts. Empty
+	// rejects these machines.
+	IPXEServerURL string
+
+	// Compatibility, when set, rejects the machines whose machine type,
+	// operating system and location Packet can not fulfill before creating
+	// their device.
+	Compatibility *CompatibilityCache
+
+	// LabelSync mirrors the labels of the machines under a prefix into the
+	// tags of their devices, and the device tags under another prefix into
+	// the labels of the PacketMachines.
+	LabelSync packet.LabelSync
+
+	// NodeLabels labels the nodes of the workload clusters with the facts of
+	// their devices, see packet.NodeLabels.
+	NodeLabels bool
+
+	// WarmPool, when set, hands the devices kept warm for the template of a
+	// new machine over to it instead of creating one.
+	WarmPool *WarmPool
+
+	// CreateBreaker, when set, stops creating the devices of a cluster for a
+	// while after their creation failed repeatedly.
+	CreateBreaker *packet.CreateBreaker
+
+	// ReservationClaims, when set, keeps the machines sharing hardware
+	// reservations from trying the same one at the same time.
+	ReservationClaims *packet.ReservationClaims
+
+	// UserDataHistory, when set, logs how the userdata rendered for a machine
+	// differs from the one of the previous machine of its node group.
+	UserDataHistory *packet.UserDataHistory
+
+	// ProvisioningSLO, when set, is how long the node of a machine may take
+	// to become ready from the creation request of its device.
+	ProvisioningSLO time.Duration
+
+	// NodeReadinessCheck holds the PacketMachines back from being ready
+	// until the node of their device registered with the workload cluster,
+	// for the devices whose kubelet never joins to be caught.
+	NodeReadinessCheck bool
+
+	// StrictDeviceOwnership only lets the controller change and delete the
+	// devices carrying the uid tag of their cluster, or those of the
+	// PacketMachines set with the adopt-device annotation. Otherwise the
+	// devices found without the tag, or with the one of another cluster, get
+	// it.
+	StrictDeviceOwnership bool
+
+	// ipAssignBackoff spaces out the retries of the assignment of the
+	// control plane ElasticIP of each machine.
+	ipAssignBackoff workqueue.RateLimiter
 }
 
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetmachines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=patch
 // +kubebuilder:rbac:groups=bootstrap.cluster.x-k8s.io,resources=kubeadmconfigs;kubeadmconfigs/status,verbs=get;list;watch
-// +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets;,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get
+// +kubebuilder:rbac:groups=externaldns.k8s.io,resources=dnsendpoints,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetmachinetemplates;packetmachinetemplategrants,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetresourcequotas,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetbootprofiles,verbs=get;list;watch
 
 func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
-	ctx := context.Background()
+	ctx, span := tracing.Start(context.Background(), "PacketMachine.Reconcile", attribute.String("packetmachine", req.NamespacedName.String()))
+	defer func() { tracing.End(span, reterr) }()
+	r = r.withTracing(ctx)
 	logger := r.Log.WithValues("packetmachine", req.NamespacedName)
 
+	_, fetchSpan := tracing.Start(ctx, "FetchScopes")
+
 	// your logic here
 	packetmachine := &infrastructurev1alpha3.PacketMachine{}
 	if err := r.Get(ctx, req.NamespacedName, packetmachine); err != nil {
 		if apierrors.IsNotFound(err) {
+			fetchSpan.End()
 			return ctrl.Result{}, nil
 		}
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, err
 	}
 
@@ -84,10 +194,12 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	// Fetch the Machine.
 	machine, err := util.GetOwnerMachine(ctx, r.Client, packetmachine.ObjectMeta)
 	if err != nil {
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, err
 	}
 	if machine == nil {
 		logger.Info("Machine Controller has not yet set OwnerRef")
+		fetchSpan.End()
 		return ctrl.Result{}, nil
 	}
 
@@ -97,6 +209,7 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machine.ObjectMeta)
 	if err != nil {
 		logger.Info("Machine is missing cluster label or cluster does not exist")
+		fetchSpan.End()
 		return ctrl.Result{}, nil
 	}
 
@@ -104,6 +217,7 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 
 	if util.IsPaused(cluster, machine) {
 		logger.Info("PacketMachine or linked Cluster is marked as paused. Won't reconcile")
+		fetchSpan.End()
 		return ctrl.Result{}, nil
 	}
 
@@ -114,6 +228,7 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	}
 	if err := r.Get(ctx, packetclusterNamespacedName, packetcluster); err != nil {
 		logger.Info("PacketCluster is not available yet")
+		fetchSpan.End()
 		return ctrl.Result{}, nil
 	}
 
@@ -127,6 +242,7 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		PacketCluster: packetcluster,
 	})
 	if err != nil {
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, err
 	}
 
@@ -134,18 +250,24 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 	machineScope, err := scope.NewMachineScope(ctx, scope.MachineScopeParams{
 		Logger:        logger,
 		Client:        r.Client,
+		Reader:        r.APIReader,
 		Cluster:       cluster,
 		Machine:       machine,
 		PacketCluster: packetcluster,
 		PacketMachine: packetmachine,
 	})
 	if err != nil {
+		tracing.End(fetchSpan, err)
 		return ctrl.Result{}, fmt.Errorf("failed to create scope: %w", err)
 	}
+	fetchSpan.End()
 
 	// Always close the scope when exiting this function so we can persist any PacketMachine changes.
 	defer func() {
-		if err := machineScope.Close(); err != nil && reterr == nil {
+		_, patchSpan := tracing.Start(ctx, "PatchStatus")
+		err := machineScope.Close()
+		tracing.End(patchSpan, err)
+		if err != nil && reterr == nil {
 			reterr = err
 		}
 	}()
@@ -155,21 +277,115 @@ func (r *PacketMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, re
 		return r.reconcileDelete(ctx, machineScope, clusterScope, logger)
 	}
 
-	return r.reconcile(ctx, machineScope, clusterScope, logger)
+	graceResult, err := r.reconcileDeletionGrace(ctx, machineScope, logger)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result, err := r.reconcile(ctx, machineScope, clusterScope, logger)
+	if graceResult.RequeueAfter > 0 && (result.RequeueAfter == 0 || graceResult.RequeueAfter < result.RequeueAfter) {
+		result.RequeueAfter = graceResult.RequeueAfter
+	}
+	return result, err
 }
 
-func (r *PacketMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// reconcileDeletionGrace holds the drain of a deleted Machine for the grace
+// period it is annotated with, through a pre-drain hook the Cluster API waits
+// for. The hook is set as long as the Machine has a grace period, and removed
+// once the period elapsed after the deletion.
+func (r *PacketMachineReconciler) reconcileDeletionGrace(ctx context.Context, machineScope *scope.MachineScope, logger logr.Logger) (ctrl.Result, error) {
+	machine := machineScope.Machine
+	grace, err := packet.DeletionGracePeriod(machine.Annotations)
+	if err != nil {
+		// an invalid grace period must not hold the machine forever
+		logger.Info("Ignoring the deletion grace period", "error", err.Error())
+	}
+	_, hooked := machine.Annotations[infrastructurev1alpha3.DeletionGraceHookAnnotation]
+	deleted := !machine.DeletionTimestamp.IsZero()
+
+	patch := client.MergeFrom(machine.DeepCopy())
+	switch {
+	case grace > 0 && !hooked && !deleted:
+		if machine.Annotations == nil {
+			machine.Annotations = map[string]string{}
+		}
+		machine.Annotations[infrastructurev1alpha3.DeletionGraceHookAnnotation] = "cluster-api-provider-packet"
+	case hooked && deleted && grace > 0:
+		if remaining := time.Until(machine.DeletionTimestamp.Add(grace)); remaining > 0 {
+			logger.Info("Holding the drain of the machine for its deletion grace period", "remaining", remaining.Round(time.Second).String())
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+		delete(machine.Annotations, infrastructurev1alpha3.DeletionGraceHookAnnotation)
+	case hooked && grace == 0:
+		delete(machine.Annotations, infrastructurev1alpha3.DeletionGraceHookAnnotation)
+	default:
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.Patch(ctx, machine, patch); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to patch the deletion grace hook of Machine %s: %w", machine.Name, err)
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager registers the PacketMachine controller, options setting how
+// many PacketMachines are reconciled in parallel.
+func (r *PacketMachineReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	r.ipAssignBackoff = workqueue.NewItemExponentialFailureRateLimiter(ipAssignBaseDelay, ipAssignMaxDelay)
+	if err := mgr.GetFieldIndexer().IndexField(&clusterv1.Machine{}, machineBootstrapDataSecretField, func(obj runtime.Object) []string {
+		machine, ok := obj.(*clusterv1.Machine)
+		if !ok || machine.Spec.Bootstrap.DataSecretName == nil {
+			return nil
+		}
+		return []string{*machine.Spec.Bootstrap.DataSecretName}
+	}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1alpha3.PacketMachine{}).
+		WithOptions(options).
 		Watches(
 			&source.Kind{Type: &clusterv1.Machine{}},
 			&handler.EnqueueRequestsFromMapFunc{
 				ToRequests: util.MachineToInfrastructureMapFunc(infrastructurev1alpha3.GroupVersion.WithKind("PacketMachine")),
 			},
 		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.secretToPacketMachines),
+			},
+		).
 		Complete(r)
 }
 
+// machineBootstrapDataSecretField indexes the Machines by the name of their
+// bootstrap data secret.
+const machineBootstrapDataSecretField = "spec.bootstrap.dataSecretName"
+
+// secretToPacketMachines maps a bootstrap data secret to the PacketMachines of
+// the Machines using it, so that they are reconciled as soon as their
+// bootstrap data is written.
+func (r *PacketMachineReconciler) secretToPacketMachines(o handler.MapObject) []ctrl.Request {
+	machines := &clusterv1.MachineList{}
+	if err := r.List(context.Background(), machines, client.InNamespace(o.Meta.GetNamespace()), client.MatchingFields{machineBootstrapDataSecretField: o.Meta.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list the Machines of a bootstrap data secret", "secret", o.Meta.GetName(), "namespace", o.Meta.GetNamespace())
+		return nil
+	}
+
+	gk := infrastructurev1alpha3.GroupVersion.WithKind("PacketMachine").GroupKind()
+	var requests []ctrl.Request
+	for _, machine := range machines.Items {
+		ref := machine.Spec.InfrastructureRef
+		if ref.Name == "" || ref.GroupVersionKind().GroupKind() != gk {
+			continue
+		}
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: machine.Namespace, Name: ref.Name}})
+	}
+	return requests
+}
+
 func (r *PacketMachineReconciler) reconcile(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope, logger logr.Logger) (ctrl.Result, error) {
 	logger.Info("Reconciling PacketMachine")
 	packetmachine := machineScope.PacketMachine
@@ -184,16 +400,45 @@ func (r *PacketMachineReconciler) reconcile(ctx context.Context, machineScope *s
 
 	if !machineScope.Cluster.Status.InfrastructureReady {
 		machineScope.Info("Cluster infrastructure is not ready yet")
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForClusterInfrastructureReason, clusterv1.ConditionSeverityInfo, "")
 		return ctrl.Result{}, nil
 	}
 
-	// Make sure bootstrap data secret is available and populated.
-	if machineScope.Machine.Spec.Bootstrap.DataSecretName == nil {
+	providerID := machineScope.GetInstanceID()
+
+	// The referenced template is only read until the device gets created,
+	// revoking its grant does not affect the existing machines.
+	if providerID == "" && packetmachine.Spec.TemplateRef != nil {
+		reason, err := r.reconcileTemplateRef(ctx, machineScope)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason != "" {
+			machineScope.Info("Waiting for the referenced template", "reason", reason)
+			conditions.MarkFalse(packetmachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForTemplateReason, clusterv1.ConditionSeverityWarning, "%s", reason)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+	}
+
+	// Make sure bootstrap data secret is available and populated before
+	// creating the device. The machine is reconciled again when the secret
+	// shows up or changes, see secretToPacketMachines.
+	if providerID == "" {
+		ready, reason, err := machineScope.BootstrapDataReady(ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !ready {
+			machineScope.Info("Bootstrap data is not yet available", "reason", reason)
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, reason)
+			return ctrl.Result{}, nil
+		}
+	} else if machineScope.Machine.Spec.Bootstrap.DataSecretName == nil {
 		machineScope.Info("Bootstrap data secret is not yet available")
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, "")
 		return ctrl.Result{}, nil
 	}
 
-	providerID := machineScope.GetInstanceID()
 	var (
 		dev                  *packngo.Device
 		addrs                []corev1.NodeAddress
@@ -204,17 +449,86 @@ func (r *PacketMachineReconciler) reconcile(ctx context.Context, machineScope *s
 	if providerID != "" {
 		dev, err = r.PacketClient.GetDevice(providerID)
 		if err != nil {
+			if packeterrors.IsNotFound(err) {
+				// the device got deleted outside of the cluster api, the machine can not recover
+				machineScope.SetErrorReason(capierrors.UpdateMachineError)
+				machineScope.SetErrorMessage(fmt.Errorf("device %s not found", providerID))
+				conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceNotFoundReason, clusterv1.ConditionSeverityError, "device %s not found", providerID)
+			}
+			return ctrl.Result{}, err
+		}
+		if managed, err := r.reconcileDeviceOwnership(machineScope, dev); err != nil || !managed {
 			return ctrl.Result{}, err
 		}
 	}
 	if dev == nil {
+		if clusterScope.PacketCluster.Spec.Maintenance {
+			machineScope.Info("PacketCluster is in maintenance mode, not creating the device")
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.MaintenanceModeReason, clusterv1.ConditionSeverityInfo, "")
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		if r.CreateBreaker != nil {
+			if until, cause := r.CreateBreaker.Open(clusterKey(clusterScope)); !until.IsZero() {
+				machineScope.Info("Device creation is stopped for the cluster after repeated failures", "until", until)
+				conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.CreateCircuitOpenReason, clusterv1.ConditionSeverityWarning,
+					"device creation is stopped until %s after repeated failures: %s", until.Format(time.RFC3339), cause)
+				return ctrl.Result{RequeueAfter: time.Until(until)}, nil
+			}
+		}
+
+		// Devices take a while to boot, make sure the join token rendered in
+		// the bootstrap data is still valid before spending one on it.
+		tokenExpiration, fresh, err := r.bootstrapTokenFreshness(ctx, machineScope)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !fresh {
+			machineScope.Info("Bootstrap token is expired, waiting for the bootstrap provider to refresh it")
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, "bootstrap token is expired")
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
+
+		caCertificate, err := machineScope.GetClusterCACertificate(ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
 		createDeviceReq := packet.CreateDeviceRequest{
-			MachineScope: machineScope,
+			MachineScope:             machineScope,
+			ClusterCACertificate:     caCertificate,
+			BootstrapTokenExpiration: tokenExpiration,
+			ReservationClaims:        r.ReservationClaims,
+			UserDataHistory:          r.UserDataHistory,
 		}
-		mUID := uuid.New().String()
+		if r.BootstrapCallbackURL != "" {
+			token, err := machineScope.GetBootstrapCallbackToken(ctx)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			createDeviceReq.BootstrapCallbackURL = r.bootstrapCallbackURL(machineScope)
+			createDeviceReq.BootstrapCallbackToken = token
+		}
+		// the device is tagged with the UID of the PacketMachine for a
+		// creation or an adoption whose result got lost to be found again
+		machineTag := packet.GenerateMachineTag(string(machineScope.PacketMachine.UID))
 		tags := []string{
-			packet.GenerateMachineTag(mUID),
+			machineTag,
 			packet.GenerateClusterTag(clusterScope.Name()),
+			packet.GenerateClusterUIDTag(packet.ClusterUID(clusterScope.PacketCluster)),
+		}
+
+		facility, err := r.machineFacility(ctx, machineScope, clusterScope)
+		if errors.Is(err, packet.ErrNoCapacity) {
+			machineScope.Info("No capacity left for the machine type, retrying later", "error", err.Error())
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.NoCapacityReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if facility != "" {
+			createDeviceReq.Facility = facility
+			machineScope.PacketMachine.Status.Facility = facility
 		}
 
 		// when the node is a control plan we should check if the elastic ip
@@ -222,104 +536,1050 @@ func (r *PacketMachineReconciler) reconcile(ctx context.Context, machineScope *s
 		// current node to use it.
 		if machineScope.IsControlPlane() {
 			controlPlaneEndpoint, _ = r.PacketClient.GetIPByClusterIdentifier(
-				clusterScope.Namespace(),
-				clusterScope.Name(),
+				packet.ClusterIPOwner(clusterScope),
 				clusterScope.PacketCluster.Spec.ProjectID)
-			if len(controlPlaneEndpoint.Assignments) == 0 {
+			createDeviceReq.ControlPlaneEndpoint = controlPlaneEndpoint.Address
+
+			facilityEndpoint, err := r.controlPlaneIP(clusterScope, facility)
+			if err != nil && err != packet.ErrControlPlanEndpointNotFound {
+				return ctrl.Result{}, fmt.Errorf("failed to reserve control plane ip in facility %s: %w", facility, err)
+			}
+			if facilityEndpoint.Address != "" && len(facilityEndpoint.Assignments) == 0 {
 				a := corev1.NodeAddress{
 					Type:    corev1.NodeExternalIP,
-					Address: controlPlaneEndpoint.Address,
+					Address: facilityEndpoint.Address,
 				}
 				addrs = append(addrs, a)
 			}
-			createDeviceReq.ControlPlaneEndpoint = controlPlaneEndpoint.Address
+			createDeviceReq.FacilityControlPlaneEndpoint = facilityEndpoint.Address
+		}
+
+		deviceFacility := packet.DeviceFacility(machineScope, createDeviceReq.Facility)
+		err = r.validateDeviceLocation(clusterScope, deviceFacility)
+		if err == nil {
+			err = packet.ValidateTemplateValuesFrom(machineScope.PacketMachine.Spec.TemplateValuesFrom)
+		}
+		if err == nil {
+			err = packet.ValidateUserTags(machineScope.PacketMachine.Spec.Tags)
+		}
+		if spec := machineScope.PacketMachine.Spec; err == nil && spec.Device == nil {
+			err = r.Config.Get().CheckMachineType(spec.MachineType)
+			if err == nil && spec.ImageRef != nil {
+				err = r.checkImage(spec)
+			}
+		}
+		if matrix := r.Compatibility.Matrix(); err == nil && matrix != nil {
+			// the cached matrix can be stale: the device is still requested,
+			// Packet rejects it if it really can not be created
+			if incompatible := matrix.CheckMachine(machineScope.PacketMachine.Spec, deviceFacility, clusterScope.PacketCluster.Spec.Metro); incompatible != nil {
+				machineScope.Info("The compatibility matrix does not allow the device, requesting it anyway", "reason", incompatible.Error())
+				r.Recorder.Eventf(machineScope.PacketMachine, corev1.EventTypeWarning, "IncompatibleDevice", "The cached compatibility matrix does not allow the device, Packet may reject it: %v", incompatible)
+			}
+			if gpus, ok := matrix.PlanGPUs(machineScope.PacketMachine.Spec.MachineType); ok {
+				createDeviceReq.PlanGPUs = &gpus
+			}
+		}
+		if err != nil {
+			if errors.Is(err, packet.ErrInvalidRequest) {
+				machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+				machineScope.SetErrorMessage(err)
+				conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceProvisionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			}
+			return ctrl.Result{}, err
+		}
+
+		exceeded, err := r.checkQuotas(ctx, machineScope)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if exceeded != "" {
+			if conditions.GetReason(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition) != infrastructurev1alpha3.QuotaExceededReason {
+				r.Recorder.Event(machineScope.PacketMachine, corev1.EventTypeWarning, infrastructurev1alpha3.QuotaExceededReason, exceeded)
+			}
+			machineScope.Info("Device creation denied by a resource quota", "reason", exceeded)
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.QuotaExceededReason, clusterv1.ConditionSeverityWarning, "%s", exceeded)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+
+		// the values are not watched, a missing one is looked up again later
+		templateValues, reason, err := machineScope.GetTemplateValues(ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason != "" {
+			machineScope.Info("Waiting for the template values", "reason", reason)
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForTemplateValuesReason, clusterv1.ConditionSeverityInfo, reason)
+			return ctrl.Result{RequeueAfter: time.Minute}, nil
+		}
+		createDeviceReq.TemplateValues = templateValues
+
+		if profile := machineScope.PacketMachine.Spec.IPXEBootProfile; profile != "" {
+			reason, err := r.checkBootProfile(ctx, machineScope.Namespace(), profile)
+			if err != nil {
+				if errors.Is(err, packet.ErrInvalidRequest) {
+					machineScope.SetErrorReason(capierrors.InvalidConfigurationMachineError)
+					machineScope.SetErrorMessage(err)
+					conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceProvisionFailedReason, clusterv1.ConditionSeverityError, err.Error())
+				}
+				return ctrl.Result{}, err
+			}
+			if reason != "" {
+				machineScope.Info("Waiting for the boot profile", "reason", reason)
+				conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForBootProfileReason, clusterv1.ConditionSeverityInfo, reason)
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			createDeviceReq.IPXEScriptURL = r.ipxeScriptURL(machineScope)
 		}
 
 		createDeviceReq.ExtraTags = tags
 
-		dev, err = r.PacketClient.NewDevice(createDeviceReq)
-
-		switch {
-		// TODO: find a better way than parsing the error messages for this.
-		case err != nil && strings.Contains(err.Error(), " no available hardware reservations "):
-			// Do not treat an error indicating there are no hardware reservations available as fatal
-			return ctrl.Result{}, fmt.Errorf("failed to create machine %s: %w", machineScope.Name(), err)
-		case err != nil && strings.Contains(err.Error(), "Server is not provisionable"):
-			// Do not treat an error indicating that reserved hardware is not provisionable as fatal
-			// This occurs when reserved hardware is in the process of being deprovisioned
-			return ctrl.Result{}, fmt.Errorf("failed to create machine %s: %w", machineScope.Name(), err)
-		case err != nil:
+		// the userdata rendering and the API calls are traced as part of the creation
+		createCtx, createSpan := tracing.Start(ctx, "CreateDevice")
+		traced := r.withTracing(createCtx)
+		found := false
+		if ref := machineScope.PacketMachine.Spec.Device; ref != nil {
+			dev, err = traced.adoptDevice(createDeviceReq, ref, clusterScope)
+		} else {
+			hostname := packet.MachineHostname(machineScope)
+			dev, createDeviceReq.Hostname, err = traced.PacketClient.DeviceHostname(clusterScope.PacketCluster.Spec.ProjectID, hostname, machineTag, packet.HostnameSuffix(string(machineScope.PacketMachine.UID)))
+			switch {
+			case dev != nil:
+				found = true
+				machineScope.Info("Found the device of a previous creation", "device-id", dev.ID)
+			case err == nil && createDeviceReq.Hostname != hostname:
+				machineScope.Info("Another device of the project has the name of the machine, suffixing the hostname", "hostname", createDeviceReq.Hostname)
+			}
+			if dev == nil && err == nil {
+				createDeviceReq.NodeAPIKey, err = traced.mintNodeAPIKey(createCtx, machineScope, clusterScope)
+			}
+			if dev == nil && err == nil && r.WarmPool != nil {
+				dev, err = r.WarmPool.Claim(createCtx, createDeviceReq, clusterScope.PacketCluster.Spec.ProjectID)
+			}
+		}
+		if dev == nil && err == nil {
+			dev, err = traced.PacketClient.NewDevice(createDeviceReq)
+		}
+		tracing.End(createSpan, err)
+
+		if err != nil {
 			errs := fmt.Errorf("failed to create machine %s: %w", machineScope.Name(), err)
-			machineScope.SetErrorReason(capierrors.CreateMachineError)
+			failureReason, retryable := packet.MachineFailure(err)
+			if retryable {
+				// Do not treat as fatal the errors that can go away by themselves, like
+				// no hardware reservation being available, reserved hardware still being
+				// deprovisioned, no capacity left, quota limits or rate limiting
+				conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceProvisionFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+				// the reservations claimed by other machines, or deprovisioning,
+				// did not cost a creation
+				if errors.Is(err, packet.ErrReservationsClaimed) || errors.Is(err, packet.ErrReservationsDeprovisioning) {
+					return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+				}
+				if err := r.recordCreateFailure(clusterScope, err); err != nil {
+					machineScope.Error(err, "failed to stop the device creations of the cluster")
+				}
+				return ctrl.Result{}, errs
+			}
+			machineScope.SetErrorReason(failureReason)
 			machineScope.SetErrorMessage(errs)
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceProvisionFailedReason, clusterv1.ConditionSeverityError, errs.Error())
 			return ctrl.Result{}, errs
 		}
+		if r.CreateBreaker != nil {
+			r.CreateBreaker.Success(clusterKey(clusterScope))
+		}
+		if !found {
+			machineScope.RecordDeviceEvent(infrastructurev1alpha3.DeviceEventCreateRequested, dev.ID)
+			machineScope.PacketMachine.Status.ProvisioningDurations = nil
+		}
 	}
 
 	// we do not need to set this as packet://<id> because SetProviderID() does the formatting for us
 	machineScope.SetProviderID(dev.ID)
+	previousState := machineScope.GetInstanceStatus()
+	stateChanged := previousState == nil || *previousState != infrastructurev1alpha3.PacketResourceStatus(dev.State)
 	machineScope.SetInstanceStatus(infrastructurev1alpha3.PacketResourceStatus(dev.State))
+	if dev.Facility != nil {
+		machineScope.PacketMachine.Status.Facility = dev.Facility.Code
+	}
+	if dev.Metro != nil {
+		machineScope.PacketMachine.Status.Metro = dev.Metro.Code
+	}
+	if reservationID := packet.DeviceReservationID(dev); reservationID != "" {
+		machineScope.PacketMachine.Status.HardwareReservationID = reservationID
+	}
+	machineScope.PacketMachine.Status.Locked = dev.Locked
 
-	deviceAddr, err := r.PacketClient.GetDeviceAddresses(dev)
+	addrCtx, addrSpan := tracing.Start(ctx, "WaitAddresses")
+	deviceAddr, err := r.withTracing(addrCtx).PacketClient.GetDeviceAddresses(dev, machineScope.PacketMachine.Spec.NodeIPFamily)
+	tracing.End(addrSpan, err)
 	if err != nil {
 		machineScope.SetErrorMessage(errors.New("failed to getting device addresses"))
 		return ctrl.Result{}, err
 	}
 
-	machineScope.SetAddresses(append(addrs, deviceAddr...))
+	machineScope.SetAddresses(append(addrs, packet.NodeAddresses(deviceAddr)...))
+	machineScope.PacketMachine.Status.DeviceAddresses = deviceAddr
+	machineScope.PacketMachine.Status.AdvertiseAddress = ""
+	if policy := machineScope.PacketCluster.Spec.AdvertiseAddress; policy != nil && machineScope.IsControlPlane() {
+		if sorted := packet.SortAdvertiseAddresses(deviceAddr, policy); len(sorted) > 0 {
+			machineScope.PacketMachine.Status.AdvertiseAddress = sorted[0]
+		}
+	}
+
+	// Catch userdata truncated or re-encoded by the API before the device
+	// boots with it. Devices created by older versions have no digest.
+	if hash := machineScope.PacketMachine.Status.UserDataHash; hash != "" {
+		if err := packet.VerifyUserData(dev, hash); err != nil {
+			if conditions.GetReason(machineScope.PacketMachine, infrastructurev1alpha3.UserDataVerifiedCondition) != infrastructurev1alpha3.UserDataMismatchReason {
+				r.Recorder.Event(machineScope.PacketMachine, corev1.EventTypeWarning, infrastructurev1alpha3.UserDataMismatchReason, err.Error())
+			}
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.UserDataVerifiedCondition, infrastructurev1alpha3.UserDataMismatchReason, clusterv1.ConditionSeverityError, err.Error())
+		} else {
+			conditions.MarkTrue(machineScope.PacketMachine, infrastructurev1alpha3.UserDataVerifiedCondition)
+		}
+	}
+
+	// Devices created by older versions have no recorded request.
+	if record, ok := machineScope.PacketMachine.Annotations[infrastructurev1alpha3.DeviceRequestAnnotation]; ok {
+		r.reconcileDeviceRequestDrift(machineScope, record)
+	}
+
+	if err := r.reconcileLabelSync(machineScope, dev); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// A device in rescue mode does not run the node, its state is left alone.
+	if rescue, err := r.reconcileBootMode(machineScope, dev); err != nil || rescue {
+		return ctrl.Result{}, err
+	}
+
+	nodeKeyRequeue := r.reconcileNodeAPIKey(machineScope)
 
 	// Proceed to reconcile the PacketMachine state.
 	var result reconcile.Result
 
 	switch infrastructurev1alpha3.PacketResourceStatus(dev.State) {
-	case infrastructurev1alpha3.PacketResourceStatusNew, infrastructurev1alpha3.PacketResourceStatusQueued, infrastructurev1alpha3.PacketResourceStatusProvisioning:
+	case infrastructurev1alpha3.PacketResourceStatusNew, infrastructurev1alpha3.PacketResourceStatusQueued, infrastructurev1alpha3.PacketResourceStatusProvisioning,
+		infrastructurev1alpha3.PacketResourceStatusReinstalling:
 		machineScope.Info("Machine instance is pending", "instance-id", machineScope.GetInstanceID())
-		result = ctrl.Result{RequeueAfter: 10 * time.Second}
+		if stateChanged {
+			switch infrastructurev1alpha3.PacketResourceStatus(dev.State) {
+			case infrastructurev1alpha3.PacketResourceStatusProvisioning:
+				machineScope.RecordDeviceEvent(infrastructurev1alpha3.DeviceEventProvisioning, "")
+			case infrastructurev1alpha3.PacketResourceStatusReinstalling:
+				machineScope.RecordDeviceEvent(infrastructurev1alpha3.DeviceEventReinstalling, "")
+			}
+		}
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceProvisioningReason, clusterv1.ConditionSeverityInfo,
+			"%s, %.0f%% provisioned", dev.State, dev.ProvisionPer)
+		result = ctrl.Result{RequeueAfter: packet.DeviceRequeue(dev)}
 	case infrastructurev1alpha3.PacketResourceStatusRunning:
 		machineScope.Info("Machine instance is active", "instance-id", machineScope.GetInstanceID())
+		if stateChanged {
+			machineScope.RecordDeviceEvent(infrastructurev1alpha3.DeviceEventActive, "")
+		}
+		conditions.MarkTrue(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition)
+		packet.RecordDeviceActive(machineScope.PacketMachine, time.Now())
+		r.reconcileDeviceLock(machineScope, dev)
+		if conditions.IsTrue(machineScope.Machine, clusterv1.MachineNodeHealthyCondition) &&
+			packet.RecordNodeReady(machineScope.PacketMachine, time.Now(), r.ProvisioningSLO) {
+			r.Recorder.Eventf(machineScope.PacketMachine, corev1.EventTypeWarning, "ProvisioningSLOMissed", "The node became ready %s after the device got requested, the SLO is %s",
+				machineScope.PacketMachine.Status.ProvisioningDurations.NodeReady.Duration, r.ProvisioningSLO)
+		}
 
 		// This logic is here because an elastic ip can be assigned only an
 		// active node. It needs to be a control plane and the IP should not be
-		// assigned to anything at this point.
-		controlPlaneEndpoint, _ = r.PacketClient.GetIPByClusterIdentifier(
-			clusterScope.Namespace(),
-			clusterScope.Name(),
-			clusterScope.PacketCluster.Spec.ProjectID)
-		if len(controlPlaneEndpoint.Assignments) == 0 && machineScope.IsControlPlane() {
-			if _, _, err := r.PacketClient.DeviceIPs.Assign(dev.ID, &packngo.AddressStruct{
-				Address: controlPlaneEndpoint.Address,
-			}); err != nil {
-				r.Log.Error(err, "err assigining elastic ip to control plane. retrying...")
-				return ctrl.Result{RequeueAfter: time.Second * 20}, nil
+		// assigned to anything at this point. An address the device already
+		// announces over BGP, or kube-vip announces over BGP, is not assigned.
+		if machineScope.IsControlPlane() {
+			controlPlaneEndpoint, _ = r.controlPlaneIP(clusterScope, machineScope.PacketMachine.Status.Facility)
+			announced := packet.HasDeviceAddress(deviceAddr, controlPlaneEndpoint.Address) ||
+				clusterScope.PacketCluster.Spec.KubeVIP != nil && packet.KubeVIPMode(clusterScope.PacketCluster.Spec) == infrastructurev1alpha3.KubeVIPModeBGP
+			if controlPlaneEndpoint.Address != "" && len(controlPlaneEndpoint.Assignments) == 0 && !announced {
+				if err := r.PacketClient.AssignIP(dev.ID, controlPlaneEndpoint.Address); err != nil {
+					// the reservation of a new ip takes a while to propagate,
+					// the assignment is retried until it shows up on the device
+					retry := r.ipAssignBackoff.When(machineScope.PacketMachine.UID)
+					if errors.Is(err, packet.ErrIPAssignmentPending) {
+						machineScope.Info("Elastic ip assignment is pending, retrying", "address", controlPlaneEndpoint.Address, "retry", retry)
+					} else {
+						machineScope.Error(err, "failed to assign the elastic ip to the control plane, retrying", "retry", retry)
+					}
+					conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition, infrastructurev1alpha3.ElasticIPAssignmentFailedReason, clusterv1.ConditionSeverityWarning,
+						"attempt %d failed, retrying in %s: %s", r.ipAssignBackoff.NumRequeues(machineScope.PacketMachine.UID), retry, err)
+					return ctrl.Result{RequeueAfter: retry}, nil
+				}
+				r.ipAssignBackoff.Forget(machineScope.PacketMachine.UID)
+				machineScope.RecordDeviceEvent(infrastructurev1alpha3.DeviceEventAddressAssigned, controlPlaneEndpoint.Address)
+			}
+			if result, err := r.reconcileBGPSession(machineScope, clusterScope, dev); err != nil || result.RequeueAfter > 0 {
+				return result, err
+			}
+		}
+		if result, err := r.reconcileVRFPorts(machineScope, clusterScope, dev); err != nil || result.RequeueAfter > 0 {
+			return result, err
+		}
+		conditions.MarkTrue(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition)
+		nodeRequeue := r.reconcileNodeJoined(ctx, machineScope)
+		if nodeRequeue == 0 {
+			machineScope.SetReady()
+		}
+		r.reconcileDNSRecords(ctx, machineScope, clusterScope)
+		result = r.reconcileBootstrapCallback(machineScope, dev)
+		for _, requeue := range []time.Duration{nodeRequeue, r.reconcileStartupTaint(ctx, machineScope), r.reconcileNodeLabels(ctx, machineScope, dev), packet.DeviceRequeue(dev), nodeKeyRequeue} {
+			if requeue > 0 && (result.RequeueAfter == 0 || requeue < result.RequeueAfter) {
+				result.RequeueAfter = requeue
 			}
 		}
-		machineScope.SetReady()
-		result = ctrl.Result{}
 	default:
 		machineScope.SetErrorReason(capierrors.UpdateMachineError)
 		machineScope.SetErrorMessage(fmt.Errorf("Instance status %q is unexpected", dev.State))
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceProvisionFailedReason, clusterv1.ConditionSeverityError, "instance status %q is unexpected", dev.State)
 		result = ctrl.Result{}
 	}
 
 	return result, nil
 }
 
+// checkQuotas returns which limit of the PacketResourceQuotas of its
+// namespace the device of a machine would exceed, empty when it fits them
+// all. The usage is the one of the other PacketMachines of the namespace with
+// a device, as cached: the machines getting their device at the same time can
+// go over the limits. Limiting the cores requires the compatibility matrix.
+func (r *PacketMachineReconciler) checkQuotas(ctx context.Context, machineScope *scope.MachineScope) (string, error) {
+	packetMachine := machineScope.PacketMachine
+	quotas := &infrastructurev1alpha3.PacketResourceQuotaList{}
+	if err := r.Client.List(ctx, quotas, client.InNamespace(packetMachine.Namespace)); err != nil {
+		return "", fmt.Errorf("failed to list the PacketResourceQuotas of namespace %s: %w", packetMachine.Namespace, err)
+	}
+	if len(quotas.Items) == 0 {
+		return "", nil
+	}
+
+	matrix := r.Compatibility.Matrix()
+	planCores := func(machineType string) (int, bool) {
+		if matrix == nil {
+			return 0, false
+		}
+		return matrix.PlanCores(machineType)
+	}
+	cores, known := planCores(packetMachine.Spec.MachineType)
+	for _, quota := range quotas.Items {
+		if quota.Spec.MaxCores != nil && !known {
+			return fmt.Sprintf("PacketResourceQuota %s limits the cores, the cores of machine type %s are not known", quota.Name, packetMachine.Spec.MachineType), nil
+		}
+	}
+	requested := packet.MachineQuotaUsage(packetMachine.Spec, cores)
+
+	machines := &infrastructurev1alpha3.PacketMachineList{}
+	if err := r.Client.List(ctx, machines, client.InNamespace(packetMachine.Namespace)); err != nil {
+		return "", fmt.Errorf("failed to list the PacketMachines of namespace %s: %w", packetMachine.Namespace, err)
+	}
+	used := packet.QuotaUsage{}
+	for i := range machines.Items {
+		machine := &machines.Items[i]
+		if machine.UID == packetMachine.UID || machine.Spec.ProviderID == nil {
+			continue
+		}
+		machineCores, _ := planCores(machine.Spec.MachineType)
+		used = used.Add(packet.MachineQuotaUsage(machine.Spec, machineCores))
+	}
+
+	for _, quota := range quotas.Items {
+		if exceeded := packet.ExceededQuota(quota.Spec, used, requested); exceeded != "" {
+			return fmt.Sprintf("PacketResourceQuota %s: %s", quota.Name, exceeded), nil
+		}
+	}
+	return "", nil
+}
+
+// reconcileTemplateRef fills the fields the machine leaves empty from the
+// PacketMachineTemplate it references, once a PacketMachineTemplateGrant
+// allows the namespace of the machine to use a template of another namespace.
+// The merged spec is saved with the machine. It returns why the template can
+// not be used, empty once the spec is complete.
+func (r *PacketMachineReconciler) reconcileTemplateRef(ctx context.Context, machineScope *scope.MachineScope) (string, error) {
+	packetMachine := machineScope.PacketMachine
+	ref := packetMachine.Spec.TemplateRef
+	key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+	if key.Namespace == "" {
+		key.Namespace = packetMachine.Namespace
+	}
+
+	template := &infrastructurev1alpha3.PacketMachineTemplate{}
+	if err := r.Client.Get(ctx, key, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("PacketMachineTemplate %s not found", key), nil
+		}
+		return "", fmt.Errorf("failed to get PacketMachineTemplate %s: %w", key, err)
+	}
+	if key.Namespace != packetMachine.Namespace {
+		grants := &infrastructurev1alpha3.PacketMachineTemplateGrantList{}
+		if err := r.Client.List(ctx, grants, client.InNamespace(key.Namespace)); err != nil {
+			return "", fmt.Errorf("failed to list the PacketMachineTemplateGrants of namespace %s: %w", key.Namespace, err)
+		}
+		if !packet.TemplateGranted(grants.Items, packetMachine.Namespace, key.Name) {
+			return fmt.Sprintf("no PacketMachineTemplateGrant of namespace %s allows namespace %s to reference PacketMachineTemplate %s",
+				key.Namespace, packetMachine.Namespace, key.Name), nil
+		}
+	}
+
+	spec, err := packet.MergeTemplateSpec(packetMachine.Spec, template.Spec.Template.Spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to merge PacketMachineTemplate %s: %w", key, err)
+	}
+	if spec.OS == "" || spec.BillingCycle == "" || spec.MachineType == "" {
+		return fmt.Sprintf("neither the machine nor PacketMachineTemplate %s set the OS, billing cycle and machine type", key), nil
+	}
+	packetMachine.Spec = spec
+	return "", nil
+}
+
+// reconcileNodeJoined checks, with NodeReadinessCheck, that the node of the
+// device of the machine registered with the workload cluster. Whether the node
+// is ready is left to Cluster API: the CNI making it ready is only applied
+// once a control plane Machine references its node, which takes its
+// PacketMachine to be ready. For the same reason, the control plane machines
+// are not checked until the control plane is initialized, as the cloud
+// controller manager setting the provider ID of the nodes is not running yet.
+// Nodes are not checked again once their PacketMachine is ready. It returns
+// when to check again, zero once the node registered.
+func (r *PacketMachineReconciler) reconcileNodeJoined(ctx context.Context, machineScope *scope.MachineScope) time.Duration {
+	packetMachine := machineScope.PacketMachine
+	if !r.NodeReadinessCheck {
+		conditions.Delete(packetMachine, infrastructurev1alpha3.NodeJoinedCondition)
+		return 0
+	}
+	if packetMachine.Status.Ready {
+		return 0
+	}
+	if machineScope.IsControlPlane() && !machineScope.Cluster.Status.ControlPlaneInitialized {
+		conditions.Delete(packetMachine, infrastructurev1alpha3.NodeJoinedCondition)
+		return 0
+	}
+
+	node, err := machineScope.GetNodeByProviderID(ctx, machineScope.GetProviderID())
+	switch {
+	case err != nil:
+		machineScope.Error(err, "failed to look the node of the device up, retrying...")
+		conditions.MarkFalse(packetMachine, infrastructurev1alpha3.NodeJoinedCondition, infrastructurev1alpha3.NodeCheckFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return 30 * time.Second
+	case node == nil:
+		conditions.MarkFalse(packetMachine, infrastructurev1alpha3.NodeJoinedCondition, infrastructurev1alpha3.NodeNotRegisteredReason, clusterv1.ConditionSeverityInfo,
+			"no node registered with provider ID %s", machineScope.GetProviderID())
+		return 30 * time.Second
+	}
+	machineScope.Info("The node of the device registered", "node", node.Name)
+	conditions.MarkTrue(packetMachine, infrastructurev1alpha3.NodeJoinedCondition)
+	return 0
+}
+
+// reconcileStartupTaint removes the startup taint from the node of the
+// machine, once its device is active and its addresses are published. It
+// returns when to check again, zero once the taint is gone.
+func (r *PacketMachineReconciler) reconcileStartupTaint(ctx context.Context, machineScope *scope.MachineScope) time.Duration {
+	packetMachine := machineScope.PacketMachine
+	if !packetMachine.Spec.StartupTaint {
+		conditions.Delete(packetMachine, infrastructurev1alpha3.NodeInitializedCondition)
+		return 0
+	}
+	if conditions.IsTrue(packetMachine, infrastructurev1alpha3.NodeInitializedCondition) {
+		return 0
+	}
+
+	nodeRef := machineScope.Machine.Status.NodeRef
+	if nodeRef == nil {
+		conditions.MarkFalse(packetMachine, infrastructurev1alpha3.NodeInitializedCondition, infrastructurev1alpha3.WaitingForNodeReason, clusterv1.ConditionSeverityInfo, "")
+		return 30 * time.Second
+	}
+	removed, err := machineScope.RemoveNodeTaint(ctx, nodeRef.Name, infrastructurev1alpha3.StartupTaintKey)
+	if err != nil {
+		machineScope.Error(err, "failed to remove the startup taint, retrying...")
+		conditions.MarkFalse(packetMachine, infrastructurev1alpha3.NodeInitializedCondition, infrastructurev1alpha3.StartupTaintRemovalFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return 30 * time.Second
+	}
+	if removed {
+		machineScope.Info("Removed the startup taint from the node", "node", nodeRef.Name)
+	}
+	conditions.MarkTrue(packetMachine, infrastructurev1alpha3.NodeInitializedCondition)
+	return 0
+}
+
+// reconcileNodeLabels sets the labels derived from the facts of the device on
+// the node of the machine, once it registered. The labels set are recorded on
+// the PacketMachine, the node is only patched again when they change. It
+// returns when to check again, zero once the node is labelled.
+func (r *PacketMachineReconciler) reconcileNodeLabels(ctx context.Context, machineScope *scope.MachineScope, dev *packngo.Device) time.Duration {
+	if !r.NodeLabels {
+		return 0
+	}
+	packetMachine := machineScope.PacketMachine
+	labels := packet.NodeLabels(dev)
+	formatted := packet.FormatLabels(labels)
+	if packetMachine.Annotations[infrastructurev1alpha3.NodeLabelsAnnotation] == formatted {
+		return 0
+	}
+
+	nodeRef := machineScope.Machine.Status.NodeRef
+	if nodeRef == nil {
+		return 30 * time.Second
+	}
+	changed, err := machineScope.SetNodeLabels(ctx, nodeRef.Name, infrastructurev1alpha3.NodeLabelPrefix, labels)
+	if err != nil {
+		machineScope.Error(err, "failed to label the node, retrying...")
+		return 30 * time.Second
+	}
+	if changed {
+		machineScope.Info("Labelled the node with the facts of its device", "node", nodeRef.Name, "labels", formatted)
+	}
+	if packetMachine.Annotations == nil {
+		packetMachine.Annotations = map[string]string{}
+	}
+	packetMachine.Annotations[infrastructurev1alpha3.NodeLabelsAnnotation] = formatted
+	return 0
+}
+
+// reconcileBGPSession creates the BGP session of a control plane device when
+// the cluster announces its control plane endpoint over BGP. The session can
+// only be created once Packet enabled BGP on the project: it waits while the
+// configuration is pending, not when it differs from the cluster, which the
+// cluster reports.
+func (r *PacketMachineReconciler) reconcileBGPSession(machineScope *scope.MachineScope, clusterScope *scope.ClusterScope, dev *packngo.Device) (ctrl.Result, error) {
+	bgp := clusterScope.PacketCluster.Spec.BGP
+	if bgp == nil || !bgp.ControlPlaneSessions {
+		return ctrl.Result{}, nil
+	}
+	packetcluster := clusterScope.PacketCluster
+	if !conditions.Has(packetcluster, infrastructurev1alpha3.BGPConfiguredCondition) ||
+		conditions.GetReason(packetcluster, infrastructurev1alpha3.BGPConfiguredCondition) == infrastructurev1alpha3.BGPConfigPendingReason {
+		machineScope.Info("Waiting for BGP to be enabled on the project")
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition, infrastructurev1alpha3.BGPSessionFailedReason, clusterv1.ConditionSeverityInfo, "waiting for BGP to be enabled on the project")
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	if _, err := r.PacketClient.EnsureBGPSession(dev.ID); err != nil {
+		if !conditions.IsTrue(packetcluster, infrastructurev1alpha3.BGPConfiguredCondition) {
+			// the session likely failed for the reason the cluster reports
+			err = fmt.Errorf("%w, the BGP configuration of the cluster is not ready: %s", err, conditions.GetMessage(packetcluster, infrastructurev1alpha3.BGPConfiguredCondition))
+		}
+		machineScope.Error(err, "failed to create the bgp session, retrying...")
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition, infrastructurev1alpha3.BGPSessionFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return ctrl.Result{RequeueAfter: 20 * time.Second}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileVRFPorts attaches the bond0 port of a device to the VLANs of the
+// metal gateways of the VRFs of its machine.
+func (r *PacketMachineReconciler) reconcileVRFPorts(machineScope *scope.MachineScope, clusterScope *scope.ClusterScope, dev *packngo.Device) (ctrl.Result, error) {
+	names := machineScope.PacketMachine.Spec.VRFs
+	if len(names) == 0 {
+		return ctrl.Result{}, nil
+	}
+	spec := clusterScope.PacketCluster.Spec
+	if err := packet.ValidateMachineNetworking(machineScope.PacketMachine.Spec, &spec); err != nil {
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition, infrastructurev1alpha3.VRFPortsFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	declared := map[string]infrastructurev1alpha3.VRF{}
+	for _, vrf := range spec.VRFs {
+		declared[vrf.Name] = vrf
+	}
+
+	var vlans []*packngo.VirtualNetwork
+	for _, name := range names {
+		vrf := declared[name]
+		metro := packet.VRFMetro(spec, vrf)
+		for _, gateway := range vrf.MetalGateways {
+			vlan, err := r.PacketClient.ProjectVLAN(spec.ProjectID, metro, int(gateway.VLAN))
+			if err == nil && vlan == nil {
+				err = fmt.Errorf("project %s has no VLAN %d in metro %s", spec.ProjectID, gateway.VLAN, metro)
+			}
+			if err != nil {
+				machineScope.Error(err, "failed to look the vlan of the vrf up, retrying...", "vrf", name)
+				conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition, infrastructurev1alpha3.VRFPortsFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+			vlans = append(vlans, vlan)
+		}
+	}
+	if err := r.PacketClient.AttachDeviceVLANs(dev, vlans); err != nil {
+		machineScope.Error(err, "failed to attach the port of the device to the vlans of its vrfs, retrying...")
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.NetworkConfiguredCondition, infrastructurev1alpha3.VRFPortsFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return ctrl.Result{RequeueAfter: 20 * time.Second}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// withTracing returns a copy of the reconciler whose Packet API calls are
+// traced as children of the span of ctx.
+func (r *PacketMachineReconciler) withTracing(ctx context.Context) *PacketMachineReconciler {
+	traced := *r
+	traced.PacketClient = r.PacketClient.WithContext(ctx)
+	return &traced
+}
+
+// recordCreateFailure counts a failed device creation against the cluster.
+// The failure stopping the creations marks the PacketCluster and records a
+// single event summing the failures up, the PacketCluster controller marks it
+// again once the creations resume.
+func (r *PacketMachineReconciler) recordCreateFailure(clusterScope *scope.ClusterScope, err error) error {
+	if r.CreateBreaker == nil || !r.CreateBreaker.Failure(clusterKey(clusterScope), err) {
+		return nil
+	}
+	breaker := r.CreateBreaker
+	msg := fmt.Sprintf("Stopped creating devices for %s after %d failures within %s: %v", breaker.Cooldown, breaker.Threshold, breaker.Window, err)
+	conditions.MarkFalse(clusterScope.PacketCluster, infrastructurev1alpha3.DeviceCreationAllowedCondition, infrastructurev1alpha3.CreateCircuitOpenReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+	r.Recorder.Event(clusterScope.PacketCluster, corev1.EventTypeWarning, infrastructurev1alpha3.CreateCircuitOpenReason, msg)
+	return clusterScope.Close()
+}
+
+// clusterKey identifies the cluster of a scope in the CreateBreaker.
+func clusterKey(clusterScope *scope.ClusterScope) string {
+	return clusterScope.Namespace() + "/" + clusterScope.Name()
+}
+
+// reconcileDeviceRequestDrift reports on the DeviceRequestSynced condition,
+// as a JSON patch, the changes to the spec of the machine since its device
+// was created. The device is not updated, it has to be replaced to follow them.
+func (r *PacketMachineReconciler) reconcileDeviceRequestDrift(machineScope *scope.MachineScope, record string) {
+	recorded, err := packet.ParseDeviceRequest(record)
+	if err != nil {
+		machineScope.Error(err, "failed to parse the recorded device request")
+		return
+	}
+	drift, err := packet.DeviceRequestDrift(recorded, packet.ExpectedDeviceRequest(machineScope, recorded))
+	if err != nil {
+		machineScope.Error(err, "failed to compare the spec with the recorded device request")
+		return
+	}
+	if drift == "" {
+		conditions.MarkTrue(machineScope.PacketMachine, infrastructurev1alpha3.DeviceRequestSyncedCondition)
+		return
+	}
+
+	if conditions.GetMessage(machineScope.PacketMachine, infrastructurev1alpha3.DeviceRequestSyncedCondition) != drift {
+		r.Recorder.Eventf(machineScope.PacketMachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceRequestDriftedReason, "The spec changed since the device was created: %s", drift)
+	}
+	conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceRequestSyncedCondition, infrastructurev1alpha3.DeviceRequestDriftedReason, clusterv1.ConditionSeverityWarning, "%s", drift)
+}
+
+// reconcileLabelSync updates the tags of the device from the labels of the
+// Machine and the PacketMachine, the PacketMachine ones taking precedence,
+// then the labels of the PacketMachine from the tags of the device.
+func (r *PacketMachineReconciler) reconcileLabelSync(machineScope *scope.MachineScope, dev *packngo.Device) error {
+	labels := map[string]string{}
+	for key, value := range machineScope.Machine.Labels {
+		labels[key] = value
+	}
+	for key, value := range machineScope.PacketMachine.Labels {
+		labels[key] = value
+	}
+	if tags, changed := r.LabelSync.DeviceTags(dev.Tags, labels); changed {
+		if err := r.PacketClient.UpdateDeviceTags(dev.ID, tags); err != nil {
+			return fmt.Errorf("failed to sync the labels of the machine into the tags of the device: %w", err)
+		}
+		machineScope.Info("Synced the labels of the machine into the tags of the device")
+		dev.Tags = tags
+	}
+
+	labels, changed, invalid := r.LabelSync.MachineLabels(machineScope.PacketMachine.Labels, dev.Tags)
+	if len(invalid) != 0 {
+		machineScope.Info("Device tags are not valid labels, skipping them", "tags", invalid)
+	}
+	if changed {
+		machineScope.PacketMachine.Labels = labels
+	}
+	return nil
+}
+
+// reconcileDeviceLock locks the device of a machine asking for it, once
+// provisioned. A lock set by a user is left alone, whether the machine asks
+// for one or not. Failures are retried at the next reconciliation.
+func (r *PacketMachineReconciler) reconcileDeviceLock(machineScope *scope.MachineScope, dev *packngo.Device) {
+	packetMachine := machineScope.PacketMachine
+	if !packetMachine.Spec.LockDevice || dev.Locked {
+		return
+	}
+	if err := r.PacketClient.SetDeviceLocked(dev.ID, true); err != nil {
+		machineScope.Error(err, "failed to lock the device, retrying...")
+		r.Recorder.Eventf(packetMachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceActionFailedReason, "Failed to lock the device: %v", err)
+		return
+	}
+	packetMachine.Status.Locked = true
+	r.Recorder.Event(packetMachine, corev1.EventTypeNormal, "DeviceLocked", "Locked the device")
+}
+
+// reconcileBootMode applies the boot order and the rescue mode asked for by
+// the annotations of the PacketMachine, and reports them in its status. It
+// returns true while the device is in rescue mode.
+func (r *PacketMachineReconciler) reconcileBootMode(machineScope *scope.MachineScope, dev *packngo.Device) (bool, error) {
+	packetMachine := machineScope.PacketMachine
+
+	packetMachine.Status.BootOrder = packet.DeviceBootOrder(dev)
+	order, ok, err := packet.DesiredBootOrder(packetMachine.Annotations)
+	switch {
+	case err != nil:
+		r.Recorder.Event(packetMachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceActionFailedReason, err.Error())
+	case ok && order != packetMachine.Status.BootOrder:
+		if err := r.PacketClient.SetDeviceBootOrder(dev.ID, order); err != nil {
+			r.Recorder.Eventf(packetMachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceActionFailedReason, "Failed to set the boot order to %s: %v", order, err)
+			return false, fmt.Errorf("failed to set the boot order of the device to %s: %w", order, err)
+		}
+		machineScope.Info("Changed the boot order of the device", "bootOrder", order)
+		packetMachine.Status.BootOrder = order
+	}
+
+	_, rescue := packetMachine.Annotations[infrastructurev1alpha3.RescueAnnotation]
+	switch {
+	case rescue && !packetMachine.Status.Rescue && infrastructurev1alpha3.PacketResourceStatus(dev.State) == infrastructurev1alpha3.PacketResourceStatusRunning:
+		if err := r.PacketClient.RescueDevice(dev.ID); err != nil {
+			conditions.MarkFalse(packetMachine, infrastructurev1alpha3.RescueModeCondition, infrastructurev1alpha3.DeviceActionFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return false, fmt.Errorf("failed to reboot the device into rescue mode: %w", err)
+		}
+		r.Recorder.Event(packetMachine, corev1.EventTypeNormal, string(infrastructurev1alpha3.RescueModeCondition), "Rebooted the device into rescue mode")
+		packetMachine.Status.Rescue = true
+	case !rescue && packetMachine.Status.Rescue:
+		if err := r.PacketClient.RebootDevice(dev.ID); err != nil {
+			r.Recorder.Eventf(packetMachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceActionFailedReason, "Failed to reboot the device out of rescue mode: %v", err)
+			return true, fmt.Errorf("failed to reboot the device out of rescue mode: %w", err)
+		}
+		r.Recorder.Event(packetMachine, corev1.EventTypeNormal, string(infrastructurev1alpha3.RescueModeCondition), "Rebooted the device out of rescue mode")
+		packetMachine.Status.Rescue = false
+	}
+
+	if packetMachine.Status.Rescue {
+		conditions.MarkTrue(packetMachine, infrastructurev1alpha3.RescueModeCondition)
+		return true, nil
+	}
+	if !rescue {
+		conditions.Delete(packetMachine, infrastructurev1alpha3.RescueModeCondition)
+	}
+	return false, nil
+}
+
+// reconcileDNSRecords registers the addresses of the device in the DNS zone
+// of the cluster, if any. Failures are reported on the DNSRecordsReady
+// condition without holding the machine back.
+func (r *PacketMachineReconciler) reconcileDNSRecords(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope) {
+	zone := clusterScope.PacketCluster.Spec.DNSZone
+	if zone == nil {
+		return
+	}
+
+	records := dns.MachineRecords(zone, clusterScope.Name(), machineScope.Name(), machineScope.PacketMachine.Status.DeviceAddresses)
+	owner := *metav1.NewControllerRef(machineScope.PacketMachine, infrastructurev1alpha3.GroupVersion.WithKind("PacketMachine"))
+	labels := map[string]string{clusterv1.ClusterLabelName: clusterScope.Name()}
+	if err := dns.EnsureEndpoint(ctx, r.Client, machineScope.Namespace(), machineScope.Name()+"-dns", owner, labels, zone, records); err != nil {
+		machineScope.Error(err, "failed to register the device addresses in DNS")
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DNSRecordsReadyCondition, infrastructurev1alpha3.DNSRegistrationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return
+	}
+	conditions.MarkTrue(machineScope.PacketMachine, infrastructurev1alpha3.DNSRecordsReadyCondition)
+}
+
+// bootstrapCallbackURL returns the url the device of the PacketMachine calls
+// once its bootstrap completed.
+func (r *PacketMachineReconciler) bootstrapCallbackURL(machineScope *scope.MachineScope) string {
+	return strings.TrimSuffix(r.BootstrapCallbackURL, "/") + path.Join(BootstrapCallbackPath, machineScope.Namespace(), machineScope.Name())
+}
+
+// ipxeScriptURL returns the url of the iPXE script the device of the
+// PacketMachine boots.
+func (r *PacketMachineReconciler) ipxeScriptURL(machineScope *scope.MachineScope) string {
+	return strings.TrimSuffix(r.IPXEServerURL, "/") + path.Join(IPXEScriptPath, machineScope.Namespace(), machineScope.Name(), string(machineScope.PacketMachine.UID))
+}
+
+// checkBootProfile returns why the device of a machine booting the boot
+// profile name can not be created yet, empty once it can. It returns an
+// ErrInvalidRequest when it never can.
+func (r *PacketMachineReconciler) checkBootProfile(ctx context.Context, namespace, name string) (string, error) {
+	if r.IPXEServerURL == "" {
+		return "", fmt.Errorf("the machine has a boot profile and the iPXE server is not enabled: %w", packet.ErrInvalidRequest)
+	}
+	profile := &infrastructurev1alpha3.PacketBootProfile{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, profile); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("PacketBootProfile %s not found", name), nil
+		}
+		return "", err
+	}
+	if err := packet.ValidateBootProfile(profile.Spec); err != nil {
+		return "", fmt.Errorf("PacketBootProfile %s: %w", name, err)
+	}
+	return "", nil
+}
+
+// reconcileBootstrapCallback sets the BootstrapSucceeded condition of an active
+// device from the callback it made, or did not make, once cloud-init completed.
+// Devices that never call back are reported with their latest events to help
+// diagnose the failure.
+func (r *PacketMachineReconciler) reconcileBootstrapCallback(machineScope *scope.MachineScope, dev *packngo.Device) ctrl.Result {
+	if r.BootstrapCallbackURL == "" {
+		return ctrl.Result{}
+	}
+	if _, ok := machineScope.PacketMachine.Annotations[infrastructurev1alpha3.BootstrapCallbackAnnotation]; ok {
+		conditions.MarkTrue(machineScope.PacketMachine, infrastructurev1alpha3.BootstrapSucceededCondition)
+		return ctrl.Result{}
+	}
+	if conditions.GetReason(machineScope.PacketMachine, infrastructurev1alpha3.BootstrapSucceededCondition) == infrastructurev1alpha3.BootstrapTimedOutReason {
+		// a late callback still flips the condition, the annotation triggers a reconcile
+		return ctrl.Result{}
+	}
+
+	timeout := r.Config.Get().BootstrapCallbackTimeout
+	activeSince := conditions.GetLastTransitionTime(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition)
+	if activeSince == nil || time.Since(activeSince.Time) < timeout {
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.BootstrapSucceededCondition, infrastructurev1alpha3.WaitingForBootstrapCallbackReason, clusterv1.ConditionSeverityInfo, "")
+		return ctrl.Result{RequeueAfter: time.Minute}
+	}
+
+	diagnostics := fmt.Sprintf("device %s did not call back within %s of becoming active", dev.ID, timeout)
+	events, err := r.PacketClient.LatestDeviceEvents(dev.ID, 3)
+	if err != nil {
+		machineScope.Error(err, "failed to list device events")
+	}
+	for _, event := range events {
+		diagnostics += fmt.Sprintf("; %s: %s", event.Type, event.Interpolated)
+	}
+	r.Recorder.Event(machineScope.PacketMachine, corev1.EventTypeWarning, infrastructurev1alpha3.BootstrapTimedOutReason, diagnostics)
+	conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.BootstrapSucceededCondition, infrastructurev1alpha3.BootstrapTimedOutReason, clusterv1.ConditionSeverityError, diagnostics)
+	return ctrl.Result{}
+}
+
+// bootstrapTokenFreshness reports whether the bootstrap data can still be used
+// to join the cluster. Bootstrap data younger than the token TTL is always
+// considered fresh, otherwise the expiration of the token is checked in the
+// workload cluster, where the bootstrap provider keeps refreshing it.
+func (r *PacketMachineReconciler) bootstrapTokenFreshness(ctx context.Context, machineScope *scope.MachineScope) (*time.Time, bool, error) {
+	bootstrapSecret, err := machineScope.GetBootstrapDataSecret()
+	if err != nil {
+		return nil, false, err
+	}
+
+	ttl := r.Config.Get().BootstrapTokenTTL
+	if ttl == 0 || time.Since(bootstrapSecret.CreationTimestamp.Time) < ttl {
+		return nil, true, nil
+	}
+
+	expiration, err := machineScope.GetBootstrapTokenExpiration(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if expiration == nil {
+		return nil, true, nil
+	}
+
+	return expiration, expiration.After(time.Now()), nil
+}
+
+// checkImage makes sure the image of the machine exists and can be
+// provisioned on its machine type before creating the device.
+func (r *PacketMachineReconciler) checkImage(spec infrastructurev1alpha3.PacketMachineSpec) error {
+	image, err := r.PacketClient.GetImage(spec.ImageRef.Slug)
+	if err != nil {
+		return err
+	}
+	return packet.CheckImage(image, spec)
+}
+
+// machineFacility returns the facility a new device should be placed in when
+// the PacketMachine spreads across a list of facilities, or lets the
+// controller search for capacity. An empty string means the facility resolved
+// from the specs should be used.
+func (r *PacketMachineReconciler) machineFacility(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope) (string, error) {
+	spec := machineScope.PacketMachine.Spec
+	searchCapacity := spec.Facility == infrastructurev1alpha3.FacilityAny ||
+		packet.DeviceFacility(machineScope, "") == "" && clusterScope.PacketCluster.Spec.Metro == ""
+	if len(spec.Facilities) == 0 && !searchCapacity {
+		return "", nil
+	}
+
+	// keep the placement decided by a previous attempt
+	if machineScope.PacketMachine.Status.Facility != "" {
+		return machineScope.PacketMachine.Status.Facility, nil
+	}
+
+	if len(spec.Facilities) != 0 && spec.SpreadConstraints != nil {
+		return r.spreadFacility(ctx, machineScope, clusterScope)
+	}
+	if len(spec.Facilities) != 0 {
+		counts, err := clusterScope.MachineFacilities(ctx, machineScope.IsControlPlane())
+		if err != nil {
+			return "", err
+		}
+		return packet.LeastPopulatedFacility(spec.Facilities, counts), nil
+	}
+
+	// a metro scoped control plane ip can only be held by devices of its metro
+	metro := ""
+	if ipScope, location := packet.IPReservationLocation(clusterScope.PacketCluster.Spec); ipScope == infrastructurev1alpha3.IPReservationScopeMetro {
+		metro = location
+	}
+	facility, err := r.PacketClient.FacilityWithCapacity(spec.MachineType, metro)
+	if err != nil {
+		return "", err
+	}
+	machineScope.Info("Selected a facility with capacity for the machine type", "facility", facility, "machineType", spec.MachineType)
+	return facility, nil
+}
+
+// spreadFacility returns the facility of the Facilities of the machine its
+// node group is balanced to under the spread constraints of the machine.
+func (r *PacketMachineReconciler) spreadFacility(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope) (string, error) {
+	spec := machineScope.PacketMachine.Spec
+	counts, err := clusterScope.NodeGroupFacilities(ctx, machineScope.PacketMachine)
+	if err != nil {
+		return "", err
+	}
+	report, err := r.PacketClient.CapacityReport()
+	if err != nil {
+		return "", err
+	}
+	var metros map[string]string
+	if spec.SpreadConstraints.TopologyKey == infrastructurev1alpha3.SpreadTopologyMetro {
+		if metros, err = r.PacketClient.FacilityMetros(); err != nil {
+			return "", err
+		}
+	}
+
+	facility, err := packet.SpreadFacility(*spec.SpreadConstraints, spec.Facilities, counts, metros, report, spec.MachineType)
+	if err != nil {
+		return "", err
+	}
+	machineScope.Info("Selected a facility balancing the node group", "facility", facility, "nodeGroupMachines", counts)
+	return facility, nil
+}
+
+// controlPlaneIP returns the ip reserved for the control plane machines placed
+// in facility. Metro and global ips are valid in every facility, the metro
+// ones are kept within the metro by validateDeviceLocation. When the cluster
+// reserves an ElasticIP per facility and none exists yet for facility, it gets
+// reserved.
+func (r *PacketMachineReconciler) controlPlaneIP(clusterScope *scope.ClusterScope, facility string) (packngo.IPAddressReservation, error) {
+	spec := clusterScope.PacketCluster.Spec
+	owner := packet.ClusterIPOwner(clusterScope)
+	otherFacility := facility != "" && spec.Facility != "" && facility != spec.Facility
+	ipScope, _ := packet.IPReservationLocation(spec)
+
+	switch {
+	case !otherFacility || ipScope != infrastructurev1alpha3.IPReservationScopeFacility:
+		return r.PacketClient.GetIPByClusterIdentifier(owner, spec.ProjectID)
+	case spec.ControlPlaneEndpointStrategy != infrastructurev1alpha3.ControlPlaneEndpointStrategyElasticIPPerFacility:
+		// a facility scoped ElasticIP can not be assigned to devices in other facilities
+		return packngo.IPAddressReservation{}, packet.ErrControlPlanEndpointNotFound
+	}
+
+	ip, err := r.PacketClient.GetIPByFacilityIdentifier(owner, spec.ProjectID, facility)
+	if err != packet.ErrControlPlanEndpointNotFound {
+		return ip, err
+	}
+	if _, err := r.PacketClient.CreateFacilityIP(owner, spec.ProjectID, facility, spec.IPReservationMetadata); err != nil {
+		return ip, err
+	}
+	return r.PacketClient.GetIPByFacilityIdentifier(owner, spec.ProjectID, facility)
+}
+
+// adoptDevice takes over the existing device referenced by the PacketMachine
+// instead of creating one.
+func (r *PacketMachineReconciler) adoptDevice(req packet.CreateDeviceRequest, ref *infrastructurev1alpha3.DeviceReference, clusterScope *scope.ClusterScope) (*packngo.Device, error) {
+	dev, err := r.PacketClient.FindDevice(clusterScope.PacketCluster.Spec.ProjectID, ref)
+	if err != nil {
+		return nil, err
+	}
+	if msg := packet.DeviceOwnership(dev, packet.ClusterUID(clusterScope.PacketCluster), r.adoptsDevice(req.MachineScope), r.StrictDeviceOwnership); msg != "" {
+		return nil, fmt.Errorf("%s: %w", msg, packet.ErrDeviceNotManaged)
+	}
+	if err := r.PacketClient.AdoptDevice(req, dev); err != nil {
+		return nil, err
+	}
+	req.MachineScope.Info("Adopted existing device", "device-id", dev.ID)
+	return r.PacketClient.GetDevice(dev.ID)
+}
+
+// adoptsDevice reports whether the controller may take over the device of a
+// machine that does not carry the uid tag of its cluster, with strict device
+// ownership.
+func (r *PacketMachineReconciler) adoptsDevice(machineScope *scope.MachineScope) bool {
+	_, adopt := machineScope.PacketMachine.Annotations[infrastructurev1alpha3.AdoptDeviceAnnotation]
+	return adopt
+}
+
+// reconcileDeviceOwnership makes sure the device of a machine is managed for
+// its cluster before changing it, tagging the devices the controller may
+// adopt. It returns false, with the machine marked, when the device must be
+// left alone.
+func (r *PacketMachineReconciler) reconcileDeviceOwnership(machineScope *scope.MachineScope, dev *packngo.Device) (bool, error) {
+	clusterUID := packet.ClusterUID(machineScope.PacketCluster)
+	if msg := packet.DeviceOwnership(dev, clusterUID, r.adoptsDevice(machineScope), r.StrictDeviceOwnership); msg != "" {
+		r.markDeviceNotManaged(machineScope, msg)
+		return false, nil
+	}
+	if packet.DeviceManager(dev) == clusterUID {
+		return true, nil
+	}
+	tags := packet.ManagedDeviceTags(dev.Tags, clusterUID)
+	if err := r.PacketClient.UpdateDeviceTags(dev.ID, tags); err != nil {
+		return false, fmt.Errorf("failed to tag the device as managed for the cluster: %w", err)
+	}
+	machineScope.Info("Tagged the device as managed for the cluster", "device-id", dev.ID)
+	dev.Tags = tags
+	return true, nil
+}
+
+// markDeviceNotManaged reports a device the controller leaves alone, with an
+// event the first time.
+func (r *PacketMachineReconciler) markDeviceNotManaged(machineScope *scope.MachineScope, msg string) {
+	if conditions.GetReason(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition) != infrastructurev1alpha3.DeviceNotManagedReason {
+		r.Recorder.Event(machineScope.PacketMachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceNotManagedReason, msg)
+	}
+	machineScope.Info("Device is not managed for the cluster, leaving it alone", "reason", msg)
+	conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceNotManagedReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+}
+
+// validateDeviceLocation makes sure a device created in facility can hold the
+// control plane ip of a cluster reserving it in a metro.
+func (r *PacketMachineReconciler) validateDeviceLocation(clusterScope *scope.ClusterScope, facility string) error {
+	ipScope, metro := packet.IPReservationLocation(clusterScope.PacketCluster.Spec)
+	if ipScope != infrastructurev1alpha3.IPReservationScopeMetro || facility == "" {
+		return nil
+	}
+
+	facilityMetro, err := r.PacketClient.FacilityMetro(facility)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(facilityMetro, metro) {
+		return fmt.Errorf("facility %s is in metro %s, the cluster ip is reserved in metro %s: %w",
+			facility, facilityMetro, metro, packet.ErrInvalidRequest)
+	}
+	return nil
+}
+
 func (r *PacketMachineReconciler) reconcileDelete(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope, logger logr.Logger) (ctrl.Result, error) {
 	logger.Info("Deleting machine")
+	r.ipAssignBackoff.Forget(machineScope.PacketMachine.UID)
+	previousReason := conditions.GetReason(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition)
+	conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
 	packetmachine := machineScope.PacketMachine
 	providerID := machineScope.GetInstanceID()
 	if providerID == "" {
 		logger.Info("no provider ID provided, nothing to delete")
+		if err := r.revokeNodeAPIKey(machineScope); err != nil {
+			return ctrl.Result{}, err
+		}
 		controllerutil.RemoveFinalizer(packetmachine, infrastructurev1alpha3.MachineFinalizer)
 		return ctrl.Result{}, nil
 	}
 
 	device, err := r.PacketClient.GetDevice(providerID)
 	if err != nil {
-		if err.(*packngo.ErrorResponse).Response != nil && err.(*packngo.ErrorResponse).Response.StatusCode == http.StatusNotFound {
+		if packeterrors.IsNotFound(err) {
 			// When the server does not exist we do not have anything left to do.
 			// Probably somebody manually deleted the server from the UI or via API.
 			logger.Info("Server not found, nothing left to do")
+			if err := r.revokeNodeAPIKey(machineScope); err != nil {
+				return ctrl.Result{}, err
+			}
 			controllerutil.RemoveFinalizer(packetmachine, infrastructurev1alpha3.MachineFinalizer)
 			return ctrl.Result{}, nil
 		}
@@ -331,12 +1591,213 @@ func (r *PacketMachineReconciler) reconcileDelete(ctx context.Context, machineSc
 		controllerutil.RemoveFinalizer(packetmachine, infrastructurev1alpha3.MachineFinalizer)
 		return ctrl.Result{}, fmt.Errorf("machine does not exist: %s", packetmachine.Name)
 	}
+	// the deletion of a device the controller does not manage waits for the
+	// adopt-device annotation
+	if msg := packet.DeviceOwnership(device, packet.ClusterUID(machineScope.PacketCluster), r.adoptsDevice(machineScope), r.StrictDeviceOwnership); msg != "" {
+		if previousReason != infrastructurev1alpha3.DeviceNotManagedReason {
+			r.Recorder.Event(packetmachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceNotManagedReason, msg)
+		}
+		logger.Info("Device is not managed for the cluster, keeping it", "reason", msg)
+		conditions.MarkFalse(packetmachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceNotManagedReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		return ctrl.Result{}, nil
+	}
+	// The devices of a protected cluster are kept when the cluster gets
+	// deleted anyway, e.g. while the webhook is not installed. Scaling in
+	// still deletes them.
+	clusterDeleted := !machineScope.Cluster.DeletionTimestamp.IsZero() || !machineScope.PacketCluster.DeletionTimestamp.IsZero()
+	if clusterDeleted && packet.DeleteProtected(machineScope.PacketCluster, machineScope.Cluster) {
+		msg := fmt.Sprintf("cluster %s is delete protected, remove the %s annotation to delete device %s",
+			machineScope.Cluster.Name, infrastructurev1alpha3.DeleteProtectionAnnotation, device.ID)
+		if previousReason != infrastructurev1alpha3.DeleteProtectedReason {
+			r.Recorder.Event(packetmachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeleteProtectedReason, msg)
+		}
+		logger.Info("Cluster is delete protected, keeping the device")
+		conditions.MarkFalse(packetmachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeleteProtectedReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	machineScope.RecordDeviceEvent(infrastructurev1alpha3.DeviceEventDeleteRequested, "")
 
-	_, err = r.PacketClient.Devices.Delete(device.ID, force)
-	if err != nil {
+	// Releasing a reserved server is costly to undo: the devices running on
+	// protected reservations need an explicit go ahead.
+	if reservationID := packet.DeviceReservationID(device); reservationID != "" {
+		if _, release := packetmachine.Annotations[infrastructurev1alpha3.ReleaseProtectedReservationAnnotation]; !release {
+			protected, err := r.PacketClient.IsReservationProtected(reservationID)
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to check the hardware reservation of the machine %s: %w", packetmachine.Name, err)
+			}
+			if protected {
+				msg := fmt.Sprintf("device %s runs on the protected hardware reservation %s, set the %s annotation to delete it",
+					device.ID, reservationID, infrastructurev1alpha3.ReleaseProtectedReservationAnnotation)
+				if previousReason != infrastructurev1alpha3.ProtectedReservationReason {
+					r.Recorder.Event(packetmachine, corev1.EventTypeWarning, infrastructurev1alpha3.ProtectedReservationReason, msg)
+				}
+				logger.Info("Device runs on a protected hardware reservation, waiting for the release annotation", "reservation", reservationID)
+				conditions.MarkFalse(packetmachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.ProtectedReservationReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+				return ctrl.Result{RequeueAfter: time.Minute}, nil
+			}
+		}
+	}
+
+	// only the lock the controller set is lifted, a device locked by a user
+	// waits for the user to unlock it
+	if device.Locked && !packetmachine.Spec.LockDevice {
+		msg := fmt.Sprintf("device %s is locked, unlock it to delete it", device.ID)
+		if previousReason != infrastructurev1alpha3.DeviceLockedReason {
+			r.Recorder.Event(packetmachine, corev1.EventTypeWarning, infrastructurev1alpha3.DeviceLockedReason, msg)
+		}
+		logger.Info("Device is locked, waiting for it to be unlocked")
+		conditions.MarkFalse(packetmachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.DeviceLockedReason, clusterv1.ConditionSeverityWarning, "%s", msg)
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+
+	// the billing hour already started is paid for, keep the device until its end
+	if packetmachine.Spec.DeviceDeletePolicy == infrastructurev1alpha3.DeviceDeletePolicyEndOfBillingHour && device.BillingCycle == "hourly" {
+		created, err := time.Parse(time.RFC3339, device.Created)
+		if err != nil {
+			logger.Info("Deleting the device now, its creation time can not be parsed", "created", device.Created)
+		} else if wait := time.Until(packet.BillingHourEnd(created, time.Now(), billingHourMargin)); wait > 0 {
+			logger.Info("Keeping the device until the end of its billing hour", "remaining", wait.Round(time.Second).String())
+			conditions.MarkFalse(packetmachine, infrastructurev1alpha3.DeviceReadyCondition, infrastructurev1alpha3.WaitingForBillingHourEndReason, clusterv1.ConditionSeverityInfo, "")
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	if ttl := r.Config.Get().AutopsyTTL; ttl > 0 {
+		// the autopsy helps post-mortems, it does not hold back the deletion
+		if err := r.recordAutopsy(ctx, machineScope, device, ttl); err != nil {
+			logger.Error(err, "Failed to record the autopsy of the machine")
+		}
+	}
+
+	// a locked device can not be deleted, the machine locked it
+	if device.Locked {
+		if err := r.PacketClient.SetDeviceLocked(device.ID, false); err != nil {
+			conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, clusterv1.DeletionFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return ctrl.Result{}, fmt.Errorf("failed to unlock the device of the machine: %v", err)
+		}
+		packetmachine.Status.Locked = false
+	}
+
+	if err := r.PacketClient.DeleteDevice(device.ID); err != nil {
+		conditions.MarkFalse(machineScope.PacketMachine, infrastructurev1alpha3.DeviceReadyCondition, clusterv1.DeletionFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 		return ctrl.Result{}, fmt.Errorf("failed to delete the machine: %v", err)
 	}
+	// the reservation takes no new device until deprovisioned
+	if reservationID := packet.DeviceReservationID(device); reservationID != "" {
+		r.ReservationClaims.Deprovisioning(reservationID)
+	}
+	if err := r.revokeNodeAPIKey(machineScope); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	controllerutil.RemoveFinalizer(packetmachine, infrastructurev1alpha3.MachineFinalizer)
 	return ctrl.Result{}, nil
 }
+
+// mintNodeAPIKey mints the API key rendered into the userdata of the device
+// of a control plane machine, when the cluster asks for node credentials. It
+// returns empty for the API key of the controller. A key minted for a creation
+// that failed is revoked first. The key is recorded in the status before it is
+// used, and revoked when it can not be, so that no key is left behind.
+func (r *PacketMachineReconciler) mintNodeAPIKey(ctx context.Context, machineScope *scope.MachineScope, clusterScope *scope.ClusterScope) (string, error) {
+	policy := clusterScope.PacketCluster.Spec.NodeCredentials
+	if policy == nil || !machineScope.IsControlPlane() {
+		return "", nil
+	}
+	if err := packet.ValidateNodeCredentials(clusterScope.PacketCluster.Spec); err != nil {
+		return "", err
+	}
+	if err := r.revokeNodeAPIKey(machineScope); err != nil {
+		return "", err
+	}
+
+	expiresAt := packet.NodeAPIKeyExpiration(policy, time.Now())
+	description := packet.NodeAPIKeyDescription(machineScope.Namespace(), machineScope.Name(), expiresAt)
+	key, err := r.PacketClient.MintNodeAPIKey(clusterScope.PacketCluster.Spec.ProjectID, description, policy.ReadOnly)
+	if err != nil {
+		return "", err
+	}
+	status := packet.NewNodeAPIKeyStatus(key, expiresAt)
+
+	// patch a copy, the changes of the reconcile are patched at its end
+	persisted := machineScope.PacketMachine.DeepCopy()
+	patch := client.MergeFrom(persisted.DeepCopy())
+	persisted.Status.NodeAPIKey = status
+	if err := r.Status().Patch(ctx, persisted, patch); err != nil {
+		if revokeErr := r.PacketClient.RevokeNodeAPIKey(key.ID); revokeErr != nil {
+			machineScope.Error(revokeErr, "failed to revoke the unrecorded node api key", "key", key.ID)
+		}
+		return "", fmt.Errorf("failed to record the node api key: %w", err)
+	}
+	machineScope.PacketMachine.Status.NodeAPIKey = status
+	return key.Token, nil
+}
+
+// reconcileNodeAPIKey revokes the API key minted for the node of a machine
+// once its ttl is over. It returns when to check again, zero for the machines
+// without a key expiring.
+func (r *PacketMachineReconciler) reconcileNodeAPIKey(machineScope *scope.MachineScope) time.Duration {
+	left, ok := packet.NodeAPIKeyRevocation(machineScope.PacketMachine.Status.NodeAPIKey, time.Now())
+	if !ok || left > 0 {
+		return left
+	}
+	id := machineScope.PacketMachine.Status.NodeAPIKey.ID
+	if err := r.revokeNodeAPIKey(machineScope); err != nil {
+		machineScope.Error(err, "failed to revoke the expired node api key, retrying...")
+		return time.Minute
+	}
+	r.Recorder.Eventf(machineScope.PacketMachine, corev1.EventTypeNormal, "NodeAPIKeyRevoked", "Revoked the expired node api key %s", id)
+	return 0
+}
+
+// revokeNodeAPIKey revokes the API key minted for the node of a machine, if
+// any, and forgets it.
+func (r *PacketMachineReconciler) revokeNodeAPIKey(machineScope *scope.MachineScope) error {
+	status := machineScope.PacketMachine.Status.NodeAPIKey
+	if status == nil {
+		return nil
+	}
+	if err := r.PacketClient.RevokeNodeAPIKey(status.ID); err != nil {
+		return err
+	}
+	machineScope.PacketMachine.Status.NodeAPIKey = nil
+	return nil
+}
+
+// recordAutopsy saves the diagnostics of a machine in a ConfigMap, kept for
+// ttl after the deletion of its device. The ConfigMap is only created,
+// so that the manager does not cache the ConfigMaps: an autopsy left by a
+// previous attempt to delete the device is kept as is. It outlives the
+// machine, so nothing owns it: the clusterctl move label has clusterctl move
+// it anyway.
+func (r *PacketMachineReconciler) recordAutopsy(ctx context.Context, machineScope *scope.MachineScope, device *packngo.Device, ttl time.Duration) error {
+	packetMachine := machineScope.PacketMachine
+	events, err := r.PacketClient.LatestDeviceEvents(device.ID, packet.AutopsyEventCount)
+	if err != nil {
+		return fmt.Errorf("failed to get the events of the device %s: %w", device.ID, err)
+	}
+	data, err := packet.Autopsy(packetMachine, device, events)
+	if err != nil {
+		return err
+	}
+
+	autopsy := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      packetMachine.Name + "-autopsy",
+			Namespace: packetMachine.Namespace,
+			Labels: map[string]string{
+				infrastructurev1alpha3.AutopsyLabel:  packetMachine.Name,
+				clusterv1.ClusterLabelName:           machineScope.Cluster.Name,
+				clusterctlv1.ClusterctlMoveLabelName: "",
+			},
+			Annotations: map[string]string{
+				infrastructurev1alpha3.AutopsyExpiresAnnotation: time.Now().Add(ttl).UTC().Format(time.RFC3339),
+			},
+		},
+		Data: data,
+	}
+	if err := r.Create(ctx, autopsy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create the autopsy ConfigMap: %w", err)
+	}
+	return nil
+}
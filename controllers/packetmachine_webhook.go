@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+const (
+	// PacketMachineValidationPath is the path the PacketMachine validation
+	// webhook is served on.
+	PacketMachineValidationPath = "/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetmachine"
+	// PacketMachineTemplateValidationPath is the path the
+	// PacketMachineTemplate validation webhook is served on.
+	PacketMachineTemplateValidationPath = "/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetmachinetemplate"
+)
+
+// PacketMachineValidator rejects the PacketMachines and PacketMachineTemplates
+// whose machine type, operating system and facilities Packet can not fulfill,
+// telling why instead of the generic error of the device creation. Updates are
+// only checked when they change any of these, and everything is admitted until
+// the compatibility matrix is first fetched. The declarations of the userdata
+// template values and the VRFs are always checked, and so are the updates of
+// the PacketMachineTemplates, whose fields read when devices get created can
+// not change, and so is the machine type of the PacketMachines. The machine
+// type is also checked against the budget of the MaxHourlyCostAnnotation.
+type PacketMachineValidator struct {
+	Compatibility *CompatibilityCache
+
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetmachine,mutating=false,failurePolicy=ignore,groups=infrastructure.cluster.x-k8s.io,resources=packetmachines,versions=v1alpha3,name=validation.packetmachine.infrastructure.cluster.x-k8s.io
+// +kubebuilder:webhook:verbs=create;update,path=/validate-infrastructure-cluster-x-k8s-io-v1alpha3-packetmachinetemplate,mutating=false,failurePolicy=ignore,groups=infrastructure.cluster.x-k8s.io,resources=packetmachinetemplates,versions=v1alpha3,name=validation.packetmachinetemplate.infrastructure.cluster.x-k8s.io
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *PacketMachineValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *PacketMachineValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allowed("")
+	}
+
+	spec, annotations, err := v.decode(req.Kind.Kind, req.Object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	budget, hasBudget, err := packet.MaxHourlyCost(annotations)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	if err := packet.ValidateTemplateValuesFrom(spec.TemplateValuesFrom); err != nil {
+		return admission.Denied(err.Error())
+	}
+	if err := packet.ValidateUserTags(spec.Tags); err != nil {
+		return admission.Denied(err.Error())
+	}
+	if err := packet.ValidateMachineNetworking(spec, nil); err != nil {
+		return admission.Denied(err.Error())
+	}
+	if spec.TemplateRef == nil && (spec.OS == "" || spec.BillingCycle == "" || spec.MachineType == "") {
+		return admission.Denied("OS, billingCycle and machineType are required unless templateRef is set")
+	}
+	if req.Kind.Kind == "PacketMachine" && req.Operation == admissionv1beta1.Update {
+		old, _, err := v.decode(req.Kind.Kind, req.OldObject)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		// the machine type of a machine referencing a template is empty
+		// until the controller merged the template
+		if old.MachineType != "" && old.MachineType != spec.MachineType {
+			return admission.Denied(fmt.Sprintf("spec.machineType of a PacketMachine can not be changed, its device would keep machine type %s: "+
+				"set the %s annotation of its MachineDeployment to the machine type to roll the machines out to it", old.MachineType, infrastructurev1alpha3.PlanMigrationAnnotation))
+		}
+	}
+	if req.Kind.Kind == "PacketMachineTemplate" && req.Operation == admissionv1beta1.Update {
+		old, _, err := v.decode(req.Kind.Kind, req.OldObject)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		changed, err := packet.TemplateSpecChanges(old, spec)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if len(changed) != 0 {
+			return admission.Denied(fmt.Sprintf("spec.template.spec.%s of a PacketMachineTemplate can not be changed, the existing devices would not match it: "+
+				"create a new PacketMachineTemplate and reference it from the MachineDeployment or control plane to roll the machines out", strings.Join(changed, ", spec.template.spec.")))
+		}
+	}
+
+	// the fields taken from a referenced template are only known once the
+	// controller merged it, the template is checked on its own admission
+	matrix := v.Compatibility.Matrix()
+	if matrix == nil || spec.TemplateRef != nil {
+		return admission.Allowed("")
+	}
+	checkMachine, checkBudget := true, hasBudget
+	if req.Operation == admissionv1beta1.Update {
+		old, oldAnnotations, err := v.decode(req.Kind.Kind, req.OldObject)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		checkMachine = compatibilityChanged(old, spec)
+		checkBudget = hasBudget && (old.MachineType != spec.MachineType ||
+			oldAnnotations[infrastructurev1alpha3.MaxHourlyCostAnnotation] != annotations[infrastructurev1alpha3.MaxHourlyCostAnnotation])
+	}
+
+	if checkMachine {
+		if err := matrix.CheckMachine(spec, "", ""); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	if checkBudget {
+		if err := matrix.CheckBudget(spec.MachineType, budget); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+	return admission.Allowed("")
+}
+
+// decode returns the PacketMachineSpec of a PacketMachine or of the template
+// of a PacketMachineTemplate, with the annotations of the object.
+func (v *PacketMachineValidator) decode(kind string, raw runtime.RawExtension) (infrastructurev1alpha3.PacketMachineSpec, map[string]string, error) {
+	if kind == "PacketMachineTemplate" {
+		template := &infrastructurev1alpha3.PacketMachineTemplate{}
+		err := v.decoder.DecodeRaw(raw, template)
+		return template.Spec.Template.Spec, template.Annotations, err
+	}
+	machine := &infrastructurev1alpha3.PacketMachine{}
+	err := v.decoder.DecodeRaw(raw, machine)
+	return machine.Spec, machine.Annotations, err
+}
+
+// compatibilityChanged reports whether the fields checked against the
+// compatibility matrix differ.
+func compatibilityChanged(old, spec infrastructurev1alpha3.PacketMachineSpec) bool {
+	return old.MachineType != spec.MachineType ||
+		packet.DeviceOS(old) != packet.DeviceOS(spec) ||
+		old.Facility != spec.Facility ||
+		!equality.Semantic.DeepEqual(old.Facilities, spec.Facilities) ||
+		old.HardwareReservationID != spec.HardwareReservationID ||
+		!equality.Semantic.DeepEqual(old.GPU, spec.GPU)
+}
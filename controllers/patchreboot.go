@@ -0,0 +1,285 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/noderefutil"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	kubedrain "sigs.k8s.io/cluster-api/third_party/kubernetes-drain"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// patchRebootRequeue is how often the nodes of a failure domain being
+// rebooted are checked.
+const patchRebootRequeue = 30 * time.Second
+
+// reconcilePatchReboots drains and reboots the nodes of the cluster requiring
+// a reboot, one failure domain at a time, and returns when to check them
+// again. Reboots do not hold the cluster back.
+func (r *PacketClusterReconciler) reconcilePatchReboots(ctx context.Context, clusterScope *scope.ClusterScope) time.Duration {
+	packetcluster := clusterScope.PacketCluster
+	policy := packetcluster.Spec.PatchReboots
+	if policy == nil {
+		packetcluster.Status.PatchReboot = nil
+		conditions.Delete(packetcluster, v1alpha3.NodesRebootedCondition)
+		return 0
+	}
+	interval := packet.PatchRebootCheckInterval(policy)
+	// the workload cluster has no nodes before its control plane is up
+	if !clusterScope.Cluster.Status.ControlPlaneInitialized {
+		return interval
+	}
+
+	restConfig, err := remote.RESTConfig(ctx, r.Client, util.ObjectKey(clusterScope.Cluster))
+	if err != nil {
+		clusterScope.Error(err, "failed to get the workload cluster config")
+		conditions.MarkFalse(packetcluster, v1alpha3.NodesRebootedCondition, v1alpha3.PatchRebootFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return interval
+	}
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		clusterScope.Error(err, "failed to create the workload cluster client")
+		conditions.MarkFalse(packetcluster, v1alpha3.NodesRebootedCondition, v1alpha3.PatchRebootFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return interval
+	}
+
+	annotation := packet.RebootRequiredAnnotation(policy)
+	candidates, nodes, err := r.rebootCandidates(ctx, clusterScope, kubeClient, annotation)
+	if err != nil {
+		clusterScope.Error(err, "failed to list the nodes to reboot")
+		conditions.MarkFalse(packetcluster, v1alpha3.NodesRebootedCondition, v1alpha3.PatchRebootFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return interval
+	}
+
+	status := packetcluster.Status.PatchReboot
+	if status == nil {
+		domain := packet.NextRebootDomain(candidates)
+		if domain == "" {
+			conditions.MarkTrue(packetcluster, v1alpha3.NodesRebootedCondition)
+			return interval
+		}
+		status = &v1alpha3.PatchRebootStatus{FailureDomain: domain}
+		packetcluster.Status.PatchReboot = status
+		clusterScope.Info("Rebooting the nodes of a failure domain", "failureDomain", domain)
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "PatchRebootStarted", "Rebooting the nodes of failure domain %s", domain)
+	}
+
+	log := clusterScope.Logger.WithValues("failureDomain", status.FailureDomain)
+	drainer := &kubedrain.Helper{
+		Ctx:                 ctx,
+		Client:              kubeClient,
+		Force:               true,
+		IgnoreAllDaemonSets: true,
+		DeleteLocalData:     true,
+		GracePeriodSeconds:  -1,
+		// pods not evicted in time, e.g. held by a PodDisruptionBudget,
+		// are evicted again on the next check
+		Timeout: 20 * time.Second,
+		Out:     logWriter{log},
+		ErrOut:  logWriter{log},
+	}
+
+	var failed, blocked []string
+	// the nodes back from their reboot are uncordoned
+	rebooting := []v1alpha3.RebootingNode{}
+	for _, n := range status.Nodes {
+		node, ok := nodes[n.Name]
+		if !ok {
+			// deleted meanwhile, e.g. by a rollout
+			continue
+		}
+		if n.RebootedAt == nil || !packet.NodeRebooted(node, n.BootID) {
+			rebooting = append(rebooting, n)
+			continue
+		}
+		if err := finishNodeReboot(kubeClient, drainer, node, annotation); err != nil {
+			log.Error(err, "failed to uncordon the rebooted node", "node", n.Name)
+			failed = append(failed, err.Error())
+			rebooting = append(rebooting, n)
+			continue
+		}
+		for i := range candidates {
+			if candidates[i].Node == n.Name {
+				candidates[i].Required = false
+			}
+		}
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "NodeRebooted", "Node %s is ready after its reboot", n.Name)
+	}
+
+	maxUnavailable := 1
+	if policy.MaxUnavailable > 0 {
+		maxUnavailable = int(policy.MaxUnavailable)
+	}
+	devices := map[string]string{}
+	for _, c := range candidates {
+		devices[c.Node] = c.DeviceID
+	}
+	for _, c := range packet.NodesToReboot(candidates, &v1alpha3.PatchRebootStatus{FailureDomain: status.FailureDomain, Nodes: rebooting}, maxUnavailable) {
+		rebooting = append(rebooting, v1alpha3.RebootingNode{Name: c.Node, BootID: nodes[c.Node].Status.NodeInfo.BootID})
+	}
+	status.Nodes = rebooting
+
+	for i := range status.Nodes {
+		n := &status.Nodes[i]
+		if n.RebootedAt != nil {
+			continue
+		}
+		if err := kubedrain.RunCordonOrUncordon(drainer, nodes[n.Name], true); err != nil {
+			log.Error(err, "failed to cordon the node", "node", n.Name)
+			failed = append(failed, fmt.Sprintf("failed to cordon node %s: %v", n.Name, err))
+			continue
+		}
+		if err := kubedrain.RunNodeDrain(drainer, n.Name); err != nil {
+			log.Info("Waiting for the pods of the node to be evicted", "node", n.Name, "reason", err.Error())
+			blocked = append(blocked, fmt.Sprintf("%s: %v", n.Name, err))
+			continue
+		}
+		if err := r.PacketClient.RebootDevice(devices[n.Name]); err != nil {
+			log.Error(err, "failed to reboot the device of the node", "node", n.Name)
+			failed = append(failed, fmt.Sprintf("failed to reboot the device of node %s: %v", n.Name, err))
+			continue
+		}
+		now := metav1.Now()
+		n.RebootedAt = &now
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "NodeRebooting", "Drained node %s and rebooted its device %s", n.Name, devices[n.Name])
+	}
+
+	if len(status.Nodes) == 0 {
+		clusterScope.Info("Rebooted the nodes of a failure domain", "failureDomain", status.FailureDomain)
+		r.Recorder.Eventf(packetcluster, corev1.EventTypeNormal, "PatchRebootCompleted", "Rebooted the nodes of failure domain %s", status.FailureDomain)
+		packetcluster.Status.PatchReboot = nil
+	}
+
+	names := make([]string, 0, len(status.Nodes))
+	for _, n := range status.Nodes {
+		names = append(names, n.Name)
+	}
+	switch {
+	case len(failed) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.NodesRebootedCondition, v1alpha3.PatchRebootFailedReason, clusterv1.ConditionSeverityWarning, "%s", strings.Join(failed, "; "))
+	case len(blocked) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.NodesRebootedCondition, v1alpha3.DrainBlockedReason, clusterv1.ConditionSeverityWarning, "%s", strings.Join(blocked, "; "))
+	case len(names) > 0:
+		conditions.MarkFalse(packetcluster, v1alpha3.NodesRebootedCondition, v1alpha3.PatchRebootInProgressReason, clusterv1.ConditionSeverityInfo,
+			"Rebooting nodes %s of failure domain %s", strings.Join(names, ", "), status.FailureDomain)
+	}
+	// the next failure domain, if any, starts on the next check
+	return patchRebootRequeue
+}
+
+// rebootCandidates returns the nodes of the Machines of the cluster, sorted
+// by name, and the nodes of the workload cluster by name. annotation tells
+// the nodes requiring a reboot.
+func (r *PacketClusterReconciler) rebootCandidates(ctx context.Context, clusterScope *scope.ClusterScope, kubeClient kubernetes.Interface, annotation string) ([]packet.RebootCandidate, map[string]*corev1.Node, error) {
+	selector := client.MatchingLabels{clusterv1.ClusterLabelName: clusterScope.Name()}
+	machines := &clusterv1.MachineList{}
+	if err := r.List(ctx, machines, client.InNamespace(clusterScope.Namespace()), selector); err != nil {
+		return nil, nil, fmt.Errorf("failed to list Machines: %w", err)
+	}
+	packetMachines := &v1alpha3.PacketMachineList{}
+	if err := r.List(ctx, packetMachines, client.InNamespace(clusterScope.Namespace()), selector); err != nil {
+		return nil, nil, fmt.Errorf("failed to list PacketMachines: %w", err)
+	}
+	byName := map[string]*v1alpha3.PacketMachine{}
+	for i := range packetMachines.Items {
+		byName[packetMachines.Items[i].Name] = &packetMachines.Items[i]
+	}
+
+	nodeList, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list the nodes of the workload cluster: %w", err)
+	}
+	nodes := map[string]*corev1.Node{}
+	for i := range nodeList.Items {
+		nodes[nodeList.Items[i].Name] = &nodeList.Items[i]
+	}
+
+	candidates := []packet.RebootCandidate{}
+	for _, m := range machines.Items {
+		if m.Status.NodeRef == nil || m.Spec.ProviderID == nil || !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		node, ok := nodes[m.Status.NodeRef.Name]
+		if !ok {
+			continue
+		}
+		providerID, err := noderefutil.NewProviderID(*m.Spec.ProviderID)
+		if err != nil {
+			continue
+		}
+		domain := ""
+		if m.Spec.FailureDomain != nil {
+			domain = *m.Spec.FailureDomain
+		}
+		if packetMachine, ok := byName[m.Spec.InfrastructureRef.Name]; domain == "" && ok {
+			domain = clusterScope.MachineFacility(packetMachine)
+		}
+		_, required := node.Annotations[annotation]
+		candidates = append(candidates, packet.RebootCandidate{
+			Node:          node.Name,
+			DeviceID:      providerID.ID(),
+			FailureDomain: domain,
+			Required:      required,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Node < candidates[j].Node })
+	return candidates, nodes, nil
+}
+
+// finishNodeReboot uncordons a node back from its reboot and removes the
+// annotation it required the reboot with.
+func finishNodeReboot(kubeClient kubernetes.Interface, drainer *kubedrain.Helper, node *corev1.Node, annotation string) error {
+	if err := kubedrain.RunCordonOrUncordon(drainer, node, false); err != nil {
+		return fmt.Errorf("failed to uncordon node %s: %w", node.Name, err)
+	}
+	if _, ok := node.Annotations[annotation]; !ok {
+		return nil
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, annotation)
+	if _, err := kubeClient.CoreV1().Nodes().Patch(node.Name, types.MergePatchType, []byte(patch)); err != nil {
+		return fmt.Errorf("failed to remove annotation %s from node %s: %w", annotation, node.Name, err)
+	}
+	return nil
+}
+
+// logWriter writes the output of the drain helper to a logger.
+type logWriter struct {
+	logr.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.Info(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// PlanMigrationReconciler moves the machines of the MachineDeployments with
+// the plan migration annotation to its machine type. It clones the
+// PacketMachineTemplate of the MachineDeployment with the machine type and
+// references the clone from the MachineDeployment, which rolls the machines
+// out as configured by its strategy. The progress of the roll out is reported
+// on the status of the clone.
+type PlanMigrationReconciler struct {
+	client.Client
+	Log           logr.Logger
+	Recorder      record.EventRecorder
+	Compatibility *CompatibilityCache
+}
+
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinedeployments,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetmachinetemplates,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetmachinetemplates/status,verbs=get;update;patch
+
+func (r *PlanMigrationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("machinedeployment", req.NamespacedName)
+
+	md := &clusterv1.MachineDeployment{}
+	if err := r.Get(ctx, req.NamespacedName, md); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	machineType := md.Annotations[infrastructurev1alpha3.PlanMigrationAnnotation]
+	ref := md.Spec.Template.Spec.InfrastructureRef
+	if machineType == "" || !md.DeletionTimestamp.IsZero() ||
+		ref.Kind != "PacketMachineTemplate" || ref.GroupVersionKind().Group != infrastructurev1alpha3.GroupVersion.Group {
+		return ctrl.Result{}, nil
+	}
+
+	template := &infrastructurev1alpha3.PacketMachineTemplate{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: md.Namespace, Name: ref.Name}, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if template.Spec.Template.Spec.MachineType != machineType {
+		migrated, err := r.startMigration(ctx, md, template, machineType)
+		if err != nil || migrated == nil {
+			return ctrl.Result{}, err
+		}
+		logger.Info("Started plan migration", "from", template.Spec.Template.Spec.MachineType, "to", machineType, "template", migrated.Name)
+		template = migrated
+	}
+
+	// the template was not created by a plan migration, there is nothing to
+	// report on
+	if _, ok := template.Annotations[infrastructurev1alpha3.MigratedFromAnnotation]; !ok || template.Status.Migration == nil {
+		return ctrl.Result{}, nil
+	}
+	wasMigrated := conditions.IsTrue(template, infrastructurev1alpha3.MachinesMigratedCondition)
+	patch := client.MergeFrom(template.DeepCopy())
+	packet.MarkPlanMigration(template, md)
+	if err := r.Status().Patch(ctx, template, patch); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to patch the status of PacketMachineTemplate %s", template.Name)
+	}
+	if !wasMigrated && conditions.IsTrue(template, infrastructurev1alpha3.MachinesMigratedCondition) {
+		r.Recorder.Eventf(md, corev1.EventTypeNormal, "PlanMigrationCompleted", "The machines moved to machine type %s", machineType)
+	}
+	return ctrl.Result{}, nil
+}
+
+// startMigration creates the template of the migration of md to machineType,
+// or gets it when it exists, and references it from md. It returns nil when
+// the migration can not start.
+func (r *PlanMigrationReconciler) startMigration(ctx context.Context, md *clusterv1.MachineDeployment, template *infrastructurev1alpha3.PacketMachineTemplate, machineType string) (*infrastructurev1alpha3.PacketMachineTemplate, error) {
+	migrated := packet.PlanMigrationTemplate(template, machineType)
+	if matrix := r.Compatibility.Matrix(); matrix != nil {
+		if err := matrix.CheckMachine(migrated.Spec.Template.Spec, "", ""); err != nil {
+			r.Recorder.Eventf(md, corev1.EventTypeWarning, "InvalidPlanMigration", "Can not move the machines to machine type %s: %v", machineType, err)
+			return nil, nil
+		}
+	}
+
+	if err := r.Create(ctx, migrated); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, errors.Wrapf(err, "failed to create PacketMachineTemplate %s", migrated.Name)
+		}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: migrated.Namespace, Name: migrated.Name}, migrated); err != nil {
+			return nil, err
+		}
+		if migrated.Spec.Template.Spec.MachineType != machineType {
+			r.Recorder.Eventf(md, corev1.EventTypeWarning, "InvalidPlanMigration", "PacketMachineTemplate %s exists with machine type %s", migrated.Name, migrated.Spec.Template.Spec.MachineType)
+			return nil, nil
+		}
+	}
+	if migrated.Status.Migration == nil {
+		patch := client.MergeFrom(migrated.DeepCopy())
+		migrated.Status.Migration = &infrastructurev1alpha3.PlanMigrationStatus{
+			MachineDeployment: md.Name,
+			FromMachineType:   template.Spec.Template.Spec.MachineType,
+			MachineType:       machineType,
+		}
+		conditions.MarkFalse(migrated, infrastructurev1alpha3.MachinesMigratedCondition, infrastructurev1alpha3.RollingOutReason, clusterv1.ConditionSeverityInfo, "")
+		if err := r.Status().Patch(ctx, migrated, patch); err != nil {
+			return nil, errors.Wrapf(err, "failed to patch the status of PacketMachineTemplate %s", migrated.Name)
+		}
+	}
+
+	patch := client.MergeFrom(md.DeepCopy())
+	md.Spec.Template.Spec.InfrastructureRef.Name = migrated.Name
+	if err := r.Patch(ctx, md, patch); err != nil {
+		statusPatch := client.MergeFrom(migrated.DeepCopy())
+		conditions.MarkFalse(migrated, infrastructurev1alpha3.MachineDeploymentUpdatedCondition, infrastructurev1alpha3.MachineDeploymentUpdateFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		if err := r.Status().Patch(ctx, migrated, statusPatch); err != nil {
+			r.Log.Error(err, "failed to patch the status of PacketMachineTemplate", "template", migrated.Name)
+		}
+		return nil, errors.Wrapf(err, "failed to reference PacketMachineTemplate %s from MachineDeployment %s", migrated.Name, md.Name)
+	}
+	r.Recorder.Eventf(md, corev1.EventTypeNormal, "PlanMigrationStarted", "Moving the machines from machine type %s to %s with PacketMachineTemplate %s",
+		template.Spec.Template.Spec.MachineType, machineType, migrated.Name)
+	return migrated, nil
+}
+
+func (r *PlanMigrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&clusterv1.MachineDeployment{}).
+		Complete(r)
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/addons"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/plural"
+)
+
+// pluralRegistrationRequeue is how often the clusters waiting for their
+// control plane, or failing to register, are checked again.
+const pluralRegistrationRequeue = 30 * time.Second
+
+// PluralRegistrationReconciler registers the clusters of the PacketClusters
+// labelled with the PluralRegisterLabel with the Plural console once their
+// control plane is reachable. The deploy token of a registered cluster is
+// applied to it by a ClusterResourceSet, for the Plural deployment agent to
+// connect to the console, and the Cluster is labelled with the
+// PluralAgentLabel for add-on providers to install the agent. The
+// PluralRegistrationFinalizer deregisters the cluster once the PacketCluster
+// is deleted.
+type PluralRegistrationReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Console  *plural.Client
+}
+
+// +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=packetclusters,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=clusterresourcesets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
+
+func (r *PluralRegistrationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("packetcluster", req.NamespacedName)
+
+	packetCluster := &infrastructurev1alpha3.PacketCluster{}
+	if err := r.Get(ctx, req.NamespacedName, packetCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	if !packetCluster.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, logger, packetCluster)
+	}
+	if packetCluster.Labels[infrastructurev1alpha3.PluralRegisterLabel] != "true" {
+		return ctrl.Result{}, nil
+	}
+
+	// the finalizer is set before registering, for the cluster not to be
+	// left registered once deleted
+	if !controllerutil.ContainsFinalizer(packetCluster, infrastructurev1alpha3.PluralRegistrationFinalizer) {
+		patch := client.MergeFrom(packetCluster.DeepCopy())
+		controllerutil.AddFinalizer(packetCluster, infrastructurev1alpha3.PluralRegistrationFinalizer)
+		if err := r.Patch(ctx, packetCluster, patch); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to add the Plural registration finalizer")
+		}
+	}
+	// the id is only recorded once the registration is complete
+	if packetCluster.Annotations[infrastructurev1alpha3.PluralClusterIDAnnotation] != "" {
+		return ctrl.Result{}, nil
+	}
+
+	cluster, err := util.GetOwnerCluster(ctx, r.Client, packetCluster.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if cluster == nil || !cluster.Status.ControlPlaneInitialized {
+		return ctrl.Result{RequeueAfter: pluralRegistrationRequeue}, nil
+	}
+	if err := r.checkReachable(ctx, cluster); err != nil {
+		logger.V(1).Info("waiting for the control plane to be reachable", "error", err.Error())
+		return ctrl.Result{RequeueAfter: pluralRegistrationRequeue}, nil
+	}
+
+	handle := packetCluster.Namespace + "-" + packetCluster.Name
+	if value := packetCluster.Annotations[infrastructurev1alpha3.PluralHandleAnnotation]; value != "" {
+		handle = value
+	}
+	registered, err := r.Console.RegisterCluster(ctx, plural.ClusterAttributes{
+		Name:   packetCluster.Name,
+		Handle: handle,
+		Tags: []plural.Tag{
+			{Name: "namespace", Value: packetCluster.Namespace},
+			{Name: "cluster", Value: cluster.Name},
+			{Name: "provider", Value: "equinix-metal"},
+			// a moved cluster keeps the UID it recorded
+			{Name: plural.OwnerTag, Value: packet.ClusterUID(packetCluster)},
+		},
+	})
+	if err != nil {
+		logger.Error(err, "failed to register the cluster with the Plural console")
+		r.Recorder.Eventf(packetCluster, corev1.EventTypeWarning, "PluralRegistrationFailed", "Failed to register the cluster with the Plural console: %v", err)
+		return ctrl.Result{RequeueAfter: pluralRegistrationRequeue}, nil
+	}
+
+	manifests, err := plural.AgentManifests(r.Console.URL, registered.DeployToken)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	name := packetCluster.Name + "-plural-agent"
+	owner := *metav1.NewControllerRef(packetCluster, infrastructurev1alpha3.GroupVersion.WithKind("PacketCluster"))
+	labels := map[string]string{clusterv1.ClusterLabelName: cluster.Name}
+	selector := map[string]string{infrastructurev1alpha3.PluralAgentLabel: packetCluster.Name}
+	if err := addons.EnsureResourceSet(ctx, r.Client, packetCluster.Namespace, name, owner, labels, selector, []addons.Resource{{Name: name, Manifests: manifests}}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if cluster.Labels[infrastructurev1alpha3.PluralAgentLabel] != packetCluster.Name {
+		patch := client.MergeFrom(cluster.DeepCopy())
+		if cluster.Labels == nil {
+			cluster.Labels = map[string]string{}
+		}
+		cluster.Labels[infrastructurev1alpha3.PluralAgentLabel] = packetCluster.Name
+		if err := r.Patch(ctx, cluster, patch); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to label the Cluster for the Plural deployment agent")
+		}
+	}
+
+	if packetCluster.Annotations[infrastructurev1alpha3.PluralClusterIDAnnotation] != registered.ID {
+		patch := client.MergeFrom(packetCluster.DeepCopy())
+		if packetCluster.Annotations == nil {
+			packetCluster.Annotations = map[string]string{}
+		}
+		packetCluster.Annotations[infrastructurev1alpha3.PluralClusterIDAnnotation] = registered.ID
+		if err := r.Patch(ctx, packetCluster, patch); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to annotate the PacketCluster with its Plural cluster id")
+		}
+		r.Recorder.Eventf(packetCluster, corev1.EventTypeNormal, "PluralClusterRegistered", "Registered with the Plural console as %s (%s)", handle, registered.ID)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcileDelete deregisters the cluster of a deleted PacketCluster from the
+// Plural console, and lets the PacketCluster go.
+func (r *PluralRegistrationReconciler) reconcileDelete(ctx context.Context, logger logr.Logger, packetCluster *infrastructurev1alpha3.PacketCluster) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(packetCluster, infrastructurev1alpha3.PluralRegistrationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if id := packetCluster.Annotations[infrastructurev1alpha3.PluralClusterIDAnnotation]; id != "" {
+		if err := r.Console.DeregisterCluster(ctx, id); err != nil {
+			logger.Error(err, "failed to deregister the cluster from the Plural console")
+			r.Recorder.Eventf(packetCluster, corev1.EventTypeWarning, "PluralDeregistrationFailed", "Failed to deregister the cluster from the Plural console: %v", err)
+			return ctrl.Result{RequeueAfter: pluralRegistrationRequeue}, nil
+		}
+		r.Recorder.Eventf(packetCluster, corev1.EventTypeNormal, "PluralClusterDeregistered", "Deregistered %s from the Plural console", id)
+	}
+
+	patch := client.MergeFrom(packetCluster.DeepCopy())
+	controllerutil.RemoveFinalizer(packetCluster, infrastructurev1alpha3.PluralRegistrationFinalizer)
+	if err := r.Patch(ctx, packetCluster, patch); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to remove the Plural registration finalizer")
+	}
+	return ctrl.Result{}, nil
+}
+
+// checkReachable returns an error unless the API server of the workload
+// cluster answers with the kubeconfig Cluster API generated for it.
+func (r *PluralRegistrationReconciler) checkReachable(ctx context.Context, cluster *clusterv1.Cluster) error {
+	restConfig, err := remote.RESTConfig(ctx, r.Client, util.ObjectKey(cluster))
+	if err != nil {
+		return err
+	}
+	restConfig.Timeout = 10 * time.Second
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	_, err = kubeClient.Discovery().ServerVersion()
+	return err
+}
+
+func (r *PluralRegistrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pluralregistration").
+		For(&infrastructurev1alpha3.PacketCluster{}).
+		Complete(r)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// ScaleInHintReconciler keeps the Cluster API delete-machine annotation on
+// the Machines of a MachineSet that should go first when it scales in, as
+// ranked by the scale in policy of the MachineSet. MachineSets without a
+// policy are left alone.
+type ScaleInHintReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinesets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch;patch
+
+func (r *ScaleInHintReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("machineset", req.NamespacedName)
+
+	machineSet := &clusterv1.MachineSet{}
+	if err := r.Get(ctx, req.NamespacedName, machineSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	machines, err := r.machineSetMachines(ctx, machineSet)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	victims := map[string]bool{}
+	if value, ok := machineSet.Annotations[infrastructurev1alpha3.ScaleInPolicyAnnotation]; ok && machineSet.DeletionTimestamp.IsZero() {
+		policy, err := packet.ParseScaleInPolicy(value)
+		if err != nil {
+			logger.Error(err, "invalid scale in policy")
+			r.Recorder.Eventf(machineSet, corev1.EventTypeWarning, "InvalidScaleInPolicy", "Invalid scale in policy: %v", err)
+			return ctrl.Result{}, nil
+		}
+		count := 1
+		if value, ok := machineSet.Annotations[infrastructurev1alpha3.ScaleInCandidatesAnnotation]; ok {
+			if count, err = strconv.Atoi(value); err != nil || count < 0 {
+				r.Recorder.Eventf(machineSet, corev1.EventTypeWarning, "InvalidScaleInPolicy", "Invalid scale in candidates count %q", value)
+				return ctrl.Result{}, nil
+			}
+		}
+		victims, err = r.selectVictims(ctx, machineSet, machines, policy, count)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	for _, machine := range machines {
+		_, hinted := machine.Annotations[infrastructurev1alpha3.ScaleInHintAnnotation]
+		_, marked := machine.Annotations[clusterv1.DeleteMachineAnnotation]
+		patch := client.MergeFrom(machine.DeepCopy())
+		switch {
+		case victims[machine.Name] && !marked:
+			if machine.Annotations == nil {
+				machine.Annotations = map[string]string{}
+			}
+			machine.Annotations[clusterv1.DeleteMachineAnnotation] = "yes"
+			machine.Annotations[infrastructurev1alpha3.ScaleInHintAnnotation] = "yes"
+		case !victims[machine.Name] && hinted:
+			delete(machine.Annotations, clusterv1.DeleteMachineAnnotation)
+			delete(machine.Annotations, infrastructurev1alpha3.ScaleInHintAnnotation)
+		default:
+			continue
+		}
+		if err := r.Patch(ctx, machine, patch); err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to patch Machine %s", machine.Name)
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// selectVictims returns the names of the count Machines to delete first. The
+// Machines a user already marked for deletion are victims and count toward
+// count, the others are ranked with the policy.
+func (r *ScaleInHintReconciler) selectVictims(ctx context.Context, machineSet *clusterv1.MachineSet, machines []*clusterv1.Machine, policy []infrastructurev1alpha3.ScaleInPreference, count int) (map[string]bool, error) {
+	victims := map[string]bool{}
+	candidates := []packet.ScaleInCandidate{}
+	for _, machine := range machines {
+		_, hinted := machine.Annotations[infrastructurev1alpha3.ScaleInHintAnnotation]
+		if _, marked := machine.Annotations[clusterv1.DeleteMachineAnnotation]; marked && !hinted {
+			victims[machine.Name] = true
+			continue
+		}
+
+		candidate := packet.ScaleInCandidate{
+			Name:    machine.Name,
+			Created: machine.CreationTimestamp.Time,
+		}
+		ref := machine.Spec.InfrastructureRef
+		if ref.Kind == "PacketMachine" {
+			packetMachine := &infrastructurev1alpha3.PacketMachine{}
+			key := types.NamespacedName{Namespace: machine.Namespace, Name: ref.Name}
+			if err := r.Get(ctx, key, packetMachine); err != nil && !apierrors.IsNotFound(err) {
+				return nil, err
+			}
+			candidate.Metro = packetMachine.Status.Metro
+			candidate.HardwareReservationID = packetMachine.Status.HardwareReservationID
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	drainingMetros, err := r.drainingMetros(ctx, machineSet)
+	if err != nil {
+		return nil, err
+	}
+	packet.RankScaleInCandidates(candidates, policy, drainingMetros)
+	for _, candidate := range candidates {
+		if len(victims) >= count {
+			break
+		}
+		victims[candidate.Name] = true
+	}
+	return victims, nil
+}
+
+// machineSetMachines returns the Machines controlled by the MachineSet and
+// not being deleted.
+func (r *ScaleInHintReconciler) machineSetMachines(ctx context.Context, machineSet *clusterv1.MachineSet) ([]*clusterv1.Machine, error) {
+	machineList := &clusterv1.MachineList{}
+	if err := r.List(ctx, machineList, client.InNamespace(machineSet.Namespace), client.MatchingLabels(machineSet.Spec.Selector.MatchLabels)); err != nil {
+		return nil, errors.Wrap(err, "failed to list Machines")
+	}
+	machines := []*clusterv1.Machine{}
+	for i := range machineList.Items {
+		machine := &machineList.Items[i]
+		if metav1.IsControlledBy(machine, machineSet) && machine.DeletionTimestamp.IsZero() {
+			machines = append(machines, machine)
+		}
+	}
+	return machines, nil
+}
+
+// drainingMetros returns the draining metros of the PacketCluster of the
+// MachineSet.
+func (r *ScaleInHintReconciler) drainingMetros(ctx context.Context, machineSet *clusterv1.MachineSet) ([]string, error) {
+	cluster, err := util.GetClusterByName(ctx, r.Client, machineSet.Namespace, machineSet.Spec.ClusterName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if cluster.Spec.InfrastructureRef == nil || cluster.Spec.InfrastructureRef.Kind != "PacketCluster" {
+		return nil, nil
+	}
+	packetCluster := &infrastructurev1alpha3.PacketCluster{}
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Spec.InfrastructureRef.Name}
+	if err := r.Get(ctx, key, packetCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return packetCluster.Spec.DrainingMetros, nil
+}
+
+func (r *ScaleInHintReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&clusterv1.MachineSet{}).
+		Watches(
+			&source.Kind{Type: &clusterv1.Machine{}},
+			&handler.EnqueueRequestForOwner{OwnerType: &clusterv1.MachineSet{}, IsController: true},
+		).
+		Watches(
+			&source.Kind{Type: &infrastructurev1alpha3.PacketCluster{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.packetClusterToMachineSets),
+			},
+		).
+		Complete(r)
+}
+
+// packetClusterToMachineSets enqueues the MachineSets of the cluster of a
+// PacketCluster, so that a change of its draining metros is reflected.
+func (r *ScaleInHintReconciler) packetClusterToMachineSets(o handler.MapObject) []ctrl.Request {
+	result := []ctrl.Request{}
+
+	packetCluster, ok := o.Object.(*infrastructurev1alpha3.PacketCluster)
+	if !ok {
+		return nil
+	}
+	cluster, err := util.GetOwnerCluster(context.TODO(), r.Client, packetCluster.ObjectMeta)
+	if err != nil || cluster == nil {
+		return nil
+	}
+
+	machineSets := &clusterv1.MachineSetList{}
+	if err := r.List(context.TODO(), machineSets, client.InNamespace(cluster.Namespace), client.MatchingLabels{clusterv1.ClusterLabelName: cluster.Name}); err != nil {
+		r.Log.Error(err, "failed to list MachineSets", "cluster", cluster.Name)
+		return nil
+	}
+	for _, machineSet := range machineSets.Items {
+		if _, ok := machineSet.Annotations[infrastructurev1alpha3.ScaleInPolicyAnnotation]; !ok {
+			continue
+		}
+		result = append(result, ctrl.Request{
+			NamespacedName: client.ObjectKey{Namespace: machineSet.Namespace, Name: machineSet.Name},
+		})
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+)
+
+// TagMigrator retags, once at startup, the devices and ip reservations that
+// were tagged by a previous version of the provider so that the controllers
+// keep finding them after an upgrade.
+// It runs only on the leader, after the caches have synced.
+type TagMigrator struct {
+	client.Client
+	Log          logr.Logger
+	PacketClient packet.TagService
+}
+
+// Start implements manager.Runnable. Failures are logged and do not prevent
+// the manager from running: the migration is retried on the next startup.
+func (m *TagMigrator) Start(stop <-chan struct{}) error {
+	ctx := context.Background()
+
+	packetClusters := &infrastructurev1alpha3.PacketClusterList{}
+	if err := m.List(ctx, packetClusters); err != nil {
+		m.Log.Error(errors.Wrap(err, "failed to list PacketClusters"), "skipping tag migration")
+		return nil
+	}
+
+	for i := range packetClusters.Items {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		packetCluster := &packetClusters.Items[i]
+		logger := m.Log.WithValues("packetcluster", packetCluster.Namespace+"/"+packetCluster.Name)
+
+		cluster, err := util.GetOwnerCluster(ctx, m.Client, packetCluster.ObjectMeta)
+		if err != nil || cluster == nil {
+			logger.Info("OwnerCluster is not available, skipping tag migration")
+			continue
+		}
+
+		updated, err := m.PacketClient.MigrateClusterTags(cluster.Namespace, cluster.Name, packetCluster.Spec.ProjectID)
+		if err != nil {
+			logger.Error(err, "failed to migrate legacy tags")
+			continue
+		}
+		if updated > 0 {
+			logger.Info("migrated legacy tags", "resources", updated)
+		}
+	}
+	return nil
+}
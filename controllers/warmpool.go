@@ -0,0 +1,316 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/packethost/packngo"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// warmPoolFailedReason is the reason of the events of the templates whose
+// warm pool can not be kept.
+const warmPoolFailedReason = "WarmPoolFailed"
+
+// warmPoolClient is the part of the Packet API the warm pool works with.
+type warmPoolClient interface {
+	packet.DeviceService
+	packet.WarmPoolService
+}
+
+// WarmPool keeps devices provisioned with the base operating system of the
+// PacketMachineTemplates that set the warm pool size annotation, and hands
+// them over to the new machines of the templates, which then only need a
+// reinstall with their bootstrap data instead of a new device.
+// It runs only on the leader, after the caches have synced. The machines
+// claim devices from the PacketMachine controller.
+type WarmPool struct {
+	client.Client
+	Log          logr.Logger
+	Recorder     record.EventRecorder
+	PacketClient warmPoolClient
+
+	// Interval between two refills of the pools.
+	Interval time.Duration
+
+	// mu serializes the claims with each other and with the deletions of the
+	// refills, so that a device is claimed once and is not deleted while being
+	// claimed.
+	mu sync.Mutex
+
+	// pools are the pools of the last refill, kept when the cluster of a
+	// template can not be read for a while.
+	pools map[string]warmTemplate
+	// projects hold warm devices, including the projects of the clusters
+	// deleted since, whose devices are deleted on the next refills.
+	projects map[string]bool
+}
+
+// warmCreation is the number of devices to create in the pool of a template.
+type warmCreation struct {
+	key   string
+	pool  warmTemplate
+	count int
+}
+
+// warmTemplate is a template whose pool is kept.
+type warmTemplate struct {
+	template    *infrastructurev1alpha3.PacketMachineTemplate
+	clusterSpec infrastructurev1alpha3.PacketClusterSpec
+	size        int
+}
+
+// Start implements manager.Runnable.
+func (p *WarmPool) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		p.refill(context.Background())
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refill creates the missing devices of every pool and deletes the extra
+// ones, including the devices of the templates that no longer have a pool and
+// of the clusters that were deleted. Failures are logged, the refill is
+// retried on the next tick.
+func (p *WarmPool) refill(ctx context.Context) {
+	templates := &infrastructurev1alpha3.PacketMachineTemplateList{}
+	if err := p.List(ctx, templates); err != nil {
+		p.Log.Error(errors.Wrap(err, "failed to list PacketMachineTemplates"), "skipping warm pool refill")
+		return
+	}
+	packetClusters := &infrastructurev1alpha3.PacketClusterList{}
+	if err := p.List(ctx, packetClusters); err != nil {
+		p.Log.Error(errors.Wrap(err, "failed to list PacketClusters"), "skipping warm pool refill")
+		return
+	}
+
+	// the devices of deleted templates are looked for in the projects of
+	// every cluster, and in the projects that held warm devices before
+	projects := map[string]bool{}
+	for projectID := range p.projects {
+		projects[projectID] = true
+	}
+	for _, packetCluster := range packetClusters.Items {
+		if packetCluster.Spec.ProjectID != "" {
+			projects[packetCluster.Spec.ProjectID] = true
+		}
+	}
+
+	pools := map[string]warmTemplate{}
+	for i := range templates.Items {
+		template := &templates.Items[i]
+		logger := p.Log.WithValues("packetmachinetemplate", template.Namespace+"/"+template.Name)
+
+		size, ok, err := packet.WarmPoolSize(template.Annotations)
+		if err != nil {
+			logger.Error(err, "invalid warm pool size")
+			p.Recorder.Event(template, corev1.EventTypeWarning, warmPoolFailedReason, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		key := template.Namespace + "/" + template.Name
+		clusterSpec, err := templateClusterSpec(ctx, p.Client, template)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				// the cluster is gone: its devices are extra
+				continue
+			}
+			logger.Error(err, "failed to get the PacketCluster of the template")
+			// keep the pool of the last refill rather than emptying it
+			if previous, ok := p.pools[key]; ok {
+				projects[previous.clusterSpec.ProjectID] = true
+				pools[key] = previous
+			}
+			continue
+		}
+		if clusterSpec.ProjectID == "" {
+			continue
+		}
+		projects[clusterSpec.ProjectID] = true
+		pools[key] = warmTemplate{template: template, clusterSpec: clusterSpec, size: size}
+	}
+	p.pools = pools
+
+	creations := p.trimPools(projects, pools)
+
+	// creating a device takes a while, the claims are not held up meanwhile
+	for _, creation := range creations {
+		p.createWarmDevices(creation)
+	}
+}
+
+// trimPools deletes the extra devices of the pools in the projects, and
+// returns the devices to create. It forgets the projects left without warm
+// devices or cluster.
+func (p *WarmPool) trimPools(projects map[string]bool, pools map[string]warmTemplate) []warmCreation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	used := map[string]bool{}
+	for _, pool := range pools {
+		used[pool.clusterSpec.ProjectID] = true
+	}
+
+	creations := []warmCreation{}
+	p.projects = map[string]bool{}
+	for projectID := range projects {
+		devices, err := p.PacketClient.ListWarmDevices(projectID)
+		if err != nil {
+			if packeterrors.IsNotFound(err) {
+				// the project was deleted with its cluster
+				continue
+			}
+			p.Log.Error(err, "failed to list the warm devices", "project", projectID)
+			p.projects[projectID] = true
+			continue
+		}
+		if len(devices) > 0 || used[projectID] {
+			p.projects[projectID] = true
+		}
+		poolDevices := map[string][]packngo.Device{}
+		for _, device := range devices {
+			key, _ := packet.WarmPoolTemplate(device)
+			poolDevices[key] = append(poolDevices[key], device)
+		}
+		for key, pool := range pools {
+			if pool.clusterSpec.ProjectID == projectID {
+				if _, ok := poolDevices[key]; !ok {
+					poolDevices[key] = nil
+				}
+			}
+		}
+
+		for key, devices := range poolDevices {
+			pool := pools[key]
+			if pool.clusterSpec.ProjectID != projectID {
+				// the template has no pool, or its cluster moved to another
+				// project: its devices in this one are extra
+				pool = warmTemplate{}
+			}
+			if create := p.trimPool(key, pool, devices); create > 0 {
+				creations = append(creations, warmCreation{key: key, pool: pool, count: create})
+			}
+		}
+	}
+	return creations
+}
+
+// trimPool deletes the extra devices of the pool of a template, all of them
+// for a template without a pool, and returns the number of devices missing.
+func (p *WarmPool) trimPool(key string, pool warmTemplate, devices []packngo.Device) int {
+	logger := p.Log.WithValues("packetmachinetemplate", key)
+
+	create, remove := packet.PlanWarmPool(devices, pool.size)
+	for _, device := range remove {
+		if err := p.PacketClient.DeleteDevice(device.ID); err != nil && !packeterrors.IsNotFound(err) {
+			logger.Error(err, "failed to delete a warm device", "device", device.ID)
+			continue
+		}
+		logger.Info("deleted an extra warm device", "device", device.ID)
+	}
+	return create
+}
+
+// createWarmDevices creates the missing devices of the pool of a template.
+func (p *WarmPool) createWarmDevices(creation warmCreation) {
+	logger := p.Log.WithValues("packetmachinetemplate", creation.key)
+	pool := creation.pool
+
+	for i := 0; i < creation.count; i++ {
+		spec := pool.template.Spec.Template.Spec
+		req, err := packet.WarmDeviceRequest(pool.template.Namespace, pool.template.Name, spec, pool.clusterSpec)
+		if err == nil {
+			var device *packngo.Device
+			if device, err = p.PacketClient.NewWarmDevice(req); err == nil {
+				logger.Info("created a warm device", "device", device.ID)
+				continue
+			}
+		}
+		logger.Error(err, "failed to create a warm device")
+		p.Recorder.Eventf(pool.template, corev1.EventTypeWarning, warmPoolFailedReason, "Failed to create a warm device: %v", err)
+		return
+	}
+}
+
+// Claim hands a warm device of the template the machine of req was cloned
+// from over to the machine, adopting it with the bootstrap data of the
+// machine. It returns nil when the template has no pool or no warm device is
+// ready yet.
+func (p *WarmPool) Claim(ctx context.Context, req packet.CreateDeviceRequest, projectID string) (*packngo.Device, error) {
+	packetMachine := req.MachineScope.PacketMachine
+	name := packetMachine.Annotations[clusterv1.TemplateClonedFromNameAnnotation]
+	groupKind := infrastructurev1alpha3.GroupVersion.WithKind("PacketMachineTemplate").GroupKind().String()
+	if name == "" || packetMachine.Annotations[clusterv1.TemplateClonedFromGroupKindAnnotation] != groupKind {
+		return nil, nil
+	}
+
+	template := &infrastructurev1alpha3.PacketMachineTemplate{}
+	if err := p.Get(ctx, client.ObjectKey{Namespace: packetMachine.Namespace, Name: name}, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size, _, err := packet.WarmPoolSize(template.Annotations); err != nil || size == 0 {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	devices, err := p.PacketClient.ListWarmDevices(projectID)
+	if err != nil {
+		return nil, err
+	}
+	pool := []packngo.Device{}
+	for _, device := range devices {
+		if key, _ := packet.WarmPoolTemplate(device); key == packetMachine.Namespace+"/"+name {
+			pool = append(pool, device)
+		}
+	}
+	device := packet.ClaimableWarmDevice(pool)
+	if device == nil {
+		return nil, nil
+	}
+
+	if err := p.PacketClient.ClaimWarmDevice(req, device); err != nil {
+		return nil, err
+	}
+	req.MachineScope.Info("Claimed a warm device", "device-id", device.ID, "packetmachinetemplate", name)
+	return p.PacketClient.GetDevice(device.ID)
+}
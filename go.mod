@@ -1,6 +1,6 @@
 module sigs.k8s.io/cluster-api-provider-packet
 
-go 1.13
+go 1.16
 
 require (
 	github.com/go-logr/logr v0.4.0
@@ -9,11 +9,19 @@ require (
 	github.com/onsi/gomega v1.14.0
 	github.com/packethost/packngo v0.13.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.5.1
+	go.opentelemetry.io/otel v1.2.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.2.0
+	go.opentelemetry.io/otel/sdk v1.2.0
+	go.opentelemetry.io/otel/trace v1.2.0
+	gomodules.xyz/jsonpatch/v2 v2.0.1
 	k8s.io/api v0.17.17
 	k8s.io/apimachinery v0.17.17
 	k8s.io/client-go v0.17.17
+	k8s.io/cluster-bootstrap v0.17.9
 	k8s.io/klog/v2 v2.0.0
 	k8s.io/utils v0.0.0-20201110183641-67b214c5f920
 	sigs.k8s.io/cluster-api v0.3.23
 	sigs.k8s.io/controller-runtime v0.5.14
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -16,12 +16,16 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -29,12 +33,17 @@ import (
 	"k8s.io/klog/v2/klogr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
 	"sigs.k8s.io/cluster-api-provider-packet/controllers"
 	packet "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/plural"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -48,6 +57,7 @@ func init() {
 	utilruntime.Must(infrastructurev1alpha3.AddToScheme(scheme))
 	utilruntime.Must(clusterv1.AddToScheme(scheme))
 	utilruntime.Must(bootstrapv1.AddToScheme(scheme))
+	utilruntime.Must(addonsv1.AddToScheme(scheme))
 
 	// +kubebuilder:scaffold:scheme
 }
@@ -62,6 +72,58 @@ func main() {
 		webhookPort             int
 		syncPeriod              time.Duration
 		watchNamespace          string
+		bootstrapTokenTTL       time.Duration
+		migrateLegacyTags       bool
+		metroMigration          string
+		tagSyncLabelPrefix      string
+		labelSyncTagPrefix      string
+		nodeLabels              bool
+		warmPoolInterval        time.Duration
+		apiCheckInterval        time.Duration
+		permissionInterval      time.Duration
+		projectDriftInterval    time.Duration
+		anomalyInterval         time.Duration
+		idleReservationAge      time.Duration
+		deletionConcurrency     int
+		clusterConcurrency      int
+		machineConcurrency      int
+		createFailureThreshold  int
+		createFailureWindow     time.Duration
+		createFailureCooldown   time.Duration
+		reservationClaimTTL     time.Duration
+		provisioningSLO         time.Duration
+		nodeReadinessCheck      bool
+		strictDeviceOwnership   bool
+		inventoryExport         bool
+		userDataDiffs           bool
+		pluralConsoleURL        string
+		oauthTokenURL           string
+		oauthAudience           string
+		projectOrganization     string
+		bootstrapCallbackAddr   string
+		bootstrapCallbackURL    string
+		bootstrapCallbackCerts  string
+		bootstrapCallbackTTL    time.Duration
+		ipxeServerAddr          string
+		ipxeServerURL           string
+		eipGCInterval           time.Duration
+		eipGCMinAge             time.Duration
+		eipGCDryRun             bool
+		eipGCProjects           string
+		capacityInterval        time.Duration
+		autopsyTTL              time.Duration
+		compatibilityInterval   time.Duration
+		apiHeaders              stringsFlag
+		clientIdleTimeout       time.Duration
+		clientHTTP              packet.HTTPOptions
+		rateWarningThreshold    float64
+		deviceCacheTTL          time.Duration
+		deviceCacheWarmUp       bool
+		otlpEndpoint            string
+		otlpInsecure            bool
+		traceSampleRatio        float64
+		allowedMachineTypes     string
+		configMap               string
 	)
 
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
@@ -96,6 +158,354 @@ func main() {
 		"Namespace that the controller watches to reconcile cluster-api objects. If unspecified, the controller watches for cluster-api objects across all namespaces.",
 	)
 
+	flag.DurationVar(&bootstrapTokenTTL,
+		"bootstrap-token-ttl",
+		15*time.Minute,
+		"The lifetime of the bootstrap tokens generated by the bootstrap provider. Bootstrap data older than this gets its token validated before creating a device. Set to 0 to disable the check.",
+	)
+
+	flag.BoolVar(&migrateLegacyTags,
+		"migrate-legacy-tags",
+		true,
+		"Retag at startup the devices and ip reservations tagged by previous versions of the provider.",
+	)
+
+	flag.StringVar(&metroMigration,
+		"metro-migration",
+		"",
+		"Move at startup the PacketClusters that only set a facility to the metro of that facility: "+
+			"report only reports the migrations, apply also updates the clusters. Disabled when empty.",
+	)
+
+	flag.StringVar(&tagSyncLabelPrefix,
+		"tag-sync-label-prefix",
+		"",
+		"Sync the labels of the Machines and PacketMachines with this prefix, such as metal.plural.sh/, into key=value tags of their devices. Disabled when empty.",
+	)
+
+	flag.StringVar(&labelSyncTagPrefix,
+		"label-sync-tag-prefix",
+		"",
+		"Sync the key=value tags of the devices with this prefix into labels of their PacketMachines. Disabled when empty.",
+	)
+
+	flag.BoolVar(&nodeLabels,
+		"node-labels",
+		false,
+		"Label the nodes of the workload clusters with the plan, metro, facility, hardware reservation and lifecycle of their devices.",
+	)
+
+	flag.DurationVar(&warmPoolInterval,
+		"warm-pool-interval",
+		0,
+		"The interval at which the warm pools of the PacketMachineTemplates setting a warm pool size are refilled. Disabled when 0.",
+	)
+
+	flag.DurationVar(&apiCheckInterval,
+		"api-check-interval",
+		time.Minute,
+		"How long the result of the Packet API reachability check used by the readiness probe is cached.",
+	)
+
+	flag.DurationVar(&permissionInterval,
+		"permission-check-interval",
+		10*time.Minute,
+		"How long the permissions of the Packet API key probed in the project of a cluster are cached. Set to 0 to disable the probe.",
+	)
+
+	flag.DurationVar(&projectDriftInterval,
+		"project-drift-interval",
+		10*time.Minute,
+		"How often the settings of the project of a cluster, BGP and its projectRequirements, are verified. Set to 0 to disable the verification.",
+	)
+
+	flag.DurationVar(&anomalyInterval,
+		"anomaly-interval",
+		time.Hour,
+		"How often the resources of a cluster wasting money, unowned devices, monthly billed machines of autoscaled node groups and idle hardware reservations, are looked for. Set to 0 to disable the analysis.",
+	)
+
+	flag.DurationVar(&idleReservationAge,
+		"idle-reservation-age",
+		7*24*time.Hour,
+		"How long a hardware reservation the machines of a cluster may provision on is idle before it is reported as an anomaly.",
+	)
+
+	flag.IntVar(&deletionConcurrency,
+		"cluster-deletion-concurrency",
+		0,
+		"Number of devices, tagged with the uid of their cluster, deleted in parallel when a cluster gets deleted. 0, the default, lets every machine delete its own device.",
+	)
+
+	flag.IntVar(&clusterConcurrency,
+		"packetcluster-concurrency",
+		10,
+		"Number of PacketClusters reconciled in parallel.",
+	)
+
+	flag.IntVar(&machineConcurrency,
+		"packetmachine-concurrency",
+		10,
+		"Number of PacketMachines reconciled in parallel. Raise it for large management clusters, along with --client-max-idle-conns.",
+	)
+
+	flag.IntVar(&createFailureThreshold,
+		"create-failure-threshold",
+		0,
+		"Number of device creations of a cluster failing within --create-failure-window, e.g. for lack of quota or capacity, after which no device is created for the cluster during --create-failure-cooldown. Disabled when 0.",
+	)
+
+	flag.DurationVar(&createFailureWindow,
+		"create-failure-window",
+		10*time.Minute,
+		"The window the failed device creations of a cluster are counted in.",
+	)
+
+	flag.DurationVar(&createFailureCooldown,
+		"create-failure-cooldown",
+		15*time.Minute,
+		"How long no device is created for a cluster once --create-failure-threshold is reached.",
+	)
+
+	flag.DurationVar(&reservationClaimTTL,
+		"reservation-claim-ttl",
+		packet.DefaultReservationClaimTTL,
+		"How long a machine keeps the other machines from trying the hardware reservation it creates its device on. The reservations of deleted devices are also held until deprovisioned. Disabled when 0.",
+	)
+
+	flag.DurationVar(&provisioningSLO,
+		"provisioning-slo",
+		0,
+		"How long the node of a machine may take to become ready from the creation request of its device. Slower machines are reported with an event and counted. Disabled when 0.",
+	)
+
+	flag.BoolVar(&nodeReadinessCheck,
+		"node-readiness-check",
+		false,
+		"Keep the PacketMachines from being ready until the node of their device registered with the workload cluster, read through the kubeconfig secret of the cluster. Control plane machines are only checked once the control plane is initialized.",
+	)
+
+	flag.BoolVar(&strictDeviceOwnership,
+		"strict-device-ownership",
+		false,
+		"Only change and delete the devices tagged with the uid of their cluster, or those of the PacketMachines set with the adopt-device annotation. Otherwise the devices of the machines found without the tag, or with the one of another cluster, get it.",
+	)
+
+	flag.BoolVar(&inventoryExport,
+		"inventory-export",
+		false,
+		"Publish the inventory of every cluster, its devices, plans, addresses, reservations and hourly costs, as JSON and CSV in the <packetcluster>-inventory ConfigMap.",
+	)
+
+	flag.BoolVar(&userDataDiffs,
+		"userdata-diffs",
+		true,
+		"Log the diff, secrets redacted, of the userdata rendered for a machine when it differs from the one of the previous machine of its node group.",
+	)
+
+	flag.StringVar(&pluralConsoleURL,
+		"plural-console-url",
+		"",
+		"The url of the Plural console the clusters of the PacketClusters labelled metal.plural.sh/register=true are registered with once their control plane is reachable, disabled when empty. The console token is read from the "+plural.TokenVarName+" environment variable.",
+	)
+
+	flag.StringVar(&projectOrganization,
+		"project-organization-id",
+		"",
+		"The organization the dedicated projects of the clusters are created in, unless they set their own.",
+	)
+
+	flag.StringVar(&bootstrapCallbackAddr,
+		"bootstrap-callback-addr",
+		"",
+		"The address the bootstrap callback endpoint binds to, disabled when empty.",
+	)
+
+	flag.StringVar(&bootstrapCallbackURL,
+		"bootstrap-callback-url",
+		"",
+		"The url devices reach the bootstrap callback endpoint at, rendered in their userdata. Devices are not expected to call back when empty.",
+	)
+
+	flag.StringVar(&bootstrapCallbackCerts,
+		"bootstrap-callback-cert-dir",
+		"",
+		"The directory holding the tls.crt and tls.key the bootstrap callback endpoint is served with, such as the webhook serving certificate. The endpoint is served over plain HTTP when empty, and must then be exposed through a TLS terminating ingress.",
+	)
+
+	flag.DurationVar(&bootstrapCallbackTTL,
+		"bootstrap-callback-timeout",
+		30*time.Minute,
+		"How long an active device has to call back before its bootstrap is reported as failed.",
+	)
+
+	flag.StringVar(&ipxeServerAddr,
+		"ipxe-server-addr",
+		"",
+		"The address the iPXE server, serving the scripts of the machines with a boot profile, binds to, disabled when empty.",
+	)
+
+	flag.StringVar(&ipxeServerURL,
+		"ipxe-server-url",
+		"",
+		"The url devices reach the iPXE server at. The machines with a boot profile are rejected when empty.",
+	)
+
+	flag.DurationVar(&eipGCInterval,
+		"eip-gc-interval",
+		0,
+		"Interval at which the elastic ips reserved for clusters that no longer exist are released. Set to 0, the default, to disable the collection.",
+	)
+
+	flag.DurationVar(&eipGCMinAge,
+		"eip-gc-min-age",
+		time.Hour,
+		"Minimum age of an elastic ip reservation before it can be released by the collection.",
+	)
+
+	flag.BoolVar(&eipGCDryRun,
+		"eip-gc-dry-run",
+		false,
+		"Only log the elastic ips the collection would release.",
+	)
+
+	flag.StringVar(&eipGCProjects,
+		"eip-gc-projects",
+		"",
+		"Comma separated list of projects collected in addition to the ones of the existing PacketClusters.",
+	)
+
+	flag.DurationVar(&capacityInterval,
+		"capacity-publish-interval",
+		0,
+		"Interval at which the PacketMachineTemplates are annotated with the capacity left for their machine type. Set to 0, the default, to disable the publication.",
+	)
+
+	flag.DurationVar(&autopsyTTL,
+		"autopsy-ttl",
+		0,
+		"How long the diagnostics of a PacketMachine, saved in a ConfigMap before its device is deleted, are kept. Set to 0, the default, to disable them.",
+	)
+
+	flag.StringVar(&allowedMachineTypes,
+		"allowed-machine-types",
+		"",
+		"Comma separated list of the machine types devices can be created with. Any machine type is allowed when empty.",
+	)
+
+	flag.StringVar(&configMap,
+		"config-map",
+		"",
+		"The namespace/name of a ConfigMap whose keys override the flags of the same name while the manager runs: "+configMapKeys+". Disabled when empty.",
+	)
+
+	flag.DurationVar(&compatibilityInterval,
+		"compatibility-refresh-interval",
+		0,
+		"Interval at which the plans and operating systems offered by Packet are fetched, to reject the PacketMachines they can not fulfill. Required by the webhook server. Set to 0, the default, to disable the check.",
+	)
+
+	flag.Var(&apiHeaders,
+		"api-header",
+		"A header, as Name: value, added to every Packet API request, e.g. for a gateway fronting the API. Can be repeated.",
+	)
+
+	flag.StringVar(&oauthTokenURL,
+		"oauth-token-url",
+		packet.DefaultOAuthTokenURL,
+		"The OAuth token endpoint the clients get their access tokens from when PACKET_OAUTH_CLIENT_ID and PACKET_OAUTH_CLIENT_SECRET, or PACKET_OAUTH_SUBJECT_TOKEN_FILE, are set instead of PACKET_API_KEY.",
+	)
+
+	flag.StringVar(&oauthAudience,
+		"oauth-audience",
+		"",
+		"The audience of the OAuth access tokens, left out of the token requests when empty.",
+	)
+
+	flag.DurationVar(&clientIdleTimeout,
+		"client-idle-timeout",
+		30*time.Minute,
+		"How long the Packet client of a credential is kept in the client pool without being used.",
+	)
+
+	flag.DurationVar(&clientHTTP.Timeout,
+		"client-timeout",
+		packet.DefaultHTTPOptions.Timeout,
+		"How long a Packet API request may take, reading the response included, before it fails. 0 disables the timeout.",
+	)
+
+	flag.DurationVar(&clientHTTP.DialTimeout,
+		"client-dial-timeout",
+		packet.DefaultHTTPOptions.DialTimeout,
+		"How long connecting to the Packet API may take.",
+	)
+
+	flag.DurationVar(&clientHTTP.TLSHandshakeTimeout,
+		"client-tls-handshake-timeout",
+		packet.DefaultHTTPOptions.TLSHandshakeTimeout,
+		"How long the TLS handshake with the Packet API may take.",
+	)
+
+	flag.DurationVar(&clientHTTP.ResponseHeaderTimeout,
+		"client-response-header-timeout",
+		packet.DefaultHTTPOptions.ResponseHeaderTimeout,
+		"How long the Packet API may take to answer a request with the headers of its response. 0 disables the timeout.",
+	)
+
+	flag.DurationVar(&clientHTTP.KeepAlive,
+		"client-keep-alive",
+		packet.DefaultHTTPOptions.KeepAlive,
+		"The interval of the TCP keep-alive probes of the connections to the Packet API.",
+	)
+
+	flag.DurationVar(&clientHTTP.IdleConnTimeout,
+		"client-idle-conn-timeout",
+		packet.DefaultHTTPOptions.IdleConnTimeout,
+		"How long an idle connection to the Packet API is kept open.",
+	)
+
+	flag.IntVar(&clientHTTP.MaxIdleConnsPerHost,
+		"client-max-idle-conns",
+		packet.DefaultHTTPOptions.MaxIdleConnsPerHost,
+		"Number of idle connections to the Packet API kept open for the workers of the controllers.",
+	)
+
+	flag.Float64Var(&rateWarningThreshold,
+		"api-rate-warning-threshold",
+		packet.DefaultRateWarningThreshold,
+		"The share of the Packet API rate limit window left under which a warning is logged (e.g. 0.1). 0 disables the warnings.",
+	)
+
+	flag.DurationVar(&deviceCacheTTL,
+		"device-cache-ttl",
+		packet.DefaultDeviceCacheTTL,
+		"How long an active device read from the Packet API is served from the cache of the client (e.g. 30s). 0 disables the cache.",
+	)
+
+	flag.BoolVar(&deviceCacheWarmUp,
+		"device-cache-warm-up",
+		true,
+		"Cache the active devices of every project, listed once per project, before the controllers start, for the first reconciliations not to read them one by one. A disabled cache disables the warm up.",
+	)
+
+	flag.StringVar(&otlpEndpoint,
+		"otlp-endpoint",
+		"",
+		"The OTLP gRPC endpoint the reconciliation traces are exported to (e.g. otel-collector:4317). Tracing is disabled when empty.",
+	)
+
+	flag.BoolVar(&otlpInsecure,
+		"otlp-insecure",
+		false,
+		"Connect to the OTLP endpoint without TLS.",
+	)
+
+	flag.Float64Var(&traceSampleRatio,
+		"trace-sample-ratio",
+		1,
+		"The ratio of the reconciliations traced, between 0 and 1.",
+	)
+
 	flag.IntVar(&webhookPort,
 		"webhook-port",
 		0,
@@ -110,6 +520,19 @@ func main() {
 		setupLog.Info("Watching cluster-api objects only in namespace for reconciliation", "namespace", watchNamespace)
 	}
 
+	if otlpEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(context.Background(), otlpEndpoint, otlpInsecure, traceSampleRatio)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				setupLog.Error(err, "unable to flush traces")
+			}
+		}()
+	}
+
 	// Machine and cluster operations can create enough events to trigger the event recorder spam filter
 	// Setting the burst size higher ensures all events will be recorded and submitted to the API
 	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
@@ -133,38 +556,344 @@ func main() {
 		os.Exit(1)
 	}
 
-	// get a packet client
-	client, err := packet.GetClient()
+	if metroMigration != "" && metroMigration != controllers.MetroMigrationReport && metroMigration != controllers.MetroMigrationApply {
+		setupLog.Error(fmt.Errorf("%q is neither %s nor %s", metroMigration, controllers.MetroMigrationReport, controllers.MetroMigrationApply), "invalid --metro-migration")
+		os.Exit(1)
+	}
+
+	if bootstrapCallbackURL != "" {
+		if err := controllers.ValidateBootstrapCallbackURL(bootstrapCallbackURL); err != nil {
+			setupLog.Error(err, "invalid --bootstrap-callback-url, the callback tokens must not be sent in clear text")
+			os.Exit(1)
+		}
+	}
+
+	labelSync := packet.LabelSync{LabelPrefix: tagSyncLabelPrefix, TagPrefix: labelSyncTagPrefix}
+	if err := labelSync.Validate(); err != nil {
+		setupLog.Error(err, "invalid --tag-sync-label-prefix and --label-sync-tag-prefix")
+		os.Exit(1)
+	}
+
+	headers, err := packet.ParseHeaders(apiHeaders)
+	if err != nil {
+		setupLog.Error(err, "invalid Packet API headers")
+		os.Exit(1)
+	}
+
+	// get a packet client, shared with every client of the same credential
+	clientPool := packet.NewClientPool(clientIdleTimeout, headers)
+	clientPool.RateWarningThreshold = rateWarningThreshold
+	clientPool.DeviceCacheTTL = deviceCacheTTL
+	clientPool.HTTP = clientHTTP
+	oauth, err := packet.OAuthConfigFromEnv(oauthTokenURL, oauthAudience)
+	if err != nil {
+		setupLog.Error(err, "invalid OAuth configuration")
+		os.Exit(1)
+	}
+	if oauth != nil {
+		setupLog.Info("Packet API clients authenticate with OAuth access tokens", "tokenURL", oauth.TokenURL, "tokenExchange", oauth.SubjectTokenFile != "")
+	}
+	clientPool.OAuth = oauth
+	client, err := clientPool.GetClient()
 	if err != nil {
 		setupLog.Error(err, "unable to get Packet client")
 		os.Exit(1)
 	}
+	if err = mgr.Add(clientPool); err != nil {
+		setupLog.Error(err, "unable to add the Packet client pool")
+		os.Exit(1)
+	}
+
+	var permissions *packet.PermissionChecker
+	if permissionInterval > 0 {
+		permissions = packet.NewPermissionChecker(client, permissionInterval)
+		tokenPermissions, err := permissions.CheckToken()
+		switch {
+		case err != nil:
+			setupLog.Error(err, "unable to probe the permissions of the Packet API key")
+		case oauth != nil:
+			setupLog.Info("Packet API access tokens are not API keys, their permissions are probed per project")
+		case tokenPermissions.Scope == packet.KeyScopeProject:
+			setupLog.Info("Packet API key is a project key, its permissions are probed in the project of each cluster and dedicated projects can not be created")
+		case !tokenPermissions.KeyFound:
+			setupLog.Info("Packet API key not found among the keys of its user, its permissions are probed per project")
+		case tokenPermissions.ReadOnly:
+			setupLog.Error(fmt.Errorf("the Packet API key is read only"), "devices and ip reservations can not be created")
+		default:
+			setupLog.Info("Packet API key can create devices and ip reservations")
+		}
+		if tokenPermissions.Scope == packet.KeyScopeUser && oauth == nil {
+			setupLog.Info("Packet API key is a user key with access to every project of its user, a project key is enough unless the clusters use dedicated projects")
+		}
+	}
+
+	var projectDrift *packet.ProjectDriftChecker
+	if projectDriftInterval > 0 {
+		projectDrift = packet.NewProjectDriftChecker(client, projectDriftInterval)
+	}
+	var anomalies *packet.AnomalyAnalyzer
+	if anomalyInterval > 0 {
+		anomalies = packet.NewAnomalyAnalyzer(client, anomalyInterval, idleReservationAge)
+	}
+
+	var createBreaker *packet.CreateBreaker
+	if createFailureThreshold > 0 {
+		createBreaker = packet.NewCreateBreaker(createFailureThreshold, createFailureWindow, createFailureCooldown)
+	}
+	var reservationClaims *packet.ReservationClaims
+	if reservationClaimTTL > 0 {
+		reservationClaims = packet.NewReservationClaims(reservationClaimTTL)
+	}
+	var userDataHistory *packet.UserDataHistory
+	if userDataDiffs {
+		userDataHistory = packet.NewUserDataHistory()
+	}
+
+	config := packet.NewConfigStore(packet.Config{
+		BootstrapTokenTTL:          bootstrapTokenTTL,
+		BootstrapCallbackTimeout:   bootstrapCallbackTTL,
+		AutopsyTTL:                 autopsyTTL,
+		ClusterDeletionConcurrency: deletionConcurrency,
+		ElasticIPGCInterval:        eipGCInterval,
+		ElasticIPGCMinAge:          eipGCMinAge,
+		ElasticIPGCDryRun:          eipGCDryRun,
+		AllowedMachineTypes:        splitList(allowedMachineTypes),
+	})
+	var configMapName types.NamespacedName
+	if configMap != "" {
+		parts := strings.Split(configMap, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			setupLog.Error(fmt.Errorf("%q is not a namespace/name", configMap), "invalid --config-map")
+			os.Exit(1)
+		}
+		configMapName = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+
+	var compatibility *controllers.CompatibilityCache
+	if compatibilityInterval > 0 {
+		compatibility = &controllers.CompatibilityCache{
+			Log:          ctrl.Log.WithName("controllers").WithName("CompatibilityCache"),
+			PacketClient: client,
+			Reader:       mgr.GetAPIReader(),
+			Interval:     compatibilityInterval,
+		}
+		if err = mgr.Add(compatibility); err != nil {
+			setupLog.Error(err, "unable to add compatibility matrix refresh")
+			os.Exit(1)
+		}
+	}
 
 	if webhookPort == 0 {
+		if configMap != "" {
+			if err = (&controllers.ControllerConfigReconciler{
+				Log:       ctrl.Log.WithName("controllers").WithName("ControllerConfig"),
+				Recorder:  mgr.GetEventRecorderFor("controllerconfig-controller"),
+				Config:    config,
+				ConfigMap: configMapName,
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "ControllerConfig")
+				os.Exit(1)
+			}
+		}
 		if err = (&controllers.PacketClusterReconciler{
 			Client:       mgr.GetClient(),
+			APIReader:    mgr.GetAPIReader(),
 			Log:          ctrl.Log.WithName("controllers").WithName("PacketCluster"),
 			Recorder:     mgr.GetEventRecorderFor("packetcluster-controller"),
 			PacketClient: client,
 			Scheme:       mgr.GetScheme(),
-		}).SetupWithManager(mgr); err != nil {
+			Config:       config,
+			Permissions:  permissions,
+			ProjectDrift: projectDrift,
+			Anomalies:    anomalies,
+
+			CreateBreaker:       createBreaker,
+			ProjectOrganization: projectOrganization,
+			Compatibility:       compatibility,
+			InventoryExport:     inventoryExport,
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: clusterConcurrency}); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "PacketCluster")
 			os.Exit(1)
 		}
+		var warmPool *controllers.WarmPool
+		if warmPoolInterval > 0 {
+			warmPool = &controllers.WarmPool{
+				Client:       mgr.GetClient(),
+				Log:          ctrl.Log.WithName("controllers").WithName("WarmPool"),
+				Recorder:     mgr.GetEventRecorderFor("warm-pool"),
+				PacketClient: client,
+				Interval:     warmPoolInterval,
+			}
+			if err = mgr.Add(warmPool); err != nil {
+				setupLog.Error(err, "unable to add warm pool refill")
+				os.Exit(1)
+			}
+		}
 		if err = (&controllers.PacketMachineReconciler{
 			Client:       mgr.GetClient(),
+			APIReader:    mgr.GetAPIReader(),
 			Log:          ctrl.Log.WithName("controllers").WithName("PacketMachine"),
 			Scheme:       mgr.GetScheme(),
 			Recorder:     mgr.GetEventRecorderFor("packetmachine-controller"),
 			PacketClient: client,
-		}).SetupWithManager(mgr); err != nil {
+			Config:       config,
+
+			BootstrapCallbackURL:  bootstrapCallbackURL,
+			IPXEServerURL:         ipxeServerURL,
+			Compatibility:         compatibility,
+			LabelSync:             labelSync,
+			NodeLabels:            nodeLabels,
+			WarmPool:              warmPool,
+			CreateBreaker:         createBreaker,
+			ReservationClaims:     reservationClaims,
+			UserDataHistory:       userDataHistory,
+			ProvisioningSLO:       provisioningSLO,
+			NodeReadinessCheck:    nodeReadinessCheck,
+			StrictDeviceOwnership: strictDeviceOwnership,
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: machineConcurrency}); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "PacketMachine")
 			os.Exit(1)
 		}
+		if err = (&controllers.ScaleInHintReconciler{
+			Client:   mgr.GetClient(),
+			Log:      ctrl.Log.WithName("controllers").WithName("ScaleInHint"),
+			Recorder: mgr.GetEventRecorderFor("scaleinhint-controller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ScaleInHint")
+			os.Exit(1)
+		}
+		if pluralConsoleURL != "" {
+			token := os.Getenv(plural.TokenVarName)
+			if token == "" {
+				setupLog.Error(fmt.Errorf("%s is not set", plural.TokenVarName), "unable to register clusters with the Plural console")
+				os.Exit(1)
+			}
+			if err = (&controllers.PluralRegistrationReconciler{
+				Client:   mgr.GetClient(),
+				Log:      ctrl.Log.WithName("controllers").WithName("PluralRegistration"),
+				Recorder: mgr.GetEventRecorderFor("pluralregistration-controller"),
+				Console:  plural.NewClient(pluralConsoleURL, token),
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "PluralRegistration")
+				os.Exit(1)
+			}
+		}
+		if err = (&controllers.PlanMigrationReconciler{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("controllers").WithName("PlanMigration"),
+			Recorder:      mgr.GetEventRecorderFor("planmigration-controller"),
+			Compatibility: compatibility,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PlanMigration")
+			os.Exit(1)
+		}
+		if bootstrapCallbackAddr != "" {
+			if err = mgr.Add(&controllers.BootstrapCallbackServer{
+				Client:  mgr.GetClient(),
+				Log:     ctrl.Log.WithName("controllers").WithName("BootstrapCallback"),
+				Addr:    bootstrapCallbackAddr,
+				CertDir: bootstrapCallbackCerts,
+			}); err != nil {
+				setupLog.Error(err, "unable to add bootstrap callback server")
+				os.Exit(1)
+			}
+		}
+		if ipxeServerAddr != "" {
+			if err = mgr.Add(&controllers.IPXEServer{
+				Client: mgr.GetClient(),
+				Log:    ctrl.Log.WithName("controllers").WithName("IPXEServer"),
+				Addr:   ipxeServerAddr,
+			}); err != nil {
+				setupLog.Error(err, "unable to add iPXE server")
+				os.Exit(1)
+			}
+		}
+		// the ConfigMap can enable the collections the flags disabled
+		if eipGCInterval > 0 || configMap != "" {
+			if err = mgr.Add(&controllers.ElasticIPCollector{
+				Client:       mgr.GetClient(),
+				Log:          ctrl.Log.WithName("controllers").WithName("ElasticIPCollector"),
+				PacketClient: client,
+				Config:       config,
+				Projects:     splitList(eipGCProjects),
+			}); err != nil {
+				setupLog.Error(err, "unable to add elastic ip collection")
+				os.Exit(1)
+			}
+		}
+		if capacityInterval > 0 {
+			if err = mgr.Add(&controllers.CapacityPublisher{
+				Client:       mgr.GetClient(),
+				Log:          ctrl.Log.WithName("controllers").WithName("CapacityPublisher"),
+				PacketClient: client,
+				Interval:     capacityInterval,
+			}); err != nil {
+				setupLog.Error(err, "unable to add capacity publication")
+				os.Exit(1)
+			}
+		}
+		if autopsyTTL > 0 || configMap != "" {
+			if err = mgr.Add(&controllers.AutopsyCollector{
+				Client:   mgr.GetClient(),
+				Log:      ctrl.Log.WithName("controllers").WithName("AutopsyCollector"),
+				Reader:   mgr.GetAPIReader(),
+				Interval: 10 * time.Minute,
+			}); err != nil {
+				setupLog.Error(err, "unable to add autopsy collection")
+				os.Exit(1)
+			}
+		}
+		// the controllers start once the cache is warm
+		if deviceCacheWarmUp && deviceCacheTTL > 0 {
+			warmUp := &controllers.DeviceCacheWarmUp{
+				Reader:       mgr.GetAPIReader(),
+				Log:          ctrl.Log.WithName("controllers").WithName("DeviceCacheWarmUp"),
+				PacketClient: client,
+				Namespace:    watchNamespace,
+			}
+			// a warm up longer than the ttl would expire the devices it cached first
+			warmUpCtx, cancel := context.WithTimeout(context.Background(), deviceCacheTTL)
+			warmUp.WarmUp(warmUpCtx)
+			cancel()
+		}
+		if migrateLegacyTags {
+			if err = mgr.Add(&controllers.TagMigrator{
+				Client:       mgr.GetClient(),
+				Log:          ctrl.Log.WithName("controllers").WithName("TagMigrator"),
+				PacketClient: client,
+			}); err != nil {
+				setupLog.Error(err, "unable to add tag migration")
+				os.Exit(1)
+			}
+		}
+		if metroMigration != "" {
+			if err = mgr.Add(&controllers.MetroMigrator{
+				Client:       mgr.GetClient(),
+				Log:          ctrl.Log.WithName("controllers").WithName("MetroMigrator"),
+				Recorder:     mgr.GetEventRecorderFor("metro-migration"),
+				PacketClient: client,
+				Apply:        metroMigration == controllers.MetroMigrationApply,
+			}); err != nil {
+				setupLog.Error(err, "unable to add metro migration")
+				os.Exit(1)
+			}
+		}
 	} else {
-		// TODO: add the webhook configuration
-		setupLog.Error(errors.New("webhook not implemented"), "webhook", "not available")
-		os.Exit(1)
+		if compatibility == nil {
+			setupLog.Error(errors.New("--compatibility-refresh-interval is not set"), "webhook", "not available")
+			os.Exit(1)
+		}
+		validator := &controllers.PacketMachineValidator{Compatibility: compatibility}
+		mgr.GetWebhookServer().Register(controllers.PacketMachineValidationPath, &webhook.Admission{Handler: validator})
+		mgr.GetWebhookServer().Register(controllers.PacketMachineTemplateValidationPath, &webhook.Admission{Handler: validator})
+		mgr.GetWebhookServer().Register(controllers.MachineDeploymentValidationPath, &webhook.Admission{Handler: &controllers.MachineDeploymentBudgetValidator{
+			Client:        mgr.GetClient(),
+			Compatibility: compatibility,
+		}})
+		mgr.GetWebhookServer().Register(controllers.PacketClusterValidationPath, &webhook.Admission{Handler: &controllers.PacketClusterValidator{}})
+		deleteProtection := &controllers.DeleteProtectionValidator{Client: mgr.GetClient()}
+		mgr.GetWebhookServer().Register(controllers.PacketClusterDeletionValidationPath, &webhook.Admission{Handler: deleteProtection})
+		mgr.GetWebhookServer().Register(controllers.ClusterDeletionValidationPath, &webhook.Admission{Handler: deleteProtection})
 	}
 	// +kubebuilder:scaffold:builder
 
@@ -173,6 +902,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// A bad token or an unreachable API only marks the manager NotReady, restarting it would not help.
+	if err := mgr.AddReadyzCheck("packet-api", packet.NewAPIChecker(client, apiCheckInterval).Check); err != nil {
+		setupLog.Error(err, "unable to create ready check")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to create health check")
 		os.Exit(1)
@@ -184,3 +919,38 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// configMapKeys are the keys of the ConfigMap set with --config-map.
+var configMapKeys = strings.Join([]string{
+	packet.ConfigBootstrapTokenTTL,
+	packet.ConfigBootstrapCallbackTimeout,
+	packet.ConfigAutopsyTTL,
+	packet.ConfigClusterDeletionConcurrency,
+	packet.ConfigElasticIPGCInterval,
+	packet.ConfigElasticIPGCMinAge,
+	packet.ConfigElasticIPGCDryRun,
+	packet.ConfigAllowedMachineTypes,
+}, ", ")
+
+// stringsFlag is a flag that can be repeated, each value is appended.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// splitList splits a comma separated flag value, ignoring empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
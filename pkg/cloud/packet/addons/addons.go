@@ -0,0 +1,542 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package addons renders the Equinix Metal cloud integration of workload
+// clusters, the cloud controller manager and the CSI driver, and hands it
+// over to Cluster API through a ClusterResourceSet. Their credentials are
+// written to the workload clusters directly, as a ClusterResourceSet applies
+// its resources once.
+package addons
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// DefaultCCMVersion is the version of cloud-provider-equinix-metal
+	// installed when the cluster does not pick one.
+	DefaultCCMVersion = "v3.2.2"
+	// DefaultCSIVersion is the version of csi-packet installed when the
+	// cluster does not pick one.
+	DefaultCSIVersion = "v1.1.0"
+
+	// manifestsKey is the key of the Secrets holding the manifests.
+	manifestsKey = "manifests.yaml"
+
+	// ccmSecretName and csiSecretName are the Secrets of the workload
+	// clusters holding the configuration of the cloud controller manager and
+	// of the CSI driver.
+	ccmSecretName = "metal-cloud-config"
+	csiSecretName = "packet-cloud-config"
+	// cloudConfigKey is the key of their configuration file.
+	cloudConfigKey = "cloud-sa.json"
+)
+
+// Config is what the cloud integration manifests are rendered with.
+type Config struct {
+	APIKey    string
+	ProjectID string
+	Metro     string
+	Facility  string
+	// EIPTag is the tag of the control plane ElasticIP, which the cloud
+	// controller manager keeps assigned to a healthy control plane node.
+	EIPTag string
+
+	CCMVersion string
+	CSIVersion string
+}
+
+// cloudConfig is the cloud-sa.json configuration file of the cloud
+// controller manager and of the CSI driver.
+type cloudConfig struct {
+	APIKey    string `json:"apiKey"`
+	ProjectID string `json:"projectID"`
+	Metro     string `json:"metro,omitempty"`
+	Facility  string `json:"facility,omitempty"`
+	EIPTag    string `json:"eipTag,omitempty"`
+}
+
+// CCMManifests returns the manifests of the cloud controller manager,
+// without its configuration Secret.
+func CCMManifests(cfg Config) (string, error) {
+	if cfg.CCMVersion == "" {
+		cfg.CCMVersion = DefaultCCMVersion
+	}
+	return render(ccmTemplate, cfg)
+}
+
+// CSIManifests returns the manifests of the CSI driver, without its
+// configuration Secret. Block storage is facility scoped, so the cluster
+// needs a facility.
+func CSIManifests(cfg Config) (string, error) {
+	if cfg.Facility == "" {
+		return "", fmt.Errorf("the CSI driver requires the cluster facility to be set")
+	}
+	if cfg.CSIVersion == "" {
+		cfg.CSIVersion = DefaultCSIVersion
+	}
+	return render(csiTemplate, cfg)
+}
+
+func render(text string, cfg Config) (string, error) {
+	tmpl, err := template.New("addon").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, map[string]string{
+		"CCMVersion": cfg.CCMVersion,
+		"CSIVersion": cfg.CSIVersion,
+	}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// CloudConfigSecrets returns the kube-system Secrets holding the
+// configuration of the cloud controller manager and, with csi, of the CSI
+// driver.
+func CloudConfigSecrets(cfg Config, csi bool) ([]corev1.Secret, error) {
+	raw, err := json.Marshal(cloudConfig{
+		APIKey:    cfg.APIKey,
+		ProjectID: cfg.ProjectID,
+		Metro:     cfg.Metro,
+		Facility:  cfg.Facility,
+		EIPTag:    cfg.EIPTag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{ccmSecretName}
+	if csi {
+		names = append(names, csiSecretName)
+	}
+	secrets := make([]corev1.Secret, 0, len(names))
+	for _, name := range names {
+		secrets = append(secrets, corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceSystem, Name: name},
+			Data:       map[string][]byte{cloudConfigKey: raw},
+		})
+	}
+	return secrets, nil
+}
+
+// EnsureSecrets creates the secrets in the workload cluster c, or updates
+// their data.
+func EnsureSecrets(ctx context.Context, c client.Client, secrets []corev1.Secret) error {
+	for i := range secrets {
+		desired := &secrets[i]
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: desired.Namespace, Name: desired.Name},
+		}
+		if _, err := controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+			secret.Data = desired.Data
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to create or update Secret %s/%s: %w", desired.Namespace, desired.Name, err)
+		}
+	}
+	return nil
+}
+
+// Resource is a Secret of manifests applied by a ClusterResourceSet.
+type Resource struct {
+	Name      string
+	Manifests string
+}
+
+// EnsureResourceSet creates or updates the Secrets of the resources and the
+// ClusterResourceSet applying them to the Clusters matching selector. All of
+// them are owned by owner and carry labels, so that clusterctl moves them
+// with the cluster.
+func EnsureResourceSet(ctx context.Context, c client.Client, namespace, name string, owner metav1.OwnerReference, labels, selector map[string]string, resources []Resource) error {
+	refs := make([]addonsv1.ResourceRef, 0, len(resources))
+	for _, resource := range resources {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: resource.Name},
+		}
+		if _, err := controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+			secret.OwnerReferences = []metav1.OwnerReference{owner}
+			secret.Labels = mergeLabels(secret.Labels, labels)
+			secret.Type = addonsv1.ClusterResourceSetSecretType
+			secret.Data = map[string][]byte{manifestsKey: []byte(resource.Manifests)}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to create or update Secret %s/%s: %w", namespace, resource.Name, err)
+		}
+		refs = append(refs, addonsv1.ResourceRef{
+			Name: resource.Name,
+			Kind: string(addonsv1.SecretClusterResourceSetResourceKind),
+		})
+	}
+
+	resourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, c, resourceSet, func() error {
+		resourceSet.OwnerReferences = []metav1.OwnerReference{owner}
+		resourceSet.Labels = mergeLabels(resourceSet.Labels, labels)
+		// the selector and the strategy are immutable
+		if resourceSet.CreationTimestamp.IsZero() {
+			resourceSet.Spec.ClusterSelector = metav1.LabelSelector{MatchLabels: selector}
+			resourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyApplyOnce)
+		}
+		resourceSet.Spec.Resources = refs
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to create or update ClusterResourceSet %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// mergeLabels returns existing with labels set, keeping the labels added by
+// others.
+func mergeLabels(existing, labels map[string]string) map[string]string {
+	if existing == nil && len(labels) > 0 {
+		existing = make(map[string]string, len(labels))
+	}
+	for key, value := range labels {
+		existing[key] = value
+	}
+	return existing
+}
+
+const ccmTemplate = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cloud-controller-manager
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:cloud-controller-manager
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: cloud-controller-manager
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cloud-provider-equinix-metal
+  namespace: kube-system
+  labels:
+    app: cloud-provider-equinix-metal
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: cloud-provider-equinix-metal
+  template:
+    metadata:
+      labels:
+        app: cloud-provider-equinix-metal
+    spec:
+      dnsPolicy: Default
+      hostNetwork: true
+      serviceAccountName: cloud-controller-manager
+      tolerations:
+      - key: CriticalAddonsOnly
+        operator: Exists
+      - key: node.cloudprovider.kubernetes.io/uninitialized
+        value: "true"
+        effect: NoSchedule
+      - key: node-role.kubernetes.io/master
+        effect: NoSchedule
+      - key: node-role.kubernetes.io/control-plane
+        effect: NoSchedule
+      containers:
+      - name: cloud-provider-equinix-metal
+        image: docker.io/equinix/cloud-provider-equinix-metal:{{ .CCMVersion }}
+        command:
+        - ./cloud-provider-equinix-metal
+        - --cloud-provider=equinixmetal
+        - --leader-elect=false
+        - --authentication-skip-lookup=true
+        - --provider-config=/etc/cloud-sa/cloud-sa.json
+        resources:
+          requests:
+            cpu: 100m
+            memory: 50Mi
+        volumeMounts:
+        - name: cloud-sa-volume
+          readOnly: true
+          mountPath: /etc/cloud-sa
+      volumes:
+      - name: cloud-sa-volume
+        secret:
+          secretName: metal-cloud-config
+`
+
+const csiTemplate = `apiVersion: storage.k8s.io/v1
+kind: CSIDriver
+metadata:
+  name: net.packet.csi
+spec:
+  attachRequired: true
+  podInfoOnMount: false
+---
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: csi-packet-standard
+  annotations:
+    storageclass.kubernetes.io/is-default-class: "true"
+provisioner: net.packet.csi
+parameters:
+  plan: standard
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: csi-controller-sa
+  namespace: kube-system
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: csi-node-sa
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: csi-packet-controller
+rules:
+- apiGroups: [""]
+  resources: ["persistentvolumes"]
+  verbs: ["get", "list", "watch", "create", "delete", "update", "patch"]
+- apiGroups: [""]
+  resources: ["persistentvolumeclaims"]
+  verbs: ["get", "list", "watch", "update"]
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["list", "watch", "create", "update", "patch"]
+- apiGroups: ["storage.k8s.io"]
+  resources: ["storageclasses", "csinodes"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["storage.k8s.io"]
+  resources: ["volumeattachments"]
+  verbs: ["get", "list", "watch", "update", "patch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: csi-packet-controller
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: csi-packet-controller
+subjects:
+- kind: ServiceAccount
+  name: csi-controller-sa
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: csi-packet-node
+rules:
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["get"]
+- apiGroups: ["storage.k8s.io"]
+  resources: ["volumeattachments"]
+  verbs: ["get", "list", "watch", "update"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["list", "watch", "create", "update", "patch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: csi-packet-node
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: csi-packet-node
+subjects:
+- kind: ServiceAccount
+  name: csi-node-sa
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: csi-packet-controller
+  namespace: kube-system
+spec:
+  serviceName: csi-packet-controller
+  replicas: 1
+  selector:
+    matchLabels:
+      app: csi-packet-controller
+  template:
+    metadata:
+      labels:
+        app: csi-packet-controller
+    spec:
+      serviceAccountName: csi-controller-sa
+      tolerations:
+      - key: node-role.kubernetes.io/master
+        effect: NoSchedule
+      - key: node-role.kubernetes.io/control-plane
+        effect: NoSchedule
+      containers:
+      - name: csi-provisioner
+        image: quay.io/k8scsi/csi-provisioner:v1.6.0
+        args:
+        - --csi-address=/csi/csi.sock
+        volumeMounts:
+        - name: socket-dir
+          mountPath: /csi
+      - name: csi-attacher
+        image: quay.io/k8scsi/csi-attacher:v2.2.0
+        args:
+        - --csi-address=/csi/csi.sock
+        volumeMounts:
+        - name: socket-dir
+          mountPath: /csi
+      - name: packet-driver
+        image: docker.io/packethost/csi-packet:{{ .CSIVersion }}
+        args:
+        - --endpoint=unix:///csi/csi.sock
+        - --nodeid=$(KUBE_NODE_NAME)
+        - --config=/etc/cloud-sa/cloud-sa.json
+        env:
+        - name: KUBE_NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        volumeMounts:
+        - name: socket-dir
+          mountPath: /csi
+        - name: cloud-sa-volume
+          readOnly: true
+          mountPath: /etc/cloud-sa
+      volumes:
+      - name: socket-dir
+        emptyDir: {}
+      - name: cloud-sa-volume
+        secret:
+          secretName: packet-cloud-config
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: csi-packet-node
+  namespace: kube-system
+spec:
+  selector:
+    matchLabels:
+      app: csi-packet-node
+  template:
+    metadata:
+      labels:
+        app: csi-packet-node
+    spec:
+      serviceAccountName: csi-node-sa
+      hostNetwork: true
+      tolerations:
+      - operator: Exists
+      containers:
+      - name: csi-node-driver-registrar
+        image: quay.io/k8scsi/csi-node-driver-registrar:v1.3.0
+        args:
+        - --csi-address=/csi/csi.sock
+        - --kubelet-registration-path=/var/lib/kubelet/plugins/net.packet.csi/csi.sock
+        volumeMounts:
+        - name: plugin-dir
+          mountPath: /csi
+        - name: registration-dir
+          mountPath: /registration
+      - name: packet-driver
+        image: docker.io/packethost/csi-packet:{{ .CSIVersion }}
+        args:
+        - --endpoint=unix:///csi/csi.sock
+        - --nodeid=$(KUBE_NODE_NAME)
+        - --config=/etc/cloud-sa/cloud-sa.json
+        env:
+        - name: KUBE_NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        securityContext:
+          privileged: true
+          capabilities:
+            add: ["SYS_ADMIN"]
+          allowPrivilegeEscalation: true
+        volumeMounts:
+        - name: plugin-dir
+          mountPath: /csi
+        - name: kubelet-dir
+          mountPath: /var/lib/kubelet
+          mountPropagation: Bidirectional
+        - name: device-dir
+          mountPath: /dev
+        - name: iscsi-dir
+          mountPath: /etc/iscsi
+        - name: modules-dir
+          mountPath: /lib/modules
+          readOnly: true
+        - name: cloud-sa-volume
+          readOnly: true
+          mountPath: /etc/cloud-sa
+      volumes:
+      - name: plugin-dir
+        hostPath:
+          path: /var/lib/kubelet/plugins/net.packet.csi
+          type: DirectoryOrCreate
+      - name: registration-dir
+        hostPath:
+          path: /var/lib/kubelet/plugins_registry
+          type: Directory
+      - name: kubelet-dir
+        hostPath:
+          path: /var/lib/kubelet
+          type: Directory
+      - name: device-dir
+        hostPath:
+          path: /dev
+      - name: iscsi-dir
+        hostPath:
+          path: /etc/iscsi
+          type: DirectoryOrCreate
+      - name: modules-dir
+        hostPath:
+          path: /lib/modules
+      - name: cloud-sa-volume
+        secret:
+          secretName: packet-cloud-config
+`
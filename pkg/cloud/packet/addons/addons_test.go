@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addons
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" //nolint:staticcheck
+	"sigs.k8s.io/yaml"
+)
+
+func TestCCMManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	manifests, err := CCMManifests(Config{APIKey: "ccm-api-key", ProjectID: "project", Metro: "ny"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(manifests).To(ContainSubstring("cloud-provider-equinix-metal:" + DefaultCCMVersion))
+	// the credentials are not applied by the ClusterResourceSet
+	g.Expect(manifests).NotTo(ContainSubstring("ccm-api-key"))
+
+	for _, document := range strings.Split(manifests, "\n---\n") {
+		object := map[string]interface{}{}
+		g.Expect(yaml.Unmarshal([]byte(document), &object)).To(Succeed())
+		g.Expect(object["kind"]).NotTo(Equal("Secret"))
+	}
+}
+
+func TestCloudConfigSecrets(t *testing.T) {
+	g := NewWithT(t)
+
+	secrets, err := CloudConfigSecrets(Config{
+		APIKey:    "secret\"key",
+		ProjectID: "project",
+		Metro:     "ny",
+		EIPTag:    "cluster-api-provider-packet:cluster-id:default/capi",
+	}, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(secrets).To(HaveLen(1))
+	g.Expect(secrets[0].Namespace).To(Equal("kube-system"))
+	g.Expect(secrets[0].Name).To(Equal("metal-cloud-config"))
+
+	cfg := cloudConfig{}
+	g.Expect(json.Unmarshal(secrets[0].Data["cloud-sa.json"], &cfg)).To(Succeed())
+	g.Expect(cfg).To(Equal(cloudConfig{
+		APIKey:    "secret\"key",
+		ProjectID: "project",
+		Metro:     "ny",
+		EIPTag:    "cluster-api-provider-packet:cluster-id:default/capi",
+	}))
+
+	secrets, err = CloudConfigSecrets(Config{APIKey: "key", ProjectID: "project", Facility: "ewr1"}, true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(secrets).To(HaveLen(2))
+	g.Expect(secrets[1].Name).To(Equal("packet-cloud-config"))
+}
+
+func TestEnsureSecrets(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "metal-cloud-config"},
+		Data:       map[string][]byte{"cloud-sa.json": []byte("old")},
+	}
+	c := fake.NewFakeClientWithScheme(clientgoscheme.Scheme, existing)
+
+	// a rotated key replaces the previous one
+	secrets, err := CloudConfigSecrets(Config{APIKey: "new", ProjectID: "project", Facility: "ewr1"}, true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(EnsureSecrets(ctx, c, secrets)).To(Succeed())
+
+	for _, name := range []string{"metal-cloud-config", "packet-cloud-config"} {
+		secret := &corev1.Secret{}
+		g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "kube-system", Name: name}, secret)).To(Succeed())
+		g.Expect(string(secret.Data["cloud-sa.json"])).To(ContainSubstring(`"apiKey":"new"`))
+	}
+}
+
+func TestCSIManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := CSIManifests(Config{ProjectID: "project", Metro: "ny"})
+	g.Expect(err).To(HaveOccurred())
+
+	manifests, err := CSIManifests(Config{ProjectID: "project", Facility: "ewr1", CSIVersion: "v1.0.0"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(manifests).To(ContainSubstring("csi-packet:v1.0.0"))
+	for _, document := range strings.Split(manifests, "\n---\n") {
+		g.Expect(yaml.Unmarshal([]byte(document), &map[string]interface{}{})).To(Succeed())
+	}
+}
+
+func TestEnsureResourceSet(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	// labels added by others are kept
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "capi-ccm", Labels: map[string]string{"team": "infra"}},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, existing)
+
+	owner := metav1.OwnerReference{APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha3", Kind: "PacketCluster", Name: "capi", UID: "uid"}
+	labels := map[string]string{"cluster.x-k8s.io/cluster-name": "capi"}
+	selector := map[string]string{"integration": "capi"}
+	resources := []Resource{{Name: "capi-ccm", Manifests: "ccm"}, {Name: "capi-csi", Manifests: "csi"}}
+	g.Expect(EnsureResourceSet(ctx, c, "default", "capi", owner, labels, selector, resources)).To(Succeed())
+
+	for _, name := range []string{"capi-ccm", "capi-csi"} {
+		secret := &corev1.Secret{}
+		g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, secret)).To(Succeed())
+		g.Expect(secret.OwnerReferences).To(ConsistOf(owner))
+		g.Expect(secret.Labels).To(HaveKeyWithValue("cluster.x-k8s.io/cluster-name", "capi"))
+		g.Expect(secret.Type).To(Equal(addonsv1.ClusterResourceSetSecretType))
+	}
+	secret := &corev1.Secret{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "capi-ccm"}, secret)).To(Succeed())
+	g.Expect(secret.Labels).To(HaveKeyWithValue("team", "infra"))
+
+	resourceSet := &addonsv1.ClusterResourceSet{}
+	g.Expect(c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "capi"}, resourceSet)).To(Succeed())
+	g.Expect(resourceSet.OwnerReferences).To(ConsistOf(owner))
+	g.Expect(resourceSet.Labels).To(Equal(labels))
+	g.Expect(resourceSet.Spec.ClusterSelector.MatchLabels).To(Equal(selector))
+	g.Expect(resourceSet.Spec.Resources).To(HaveLen(2))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// advertiseAddressProgram is the awk program of AdvertiseAddressCommand. It
+// ranks the IPv4 addresses of the interfaces of the device as
+// SortAdvertiseAddresses does, the private ones being the RFC 1918 ones, and
+// prints the first one. It holds neither ": " nor " #" for the command to fit
+// in a plain YAML scalar.
+const advertiseAddressProgram = `function n(a, p) { split(a, p, "."); return ((p[1] * 256 + p[2]) * 256 + p[3]) * 256 + p[4] } ` +
+	`function incidr(ip, c, x, s) { split(c, x, "/"); s = 2 ^ (32 - x[2]); return int(n(ip) / s) == int(n(x[1]) / s) } ` +
+	`function priv(ip) { return incidr(ip, "10.0.0.0/8") || incidr(ip, "172.16.0.0/12") || incidr(ip, "192.168.0.0/16") } ` +
+	`$2 != "lo" { split($4, a, "/"); k = split(cidrs, c, " "); r = k + (priv(a[1]) != (prefer == "Private")); ` +
+	`for (i = 1; i <= k; i++) if (incidr(a[1], c[i])) { r = i - 1; break } ` +
+	`if (best == "" || r < rank) { best = a[1]; rank = r } } END { print best }`
+
+// ValidateAdvertiseAddressPolicy returns an ErrInvalidRequest when a CIDR of
+// policy is not an IPv4 range.
+func ValidateAdvertiseAddressPolicy(policy *infrastructurev1alpha3.AdvertiseAddressPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	for _, cidr := range policy.CIDRs {
+		ip, _, err := net.ParseCIDR(cidr)
+		if err != nil || ip.To4() == nil {
+			return fmt.Errorf("advertise address cidr %q is not an IPv4 range: %w", cidr, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// advertiseAddressRank ranks an address for policy, the lower the better:
+// the index of the first of the CIDRs holding it, or, when none does, the
+// addresses of the preferred kind before the others.
+func advertiseAddressRank(address infrastructurev1alpha3.DeviceAddress, policy *infrastructurev1alpha3.AdvertiseAddressPolicy, cidrs []*net.IPNet) int {
+	ip := net.ParseIP(address.Address)
+	for i, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return i
+		}
+	}
+	preferPublic := policy.Preference == infrastructurev1alpha3.AddressPreferencePublic
+	if address.Public == preferPublic {
+		return len(cidrs)
+	}
+	return len(cidrs) + 1
+}
+
+// SortAdvertiseAddresses returns the native IPv4 addresses of a device the
+// API server can advertise, the one policy selects first. The addresses of
+// the same rank keep their order.
+func SortAdvertiseAddresses(addresses []infrastructurev1alpha3.DeviceAddress, policy *infrastructurev1alpha3.AdvertiseAddressPolicy) []string {
+	if policy == nil {
+		policy = &infrastructurev1alpha3.AdvertiseAddressPolicy{}
+	}
+	cidrs := []*net.IPNet{}
+	for _, cidr := range policy.CIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			cidrs = append(cidrs, network)
+		}
+	}
+
+	candidates := []infrastructurev1alpha3.DeviceAddress{}
+	for _, address := range addresses {
+		if ip := net.ParseIP(address.Address); address.Management && ip != nil && ip.To4() != nil {
+			candidates = append(candidates, address)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return advertiseAddressRank(candidates[i], policy, cidrs) < advertiseAddressRank(candidates[j], policy, cidrs)
+	})
+
+	sorted := make([]string, 0, len(candidates))
+	for _, address := range candidates {
+		sorted = append(sorted, address.Address)
+	}
+	return sorted
+}
+
+// AdvertiseAddressCommand returns the shell command printing the address
+// policy selects among the addresses of the device it runs on, for the
+// userdata to set the advertise address of the API server, and the node ip
+// of the kubelet, with it.
+func AdvertiseAddressCommand(policy *infrastructurev1alpha3.AdvertiseAddressPolicy) (string, error) {
+	if err := ValidateAdvertiseAddressPolicy(policy); err != nil {
+		return "", err
+	}
+	preference := infrastructurev1alpha3.AddressPreferencePrivate
+	if policy.Preference != "" {
+		preference = policy.Preference
+	}
+	return fmt.Sprintf("ip -o -4 addr show scope global | awk -v cidrs='%s' -v prefer=%s '%s'",
+		strings.Join(policy.CIDRs, " "), preference, advertiseAddressProgram), nil
+}
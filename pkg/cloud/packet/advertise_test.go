@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestSortAdvertiseAddresses(t *testing.T) {
+	addresses := []infrastructurev1alpha3.DeviceAddress{
+		{Address: "147.75.10.2", AddressFamily: 4, Public: true, Management: true},
+		{Address: "2604:1380:0:1::3", AddressFamily: 6, Public: true, Management: true},
+		{Address: "10.99.0.3", AddressFamily: 4, Management: true},
+		{Address: "147.75.100.1", AddressFamily: 4, Public: true},
+		{Address: "192.168.10.5", AddressFamily: 4, Management: true},
+	}
+	tests := []struct {
+		name   string
+		policy *infrastructurev1alpha3.AdvertiseAddressPolicy
+		want   []string
+	}{
+		{
+			name: "private by default",
+			want: []string{"10.99.0.3", "192.168.10.5", "147.75.10.2"},
+		},
+		{
+			name:   "public",
+			policy: &infrastructurev1alpha3.AdvertiseAddressPolicy{Preference: infrastructurev1alpha3.AddressPreferencePublic},
+			want:   []string{"147.75.10.2", "10.99.0.3", "192.168.10.5"},
+		},
+		{
+			name:   "cidrs first, in order",
+			policy: &infrastructurev1alpha3.AdvertiseAddressPolicy{CIDRs: []string{"192.168.0.0/16", "147.75.0.0/16"}},
+			want:   []string{"192.168.10.5", "147.75.10.2", "10.99.0.3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(SortAdvertiseAddresses(addresses, tt.policy)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestAdvertiseAddressCommand(t *testing.T) {
+	g := NewWithT(t)
+
+	command, err := AdvertiseAddressCommand(&infrastructurev1alpha3.AdvertiseAddressPolicy{CIDRs: []string{"192.168.0.0/16", "10.0.0.0/8"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(command).To(HavePrefix("ip -o -4 addr show scope global | awk -v cidrs='192.168.0.0/16 10.0.0.0/8' -v prefer=Private '"))
+	// the command fits in a plain YAML scalar
+	g.Expect(command).NotTo(ContainSubstring(": "))
+	g.Expect(command).NotTo(ContainSubstring(" #"))
+
+	command, err = AdvertiseAddressCommand(&infrastructurev1alpha3.AdvertiseAddressPolicy{Preference: infrastructurev1alpha3.AddressPreferencePublic})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(command).To(ContainSubstring("-v cidrs='' -v prefer=Public '"))
+
+	for _, cidr := range []string{"2604:1380::/32", "10.0.0.0/8'; reboot; '", "10.0.0.1"} {
+		_, err = AdvertiseAddressCommand(&infrastructurev1alpha3.AdvertiseAddressPolicy{CIDRs: []string{cidr}})
+		g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue(), cidr)
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/noderefutil"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+const (
+	// AutoscalerMinSizeAnnotation and AutoscalerMaxSizeAnnotation are set
+	// on the MachineDeployments and MachineSets the cluster autoscaler
+	// scales.
+	AutoscalerMinSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	AutoscalerMaxSizeAnnotation = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+
+	// unownedDeviceMinAge protects the devices being created, which their
+	// PacketMachine may not have recorded yet.
+	unownedDeviceMinAge = time.Hour
+)
+
+// ProjectResourcesService reads the resources of a project the anomalies of
+// its clusters are looked for in.
+type ProjectResourcesService interface {
+	GetProjectResources(projectID string) (*ProjectResources, error)
+}
+
+// ProjectResources are the devices and hardware reservations of a project.
+type ProjectResources struct {
+	Devices      []packngo.Device
+	Reservations []packngo.HardwareReservation
+}
+
+// GetProjectResources reads the devices and the hardware reservations of a
+// project.
+func (p *PacketClient) GetProjectResources(projectID string) (*ProjectResources, error) {
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the devices of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	reservations, err := p.HardwareReservations(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the hardware reservations of project %s: %w", projectID, err)
+	}
+	return &ProjectResources{Devices: devices, Reservations: reservations}, nil
+}
+
+// Autoscaled reports whether the cluster autoscaler scales the node group,
+// MachineDeployment or MachineSet, annotated with annotations.
+func Autoscaled(annotations map[string]string) bool {
+	_, hasMin := annotations[AutoscalerMinSizeAnnotation]
+	_, hasMax := annotations[AutoscalerMaxSizeAnnotation]
+	return hasMin && hasMax
+}
+
+// NodeGroups are the names of the MachineDeployments and MachineSets of a
+// cluster.
+type NodeGroups struct {
+	Deployments map[string]bool
+	Sets        map[string]bool
+}
+
+// Contain reports whether a machine belongs to one of the node groups, after
+// the labels Cluster API copies from its Machine.
+func (g NodeGroups) Contain(machine infrastructurev1alpha3.PacketMachine) bool {
+	return g.Deployments[machine.Labels[clusterv1.MachineDeploymentLabelName]] || g.Sets[machine.Labels[clusterv1.MachineSetLabelName]]
+}
+
+// AnomalyInput is what the anomalies of a cluster are looked for in.
+type AnomalyInput struct {
+	Cluster *infrastructurev1alpha3.PacketCluster
+	// Machines are the PacketMachines of the cluster.
+	Machines []infrastructurev1alpha3.PacketMachine
+	// Autoscaled are the node groups of the cluster the cluster autoscaler
+	// scales.
+	Autoscaled NodeGroups
+	// Project are the resources of the project of the cluster.
+	Project *ProjectResources
+}
+
+// ClusterAnomalies returns the resources of a cluster wasting money, in a
+// stable order, empty when there are none: the active devices tagged for the
+// cluster that no PacketMachine owns once older than unownedDeviceMinAge, the
+// machines of autoscaled node groups billed monthly, which the autoscaler
+// deletes long before the month they are billed for ends, and the hardware
+// reservations the machines of the cluster may provision on that have been
+// idle for idleAge. It also returns the idle reservations to record in the
+// status of the cluster, keeping when the recorded ones were first seen idle.
+func ClusterAnomalies(input AnomalyInput, idleAge time.Duration, now time.Time) ([]string, []infrastructurev1alpha3.IdleHardwareReservation) {
+	anomalies := []string{}
+	if unowned := unownedDevices(input, now); len(unowned) > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("devices %s of the cluster are running without a PacketMachine", strings.Join(unowned, ", ")))
+	}
+
+	monthly := []string{}
+	for _, machine := range input.Machines {
+		if machine.Spec.ProviderID == nil || !input.Autoscaled.Contain(machine) {
+			continue
+		}
+		billingCycle := machine.Spec.BillingCycle
+		if record, ok := machine.Annotations[infrastructurev1alpha3.DeviceRequestAnnotation]; ok {
+			if req, err := ParseDeviceRequest(record); err == nil {
+				billingCycle = req.BillingCycle
+			}
+		}
+		if billingCycle == "monthly" {
+			monthly = append(monthly, machine.Name)
+		}
+	}
+	if len(monthly) > 0 {
+		sort.Strings(monthly)
+		anomalies = append(anomalies, fmt.Sprintf("machines %s of autoscaled node groups are billed monthly", strings.Join(monthly, ", ")))
+	}
+
+	idle := idleReservations(input, now)
+	long := []string{}
+	for _, r := range idle {
+		if now.Sub(r.Since.Time) >= idleAge {
+			long = append(long, r.ID)
+		}
+	}
+	if len(long) > 0 {
+		anomalies = append(anomalies, fmt.Sprintf("hardware reservations %s have been idle for more than %s", strings.Join(long, ", "), formatAge(idleAge)))
+	}
+	return anomalies, idle
+}
+
+// unownedDevices returns the IDs of the active devices of a cluster no
+// machine owns, sorted. The devices of the cluster carry its uid tag, or its
+// cluster tag and no uid tag at all.
+func unownedDevices(input AnomalyInput, now time.Time) []string {
+	owned := map[string]bool{}
+	for _, machine := range input.Machines {
+		if machine.Spec.ProviderID == nil {
+			continue
+		}
+		if providerID, err := noderefutil.NewProviderID(*machine.Spec.ProviderID); err == nil {
+			owned[providerID.ID()] = true
+		}
+	}
+
+	clusterTag := GenerateClusterTag(input.Cluster.Name)
+	unowned := []string{}
+	for i := range input.Project.Devices {
+		device := &input.Project.Devices[i]
+		manager := DeviceManager(device)
+		ours := manager == ClusterUID(input.Cluster) || manager == "" && ItemsInList(device.Tags, []string{clusterTag})
+		if !ours || owned[device.ID] || device.State != "active" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, device.Created)
+		if err != nil || now.Sub(created) < unownedDeviceMinAge {
+			continue
+		}
+		unowned = append(unowned, device.ID)
+	}
+	sort.Strings(unowned)
+	return unowned
+}
+
+// idleReservations returns the idle hardware reservations the machines of a
+// cluster may provision on, sorted by ID: the ones of its reservation
+// affinities and of its machines, and every reservation of the project when
+// a machine takes the next available one or the failure domains come from
+// the reservations. Spare reservations are left out.
+func idleReservations(input AnomalyInput, now time.Time) []infrastructurev1alpha3.IdleHardwareReservation {
+	spec := input.Cluster.Spec
+	ids := map[string]bool{}
+	anyReservation := spec.FailureDomainsFromReservations
+	for _, affinity := range spec.ReservationAffinities {
+		for _, id := range affinity.ReservationIDs {
+			ids[id] = true
+		}
+	}
+	for _, machine := range input.Machines {
+		for _, id := range strings.Split(machine.Spec.HardwareReservationID, ",") {
+			switch id = strings.TrimSpace(id); id {
+			case "":
+			case NextAvailableReservation:
+				anyReservation = true
+			default:
+				ids[id] = true
+			}
+		}
+	}
+
+	since := map[string]metav1.Time{}
+	for _, r := range input.Cluster.Status.IdleHardwareReservations {
+		since[r.ID] = r.Since
+	}
+	idle := []infrastructurev1alpha3.IdleHardwareReservation{}
+	for _, r := range input.Project.Reservations {
+		if r.Spare || !r.Provisionable || r.Device != nil || !anyReservation && !ids[r.ID] {
+			continue
+		}
+		first, ok := since[r.ID]
+		if !ok {
+			first = metav1.NewTime(now)
+		}
+		idle = append(idle, infrastructurev1alpha3.IdleHardwareReservation{ID: r.ID, Since: first})
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].ID < idle[j].ID })
+	return idle
+}
+
+// formatAge returns an age in days when it is a whole number of them.
+func formatAge(age time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case age == day:
+		return "1 day"
+	case age > day && age%day == 0:
+		return fmt.Sprintf("%d days", age/day)
+	}
+	return age.String()
+}
+
+// AnomalyAnalyzer looks for the anomalies of the clusters. The resources of
+// every project are read at most once per Interval, so that analyzing many
+// clusters does not eat into the API rate limit, unless the cached ones report
+// unowned devices: the devices of the machines deleted since were listed too.
+type AnomalyAnalyzer struct {
+	Client   ProjectResourcesService
+	Interval time.Duration
+	// IdleReservationAge is how long a hardware reservation is idle before
+	// it is reported.
+	IdleReservationAge time.Duration
+
+	mu       sync.Mutex
+	projects map[string]readResources
+	now      func() time.Time
+}
+
+type readResources struct {
+	resources *ProjectResources
+	readAt    time.Time
+}
+
+// NewAnomalyAnalyzer returns an AnomalyAnalyzer caching the resources of the
+// projects for interval and reporting the hardware reservations idle for
+// idleReservationAge.
+func NewAnomalyAnalyzer(client ProjectResourcesService, interval, idleReservationAge time.Duration) *AnomalyAnalyzer {
+	return &AnomalyAnalyzer{
+		Client:             client,
+		Interval:           interval,
+		IdleReservationAge: idleReservationAge,
+		projects:           map[string]readResources{},
+		now:                time.Now,
+	}
+}
+
+// Analyze returns the anomalies of a cluster and its idle reservations, as
+// ClusterAnomalies, with the resources of its project read at most once per
+// Interval. The unowned devices found in cached resources are confirmed with
+// a new read. Errors are not cached.
+func (a *AnomalyAnalyzer) Analyze(input AnomalyInput) ([]string, []infrastructurev1alpha3.IdleHardwareReservation, error) {
+	now := a.now()
+	projectID := input.Cluster.Spec.ProjectID
+	input.Project = a.cached(projectID, now)
+	if input.Project != nil && len(unownedDevices(input, now)) > 0 {
+		input.Project = nil
+	}
+	if input.Project == nil {
+		resources, err := a.read(projectID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		input.Project = resources
+	}
+	anomalies, idle := ClusterAnomalies(input, a.IdleReservationAge, now)
+	return anomalies, idle, nil
+}
+
+// cached returns the resources of a project read less than Interval ago, nil
+// when there are none.
+func (a *AnomalyAnalyzer) cached(projectID string, now time.Time) *ProjectResources {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	read, ok := a.projects[projectID]
+	if !ok || now.Sub(read.readAt) >= a.Interval {
+		return nil
+	}
+	return read.resources
+}
+
+// read reads the resources of a project and caches them. The API is not
+// called under the lock, so that the analyses of the other clusters are not
+// held up.
+func (a *AnomalyAnalyzer) read(projectID string, now time.Time) (*ProjectResources, error) {
+	resources, err := a.Client.GetProjectResources(projectID)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.projects[projectID] = readResources{resources: resources, readAt: now}
+	return resources, nil
+}
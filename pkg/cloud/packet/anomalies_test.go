@@ -0,0 +1,284 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestAutoscaled(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(Autoscaled(map[string]string{AutoscalerMinSizeAnnotation: "1", AutoscalerMaxSizeAnnotation: "5"})).To(BeTrue())
+	g.Expect(Autoscaled(map[string]string{AutoscalerMaxSizeAnnotation: "5"})).To(BeFalse())
+	g.Expect(Autoscaled(nil)).To(BeFalse())
+}
+
+func TestClusterAnomalies(t *testing.T) {
+	now := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	cluster := &infrastructurev1alpha3.PacketCluster{ObjectMeta: metav1.ObjectMeta{Name: "capi", UID: "uid"}}
+	device := func(id, state string, age time.Duration, tags ...string) packngo.Device {
+		return packngo.Device{ID: id, State: state, Created: now.Add(-age).Format(time.RFC3339), Tags: tags}
+	}
+	machine := func(name, deviceID, billingCycle, deployment string) infrastructurev1alpha3.PacketMachine {
+		m := infrastructurev1alpha3.PacketMachine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{clusterv1.MachineDeploymentLabelName: deployment}},
+			Spec:       infrastructurev1alpha3.PacketMachineSpec{BillingCycle: billingCycle},
+		}
+		if deviceID != "" {
+			providerID := "equinixmetal://" + deviceID
+			m.Spec.ProviderID = &providerID
+		}
+		return m
+	}
+	managed := GenerateClusterUIDTag("uid")
+	autoscaled := NodeGroups{Deployments: map[string]bool{"workers": true}}
+
+	tests := []struct {
+		name     string
+		machines []infrastructurev1alpha3.PacketMachine
+		devices  []packngo.Device
+		want     []string
+	}{
+		{
+			name:     "none",
+			machines: []infrastructurev1alpha3.PacketMachine{machine("m1", "d1", "hourly", "workers")},
+			devices:  []packngo.Device{device("d1", "active", 48*time.Hour, managed)},
+			want:     []string{},
+		},
+		{
+			name:     "unowned devices",
+			machines: []infrastructurev1alpha3.PacketMachine{machine("m1", "d1", "hourly", "workers")},
+			devices: []packngo.Device{
+				device("d1", "active", 48*time.Hour, managed),
+				device("d3", "active", 48*time.Hour, GenerateClusterTag("capi")),
+				device("d2", "active", 2*time.Hour, managed),
+				device("young", "active", time.Minute, managed),
+				device("provisioning", "provisioning", 2*time.Hour, managed),
+				device("other-cluster", "active", 48*time.Hour, GenerateClusterTag("capi"), GenerateClusterUIDTag("other")),
+				device("untagged", "active", 48*time.Hour),
+			},
+			want: []string{"devices d2, d3 of the cluster are running without a PacketMachine"},
+		},
+		{
+			name: "monthly machines of autoscaled node groups",
+			machines: []infrastructurev1alpha3.PacketMachine{
+				machine("m2", "d2", "monthly", "workers"),
+				machine("m1", "d1", "monthly", "workers"),
+				machine("static", "d3", "monthly", "static"),
+				machine("pending", "", "monthly", "workers"),
+				machine("hourly", "d4", "hourly", "workers"),
+			},
+			want: []string{"machines m1, m2 of autoscaled node groups are billed monthly"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			anomalies, _ := ClusterAnomalies(AnomalyInput{
+				Cluster:    cluster,
+				Machines:   tt.machines,
+				Autoscaled: autoscaled,
+				Project:    &ProjectResources{Devices: tt.devices},
+			}, 7*24*time.Hour, now)
+			g.Expect(anomalies).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestClusterAnomaliesRecordedBillingCycle(t *testing.T) {
+	g := NewWithT(t)
+	providerID := "equinixmetal://d1"
+	machine := infrastructurev1alpha3.PacketMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "m1",
+			Labels:      map[string]string{clusterv1.MachineSetLabelName: "workers-abcde"},
+			Annotations: map[string]string{infrastructurev1alpha3.DeviceRequestAnnotation: `{"billing_cycle":"monthly"}`},
+		},
+		Spec: infrastructurev1alpha3.PacketMachineSpec{BillingCycle: "hourly", ProviderID: &providerID},
+	}
+
+	anomalies, _ := ClusterAnomalies(AnomalyInput{
+		Cluster:    &infrastructurev1alpha3.PacketCluster{},
+		Machines:   []infrastructurev1alpha3.PacketMachine{machine},
+		Autoscaled: NodeGroups{Sets: map[string]bool{"workers-abcde": true}},
+		Project:    &ProjectResources{},
+	}, time.Hour, time.Now())
+	g.Expect(anomalies).To(Equal([]string{"machines m1 of autoscaled node groups are billed monthly"}))
+}
+
+func TestClusterAnomaliesIdleReservations(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	reservations := []packngo.HardwareReservation{
+		{ID: "affinity", Provisionable: true},
+		{ID: "machine", Provisionable: true},
+		{ID: "busy", Device: &packngo.Device{ID: "device"}},
+		{ID: "spare", Provisionable: true, Spare: true},
+		{ID: "other", Provisionable: true},
+	}
+	cluster := &infrastructurev1alpha3.PacketCluster{
+		Spec: infrastructurev1alpha3.PacketClusterSpec{ReservationAffinities: []infrastructurev1alpha3.ReservationAffinity{
+			{FailureDomain: "rack-1", ReservationIDs: []string{"affinity", "busy"}},
+		}},
+		Status: infrastructurev1alpha3.PacketClusterStatus{IdleHardwareReservations: []infrastructurev1alpha3.IdleHardwareReservation{
+			{ID: "affinity", Since: metav1.NewTime(now.Add(-8 * 24 * time.Hour))},
+			{ID: "busy", Since: metav1.NewTime(now.Add(-8 * 24 * time.Hour))},
+		}},
+	}
+	machines := []infrastructurev1alpha3.PacketMachine{
+		{Spec: infrastructurev1alpha3.PacketMachineSpec{HardwareReservationID: "machine, spare"}},
+	}
+	input := AnomalyInput{Cluster: cluster, Machines: machines, Project: &ProjectResources{Reservations: reservations}}
+
+	anomalies, idle := ClusterAnomalies(input, 7*24*time.Hour, now)
+	g.Expect(anomalies).To(Equal([]string{"hardware reservations affinity have been idle for more than 7 days"}))
+	// the reservations no longer idle are forgotten, the new ones recorded
+	g.Expect(idle).To(Equal([]infrastructurev1alpha3.IdleHardwareReservation{
+		{ID: "affinity", Since: metav1.NewTime(now.Add(-8 * 24 * time.Hour))},
+		{ID: "machine", Since: metav1.NewTime(now)},
+	}))
+
+	// a machine taking the next available reservation may provision on any
+	machines[0].Spec.HardwareReservationID = NextAvailableReservation
+	cluster.Status.IdleHardwareReservations = idle
+	anomalies, idle = ClusterAnomalies(input, 7*24*time.Hour, now.Add(7*24*time.Hour))
+	g.Expect(anomalies).To(Equal([]string{"hardware reservations affinity, machine have been idle for more than 7 days"}))
+	g.Expect(idle).To(HaveLen(3))
+	g.Expect(idle[2].ID).To(Equal("other"))
+}
+
+func TestFormatAge(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(formatAge(24 * time.Hour)).To(Equal("1 day"))
+	g.Expect(formatAge(14 * 24 * time.Hour)).To(Equal("14 days"))
+	g.Expect(formatAge(36 * time.Hour)).To(Equal("36h0m0s"))
+}
+
+func TestGetProjectResources(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"devices": []map[string]interface{}{{"id": "device", "state": "active"}},
+	}})
+	api.on(http.MethodGet, "/projects/project/hardware-reservations", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"hardware_reservations": []map[string]interface{}{{"id": "reservation", "provisionable": true}},
+	}})
+
+	resources, err := c.GetProjectResources("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resources.Devices).To(HaveLen(1))
+	g.Expect(resources.Devices[0].State).To(Equal("active"))
+	g.Expect(resources.Reservations).To(HaveLen(1))
+	g.Expect(resources.Reservations[0].Provisionable).To(BeTrue())
+
+	_, err = c.GetProjectResources("other")
+	g.Expect(err).To(MatchError(ContainSubstring("failed to list the devices of project other")))
+}
+
+// fakeProjectResources serves the resources of every project and counts the
+// reads.
+type fakeProjectResources struct {
+	resources *ProjectResources
+	err       error
+	reads     int
+}
+
+func (f *fakeProjectResources) GetProjectResources(projectID string) (*ProjectResources, error) {
+	f.reads++
+	return f.resources, f.err
+}
+
+func TestAnomalyAnalyzer(t *testing.T) {
+	g := NewWithT(t)
+	service := &fakeProjectResources{resources: &ProjectResources{
+		Reservations: []packngo.HardwareReservation{{ID: "reservation", Provisionable: true}},
+	}}
+	analyzer := NewAnomalyAnalyzer(service, time.Hour, 24*time.Hour)
+	now := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	analyzer.now = func() time.Time { return now }
+	cluster := &infrastructurev1alpha3.PacketCluster{Spec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", FailureDomainsFromReservations: true}}
+
+	anomalies, idle, err := analyzer.Analyze(AnomalyInput{Cluster: cluster})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(anomalies).To(BeEmpty())
+	g.Expect(idle).To(HaveLen(1))
+
+	// the resources of the project are cached, the age of the idle
+	// reservations is not
+	cluster.Status.IdleHardwareReservations = idle
+	now = now.Add(59 * time.Minute)
+	_, _, _ = analyzer.Analyze(AnomalyInput{Cluster: cluster})
+	g.Expect(service.reads).To(Equal(1))
+	now = now.Add(24 * time.Hour)
+	anomalies, _, _ = analyzer.Analyze(AnomalyInput{Cluster: cluster})
+	g.Expect(anomalies).To(Equal([]string{"hardware reservations reservation have been idle for more than 1 day"}))
+	g.Expect(service.reads).To(Equal(2))
+
+	// errors are not cached
+	now = now.Add(time.Hour)
+	service.err = errors.New("rate limited")
+	_, _, err = analyzer.Analyze(AnomalyInput{Cluster: cluster})
+	g.Expect(err).To(HaveOccurred())
+	service.err = nil
+	_, _, err = analyzer.Analyze(AnomalyInput{Cluster: cluster})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(service.reads).To(Equal(4))
+}
+
+func TestAnomalyAnalyzerConfirmsUnownedDevices(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	cluster := &infrastructurev1alpha3.PacketCluster{Spec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"}}
+	cluster.Name = "cluster"
+	cluster.UID = "cluster-uid"
+	device := packngo.Device{
+		ID:      "device",
+		State:   "active",
+		Created: now.Add(-2 * time.Hour).Format(time.RFC3339),
+		Tags:    []string{GenerateClusterUIDTag("cluster-uid")},
+	}
+	providerID := "equinixmetal://device"
+	machine := infrastructurev1alpha3.PacketMachine{Spec: infrastructurev1alpha3.PacketMachineSpec{ProviderID: &providerID}}
+
+	service := &fakeProjectResources{resources: &ProjectResources{Devices: []packngo.Device{device}}}
+	analyzer := NewAnomalyAnalyzer(service, time.Hour, 24*time.Hour)
+	analyzer.now = func() time.Time { return now }
+
+	anomalies, _, err := analyzer.Analyze(AnomalyInput{Cluster: cluster, Machines: []infrastructurev1alpha3.PacketMachine{machine}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(anomalies).To(BeEmpty())
+	g.Expect(service.reads).To(Equal(1))
+
+	// the machine and its device are deleted: the cached device is not
+	// reported, the project is read again
+	service.resources = &ProjectResources{}
+	anomalies, _, err = analyzer.Analyze(AnomalyInput{Cluster: cluster})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(anomalies).To(BeEmpty())
+	g.Expect(service.reads).To(Equal(2))
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/packethost/packngo"
+	corev1 "k8s.io/api/core/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// AutopsyEventCount is how many of the latest events of a device are kept in
+// its autopsy.
+const AutopsyEventCount = 50
+
+// Keys of the autopsy ConfigMap data.
+const (
+	AutopsyDeviceKey    = "device.json"
+	AutopsyAddressesKey = "addresses.json"
+	AutopsyEventsKey    = "events"
+	AutopsyTimelineKey  = "timeline"
+)
+
+// autopsyDevice is the part of a device kept in its autopsy.
+type autopsyDevice struct {
+	ID                    string `json:"id"`
+	Hostname              string `json:"hostname,omitempty"`
+	State                 string `json:"state,omitempty"`
+	Plan                  string `json:"plan,omitempty"`
+	OS                    string `json:"os,omitempty"`
+	Facility              string `json:"facility,omitempty"`
+	Metro                 string `json:"metro,omitempty"`
+	HardwareReservationID string `json:"hardwareReservationID,omitempty"`
+	BillingCycle          string `json:"billingCycle,omitempty"`
+	Created               string `json:"created,omitempty"`
+	Updated               string `json:"updated,omitempty"`
+}
+
+// autopsyAddresses are the last addresses known for a machine.
+type autopsyAddresses struct {
+	NodeAddresses   []corev1.NodeAddress                   `json:"nodeAddresses,omitempty"`
+	DeviceAddresses []infrastructurev1alpha3.DeviceAddress `json:"deviceAddresses,omitempty"`
+}
+
+// timelineEntry is a dated line of the timeline of a machine.
+type timelineEntry struct {
+	at   time.Time
+	line string
+}
+
+// Autopsy returns the diagnostics of a PacketMachine and of its device,
+// collected before the device is deleted: the device, the last addresses
+// known for the machine, the latest events of the device, oldest first, and
+// the provisioning timeline built from the device and the conditions of the
+// machine.
+func Autopsy(packetMachine *infrastructurev1alpha3.PacketMachine, device *packngo.Device, events []packngo.Event) (map[string]string, error) {
+	summary := autopsyDevice{
+		ID:                    device.ID,
+		Hostname:              device.Hostname,
+		State:                 device.State,
+		HardwareReservationID: DeviceReservationID(device),
+		BillingCycle:          device.BillingCycle,
+		Created:               device.Created,
+		Updated:               device.Updated,
+	}
+	if device.Plan != nil {
+		summary.Plan = device.Plan.Slug
+	}
+	if device.OS != nil {
+		summary.OS = device.OS.Slug
+	}
+	if device.Facility != nil {
+		summary.Facility = device.Facility.Code
+	}
+	if device.Metro != nil {
+		summary.Metro = device.Metro.Code
+	}
+	deviceData, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	addressesData, err := json.MarshalIndent(autopsyAddresses{
+		NodeAddresses:   packetMachine.Status.Addresses,
+		DeviceAddresses: packetMachine.Status.DeviceAddresses,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		AutopsyDeviceKey:    string(deviceData),
+		AutopsyAddressesKey: string(addressesData),
+		AutopsyEventsKey:    autopsyEvents(events),
+		AutopsyTimelineKey:  autopsyTimeline(packetMachine, device),
+	}, nil
+}
+
+// autopsyEvents returns the events of a device, one per line, oldest first.
+func autopsyEvents(events []packngo.Event) string {
+	entries := make([]timelineEntry, 0, len(events))
+	for _, event := range events {
+		entry := timelineEntry{line: event.Interpolated}
+		if entry.line == "" {
+			entry.line = event.Body
+		}
+		if event.Type != "" {
+			entry.line = fmt.Sprintf("%s %s", event.Type, entry.line)
+		}
+		if event.CreatedAt != nil {
+			entry.at = event.CreatedAt.Time
+		}
+		entries = append(entries, entry)
+	}
+	return joinTimeline(entries)
+}
+
+// autopsyTimeline returns the provisioning timeline of a machine, one step per
+// line, oldest first.
+func autopsyTimeline(packetMachine *infrastructurev1alpha3.PacketMachine, device *packngo.Device) string {
+	entries := []timelineEntry{}
+	if created, err := time.Parse(time.RFC3339, device.Created); err == nil {
+		entries = append(entries, timelineEntry{at: created, line: fmt.Sprintf("device %s created", device.ID)})
+	}
+	for _, condition := range packetMachine.Status.Conditions {
+		line := fmt.Sprintf("%s=%s", condition.Type, condition.Status)
+		if condition.Reason != "" {
+			line = fmt.Sprintf("%s %s", line, condition.Reason)
+		}
+		if condition.Message != "" {
+			line = fmt.Sprintf("%s: %s", line, condition.Message)
+		}
+		entries = append(entries, timelineEntry{at: condition.LastTransitionTime.Time, line: line})
+	}
+	if callback, ok := packetMachine.Annotations[infrastructurev1alpha3.BootstrapCallbackAnnotation]; ok {
+		if at, err := time.Parse(time.RFC3339, callback); err == nil {
+			entries = append(entries, timelineEntry{at: at, line: "bootstrap callback received"})
+		}
+	}
+	if packetMachine.DeletionTimestamp != nil {
+		entries = append(entries, timelineEntry{at: packetMachine.DeletionTimestamp.Time, line: "machine deleted"})
+	}
+	return joinTimeline(entries)
+}
+
+func joinTimeline(entries []timelineEntry) string {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].at.Before(entries[j].at)
+	})
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		at := "-"
+		if !entry.at.IsZero() {
+			at = entry.at.UTC().Format(time.RFC3339)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", at, entry.line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AutopsyExpired reports whether the AutopsyExpiresAnnotation of an autopsy
+// ConfigMap is past. An autopsy without a valid expiry is kept.
+func AutopsyExpired(annotations map[string]string, now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, annotations[infrastructurev1alpha3.AutopsyExpiresAnnotation])
+	if err != nil {
+		return false
+	}
+	return now.After(expires)
+}
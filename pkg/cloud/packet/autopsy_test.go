@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestAutopsy(t *testing.T) {
+	g := NewWithT(t)
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		g.Expect(err).NotTo(HaveOccurred())
+		return parsed
+	}
+	deleted := metav1.NewTime(at("2021-03-01T12:00:00Z"))
+
+	packetMachine := &infrastructurev1alpha3.PacketMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "worker-0",
+			DeletionTimestamp: &deleted,
+			Annotations: map[string]string{
+				infrastructurev1alpha3.BootstrapCallbackAnnotation: "2021-03-01T10:10:00Z",
+			},
+		},
+		Status: infrastructurev1alpha3.PacketMachineStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalIP, Address: "147.75.1.1"}},
+			Conditions: clusterv1.Conditions{
+				{
+					Type:               infrastructurev1alpha3.DeviceReadyCondition,
+					Status:             corev1.ConditionFalse,
+					Reason:             clusterv1.DeletingReason,
+					LastTransitionTime: deleted,
+				},
+				{
+					Type:               clusterv1.ReadyCondition,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(at("2021-03-01T10:08:00Z")),
+				},
+			},
+		},
+	}
+	device := &packngo.Device{
+		ID:                  "device",
+		Hostname:            "worker-0",
+		State:               "active",
+		Created:             "2021-03-01T10:00:00Z",
+		Plan:                &packngo.Plan{Slug: "c3.small.x86"},
+		Facility:            &packngo.Facility{Code: "ewr1"},
+		HardwareReservation: packngo.Href{Href: "/hardware-reservations/reservation"},
+	}
+	events := []packngo.Event{
+		{Type: "provisioning.109", Interpolated: "Installation finished", CreatedAt: &packngo.Timestamp{Time: at("2021-03-01T10:06:00Z")}},
+		{Type: "provisioning.101", Body: "Provisioning started", CreatedAt: &packngo.Timestamp{Time: at("2021-03-01T10:01:00Z")}},
+	}
+
+	data, err := Autopsy(packetMachine, device, events)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	summary := map[string]interface{}{}
+	g.Expect(json.Unmarshal([]byte(data[AutopsyDeviceKey]), &summary)).To(Succeed())
+	g.Expect(summary).To(HaveKeyWithValue("plan", "c3.small.x86"))
+	g.Expect(summary).To(HaveKeyWithValue("facility", "ewr1"))
+	g.Expect(summary).To(HaveKeyWithValue("hardwareReservationID", "reservation"))
+	g.Expect(data[AutopsyAddressesKey]).To(ContainSubstring("147.75.1.1"))
+	g.Expect(data[AutopsyEventsKey]).To(Equal(
+		"2021-03-01T10:01:00Z provisioning.101 Provisioning started\n" +
+			"2021-03-01T10:06:00Z provisioning.109 Installation finished"))
+	g.Expect(data[AutopsyTimelineKey]).To(Equal(
+		"2021-03-01T10:00:00Z device device created\n" +
+			"2021-03-01T10:08:00Z Ready=True\n" +
+			"2021-03-01T10:10:00Z bootstrap callback received\n" +
+			"2021-03-01T12:00:00Z DeviceReady=False Deleting\n" +
+			"2021-03-01T12:00:00Z machine deleted"))
+}
+
+func TestAutopsyExpired(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		expires string
+		want    bool
+	}{
+		{name: "expired", expires: "2021-03-01T11:00:00Z", want: true},
+		{name: "not yet", expires: "2021-03-01T13:00:00Z"},
+		{name: "invalid", expires: "tomorrow"},
+		{name: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			annotations := map[string]string{}
+			if tt.expires != "" {
+				annotations[infrastructurev1alpha3.AutopsyExpiresAnnotation] = tt.expires
+			}
+			g.Expect(AutopsyExpired(annotations, now)).To(Equal(tt.want))
+		})
+	}
+}
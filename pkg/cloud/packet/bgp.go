@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+const (
+	// DefaultBGPLocalASN is the ASN of the devices when a cluster sets none.
+	DefaultBGPLocalASN = 65000
+	// bgpAddressFamily is the address family of the sessions of the control
+	// plane devices.
+	bgpAddressFamily = "ipv4"
+	// bgpUseCase is reported to Packet with the configurations the
+	// controller enables.
+	bgpUseCase = "cluster-api-provider-packet"
+)
+
+// BGPService manages the BGP configuration of a project and the BGP sessions
+// of its devices.
+type BGPService interface {
+	GetBGPConfig(projectID string) (*packngo.BGPConfig, error)
+	EnableBGP(projectID string, req packngo.CreateBGPConfigRequest) error
+	EnsureBGPSession(deviceID string) (*packngo.BGPSession, error)
+}
+
+// BGPConfigRequest returns the request enabling BGP on a project as
+// configured by bgp, with password as md5 password.
+func BGPConfigRequest(bgp *infrastructurev1alpha3.BGPConfig, password string) packngo.CreateBGPConfigRequest {
+	req := packngo.CreateBGPConfigRequest{
+		DeploymentType: string(bgp.DeploymentType),
+		Asn:            int(bgp.LocalASN),
+		Md5:            password,
+		UseCase:        bgpUseCase,
+	}
+	if req.DeploymentType == "" {
+		req.DeploymentType = string(infrastructurev1alpha3.BGPDeploymentTypeLocal)
+	}
+	if req.Asn == 0 {
+		req.Asn = DefaultBGPLocalASN
+	}
+	return req
+}
+
+// BGPConfigDrift compares the BGP configuration of a project with the
+// request a cluster would enable it with. Packet can not update the
+// configuration of a project, it returns a description of the differences
+// for the user to solve, empty when there is none. The password is not
+// compared, Packet does not return it.
+func BGPConfigDrift(config *packngo.BGPConfig, req packngo.CreateBGPConfigRequest) string {
+	switch {
+	case config.Asn != req.Asn:
+		return fmt.Sprintf("project BGP ASN is %d, the cluster sets %d", config.Asn, req.Asn)
+	case config.DeploymentType != req.DeploymentType:
+		return fmt.Sprintf("project BGP deployment type is %s, the cluster sets %s", config.DeploymentType, req.DeploymentType)
+	}
+	return ""
+}
+
+// GetBGPConfig returns the BGP configuration of a project, nil when BGP is
+// not enabled on it.
+func (p *PacketClient) GetBGPConfig(projectID string) (*packngo.BGPConfig, error) {
+	config, _, err := p.BGPConfig.Get(projectID, nil)
+	if err = packeterrors.Wrap(err); err != nil {
+		if packeterrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the bgp configuration of project %s: %w", projectID, err)
+	}
+	// projects without BGP return an empty configuration
+	if config.ID == "" {
+		return nil, nil
+	}
+	return config, nil
+}
+
+// EnableBGP requests BGP on a project.
+func (p *PacketClient) EnableBGP(projectID string, req packngo.CreateBGPConfigRequest) error {
+	if _, err := p.BGPConfig.Create(projectID, req); err != nil {
+		return fmt.Errorf("failed to enable bgp on project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	return nil
+}
+
+// EnsureBGPSession creates the IPv4 BGP session of a device, unless it has
+// one already.
+func (p *PacketClient) EnsureBGPSession(deviceID string) (*packngo.BGPSession, error) {
+	sessions, _, err := p.Devices.ListBGPSessions(deviceID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the bgp sessions of device %s: %w", deviceID, packeterrors.Wrap(err))
+	}
+	for i := range sessions {
+		if sessions[i].AddressFamily == bgpAddressFamily {
+			return &sessions[i], nil
+		}
+	}
+	session, _, err := p.BGPSessions.Create(deviceID, packngo.CreateBGPSessionRequest{AddressFamily: bgpAddressFamily})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the bgp session of device %s: %w", deviceID, packeterrors.Wrap(err))
+	}
+	return session, nil
+}
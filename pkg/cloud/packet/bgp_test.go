@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestBGPConfigRequest(t *testing.T) {
+	g := NewWithT(t)
+
+	req := BGPConfigRequest(&infrastructurev1alpha3.BGPConfig{}, "")
+	g.Expect(req.Asn).To(Equal(DefaultBGPLocalASN))
+	g.Expect(req.DeploymentType).To(Equal("local"))
+	g.Expect(req.Md5).To(BeEmpty())
+
+	req = BGPConfigRequest(&infrastructurev1alpha3.BGPConfig{LocalASN: 65100, DeploymentType: infrastructurev1alpha3.BGPDeploymentTypeGlobal}, "secret")
+	g.Expect(req.Asn).To(Equal(65100))
+	g.Expect(req.DeploymentType).To(Equal("global"))
+	g.Expect(req.Md5).To(Equal("secret"))
+}
+
+func TestBGPConfigDrift(t *testing.T) {
+	g := NewWithT(t)
+	req := packngo.CreateBGPConfigRequest{Asn: 65000, DeploymentType: "local", Md5: "secret"}
+
+	g.Expect(BGPConfigDrift(&packngo.BGPConfig{Asn: 65000, DeploymentType: "local"}, req)).To(BeEmpty())
+	g.Expect(BGPConfigDrift(&packngo.BGPConfig{Asn: 65100, DeploymentType: "local"}, req)).To(ContainSubstring("65100"))
+	g.Expect(BGPConfigDrift(&packngo.BGPConfig{Asn: 65000, DeploymentType: "global"}, req)).To(ContainSubstring("global"))
+}
+
+func TestGetBGPConfig(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/bgp-config",
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{}},
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "config", "asn": 65000, "status": "enabled"}},
+	)
+
+	config, err := c.GetBGPConfig("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(BeNil())
+
+	config, err = c.GetBGPConfig("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Asn).To(Equal(65000))
+
+	config, err = c.GetBGPConfig("other")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(BeNil())
+}
+
+func TestEnableBGP(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodPost, "/projects/project/bgp-configs", fakeResponse{status: http.StatusNoContent})
+
+	g.Expect(c.EnableBGP("project", packngo.CreateBGPConfigRequest{Asn: 65000, DeploymentType: "local", Md5: "secret"})).To(Succeed())
+	body := api.requestsTo(http.MethodPost, "/projects/project/bgp-configs")[0].Body
+	g.Expect(body).To(HaveKeyWithValue("asn", float64(65000)))
+	g.Expect(body).To(HaveKeyWithValue("md5", "secret"))
+}
+
+func TestEnsureBGPSession(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/devices/existing/bgp/sessions", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"bgp_sessions": []map[string]string{{"id": "session", "address_family": "ipv4"}},
+	}})
+	api.on(http.MethodGet, "/devices/new/bgp/sessions", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"bgp_sessions": []map[string]string{{"id": "v6", "address_family": "ipv6"}},
+	}})
+	api.on(http.MethodPost, "/devices/new/bgp/sessions", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "created", "address_family": "ipv4"}})
+
+	session, err := c.EnsureBGPSession("existing")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(session.ID).To(Equal("session"))
+
+	session, err = c.EnsureBGPSession("new")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(session.ID).To(Equal("created"))
+	g.Expect(api.requestsTo(http.MethodPost, "/devices/new/bgp/sessions")[0].Body).To(HaveKeyWithValue("address_family", "ipv4"))
+}
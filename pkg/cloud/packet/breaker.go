@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"sync"
+	"time"
+)
+
+// CreateBreaker stops creating the devices of a cluster once their creation
+// failed Threshold times within Window, for Cooldown. The failures counted are
+// the ones that go away by themselves, like a quota or capacity shortage: the
+// machines of a cluster scaled up would otherwise keep hammering the API and
+// record an event each.
+type CreateBreaker struct {
+	Threshold int
+	Window    time.Duration
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	clusters map[string]*breakerState
+	now      func() time.Time
+}
+
+type breakerState struct {
+	failures  []time.Time
+	openUntil time.Time
+	lastError string
+}
+
+// NewCreateBreaker returns a CreateBreaker opening after threshold failures
+// within window, for cooldown.
+func NewCreateBreaker(threshold int, window, cooldown time.Duration) *CreateBreaker {
+	return &CreateBreaker{
+		Threshold: threshold,
+		Window:    window,
+		Cooldown:  cooldown,
+		clusters:  map[string]*breakerState{},
+		now:       time.Now,
+	}
+}
+
+// Open returns until when the creations of the devices of cluster are stopped
+// and the last failure that stopped them. The time is zero when devices can be
+// created.
+func (b *CreateBreaker) Open(cluster string) (time.Time, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.clusters[cluster]
+	if !ok || !b.now().Before(state.openUntil) {
+		return time.Time{}, ""
+	}
+	return state.openUntil, state.lastError
+}
+
+// Failure records a failed creation of a device of cluster. It returns true
+// when the failure stopped the creations, once per cooldown.
+func (b *CreateBreaker) Failure(cluster string, err error) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	state, ok := b.clusters[cluster]
+	if !ok {
+		state = &breakerState{}
+		b.clusters[cluster] = state
+	}
+	if now.Before(state.openUntil) {
+		// creations already in flight when the breaker opened
+		return false
+	}
+
+	failures := []time.Time{}
+	for _, failure := range state.failures {
+		if now.Sub(failure) < b.Window {
+			failures = append(failures, failure)
+		}
+	}
+	state.failures = append(failures, now)
+	state.lastError = err.Error()
+	if len(state.failures) < b.Threshold {
+		return false
+	}
+	state.failures = nil
+	state.openUntil = now.Add(b.Cooldown)
+	return true
+}
+
+// Success forgets the failures of cluster once one of its devices got
+// created.
+func (b *CreateBreaker) Success(cluster string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if state, ok := b.clusters[cluster]; ok && !b.now().Before(state.openUntil) {
+		delete(b.clusters, cluster)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCreateBreaker(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	breaker := NewCreateBreaker(3, 10*time.Minute, 15*time.Minute)
+	breaker.now = func() time.Time { return now }
+	quota := errors.New("quota exceeded")
+
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	now = now.Add(11 * time.Minute)
+	// the first failure left the window
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	until, _ := breaker.Open("default/capi")
+	g.Expect(until.IsZero()).To(BeTrue())
+
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeTrue())
+	until, cause := breaker.Open("default/capi")
+	g.Expect(until).To(Equal(now.Add(15 * time.Minute)))
+	g.Expect(cause).To(Equal("quota exceeded"))
+	// other clusters are not stopped
+	until, _ = breaker.Open("default/other")
+	g.Expect(until.IsZero()).To(BeTrue())
+
+	// failures while open do not open it again
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	breaker.Success("default/capi")
+	until, _ = breaker.Open("default/capi")
+	g.Expect(until.IsZero()).To(BeFalse())
+
+	now = now.Add(15 * time.Minute)
+	until, _ = breaker.Open("default/capi")
+	g.Expect(until.IsZero()).To(BeTrue())
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	breaker.Success("default/capi")
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeFalse())
+	g.Expect(breaker.Failure("default/capi", quota)).To(BeTrue())
+}
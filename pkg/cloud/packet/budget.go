@@ -0,0 +1,40 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// MaxHourlyCost returns the budget set by the MaxHourlyCostAnnotation of
+// annotations, false when there is none. A budget that is not a positive
+// number is an ErrInvalidRequest.
+func MaxHourlyCost(annotations map[string]string) (float64, bool, error) {
+	value, ok := annotations[infrastructurev1alpha3.MaxHourlyCostAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	budget, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || budget <= 0 {
+		return 0, false, fmt.Errorf("annotation %s: %q is not a positive number: %w", infrastructurev1alpha3.MaxHourlyCostAnnotation, value, ErrInvalidRequest)
+	}
+	return budget, true, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestMaxHourlyCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   *string
+		want    float64
+		wantSet bool
+		wantErr bool
+	}{
+		{name: "no annotation"},
+		{name: "budget", value: pointer.StringPtr(" 2.50"), want: 2.5, wantSet: true},
+		{name: "not a number", value: pointer.StringPtr("2,50"), wantErr: true},
+		{name: "zero", value: pointer.StringPtr("0"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			annotations := map[string]string{}
+			if tt.value != nil {
+				annotations[infrastructurev1alpha3.MaxHourlyCostAnnotation] = *tt.value
+			}
+			budget, ok, err := MaxHourlyCost(annotations)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ok).To(Equal(tt.wantSet))
+			g.Expect(budget).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestCompatibilityMatrixCheckBudget(t *testing.T) {
+	g := NewWithT(t)
+	matrix := newTestCompatibilityMatrix(t)
+
+	g.Expect(matrix.CheckBudget("c3.small.x86", 0.5)).To(Succeed())
+	err := matrix.CheckBudget("c3.small.x86", 0.25)
+	g.Expect(err).To(MatchError(ContainSubstring("machine type c3.small.x86 costs 0.50 per hour, over the budget of 0.25")))
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+	// plans without a price and unknown plans are not checked
+	g.Expect(matrix.CheckBudget("t1.small.x86", 0.01)).To(Succeed())
+	g.Expect(matrix.CheckBudget("n2.xlarge.x86", 0.01)).To(Succeed())
+}
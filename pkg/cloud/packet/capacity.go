@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// CapacityService tells where devices can be placed.
+type CapacityService interface {
+	FacilityMetro(facility string) (string, error)
+	FacilityWithCapacity(plan, metro string) (string, error)
+	CapacityReport() (packngo.CapacityReport, error)
+	FacilityMetros() (map[string]string, error)
+}
+
+// FacilityMetro returns the code of the metro a facility belongs to.
+func (p *PacketClient) FacilityMetro(facility string) (string, error) {
+	facilities, _, err := p.Facilities.List(&packngo.ListOptions{Includes: []string{"metro"}})
+	if err != nil {
+		return "", packeterrors.Wrap(err)
+	}
+	for _, f := range facilities {
+		if f.Code != facility {
+			continue
+		}
+		if f.Metro == nil {
+			return "", fmt.Errorf("facility %s is not part of a metro", facility)
+		}
+		return f.Metro.Code, nil
+	}
+	return "", fmt.Errorf("facility %s not found", facility)
+}
+
+// FacilityWithCapacity searches the facilities for capacity for plan and
+// returns the one with the most left. A non empty metro restricts the search
+// to the facilities of that metro.
+func (p *PacketClient) FacilityWithCapacity(plan, metro string) (string, error) {
+	report, _, err := p.CapacityService.List()
+	if err != nil {
+		return "", packeterrors.Wrap(err)
+	}
+
+	var allowed map[string]bool
+	if metro != "" {
+		facilities, _, err := p.Facilities.List(&packngo.ListOptions{Includes: []string{"metro"}})
+		if err != nil {
+			return "", packeterrors.Wrap(err)
+		}
+		allowed = map[string]bool{}
+		for _, f := range facilities {
+			if f.Metro != nil && strings.EqualFold(f.Metro.Code, metro) {
+				allowed[f.Code] = true
+			}
+		}
+	}
+
+	facility := MostAvailableFacility(*report, plan, allowed)
+	if facility == "" {
+		if metro != "" {
+			return "", fmt.Errorf("no facility of metro %s has capacity for plan %s: %w", metro, plan, ErrNoCapacity)
+		}
+		return "", fmt.Errorf("no facility has capacity for plan %s: %w", plan, ErrNoCapacity)
+	}
+	return facility, nil
+}
+
+// CapacityReport returns the capacity level of every plan in every facility.
+func (p *PacketClient) CapacityReport() (packngo.CapacityReport, error) {
+	report, _, err := p.CapacityService.List()
+	if err != nil {
+		return nil, packeterrors.Wrap(err)
+	}
+	return *report, nil
+}
+
+// FacilityMetros returns the code of the metro of every facility, keyed by
+// the facility code. Facilities outside of any metro are left out.
+func (p *PacketClient) FacilityMetros() (map[string]string, error) {
+	facilities, _, err := p.Facilities.List(&packngo.ListOptions{Includes: []string{"metro"}})
+	if err != nil {
+		return nil, packeterrors.Wrap(err)
+	}
+	metros := map[string]string{}
+	for _, f := range facilities {
+		if f.Metro != nil {
+			metros[f.Code] = f.Metro.Code
+		}
+	}
+	return metros, nil
+}
+
+// capacityLevels ranks the capacity levels reported by Packet, facilities
+// at any other level can not host a new device.
+var capacityLevels = map[string]int{
+	"normal":  2,
+	"limited": 1,
+}
+
+// MostAvailableFacility returns the facility of the report with the highest
+// capacity level for plan, the first one in alphabetical order on ties. A non
+// nil allowed restricts the facilities considered. An empty string means no
+// facility has capacity left.
+func MostAvailableFacility(report packngo.CapacityReport, plan string, allowed map[string]bool) string {
+	facilities := make([]string, 0, len(report))
+	for facility := range report {
+		facilities = append(facilities, facility)
+	}
+	sort.Strings(facilities)
+
+	selected, selectedLevel := "", 0
+	for _, facility := range facilities {
+		if allowed != nil && !allowed[facility] {
+			continue
+		}
+		if level := capacityLevels[report[facility][plan].Level]; level > selectedLevel {
+			selected, selectedLevel = facility, level
+		}
+	}
+	return selected
+}
+
+// CandidateFacilities returns the facilities the devices of a machine can be
+// placed in, following the same rules as the device creation. A nil map means
+// any facility.
+func CandidateFacilities(machine infrastructurev1alpha3.PacketMachineSpec, cluster infrastructurev1alpha3.PacketClusterSpec, metros map[string]string) map[string]bool {
+	switch {
+	case len(machine.Facilities) != 0:
+		candidates := map[string]bool{}
+		for _, facility := range machine.Facilities {
+			candidates[facility] = true
+		}
+		return candidates
+	case machine.Facility == infrastructurev1alpha3.FacilityAny:
+		// the search is restricted to the metro of a metro scoped control plane ip
+		if ipScope, _ := IPReservationLocation(cluster); ipScope != infrastructurev1alpha3.IPReservationScopeMetro {
+			return nil
+		}
+	case machine.Facility != "":
+		return map[string]bool{machine.Facility: true}
+	case cluster.Facility != "":
+		return map[string]bool{cluster.Facility: true}
+	case cluster.Metro == "":
+		return nil
+	}
+
+	candidates := map[string]bool{}
+	for facility, metro := range metros {
+		if strings.EqualFold(metro, cluster.Metro) {
+			candidates[facility] = true
+		}
+	}
+	return candidates
+}
+
+// PlanCapacity returns the best capacity level of plan in the allowed
+// facilities, any facility of the report when allowed is nil: normal, limited
+// or unavailable.
+func PlanCapacity(report packngo.CapacityReport, plan string, allowed map[string]bool) string {
+	facility := MostAvailableFacility(report, plan, allowed)
+	if facility == "" {
+		return "unavailable"
+	}
+	return report[facility][plan].Level
+}
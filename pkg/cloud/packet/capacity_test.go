@@ -0,0 +1,220 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+var testFacilities = map[string]interface{}{"facilities": []map[string]interface{}{
+	{"code": "ewr1", "metro": map[string]string{"code": "ny"}},
+	{"code": "ny5", "metro": map[string]string{"code": "ny"}},
+	{"code": "sjc1", "metro": map[string]string{"code": "sv"}},
+	{"code": "old1"},
+}}
+
+func TestMostAvailableFacility(t *testing.T) {
+	g := NewWithT(t)
+
+	report := packngo.CapacityReport{
+		"ewr1": {"c3.small.x86": {Level: "limited"}, "m3.large.x86": {Level: "normal"}},
+		"sjc1": {"c3.small.x86": {Level: "unavailable"}},
+		"ny5":  {"c3.small.x86": {Level: "normal"}},
+		"da11": {"c3.small.x86": {Level: "normal"}},
+	}
+
+	g.Expect(MostAvailableFacility(report, "c3.small.x86", nil)).To(Equal("da11"))
+	g.Expect(MostAvailableFacility(report, "c3.small.x86", map[string]bool{"ewr1": true, "sjc1": true})).To(Equal("ewr1"))
+	g.Expect(MostAvailableFacility(report, "c3.small.x86", map[string]bool{"sjc1": true})).To(BeEmpty())
+	g.Expect(MostAvailableFacility(report, "m3.large.x86", nil)).To(Equal("ewr1"))
+	g.Expect(MostAvailableFacility(report, "n2.xlarge.x86", nil)).To(BeEmpty())
+}
+
+func TestFacilityWithCapacity(t *testing.T) {
+	capacity := map[string]interface{}{"capacity": map[string]interface{}{
+		"ewr1": map[string]interface{}{"c3.small.x86": map[string]string{"level": "limited"}},
+		"ny5":  map[string]interface{}{"c3.small.x86": map[string]string{"level": "unavailable"}},
+		"sjc1": map[string]interface{}{"c3.small.x86": map[string]string{"level": "normal"}},
+	}}
+
+	tests := []struct {
+		name           string
+		metro          string
+		want           string
+		wantNoCapacity bool
+		wantListings   int
+	}{
+		{name: "any facility", want: "sjc1"},
+		{name: "facility of the metro", metro: "ny", want: "ewr1", wantListings: 1},
+		{name: "metro without capacity", metro: "da", wantNoCapacity: true, wantListings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/capacity", fakeResponse{status: http.StatusOK, body: capacity})
+			api.on("GET", "/facilities", fakeResponse{status: http.StatusOK, body: testFacilities})
+
+			facility, err := c.FacilityWithCapacity("c3.small.x86", tt.metro)
+			if tt.wantNoCapacity {
+				g.Expect(errors.Is(err, ErrNoCapacity)).To(BeTrue())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(facility).To(Equal(tt.want))
+			}
+			g.Expect(api.requestsTo("GET", "/facilities")).To(HaveLen(tt.wantListings))
+		})
+	}
+}
+
+func TestFacilityWithCapacityFailure(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/capacity", fakeResponse{status: http.StatusInternalServerError, body: apiError("Internal error")})
+
+	_, err := c.FacilityWithCapacity("c3.small.x86", "")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(errors.Is(err, ErrNoCapacity)).To(BeFalse())
+}
+
+func TestFacilityMetro(t *testing.T) {
+	tests := []struct {
+		name     string
+		facility string
+		want     string
+		wantErr  bool
+	}{
+		{name: "facility of a metro", facility: "sjc1", want: "sv"},
+		{name: "facility outside of the metros", facility: "old1", wantErr: true},
+		{name: "unknown facility", facility: "xyz1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/facilities", fakeResponse{status: http.StatusOK, body: testFacilities})
+
+			metro, err := c.FacilityMetro(tt.facility)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(metro).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/capacity", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"capacity": map[string]interface{}{
+		"ewr1": map[string]interface{}{"c3.small.x86": map[string]string{"level": "limited"}},
+	}}})
+
+	report, err := c.CapacityReport()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(report["ewr1"]["c3.small.x86"].Level).To(Equal("limited"))
+}
+
+func TestFacilityMetros(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/facilities", fakeResponse{status: http.StatusOK, body: testFacilities})
+
+	metros, err := c.FacilityMetros()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(metros).To(Equal(map[string]string{"ewr1": "ny", "ny5": "ny", "sjc1": "sv"}))
+}
+
+func TestCandidateFacilities(t *testing.T) {
+	metros := map[string]string{"ewr1": "ny", "ny5": "ny", "sjc1": "sv"}
+
+	tests := []struct {
+		name    string
+		machine infrastructurev1alpha3.PacketMachineSpec
+		cluster infrastructurev1alpha3.PacketClusterSpec
+		want    map[string]bool
+	}{
+		{
+			name:    "facilities of the machine",
+			machine: infrastructurev1alpha3.PacketMachineSpec{Facility: "sjc1", Facilities: []string{"ewr1", "ny5"}},
+			want:    map[string]bool{"ewr1": true, "ny5": true},
+		},
+		{
+			name:    "facility of the machine",
+			machine: infrastructurev1alpha3.PacketMachineSpec{Facility: "sjc1"},
+			cluster: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1"},
+			want:    map[string]bool{"sjc1": true},
+		},
+		{
+			name:    "facility of the cluster",
+			cluster: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1"},
+			want:    map[string]bool{"ewr1": true},
+		},
+		{
+			name:    "metro of the cluster",
+			cluster: infrastructurev1alpha3.PacketClusterSpec{Metro: "ny"},
+			want:    map[string]bool{"ewr1": true, "ny5": true},
+		},
+		{
+			name:    "any facility",
+			machine: infrastructurev1alpha3.PacketMachineSpec{Facility: infrastructurev1alpha3.FacilityAny},
+			cluster: infrastructurev1alpha3.PacketClusterSpec{Metro: "ny"},
+		},
+		{
+			name:    "any facility of the metro of the control plane ip",
+			machine: infrastructurev1alpha3.PacketMachineSpec{Facility: infrastructurev1alpha3.FacilityAny},
+			cluster: infrastructurev1alpha3.PacketClusterSpec{Metro: "sv", IPReservationScope: infrastructurev1alpha3.IPReservationScopeMetro},
+			want:    map[string]bool{"sjc1": true},
+		},
+		{
+			name: "no location",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(CandidateFacilities(tt.machine, tt.cluster, metros)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestPlanCapacity(t *testing.T) {
+	g := NewWithT(t)
+
+	report := packngo.CapacityReport{
+		"ewr1": {"c3.small.x86": {Level: "limited"}},
+		"ny5":  {"c3.small.x86": {Level: "unavailable"}},
+		"sjc1": {"c3.small.x86": {Level: "normal"}},
+	}
+
+	g.Expect(PlanCapacity(report, "c3.small.x86", nil)).To(Equal("normal"))
+	g.Expect(PlanCapacity(report, "c3.small.x86", map[string]bool{"ewr1": true, "ny5": true})).To(Equal("limited"))
+	g.Expect(PlanCapacity(report, "c3.small.x86", map[string]bool{"ny5": true})).To(Equal("unavailable"))
+	g.Expect(PlanCapacity(report, "m3.large.x86", nil)).To(Equal("unavailable"))
+}
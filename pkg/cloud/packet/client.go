@@ -17,19 +17,17 @@ limitations under the License.
 package packet
 
 import (
+	"context"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/packethost/packngo"
 	"github.com/pkg/errors"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/utils/pointer"
-	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
-	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/tracing"
 )
 
 const (
@@ -41,18 +39,79 @@ const (
 var (
 	ErrControlPlanEndpointNotFound = errors.New("control plane not found")
 	ErrInvalidRequest              = errors.New("invalid request")
+	ErrNoCapacity                  = errors.New("no capacity")
+	ErrIPOwnedByAnotherCluster     = errors.New("ip owned by another cluster")
+	ErrIPAssignmentPending         = errors.New("ip assignment pending")
+	ErrReservationsClaimed         = errors.New("hardware reservations claimed by other machines")
+	ErrReservationsDeprovisioning  = errors.New("hardware reservations still deprovisioning")
+	ErrDeviceNotManaged            = errors.New("device not managed by the cluster")
 )
 
+// Client is the Packet API the reconcilers work with.
+type Client interface {
+	DeviceService
+	IPService
+	TagService
+	CapacityService
+	CompatibilityService
+	ImageService
+	WarmPoolService
+	BGPService
+	ProjectService
+	ReservationService
+	InterconnectionService
+	VRFService
+	LedgerService
+	NodeKeyService
+	ProjectSettingsService
+	ProjectResourcesService
+
+	Tracer
+
+	// Token returns the API key the client authenticates with, empty when
+	// it authenticates with OAuth access tokens.
+	Token() string
+}
+
+// Tracer makes the copies of a client whose API calls are traced.
+type Tracer interface {
+	// WithContext returns a client whose API calls are traced as children of
+	// the span of ctx.
+	WithContext(ctx context.Context) Client
+}
+
 type PacketClient struct {
 	*packngo.Client
+
+	// ctx is the context the API calls are traced under, see WithContext.
+	ctx context.Context
+	// headers are added to every API request, see WithHeaders.
+	headers http.Header
+	// transport is the transport of the credential, shared with the copies
+	// of the client. Nil is http.DefaultTransport.
+	transport http.RoundTripper
+	// timeout bounds the API requests of the client and its copies, 0 does
+	// not.
+	timeout time.Duration
+	// rate is the rate limit state of the credential, set for the clients of
+	// a ClientPool.
+	rate *APIRate
+	// devices caches the active devices of the credential, set for the
+	// clients of a ClientPool.
+	devices *deviceCache
 }
 
+// reservedHeaders are set by packngo and can not be overridden.
+var reservedHeaders = []string{"X-Auth-Token", "X-Consumer-Token", "Content-Type", "Accept"}
+
+var _ Client = &PacketClient{}
+
 // NewClient creates a new Client for the given Packet credentials
 func NewClient(packetAPIKey string) *PacketClient {
 	token := strings.TrimSpace(packetAPIKey)
 
 	if token != "" {
-		return &PacketClient{packngo.NewClientWithAuth(clientName, token, nil)}
+		return &PacketClient{Client: packngo.NewClientWithAuth(clientName, token, nil)}
 	}
 
 	return nil
@@ -66,182 +125,107 @@ func GetClient() (*PacketClient, error) {
 	return NewClient(token), nil
 }
 
-func (p *PacketClient) GetDevice(deviceID string) (*packngo.Device, error) {
-	dev, _, err := p.Client.Devices.Get(deviceID, nil)
-	return dev, err
-}
-
-type CreateDeviceRequest struct {
-	ExtraTags            []string
-	MachineScope         *scope.MachineScope
-	ControlPlaneEndpoint string
-}
-
-func (p *PacketClient) NewDevice(req CreateDeviceRequest) (*packngo.Device, error) {
-	if req.MachineScope.PacketMachine.Spec.IPXEUrl != "" {
-		// Error if pxe url and OS conflict
-		if req.MachineScope.PacketMachine.Spec.OS != ipxeOS {
-			return nil, fmt.Errorf("os should be set to custom_pxe when using pxe urls: %w", ErrInvalidRequest)
-		}
-	}
-
-	userDataRaw, err := req.MachineScope.GetRawBootstrapData()
-	if err != nil {
-		return nil, errors.Wrap(err, "impossible to retrieve bootstrap data from secret")
+// WithContext returns a client whose API calls are traced as children of
+// the span of ctx. It returns the client itself when tracing is disabled.
+func (p *PacketClient) WithContext(ctx context.Context) Client {
+	if p == nil {
+		return nil
 	}
-
-	stringWriter := &strings.Builder{}
-	userData := string(userDataRaw)
-	userDataValues := map[string]interface{}{
-		"kubernetesVersion": pointer.StringPtrDerefOr(req.MachineScope.Machine.Spec.Version, ""),
+	if !tracing.Enabled() {
+		return p
 	}
-
-	tags := append(req.MachineScope.PacketMachine.Spec.Tags, req.ExtraTags...)
-
-	tmpl, err := template.New("user-data").Parse(userData)
+	c, err := p.withTransport(ctx, p.headers)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing userdata template: %v", err)
+		return p
 	}
+	return c
+}
 
-	if req.MachineScope.IsControlPlane() {
-		// control plane machines should get the API key injected
-		userDataValues["apiKey"] = p.Client.APIKey
-
-		if req.ControlPlaneEndpoint != "" {
-			userDataValues["controlPlaneEndpoint"] = req.ControlPlaneEndpoint
+// WithHeaders returns a client adding headers to every API request, e.g. for
+// the gateways fronting the API. The headers packngo sets can not be
+// overridden.
+func (p *PacketClient) WithHeaders(headers http.Header) (*PacketClient, error) {
+	for _, name := range reservedHeaders {
+		if _, ok := headers[http.CanonicalHeaderKey(name)]; ok {
+			return nil, fmt.Errorf("header %s is set by the client and can not be overridden", name)
 		}
-
-		tags = append(tags, infrastructurev1alpha3.ControlPlaneTag)
-	} else {
-		tags = append(tags, infrastructurev1alpha3.WorkerTag)
-	}
-
-	if err := tmpl.Execute(stringWriter, userDataValues); err != nil {
-		return nil, fmt.Errorf("error executing userdata template: %v", err)
 	}
+	return p.withTransport(p.ctx, headers)
+}
 
-	userData = stringWriter.String()
-
-	// Allow to override the facility for each PacketMachineTemplate
-	var facility = req.MachineScope.PacketCluster.Spec.Facility
-	if req.MachineScope.PacketMachine.Spec.Facility != "" {
-		facility = req.MachineScope.PacketMachine.Spec.Facility
+// withTransport returns a copy of the client sending its requests through a
+// transport adding headers, and tracing them under ctx when it is set.
+func (p *PacketClient) withTransport(ctx context.Context, headers http.Header) (*PacketClient, error) {
+	transport := p.transport
+	if transport == nil {
+		transport = http.DefaultTransport
 	}
-
-	serverCreateOpts := &packngo.DeviceCreateRequest{
-		Hostname:      req.MachineScope.Name(),
-		ProjectID:     req.MachineScope.PacketCluster.Spec.ProjectID,
-		Facility:      []string{facility},
-		BillingCycle:  req.MachineScope.PacketMachine.Spec.BillingCycle,
-		Plan:          req.MachineScope.PacketMachine.Spec.MachineType,
-		OS:            req.MachineScope.PacketMachine.Spec.OS,
-		IPXEScriptURL: req.MachineScope.PacketMachine.Spec.IPXEUrl,
-		Tags:          tags,
-		UserData:      userData,
+	if len(headers) > 0 {
+		transport = &headerTransport{base: transport, headers: headers}
 	}
-
-	reservationIDs := strings.Split(req.MachineScope.PacketMachine.Spec.HardwareReservationID, ",")
-
-	// If there are no reservationIDs to process, go ahead and return early
-	if len(reservationIDs) == 0 {
-		dev, _, err := p.Client.Devices.Create(serverCreateOpts)
-		return dev, err
+	if ctx != nil {
+		transport = tracing.NewTransport(ctx, transport)
 	}
-
-	// Do a naive loop through the list of reservationIDs, continuing if we hit any error
-	// TODO: if we can determine how to differentiate a failure based on the reservation
-	// being in use vs other errors, then we can make this a bit smarter in the future.
-	var lastErr error
-
-	for _, resID := range reservationIDs {
-		serverCreateOpts.HardwareReservationID = resID
-		dev, _, err := p.Client.Devices.Create(serverCreateOpts)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		return dev, nil
+	c, err := packngo.NewClientWithBaseURL(p.ConsumerToken, p.APIKey, &http.Client{Transport: transport, Timeout: p.timeout}, p.BaseURL.String())
+	if err != nil {
+		return nil, err
 	}
-
-	return nil, lastErr
+	return &PacketClient{Client: c, ctx: ctx, headers: headers, transport: p.transport, timeout: p.timeout, rate: p.rate, devices: p.devices}, nil
 }
 
-func (p *PacketClient) GetDeviceAddresses(device *packngo.Device) ([]corev1.NodeAddress, error) {
-	addrs := make([]corev1.NodeAddress, 0)
-	for _, addr := range device.Network {
-		addrType := corev1.NodeInternalIP
-		if addr.IpAddressCommon.Public {
-			addrType = corev1.NodeExternalIP
+// ParseHeaders parses headers given as "Name: value" or "Name=value".
+func ParseHeaders(values []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, value := range values {
+		i := strings.IndexAny(value, ":=")
+		if i <= 0 {
+			return nil, fmt.Errorf("header %q is not of the form Name: value", value)
 		}
-		a := corev1.NodeAddress{
-			Type:    addrType,
-			Address: addr.Address,
+		name := strings.TrimSpace(value[:i])
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("header name %q is invalid", name)
 		}
-		addrs = append(addrs, a)
+		headers.Add(name, strings.TrimSpace(value[i+1:]))
 	}
-	return addrs, nil
+	return headers, nil
 }
 
-func (p *PacketClient) GetDeviceByTags(project string, tags []string) (*packngo.Device, error) {
-	devices, _, err := p.Devices.List(project, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error retrieving devices: %v", err)
-	}
-	// returns the first one that matches all of the tags
-	for _, device := range devices {
-		if ItemsInList(device.Tags, tags) {
-			return &device, nil
-		}
-	}
-	return nil, nil
+// headerTransport adds headers to the requests it sends.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
 }
 
-// CreateIP reserves an IP via Packet API. The request fails straight if no IP are available for the specified project.
-// This prevent the cluster to become ready.
-func (p *PacketClient) CreateIP(namespace, clusterName, projectID, facility string) (net.IP, error) {
-	req := packngo.IPReservationRequest{
-		Type:                   packngo.PublicIPv4,
-		Quantity:               1,
-		Facility:               &facility,
-		FailOnApprovalRequired: true,
-		Tags:                   []string{generateElasticIPIdentifier(clusterName)},
-	}
-
-	r, resp, err := p.ProjectIPs.Request(projectID, &req)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == http.StatusUnprocessableEntity {
-		return nil, fmt.Errorf("Could not create an Elastic IP due to quota limits on the account. Please contact Packet support.")
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
 	}
+	return t.base.RoundTrip(req)
+}
 
-	ip := net.ParseIP(r.Address)
-	if ip == nil {
-		return nil, fmt.Errorf("impossible to parse IP: %s. IP not valid.", r.Address)
+// context returns the context the API calls are traced under.
+func (p *PacketClient) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
 	}
-	return ip, nil
+	return p.ctx
 }
 
-func (p *PacketClient) GetIPByClusterIdentifier(namespace, name, projectID string) (packngo.IPAddressReservation, error) {
-	var err error
-	var reservedIP packngo.IPAddressReservation
-
-	listOpts := &packngo.ListOptions{}
-	reservedIPs, _, err := p.ProjectIPs.List(projectID, listOpts)
-	if err != nil {
-		return reservedIP, err
-	}
-	for _, reservedIP := range reservedIPs {
-		for _, v := range reservedIP.Tags {
-			if v == generateElasticIPIdentifier(name) {
-				return reservedIP, nil
-			}
-		}
-	}
-	return reservedIP, ErrControlPlanEndpointNotFound
+// Token returns the API key the client authenticates with, empty when it
+// authenticates with OAuth access tokens.
+func (p *PacketClient) Token() string {
+	return p.APIKey
 }
 
-func generateElasticIPIdentifier(name string) string {
-	return fmt.Sprintf("cluster-api-provider-packet:cluster-id:%s", name)
+// credential returns the short digest identifying the credential of the
+// client, safe to log and to use as a metric label.
+func (p *PacketClient) credential() string {
+	if p.rate != nil {
+		return p.rate.credential
+	}
+	return credentialID(p.APIKey)
 }
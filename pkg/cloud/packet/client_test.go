@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWithContext(t *testing.T) {
+	g := NewWithT(t)
+
+	var nilClient *PacketClient
+	g.Expect(nilClient.WithContext(context.Background())).To(BeNil())
+
+	c := NewClient("token")
+	g.Expect(c.Token()).To(Equal("token"))
+	g.Expect(c.context()).To(Equal(context.Background()))
+
+	traced := c.WithContext(context.TODO())
+	g.Expect(traced.Token()).To(Equal("token"))
+}
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    http.Header
+		wantErr bool
+	}{
+		{
+			name:   "colon and equal separators",
+			values: []string{"Authorization: Bearer abc==", "x-gateway-tenant=capi"},
+			want:   http.Header{"Authorization": {"Bearer abc=="}, "X-Gateway-Tenant": {"capi"}},
+		},
+		{
+			name:   "repeated header",
+			values: []string{"X-Route: a", "X-Route: b"},
+			want:   http.Header{"X-Route": {"a", "b"}},
+		},
+		{
+			name:   "empty value",
+			values: []string{"X-Debug:"},
+			want:   http.Header{"X-Debug": {""}},
+		},
+		{name: "no separator", values: []string{"X-Debug"}, wantErr: true},
+		{name: "no name", values: []string{": value"}, wantErr: true},
+		{name: "space in the name", values: []string{"X Debug: 1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			headers, err := ParseHeaders(tt.values)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(headers).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/devices/device", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "device"}})
+
+	withHeaders, err := c.WithHeaders(http.Header{"Authorization": {"Bearer gateway"}, "X-Request-Source": {"capp"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(withHeaders.Token()).To(Equal(c.Token()))
+
+	_, err = withHeaders.GetDevice("device")
+	g.Expect(err).NotTo(HaveOccurred())
+	requests := api.requestsTo("GET", "/devices/device")
+	g.Expect(requests).To(HaveLen(1))
+	g.Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer gateway"))
+	g.Expect(requests[0].Header.Get("X-Request-Source")).To(Equal("capp"))
+	g.Expect(requests[0].Header.Get("X-Auth-Token")).To(Equal("token"))
+
+	_, err = c.WithHeaders(http.Header{"X-Auth-Token": {"other"}})
+	g.Expect(err).To(HaveOccurred())
+}
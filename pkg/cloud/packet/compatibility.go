@@ -0,0 +1,327 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// CompatibilityService tells which devices Packet can create.
+type CompatibilityService interface {
+	CompatibilityMatrix(projectIDs []string) (*CompatibilityMatrix, error)
+}
+
+// CompatibilityMatrix tells which operating systems can be provisioned on
+// which plans, and where the plans are available.
+type CompatibilityMatrix struct {
+	plans map[string]planAvailability
+	// operatingSystems holds the plans each operating system can be
+	// provisioned on.
+	operatingSystems map[string]map[string]bool
+}
+
+// planAvailability holds the facilities and the metros a plan is available
+// in. Both are empty when Packet does not tell. It also holds the cores, the
+// GPUs and the hourly price of the plan, 0 when unknown.
+type planAvailability struct {
+	facilities  map[string]bool
+	metros      map[string]bool
+	cores       int
+	gpus        PlanGPUs
+	hourlyPrice float64
+}
+
+// PlanGPUs are the GPUs of a plan.
+type PlanGPUs struct {
+	// Model is the model of the GPUs, the models joined with commas for
+	// the plans mixing several.
+	Model string
+	Count int
+}
+
+// gpuPlan is a plan as Packet lists it, with the GPUs of its specs packngo
+// does not decode.
+type gpuPlan struct {
+	packngo.Plan
+	Specs *gpuPlanSpecs `json:"specs,omitempty"`
+}
+
+type gpuPlanSpecs struct {
+	packngo.Specs
+	GPU []struct {
+		Count int    `json:"count,omitempty"`
+		Type  string `json:"type,omitempty"`
+	} `json:"gpu,omitempty"`
+}
+
+// gpus returns the GPUs of the specs.
+func (s *gpuPlanSpecs) gpus() PlanGPUs {
+	gpus := PlanGPUs{}
+	if s == nil {
+		return gpus
+	}
+	models := []string{}
+	for _, gpu := range s.GPU {
+		gpus.Count += gpu.Count
+		if gpu.Type != "" {
+			models = append(models, gpu.Type)
+		}
+	}
+	gpus.Model = strings.Join(models, ",")
+	return gpus
+}
+
+// CompatibilityMatrix returns the compatibility matrix of the plans and
+// operating systems Packet currently offers, including the custom and
+// reserved plans of projectIDs. The projects that no longer exist are
+// skipped.
+func (p *PacketClient) CompatibilityMatrix(projectIDs []string) (*CompatibilityMatrix, error) {
+	list, err := p.listGPUPlans("/plans")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+	for _, projectID := range projectIDs {
+		projectPlans, err := p.listGPUPlans(path.Join("/projects", projectID, "plans"))
+		if err != nil {
+			if packeterrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list the plans of project %s: %w", projectID, err)
+		}
+		list = append(list, projectPlans...)
+	}
+
+	plans := make([]packngo.Plan, 0, len(list))
+	gpus := make(map[string]PlanGPUs, len(list))
+	for _, plan := range list {
+		// the plans offered to every project are listed again for each
+		if _, ok := gpus[plan.Slug]; ok {
+			continue
+		}
+		if plan.Specs != nil {
+			plan.Plan.Specs = &plan.Specs.Specs
+		}
+		plans = append(plans, plan.Plan)
+		gpus[plan.Slug] = plan.Specs.gpus()
+	}
+	operatingSystems, _, err := p.OperatingSystems.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operating systems: %w", packeterrors.Wrap(err))
+	}
+	m := NewCompatibilityMatrix(plans, operatingSystems)
+	for slug, planGPUs := range gpus {
+		availability := m.plans[slug]
+		availability.gpus = planGPUs
+		m.plans[slug] = availability
+	}
+	return m, nil
+}
+
+// listGPUPlans lists the plans of apiPath with their availability. They are
+// listed directly for their GPUs, which packngo does not decode.
+func (p *PacketClient) listGPUPlans(apiPath string) ([]gpuPlan, error) {
+	list := struct {
+		Plans []gpuPlan `json:"plans"`
+	}{}
+	apiPath = (&packngo.ListOptions{Includes: []string{"available_in", "available_in_metros"}}).WithQuery(apiPath)
+	if _, err := p.DoRequest(http.MethodGet, apiPath, nil, &list); err != nil {
+		return nil, packeterrors.Wrap(err)
+	}
+	return list.Plans, nil
+}
+
+// NewCompatibilityMatrix returns the compatibility matrix of plans and
+// operatingSystems.
+func NewCompatibilityMatrix(plans []packngo.Plan, operatingSystems []packngo.OS) *CompatibilityMatrix {
+	m := &CompatibilityMatrix{
+		plans:            make(map[string]planAvailability, len(plans)),
+		operatingSystems: make(map[string]map[string]bool, len(operatingSystems)),
+	}
+	for _, plan := range plans {
+		availability := planAvailability{facilities: map[string]bool{}, metros: map[string]bool{}}
+		for _, f := range plan.AvailableIn {
+			availability.facilities[strings.ToLower(f.Code)] = true
+		}
+		for _, metro := range plan.AvailableInMetros {
+			availability.metros[strings.ToLower(metro.Code)] = true
+		}
+		if plan.Specs != nil {
+			availability.cores = planCores(plan.Specs.Cpus)
+		}
+		if plan.Pricing != nil {
+			availability.hourlyPrice = float64(plan.Pricing.Hour)
+		}
+		m.plans[plan.Slug] = availability
+	}
+	for _, os := range operatingSystems {
+		provisionableOn := make(map[string]bool, len(os.ProvisionableOn))
+		for _, plan := range os.ProvisionableOn {
+			provisionableOn[plan] = true
+		}
+		m.operatingSystems[os.Slug] = provisionableOn
+	}
+	return m
+}
+
+// coresPerCPU matches the cores of a CPU in the type Packet reports for it,
+// e.g. "Intel Xeon E-2278G 8-Core Processor @ 3.40GHz".
+var coresPerCPU = regexp.MustCompile(`(\d+)-Core`)
+
+// planCores returns the cores of the CPUs of a plan: the count Packet reports
+// is the number of sockets, each with the cores its type tells. It returns 0
+// when the type of a CPU does not tell its cores.
+func planCores(cpus []*packngo.Cpus) int {
+	cores := 0
+	for _, cpu := range cpus {
+		if cpu == nil {
+			continue
+		}
+		match := coresPerCPU.FindStringSubmatch(cpu.Type)
+		if match == nil {
+			return 0
+		}
+		perCPU, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0
+		}
+		cores += cpu.Count * perCPU
+	}
+	return cores
+}
+
+// PlanCores returns the cores of plan, false when the plan does not exist or
+// Packet does not tell its cores.
+func (m *CompatibilityMatrix) PlanCores(plan string) (int, bool) {
+	availability, ok := m.plans[plan]
+	return availability.cores, ok && availability.cores > 0
+}
+
+// PlanGPUs returns the GPUs Packet reports for plan, false when the plan does
+// not exist.
+func (m *CompatibilityMatrix) PlanGPUs(plan string) (PlanGPUs, bool) {
+	availability, ok := m.plans[plan]
+	return availability.gpus, ok
+}
+
+// PlanHourlyPrice returns the hourly price Packet reports for plan, false when
+// it is not known. The matrix can be nil.
+func (m *CompatibilityMatrix) PlanHourlyPrice(plan string) (float64, bool) {
+	if m == nil {
+		return 0, false
+	}
+	availability, ok := m.plans[plan]
+	return availability.hourlyPrice, ok && availability.hourlyPrice > 0
+}
+
+// CheckGPU returns an ErrInvalidRequest when plan does not have the GPUs gpu
+// asks for. Plans that do not exist are left to Check.
+func (m *CompatibilityMatrix) CheckGPU(plan string, gpu *infrastructurev1alpha3.GPUSpec) error {
+	availability, ok := m.plans[plan]
+	if !ok || gpu == nil {
+		return nil
+	}
+	count := int(gpu.Count)
+	if count == 0 {
+		count = 1
+	}
+	if availability.gpus.Count < count {
+		return fmt.Errorf("machine type %s has %d GPUs, %d are required: %w", plan, availability.gpus.Count, count, ErrInvalidRequest)
+	}
+	if gpu.Model != "" && !strings.Contains(strings.ToLower(availability.gpus.Model), strings.ToLower(gpu.Model)) {
+		return fmt.Errorf("machine type %s has %s GPUs, not %s: %w", plan, availability.gpus.Model, gpu.Model, ErrInvalidRequest)
+	}
+	return nil
+}
+
+// CheckBudget returns an ErrInvalidRequest when a device of plan costs more
+// per hour than budget. Plans without a known price are within any budget.
+func (m *CompatibilityMatrix) CheckBudget(plan string, budget float64) error {
+	availability, ok := m.plans[plan]
+	if !ok || availability.hourlyPrice == 0 || availability.hourlyPrice <= budget {
+		return nil
+	}
+	return fmt.Errorf("machine type %s costs %.2f per hour, over the budget of %.2f: %w", plan, availability.hourlyPrice, budget, ErrInvalidRequest)
+}
+
+// Check returns an ErrInvalidRequest telling why a device of plan running os
+// can not be created in any of facilities, or in metro. Without facilities and
+// metro, only the plan and the operating system are checked.
+func (m *CompatibilityMatrix) Check(plan, os string, facilities []string, metro string) error {
+	availability, ok := m.plans[plan]
+	if !ok {
+		return fmt.Errorf("machine type %s does not exist: %w", plan, ErrInvalidRequest)
+	}
+	provisionableOn, ok := m.operatingSystems[os]
+	if !ok {
+		return fmt.Errorf("operating system %s does not exist: %w", os, ErrInvalidRequest)
+	}
+	if !provisionableOn[plan] {
+		return fmt.Errorf("operating system %s can not be provisioned on machine type %s: %w", os, plan, ErrInvalidRequest)
+	}
+
+	for _, facility := range facilities {
+		if facility == "" || facility == infrastructurev1alpha3.FacilityAny || len(availability.facilities) == 0 {
+			continue
+		}
+		if !availability.facilities[strings.ToLower(facility)] {
+			return fmt.Errorf("machine type %s is not available in facility %s: %w", plan, facility, ErrInvalidRequest)
+		}
+	}
+	if metro != "" && len(availability.metros) > 0 && !availability.metros[strings.ToLower(metro)] {
+		return fmt.Errorf("machine type %s is not available in metro %s: %w", plan, metro, ErrInvalidRequest)
+	}
+	return nil
+}
+
+// CheckMachine checks the machine type, operating system and location of a
+// PacketMachine. A non empty facility, the one the device is created in,
+// replaces the facilities of the spec; metro, the one of the cluster, only
+// applies when there are none. Adopted devices already exist and are not
+// checked, the location of hardware reservations is not either. Machines
+// provisioned from an image are checked with the image. The GPUs of the plan
+// are checked when the machine asks for some.
+func (m *CompatibilityMatrix) CheckMachine(spec infrastructurev1alpha3.PacketMachineSpec, facility, metro string) error {
+	if spec.Device != nil {
+		return nil
+	}
+	facilities := spec.Facilities
+	if facility != "" {
+		facilities = []string{facility}
+	} else if spec.Facility != "" {
+		facilities = []string{spec.Facility}
+	}
+	if len(facilities) > 0 || spec.HardwareReservationID != "" {
+		metro = ""
+	}
+	if spec.HardwareReservationID != "" {
+		facilities = nil
+	}
+	if err := m.Check(spec.MachineType, DeviceOS(spec), facilities, metro); err != nil {
+		return err
+	}
+	return m.CheckGPU(spec.MachineType, spec.GPU)
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func newTestCompatibilityMatrix(t *testing.T) *CompatibilityMatrix {
+	api, c := newFakeAPI(t)
+	api.on("GET", "/plans", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"plans": []map[string]interface{}{
+		{
+			"slug":                "c3.small.x86",
+			"available_in":        []map[string]string{{"code": "ewr1"}, {"code": "sjc1"}},
+			"available_in_metros": []map[string]string{{"code": "ny"}, {"code": "sv"}},
+			"specs":               map[string]interface{}{"cpus": []map[string]interface{}{{"count": 1, "type": "Intel Xeon E-2278G 8-Core Processor @ 3.40GHz"}}},
+			"pricing":             map[string]float64{"hour": 0.5},
+		},
+		{
+			"slug":                "m3.large.arm64",
+			"available_in":        []map[string]string{{"code": "da11"}},
+			"available_in_metros": []map[string]string{{"code": "da"}},
+		},
+		{"slug": "t1.small.x86"},
+		{
+			"slug": "g2.large.x86",
+			"specs": map[string]interface{}{
+				"cpus": []map[string]interface{}{{"count": 2, "type": "AMD EPYC 7402P 24-Core Processor @ 2.8GHz"}},
+				"gpu":  []map[string]interface{}{{"count": 2, "type": "NVIDIA A100 PCIE 40GB"}},
+			},
+		},
+	}}})
+	api.on("GET", "/operating-systems", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"operating_systems": []map[string]interface{}{
+		{"slug": "ubuntu_20_04", "provisionable_on": []string{"c3.small.x86", "m3.large.arm64", "t1.small.x86", "g2.large.x86"}},
+		{"slug": "flatcar_stable", "provisionable_on": []string{"c3.small.x86"}},
+	}}})
+
+	matrix, err := c.CompatibilityMatrix(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matrix
+}
+
+func TestCompatibilityMatrixCheckMachine(t *testing.T) {
+	matrix := newTestCompatibilityMatrix(t)
+
+	tests := []struct {
+		name     string
+		spec     infrastructurev1alpha3.PacketMachineSpec
+		facility string
+		metro    string
+		wantErr  string
+	}{
+		{
+			name:     "compatible",
+			spec:     infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", OS: "flatcar_stable"},
+			facility: "EWR1",
+		},
+		{
+			name:    "unknown machine type",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "c9.huge.x86", OS: "ubuntu_20_04"},
+			wantErr: "machine type c9.huge.x86 does not exist",
+		},
+		{
+			name:    "unknown operating system",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", OS: "windows_95"},
+			wantErr: "operating system windows_95 does not exist",
+		},
+		{
+			name:    "operating system not provisionable on the machine type",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "m3.large.arm64", OS: "flatcar_stable"},
+			wantErr: "operating system flatcar_stable can not be provisioned on machine type m3.large.arm64",
+		},
+		{
+			name:    "machine type not available in the facility",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "m3.large.arm64", OS: "ubuntu_20_04", Facility: "ewr1"},
+			wantErr: "machine type m3.large.arm64 is not available in facility ewr1",
+		},
+		{
+			name:    "one of the facilities does not have the machine type",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", OS: "ubuntu_20_04", Facilities: []string{"sjc1", "da11"}},
+			wantErr: "machine type c3.small.x86 is not available in facility da11",
+		},
+		{
+			name:     "the facility the device is created in replaces the spec ones",
+			spec:     infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", OS: "ubuntu_20_04", Facilities: []string{"sjc1", "da11"}},
+			facility: "sjc1",
+		},
+		{
+			name:  "any facility",
+			spec:  infrastructurev1alpha3.PacketMachineSpec{MachineType: "m3.large.arm64", OS: "ubuntu_20_04", Facility: infrastructurev1alpha3.FacilityAny},
+			metro: "ny",
+		},
+		{
+			name:    "machine type not available in the metro",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "m3.large.arm64", OS: "ubuntu_20_04"},
+			metro:   "ny",
+			wantErr: "machine type m3.large.arm64 is not available in metro ny",
+		},
+		{
+			name:  "location of hardware reservations is not checked",
+			spec:  infrastructurev1alpha3.PacketMachineSpec{MachineType: "m3.large.arm64", OS: "ubuntu_20_04", Facility: "ewr1", HardwareReservationID: "next-available"},
+			metro: "ny",
+		},
+		{
+			name:  "availability not reported",
+			spec:  infrastructurev1alpha3.PacketMachineSpec{MachineType: "t1.small.x86", OS: "ubuntu_20_04", Facility: "ewr1"},
+			metro: "ny",
+		},
+		{
+			name: "gpu plan",
+			spec: infrastructurev1alpha3.PacketMachineSpec{MachineType: "g2.large.x86", OS: "ubuntu_20_04", GPU: &infrastructurev1alpha3.GPUSpec{Count: 2, Model: "a100"}},
+		},
+		{
+			name:    "plan without gpus",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", OS: "ubuntu_20_04", GPU: &infrastructurev1alpha3.GPUSpec{}},
+			wantErr: "machine type c3.small.x86 has 0 GPUs, 1 are required",
+		},
+		{
+			name:    "plan with fewer gpus",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "g2.large.x86", OS: "ubuntu_20_04", GPU: &infrastructurev1alpha3.GPUSpec{Count: 4}},
+			wantErr: "machine type g2.large.x86 has 2 GPUs, 4 are required",
+		},
+		{
+			name:    "plan with other gpus",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "g2.large.x86", OS: "ubuntu_20_04", GPU: &infrastructurev1alpha3.GPUSpec{Model: "H100"}},
+			wantErr: "machine type g2.large.x86 has NVIDIA A100 PCIE 40GB GPUs, not H100",
+		},
+		{
+			name: "adopted device",
+			spec: infrastructurev1alpha3.PacketMachineSpec{MachineType: "c9.huge.x86", OS: "windows_95", Device: &infrastructurev1alpha3.DeviceReference{ID: "device"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := matrix.CheckMachine(tt.spec, tt.facility, tt.metro)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestCompatibilityMatrixPlanCores(t *testing.T) {
+	g := NewWithT(t)
+	matrix := newTestCompatibilityMatrix(t)
+
+	cores, ok := matrix.PlanCores("c3.small.x86")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(cores).To(Equal(8))
+	// the cores of plans without specs are not known
+	_, ok = matrix.PlanCores("t1.small.x86")
+	g.Expect(ok).To(BeFalse())
+	_, ok = matrix.PlanCores("n2.xlarge.x86")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestPlanCores(t *testing.T) {
+	tests := []struct {
+		name string
+		cpus []*packngo.Cpus
+		want int
+	}{
+		{
+			name: "one socket",
+			cpus: []*packngo.Cpus{{Count: 1, Type: "Intel Xeon E-2278G 8-Core Processor @ 3.40GHz"}},
+			want: 8,
+		},
+		{
+			name: "sockets are multiplied by their cores",
+			cpus: []*packngo.Cpus{{Count: 2, Type: "Intel Xeon Gold 6338 32-Core Processor @ 2.00GHz"}},
+			want: 64,
+		},
+		{
+			name: "type without cores",
+			cpus: []*packngo.Cpus{{Count: 2, Type: "Intel Xeon E5-2640 v3"}},
+			want: 0,
+		},
+		{
+			name: "no cpu",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(planCores(tt.cpus)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestCompatibilityMatrixPlanGPUs(t *testing.T) {
+	g := NewWithT(t)
+	matrix := newTestCompatibilityMatrix(t)
+
+	gpus, ok := matrix.PlanGPUs("g2.large.x86")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(gpus).To(Equal(PlanGPUs{Model: "NVIDIA A100 PCIE 40GB", Count: 2}))
+	// the specs packngo decodes are kept
+	cores, _ := matrix.PlanCores("g2.large.x86")
+	g.Expect(cores).To(Equal(48))
+	gpus, ok = matrix.PlanGPUs("c3.small.x86")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(gpus).To(BeZero())
+	_, ok = matrix.PlanGPUs("n2.xlarge.x86")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestCompatibilityMatrixFailure(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/plans", fakeResponse{status: http.StatusInternalServerError, body: apiError("Internal error")})
+
+	_, err := c.CompatibilityMatrix(nil)
+	g.Expect(err).To(MatchError(ContainSubstring("failed to list plans")))
+}
+
+func TestCompatibilityMatrixProjectPlans(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/plans", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"plans": []map[string]interface{}{
+		{"slug": "c3.small.x86", "available_in_metros": []map[string]string{{"code": "ny"}}},
+	}}})
+	api.on("GET", "/projects/p1/plans", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"plans": []map[string]interface{}{
+		{"slug": "c3.small.x86", "available_in_metros": []map[string]string{{"code": "ny"}}},
+		{"slug": "custom.reserved.x86", "available_in_metros": []map[string]string{{"code": "da"}}},
+	}}}, fakeResponse{status: http.StatusInternalServerError, body: apiError("Internal error")})
+	api.on("GET", "/projects/gone/plans", fakeResponse{status: http.StatusNotFound, body: apiError("Not found")})
+	api.on("GET", "/operating-systems", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"operating_systems": []map[string]interface{}{
+		{"slug": "ubuntu_20_04", "provisionable_on": []string{"c3.small.x86", "custom.reserved.x86"}},
+	}}})
+
+	matrix, err := c.CompatibilityMatrix([]string{"p1", "gone"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(matrix.Check("custom.reserved.x86", "ubuntu_20_04", nil, "da")).To(Succeed())
+	g.Expect(matrix.Check("c3.small.x86", "ubuntu_20_04", nil, "ny")).To(Succeed())
+
+	_, err = c.CompatibilityMatrix([]string{"p1"})
+	g.Expect(err).To(MatchError(ContainSubstring("failed to list the plans of project p1")))
+}
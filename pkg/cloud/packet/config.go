@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of the controller ConfigMap. They are named after the flags whose
+// value they override.
+const (
+	ConfigBootstrapTokenTTL          = "bootstrap-token-ttl"
+	ConfigBootstrapCallbackTimeout   = "bootstrap-callback-timeout"
+	ConfigAutopsyTTL                 = "autopsy-ttl"
+	ConfigClusterDeletionConcurrency = "cluster-deletion-concurrency"
+	ConfigElasticIPGCInterval        = "eip-gc-interval"
+	ConfigElasticIPGCMinAge          = "eip-gc-min-age"
+	ConfigElasticIPGCDryRun          = "eip-gc-dry-run"
+	ConfigAllowedMachineTypes        = "allowed-machine-types"
+)
+
+// Config holds the settings of the controllers that can be changed while
+// they run, see ConfigStore.
+type Config struct {
+	// BootstrapTokenTTL is the lifetime of the bootstrap tokens generated by
+	// the bootstrap provider, zero disables the freshness check.
+	BootstrapTokenTTL time.Duration
+	// BootstrapCallbackTimeout is how long an active device has to call back.
+	BootstrapCallbackTimeout time.Duration
+	// AutopsyTTL is how long the autopsy of a machine is kept, zero disables
+	// the autopsies.
+	AutopsyTTL time.Duration
+	// ClusterDeletionConcurrency is how many devices are deleted in parallel
+	// when a cluster gets deleted.
+	ClusterDeletionConcurrency int
+	// ElasticIPGCInterval is the interval between two collections of the
+	// stale elastic ips, zero disables the collection.
+	ElasticIPGCInterval time.Duration
+	// ElasticIPGCMinAge is the minimum age of a collected reservation.
+	ElasticIPGCMinAge time.Duration
+	// ElasticIPGCDryRun only logs the reservations that would be released.
+	ElasticIPGCDryRun bool
+	// AllowedMachineTypes are the only machine types devices are created
+	// with. Any machine type is allowed when empty.
+	AllowedMachineTypes []string
+}
+
+// CheckMachineType returns an ErrInvalidRequest when devices can not be
+// created with machineType.
+func (c Config) CheckMachineType(machineType string) error {
+	if len(c.AllowedMachineTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range c.AllowedMachineTypes {
+		if strings.EqualFold(allowed, machineType) {
+			return nil
+		}
+	}
+	return fmt.Errorf("machine type %s is not allowed, allowed machine types are %s: %w",
+		machineType, strings.Join(c.AllowedMachineTypes, ", "), ErrInvalidRequest)
+}
+
+// ParseConfig returns defaults overridden by the keys of data, the data of
+// the controller ConfigMap. Unknown keys are rejected, they are most likely
+// typos.
+func ParseConfig(data map[string]string, defaults Config) (Config, error) {
+	config := defaults
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := strings.TrimSpace(data[key])
+		var err error
+		switch key {
+		case ConfigBootstrapTokenTTL:
+			config.BootstrapTokenTTL, err = parseDuration(value)
+		case ConfigBootstrapCallbackTimeout:
+			config.BootstrapCallbackTimeout, err = parseDuration(value)
+		case ConfigAutopsyTTL:
+			config.AutopsyTTL, err = parseDuration(value)
+		case ConfigClusterDeletionConcurrency:
+			config.ClusterDeletionConcurrency, err = strconv.Atoi(value)
+			if err == nil && config.ClusterDeletionConcurrency < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case ConfigElasticIPGCInterval:
+			config.ElasticIPGCInterval, err = parseDuration(value)
+		case ConfigElasticIPGCMinAge:
+			config.ElasticIPGCMinAge, err = parseDuration(value)
+		case ConfigElasticIPGCDryRun:
+			config.ElasticIPGCDryRun, err = strconv.ParseBool(value)
+		case ConfigAllowedMachineTypes:
+			config.AllowedMachineTypes = nil
+			for _, machineType := range strings.Split(value, ",") {
+				if machineType = strings.TrimSpace(machineType); machineType != "" {
+					config.AllowedMachineTypes = append(config.AllowedMachineTypes, machineType)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return defaults, fmt.Errorf("invalid %s %q: %w", key, value, err)
+		}
+	}
+	return config, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	return d, err
+}
+
+// ConfigStore holds the current settings of the controllers: the defaults set
+// by the flags, overridden by the controller ConfigMap while it exists.
+type ConfigStore struct {
+	defaults Config
+
+	mu     sync.RWMutex
+	config Config
+}
+
+// NewConfigStore returns a store holding defaults.
+func NewConfigStore(defaults Config) *ConfigStore {
+	return &ConfigStore{defaults: defaults, config: defaults}
+}
+
+// Get returns the current settings. A nil store holds the zero Config.
+func (s *ConfigStore) Get() Config {
+	if s == nil {
+		return Config{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Update replaces the current settings with the defaults overridden by data.
+// Invalid data leaves them unchanged. Nil data, when the ConfigMap is
+// deleted, restores the defaults.
+func (s *ConfigStore) Update(data map[string]string) error {
+	config, err := ParseConfig(data, s.defaults)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.config = config
+	s.mu.Unlock()
+	return nil
+}
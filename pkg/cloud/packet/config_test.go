@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseConfig(t *testing.T) {
+	defaults := Config{
+		BootstrapTokenTTL:          15 * time.Minute,
+		BootstrapCallbackTimeout:   30 * time.Minute,
+		ClusterDeletionConcurrency: 10,
+		ElasticIPGCMinAge:          time.Hour,
+		AllowedMachineTypes:        []string{"c3.small.x86"},
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "no data",
+			want: defaults,
+		},
+		{
+			name: "overrides",
+			data: map[string]string{
+				ConfigBootstrapTokenTTL:          "0",
+				ConfigBootstrapCallbackTimeout:   "1h",
+				ConfigAutopsyTTL:                 "24h",
+				ConfigClusterDeletionConcurrency: "20",
+				ConfigElasticIPGCInterval:        "10m",
+				ConfigElasticIPGCMinAge:          " 2h ",
+				ConfigElasticIPGCDryRun:          "true",
+				ConfigAllowedMachineTypes:        "c3.small.x86, m3.large.x86,",
+			},
+			want: Config{
+				BootstrapCallbackTimeout:   time.Hour,
+				AutopsyTTL:                 24 * time.Hour,
+				ClusterDeletionConcurrency: 20,
+				ElasticIPGCInterval:        10 * time.Minute,
+				ElasticIPGCMinAge:          2 * time.Hour,
+				ElasticIPGCDryRun:          true,
+				AllowedMachineTypes:        []string{"c3.small.x86", "m3.large.x86"},
+			},
+		},
+		{
+			name: "empty allowed machine types allow any",
+			data: map[string]string{ConfigAllowedMachineTypes: ""},
+			want: Config{
+				BootstrapTokenTTL:          15 * time.Minute,
+				BootstrapCallbackTimeout:   30 * time.Minute,
+				ClusterDeletionConcurrency: 10,
+				ElasticIPGCMinAge:          time.Hour,
+			},
+		},
+		{
+			name:    "invalid duration",
+			data:    map[string]string{ConfigAutopsyTTL: "a day"},
+			wantErr: `invalid autopsy-ttl "a day"`,
+		},
+		{
+			name:    "negative duration",
+			data:    map[string]string{ConfigElasticIPGCInterval: "-1m"},
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "negative concurrency",
+			data:    map[string]string{ConfigClusterDeletionConcurrency: "-1"},
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "unknown key",
+			data:    map[string]string{"bootstrap-token-tll": "1h"},
+			wantErr: "invalid bootstrap-token-tll",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			config, err := ParseConfig(tt.data, defaults)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				g.Expect(config).To(Equal(defaults))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(config).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestConfigStore(t *testing.T) {
+	g := NewWithT(t)
+	store := NewConfigStore(Config{ClusterDeletionConcurrency: 10})
+
+	g.Expect(store.Update(map[string]string{ConfigClusterDeletionConcurrency: "5"})).To(Succeed())
+	g.Expect(store.Get().ClusterDeletionConcurrency).To(Equal(5))
+
+	// invalid settings keep the current ones
+	g.Expect(store.Update(map[string]string{ConfigClusterDeletionConcurrency: "many"})).NotTo(Succeed())
+	g.Expect(store.Get().ClusterDeletionConcurrency).To(Equal(5))
+
+	// a deleted ConfigMap restores the defaults
+	g.Expect(store.Update(nil)).To(Succeed())
+	g.Expect(store.Get().ClusterDeletionConcurrency).To(Equal(10))
+
+	var unset *ConfigStore
+	g.Expect(unset.Get()).To(Equal(Config{}))
+}
+
+func TestConfigCheckMachineType(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(Config{}.CheckMachineType("c3.small.x86")).To(Succeed())
+
+	config := Config{AllowedMachineTypes: []string{"c3.small.x86", "m3.large.x86"}}
+	g.Expect(config.CheckMachineType("C3.SMALL.X86")).To(Succeed())
+	err := config.CheckMachineType("n3.xlarge.x86")
+	g.Expect(err).To(MatchError(ContainSubstring("machine type n3.xlarge.x86 is not allowed")))
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+}
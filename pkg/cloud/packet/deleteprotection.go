@@ -0,0 +1,37 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// DeleteProtected reports whether any of objs, a PacketCluster or its
+// Cluster, enables the delete protection.
+func DeleteProtected(objs ...metav1.Object) bool {
+	for _, obj := range objs {
+		value := obj.GetAnnotations()[infrastructurev1alpha3.DeleteProtectionAnnotation]
+		if strings.EqualFold(strings.TrimSpace(value), infrastructurev1alpha3.DeleteProtectionEnabled) {
+			return true
+		}
+	}
+	return false
+}
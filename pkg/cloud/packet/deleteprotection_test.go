@@ -0,0 +1,39 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestDeleteProtected(t *testing.T) {
+	g := NewWithT(t)
+	annotated := func(value string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Annotations: map[string]string{infrastructurev1alpha3.DeleteProtectionAnnotation: value}}
+	}
+
+	g.Expect(DeleteProtected(&infrastructurev1alpha3.PacketCluster{}, &clusterv1.Cluster{})).To(BeFalse())
+	g.Expect(DeleteProtected(&infrastructurev1alpha3.PacketCluster{ObjectMeta: annotated("enabled")})).To(BeTrue())
+	g.Expect(DeleteProtected(&infrastructurev1alpha3.PacketCluster{}, &clusterv1.Cluster{ObjectMeta: annotated("Enabled")})).To(BeTrue())
+	g.Expect(DeleteProtected(&infrastructurev1alpha3.PacketCluster{ObjectMeta: annotated("disabled")})).To(BeFalse())
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// DefaultDeviceCacheTTL is how long the clients of a ClientPool serve an
+// active device from their cache.
+const DefaultDeviceCacheTTL = 30 * time.Second
+
+var deviceCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "capp_packet_device_cache_lookups_total",
+	Help: "Device lookups of the Packet clients, by result: hit or miss.",
+}, []string{"result"})
+
+func init() {
+	metrics.Registry.MustRegister(deviceCacheLookups)
+}
+
+// deviceCache holds the active devices GetDevice read for ttl, so that the
+// steady state reconciliations of running machines do not read them from the
+// API every time. Devices in any other state are always read from the API,
+// and the changes the client makes to a device drop it from the cache. A nil
+// cache caches nothing.
+type deviceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	devices map[string]cachedDevice
+}
+
+type cachedDevice struct {
+	device  packngo.Device
+	expires time.Time
+}
+
+func newDeviceCache(ttl time.Duration) *deviceCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &deviceCache{ttl: ttl, now: time.Now, devices: map[string]cachedDevice{}}
+}
+
+// get returns a copy of the cached device with the given id, nil when it is
+// not cached or expired.
+func (c *deviceCache) get(deviceID string) *packngo.Device {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.devices[deviceID]
+	if !ok || !c.now().Before(cached.expires) {
+		delete(c.devices, deviceID)
+		deviceCacheLookups.WithLabelValues("miss").Inc()
+		return nil
+	}
+	deviceCacheLookups.WithLabelValues("hit").Inc()
+	return copyDevice(cached.device)
+}
+
+// add caches a device read from the API when it is active, and drops it
+// otherwise.
+func (c *deviceCache) add(device *packngo.Device) {
+	if c == nil || device == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if device.State != "active" {
+		delete(c.devices, device.ID)
+		return
+	}
+	c.devices[device.ID] = cachedDevice{device: *copyDevice(*device), expires: c.now().Add(c.ttl)}
+}
+
+// seed caches the active devices listed from the API. It returns the number of
+// devices cached.
+func (c *deviceCache) seed(devices []packngo.Device) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seeded := 0
+	for i := range devices {
+		if devices[i].State != "active" {
+			continue
+		}
+		c.devices[devices[i].ID] = cachedDevice{device: *copyDevice(devices[i]), expires: c.now().Add(c.ttl)}
+		seeded++
+	}
+	return seeded
+}
+
+// invalidate drops a device changed by the client from the cache.
+func (c *deviceCache) invalidate(deviceID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.devices, deviceID)
+}
+
+// copyDevice copies the fields of a device the callers modify.
+func copyDevice(device packngo.Device) *packngo.Device {
+	device.Tags = append([]string(nil), device.Tags...)
+	device.Network = append([]*packngo.IPAddressAssignment(nil), device.Network...)
+	return &device
+}
+
+// DeviceCacheService warms the device cache of a client up.
+type DeviceCacheService interface {
+	WarmDeviceCache(projectID string) (int, error)
+}
+
+// WarmDeviceCache lists the devices of a project at once and caches the
+// active ones the provider tagged, so that the reconciliations of their
+// machines after a restart do not read them one by one. It returns the number
+// of devices cached, 0 for a client without cache.
+func (p *PacketClient) WarmDeviceCache(projectID string) (int, error) {
+	if p.devices == nil {
+		return 0, nil
+	}
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the devices of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	tagged := make([]packngo.Device, 0, len(devices))
+	for _, device := range devices {
+		for _, tag := range device.Tags {
+			if strings.HasPrefix(tag, MachineUIDTag+":") {
+				tagged = append(tagged, device)
+				break
+			}
+		}
+	}
+	return p.devices.seed(tagged), nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGetDeviceCache(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/devices/provisioning", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "provisioning", "state": "provisioning"}})
+	api.on("GET", "/devices/active", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "active", "state": "active", "tags": []string{"a"}}})
+	api.on("POST", "/devices/active/actions", fakeResponse{status: http.StatusAccepted})
+
+	now := time.Now()
+	c.devices = newDeviceCache(time.Minute)
+	c.devices.now = func() time.Time { return now }
+
+	// devices that are not active are always read from the API
+	for i := 0; i < 2; i++ {
+		_, err := c.GetDevice("provisioning")
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	g.Expect(api.requestsTo("GET", "/devices/provisioning")).To(HaveLen(2))
+
+	// active devices are served from the cache until they expire
+	dev, err := c.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	dev.Tags[0] = "changed"
+	dev, err = c.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev.Tags).To(Equal([]string{"a"}))
+	g.Expect(api.requestsTo("GET", "/devices/active")).To(HaveLen(1))
+
+	now = now.Add(time.Minute)
+	_, err = c.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo("GET", "/devices/active")).To(HaveLen(2))
+
+	// the changes of the client drop the device from the cache
+	g.Expect(c.RebootDevice("active")).To(Succeed())
+	_, err = c.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo("GET", "/devices/active")).To(HaveLen(3))
+
+	// copies of the client share the cache
+	copied, err := c.WithHeaders(http.Header{"X-Other": {"value"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = copied.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo("GET", "/devices/active")).To(HaveLen(3))
+}
+
+func TestDeviceCacheDisabled(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(newDeviceCache(0)).To(BeNil())
+
+	var cache *deviceCache
+	cache.add(nil)
+	cache.invalidate("device")
+	g.Expect(cache.get("device")).To(BeNil())
+}
+
+func TestWarmDeviceCache(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"devices": []map[string]interface{}{
+			{"id": "active", "state": "active", "tags": []string{GenerateMachineTag("machine-uid")}},
+			{"id": "provisioning", "state": "provisioning", "tags": []string{GenerateMachineTag("other-uid")}},
+			{"id": "manual", "state": "active", "tags": []string{"rack1"}},
+		},
+	}})
+	api.on("GET", "/devices/active", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "active", "state": "active"}})
+
+	g.Expect(c.WarmDeviceCache("project")).To(Equal(0))
+
+	now := time.Now()
+	c.devices = newDeviceCache(time.Minute)
+	c.devices.now = func() time.Time { return now }
+	g.Expect(c.WarmDeviceCache("project")).To(Equal(1))
+	g.Expect(c.devices.devices).To(HaveKey("active"))
+
+	now = now.Add(30 * time.Second)
+	dev, err := c.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev.Tags).To(Equal([]string{GenerateMachineTag("machine-uid")}))
+	g.Expect(api.requestsTo("GET", "/devices/active")).To(BeEmpty())
+
+	// the devices the cache is warmed up with expire with its ttl
+	now = now.Add(time.Minute)
+	_, err = c.GetDevice("active")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo("GET", "/devices/active")).To(HaveLen(1))
+}
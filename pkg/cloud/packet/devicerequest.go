@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/packethost/packngo"
+	"gomodules.xyz/jsonpatch/v2"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// RecordDeviceRequest returns the request a device was created with, as JSON,
+// for the DeviceRequestAnnotation. The userdata, holding the secrets the
+// machine joins the cluster with, is replaced by its digest.
+func RecordDeviceRequest(req packngo.DeviceCreateRequest) string {
+	req.UserData = UserDataHash(req.UserData)
+	record, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	return string(record)
+}
+
+// ParseDeviceRequest returns the request recorded in a DeviceRequestAnnotation.
+func ParseDeviceRequest(record string) (packngo.DeviceCreateRequest, error) {
+	req := packngo.DeviceCreateRequest{}
+	err := json.Unmarshal([]byte(record), &req)
+	return req, err
+}
+
+// ExpectedDeviceRequest returns the recorded request updated with the current
+// spec of the machine. What the controller decided at creation is kept: the
+// facility picked when the spec lets it choose, the hardware reservation
+// picked from a list, the hostname, suffixed when taken by another device or
+// qualified with the DNS zone, the generated tags, the url of the iPXE script
+// of a boot profile and the userdata.
+func ExpectedDeviceRequest(machineScope *scope.MachineScope, recorded packngo.DeviceCreateRequest) packngo.DeviceCreateRequest {
+	spec := machineScope.PacketMachine.Spec
+	expected := recorded
+	if expected.Hostname == "" {
+		expected.Hostname = MachineHostname(machineScope)
+	}
+	expected.ProjectID = machineScope.PacketCluster.Spec.ProjectID
+	expected.Plan = spec.MachineType
+	expected.OS = DeviceOS(spec)
+	expected.BillingCycle = spec.BillingCycle
+	// the url of the script of a boot profile is the controller's
+	if spec.IPXEBootProfile == "" {
+		expected.IPXEScriptURL = spec.IPXEUrl
+	}
+
+	if len(spec.Facilities) == 0 && spec.Facility != infrastructurev1alpha3.FacilityAny {
+		if facility := DeviceFacility(machineScope, ""); facility != "" {
+			expected.Facility, expected.Metro = []string{facility}, ""
+		} else if metro := machineScope.PacketCluster.Spec.Metro; metro != "" {
+			expected.Facility, expected.Metro = nil, metro
+		}
+	}
+
+	if !ItemsInList(strings.Split(spec.HardwareReservationID, ","), []string{recorded.HardwareReservationID}) {
+		expected.HardwareReservationID = spec.HardwareReservationID
+	}
+
+	// tags keep their recorded order, so that the patch only holds the ones
+	// added to or removed from the spec
+	expected.Tags = []string{}
+	for _, tag := range recorded.Tags {
+		if ItemsInList(spec.Tags, []string{tag}) || generatedTag(tag) {
+			expected.Tags = append(expected.Tags, tag)
+		}
+	}
+	for _, tag := range spec.Tags {
+		if !ItemsInList(recorded.Tags, []string{tag}) {
+			expected.Tags = append(expected.Tags, tag)
+		}
+	}
+	return expected
+}
+
+// generatedTag tells whether a tag is set by the controller rather than by the
+// spec of the machine: a managed tag, or a role tag of the devices created by
+// previous versions.
+func generatedTag(tag string) bool {
+	return ManagedTag(tag) || tag == infrastructurev1alpha3.LegacyControlPlaneTag || tag == infrastructurev1alpha3.LegacyWorkerTag
+}
+
+// DeviceRequestDrift returns the JSON patch turning the recorded request into
+// the expected one, sorted by path. An empty string means no drift.
+func DeviceRequestDrift(recorded, expected packngo.DeviceCreateRequest) (string, error) {
+	from, err := json.Marshal(recorded)
+	if err != nil {
+		return "", err
+	}
+	to, err := json.Marshal(expected)
+	if err != nil {
+		return "", err
+	}
+
+	operations, err := jsonpatch.CreatePatch(from, to)
+	if err != nil || len(operations) == 0 {
+		return "", err
+	}
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i].Path < operations[j].Path
+	})
+	drift, err := json.Marshal(operations)
+	return string(drift), err
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestNewDeviceRecordsRequest(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	machineScope := newTestMachineScope(t,
+		infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Tags: []string{"team:platform"}},
+		infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"},
+		"#!/bin/sh\necho secret-join-token\n")
+
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, ExtraTags: []string{GenerateClusterTag("capi")}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	record := machineScope.PacketMachine.Annotations[infrastructurev1alpha3.DeviceRequestAnnotation]
+	g.Expect(record).NotTo(ContainSubstring("secret-join-token"))
+	recorded, err := ParseDeviceRequest(record)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recorded.UserData).To(Equal(UserDataHash("#!/bin/sh\necho secret-join-token\n")))
+	g.Expect(recorded.Plan).To(Equal("c3.small.x86"))
+	g.Expect(recorded.Facility).To(Equal([]string{"ewr1"}))
+	g.Expect(recorded.Tags).To(Equal([]string{"team:platform", GenerateClusterTag("capi"), infrastructurev1alpha3.WorkerTag}))
+
+	drift, err := DeviceRequestDrift(recorded, ExpectedDeviceRequest(machineScope, recorded))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drift).To(BeEmpty())
+}
+
+func TestDeviceRequestDrift(t *testing.T) {
+	base := infrastructurev1alpha3.PacketMachineSpec{
+		OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Tags: []string{"team:platform"},
+		HardwareReservationID: "8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e,next-available",
+	}
+	record := RecordDeviceRequest(packngo.DeviceCreateRequest{
+		Hostname:              "worker-0",
+		ProjectID:             "project",
+		Plan:                  "c3.small.x86",
+		OS:                    "ubuntu_20_04",
+		BillingCycle:          "hourly",
+		Facility:              []string{"ewr1"},
+		HardwareReservationID: "8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e",
+		Tags:                  []string{"team:platform", GenerateClusterTag("capi"), infrastructurev1alpha3.WorkerTag},
+		UserData:              "#!/bin/sh\n",
+	})
+
+	tests := []struct {
+		name   string
+		update func(*infrastructurev1alpha3.PacketMachineSpec)
+		want   string
+	}{
+		{
+			name:   "in sync",
+			update: func(*infrastructurev1alpha3.PacketMachineSpec) {},
+		},
+		{
+			name: "machine type and operating system changed",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.MachineType, m.OS = "m3.large.x86", "flatcar_stable"
+			},
+			want: `[{"op":"replace","path":"/operating_system","value":"flatcar_stable"},{"op":"replace","path":"/plan","value":"m3.large.x86"}]`,
+		},
+		{
+			name: "tag added",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.Tags = append(m.Tags, "env:prod")
+			},
+			want: `[{"op":"add","path":"/tags/3","value":"env:prod"}]`,
+		},
+		{
+			name: "tag removed",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.Tags = nil
+			},
+			want: `[{"op":"remove","path":"/tags/0"}]`,
+		},
+		{
+			name: "facility changed",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.Facility = "sjc1"
+			},
+			want: `[{"op":"replace","path":"/facility/0","value":"sjc1"}]`,
+		},
+		{
+			name: "facility left to the controller",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.Facility = infrastructurev1alpha3.FacilityAny
+			},
+		},
+		{
+			name: "hardware reservation picked from the list",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.HardwareReservationID = "next-available,8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e"
+			},
+		},
+		{
+			name: "hardware reservation removed",
+			update: func(m *infrastructurev1alpha3.PacketMachineSpec) {
+				m.HardwareReservationID = ""
+			},
+			want: `[{"op":"remove","path":"/hardware_reservation_id"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			machineSpec := base
+			machineSpec.Tags = append([]string{}, base.Tags...)
+			tt.update(&machineSpec)
+			machineScope := newTestMachineScope(t, machineSpec, infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"}, "")
+
+			recorded, err := ParseDeviceRequest(record)
+			g.Expect(err).NotTo(HaveOccurred())
+			drift, err := DeviceRequestDrift(recorded, ExpectedDeviceRequest(machineScope, recorded))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(drift).To(Equal(tt.want))
+		})
+	}
+}
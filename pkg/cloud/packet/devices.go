@@ -0,0 +1,933 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/dns"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/tracing"
+)
+
+// DeviceService creates, inspects, operates and deletes the devices of the
+// machines.
+type DeviceService interface {
+	GetDevice(deviceID string) (*packngo.Device, error)
+	LatestDeviceEvents(deviceID string, count int) ([]packngo.Event, error)
+	NewDevice(req CreateDeviceRequest) (*packngo.Device, error)
+	FindDevice(projectID string, ref *infrastructurev1alpha3.DeviceReference) (*packngo.Device, error)
+	AdoptDevice(req CreateDeviceRequest, device *packngo.Device) error
+	IsReservationProtected(reservationID string) (bool, error)
+	IsReservationProvisionable(reservationID string) (bool, error)
+	GetDeviceAddresses(device *packngo.Device, family infrastructurev1alpha3.NodeIPFamily) ([]infrastructurev1alpha3.DeviceAddress, error)
+	GetDeviceByTags(project string, tags []string) (*packngo.Device, error)
+	DeviceHostname(projectID, hostname, machineTag, suffix string) (*packngo.Device, string, error)
+	GetClusterDevices(projectID, clusterName string) ([]packngo.Device, error)
+	GetManagedClusterDevices(projectID, clusterUID string) ([]packngo.Device, error)
+	DeleteDevice(deviceID string) error
+	DeleteDevices(deviceIDs []string, concurrency int) (int, []error)
+	UpdateDeviceTags(deviceID string, tags []string) error
+	RescueDevice(deviceID string) error
+	RebootDevice(deviceID string) error
+	SetDeviceBootOrder(deviceID string, order infrastructurev1alpha3.BootOrder) error
+	SetDeviceLocked(deviceID string, locked bool) error
+}
+
+// GetDevice returns a device. Active devices read recently may come from the
+// cache of the client.
+func (p *PacketClient) GetDevice(deviceID string) (*packngo.Device, error) {
+	if dev := p.devices.get(deviceID); dev != nil {
+		return dev, nil
+	}
+	dev, _, err := p.Client.Devices.Get(deviceID, nil)
+	if err != nil {
+		p.devices.invalidate(deviceID)
+		return nil, packeterrors.Wrap(err)
+	}
+	p.devices.add(dev)
+	return dev, nil
+}
+
+// LatestDeviceEvents returns up to count of the most recent events of a device.
+func (p *PacketClient) LatestDeviceEvents(deviceID string, count int) ([]packngo.Event, error) {
+	events, _, err := p.Client.Devices.ListEvents(deviceID, &packngo.ListOptions{Page: 1, PerPage: count})
+	if err != nil {
+		return nil, packeterrors.Wrap(err)
+	}
+	if len(events) > count {
+		events = events[:count]
+	}
+	return events, nil
+}
+
+type CreateDeviceRequest struct {
+	ExtraTags            []string
+	MachineScope         *scope.MachineScope
+	ControlPlaneEndpoint string
+	// Facility overrides the facility resolved from the PacketMachine and
+	// PacketCluster specs, it is set when the machine is spread across facilities.
+	Facility string
+	// FacilityControlPlaneEndpoint is the address reserved for the control
+	// plane in the facility the machine is placed in.
+	FacilityControlPlaneEndpoint string
+	// ClusterCACertificate is the PEM encoded certificate of the cluster CA.
+	ClusterCACertificate []byte
+	// BootstrapTokenExpiration is when the token the machine joins with expires.
+	BootstrapTokenExpiration *time.Time
+	// BootstrapCallbackURL is the url the device calls once its bootstrap
+	// completed, authenticated with BootstrapCallbackToken.
+	BootstrapCallbackURL   string
+	BootstrapCallbackToken string
+	// TemplateValues are the values declared by the TemplateValuesFrom of
+	// the machine, by name.
+	TemplateValues map[string]string
+	// Hostname overrides the hostname of the device, the name of the
+	// machine, see DeviceHostname.
+	Hostname string
+	// ReservationClaims, when set, coordinates the hardware reservations the
+	// machine picks from with the other machines.
+	ReservationClaims *ReservationClaims
+	// UserDataHistory, when set, reports how the rendered userdata differs
+	// from the one of the previous machine of the node group.
+	UserDataHistory *UserDataHistory
+	// PlanGPUs are the GPUs of the plan of the machine, when known, see
+	// GPUTemplateValues.
+	PlanGPUs *PlanGPUs
+	// IPXEScriptURL overrides the IPXEUrl of the machine, it is the url of
+	// the script the iPXE server renders for a machine with a boot profile.
+	IPXEScriptURL string
+	// NodeAPIKey is the token of the API key minted for the node, rendered
+	// instead of the API key of the client. See NodeCredentialsPolicy.
+	NodeAPIKey string
+}
+
+// hostname returns the hostname the device of the request gets.
+func (req CreateDeviceRequest) hostname() string {
+	if req.Hostname != "" {
+		return req.Hostname
+	}
+	return req.MachineScope.Name()
+}
+
+func (p *PacketClient) NewDevice(req CreateDeviceRequest) (*packngo.Device, error) {
+	ipxeScriptURL := req.MachineScope.PacketMachine.Spec.IPXEUrl
+	if req.IPXEScriptURL != "" {
+		ipxeScriptURL = req.IPXEScriptURL
+	}
+	if ipxeScriptURL != "" {
+		// Error if pxe url and OS conflict
+		if req.MachineScope.PacketMachine.Spec.OS != ipxeOS {
+			return nil, fmt.Errorf("os should be set to custom_pxe when using pxe urls: %w", ErrInvalidRequest)
+		}
+	}
+
+	userData, tags, err := p.renderDevice(req)
+	if err != nil {
+		return nil, err
+	}
+
+	facility := DeviceFacility(req.MachineScope, req.Facility)
+
+	serverCreateOpts := &packngo.DeviceCreateRequest{
+		Hostname:      req.hostname(),
+		ProjectID:     req.MachineScope.PacketCluster.Spec.ProjectID,
+		BillingCycle:  req.MachineScope.PacketMachine.Spec.BillingCycle,
+		Plan:          req.MachineScope.PacketMachine.Spec.MachineType,
+		OS:            DeviceOS(req.MachineScope.PacketMachine.Spec),
+		IPXEScriptURL: ipxeScriptURL,
+		Tags:          tags,
+		UserData:      userData,
+	}
+
+	// Devices without a facility are placed anywhere in the cluster metro
+	if facility == "" && req.MachineScope.PacketCluster.Spec.Metro != "" {
+		serverCreateOpts.Metro = req.MachineScope.PacketCluster.Spec.Metro
+	} else {
+		serverCreateOpts.Facility = []string{facility}
+	}
+
+	reservationIDs, err := MachineReservationIDs(req.MachineScope)
+	if err != nil {
+		return nil, err
+	}
+
+	// If there are no reservationIDs to process, go ahead and return early
+	if len(reservationIDs) == 0 {
+		dev, _, err := p.Client.Devices.Create(serverCreateOpts)
+		if err != nil {
+			return nil, packeterrors.Wrap(err)
+		}
+		req.MachineScope.SetUserDataHash(UserDataHash(userData))
+		req.MachineScope.SetDeviceRequest(RecordDeviceRequest(*serverCreateOpts))
+		return dev, nil
+	}
+
+	// Do a naive loop through the list of reservationIDs, continuing if we hit any error
+	// TODO: if we can determine how to differentiate a failure based on the reservation
+	// being in use vs other errors, then we can make this a bit smarter in the future.
+	// The reservations claimed by other machines, or still deprovisioning the
+	// device of a deleted machine, are skipped.
+	var lastErr error
+	claimant := string(req.MachineScope.PacketMachine.UID)
+	claimed := []string{}
+	deprovisioning := []string{}
+
+	for _, resID := range reservationIDs {
+		if resID != "" && req.ReservationClaims.IsDeprovisioning(resID) {
+			provisionable, err := p.IsReservationProvisionable(resID)
+			switch {
+			case packeterrors.IsNotFound(err):
+				// the creation reports the reservation gone
+				req.ReservationClaims.Provisionable(resID)
+			case err != nil:
+				lastErr = err
+				continue
+			case !provisionable:
+				deprovisioning = append(deprovisioning, resID)
+				continue
+			default:
+				req.ReservationClaims.Provisionable(resID)
+			}
+		}
+		if resID != "" && !req.ReservationClaims.Claim(resID, claimant) {
+			claimed = append(claimed, resID)
+			continue
+		}
+		serverCreateOpts.HardwareReservationID = resID
+		dev, _, err := p.Client.Devices.Create(serverCreateOpts)
+		if err != nil {
+			lastErr = packeterrors.Wrap(err)
+			// a reservation in use stays claimed for the other machines to skip it
+			if !packeterrors.IsConflict(lastErr) {
+				req.ReservationClaims.Release(resID, claimant)
+			}
+			continue
+		}
+
+		req.MachineScope.SetUserDataHash(UserDataHash(userData))
+		req.MachineScope.SetDeviceRequest(RecordDeviceRequest(*serverCreateOpts))
+		return dev, nil
+	}
+
+	if lastErr == nil && len(claimed) > 0 {
+		return nil, fmt.Errorf("%s: %w", strings.Join(claimed, ","), ErrReservationsClaimed)
+	}
+	if lastErr == nil && len(deprovisioning) > 0 {
+		return nil, fmt.Errorf("%s: %w", strings.Join(deprovisioning, ","), ErrReservationsDeprovisioning)
+	}
+	return nil, lastErr
+}
+
+// StartupTaint returns the taint the node of a machine registers with, as
+// the kubelet register-with-taints argument takes it. It is empty when the
+// machine has no startup taint.
+func StartupTaint(spec infrastructurev1alpha3.PacketMachineSpec) string {
+	if !spec.StartupTaint {
+		return ""
+	}
+	return infrastructurev1alpha3.StartupTaintKey + ":NoSchedule"
+}
+
+// renderDevice renders the userdata template of the machine, and returns it
+// with the tags the device gets.
+func (p *PacketClient) renderDevice(req CreateDeviceRequest) (_ string, _ []string, err error) {
+	_, span := tracing.Start(p.context(), "RenderUserData")
+	defer func() { tracing.End(span, err) }()
+
+	userDataRaw, format, err := req.MachineScope.GetBootstrapData()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "impossible to retrieve bootstrap data from secret")
+	}
+
+	userData := string(userDataRaw)
+	userDataValues := map[string]interface{}{
+		"kubernetesVersion": pointer.StringPtrDerefOr(req.MachineScope.Machine.Spec.Version, ""),
+		"nodeIPFamily":      string(infrastructurev1alpha3.NodeIPFamilyDual),
+		"values":            map[string]string{},
+	}
+	if req.TemplateValues != nil {
+		userDataValues["values"] = req.TemplateValues
+	}
+
+	if family := req.MachineScope.PacketMachine.Spec.NodeIPFamily; family != "" {
+		userDataValues["nodeIPFamily"] = string(family)
+	}
+	userDataValues["startupTaint"] = StartupTaint(req.MachineScope.PacketMachine.Spec)
+	for name, value := range GPUTemplateValues(req.MachineScope.PacketMachine.Spec.GPU, req.PlanGPUs) {
+		userDataValues[name] = value
+	}
+	registryValues, err := RegistryTemplateValues(req.MachineScope.PacketCluster.Spec.Registries)
+	if err != nil {
+		return "", nil, err
+	}
+	for name, value := range registryValues {
+		userDataValues[name] = value
+	}
+
+	joinEndpoint, err := JoinEndpoint(req.MachineScope)
+	if err != nil {
+		return "", nil, err
+	}
+	if joinEndpoint != "" {
+		userDataValues["joinEndpoint"] = joinEndpoint
+	}
+
+	if len(req.ClusterCACertificate) > 0 {
+		caCertHashes, err := CACertHashes(req.ClusterCACertificate)
+		if err != nil {
+			return "", nil, fmt.Errorf("error hashing the cluster CA certificate: %v", err)
+		}
+		userDataValues["clusterCACertificate"] = string(req.ClusterCACertificate)
+		userDataValues["clusterCACertHashes"] = caCertHashes
+	}
+
+	if req.BootstrapTokenExpiration != nil {
+		userDataValues["bootstrapTokenExpiration"] = req.BootstrapTokenExpiration.UTC().Format(time.RFC3339)
+	}
+
+	if req.BootstrapCallbackURL != "" {
+		userDataValues["bootstrapCallbackURL"] = req.BootstrapCallbackURL
+		userDataValues["bootstrapCallbackToken"] = req.BootstrapCallbackToken
+	}
+
+	tags := append(append([]string{}, req.MachineScope.PacketMachine.Spec.Tags...), req.ExtraTags...)
+
+	if req.MachineScope.IsControlPlane() {
+		// control plane machines should get the API key injected
+		apiKey := p.Client.APIKey
+		if req.NodeAPIKey != "" {
+			apiKey = req.NodeAPIKey
+		}
+		if apiKey == "" {
+			// the controller authenticates with OAuth, it has no key to hand out
+			return "", nil, fmt.Errorf("control plane machines need an API key and the controller has none, set nodeCredentials on the PacketCluster: %w", ErrInvalidRequest)
+		}
+		userDataValues["apiKey"] = apiKey
+
+		if req.ControlPlaneEndpoint != "" {
+			userDataValues["controlPlaneEndpoint"] = req.ControlPlaneEndpoint
+
+			clusterSpec := req.MachineScope.PacketCluster.Spec
+			manifest, err := KubeVIPManifest(clusterSpec, req.ControlPlaneEndpoint, clusterSpec.ControlPlaneEndpoint.Port, apiKey)
+			if err != nil {
+				return "", nil, err
+			}
+			if manifest != "" {
+				userDataValues["kubeVIPManifest"] = manifest
+				userDataValues["kubeVIPManifestBase64"] = base64.StdEncoding.EncodeToString([]byte(manifest))
+			}
+		}
+
+		if req.FacilityControlPlaneEndpoint != "" {
+			userDataValues["facilityControlPlaneEndpoint"] = req.FacilityControlPlaneEndpoint
+		}
+
+		if policy := req.MachineScope.PacketCluster.Spec.AdvertiseAddress; policy != nil {
+			command, err := AdvertiseAddressCommand(policy)
+			if err != nil {
+				return "", nil, err
+			}
+			userDataValues["advertiseAddressCommand"] = command
+		}
+
+		tags = append(tags, infrastructurev1alpha3.ControlPlaneTag)
+	} else {
+		tags = append(tags, infrastructurev1alpha3.WorkerTag)
+	}
+
+	if userData, err = RenderUserData(req.MachineScope.PacketMachine.Spec.UserDataTemplateEngine, userData, userDataValues); err != nil {
+		return "", nil, err
+	}
+	if err := scope.ValidateBootstrapData([]byte(userData), format); err != nil {
+		return "", nil, fmt.Errorf("rendered %s userdata is invalid: %v: %w", format, err, ErrInvalidRequest)
+	}
+
+	if policy := req.MachineScope.PacketCluster.Spec.NetworkPolicy; policy != nil {
+		apiServerPort := req.MachineScope.PacketCluster.Spec.ControlPlaneEndpoint.Port
+		if apiServerPort == 0 {
+			apiServerPort = 6443
+		}
+		rules, err := FirewallRules(policy, req.MachineScope.IsControlPlane(), apiServerPort)
+		if err != nil {
+			return "", nil, err
+		}
+		if userData, err = InjectFirewall(userData, format, rules); err != nil {
+			return "", nil, err
+		}
+		if req.MachineScope.IsControlPlane() && len(policy.APIServerAllowedCIDRs) != 0 {
+			tags = append(tags, GenerateAPIServerFirewallTag(rules))
+		}
+	}
+
+	// the driver is installed after the firewall is added, in the same
+	// multipart
+	if userData, err = InjectGPUDriver(userData, format, req.MachineScope.PacketMachine.Spec.GPU); err != nil {
+		return "", nil, err
+	}
+	// the containerd configuration is written first, in the multipart of
+	// the firewall or of the driver if any
+	if userData, err = InjectContainerdRegistries(userData, format, req.MachineScope.PacketCluster.Spec.Registries); err != nil {
+		return "", nil, err
+	}
+	recordRenderedUserData(req, userData, userDataValues)
+
+	return userData, tags, nil
+}
+
+// FindDevice returns the device referenced by a PacketMachine adopting an
+// existing device, looked up by id or by hostname in the project.
+func (p *PacketClient) FindDevice(projectID string, ref *infrastructurev1alpha3.DeviceReference) (*packngo.Device, error) {
+	if ref.ID != "" {
+		return p.GetDevice(ref.ID)
+	}
+
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving devices: %w", packeterrors.Wrap(err))
+	}
+	for _, device := range devices {
+		if device.Hostname == ref.Hostname {
+			return &device, nil
+		}
+	}
+	return nil, packeterrors.New(packeterrors.ReasonNotFound, fmt.Errorf("device with hostname %s not found", ref.Hostname))
+}
+
+// AdoptDevice takes over a device provisioned outside of the cluster api: the
+// device gets tagged as the machine, its userdata is replaced by the rendered
+// bootstrap data and it is reinstalled to run it.
+func (p *PacketClient) AdoptDevice(req CreateDeviceRequest, device *packngo.Device) error {
+	// a previous attempt may have tagged the device already
+	for _, tag := range device.Tags {
+		if strings.HasPrefix(tag, clusterIDTag+":") && !ItemsInList(req.ExtraTags, []string{tag}) {
+			return fmt.Errorf("device %s already belongs to another cluster: %w", device.ID, ErrInvalidRequest)
+		}
+		if strings.HasPrefix(tag, MachineUIDTag+":") && !ItemsInList(req.ExtraTags, []string{tag}) {
+			return fmt.Errorf("device %s already belongs to another machine: %w", device.ID, ErrInvalidRequest)
+		}
+	}
+
+	userData, tags, err := p.renderDevice(req)
+	if err != nil {
+		return err
+	}
+
+	// keep the tags set by the tooling that provisioned the device, the
+	// device was let in by DeviceOwnership
+	seen := map[string]bool{}
+	allTags := []string{}
+	for _, tag := range append(withoutClusterUIDTags(device.Tags), tags...) {
+		if !seen[tag] {
+			seen[tag] = true
+			allTags = append(allTags, tag)
+		}
+	}
+
+	defer p.devices.invalidate(device.ID)
+	if _, _, err := p.Devices.Update(device.ID, &packngo.DeviceUpdateRequest{
+		UserData: &userData,
+		Tags:     &allTags,
+	}); err != nil {
+		return packeterrors.Wrap(err)
+	}
+	req.MachineScope.SetUserDataHash(UserDataHash(userData))
+
+	return p.reinstallDevice(device.ID, DeviceOS(req.MachineScope.PacketMachine.Spec))
+}
+
+// UserDataHash returns the digest recorded for a device userdata.
+func UserDataHash(userData string) string {
+	sum := sha256.Sum256([]byte(userData))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// VerifyUserData checks that the userdata Packet stored for a device is the
+// one the controller rendered, whose digest is hash.
+func VerifyUserData(device *packngo.Device, hash string) error {
+	if got := UserDataHash(device.UserData); got != hash {
+		return fmt.Errorf("userdata stored for device %s does not match the rendered one: got %d bytes with digest %s, expected digest %s",
+			device.ID, len(device.UserData), got, hash)
+	}
+	return nil
+}
+
+// DeviceReservationID returns the id of the hardware reservation a device
+// runs on, empty for on demand devices.
+func DeviceReservationID(device *packngo.Device) string {
+	if device.HardwareReservation.Href == "" {
+		return ""
+	}
+	return path.Base(device.HardwareReservation.Href)
+}
+
+// IsReservationProtected reports whether a hardware reservation is tagged
+// protected. packngo does not expose the tags of the reservations.
+func (p *PacketClient) IsReservationProtected(reservationID string) (bool, error) {
+	r, err := p.NewRequest("GET", fmt.Sprintf("/hardware-reservations/%s", reservationID), nil)
+	if err != nil {
+		return false, err
+	}
+	reservation := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if _, err := p.Do(r, &reservation); err != nil {
+		return false, packeterrors.Wrap(err)
+	}
+	return ItemsInList(reservation.Tags, []string{ProtectedReservationTag}), nil
+}
+
+// IsReservationProvisionable reports whether a hardware reservation can take
+// a new device: it has none, and is done deprovisioning the previous one.
+func (p *PacketClient) IsReservationProvisionable(reservationID string) (bool, error) {
+	reservation, _, err := p.Client.HardwareReservations.Get(reservationID, nil)
+	if err != nil {
+		return false, packeterrors.Wrap(err)
+	}
+	return reservation.Provisionable && reservation.Device == nil, nil
+}
+
+// reinstallDevice reinstalls the operating system of a device, which runs its
+// userdata again. packngo does not expose the reinstall action.
+func (p *PacketClient) reinstallDevice(deviceID, os string) error {
+	action := map[string]interface{}{
+		"type":             "reinstall",
+		"operating_system": os,
+		"preserve_data":    false,
+	}
+	r, err := p.NewRequest("POST", fmt.Sprintf("/devices/%s/actions", deviceID), action)
+	if err != nil {
+		return err
+	}
+	_, err = p.Do(r, nil)
+	return packeterrors.Wrap(err)
+}
+
+// DeviceFacility returns the facility a device for the machine is created in.
+// An empty string means the device is placed by metro.
+func DeviceFacility(machineScope *scope.MachineScope, override string) string {
+	if override != "" {
+		return override
+	}
+	// Allow to override the facility for each PacketMachineTemplate
+	if machineScope.PacketMachine.Spec.Facility != "" {
+		return machineScope.PacketMachine.Spec.Facility
+	}
+	// The failure domains derived from hardware reservations are facilities,
+	// the ones of the reservation affinities are not
+	if fd := machineScope.Machine.Spec.FailureDomain; fd != nil && machineScope.PacketCluster.Spec.FailureDomainsFromReservations {
+		if _, ok := machineScope.PacketCluster.Status.FailureDomains[*fd]; ok {
+			return *fd
+		}
+	}
+	return machineScope.PacketCluster.Spec.Facility
+}
+
+// JoinEndpoint returns the address the machine joins the cluster through: the
+// JoinEndpointOverride of the PacketMachine, or the control plane endpoint of
+// the cluster. An empty string means the endpoint is not known yet.
+func JoinEndpoint(machineScope *scope.MachineScope) (string, error) {
+	if override := machineScope.PacketMachine.Spec.JoinEndpointOverride; override != "" {
+		host := override
+		if h, port, err := net.SplitHostPort(override); err == nil {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return "", fmt.Errorf("join endpoint %q has an invalid port: %w", override, ErrInvalidRequest)
+			}
+			host = h
+		}
+		if host == "" || strings.ContainsAny(host, "/ ") {
+			return "", fmt.Errorf("join endpoint %q is not a host or host:port: %w", override, ErrInvalidRequest)
+		}
+		return override, nil
+	}
+
+	endpoint := machineScope.PacketCluster.Spec.ControlPlaneEndpoint
+	if endpoint.Host == "" || endpoint.Port == 0 {
+		return endpoint.Host, nil
+	}
+	return net.JoinHostPort(endpoint.Host, strconv.Itoa(int(endpoint.Port))), nil
+}
+
+// GetDeviceAddresses returns the addresses of the device in the given ip
+// family. An empty family returns every address. The network of an active
+// device does not list every elastic ip assigned to it, nor the addresses it
+// announces over BGP, such as a control plane VIP: they are looked up with
+// the ip assignments and the BGP sessions of the device, and reported as
+// external ips.
+func (p *PacketClient) GetDeviceAddresses(device *packngo.Device, family infrastructurev1alpha3.NodeIPFamily) ([]infrastructurev1alpha3.DeviceAddress, error) {
+	addrs := make([]infrastructurev1alpha3.DeviceAddress, 0)
+	known := map[string]bool{}
+	for _, addr := range device.Network {
+		if !inIPFamily(addr.AddressFamily, family) {
+			continue
+		}
+		addrType := corev1.NodeInternalIP
+		if addr.IpAddressCommon.Public {
+			addrType = corev1.NodeExternalIP
+		}
+		a := infrastructurev1alpha3.DeviceAddress{
+			Type:          addrType,
+			Address:       addr.Address,
+			CIDR:          int32(addr.CIDR),
+			AddressFamily: int32(addr.AddressFamily),
+			Public:        addr.Public,
+			Management:    addr.Management,
+			AssignmentID:  addr.ID,
+		}
+		addrs = append(addrs, a)
+		known[addr.Address] = true
+	}
+	if device.State != string(infrastructurev1alpha3.PacketResourceStatusRunning) {
+		return addrs, nil
+	}
+
+	assignments, _, err := p.DeviceIPs.List(device.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the ips of device %s: %w", device.ID, packeterrors.Wrap(err))
+	}
+	for _, assignment := range assignments {
+		if known[assignment.Address] || !inIPFamily(assignment.AddressFamily, family) {
+			continue
+		}
+		addrs = append(addrs, infrastructurev1alpha3.DeviceAddress{
+			Type:          corev1.NodeExternalIP,
+			Address:       assignment.Address,
+			CIDR:          int32(assignment.CIDR),
+			AddressFamily: int32(assignment.AddressFamily),
+			Public:        assignment.Public,
+			Management:    assignment.Management,
+			AssignmentID:  assignment.ID,
+		})
+		known[assignment.Address] = true
+	}
+
+	sessions, _, err := p.Devices.ListBGPSessions(device.ID, nil)
+	if err = packeterrors.Wrap(err); err != nil && !packeterrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list the bgp sessions of device %s: %w", device.ID, err)
+	}
+	for _, session := range sessions {
+		for _, route := range session.LearnedRoutes {
+			ip, network, err := net.ParseCIDR(route)
+			if err != nil || known[ip.String()] {
+				continue
+			}
+			addressFamily := 6
+			if ip.To4() != nil {
+				addressFamily = 4
+			}
+			if !inIPFamily(addressFamily, family) {
+				continue
+			}
+			cidr, _ := network.Mask.Size()
+			addrs = append(addrs, infrastructurev1alpha3.DeviceAddress{
+				Type:          corev1.NodeExternalIP,
+				Address:       ip.String(),
+				CIDR:          int32(cidr),
+				AddressFamily: int32(addressFamily),
+				Public:        !privateIP(ip),
+				Announced:     true,
+			})
+			known[ip.String()] = true
+		}
+	}
+	return addrs, nil
+}
+
+// HasDeviceAddress reports whether address is one of addrs.
+func HasDeviceAddress(addrs []infrastructurev1alpha3.DeviceAddress, address string) bool {
+	for _, addr := range addrs {
+		if addr.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// privateNetworks are the IPv4 private networks and the IPv6 unique local
+// addresses.
+var privateNetworks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// privateIP reports whether ip is not routed on internet.
+func privateIP(ip net.IP) bool {
+	for _, cidr := range privateNetworks {
+		if _, network, _ := net.ParseCIDR(cidr); network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeAddresses converts device addresses to the node addresses reported to
+// the cluster api.
+func NodeAddresses(addrs []infrastructurev1alpha3.DeviceAddress) []corev1.NodeAddress {
+	nodeAddrs := make([]corev1.NodeAddress, 0, len(addrs))
+	for _, addr := range addrs {
+		nodeAddrs = append(nodeAddrs, corev1.NodeAddress{
+			Type:    addr.Type,
+			Address: addr.Address,
+		})
+	}
+	return nodeAddrs
+}
+
+func inIPFamily(addressFamily int, family infrastructurev1alpha3.NodeIPFamily) bool {
+	switch family {
+	case infrastructurev1alpha3.NodeIPFamilyIPv4:
+		return addressFamily == 4
+	case infrastructurev1alpha3.NodeIPFamilyIPv6:
+		return addressFamily == 6
+	default:
+		return true
+	}
+}
+
+func (p *PacketClient) GetDeviceByTags(project string, tags []string) (*packngo.Device, error) {
+	devices, _, err := p.Devices.List(project, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving devices: %w", packeterrors.Wrap(err))
+	}
+	// returns the first one that matches all of the tags
+	for _, device := range devices {
+		if ItemsInList(device.Tags, tags) {
+			return &device, nil
+		}
+	}
+	return nil, nil
+}
+
+// DeviceHostname is the preflight of a device creation. It returns the device
+// of the project tagged with machineTag, left by a creation whose result was
+// not recorded, for it to be used instead of creating another one. Otherwise
+// it returns the hostname the new device gets: hostname, with suffix appended
+// to its first label when another device of the project already has it.
+func (p *PacketClient) DeviceHostname(projectID, hostname, machineTag, suffix string) (*packngo.Device, string, error) {
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error retrieving devices: %w", packeterrors.Wrap(err))
+	}
+
+	taken := false
+	for i := range devices {
+		if ItemsInList(devices[i].Tags, []string{machineTag}) {
+			return &devices[i], "", nil
+		}
+		if devices[i].Hostname == hostname {
+			taken = true
+		}
+	}
+	if taken {
+		return nil, SuffixHostname(hostname, suffix), nil
+	}
+	return nil, hostname, nil
+}
+
+// SuffixHostname appends suffix to the first label of hostname, so that the
+// domain of a fully qualified hostname is kept.
+func SuffixHostname(hostname, suffix string) string {
+	if i := strings.Index(hostname, "."); i >= 0 {
+		return hostname[:i] + "-" + suffix + hostname[i:]
+	}
+	return hostname + "-" + suffix
+}
+
+// MachineHostname returns the hostname of the device of a machine: its name,
+// followed by the domain of its DNS records when the DNS zone of the cluster
+// names the devices after them.
+func MachineHostname(machineScope *scope.MachineScope) string {
+	zone := machineScope.PacketCluster.Spec.DNSZone
+	if zone == nil || !zone.DeviceHostnames {
+		return machineScope.Name()
+	}
+	return machineScope.Name() + "." + dns.MachineDomain(zone, machineScope.Cluster.Name)
+}
+
+// HostnameSuffix returns the suffix telling apart the hostname of the device of
+// the machine with the given UID, the same on every attempt.
+func HostnameSuffix(uid string) string {
+	suffix := strings.ReplaceAll(uid, "-", "")
+	if len(suffix) > 5 {
+		suffix = suffix[:5]
+	}
+	return suffix
+}
+
+// GetClusterDevices returns the devices of the project tagged for the cluster.
+func (p *PacketClient) GetClusterDevices(projectID, clusterName string) ([]packngo.Device, error) {
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving devices: %w", packeterrors.Wrap(err))
+	}
+
+	clusterDevices := []packngo.Device{}
+	for _, device := range devices {
+		if ItemsInList(device.Tags, []string{GenerateClusterTag(clusterName)}) {
+			clusterDevices = append(clusterDevices, device)
+		}
+	}
+	return clusterDevices, nil
+}
+
+// GetManagedClusterDevices returns the devices of the project tagged with the
+// UID of the cluster. Unlike the cluster tag, which only holds the name of the
+// cluster, the UID tells apart the clusters with the same name in different
+// namespaces.
+func (p *PacketClient) GetManagedClusterDevices(projectID, clusterUID string) ([]packngo.Device, error) {
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving devices: %w", packeterrors.Wrap(err))
+	}
+
+	clusterDevices := []packngo.Device{}
+	for _, device := range devices {
+		if DeviceManager(&device) == clusterUID {
+			clusterDevices = append(clusterDevices, device)
+		}
+	}
+	return clusterDevices, nil
+}
+
+// DeleteDevice deletes a device, without waiting for its storage to be
+// detached.
+func (p *PacketClient) DeleteDevice(deviceID string) error {
+	defer p.devices.invalidate(deviceID)
+	_, err := p.Devices.Delete(deviceID, true)
+	return packeterrors.Wrap(err)
+}
+
+// UpdateDeviceTags replaces the tags of a device.
+func (p *PacketClient) UpdateDeviceTags(deviceID string, tags []string) error {
+	defer p.devices.invalidate(deviceID)
+	_, _, err := p.Devices.Update(deviceID, &packngo.DeviceUpdateRequest{Tags: &tags})
+	return packeterrors.Wrap(err)
+}
+
+// RescueDevice reboots a device into the rescue operating system, running in
+// memory with the disks of the device left untouched.
+func (p *PacketClient) RescueDevice(deviceID string) error {
+	defer p.devices.invalidate(deviceID)
+	action := &packngo.DeviceActionRequest{Type: "rescue"}
+	_, err := p.DoRequest(http.MethodPost, path.Join("/devices", deviceID, "actions"), action, nil)
+	return packeterrors.Wrap(err)
+}
+
+// RebootDevice reboots a device, out of the rescue operating system if it
+// runs it.
+func (p *PacketClient) RebootDevice(deviceID string) error {
+	defer p.devices.invalidate(deviceID)
+	_, err := p.Devices.Reboot(deviceID)
+	return packeterrors.Wrap(err)
+}
+
+// SetDeviceBootOrder sets whether a device boots from its disk or always from
+// the network. The order applies from the next boot.
+func (p *PacketClient) SetDeviceBootOrder(deviceID string, order infrastructurev1alpha3.BootOrder) error {
+	defer p.devices.invalidate(deviceID)
+	alwaysPXE := order == infrastructurev1alpha3.BootOrderPXE
+	_, _, err := p.Devices.Update(deviceID, &packngo.DeviceUpdateRequest{AlwaysPXE: &alwaysPXE})
+	return packeterrors.Wrap(err)
+}
+
+// SetDeviceLocked locks or unlocks a device. A locked device can neither be
+// deleted nor reinstalled.
+func (p *PacketClient) SetDeviceLocked(deviceID string, locked bool) error {
+	defer p.devices.invalidate(deviceID)
+	var err error
+	if locked {
+		_, err = p.Devices.Lock(deviceID)
+	} else {
+		_, err = p.Devices.Unlock(deviceID)
+	}
+	return packeterrors.Wrap(err)
+}
+
+// DeviceBootOrder returns the boot order of a device.
+func DeviceBootOrder(device *packngo.Device) infrastructurev1alpha3.BootOrder {
+	if device.AlwaysPXE {
+		return infrastructurev1alpha3.BootOrderPXE
+	}
+	return infrastructurev1alpha3.BootOrderDisk
+}
+
+// DesiredBootOrder returns the boot order set by the BootOrderAnnotation of a
+// machine, and false when the annotation is not set.
+func DesiredBootOrder(annotations map[string]string) (infrastructurev1alpha3.BootOrder, bool, error) {
+	value, ok := annotations[infrastructurev1alpha3.BootOrderAnnotation]
+	if !ok {
+		return "", false, nil
+	}
+	switch order := infrastructurev1alpha3.BootOrder(strings.ToLower(strings.TrimSpace(value))); order {
+	case infrastructurev1alpha3.BootOrderDisk, infrastructurev1alpha3.BootOrderPXE:
+		return order, true, nil
+	default:
+		return "", false, fmt.Errorf("invalid boot order %q, expected %s or %s: %w", value,
+			infrastructurev1alpha3.BootOrderDisk, infrastructurev1alpha3.BootOrderPXE, ErrInvalidRequest)
+	}
+}
+
+// DeleteDevices deletes the devices running at most concurrency requests at
+// the same time. It returns how many devices got deleted, devices already gone
+// count as deleted, and the errors of the failed requests.
+func (p *PacketClient) DeleteDevices(deviceIDs []string, concurrency int) (int, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		deleted int
+		errs    []error
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, id := range deviceIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := p.DeleteDevice(id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && !packeterrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to delete device %s: %w", id, err))
+				return
+			}
+			deleted++
+		}(id)
+	}
+	wg.Wait()
+	return deleted, errs
+}
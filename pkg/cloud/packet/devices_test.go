@@ -0,0 +1,780 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" //nolint:staticcheck
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// newTestMachineScope returns the scope of a worker machine whose bootstrap
+// data is userData.
+func newTestMachineScope(t *testing.T, machineSpec infrastructurev1alpha3.PacketMachineSpec, clusterSpec infrastructurev1alpha3.PacketClusterSpec, userData string) *scope.MachineScope {
+	return newTestMachineScopeWithBootstrapData(t, machineSpec, clusterSpec, map[string][]byte{"value": []byte(userData)})
+}
+
+// newTestMachineScopeWithBootstrapData returns the scope of a worker machine
+// whose bootstrap data secret holds data.
+func newTestMachineScopeWithBootstrapData(t *testing.T, machineSpec infrastructurev1alpha3.PacketMachineSpec, clusterSpec infrastructurev1alpha3.PacketClusterSpec, data map[string][]byte) *scope.MachineScope {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrastructurev1alpha3.AddToScheme(scheme)).To(Succeed())
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "worker-0-bootstrap"},
+		Data:       data,
+	}
+	machineSpec.ProviderID = pointer.StringPtr("equinixmetal://unknown")
+	machineScope, err := scope.NewMachineScope(context.Background(), scope.MachineScopeParams{
+		Client:  fake.NewFakeClientWithScheme(scheme, secret),
+		Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "capi"}},
+		Machine: &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "worker-0"},
+			Spec: clusterv1.MachineSpec{
+				Version:   pointer.StringPtr("v1.20.4"),
+				Bootstrap: clusterv1.Bootstrap{DataSecretName: pointer.StringPtr(secret.Name)},
+			},
+		},
+		PacketCluster: &infrastructurev1alpha3.PacketCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "capi"},
+			Spec:       clusterSpec,
+		},
+		PacketMachine: &infrastructurev1alpha3.PacketMachine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "worker-0"},
+			Spec:       machineSpec,
+		},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	return machineScope
+}
+
+func TestNewDevice(t *testing.T) {
+	tests := []struct {
+		name         string
+		machineSpec  infrastructurev1alpha3.PacketMachineSpec
+		clusterSpec  infrastructurev1alpha3.PacketClusterSpec
+		responses    []fakeResponse
+		wantErr      error
+		wantRequests []map[string]interface{}
+	}{
+		{
+			name:        "facility of the machine",
+			machineSpec: infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Facility: "ewr1"},
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "sjc1"},
+			responses:   []fakeResponse{{status: http.StatusCreated, body: map[string]string{"id": "device"}}},
+			wantRequests: []map[string]interface{}{
+				{"facility": []interface{}{"ewr1"}},
+			},
+		},
+		{
+			name:        "metro of the cluster",
+			machineSpec: infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly"},
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Metro: "ny"},
+			responses:   []fakeResponse{{status: http.StatusCreated, body: map[string]string{"id": "device"}}},
+			wantRequests: []map[string]interface{}{
+				{"metro": "ny"},
+			},
+		},
+		{
+			name: "next hardware reservation when one is taken",
+			machineSpec: infrastructurev1alpha3.PacketMachineSpec{
+				OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly",
+				HardwareReservationID: "8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e,next-available",
+			},
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"},
+			responses: []fakeResponse{
+				{status: http.StatusUnprocessableEntity, body: apiError("reservation is already provisioned")},
+				{status: http.StatusCreated, body: map[string]string{"id": "device"}},
+			},
+			wantRequests: []map[string]interface{}{
+				{"hardware_reservation_id": "8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e"},
+				{"hardware_reservation_id": "next-available"},
+			},
+		},
+		{
+			name: "image",
+			machineSpec: infrastructurev1alpha3.PacketMachineSpec{
+				OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Facility: "ewr1",
+				ImageRef: &infrastructurev1alpha3.ImageReference{Slug: "capi_ubuntu_20_04_v1_20_4"},
+			},
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+			responses:   []fakeResponse{{status: http.StatusCreated, body: map[string]string{"id": "device"}}},
+			wantRequests: []map[string]interface{}{
+				{"operating_system": "capi_ubuntu_20_04_v1_20_4"},
+			},
+		},
+		{
+			name:        "ipxe url with another os",
+			machineSpec: infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", IPXEUrl: "http://boot"},
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"},
+			wantErr:     ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("POST", "/projects/project/devices", tt.responses...)
+			machineScope := newTestMachineScope(t, tt.machineSpec, tt.clusterSpec, "#!/bin/sh\necho {{ .kubernetesVersion }}\n")
+
+			dev, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, ExtraTags: []string{GenerateClusterTag("capi")}})
+			requests := api.requestsTo("POST", "/projects/project/devices")
+			if tt.wantErr != nil {
+				g.Expect(errors.Is(err, tt.wantErr)).To(BeTrue(), "unexpected error %v", err)
+				g.Expect(requests).To(BeEmpty())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(dev.ID).To(Equal("device"))
+
+			g.Expect(requests).To(HaveLen(len(tt.wantRequests)))
+			for i, want := range tt.wantRequests {
+				for key, value := range want {
+					g.Expect(requests[i].Body).To(HaveKeyWithValue(key, value))
+				}
+				g.Expect(requests[i].Body).To(HaveKeyWithValue("hostname", "worker-0"))
+				g.Expect(requests[i].Body).To(HaveKeyWithValue("plan", "c3.small.x86"))
+				g.Expect(requests[i].Body).To(HaveKeyWithValue("userdata", "#!/bin/sh\necho v1.20.4\n"))
+				g.Expect(requests[i].Body["tags"]).To(ConsistOf(GenerateClusterTag("capi"), infrastructurev1alpha3.WorkerTag))
+			}
+			g.Expect(machineScope.PacketMachine.Status.UserDataHash).To(Equal(UserDataHash("#!/bin/sh\necho v1.20.4\n")))
+		})
+	}
+}
+
+func TestNewDeviceReservationClaims(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	machineSpec := infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", HardwareReservationID: "r1,r2"}
+	clusterSpec := infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"}
+	machineScope := newTestMachineScope(t, machineSpec, clusterSpec, "#!/bin/sh\n")
+	machineScope.PacketMachine.UID = "machine"
+	claims := NewReservationClaims(time.Minute)
+	g.Expect(claims.Claim("r1", "other")).To(BeTrue())
+
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, ReservationClaims: claims})
+	g.Expect(err).NotTo(HaveOccurred())
+	requests := api.requestsTo("POST", "/projects/project/devices")
+	g.Expect(requests).To(HaveLen(1))
+	g.Expect(requests[0].Body).To(HaveKeyWithValue("hardware_reservation_id", "r2"))
+	g.Expect(claims.Claim("r2", "other")).To(BeFalse())
+
+	machineScope.PacketMachine.UID = "last"
+	_, err = c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, ReservationClaims: claims})
+	g.Expect(errors.Is(err, ErrReservationsClaimed)).To(BeTrue())
+	g.Expect(api.requestsTo("POST", "/projects/project/devices")).To(HaveLen(1))
+}
+
+func TestNewDeviceDeprovisioningReservation(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	api.on("GET", "/hardware-reservations/r1",
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "r1", "provisionable": false}},
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "r1", "provisionable": true}},
+	)
+	machineSpec := infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", HardwareReservationID: "r1"}
+	clusterSpec := infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"}
+	machineScope := newTestMachineScope(t, machineSpec, clusterSpec, "#!/bin/sh\n")
+	machineScope.PacketMachine.UID = "machine"
+	claims := NewReservationClaims(time.Minute)
+	claims.Deprovisioning("r1")
+
+	// the reservation is held until the API reports it provisionable
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, ReservationClaims: claims})
+	g.Expect(errors.Is(err, ErrReservationsDeprovisioning)).To(BeTrue())
+	g.Expect(api.requestsTo("POST", "/projects/project/devices")).To(BeEmpty())
+	g.Expect(claims.IsDeprovisioning("r1")).To(BeTrue())
+
+	_, err = c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, ReservationClaims: claims})
+	g.Expect(err).NotTo(HaveOccurred())
+	requests := api.requestsTo("POST", "/projects/project/devices")
+	g.Expect(requests).To(HaveLen(1))
+	g.Expect(requests[0].Body).To(HaveKeyWithValue("hardware_reservation_id", "r1"))
+	g.Expect(claims.IsDeprovisioning("r1")).To(BeFalse())
+	g.Expect(claims.Claim("r1", "other")).To(BeFalse())
+}
+
+func TestIsReservationProvisionable(t *testing.T) {
+	tests := []struct {
+		name              string
+		response          fakeResponse
+		wantProvisionable bool
+		wantErr           bool
+	}{
+		{
+			name:              "provisionable",
+			response:          fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "reservation", "provisionable": true}},
+			wantProvisionable: true,
+		},
+		{
+			name:     "deprovisioning",
+			response: fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "reservation", "provisionable": false}},
+		},
+		{
+			name: "with a device",
+			response: fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+				"id": "reservation", "provisionable": true, "device": map[string]string{"id": "device"},
+			}},
+		},
+		{
+			name:     "unknown reservation",
+			response: fakeResponse{status: http.StatusNotFound, body: apiError("Not found")},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/hardware-reservations/reservation", tt.response)
+
+			provisionable, err := c.IsReservationProvisionable("reservation")
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(provisionable).To(Equal(tt.wantProvisionable))
+		})
+	}
+}
+
+func TestFindDevice(t *testing.T) {
+	tests := []struct {
+		name       string
+		ref        infrastructurev1alpha3.DeviceReference
+		wantID     string
+		wantReason packeterrors.Reason
+	}{
+		{
+			name:   "by id",
+			ref:    infrastructurev1alpha3.DeviceReference{ID: "device-2"},
+			wantID: "device-2",
+		},
+		{
+			name:   "by hostname",
+			ref:    infrastructurev1alpha3.DeviceReference{Hostname: "rack1-node3"},
+			wantID: "device-3",
+		},
+		{
+			name:       "unknown hostname",
+			ref:        infrastructurev1alpha3.DeviceReference{Hostname: "rack2-node1"},
+			wantReason: packeterrors.ReasonNotFound,
+		},
+		{
+			name:       "unknown id",
+			ref:        infrastructurev1alpha3.DeviceReference{ID: "device-4"},
+			wantReason: packeterrors.ReasonNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/devices/device-2", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "device-2"}})
+			api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+				"devices": []map[string]string{{"id": "device-1", "hostname": "rack1-node1"}, {"id": "device-3", "hostname": "rack1-node3"}},
+			}})
+
+			dev, err := c.FindDevice("project", &tt.ref)
+			if tt.wantReason != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(packeterrors.ReasonForError(err)).To(Equal(tt.wantReason))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(dev.ID).To(Equal(tt.wantID))
+		})
+	}
+}
+
+func TestGetClusterDevices(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"devices": []map[string]interface{}{
+			{"id": "device-1", "tags": []string{GenerateClusterTag("capi")}},
+			{"id": "device-2", "tags": []string{GenerateClusterTag("other")}},
+			{"id": "device-3"},
+		},
+	}})
+
+	devices, err := c.GetClusterDevices("project", "capi")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(devices).To(HaveLen(1))
+	g.Expect(devices[0].ID).To(Equal("device-1"))
+
+	dev, err := c.GetDeviceByTags("project", []string{GenerateClusterTag("other")})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev.ID).To(Equal("device-2"))
+
+	dev, err = c.GetDeviceByTags("project", []string{GenerateClusterTag("unknown")})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev).To(BeNil())
+}
+
+func TestGetManagedClusterDevices(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"devices": []map[string]interface{}{
+			{"id": "device-1", "tags": []string{GenerateClusterTag("capi"), GenerateClusterUIDTag("uid")}},
+			// a cluster with the same name in another namespace
+			{"id": "device-2", "tags": []string{GenerateClusterTag("capi"), GenerateClusterUIDTag("other")}},
+			{"id": "device-3", "tags": []string{GenerateClusterTag("capi")}},
+		},
+	}})
+
+	devices, err := c.GetManagedClusterDevices("project", "uid")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(devices).To(HaveLen(1))
+	g.Expect(devices[0].ID).To(Equal("device-1"))
+}
+
+func TestDeviceHostname(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"devices": []map[string]interface{}{
+			{"id": "device-1", "hostname": "worker-0"},
+			{"id": "device-2", "hostname": "worker-1-3f2a1", "tags": []string{GenerateMachineTag("uid-1")}},
+		},
+	}})
+
+	dev, hostname, err := c.DeviceHostname("project", "worker-1", GenerateMachineTag("uid-1"), "3f2a1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev.ID).To(Equal("device-2"))
+	g.Expect(hostname).To(BeEmpty())
+
+	dev, hostname, err = c.DeviceHostname("project", "worker-0", GenerateMachineTag("uid-0"), "9c1e0")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev).To(BeNil())
+	g.Expect(hostname).To(Equal("worker-0-9c1e0"))
+
+	dev, hostname, err = c.DeviceHostname("project", "worker-2", GenerateMachineTag("uid-2"), "77b0d")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dev).To(BeNil())
+	g.Expect(hostname).To(Equal("worker-2"))
+
+	g.Expect(HostnameSuffix("3f2a1c4e-0b7d-4e5f-9a8b-1c2d3e4f5a6b")).To(Equal("3f2a1"))
+	g.Expect(HostnameSuffix("ab")).To(Equal("ab"))
+}
+
+func TestMachineHostname(t *testing.T) {
+	g := NewWithT(t)
+
+	machineScope := newTestMachineScope(t, infrastructurev1alpha3.PacketMachineSpec{}, infrastructurev1alpha3.PacketClusterSpec{}, "")
+	g.Expect(MachineHostname(machineScope)).To(Equal("worker-0"))
+
+	machineScope.PacketCluster.Spec.DNSZone = &infrastructurev1alpha3.DNSZone{Name: "k8s.example.com."}
+	g.Expect(MachineHostname(machineScope)).To(Equal("worker-0"))
+
+	machineScope.PacketCluster.Spec.DNSZone.DeviceHostnames = true
+	g.Expect(MachineHostname(machineScope)).To(Equal("worker-0.capi.k8s.example.com"))
+
+	// the suffix keeps the domain
+	g.Expect(SuffixHostname("worker-0.capi.k8s.example.com", "9c1e0")).To(Equal("worker-0-9c1e0.capi.k8s.example.com"))
+	g.Expect(SuffixHostname("worker-0", "9c1e0")).To(Equal("worker-0-9c1e0"))
+}
+
+func TestDeleteDevices(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("DELETE", "/devices/device-1", fakeResponse{status: http.StatusNoContent})
+	api.on("DELETE", "/devices/device-3", fakeResponse{status: http.StatusInternalServerError, body: apiError("internal error")})
+
+	// device-2 is already gone, it counts as deleted
+	deleted, errs := c.DeleteDevices([]string{"device-1", "device-2", "device-3"}, 2)
+	g.Expect(deleted).To(Equal(2))
+	g.Expect(errs).To(HaveLen(1))
+	g.Expect(errs[0].Error()).To(ContainSubstring("device-3"))
+
+	g.Expect(api.requestsTo("DELETE", "/devices/device-1")[0].Body).To(HaveKeyWithValue("force_delete", true))
+	g.Expect(packeterrors.IsNotFound(c.DeleteDevice("device-2"))).To(BeTrue())
+}
+
+func TestDeviceBootActions(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/devices/device/actions", fakeResponse{status: http.StatusAccepted})
+	api.on("PUT", "/devices/device", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "device", "always_pxe": true}})
+
+	g.Expect(c.RescueDevice("device")).To(Succeed())
+	g.Expect(c.RebootDevice("device")).To(Succeed())
+	actions := api.requestsTo("POST", "/devices/device/actions")
+	g.Expect(actions).To(HaveLen(2))
+	g.Expect(actions[0].Body).To(HaveKeyWithValue("type", "rescue"))
+	g.Expect(actions[1].Body).To(HaveKeyWithValue("type", "reboot"))
+
+	g.Expect(c.SetDeviceBootOrder("device", infrastructurev1alpha3.BootOrderPXE)).To(Succeed())
+	g.Expect(api.requestsTo("PUT", "/devices/device")[0].Body).To(HaveKeyWithValue("always_pxe", true))
+
+	g.Expect(packeterrors.IsNotFound(c.RescueDevice("gone"))).To(BeTrue())
+}
+
+func TestSetDeviceLocked(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("PATCH", "/devices/device", fakeResponse{status: http.StatusOK})
+
+	g.Expect(c.SetDeviceLocked("device", true)).To(Succeed())
+	g.Expect(c.SetDeviceLocked("device", false)).To(Succeed())
+	requests := api.requestsTo("PATCH", "/devices/device")
+	g.Expect(requests).To(HaveLen(2))
+	g.Expect(requests[0].Body).To(Equal(map[string]interface{}{"locked": true}))
+	g.Expect(requests[1].Body).To(Equal(map[string]interface{}{"locked": false}))
+
+	g.Expect(packeterrors.IsNotFound(c.SetDeviceLocked("gone", true))).To(BeTrue())
+}
+
+func TestDesiredBootOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        infrastructurev1alpha3.BootOrder
+		wantSet     bool
+		wantErr     bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name:        "disk",
+			annotations: map[string]string{infrastructurev1alpha3.BootOrderAnnotation: "disk"},
+			want:        infrastructurev1alpha3.BootOrderDisk,
+			wantSet:     true,
+		},
+		{
+			name:        "pxe",
+			annotations: map[string]string{infrastructurev1alpha3.BootOrderAnnotation: " PXE "},
+			want:        infrastructurev1alpha3.BootOrderPXE,
+			wantSet:     true,
+		},
+		{
+			name:        "invalid",
+			annotations: map[string]string{infrastructurev1alpha3.BootOrderAnnotation: "usb"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			order, set, err := DesiredBootOrder(tt.annotations)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(order).To(Equal(tt.want))
+			g.Expect(set).To(Equal(tt.wantSet))
+		})
+	}
+}
+
+func TestIsReservationProtected(t *testing.T) {
+	tests := []struct {
+		name          string
+		response      fakeResponse
+		wantProtected bool
+		wantErr       bool
+	}{
+		{
+			name:          "protected",
+			response:      fakeResponse{status: http.StatusOK, body: map[string]interface{}{"tags": []string{"team:batch", ProtectedReservationTag}}},
+			wantProtected: true,
+		},
+		{
+			name:     "not protected",
+			response: fakeResponse{status: http.StatusOK, body: map[string]interface{}{"tags": []string{"team:batch"}}},
+		},
+		{
+			name:     "unknown reservation",
+			response: fakeResponse{status: http.StatusNotFound, body: apiError("Not found")},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/hardware-reservations/reservation", tt.response)
+
+			protected, err := c.IsReservationProtected("reservation")
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+			g.Expect(protected).To(Equal(tt.wantProtected))
+		})
+	}
+}
+
+func TestLatestDeviceEvents(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/devices/device/events", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"events": []map[string]string{{"id": "1"}, {"id": "2"}, {"id": "3"}},
+	}})
+
+	events, err := c.LatestDeviceEvents("device", 2)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(events).To(HaveLen(2))
+	g.Expect(events[0].ID).To(Equal("1"))
+}
+
+func TestGetDeviceAddresses(t *testing.T) {
+	device := &packngo.Device{Network: []*packngo.IPAddressAssignment{
+		{IpAddressCommon: packngo.IpAddressCommon{ID: "a1", Address: "147.75.1.1", AddressFamily: 4, Public: true, Management: true, CIDR: 31}},
+		{IpAddressCommon: packngo.IpAddressCommon{ID: "a2", Address: "10.0.0.1", AddressFamily: 4, Management: true, CIDR: 31}},
+		{IpAddressCommon: packngo.IpAddressCommon{ID: "a3", Address: "2604:1380::1", AddressFamily: 6, Public: true, Management: true, CIDR: 127}},
+	}}
+
+	tests := []struct {
+		name   string
+		family infrastructurev1alpha3.NodeIPFamily
+		want   []string
+	}{
+		{name: "every address by default", want: []string{"147.75.1.1", "10.0.0.1", "2604:1380::1"}},
+		{name: "ipv4", family: infrastructurev1alpha3.NodeIPFamilyIPv4, want: []string{"147.75.1.1", "10.0.0.1"}},
+		{name: "ipv6", family: infrastructurev1alpha3.NodeIPFamilyIPv6, want: []string{"2604:1380::1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			addrs, err := (&PacketClient{}).GetDeviceAddresses(device, tt.family)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			got := []string{}
+			for _, addr := range addrs {
+				got = append(got, addr.Address)
+			}
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+
+	g := NewWithT(t)
+	addrs, _ := (&PacketClient{}).GetDeviceAddresses(device, "")
+	g.Expect(NodeAddresses(addrs)).To(Equal([]corev1.NodeAddress{
+		{Type: corev1.NodeExternalIP, Address: "147.75.1.1"},
+		{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		{Type: corev1.NodeExternalIP, Address: "2604:1380::1"},
+	}))
+}
+
+func TestGetDeviceAddressesActive(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/devices/device/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"ip_addresses": []map[string]interface{}{
+			{"id": "a1", "address": "147.75.1.1", "address_family": 4, "public": true, "management": true, "cidr": 31},
+			{"id": "eip", "address": "147.75.2.2", "address_family": 4, "public": true, "cidr": 32},
+		},
+	}})
+	api.on(http.MethodGet, "/devices/device/bgp/sessions", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"bgp_sessions": []map[string]interface{}{
+			{"id": "session", "address_family": "ipv4", "learned_routes": []string{"147.75.2.2/32", "147.75.3.3/32", "10.10.0.1/32"}},
+		},
+	}})
+
+	device := &packngo.Device{ID: "device", State: "active", Network: []*packngo.IPAddressAssignment{
+		{IpAddressCommon: packngo.IpAddressCommon{ID: "a1", Address: "147.75.1.1", AddressFamily: 4, Public: true, Management: true, CIDR: 31}},
+	}}
+	addrs, err := c.GetDeviceAddresses(device, "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(addrs).To(Equal([]infrastructurev1alpha3.DeviceAddress{
+		{Type: corev1.NodeExternalIP, Address: "147.75.1.1", CIDR: 31, AddressFamily: 4, Public: true, Management: true, AssignmentID: "a1"},
+		{Type: corev1.NodeExternalIP, Address: "147.75.2.2", CIDR: 32, AddressFamily: 4, Public: true, AssignmentID: "eip"},
+		{Type: corev1.NodeExternalIP, Address: "147.75.3.3", CIDR: 32, AddressFamily: 4, Public: true, Announced: true},
+		{Type: corev1.NodeExternalIP, Address: "10.10.0.1", CIDR: 32, AddressFamily: 4, Announced: true},
+	}))
+	g.Expect(HasDeviceAddress(addrs, "147.75.3.3")).To(BeTrue())
+	g.Expect(HasDeviceAddress(addrs, "147.75.4.4")).To(BeFalse())
+
+	addrs, err = c.GetDeviceAddresses(device, infrastructurev1alpha3.NodeIPFamilyIPv6)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(addrs).To(BeEmpty())
+}
+
+func TestVerifyUserData(t *testing.T) {
+	g := NewWithT(t)
+
+	userData := "#cloud-config\nruncmd:\n- kubeadm join\n"
+	hash := UserDataHash(userData)
+
+	g.Expect(VerifyUserData(&packngo.Device{UserData: userData}, hash)).To(Succeed())
+	g.Expect(VerifyUserData(&packngo.Device{UserData: userData[:10]}, hash)).NotTo(Succeed())
+	g.Expect(VerifyUserData(&packngo.Device{}, hash)).NotTo(Succeed())
+}
+
+func TestDeviceReservationID(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(DeviceReservationID(&packngo.Device{})).To(BeEmpty())
+	g.Expect(DeviceReservationID(&packngo.Device{
+		HardwareReservation: packngo.Href{Href: "/hardware-reservations/8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e"},
+	})).To(Equal("8d3ba9f1-3a5c-4c6e-9f5b-2f0b4c0a1d2e"))
+}
+
+func TestJoinEndpoint(t *testing.T) {
+	endpoint := clusterv1.APIEndpoint{Host: "147.75.1.1", Port: 6443}
+
+	tests := []struct {
+		name        string
+		override    string
+		endpoint    clusterv1.APIEndpoint
+		want        string
+		wantInvalid bool
+	}{
+		{name: "control plane endpoint of the cluster", endpoint: endpoint, want: "147.75.1.1:6443"},
+		{name: "control plane endpoint not known yet", want: ""},
+		{name: "ipv6 control plane endpoint", endpoint: clusterv1.APIEndpoint{Host: "2604:1380::1", Port: 6443}, want: "[2604:1380::1]:6443"},
+		{name: "host override", override: "api.internal", endpoint: endpoint, want: "api.internal"},
+		{name: "host and port override", override: "10.0.0.10:443", endpoint: endpoint, want: "10.0.0.10:443"},
+		{name: "invalid port", override: "10.0.0.10:https", endpoint: endpoint, wantInvalid: true},
+		{name: "url", override: "https://api.internal", endpoint: endpoint, wantInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			machineScope := newTestMachineScope(t,
+				infrastructurev1alpha3.PacketMachineSpec{JoinEndpointOverride: tt.override},
+				infrastructurev1alpha3.PacketClusterSpec{ControlPlaneEndpoint: tt.endpoint},
+				"#!/bin/sh\necho {{ .joinEndpoint }}\n")
+
+			joinEndpoint, err := JoinEndpoint(machineScope)
+			if tt.wantInvalid {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue(), "unexpected error %v", err)
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(joinEndpoint).To(Equal(tt.want))
+			if tt.want == "" {
+				return
+			}
+
+			_, c := newFakeAPI(t)
+			userData, _, err := c.renderDevice(CreateDeviceRequest{MachineScope: machineScope})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(userData).To(Equal("#!/bin/sh\necho " + tt.want + "\n"))
+		})
+	}
+}
+
+func TestStartupTaint(t *testing.T) {
+	g := NewWithT(t)
+	_, c := newFakeAPI(t)
+	template := "#!/bin/sh\nkubelet --register-with-taints={{ .startupTaint }}\n"
+
+	machineScope := newTestMachineScope(t, infrastructurev1alpha3.PacketMachineSpec{StartupTaint: true}, infrastructurev1alpha3.PacketClusterSpec{}, template)
+	userData, _, err := c.renderDevice(CreateDeviceRequest{MachineScope: machineScope})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(userData).To(Equal("#!/bin/sh\nkubelet --register-with-taints=packetmachine.infrastructure.cluster.x-k8s.io/startup:NoSchedule\n"))
+
+	machineScope = newTestMachineScope(t, infrastructurev1alpha3.PacketMachineSpec{}, infrastructurev1alpha3.PacketClusterSpec{}, template)
+	userData, _, err = c.renderDevice(CreateDeviceRequest{MachineScope: machineScope})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(userData).To(Equal("#!/bin/sh\nkubelet --register-with-taints=\n"))
+}
+
+func TestNewDeviceBootstrapFormats(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         map[string][]byte
+		wantUserData string
+		wantInvalid  bool
+	}{
+		{
+			name:         "kubeadm cloud-config",
+			data:         map[string][]byte{"value": []byte("#cloud-config\nruncmd:\n- echo {{ .kubernetesVersion }}\n- kubeadm join --config /run/kubeadm/kubeadm-join-config.yaml\n")},
+			wantUserData: "#cloud-config\nruncmd:\n- echo v1.20.4\n- kubeadm join --config /run/kubeadm/kubeadm-join-config.yaml\n",
+		},
+		{
+			name: "k0s cloud-config with its format",
+			data: map[string][]byte{
+				"value":  []byte("#cloud-config\nruncmd:\n- k0s install worker --token-file /etc/k0s.token\n- echo {{ .nodeIPFamily }}\n"),
+				"format": []byte("cloud-config"),
+			},
+			wantUserData: "#cloud-config\nruncmd:\n- k0s install worker --token-file /etc/k0s.token\n- echo dual\n",
+		},
+		{
+			name:         "talos machine configuration",
+			data:         map[string][]byte{"value": []byte("version: v1alpha1\nmachine:\n  type: worker\n  kubelet:\n    image: ghcr.io/siderolabs/kubelet:{{ .kubernetesVersion }}\ncluster:\n  controlPlane:\n    endpoint: https://147.75.1.1:6443\n")},
+			wantUserData: "version: v1alpha1\nmachine:\n  type: worker\n  kubelet:\n    image: ghcr.io/siderolabs/kubelet:v1.20.4\ncluster:\n  controlPlane:\n    endpoint: https://147.75.1.1:6443\n",
+		},
+		{
+			name: "ignition config with its format",
+			data: map[string][]byte{
+				"value":  []byte(`{"ignition":{"version":"2.3.0"},"storage":{"files":[{"path":"/etc/kubernetes-version","contents":{"source":"data:,{{ .kubernetesVersion }}"}}]}}`),
+				"format": []byte("ignition"),
+			},
+			wantUserData: `{"ignition":{"version":"2.3.0"},"storage":{"files":[{"path":"/etc/kubernetes-version","contents":{"source":"data:,v1.20.4"}}]}}`,
+		},
+		{
+			name: "ignition config broken by a template variable",
+			data: map[string][]byte{
+				"value":  []byte(`{"ignition":{"version":"2.3.0"},"passwd":{{ .nodeIPFamily }}}`),
+				"format": []byte("ignition"),
+			},
+			wantInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+			machineScope := newTestMachineScopeWithBootstrapData(t,
+				infrastructurev1alpha3.PacketMachineSpec{OS: "flatcar_stable", MachineType: "c3.small.x86", BillingCycle: "hourly"},
+				infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"},
+				tt.data)
+
+			_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope})
+			requests := api.requestsTo("POST", "/projects/project/devices")
+			if tt.wantInvalid {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue(), "unexpected error %v", err)
+				g.Expect(requests).To(BeEmpty())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(requests).To(HaveLen(1))
+			g.Expect(requests[0].Body).To(HaveKeyWithValue("userdata", tt.wantUserData))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dns registers the addresses of a cluster in its DNS zone through
+// external-dns DNSEndpoint objects. external-dns publishes them to the DNS
+// provider it is configured with.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// EndpointGroupVersionKind is the kind of the external-dns DNSEndpoint objects.
+var EndpointGroupVersionKind = schema.GroupVersionKind{
+	Group:   "externaldns.k8s.io",
+	Version: "v1alpha1",
+	Kind:    "DNSEndpoint",
+}
+
+// Record is a DNS record set.
+type Record struct {
+	DNSName    string
+	RecordType string
+	Targets    []string
+}
+
+// ControlPlaneName returns the name the control plane endpoint is registered as.
+func ControlPlaneName(zone *infrav1.DNSZone, clusterName string) string {
+	return fmt.Sprintf("api.%s.%s", clusterName, strings.TrimSuffix(zone.Name, "."))
+}
+
+// ControlPlaneRecords returns the records of the control plane endpoint
+// host, an ip address or a host name.
+func ControlPlaneRecords(zone *infrav1.DNSZone, clusterName, host string) []Record {
+	name := ControlPlaneName(zone, clusterName)
+	ip := net.ParseIP(host)
+	switch {
+	case host == "":
+		return nil
+	case ip == nil:
+		return []Record{{DNSName: name, RecordType: "CNAME", Targets: []string{host}}}
+	case ip.To4() != nil:
+		return []Record{{DNSName: name, RecordType: "A", Targets: []string{host}}}
+	default:
+		return []Record{{DNSName: name, RecordType: "AAAA", Targets: []string{host}}}
+	}
+}
+
+// MachineDomain returns the domain the machines of a cluster are registered
+// in, <cluster>.<zone>.
+func MachineDomain(zone *infrav1.DNSZone, clusterName string) string {
+	return fmt.Sprintf("%s.%s", clusterName, strings.TrimSuffix(zone.Name, "."))
+}
+
+// MachineRecords returns the records of the addresses natively assigned to
+// the device of a machine: <hostname>.<cluster>.<zone> for the public ones,
+// <hostname>.private.<cluster>.<zone> for the private ones. Elastic addresses,
+// such as the control plane one, are left out.
+func MachineRecords(zone *infrav1.DNSZone, clusterName, hostname string, addrs []infrav1.DeviceAddress) []Record {
+	domain := MachineDomain(zone, clusterName)
+	publicName := fmt.Sprintf("%s.%s", hostname, domain)
+	privateName := fmt.Sprintf("%s.private.%s", hostname, domain)
+
+	type recordKey struct {
+		DNSName    string
+		RecordType string
+	}
+	targets := map[recordKey][]string{}
+	order := []recordKey{}
+	for _, addr := range addrs {
+		if !addr.Management {
+			continue
+		}
+		key := recordKey{DNSName: privateName, RecordType: "A"}
+		if addr.Public {
+			key.DNSName = publicName
+		}
+		if addr.AddressFamily == 6 {
+			key.RecordType = "AAAA"
+		}
+		if _, ok := targets[key]; !ok {
+			order = append(order, key)
+		}
+		targets[key] = append(targets[key], addr.Address)
+	}
+
+	records := make([]Record, 0, len(order))
+	for _, key := range order {
+		records = append(records, Record{DNSName: key.DNSName, RecordType: key.RecordType, Targets: targets[key]})
+	}
+	return records
+}
+
+// EnsureEndpoint creates or updates the DNSEndpoint holding the records. It
+// is owned by owner, so that the records are removed with it, and carries
+// labels, keeping the labels added by others.
+func EnsureEndpoint(ctx context.Context, c client.Client, namespace, name string, owner metav1.OwnerReference, labels map[string]string, zone *infrav1.DNSZone, records []Record) error {
+	endpoint := &unstructured.Unstructured{}
+	endpoint.SetGroupVersionKind(EndpointGroupVersionKind)
+	endpoint.SetNamespace(namespace)
+	endpoint.SetName(name)
+
+	_, err := controllerutil.CreateOrUpdate(ctx, c, endpoint, func() error {
+		endpoint.SetOwnerReferences([]metav1.OwnerReference{owner})
+		endpointLabels := endpoint.GetLabels()
+		if endpointLabels == nil {
+			endpointLabels = make(map[string]string, len(labels))
+		}
+		for key, value := range labels {
+			endpointLabels[key] = value
+		}
+		endpoint.SetLabels(endpointLabels)
+
+		endpoints := make([]interface{}, 0, len(records))
+		for _, r := range records {
+			targets := make([]interface{}, 0, len(r.Targets))
+			for _, t := range r.Targets {
+				targets = append(targets, t)
+			}
+			e := map[string]interface{}{
+				"dnsName":    r.DNSName,
+				"recordType": r.RecordType,
+				"targets":    targets,
+			}
+			if zone.TTL > 0 {
+				e["recordTTL"] = zone.TTL
+			}
+			endpoints = append(endpoints, e)
+		}
+		return unstructured.SetNestedSlice(endpoint.Object, endpoints, "spec", "endpoints")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update DNSEndpoint %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dns
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestControlPlaneRecords(t *testing.T) {
+	g := NewWithT(t)
+	zone := &infrav1.DNSZone{Name: "example.com."}
+
+	g.Expect(ControlPlaneRecords(zone, "capi", "")).To(BeEmpty())
+	g.Expect(ControlPlaneRecords(zone, "capi", "147.75.1.2")).To(Equal([]Record{
+		{DNSName: "api.capi.example.com", RecordType: "A", Targets: []string{"147.75.1.2"}},
+	}))
+	g.Expect(ControlPlaneRecords(zone, "capi", "2604:1380::1")).To(Equal([]Record{
+		{DNSName: "api.capi.example.com", RecordType: "AAAA", Targets: []string{"2604:1380::1"}},
+	}))
+	g.Expect(ControlPlaneRecords(zone, "capi", "lb.example.net")).To(Equal([]Record{
+		{DNSName: "api.capi.example.com", RecordType: "CNAME", Targets: []string{"lb.example.net"}},
+	}))
+}
+
+func TestMachineRecords(t *testing.T) {
+	g := NewWithT(t)
+	zone := &infrav1.DNSZone{Name: "example.com"}
+
+	addrs := []infrav1.DeviceAddress{
+		{Address: "147.75.1.2", AddressFamily: 4, Public: true, Management: true},
+		{Address: "2604:1380::2", AddressFamily: 6, Public: true, Management: true},
+		{Address: "10.0.0.2", AddressFamily: 4, Public: false, Management: true},
+		{Address: "147.75.9.9", AddressFamily: 4, Public: true, Management: false},
+	}
+
+	g.Expect(MachineRecords(zone, "capi", "worker-0", addrs)).To(Equal([]Record{
+		{DNSName: "worker-0.capi.example.com", RecordType: "A", Targets: []string{"147.75.1.2"}},
+		{DNSName: "worker-0.capi.example.com", RecordType: "AAAA", Targets: []string{"2604:1380::2"}},
+		{DNSName: "worker-0.private.capi.example.com", RecordType: "A", Targets: []string{"10.0.0.2"}},
+	}))
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+const (
+	// EgressIPsKey is the key of the egress ConfigMap of a cluster listing
+	// its egress addresses, one per line.
+	EgressIPsKey = "ips"
+	// EgressCIDRsKey is the key of the egress ConfigMap of a cluster listing
+	// its egress addresses as single address CIDRs, one per line, as
+	// firewall allow-lists take them.
+	EgressCIDRsKey = "cidrs"
+)
+
+// EgressIPs returns the public addresses the workloads of a cluster may use
+// as egress source: the public addresses of the devices of its machines,
+// native and elastic, and the control plane addresses reserved for the
+// cluster. They are sorted, IPv4 first.
+func EgressIPs(packetCluster *infrastructurev1alpha3.PacketCluster, machines []infrastructurev1alpha3.PacketMachine) []string {
+	seen := map[string]net.IP{}
+	add := func(address string) {
+		if ip := net.ParseIP(address); ip != nil {
+			seen[ip.String()] = ip
+		}
+	}
+
+	add(packetCluster.Spec.ControlPlaneEndpoint.Host)
+	for _, location := range packetCluster.Status.ControlPlaneTopology {
+		add(location.Address)
+	}
+	for _, machine := range machines {
+		for _, address := range machine.Status.DeviceAddresses {
+			if address.Public {
+				add(address.Address)
+			}
+		}
+	}
+
+	ips := make([]string, 0, len(seen))
+	for address := range seen {
+		ips = append(ips, address)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		iv4, jv4 := seen[ips[i]].To4() != nil, seen[ips[j]].To4() != nil
+		if iv4 != jv4 {
+			return iv4
+		}
+		return bytes.Compare(seen[ips[i]].To16(), seen[ips[j]].To16()) < 0
+	})
+	return ips
+}
+
+// EgressConfigMapData returns the data of the egress ConfigMap of a cluster
+// with the egress addresses ips.
+func EgressConfigMapData(ips []string) map[string]string {
+	cidrs := make([]string, 0, len(ips))
+	for _, address := range ips {
+		if strings.Contains(address, ":") {
+			cidrs = append(cidrs, address+"/128")
+			continue
+		}
+		cidrs = append(cidrs, address+"/32")
+	}
+	return map[string]string{
+		EgressIPsKey:   strings.Join(ips, "\n"),
+		EgressCIDRsKey: strings.Join(cidrs, "\n"),
+	}
+}
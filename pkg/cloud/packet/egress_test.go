@@ -0,0 +1,66 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestEgressIPs(t *testing.T) {
+	g := NewWithT(t)
+	packetCluster := &infrastructurev1alpha3.PacketCluster{
+		Spec: infrastructurev1alpha3.PacketClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "147.75.100.1", Port: 6443},
+		},
+		Status: infrastructurev1alpha3.PacketClusterStatus{
+			ControlPlaneTopology: []infrastructurev1alpha3.ControlPlaneLocation{
+				{Address: "147.75.100.1"},
+				{Facility: "ewr1", Address: "147.75.9.1"},
+			},
+		},
+	}
+	machine := func(addresses ...infrastructurev1alpha3.DeviceAddress) infrastructurev1alpha3.PacketMachine {
+		return infrastructurev1alpha3.PacketMachine{Status: infrastructurev1alpha3.PacketMachineStatus{DeviceAddresses: addresses}}
+	}
+	machines := []infrastructurev1alpha3.PacketMachine{
+		machine(
+			infrastructurev1alpha3.DeviceAddress{Address: "147.75.10.2", Public: true, Management: true},
+			infrastructurev1alpha3.DeviceAddress{Address: "2604:1380:0:1::3", Public: true, Management: true},
+			infrastructurev1alpha3.DeviceAddress{Address: "10.99.0.3", Management: true},
+			infrastructurev1alpha3.DeviceAddress{Address: "147.75.100.1", Public: true},
+		),
+		machine(infrastructurev1alpha3.DeviceAddress{Address: "147.75.10.10", Public: true, Management: true}),
+		machine(),
+	}
+
+	ips := EgressIPs(packetCluster, machines)
+	g.Expect(ips).To(Equal([]string{"147.75.9.1", "147.75.10.2", "147.75.10.10", "147.75.100.1", "2604:1380:0:1::3"}))
+
+	g.Expect(EgressConfigMapData(ips)).To(Equal(map[string]string{
+		EgressIPsKey:   "147.75.9.1\n147.75.10.2\n147.75.10.10\n147.75.100.1\n2604:1380:0:1::3",
+		EgressCIDRsKey: "147.75.9.1/32\n147.75.10.2/32\n147.75.10.10/32\n147.75.100.1/32\n2604:1380:0:1::3/128",
+	}))
+
+	// clusters whose control plane endpoint is a hostname have no address for it
+	packetCluster = &infrastructurev1alpha3.PacketCluster{Spec: infrastructurev1alpha3.PacketClusterSpec{ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "lb.example.net"}}}
+	g.Expect(EgressIPs(packetCluster, nil)).To(BeEmpty())
+}
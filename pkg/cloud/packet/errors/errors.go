@@ -0,0 +1,238 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package errors classifies the errors returned by the Packet API so that the
+// reconcilers can decide whether to requeue, fail or ignore them without
+// parsing error messages.
+package errors
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/packethost/packngo"
+)
+
+// Reason is the class of a Packet API error.
+type Reason string
+
+const (
+	// ReasonUnknown is used for the errors that do not fall in any other class.
+	ReasonUnknown Reason = "Unknown"
+	// ReasonNotFound means the resource does not exist.
+	ReasonNotFound Reason = "NotFound"
+	// ReasonQuotaExceeded means the project or the organization hit a limit.
+	ReasonQuotaExceeded Reason = "QuotaExceeded"
+	// ReasonForbidden means the credentials are invalid or lack permissions.
+	ReasonForbidden Reason = "Forbidden"
+	// ReasonRateLimited means the API throttled the request.
+	ReasonRateLimited Reason = "RateLimited"
+	// ReasonConflict means the request conflicts with the current state of a
+	// resource, e.g. a hardware reservation already in use. Retrying later can
+	// succeed.
+	ReasonConflict Reason = "Conflict"
+	// ReasonInvalidOS means the operating system is unknown or can not be
+	// installed on the plan.
+	ReasonInvalidOS Reason = "InvalidOS"
+	// ReasonNoCapacity means the location has no hardware left for the plan.
+	// Retrying later, or elsewhere, can succeed.
+	ReasonNoCapacity Reason = "NoCapacity"
+	// ReasonApprovalRequired means the organization has to be approved by
+	// Packet before using the plan or the location. Retrying does not help
+	// until someone requests the approval.
+	ReasonApprovalRequired Reason = "ApprovalRequired"
+)
+
+// conflictMessages are the 422 messages the API returns when a request can not
+// be fulfilled right now, but could be later.
+var conflictMessages = []string{
+	"no available hardware reservations",
+	"server is not provisionable",
+}
+
+// capacityMessages are the 422 and 503 messages the API returns when there is
+// no hardware left for a plan.
+var capacityMessages = []string{
+	"not enough capacity",
+	"no capacity",
+	"servers available",
+}
+
+// invalidOSMessages are the 422 messages the API returns for an operating
+// system it can not install.
+var invalidOSMessages = []string{
+	"operating system",
+	"invalid os",
+}
+
+// quotaMessages are the 422 messages the API returns when a limit is hit.
+var quotaMessages = []string{
+	"quota",
+	"limit reached",
+}
+
+// approvalMessages are the 422 messages the API returns when the organization
+// lacks the approval a request needs.
+var approvalMessages = []string{
+	"approval",
+}
+
+// PacketError is an error returned by the Packet API, tagged with its class.
+type PacketError struct {
+	Reason     Reason
+	StatusCode int
+	Err        error
+}
+
+func (e *PacketError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PacketError) Unwrap() error {
+	return e.Err
+}
+
+// New returns a PacketError wrapping err with the given reason.
+func New(reason Reason, err error) error {
+	return &PacketError{Reason: reason, Err: err}
+}
+
+// Wrap classifies an error returned by packngo. A nil error stays nil and an
+// error that is already classified is returned as is.
+func Wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	var perr *PacketError
+	if errors.As(err, &perr) {
+		return err
+	}
+
+	var resp *packngo.ErrorResponse
+	if !errors.As(err, &resp) || resp.Response == nil {
+		return &PacketError{Reason: ReasonUnknown, Err: err}
+	}
+	return &PacketError{
+		Reason:     reasonForResponse(resp),
+		StatusCode: resp.Response.StatusCode,
+		Err:        err,
+	}
+}
+
+func reasonForResponse(resp *packngo.ErrorResponse) Reason {
+	switch resp.Response.StatusCode {
+	case http.StatusNotFound:
+		return ReasonNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ReasonForbidden
+	case http.StatusTooManyRequests:
+		return ReasonRateLimited
+	case http.StatusConflict:
+		return ReasonConflict
+	case http.StatusServiceUnavailable:
+		if containsAny(responseMessage(resp), capacityMessages) {
+			return ReasonNoCapacity
+		}
+	case http.StatusUnprocessableEntity:
+		message := responseMessage(resp)
+		switch {
+		case containsAny(message, conflictMessages):
+			return ReasonConflict
+		case containsAny(message, capacityMessages):
+			return ReasonNoCapacity
+		case containsAny(message, approvalMessages):
+			return ReasonApprovalRequired
+		case containsAny(message, quotaMessages):
+			return ReasonQuotaExceeded
+		case containsAny(message, invalidOSMessages):
+			return ReasonInvalidOS
+		}
+	}
+	return ReasonUnknown
+}
+
+func responseMessage(resp *packngo.ErrorResponse) string {
+	return strings.ToLower(strings.Join(resp.Errors, " ") + " " + resp.SingleError)
+}
+
+func containsAny(message string, substrings []string) bool {
+	for _, s := range substrings {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReasonForError returns the class of err, ReasonUnknown when it is not a
+// PacketError.
+func ReasonForError(err error) Reason {
+	var perr *PacketError
+	if errors.As(err, &perr) {
+		return perr.Reason
+	}
+	return ReasonUnknown
+}
+
+// IsNotFound returns true if err is a NotFound PacketError.
+func IsNotFound(err error) bool {
+	return ReasonForError(err) == ReasonNotFound
+}
+
+// IsQuotaExceeded returns true if err is a QuotaExceeded PacketError.
+func IsQuotaExceeded(err error) bool {
+	return ReasonForError(err) == ReasonQuotaExceeded
+}
+
+// IsForbidden returns true if err is a Forbidden PacketError.
+func IsForbidden(err error) bool {
+	return ReasonForError(err) == ReasonForbidden
+}
+
+// IsRateLimited returns true if err is a RateLimited PacketError.
+func IsRateLimited(err error) bool {
+	return ReasonForError(err) == ReasonRateLimited
+}
+
+// IsConflict returns true if err is a Conflict PacketError.
+func IsConflict(err error) bool {
+	return ReasonForError(err) == ReasonConflict
+}
+
+// IsInvalidOS returns true if err is an InvalidOS PacketError.
+func IsInvalidOS(err error) bool {
+	return ReasonForError(err) == ReasonInvalidOS
+}
+
+// IsNoCapacity returns true if err is a NoCapacity PacketError.
+func IsNoCapacity(err error) bool {
+	return ReasonForError(err) == ReasonNoCapacity
+}
+
+// IsApprovalRequired returns true if err is an ApprovalRequired PacketError.
+func IsApprovalRequired(err error) bool {
+	return ReasonForError(err) == ReasonApprovalRequired
+}
+
+// IsRetryable returns true if retrying the request later can succeed.
+func IsRetryable(err error) bool {
+	switch ReasonForError(err) {
+	case ReasonRateLimited, ReasonConflict, ReasonQuotaExceeded, ReasonNoCapacity:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+)
+
+func errorResponse(status int, messages ...string) error {
+	return &packngo.ErrorResponse{
+		Response: &http.Response{
+			StatusCode: status,
+			Request:    &http.Request{Method: http.MethodPost},
+		},
+		Errors: messages,
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected Reason
+	}{
+		{
+			name:     "not found",
+			err:      errorResponse(http.StatusNotFound, "Not found"),
+			expected: ReasonNotFound,
+		},
+		{
+			name:     "invalid token",
+			err:      errorResponse(http.StatusUnauthorized, "Invalid authentication token"),
+			expected: ReasonForbidden,
+		},
+		{
+			name:     "rate limited",
+			err:      errorResponse(http.StatusTooManyRequests),
+			expected: ReasonRateLimited,
+		},
+		{
+			name:     "no hardware reservation available",
+			err:      errorResponse(http.StatusUnprocessableEntity, "Oh snap, no available hardware reservations for this plan"),
+			expected: ReasonConflict,
+		},
+		{
+			name:     "quota",
+			err:      errorResponse(http.StatusUnprocessableEntity, "You have reached the quota of ip reservations"),
+			expected: ReasonQuotaExceeded,
+		},
+		{
+			name:     "approval required",
+			err:      errorResponse(http.StatusUnprocessableEntity, "Plan s3.xlarge.x86 requires approval for your organization"),
+			expected: ReasonApprovalRequired,
+		},
+		{
+			name:     "no capacity",
+			err:      errorResponse(http.StatusUnprocessableEntity, "Oh snap, we don't have enough servers available in ewr1 to fulfill your request"),
+			expected: ReasonNoCapacity,
+		},
+		{
+			name:     "service unavailable for capacity",
+			err:      errorResponse(http.StatusServiceUnavailable, "There is not enough capacity for c3.small.x86 in sjc1"),
+			expected: ReasonNoCapacity,
+		},
+		{
+			name:     "service unavailable",
+			err:      errorResponse(http.StatusServiceUnavailable, "Maintenance in progress"),
+			expected: ReasonUnknown,
+		},
+		{
+			name:     "invalid operating system",
+			err:      errorResponse(http.StatusUnprocessableEntity, "Operating system ubuntu_99_04 is not available for plan c3.small.x86"),
+			expected: ReasonInvalidOS,
+		},
+		{
+			name:     "other unprocessable entity",
+			err:      errorResponse(http.StatusUnprocessableEntity, "hostname is invalid"),
+			expected: ReasonUnknown,
+		},
+		{
+			name:     "wrapped error response",
+			err:      fmt.Errorf("failed to get device: %w", errorResponse(http.StatusNotFound)),
+			expected: ReasonNotFound,
+		},
+		{
+			name:     "not an api error",
+			err:      errors.New("connection refused"),
+			expected: ReasonUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := Wrap(tt.err)
+			g.Expect(ReasonForError(err)).To(Equal(tt.expected))
+			g.Expect(errors.Is(err, tt.err)).To(BeTrue())
+		})
+	}
+}
+
+func TestWrapNil(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(Wrap(nil)).To(BeNil())
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+
+	capierrors "sigs.k8s.io/cluster-api/errors"
+
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// MachineFailure maps an error creating a device to the CAPI failure reason
+// of the machine, and tells whether retrying can succeed. Only the terminal
+// failures belong in the ErrorReason of a PacketMachine: the Machine
+// controller copies it to the FailureReason of the Machine, which is then
+// never reconciled again.
+func MachineFailure(err error) (reason capierrors.MachineStatusError, retryable bool) {
+	switch {
+	case errors.Is(err, ErrNoCapacity):
+		return capierrors.InsufficientResourcesMachineError, true
+	case errors.Is(err, ErrReservationsClaimed), errors.Is(err, ErrReservationsDeprovisioning), errors.Is(err, ErrDeviceNotManaged):
+		return capierrors.CreateMachineError, true
+	case errors.Is(err, ErrInvalidRequest):
+		return capierrors.InvalidConfigurationMachineError, false
+	}
+
+	switch packeterrors.ReasonForError(err) {
+	case packeterrors.ReasonQuotaExceeded, packeterrors.ReasonNoCapacity:
+		return capierrors.InsufficientResourcesMachineError, true
+	case packeterrors.ReasonConflict, packeterrors.ReasonRateLimited:
+		return capierrors.CreateMachineError, true
+	case packeterrors.ReasonInvalidOS, packeterrors.ReasonForbidden, packeterrors.ReasonApprovalRequired:
+		return capierrors.InvalidConfigurationMachineError, false
+	}
+	return capierrors.CreateMachineError, false
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+func TestMachineFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantReason    capierrors.MachineStatusError
+		wantRetryable bool
+	}{
+		{
+			name:          "quota exceeded",
+			err:           packeterrors.New(packeterrors.ReasonQuotaExceeded, errors.New("quota")),
+			wantReason:    capierrors.InsufficientResourcesMachineError,
+			wantRetryable: true,
+		},
+		{
+			name:          "no capacity left in the location",
+			err:           packeterrors.New(packeterrors.ReasonNoCapacity, errors.New("no servers available")),
+			wantReason:    capierrors.InsufficientResourcesMachineError,
+			wantRetryable: true,
+		},
+		{
+			name:          "no facility with capacity",
+			err:           fmt.Errorf("no facility has capacity for plan c3.small.x86: %w", ErrNoCapacity),
+			wantReason:    capierrors.InsufficientResourcesMachineError,
+			wantRetryable: true,
+		},
+		{
+			name:          "reservation conflict",
+			err:           packeterrors.New(packeterrors.ReasonConflict, errors.New("no available hardware reservations")),
+			wantReason:    capierrors.CreateMachineError,
+			wantRetryable: true,
+		},
+		{
+			name:          "rate limited",
+			err:           packeterrors.New(packeterrors.ReasonRateLimited, errors.New("too many requests")),
+			wantReason:    capierrors.CreateMachineError,
+			wantRetryable: true,
+		},
+		{
+			name:          "adopted device not managed",
+			err:           fmt.Errorf("device does not carry the uid tag of the cluster: %w", ErrDeviceNotManaged),
+			wantReason:    capierrors.CreateMachineError,
+			wantRetryable: true,
+		},
+		{
+			name:       "invalid operating system",
+			err:        packeterrors.New(packeterrors.ReasonInvalidOS, errors.New("operating system not available")),
+			wantReason: capierrors.InvalidConfigurationMachineError,
+		},
+		{
+			name:       "approval required",
+			err:        packeterrors.New(packeterrors.ReasonApprovalRequired, errors.New("plan requires approval")),
+			wantReason: capierrors.InvalidConfigurationMachineError,
+		},
+		{
+			name:       "authentication failure",
+			err:        packeterrors.New(packeterrors.ReasonForbidden, errors.New("invalid token")),
+			wantReason: capierrors.InvalidConfigurationMachineError,
+		},
+		{
+			name:       "invalid request",
+			err:        fmt.Errorf("facility ewr1 is not part of metro sv: %w", ErrInvalidRequest),
+			wantReason: capierrors.InvalidConfigurationMachineError,
+		},
+		{
+			name:       "unknown",
+			err:        errors.New("connection reset"),
+			wantReason: capierrors.CreateMachineError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			reason, retryable := MachineFailure(tt.err)
+			g.Expect(reason).To(Equal(tt.wantReason))
+			g.Expect(retryable).To(Equal(tt.wantRetryable))
+		})
+	}
+}
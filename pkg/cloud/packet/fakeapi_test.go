@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/packethost/packngo"
+)
+
+// fakeResponse is a canned response of the fake Packet API.
+type fakeResponse struct {
+	status int
+	header http.Header
+	body   interface{}
+}
+
+// fakeRequest is a request the fake Packet API got, with its decoded body.
+type fakeRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// fakeAPI is a Packet API server answering with canned responses. Requests
+// to routes without a response get a 404, as for a missing resource.
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses map[string][]fakeResponse
+	requests  []fakeRequest
+}
+
+// newFakeAPI starts a fake Packet API and returns a client talking to it.
+func newFakeAPI(t *testing.T) (*fakeAPI, *PacketClient) {
+	api := &fakeAPI{responses: map[string][]fakeResponse{}}
+	server := httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(server.Close)
+
+	c, err := packngo.NewClientWithBaseURL(clientName, "token", nil, server.URL+"/")
+	if err != nil {
+		t.Fatalf("failed to create the packet client: %v", err)
+	}
+	return api, &PacketClient{Client: c}
+}
+
+// on queues responses to the requests to method and path. They are served in
+// order, the last one to every remaining request.
+func (a *fakeAPI) on(method, path string, responses ...fakeResponse) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.responses[method+" "+path] = append(a.responses[method+" "+path], responses...)
+}
+
+// requestsTo returns the requests sent to method and path.
+func (a *fakeAPI) requestsTo(method, path string) []fakeRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	requests := []fakeRequest{}
+	for _, r := range a.requests {
+		if r.Method == method && r.Path == path {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+func (a *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	body := map[string]interface{}{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	a.mu.Lock()
+	a.requests = append(a.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header, Body: body})
+	key := r.Method + " " + r.URL.Path
+	resp := fakeResponse{status: http.StatusNotFound, body: map[string][]string{"errors": {"Not found"}}}
+	if queued := a.responses[key]; len(queued) > 0 {
+		resp = queued[0]
+		if len(queued) > 1 {
+			a.responses[key] = queued[1:]
+		}
+	}
+	a.mu.Unlock()
+
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	if resp.body != nil {
+		_ = json.NewEncoder(w).Encode(resp.body)
+	}
+}
+
+// apiError is the body of a failed Packet API request.
+func apiError(message string) map[string][]string {
+	return map[string][]string{"errors": {message}}
+}
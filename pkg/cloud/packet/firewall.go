@@ -0,0 +1,355 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+const (
+	// projectPrivateNetwork is the range the private addresses of the
+	// devices of a project are allocated from.
+	projectPrivateNetwork = "10.0.0.0/8"
+	// bgpPeersNetwork holds the addresses of the BGP peers of the devices.
+	bgpPeersNetwork = "169.254.255.0/24"
+
+	firewallRulesPath = "/etc/capp/firewall.nft"
+	firewallUnit      = "capp-firewall.service"
+
+	// firewallBoundary separates the parts of the multipart userdata the
+	// firewall is added to. It is fixed for the userdata of a machine to
+	// render the same every time.
+	firewallBoundary = "capp-firewall-boundary"
+)
+
+const firewallUnitContents = `[Unit]
+Description=Cluster API Provider Packet host firewall
+Before=network-pre.target kubelet.service
+Wants=network-pre.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/usr/sbin/nft -f ` + firewallRulesPath + `
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// cloudInitContentTypes are the MIME types of the userdata cloud-init reads,
+// by the first line they start with.
+var cloudInitContentTypes = []struct {
+	prefix      string
+	contentType string
+}{
+	{"#cloud-config", "text/cloud-config"},
+	{"#!", "text/x-shellscript"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#include", "text/x-include-url"},
+	{"## template: jinja", "text/jinja2"},
+}
+
+// cloudInitPart is a part of multipart cloud-init userdata.
+type cloudInitPart struct {
+	contentType, filename, content string
+}
+
+// cloudInitContentType returns the MIME type of userdata, empty when
+// cloud-init does not read it.
+func cloudInitContentType(userData string) string {
+	for _, t := range cloudInitContentTypes {
+		if strings.HasPrefix(userData, t.prefix) {
+			return t.contentType
+		}
+	}
+	return ""
+}
+
+// cloudInitMultipartHeader starts the multipart userdata separated by
+// boundary.
+func cloudInitMultipartHeader(boundary string) string {
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\nMIME-Version: 1.0\n\n", boundary)
+}
+
+// cloudInitMultipart returns the multipart userdata of parts, separated by
+// boundary.
+func cloudInitMultipart(boundary string, parts []cloudInitPart) (string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return "", err
+	}
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType+`; charset="us-ascii"`)
+		header.Set("MIME-Version", "1.0")
+		header.Set("Content-Transfer-Encoding", "7bit")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", part.filename))
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return cloudInitMultipartHeader(boundary) + body.String(), nil
+}
+
+// cloudInitParts returns the parts of the multipart userdata separated by
+// boundary that cloudInitMultipart rendered, false for other userdata.
+func cloudInitParts(userData, boundary string) ([]cloudInitPart, bool, error) {
+	header := cloudInitMultipartHeader(boundary)
+	if !strings.HasPrefix(userData, header) {
+		return nil, false, nil
+	}
+	parts := []cloudInitPart{}
+	reader := multipart.NewReader(strings.NewReader(strings.TrimPrefix(userData, header)), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts, true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, false, err
+		}
+		parts = append(parts, cloudInitPart{
+			contentType: strings.TrimSuffix(part.Header.Get("Content-Type"), `; charset="us-ascii"`),
+			filename:    part.FileName(),
+			content:     string(content),
+		})
+	}
+}
+
+// ValidateNetworkPolicy checks the ranges and ports of a network policy. It
+// returns an ErrInvalidRequest otherwise.
+func ValidateNetworkPolicy(policy *infrastructurev1alpha3.NetworkPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	for field, cidrs := range map[string][]string{
+		"apiServerAllowedCIDRs": policy.APIServerAllowedCIDRs,
+		"sshAllowedCIDRs":       policy.SSHAllowedCIDRs,
+		"nodeCIDRs":             policy.NodeCIDRs,
+	} {
+		for _, cidr := range cidrs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("networkPolicy.%s: %q is not a CIDR: %w", field, cidr, ErrInvalidRequest)
+			}
+		}
+	}
+	for _, port := range policy.AllowedPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("networkPolicy.allowedPorts: %d is not a port: %w", port, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// FirewallRules renders a network policy as an nftables ruleset. The API
+// server rule only applies to control plane devices, on apiServerPort, and
+// always accepts the node networks for the nodes to join.
+func FirewallRules(policy *infrastructurev1alpha3.NetworkPolicy, controlPlane bool, apiServerPort int32) (string, error) {
+	if err := ValidateNetworkPolicy(policy); err != nil {
+		return "", err
+	}
+
+	rules := &strings.Builder{}
+	// declaring the table before deleting it lets the ruleset be applied
+	// again, replacing the previous one
+	rules.WriteString("table inet capp_firewall\n")
+	rules.WriteString("delete table inet capp_firewall\n")
+	rules.WriteString("table inet capp_firewall {\n")
+	rules.WriteString("\tchain input {\n")
+	rules.WriteString("\t\ttype filter hook input priority 0; policy drop;\n")
+	rules.WriteString("\t\tiif \"lo\" accept\n")
+	rules.WriteString("\t\tct state established,related accept\n")
+	rules.WriteString("\t\tct state invalid drop\n")
+	rules.WriteString("\t\tmeta l4proto { icmp, ipv6-icmp } accept\n")
+	writeSourceRules(rules, "", nodeNetworks(policy))
+	writeSourceRules(rules, "tcp dport 179 ", []string{bgpPeersNetwork})
+	if controlPlane {
+		port := fmt.Sprintf("tcp dport %d ", apiServerPort)
+		if len(policy.APIServerAllowedCIDRs) == 0 {
+			fmt.Fprintf(rules, "\t\t%saccept\n", port)
+		} else {
+			writeSourceRules(rules, port, append(nodeNetworks(policy), policy.APIServerAllowedCIDRs...))
+		}
+	}
+	writeSourceRules(rules, "tcp dport 22 ", policy.SSHAllowedCIDRs)
+	if len(policy.AllowedPorts) != 0 {
+		ports := make([]string, 0, len(policy.AllowedPorts))
+		for _, port := range policy.AllowedPorts {
+			ports = append(ports, fmt.Sprint(port))
+		}
+		fmt.Fprintf(rules, "\t\ttcp dport { %s } accept\n", strings.Join(ports, ", "))
+	}
+	rules.WriteString("\t}\n")
+	rules.WriteString("}\n")
+	return rules.String(), nil
+}
+
+// nodeNetworks returns the ranges of the nodes of a network policy: the
+// private network of the project and the node ranges.
+func nodeNetworks(policy *infrastructurev1alpha3.NetworkPolicy) []string {
+	return append([]string{projectPrivateNetwork}, policy.NodeCIDRs...)
+}
+
+// writeSourceRules writes the rules accepting match from cidrs, one per
+// address family.
+func writeSourceRules(rules *strings.Builder, match string, cidrs []string) {
+	var v4, v6 []string
+	for _, cidr := range cidrs {
+		if ip, _, _ := net.ParseCIDR(cidr); ip.To4() != nil {
+			v4 = append(v4, cidr)
+		} else {
+			v6 = append(v6, cidr)
+		}
+	}
+	if len(v4) != 0 {
+		fmt.Fprintf(rules, "\t\tip saddr { %s } %saccept\n", strings.Join(v4, ", "), match)
+	}
+	if len(v6) != 0 {
+		fmt.Fprintf(rules, "\t\tip6 saddr { %s } %saccept\n", strings.Join(v6, ", "), match)
+	}
+}
+
+// InjectFirewall adds the installation of an nftables ruleset, applied at
+// every boot by a systemd unit, to rendered userdata. Cloud-init userdata
+// becomes a multipart with a script installing the ruleset first, an
+// Ignition config gets the ruleset and the unit. Talos machine
+// configurations have their own firewall and are not supported.
+func InjectFirewall(userData string, format scope.BootstrapFormat, rules string) (string, error) {
+	switch format {
+	case scope.BootstrapFormatIgnition:
+		return injectIgnitionFirewall(userData, rules)
+	case scope.BootstrapFormatCloudConfig:
+		return injectCloudInitFirewall(userData, rules)
+	default:
+		return "", fmt.Errorf("the network policy is not supported with %s userdata: %w", format, ErrInvalidRequest)
+	}
+}
+
+func injectCloudInitFirewall(userData, rules string) (string, error) {
+	contentType := cloudInitContentType(userData)
+	if contentType == "" {
+		return "", fmt.Errorf("the network policy can not be added to userdata that is not a cloud-config or a script: %w", ErrInvalidRequest)
+	}
+	if strings.Contains(userData, firewallBoundary) {
+		return "", fmt.Errorf("the userdata contains the %s boundary: %w", firewallBoundary, ErrInvalidRequest)
+	}
+
+	script := &strings.Builder{}
+	script.WriteString("#!/bin/sh\nset -e\n")
+	fmt.Fprintf(script, "mkdir -p %s\n", path.Dir(firewallRulesPath))
+	fmt.Fprintf(script, "cat > %s <<'EOF'\n%sEOF\n", firewallRulesPath, rules)
+	fmt.Fprintf(script, "cat > /etc/systemd/system/%s <<'EOF'\n%sEOF\n", firewallUnit, firewallUnitContents)
+	script.WriteString("systemctl daemon-reload\n")
+	fmt.Fprintf(script, "systemctl enable --now %s\n", firewallUnit)
+
+	// cloud-init runs the scripts in the order of their parts, the firewall
+	// is up before the bootstrap commands run
+	return cloudInitMultipart(firewallBoundary, []cloudInitPart{
+		{"text/x-shellscript", "capp-firewall.sh", script.String()},
+		{contentType, "userdata", userData},
+	})
+}
+
+func injectIgnitionFirewall(userData, rules string) (string, error) {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(userData), &config); err != nil {
+		return "", fmt.Errorf("the ignition config is not valid JSON: %v: %w", err, ErrInvalidRequest)
+	}
+
+	file := ignitionFile(config, firewallRulesPath, 0600, rules)
+	unit := map[string]interface{}{
+		"name":     firewallUnit,
+		"enabled":  true,
+		"contents": firewallUnitContents,
+	}
+
+	if err := appendIgnition(config, "storage", "files", file); err != nil {
+		return "", err
+	}
+	if err := appendIgnition(config, "systemd", "units", unit); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ignitionFile returns the file of config at path holding contents.
+func ignitionFile(config map[string]interface{}, path string, mode int, contents string) map[string]interface{} {
+	file := map[string]interface{}{
+		"path":     path,
+		"mode":     mode,
+		"contents": map[string]interface{}{"source": "data:," + url.PathEscape(contents)},
+	}
+	// ignition configs of the 2.x specification name the filesystem of
+	// their files
+	if ignition, ok := config["ignition"].(map[string]interface{}); ok {
+		if version, _ := ignition["version"].(string); strings.HasPrefix(version, "2.") {
+			file["filesystem"] = "root"
+		}
+	}
+	return file
+}
+
+// appendIgnition appends value to the list config[section][key].
+func appendIgnition(config map[string]interface{}, section, key string, value interface{}) error {
+	if config[section] == nil {
+		config[section] = map[string]interface{}{}
+	}
+	s, ok := config[section].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("the %s section of the ignition config is not an object: %w", section, ErrInvalidRequest)
+	}
+	if s[key] == nil {
+		s[key] = []interface{}{}
+	}
+	list, ok := s[key].([]interface{})
+	if !ok {
+		return fmt.Errorf("%s.%s of the ignition config is not a list: %w", section, key, ErrInvalidRequest)
+	}
+	s[key] = append(list, value)
+	return nil
+}
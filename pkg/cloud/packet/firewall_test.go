@@ -0,0 +1,238 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+func TestFirewallRules(t *testing.T) {
+	policy := &infrastructurev1alpha3.NetworkPolicy{
+		APIServerAllowedCIDRs: []string{"203.0.113.0/24", "2001:db8::/32"},
+		SSHAllowedCIDRs:       []string{"198.51.100.7/32"},
+		NodeCIDRs:             []string{"147.75.0.0/16"},
+		AllowedPorts:          []int32{80, 443},
+	}
+
+	tests := []struct {
+		name         string
+		policy       *infrastructurev1alpha3.NetworkPolicy
+		controlPlane bool
+		want         []string
+		wantNot      []string
+		wantErr      string
+	}{
+		{
+			name:         "control plane",
+			policy:       policy,
+			controlPlane: true,
+			want: []string{
+				"type filter hook input priority 0; policy drop;",
+				"ip saddr { 10.0.0.0/8, 147.75.0.0/16 } accept",
+				"ip saddr { 169.254.255.0/24 } tcp dport 179 accept",
+				"ip saddr { 10.0.0.0/8, 147.75.0.0/16, 203.0.113.0/24 } tcp dport 6443 accept",
+				"ip6 saddr { 2001:db8::/32 } tcp dport 6443 accept",
+				"ip saddr { 198.51.100.7/32 } tcp dport 22 accept",
+				"tcp dport { 80, 443 } accept",
+			},
+		},
+		{
+			name:    "worker",
+			policy:  policy,
+			wantNot: []string{"dport 6443"},
+		},
+		{
+			name:         "api server and ssh without ranges",
+			policy:       &infrastructurev1alpha3.NetworkPolicy{},
+			controlPlane: true,
+			want:         []string{"\t\ttcp dport 6443 accept\n"},
+			wantNot:      []string{"dport 22", "ip6 saddr"},
+		},
+		{
+			name:    "invalid range",
+			policy:  &infrastructurev1alpha3.NetworkPolicy{SSHAllowedCIDRs: []string{"198.51.100.7"}},
+			wantErr: `networkPolicy.sshAllowedCIDRs: "198.51.100.7" is not a CIDR`,
+		},
+		{
+			name:    "invalid port",
+			policy:  &infrastructurev1alpha3.NetworkPolicy{AllowedPorts: []int32{70000}},
+			wantErr: "networkPolicy.allowedPorts: 70000 is not a port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			rules, err := FirewallRules(tt.policy, tt.controlPlane, 6443)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			for _, rule := range tt.want {
+				g.Expect(rules).To(ContainSubstring(rule))
+			}
+			for _, rule := range tt.wantNot {
+				g.Expect(rules).NotTo(ContainSubstring(rule))
+			}
+		})
+	}
+}
+
+func TestGenerateAPIServerFirewallTag(t *testing.T) {
+	g := NewWithT(t)
+
+	rules := func(cidrs ...string) string {
+		rules, err := FirewallRules(&infrastructurev1alpha3.NetworkPolicy{APIServerAllowedCIDRs: cidrs}, true, 6443)
+		g.Expect(err).NotTo(HaveOccurred())
+		return rules
+	}
+
+	// the tag of the rules only changes with them
+	tag := GenerateAPIServerFirewallTag(rules("203.0.113.0/24", "2001:db8::/32"))
+	g.Expect(tag).To(HavePrefix(APIServerFirewallTag + ":"))
+	g.Expect(tag).To(Equal(GenerateAPIServerFirewallTag(rules("203.0.113.0/24", "2001:db8::/32"))))
+	g.Expect(tag).NotTo(Equal(GenerateAPIServerFirewallTag(rules("203.0.113.0/24"))))
+}
+
+func TestInjectFirewallCloudInit(t *testing.T) {
+	g := NewWithT(t)
+	userData := "#cloud-config\nruncmd:\n- kubeadm join\n"
+
+	injected, err := InjectFirewall(userData, scope.BootstrapFormatCloudConfig, "table inet capp_firewall {}\n")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	message, err := mail.ReadMessage(strings.NewReader(injected))
+	g.Expect(err).NotTo(HaveOccurred())
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(mediaType).To(Equal("multipart/mixed"))
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	var contentTypes, contents []string
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(part)
+		g.Expect(err).NotTo(HaveOccurred())
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+		contents = append(contents, string(content))
+	}
+	g.Expect(contentTypes).To(Equal([]string{`text/x-shellscript; charset="us-ascii"`, `text/cloud-config; charset="us-ascii"`}))
+	g.Expect(contents[0]).To(ContainSubstring("cat > /etc/capp/firewall.nft <<'EOF'\ntable inet capp_firewall {}\nEOF\n"))
+	g.Expect(contents[0]).To(ContainSubstring("systemctl enable --now capp-firewall.service"))
+	g.Expect(contents[1]).To(Equal(userData))
+}
+
+func TestInjectFirewallIgnition(t *testing.T) {
+	tests := []struct {
+		name           string
+		userData       string
+		wantFilesystem bool
+	}{
+		{
+			name:     "ignition 3",
+			userData: `{"ignition":{"version":"3.3.0"},"storage":{"files":[{"path":"/etc/hostname"}]}}`,
+		},
+		{
+			name:           "ignition 2",
+			userData:       `{"ignition":{"version":"2.3.0"}}`,
+			wantFilesystem: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			injected, err := InjectFirewall(tt.userData, scope.BootstrapFormatIgnition, "table inet capp_firewall {}\n")
+			g.Expect(err).NotTo(HaveOccurred())
+
+			var config struct {
+				Storage struct {
+					Files []map[string]interface{} `json:"files"`
+				} `json:"storage"`
+				Systemd struct {
+					Units []map[string]interface{} `json:"units"`
+				} `json:"systemd"`
+			}
+			g.Expect(json.Unmarshal([]byte(injected), &config)).To(Succeed())
+			file := config.Storage.Files[len(config.Storage.Files)-1]
+			g.Expect(file).To(HaveKeyWithValue("path", "/etc/capp/firewall.nft"))
+			g.Expect(file).To(HaveKeyWithValue("contents", map[string]interface{}{"source": "data:,table%20inet%20capp_firewall%20%7B%7D%0A"}))
+			if tt.wantFilesystem {
+				g.Expect(file).To(HaveKeyWithValue("filesystem", "root"))
+			} else {
+				g.Expect(file).NotTo(HaveKey("filesystem"))
+			}
+			g.Expect(config.Systemd.Units).To(HaveLen(1))
+			g.Expect(config.Systemd.Units[0]).To(HaveKeyWithValue("name", "capp-firewall.service"))
+			g.Expect(config.Systemd.Units[0]).To(HaveKeyWithValue("enabled", true))
+		})
+	}
+}
+
+func TestInjectFirewallUnsupported(t *testing.T) {
+	tests := []struct {
+		name     string
+		userData string
+		format   scope.BootstrapFormat
+	}{
+		{name: "talos", userData: "version: v1alpha1\n", format: scope.BootstrapFormatTalos},
+		{name: "unknown cloud-init userdata", userData: "echo hello\n", format: scope.BootstrapFormatCloudConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			_, err := InjectFirewall(tt.userData, tt.format, "")
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue(), "unexpected error %v", err)
+		})
+	}
+}
+
+func TestNewDeviceNetworkPolicy(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	machineScope := newTestMachineScope(t,
+		infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Facility: "ewr1"},
+		infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", NetworkPolicy: &infrastructurev1alpha3.NetworkPolicy{}},
+		"#cloud-config\nruncmd:\n- kubeadm join\n")
+
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope})
+	g.Expect(err).NotTo(HaveOccurred())
+	userData := api.requestsTo("POST", "/projects/project/devices")[0].Body["userdata"]
+	g.Expect(userData).To(HavePrefix(`Content-Type: multipart/mixed; boundary="capp-firewall-boundary"`))
+	g.Expect(userData).To(ContainSubstring("policy drop;"))
+	g.Expect(userData).To(ContainSubstring("kubeadm join"))
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+const (
+	// gpuBoundary separates the parts of the multipart userdata the GPU
+	// driver is added to, when the firewall was not.
+	gpuBoundary = "capp-gpu-boundary"
+
+	nvidiaToolkitKeyring = "/usr/share/keyrings/nvidia-container-toolkit-keyring.gpg"
+	nvidiaToolkitRepo    = "https://nvidia.github.io/libnvidia-container"
+)
+
+// nvidiaDriverScript installs the NVIDIA driver, version %s, and the NVIDIA
+// container toolkit on Ubuntu, and makes the NVIDIA runtime the default
+// runtime of containerd.
+const nvidiaDriverScript = `#!/bin/sh
+set -e
+. /etc/os-release
+if [ "$ID" != "ubuntu" ]; then
+  echo "the NVIDIA driver can only be installed on ubuntu, not $ID" >&2
+  exit 1
+fi
+export DEBIAN_FRONTEND=noninteractive
+apt-get update
+apt-get install -y ubuntu-drivers-common curl gpg
+ubuntu-drivers install --gpgpu %s
+curl -fsSL ` + nvidiaToolkitRepo + `/gpgkey | gpg --batch --yes --dearmor -o ` + nvidiaToolkitKeyring + `
+curl -fsSL ` + nvidiaToolkitRepo + `/stable/deb/nvidia-container-toolkit.list | sed 's#deb https://#deb [signed-by=` + nvidiaToolkitKeyring + `] https://#g' > /etc/apt/sources.list.d/nvidia-container-toolkit.list
+apt-get update
+apt-get install -y nvidia-container-toolkit
+modprobe nvidia
+nvidia-ctk runtime configure --runtime=containerd --set-as-default
+systemctl restart containerd
+`
+
+// GPUTemplateValues returns the gpuModel and gpuCount userdata template
+// variables of the GPUs of a machine. The GPUs the plan has are preferred
+// over the ones the machine asks for. Both are strings, for envsubst to
+// substitute them too.
+func GPUTemplateValues(gpu *infrastructurev1alpha3.GPUSpec, planGPUs *PlanGPUs) map[string]string {
+	if gpu == nil {
+		return nil
+	}
+	if planGPUs != nil && planGPUs.Count > 0 {
+		return map[string]string{"gpuModel": planGPUs.Model, "gpuCount": strconv.Itoa(planGPUs.Count)}
+	}
+	count := int(gpu.Count)
+	if count == 0 {
+		count = 1
+	}
+	return map[string]string{"gpuModel": gpu.Model, "gpuCount": strconv.Itoa(count)}
+}
+
+// gpuDriverScript returns the script installing the driver gpu asks for,
+// empty when it asks for none.
+func gpuDriverScript(gpu *infrastructurev1alpha3.GPUSpec) (string, error) {
+	if gpu == nil {
+		return "", nil
+	}
+	switch gpu.Driver {
+	case "", infrastructurev1alpha3.GPUDriverNone:
+		return "", nil
+	case infrastructurev1alpha3.GPUDriverNVIDIA:
+	default:
+		return "", fmt.Errorf("unknown GPU driver %q: %w", gpu.Driver, ErrInvalidRequest)
+	}
+
+	driver := ""
+	if gpu.DriverVersion != "" {
+		if _, err := strconv.ParseUint(gpu.DriverVersion, 10, 32); err != nil {
+			return "", fmt.Errorf("invalid GPU driver version %q: %w", gpu.DriverVersion, ErrInvalidRequest)
+		}
+		driver = "nvidia:" + gpu.DriverVersion + "-server"
+	}
+	return fmt.Sprintf(nvidiaDriverScript, driver), nil
+}
+
+// InjectGPUDriver adds the installation of the driver a machine asks for to
+// its rendered userdata, unchanged when it asks for none. The driver is
+// installed once the bootstrap commands ran: cloud-init userdata becomes a
+// multipart with the installation script last, the userdata the firewall was
+// added to gets one more part. Only cloud-init userdata is supported.
+func InjectGPUDriver(userData string, format scope.BootstrapFormat, gpu *infrastructurev1alpha3.GPUSpec) (string, error) {
+	script, err := gpuDriverScript(gpu)
+	if err != nil || script == "" {
+		return userData, err
+	}
+	if format != scope.BootstrapFormatCloudConfig {
+		return "", fmt.Errorf("the GPU driver can not be installed with %s userdata: %w", format, ErrInvalidRequest)
+	}
+
+	part := cloudInitPart{"text/x-shellscript", "capp-gpu-driver.sh", script}
+	parts, ok, err := cloudInitParts(userData, firewallBoundary)
+	if err != nil {
+		return "", fmt.Errorf("error reading the multipart userdata: %v: %w", err, ErrInvalidRequest)
+	}
+	if ok {
+		return cloudInitMultipart(firewallBoundary, append(parts, part))
+	}
+
+	contentType := cloudInitContentType(userData)
+	if contentType == "" {
+		return "", fmt.Errorf("the GPU driver can not be added to userdata that is not a cloud-config or a script: %w", ErrInvalidRequest)
+	}
+	if strings.Contains(userData, gpuBoundary) {
+		return "", fmt.Errorf("the userdata contains the %s boundary: %w", gpuBoundary, ErrInvalidRequest)
+	}
+	return cloudInitMultipart(gpuBoundary, []cloudInitPart{
+		{contentType, "userdata", userData},
+		part,
+	})
+}
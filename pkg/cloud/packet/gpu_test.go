@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// readMultipartUserData returns the file names and the contents of the parts
+// of multipart userdata.
+func readMultipartUserData(g *WithT, userData string) (filenames, contents []string) {
+	message, err := mail.ReadMessage(strings.NewReader(userData))
+	g.Expect(err).NotTo(HaveOccurred())
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(mediaType).To(Equal("multipart/mixed"))
+
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(part)
+		g.Expect(err).NotTo(HaveOccurred())
+		filenames = append(filenames, part.FileName())
+		contents = append(contents, string(content))
+	}
+	return filenames, contents
+}
+
+func TestGPUTemplateValues(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(GPUTemplateValues(nil, &PlanGPUs{Model: "NVIDIA A100 PCIE 40GB", Count: 2})).To(BeNil())
+	g.Expect(GPUTemplateValues(&infrastructurev1alpha3.GPUSpec{Model: "A100"}, &PlanGPUs{Model: "NVIDIA A100 PCIE 40GB", Count: 2})).
+		To(Equal(map[string]string{"gpuModel": "NVIDIA A100 PCIE 40GB", "gpuCount": "2"}))
+	// the spec is used when the plan is not known
+	g.Expect(GPUTemplateValues(&infrastructurev1alpha3.GPUSpec{Model: "A100"}, nil)).
+		To(Equal(map[string]string{"gpuModel": "A100", "gpuCount": "1"}))
+	g.Expect(GPUTemplateValues(&infrastructurev1alpha3.GPUSpec{Count: 4}, &PlanGPUs{})).
+		To(Equal(map[string]string{"gpuModel": "", "gpuCount": "4"}))
+}
+
+func TestInjectGPUDriver(t *testing.T) {
+	userData := "#cloud-config\nruncmd:\n- kubeadm join\n"
+	tests := []struct {
+		name       string
+		format     scope.BootstrapFormat
+		gpu        *infrastructurev1alpha3.GPUSpec
+		unchanged  bool
+		wantDriver string
+		wantErr    string
+	}{
+		{
+			name:      "no gpu",
+			format:    scope.BootstrapFormatCloudConfig,
+			unchanged: true,
+		},
+		{
+			name:      "no driver",
+			format:    scope.BootstrapFormatIgnition,
+			gpu:       &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNone},
+			unchanged: true,
+		},
+		{
+			name:       "recommended driver",
+			format:     scope.BootstrapFormatCloudConfig,
+			gpu:        &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNVIDIA},
+			wantDriver: "ubuntu-drivers install --gpgpu \n",
+		},
+		{
+			name:       "driver version",
+			format:     scope.BootstrapFormatCloudConfig,
+			gpu:        &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNVIDIA, DriverVersion: "535"},
+			wantDriver: "ubuntu-drivers install --gpgpu nvidia:535-server\n",
+		},
+		{
+			name:    "invalid driver version",
+			format:  scope.BootstrapFormatCloudConfig,
+			gpu:     &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNVIDIA, DriverVersion: "535; reboot"},
+			wantErr: `invalid GPU driver version "535; reboot"`,
+		},
+		{
+			name:    "ignition",
+			format:  scope.BootstrapFormatIgnition,
+			gpu:     &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNVIDIA},
+			wantErr: "the GPU driver can not be installed with ignition userdata",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			injected, err := InjectGPUDriver(userData, tt.format, tt.gpu)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			if tt.unchanged {
+				g.Expect(injected).To(Equal(userData))
+				return
+			}
+
+			g.Expect(injected).To(HavePrefix(`Content-Type: multipart/mixed; boundary="capp-gpu-boundary"`))
+			filenames, contents := readMultipartUserData(g, injected)
+			g.Expect(filenames).To(Equal([]string{"userdata", "capp-gpu-driver.sh"}))
+			g.Expect(contents[0]).To(Equal(userData))
+			g.Expect(contents[1]).To(ContainSubstring(tt.wantDriver))
+			g.Expect(contents[1]).To(ContainSubstring("nvidia-ctk runtime configure --runtime=containerd --set-as-default"))
+		})
+	}
+}
+
+func TestInjectGPUDriverAfterFirewall(t *testing.T) {
+	g := NewWithT(t)
+	userData := "#cloud-config\nruncmd:\n- kubeadm join\n"
+
+	injected, err := InjectFirewall(userData, scope.BootstrapFormatCloudConfig, "table inet capp_firewall {}\n")
+	g.Expect(err).NotTo(HaveOccurred())
+	injected, err = InjectGPUDriver(injected, scope.BootstrapFormatCloudConfig, &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNVIDIA})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// the driver is added to the multipart of the firewall
+	g.Expect(injected).To(HavePrefix(`Content-Type: multipart/mixed; boundary="capp-firewall-boundary"`))
+	filenames, contents := readMultipartUserData(g, injected)
+	g.Expect(filenames).To(Equal([]string{"capp-firewall.sh", "userdata", "capp-gpu-driver.sh"}))
+	g.Expect(contents[0]).To(ContainSubstring("table inet capp_firewall {}"))
+	g.Expect(contents[1]).To(Equal(userData))
+	g.Expect(contents[2]).To(ContainSubstring("apt-get install -y nvidia-container-toolkit"))
+}
+
+func TestNewDeviceGPU(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	machineScope := newTestMachineScope(t,
+		infrastructurev1alpha3.PacketMachineSpec{
+			OS: "ubuntu_20_04", MachineType: "g2.large.x86", BillingCycle: "hourly", Facility: "ewr1",
+			GPU: &infrastructurev1alpha3.GPUSpec{Model: "A100", Driver: infrastructurev1alpha3.GPUDriverNVIDIA},
+		},
+		infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+		"#cloud-config\nruncmd:\n- echo {{ .gpuCount }} {{ .gpuModel }} GPUs\n")
+
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, PlanGPUs: &PlanGPUs{Model: "NVIDIA A100 PCIE 40GB", Count: 2}})
+	g.Expect(err).NotTo(HaveOccurred())
+	userData := api.requestsTo("POST", "/projects/project/devices")[0].Body["userdata"]
+	filenames, contents := readMultipartUserData(g, userData.(string))
+	g.Expect(filenames).To(Equal([]string{"userdata", "capp-gpu-driver.sh"}))
+	g.Expect(contents[0]).To(Equal("#cloud-config\nruncmd:\n- echo 2 NVIDIA A100 PCIE 40GB GPUs\n"))
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// APIChecker verifies that the Packet API is reachable with the configured
+// credentials. The result of the last call is cached for Interval so that
+// frequent probes do not eat into the API rate limit.
+type APIChecker struct {
+	Client   *PacketClient
+	Interval time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+	// scope is the scope of the key once probed, the project keys can not
+	// read their user.
+	scope KeyScope
+	now   func() time.Time
+}
+
+// NewAPIChecker returns an APIChecker caching its result for interval.
+func NewAPIChecker(client *PacketClient, interval time.Duration) *APIChecker {
+	return &APIChecker{
+		Client:   client,
+		Interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Check has the signature of a controller-runtime healthz.Checker. It fetches
+// the user owning the API token, or for a project key its project, which fails
+// on a revoked token as well as on network errors.
+func (c *APIChecker) Check(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if !c.checkedAt.IsZero() && now.Sub(c.checkedAt) < c.Interval {
+		return c.lastErr
+	}
+
+	err := c.probe()
+	if err != nil {
+		err = errors.Wrap(err, "packet api is not reachable")
+	}
+	c.checkedAt = now
+	c.lastErr = err
+	return err
+}
+
+// probe reads the user of the key, or the project of a project key.
+func (c *APIChecker) probe() error {
+	if c.scope != KeyScopeProject {
+		_, _, err := c.Client.Users.Current()
+		switch err = packeterrors.Wrap(err); {
+		case err == nil:
+			c.scope = KeyScopeUser
+			return nil
+		case c.scope == KeyScopeUser || !deniedOrMissing(err):
+			return err
+		}
+		c.scope = KeyScopeProject
+	}
+	// a project key lists its own project
+	_, err := c.Client.DoRequest(http.MethodGet, "/projects?per_page=1", nil, nil)
+	return packeterrors.Wrap(err)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+)
+
+func TestAPICheckerCachesResult(t *testing.T) {
+	g := NewWithT(t)
+
+	calls := 0
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"id":"user"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors":["invalid token"]}`))
+	}))
+	defer server.Close()
+
+	c, err := packngo.NewClientWithBaseURL(clientName, "token", nil, server.URL+"/")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	now := time.Now()
+	checker := NewAPIChecker(&PacketClient{Client: c}, time.Minute)
+	checker.now = func() time.Time { return now }
+
+	g.Expect(checker.Check(nil)).To(Succeed())
+	g.Expect(checker.Check(nil)).To(Succeed())
+	g.Expect(calls).To(Equal(1))
+
+	status = http.StatusUnauthorized
+	g.Expect(checker.Check(nil)).To(Succeed())
+	g.Expect(calls).To(Equal(1))
+
+	now = now.Add(2 * time.Minute)
+	g.Expect(checker.Check(nil)).NotTo(Succeed())
+	g.Expect(calls).To(Equal(2))
+}
+
+func TestAPICheckerProjectKey(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/user", fakeResponse{status: http.StatusForbidden, body: apiError("You are not authorized to view this user")})
+	api.on(http.MethodGet, "/projects",
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"projects": []interface{}{}}},
+		fakeResponse{status: http.StatusUnauthorized, body: apiError("invalid token")},
+	)
+
+	checker := NewAPIChecker(c, 0)
+	g.Expect(checker.Check(nil)).To(Succeed())
+	g.Expect(checker.Check(nil)).NotTo(Succeed())
+	// the user of a project key is read once
+	g.Expect(api.requestsTo(http.MethodGet, "/user")).To(HaveLen(1))
+	g.Expect(api.requestsTo(http.MethodGet, "/projects")).To(HaveLen(2))
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// ImageService looks up the custom images devices are provisioned from.
+type ImageService interface {
+	GetImage(slug string) (*packngo.OS, error)
+}
+
+// GetImage returns the custom image with slug, listed by Packet with the
+// operating systems the credential can provision. It returns an
+// ErrInvalidRequest when there is none.
+func (p *PacketClient) GetImage(slug string) (*packngo.OS, error) {
+	operatingSystems, _, err := p.OperatingSystems.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operating systems: %w", packeterrors.Wrap(err))
+	}
+	for i := range operatingSystems {
+		if operatingSystems[i].Slug == slug {
+			return &operatingSystems[i], nil
+		}
+	}
+	return nil, fmt.Errorf("image %s does not exist: %w", slug, ErrInvalidRequest)
+}
+
+// DeviceOS returns the operating system slug devices of spec are provisioned
+// with: the one of their image, if any.
+func DeviceOS(spec infrastructurev1alpha3.PacketMachineSpec) string {
+	if spec.ImageRef != nil {
+		return spec.ImageRef.Slug
+	}
+	return spec.OS
+}
+
+// CheckImage returns an ErrInvalidRequest when the image of a device of spec
+// can not be provisioned on its machine type.
+func CheckImage(image *packngo.OS, spec infrastructurev1alpha3.PacketMachineSpec) error {
+	if len(image.ProvisionableOn) == 0 {
+		return nil
+	}
+	for _, plan := range image.ProvisionableOn {
+		if plan == spec.MachineType {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s can not be provisioned on machine type %s: %w", image.Slug, spec.MachineType, ErrInvalidRequest)
+}
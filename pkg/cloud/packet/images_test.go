@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestGetImage(t *testing.T) {
+	api, c := newFakeAPI(t)
+	api.on("GET", "/operating-systems", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"operating_systems": []map[string]interface{}{
+		{"slug": "ubuntu_20_04", "provisionable_on": []string{"c3.small.x86", "m3.large.x86"}},
+		{"slug": "capi_ubuntu_20_04_v1_20_4", "provisionable_on": []string{"c3.small.x86"}},
+	}}})
+
+	tests := []struct {
+		name    string
+		spec    infrastructurev1alpha3.PacketMachineSpec
+		wantErr string
+	}{
+		{
+			name: "image provisionable on the machine type",
+			spec: infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", ImageRef: &infrastructurev1alpha3.ImageReference{Slug: "capi_ubuntu_20_04_v1_20_4"}},
+		},
+		{
+			name:    "image not provisionable on the machine type",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "m3.large.x86", ImageRef: &infrastructurev1alpha3.ImageReference{Slug: "capi_ubuntu_20_04_v1_20_4"}},
+			wantErr: "image capi_ubuntu_20_04_v1_20_4 can not be provisioned on machine type m3.large.x86",
+		},
+		{
+			name:    "missing image",
+			spec:    infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", ImageRef: &infrastructurev1alpha3.ImageReference{Slug: "capi_ubuntu_18_04"}},
+			wantErr: "image capi_ubuntu_18_04 does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			image, err := c.GetImage(tt.spec.ImageRef.Slug)
+			if err == nil {
+				err = CheckImage(image, tt.spec)
+			}
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestDeviceOS(t *testing.T) {
+	g := NewWithT(t)
+	spec := infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04"}
+	g.Expect(DeviceOS(spec)).To(Equal("ubuntu_20_04"))
+
+	spec.ImageRef = &infrastructurev1alpha3.ImageReference{Slug: "capi_ubuntu_20_04_v1_20_4"}
+	g.Expect(DeviceOS(spec)).To(Equal("capi_ubuntu_20_04_v1_20_4"))
+}
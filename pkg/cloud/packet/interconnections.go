@@ -0,0 +1,229 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// statusActive is the status of active interconnections and virtual
+// circuits.
+const statusActive = "active"
+
+// InterconnectionService manages the interconnections of a cluster and the
+// virtual circuits connecting them to its VLANs.
+type InterconnectionService interface {
+	ClusterInterconnections(projectID, clusterUID string) ([]packngo.Connection, error)
+	CreateInterconnection(projectID, clusterUID, clusterName, metro string, interconnection infrastructurev1alpha3.Interconnection) (*packngo.Connection, error)
+	DeleteInterconnection(id string) error
+	ProjectVLAN(projectID, metro string, vxlan int) (*packngo.VirtualNetwork, error)
+	ConnectVirtualCircuits(projectID string, connection *packngo.Connection, vlan *packngo.VirtualNetwork, nniVLAN int) ([]infrastructurev1alpha3.VirtualCircuitStatus, error)
+}
+
+// ValidateInterconnections checks the interconnections of a cluster. It
+// returns an ErrInvalidRequest when one can not be provisioned as declared.
+func ValidateInterconnections(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	names := map[string]bool{}
+	for _, interconnection := range spec.Interconnections {
+		name := interconnection.Name
+		if names[name] {
+			return fmt.Errorf("interconnections: %s is declared twice: %w", name, ErrInvalidRequest)
+		}
+		names[name] = true
+		if InterconnectionMetro(spec, interconnection) == "" {
+			return fmt.Errorf("interconnections: %s needs a metro, the cluster has none: %w", name, ErrInvalidRequest)
+		}
+		dedicated := interconnection.Type == infrastructurev1alpha3.InterconnectionTypeDedicated
+		if dedicated && interconnection.NNIVLAN == 0 {
+			return fmt.Errorf("interconnections: dedicated interconnection %s needs a nniVLAN: %w", name, ErrInvalidRequest)
+		}
+		if !dedicated && interconnection.NNIVLAN != 0 {
+			return fmt.Errorf("interconnections: nniVLAN only applies to dedicated interconnections, %s is shared: %w", name, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// InterconnectionMetro returns the metro of an interconnection of a cluster.
+func InterconnectionMetro(spec infrastructurev1alpha3.PacketClusterSpec, interconnection infrastructurev1alpha3.Interconnection) string {
+	if interconnection.Metro != "" {
+		return interconnection.Metro
+	}
+	return spec.Metro
+}
+
+// InterconnectionName returns the name within its cluster of an
+// interconnection the controller provisioned, empty for other ones.
+func InterconnectionName(connection packngo.Connection) string {
+	for _, tag := range connection.Tags {
+		if name := strings.TrimPrefix(tag, InterconnectionTag+":"); name != tag {
+			return name
+		}
+	}
+	return ""
+}
+
+// InterconnectionReady reports whether an interconnection and the virtual
+// circuits of each of its ports are active.
+func InterconnectionReady(status infrastructurev1alpha3.InterconnectionStatus, redundant bool) bool {
+	ports := 1
+	if redundant {
+		ports = 2
+	}
+	if status.Status != statusActive || len(status.VirtualCircuits) < ports {
+		return false
+	}
+	for _, circuit := range status.VirtualCircuits {
+		if circuit.Status != statusActive {
+			return false
+		}
+	}
+	return true
+}
+
+// ClusterInterconnections returns the interconnections of a project the
+// controller provisioned for the PacketCluster with the given UID, the one
+// returned by ClusterUID for the interconnections of a moved cluster to be
+// found.
+func (p *PacketClient) ClusterInterconnections(projectID, clusterUID string) ([]packngo.Connection, error) {
+	connections, _, err := p.Connections.ProjectList(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the interconnections of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	clusterTag := GenerateClusterUIDTag(clusterUID)
+	owned := []packngo.Connection{}
+	for _, connection := range connections {
+		if ItemsInList(connection.Tags, []string{clusterTag}) {
+			owned = append(owned, connection)
+		}
+	}
+	return owned, nil
+}
+
+// CreateInterconnection requests an interconnection in metro for the
+// PacketCluster with the given UID and name.
+func (p *PacketClient) CreateInterconnection(projectID, clusterUID, clusterName, metro string, interconnection infrastructurev1alpha3.Interconnection) (*packngo.Connection, error) {
+	req := &packngo.ConnectionCreateRequest{
+		Name:       fmt.Sprintf("%s-%s", clusterName, interconnection.Name),
+		Metro:      metro,
+		Type:       packngo.ConnectionShared,
+		Redundancy: packngo.ConnectionPrimary,
+		Speed:      int(interconnection.Speed),
+		Tags:       []string{GenerateClusterUIDTag(clusterUID), GenerateInterconnectionTag(interconnection.Name)},
+	}
+	if interconnection.Type == infrastructurev1alpha3.InterconnectionTypeDedicated {
+		req.Type = packngo.ConnectionDedicated
+	}
+	if interconnection.Redundant {
+		req.Redundancy = packngo.ConnectionRedundant
+	}
+	connection, _, err := p.Connections.ProjectCreate(projectID, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create interconnection %s: %w", req.Name, packeterrors.Wrap(err))
+	}
+	return connection, nil
+}
+
+// DeleteInterconnection deletes an interconnection and its virtual circuits.
+// Interconnections already gone are not an error.
+func (p *PacketClient) DeleteInterconnection(id string) error {
+	if _, err := p.Connections.Delete(id); err != nil {
+		if err = packeterrors.Wrap(err); packeterrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete interconnection %s: %w", id, err)
+	}
+	return nil
+}
+
+// ProjectVLAN returns the VLAN of a project with the given VXLAN id in metro,
+// nil when there is none.
+func (p *PacketClient) ProjectVLAN(projectID, metro string, vxlan int) (*packngo.VirtualNetwork, error) {
+	vlans, _, err := p.ProjectVirtualNetworks.List(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the vlans of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	for i, vlan := range vlans.VirtualNetworks {
+		vlanMetro := vlan.MetroCode
+		if vlanMetro == "" && vlan.Metro != nil {
+			vlanMetro = vlan.Metro.Code
+		}
+		if vlan.VXLAN == vxlan && strings.EqualFold(vlanMetro, metro) {
+			return &vlans.VirtualNetworks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ConnectVirtualCircuits connects every port of an interconnection to vlan.
+// Dedicated ports get a virtual circuit created with nniVLAN as customer
+// side tag. Shared ones get a virtual circuit Equinix created, once the
+// token of the interconnection is redeemed, assigned to vlan. It returns the
+// virtual circuits connected to vlan.
+func (p *PacketClient) ConnectVirtualCircuits(projectID string, connection *packngo.Connection, vlan *packngo.VirtualNetwork, nniVLAN int) ([]infrastructurev1alpha3.VirtualCircuitStatus, error) {
+	ports, _, err := p.Connections.Ports(connection.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the ports of interconnection %s: %w", connection.ID, packeterrors.Wrap(err))
+	}
+
+	circuits := []infrastructurev1alpha3.VirtualCircuitStatus{}
+	for _, port := range ports {
+		vcs, _, err := p.Connections.VirtualCircuits(connection.ID, port.ID, &packngo.GetOptions{Includes: []string{"virtual_network"}})
+		if err != nil {
+			return circuits, fmt.Errorf("failed to list the virtual circuits of port %s: %w", port.ID, packeterrors.Wrap(err))
+		}
+
+		var connected, unassigned *packngo.VirtualCircuit
+		for i := range vcs {
+			vc := &vcs[i]
+			switch {
+			case vc.VirtualNetwork != nil && vc.VirtualNetwork.ID == vlan.ID, vc.VNID != 0 && vc.VNID == vlan.VXLAN:
+				connected = vc
+			case unassigned == nil && vc.VirtualNetwork == nil && vc.VNID == 0:
+				unassigned = vc
+			}
+		}
+
+		switch {
+		case connected != nil:
+		case connection.Type == packngo.ConnectionDedicated:
+			req := &packngo.VCCreateRequest{VirtualNetworkID: vlan.ID, NniVLAN: nniVLAN, Name: fmt.Sprintf("%s-%s", connection.Name, port.Role)}
+			if connected, _, err = p.VirtualCircuits.Create(projectID, connection.ID, port.ID, req, nil); err != nil {
+				return circuits, fmt.Errorf("failed to create the virtual circuit of port %s: %w", port.ID, packeterrors.Wrap(err))
+			}
+		case unassigned != nil:
+			if connected, _, err = p.VirtualCircuits.Update(unassigned.ID, &packngo.VCUpdateRequest{VirtualNetworkID: &vlan.ID}, nil); err != nil {
+				return circuits, fmt.Errorf("failed to assign virtual circuit %s to vlan %d: %w", unassigned.ID, vlan.VXLAN, packeterrors.Wrap(err))
+			}
+		default:
+			// the token of the shared interconnection is not redeemed yet
+			continue
+		}
+		circuits = append(circuits, infrastructurev1alpha3.VirtualCircuitStatus{
+			ID:     connected.ID,
+			Port:   string(port.Role),
+			Status: connected.Status,
+		})
+	}
+	return circuits, nil
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestValidateInterconnections(t *testing.T) {
+	shared := infrastructurev1alpha3.Interconnection{Name: "aws", VLAN: 1000}
+	dedicated := infrastructurev1alpha3.Interconnection{Name: "dc", Type: infrastructurev1alpha3.InterconnectionTypeDedicated, VLAN: 1000, NNIVLAN: 100}
+
+	tests := []struct {
+		name  string
+		spec  infrastructurev1alpha3.PacketClusterSpec
+		valid bool
+	}{
+		{name: "none", valid: true},
+		{name: "shared and dedicated", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", Interconnections: []infrastructurev1alpha3.Interconnection{shared, dedicated}}, valid: true},
+		{name: "duplicate", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", Interconnections: []infrastructurev1alpha3.Interconnection{shared, shared}}},
+		{name: "no metro", spec: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1", Interconnections: []infrastructurev1alpha3.Interconnection{shared}}},
+		{name: "own metro", spec: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1", Interconnections: []infrastructurev1alpha3.Interconnection{{Name: "aws", Metro: "ny", VLAN: 1000}}}, valid: true},
+		{name: "dedicated without nni vlan", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", Interconnections: []infrastructurev1alpha3.Interconnection{{Name: "dc", Type: infrastructurev1alpha3.InterconnectionTypeDedicated, VLAN: 1000}}}},
+		{name: "shared with nni vlan", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", Interconnections: []infrastructurev1alpha3.Interconnection{{Name: "aws", VLAN: 1000, NNIVLAN: 100}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateInterconnections(tt.spec)
+			if tt.valid {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestInterconnectionReady(t *testing.T) {
+	g := NewWithT(t)
+	active := infrastructurev1alpha3.VirtualCircuitStatus{ID: "vc", Status: "active"}
+
+	g.Expect(InterconnectionReady(infrastructurev1alpha3.InterconnectionStatus{Status: "active", VirtualCircuits: []infrastructurev1alpha3.VirtualCircuitStatus{active}}, false)).To(BeTrue())
+	g.Expect(InterconnectionReady(infrastructurev1alpha3.InterconnectionStatus{Status: "requested", VirtualCircuits: []infrastructurev1alpha3.VirtualCircuitStatus{active}}, false)).To(BeFalse())
+	g.Expect(InterconnectionReady(infrastructurev1alpha3.InterconnectionStatus{Status: "active"}, false)).To(BeFalse())
+	g.Expect(InterconnectionReady(infrastructurev1alpha3.InterconnectionStatus{Status: "active", VirtualCircuits: []infrastructurev1alpha3.VirtualCircuitStatus{active}}, true)).To(BeFalse())
+	g.Expect(InterconnectionReady(infrastructurev1alpha3.InterconnectionStatus{Status: "active", VirtualCircuits: []infrastructurev1alpha3.VirtualCircuitStatus{
+		active, {ID: "secondary", Status: "activating"},
+	}}, true)).To(BeFalse())
+}
+
+func TestClusterInterconnections(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/connections", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"interconnections": []map[string]interface{}{
+			{"id": "owned", "tags": []string{GenerateClusterUIDTag("uid"), GenerateInterconnectionTag("aws")}},
+			{"id": "other", "tags": []string{GenerateClusterUIDTag("other"), GenerateInterconnectionTag("aws")}},
+			{"id": "manual"},
+		},
+	}})
+
+	connections, err := c.ClusterInterconnections("project", "uid")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(connections).To(HaveLen(1))
+	g.Expect(connections[0].ID).To(Equal("owned"))
+	g.Expect(InterconnectionName(connections[0])).To(Equal("aws"))
+}
+
+func TestCreateInterconnection(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodPost, "/projects/project/connections", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "created", "status": "requested"}})
+
+	connection, err := c.CreateInterconnection("project", "uid", "cluster", "da", infrastructurev1alpha3.Interconnection{
+		Name: "dc", Type: infrastructurev1alpha3.InterconnectionTypeDedicated, Redundant: true, VLAN: 1000, NNIVLAN: 100,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(connection.ID).To(Equal("created"))
+
+	body := api.requestsTo(http.MethodPost, "/projects/project/connections")[0].Body
+	g.Expect(body).To(HaveKeyWithValue("name", "cluster-dc"))
+	g.Expect(body).To(HaveKeyWithValue("metro", "da"))
+	g.Expect(body).To(HaveKeyWithValue("type", "dedicated"))
+	g.Expect(body).To(HaveKeyWithValue("redundancy", "redundant"))
+	g.Expect(body["tags"]).To(ConsistOf(GenerateClusterUIDTag("uid"), GenerateInterconnectionTag("dc")))
+}
+
+func TestDeleteInterconnection(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodDelete, "/connections/existing", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodDelete, "/connections/failing", fakeResponse{status: http.StatusUnprocessableEntity, body: apiError("has active virtual circuits")})
+
+	g.Expect(c.DeleteInterconnection("existing")).To(Succeed())
+	g.Expect(c.DeleteInterconnection("gone")).To(Succeed())
+	g.Expect(c.DeleteInterconnection("failing")).To(MatchError(ContainSubstring("has active virtual circuits")))
+}
+
+func TestProjectVLAN(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/virtual-networks", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"virtual_networks": []map[string]interface{}{
+			{"id": "ny", "vxlan": 1000, "metro_code": "ny"},
+			{"id": "da", "vxlan": 1000, "metro_code": "da"},
+		},
+	}})
+
+	vlan, err := c.ProjectVLAN("project", "DA", 1000)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vlan.ID).To(Equal("da"))
+
+	vlan, err = c.ProjectVLAN("project", "da", 1001)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vlan).To(BeNil())
+}
+
+func TestConnectVirtualCircuits(t *testing.T) {
+	vlan := &packngo.VirtualNetwork{ID: "vlan", VXLAN: 1000}
+
+	t.Run("dedicated", func(t *testing.T) {
+		g := NewWithT(t)
+		api, c := newFakeAPI(t)
+		api.on(http.MethodGet, "/connections/conn/ports", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"ports": []map[string]string{{"id": "primary", "role": "primary"}, {"id": "secondary", "role": "secondary"}},
+		}})
+		api.on(http.MethodGet, "/connections/conn/ports/primary/virtual-circuits", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"virtual_circuits": []map[string]interface{}{{"id": "existing", "status": "active", "virtual_network": map[string]string{"id": "vlan"}}},
+		}})
+		api.on(http.MethodGet, "/connections/conn/ports/secondary/virtual-circuits", fakeResponse{status: http.StatusOK, body: map[string]interface{}{}})
+		api.on(http.MethodPost, "/projects/project/connections/conn/ports/secondary/virtual-circuits", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "created", "status": "activating"}})
+
+		circuits, err := c.ConnectVirtualCircuits("project", &packngo.Connection{ID: "conn", Name: "cluster-dc", Type: packngo.ConnectionDedicated}, vlan, 100)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(circuits).To(Equal([]infrastructurev1alpha3.VirtualCircuitStatus{
+			{ID: "existing", Port: "primary", Status: "active"},
+			{ID: "created", Port: "secondary", Status: "activating"},
+		}))
+
+		body := api.requestsTo(http.MethodPost, "/projects/project/connections/conn/ports/secondary/virtual-circuits")[0].Body
+		g.Expect(body).To(HaveKeyWithValue("vnid", "vlan"))
+		g.Expect(body).To(HaveKeyWithValue("nni_vlan", float64(100)))
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		g := NewWithT(t)
+		api, c := newFakeAPI(t)
+		api.on(http.MethodGet, "/connections/conn/ports", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"ports": []map[string]string{{"id": "primary", "role": "primary"}, {"id": "secondary", "role": "secondary"}},
+		}})
+		api.on(http.MethodGet, "/connections/conn/ports/primary/virtual-circuits", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"virtual_circuits": []map[string]interface{}{{"id": "unassigned", "status": "waiting_on_customer_vlan"}},
+		}})
+		api.on(http.MethodGet, "/connections/conn/ports/secondary/virtual-circuits", fakeResponse{status: http.StatusOK, body: map[string]interface{}{}})
+		api.on(http.MethodPut, "/virtual-circuits/unassigned", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "unassigned", "status": "activating"}})
+
+		circuits, err := c.ConnectVirtualCircuits("project", &packngo.Connection{ID: "conn", Type: packngo.ConnectionShared}, vlan, 0)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(circuits).To(Equal([]infrastructurev1alpha3.VirtualCircuitStatus{{ID: "unassigned", Port: "primary", Status: "activating"}}))
+		g.Expect(api.requestsTo(http.MethodPut, "/virtual-circuits/unassigned")[0].Body).To(HaveKeyWithValue("vnid", "vlan"))
+	})
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/cluster-api/controllers/noderefutil"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+const (
+	// InventoryJSONKey is the key of the inventory ConfigMap of a cluster
+	// holding its inventory as JSON.
+	InventoryJSONKey = "inventory.json"
+	// InventoryCSVKey is the key of the inventory ConfigMap of a cluster
+	// holding its devices as CSV, one per line after the header.
+	InventoryCSVKey = "devices.csv"
+)
+
+// inventoryCSVHeader are the columns of the devices in CSV.
+var inventoryCSVHeader = []string{"machine", "deviceID", "plan", "billingCycle", "facility", "metro", "publicIPs", "privateIPs", "hardwareReservationID", "hourlyCost"}
+
+// Inventory is the machine-readable inventory of the Packet resources of a
+// cluster, for CMDB and budgeting systems.
+type Inventory struct {
+	Namespace      string                   `json:"namespace"`
+	Cluster        string                   `json:"cluster"`
+	ProjectID      string                   `json:"projectID"`
+	Devices        []InventoryDevice        `json:"devices"`
+	IPReservations []InventoryIPReservation `json:"ipReservations"`
+	// HourlyCost is the sum of the hourly cost of the devices whose price
+	// is known.
+	HourlyCost float64 `json:"hourlyCost"`
+}
+
+// InventoryDevice is a device of a cluster.
+type InventoryDevice struct {
+	Machine               string   `json:"machine"`
+	DeviceID              string   `json:"deviceID"`
+	Plan                  string   `json:"plan"`
+	BillingCycle          string   `json:"billingCycle,omitempty"`
+	Facility              string   `json:"facility,omitempty"`
+	Metro                 string   `json:"metro,omitempty"`
+	PublicIPs             []string `json:"publicIPs,omitempty"`
+	PrivateIPs            []string `json:"privateIPs,omitempty"`
+	HardwareReservationID string   `json:"hardwareReservationID,omitempty"`
+	// HourlyCost is the hourly price of the plan, nil when unknown.
+	HourlyCost *float64 `json:"hourlyCost,omitempty"`
+}
+
+// InventoryIPReservation is an ip reservation created for a cluster.
+type InventoryIPReservation struct {
+	ID            string `json:"id"`
+	FailureDomain string `json:"failureDomain,omitempty"`
+}
+
+// ClusterInventory returns the inventory of a cluster: the devices of its
+// machines, sorted by machine, and the ip reservations of its cleanup ledger.
+// The plan and billing cycle of a device are the ones it was created with when
+// recorded. prices is nil when the prices of the plans are not known.
+func ClusterInventory(packetCluster *infrastructurev1alpha3.PacketCluster, machines []infrastructurev1alpha3.PacketMachine, prices *CompatibilityMatrix) Inventory {
+	inventory := Inventory{
+		Namespace:      packetCluster.Namespace,
+		Cluster:        packetCluster.Name,
+		ProjectID:      packetCluster.Spec.ProjectID,
+		Devices:        []InventoryDevice{},
+		IPReservations: []InventoryIPReservation{},
+	}
+
+	for _, machine := range machines {
+		if machine.Spec.ProviderID == nil {
+			continue
+		}
+		providerID, err := noderefutil.NewProviderID(*machine.Spec.ProviderID)
+		if err != nil {
+			continue
+		}
+		device := InventoryDevice{
+			Machine:               machine.Name,
+			DeviceID:              providerID.ID(),
+			Plan:                  machine.Spec.MachineType,
+			BillingCycle:          machine.Spec.BillingCycle,
+			Facility:              machine.Status.Facility,
+			Metro:                 machine.Status.Metro,
+			HardwareReservationID: machine.Status.HardwareReservationID,
+		}
+		if record, ok := machine.Annotations[infrastructurev1alpha3.DeviceRequestAnnotation]; ok {
+			if req, err := ParseDeviceRequest(record); err == nil {
+				device.Plan, device.BillingCycle = req.Plan, req.BillingCycle
+			}
+		}
+		for _, address := range machine.Status.DeviceAddresses {
+			if address.Public {
+				device.PublicIPs = append(device.PublicIPs, address.Address)
+			} else {
+				device.PrivateIPs = append(device.PrivateIPs, address.Address)
+			}
+		}
+		if price, ok := prices.PlanHourlyPrice(device.Plan); ok {
+			device.HourlyCost = &price
+			inventory.HourlyCost += price
+		}
+		inventory.Devices = append(inventory.Devices, device)
+	}
+	sort.Slice(inventory.Devices, func(i, j int) bool { return inventory.Devices[i].Machine < inventory.Devices[j].Machine })
+
+	for _, resource := range packetCluster.Status.CreatedResources {
+		if resource.Kind == infrastructurev1alpha3.CreatedResourceIPReservation {
+			inventory.IPReservations = append(inventory.IPReservations, InventoryIPReservation{ID: resource.ID, FailureDomain: resource.FailureDomain})
+		}
+	}
+	return inventory
+}
+
+// InventoryConfigMapData returns the data of the inventory ConfigMap of a
+// cluster: the inventory as JSON, and its devices as CSV with the addresses
+// separated by spaces.
+func InventoryConfigMapData(inventory Inventory) (map[string]string, error) {
+	encoded, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	rows := [][]string{inventoryCSVHeader}
+	for _, device := range inventory.Devices {
+		cost := ""
+		if device.HourlyCost != nil {
+			cost = strconv.FormatFloat(*device.HourlyCost, 'f', -1, 64)
+		}
+		rows = append(rows, []string{
+			device.Machine, device.DeviceID, device.Plan, device.BillingCycle, device.Facility, device.Metro,
+			strings.Join(device.PublicIPs, " "), strings.Join(device.PrivateIPs, " "), device.HardwareReservationID, cost,
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		InventoryJSONKey: string(encoded),
+		InventoryCSVKey:  buf.String(),
+	}, nil
+}
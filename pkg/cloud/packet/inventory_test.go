@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestClusterInventory(t *testing.T) {
+	g := NewWithT(t)
+	packetCluster := &infrastructurev1alpha3.PacketCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "capi"},
+		Spec:       infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+		Status: infrastructurev1alpha3.PacketClusterStatus{
+			CreatedResources: []infrastructurev1alpha3.CreatedResource{
+				{Kind: infrastructurev1alpha3.CreatedResourceIPReservation, ID: "eip"},
+				{Kind: infrastructurev1alpha3.CreatedResourceVRF, ID: "vrf"},
+				{Kind: infrastructurev1alpha3.CreatedResourceIPReservation, ID: "eip-ewr1", FailureDomain: "ewr1"},
+			},
+		},
+	}
+	machines := []infrastructurev1alpha3.PacketMachine{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "worker-0",
+				Annotations: map[string]string{infrastructurev1alpha3.DeviceRequestAnnotation: `{"plan":"m3.large.x86","billing_cycle":"hourly"}`},
+			},
+			Spec: infrastructurev1alpha3.PacketMachineSpec{ProviderID: pointer.StringPtr("equinixmetal://device-2")},
+			Status: infrastructurev1alpha3.PacketMachineStatus{
+				Facility: "sv15", Metro: "sv", HardwareReservationID: "reservation",
+				DeviceAddresses: []infrastructurev1alpha3.DeviceAddress{
+					{Address: "147.75.10.2", Public: true},
+					{Address: "10.99.0.3"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "cp-0"},
+			Spec:       infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86", BillingCycle: "hourly", ProviderID: pointer.StringPtr("packet://device-1")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unknown-plan"},
+			Spec:       infrastructurev1alpha3.PacketMachineSpec{MachineType: "x1.small.x86", ProviderID: pointer.StringPtr("packet://device-3")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+			Spec:       infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86"},
+		},
+	}
+	prices := NewCompatibilityMatrix([]packngo.Plan{
+		{Slug: "c3.small.x86", Pricing: &packngo.Pricing{Hour: 0.5}},
+		{Slug: "m3.large.x86", Pricing: &packngo.Pricing{Hour: 1.5}},
+		{Slug: "x1.small.x86"},
+	}, nil)
+
+	inventory := ClusterInventory(packetCluster, machines, prices)
+	g.Expect(inventory.Namespace).To(Equal("default"))
+	g.Expect(inventory.Cluster).To(Equal("capi"))
+	g.Expect(inventory.ProjectID).To(Equal("project"))
+	g.Expect(inventory.HourlyCost).To(Equal(2.0))
+	g.Expect(inventory.IPReservations).To(Equal([]InventoryIPReservation{{ID: "eip"}, {ID: "eip-ewr1", FailureDomain: "ewr1"}}))
+
+	g.Expect(inventory.Devices).To(HaveLen(3))
+	g.Expect(inventory.Devices[0].Machine).To(Equal("cp-0"))
+	g.Expect(inventory.Devices[0].DeviceID).To(Equal("device-1"))
+	g.Expect(*inventory.Devices[0].HourlyCost).To(Equal(0.5))
+	g.Expect(inventory.Devices[1].Machine).To(Equal("unknown-plan"))
+	g.Expect(inventory.Devices[1].HourlyCost).To(BeNil())
+	// the plan the device was created with is preferred
+	g.Expect(inventory.Devices[2]).To(Equal(InventoryDevice{
+		Machine: "worker-0", DeviceID: "device-2", Plan: "m3.large.x86", BillingCycle: "hourly",
+		Facility: "sv15", Metro: "sv", PublicIPs: []string{"147.75.10.2"}, PrivateIPs: []string{"10.99.0.3"},
+		HardwareReservationID: "reservation", HourlyCost: pointer.Float64Ptr(1.5),
+	}))
+
+	// the costs are left out while the prices are not known
+	inventory = ClusterInventory(packetCluster, machines, nil)
+	g.Expect(inventory.HourlyCost).To(BeZero())
+	g.Expect(inventory.Devices[0].HourlyCost).To(BeNil())
+}
+
+func TestInventoryConfigMapData(t *testing.T) {
+	g := NewWithT(t)
+	inventory := Inventory{
+		Namespace: "default", Cluster: "capi", ProjectID: "project",
+		Devices: []InventoryDevice{
+			{Machine: "cp-0", DeviceID: "device-1", Plan: "c3.small.x86", BillingCycle: "hourly", Metro: "sv", PublicIPs: []string{"147.75.10.2", "2604:1380::1"}, HourlyCost: pointer.Float64Ptr(0.5)},
+			{Machine: "worker-0", DeviceID: "device-2", Plan: "x1.small.x86"},
+		},
+		IPReservations: []InventoryIPReservation{},
+		HourlyCost:     0.5,
+	}
+
+	data, err := InventoryConfigMapData(inventory)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data[InventoryCSVKey]).To(Equal("machine,deviceID,plan,billingCycle,facility,metro,publicIPs,privateIPs,hardwareReservationID,hourlyCost\n" +
+		"cp-0,device-1,c3.small.x86,hourly,,sv,147.75.10.2 2604:1380::1,,,0.5\n" +
+		"worker-0,device-2,x1.small.x86,,,,,,,\n"))
+
+	decoded := Inventory{}
+	g.Expect(json.Unmarshal([]byte(data[InventoryJSONKey]), &decoded)).To(Succeed())
+	g.Expect(decoded).To(Equal(inventory))
+}
+
+func TestPlanHourlyPrice(t *testing.T) {
+	g := NewWithT(t)
+	m := NewCompatibilityMatrix([]packngo.Plan{{Slug: "c3.small.x86", Pricing: &packngo.Pricing{Hour: 0.5}}, {Slug: "free"}}, nil)
+
+	price, ok := m.PlanHourlyPrice("c3.small.x86")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(price).To(Equal(0.5))
+	_, ok = m.PlanHourlyPrice("free")
+	g.Expect(ok).To(BeFalse())
+	_, ok = m.PlanHourlyPrice("missing")
+	g.Expect(ok).To(BeFalse())
+	var none *CompatibilityMatrix
+	_, ok = none.PlanHourlyPrice("c3.small.x86")
+	g.Expect(ok).To(BeFalse())
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"strings"
+	"time"
+
+	"github.com/packethost/packngo"
+)
+
+// ClusterIPReservation is an ip reservation tagged by the provider, with the
+// cluster it was reserved for. ClusterNamespace is empty for the reservations
+// tagged with the legacy identifier.
+type ClusterIPReservation struct {
+	packngo.IPAddressReservation
+	ClusterNamespace string
+	ClusterName      string
+}
+
+// ClusterKey returns the key of the cluster of the reservation: namespace/name,
+// or only the name for a legacy reservation.
+func (r ClusterIPReservation) ClusterKey() string {
+	if r.ClusterNamespace == "" {
+		return r.ClusterName
+	}
+	return r.ClusterNamespace + "/" + r.ClusterName
+}
+
+// ClusterFromIPTags returns the namespace and the name of the cluster an ip
+// reservation was reserved for, and false when none of the tags is a provider
+// identifier. The namespace is empty for a legacy identifier.
+func ClusterFromIPTags(tags []string) (string, string, bool) {
+	prefix := clusterIDTag + ":"
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(tag, prefix)
+		if i := strings.Index(name, ":facility:"); i >= 0 {
+			name = name[:i]
+		}
+		namespace := ""
+		if i := strings.Index(name, "/"); i >= 0 {
+			namespace, name = name[:i], name[i+1:]
+		}
+		if name != "" {
+			return namespace, name, true
+		}
+	}
+	return "", "", false
+}
+
+// StaleIPReservations returns the reservations whose cluster is not in
+// clusters, keyed both by namespace/name and by name for the legacy ones.
+// Reservations younger than minAge, whose age is unknown, or still assigned to
+// a device are kept: they may belong to a cluster being created or to a device
+// not cleaned up yet. Parked reservations are kept for their cluster to come
+// back.
+func StaleIPReservations(reservations []ClusterIPReservation, clusters map[string]bool, minAge time.Duration, now time.Time) []ClusterIPReservation {
+	stale := []ClusterIPReservation{}
+	for _, r := range reservations {
+		if clusters[r.ClusterKey()] || len(r.Assignments) > 0 || ItemsInList(r.Tags, []string{ParkedIPTag}) {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, r.Created)
+		if err != nil || now.Sub(created) < minAge {
+			continue
+		}
+		stale = append(stale, r)
+	}
+	return stale
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+)
+
+func TestClusterFromIPTags(t *testing.T) {
+	tests := []struct {
+		name          string
+		tags          []string
+		wantNamespace string
+		wantName      string
+		wantOK        bool
+	}{
+		{name: "cluster ip", tags: []string{"other", generateElasticIPIdentifier("ns", "foo")}, wantNamespace: "ns", wantName: "foo", wantOK: true},
+		{name: "facility ip", tags: []string{generateFacilityElasticIPIdentifier("ns", "foo", "ewr1")}, wantNamespace: "ns", wantName: "foo", wantOK: true},
+		{name: "legacy cluster ip", tags: []string{generateLegacyElasticIPIdentifier("foo")}, wantName: "foo", wantOK: true},
+		{name: "legacy facility ip", tags: []string{generateLegacyFacilityElasticIPIdentifier("foo", "ewr1")}, wantName: "foo", wantOK: true},
+		{name: "untagged", tags: []string{"cluster-api-provider-packet:machine-uid:foo"}},
+		{name: "no tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			namespace, name, ok := ClusterFromIPTags(tt.tags)
+			g.Expect(ok).To(Equal(tt.wantOK))
+			g.Expect(namespace).To(Equal(tt.wantNamespace))
+			g.Expect(name).To(Equal(tt.wantName))
+		})
+	}
+}
+
+func TestStaleIPReservations(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	reservation := func(id, namespace, cluster string, age time.Duration, assigned bool) ClusterIPReservation {
+		r := ClusterIPReservation{ClusterNamespace: namespace, ClusterName: cluster}
+		r.ID = id
+		r.Created = now.Add(-age).Format(time.RFC3339)
+		if assigned {
+			r.Assignments = []*packngo.IPAddressAssignment{{}}
+		}
+		return r
+	}
+
+	reservations := []ClusterIPReservation{
+		reservation("live", "ns", "foo", 2*time.Hour, false),
+		reservation("live-legacy", "", "foo", 2*time.Hour, false),
+		reservation("other-namespace", "other", "foo", 2*time.Hour, false),
+		reservation("stale", "ns", "bar", 2*time.Hour, false),
+		reservation("young", "ns", "bar", time.Minute, false),
+		reservation("assigned", "ns", "bar", 2*time.Hour, true),
+		reservation("parked", "ns", "baz", 2*time.Hour, false),
+	}
+	reservations[len(reservations)-1].Tags = []string{ParkedIPTag}
+
+	stale := StaleIPReservations(reservations, map[string]bool{"ns/foo": true, "foo": true}, time.Hour, now)
+	g.Expect(stale).To(HaveLen(2))
+	g.Expect(stale[0].ID).To(Equal("other-namespace"))
+	g.Expect(stale[1].ID).To(Equal("stale"))
+}
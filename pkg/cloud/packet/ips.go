@@ -0,0 +1,362 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// IPService reserves the control plane ips of the clusters, assigns them to
+// devices and releases them.
+type IPService interface {
+	CreateIP(owner IPOwner, projectID string, ipScope infrastructurev1alpha3.IPReservationScope, location string, meta *infrastructurev1alpha3.IPReservationMetadata) (packngo.IPAddressReservation, error)
+	CreateFacilityIP(owner IPOwner, projectID, facility string, meta *infrastructurev1alpha3.IPReservationMetadata) (packngo.IPAddressReservation, error)
+	GetIPByClusterIdentifier(owner IPOwner, projectID string) (packngo.IPAddressReservation, error)
+	GetIPByFacilityIdentifier(owner IPOwner, projectID, facility string) (packngo.IPAddressReservation, error)
+	AssignIP(deviceID, address string) error
+	ListClusterIPs(projectID string) ([]ClusterIPReservation, error)
+	ReleaseIP(reservationID string) error
+	ParkClusterIPs(namespace, clusterName, projectID string) (int, error)
+}
+
+// IPOwner identifies the cluster the ElasticIPs are reserved for. The tags
+// derived from the namespace and name find the ips, the UID tells the cluster
+// apart from a deleted one with the same namespace and name. It is the UID
+// recorded on the PacketCluster, see ClusterUID, for a cluster moved to
+// another management cluster to keep its ips.
+type IPOwner struct {
+	Namespace string
+	Name      string
+	UID       string
+	// AdoptExisting lets the cluster take over the ips another cluster with
+	// the same namespace and name left behind without parking them.
+	AdoptExisting bool
+}
+
+// ClusterIPOwner returns the owner of the ElasticIPs of a cluster.
+func ClusterIPOwner(clusterScope *scope.ClusterScope) IPOwner {
+	return IPOwner{
+		Namespace:     clusterScope.Namespace(),
+		Name:          clusterScope.Name(),
+		UID:           ClusterUID(clusterScope.PacketCluster),
+		AdoptExisting: clusterScope.PacketCluster.Spec.AdoptExistingIP,
+	}
+}
+
+// CreateIP reserves an IP via Packet API. The request fails straight if no IP are available for the specified project.
+// This prevent the cluster to become ready.
+// location is the facility or the metro code, depending on the scope. It is ignored for global ips.
+// meta adds the user tags and description to the reservation, it may be nil.
+// The reservation is returned for its id to be recorded in the cleanup ledger
+// of the cluster.
+func (p *PacketClient) CreateIP(owner IPOwner, projectID string, ipScope infrastructurev1alpha3.IPReservationScope, location string, meta *infrastructurev1alpha3.IPReservationMetadata) (packngo.IPAddressReservation, error) {
+	req := packngo.IPReservationRequest{
+		Type:                   packngo.PublicIPv4,
+		Quantity:               1,
+		FailOnApprovalRequired: true,
+		Tags:                   ownerIPTags(owner, generateElasticIPIdentifier(owner.Namespace, owner.Name)),
+	}
+	if err := setIPReservationDetails(&req, meta, owner.Namespace, owner.Name, IPPurposeControlPlane); err != nil {
+		return packngo.IPAddressReservation{}, err
+	}
+
+	switch ipScope {
+	case infrastructurev1alpha3.IPReservationScopeGlobal:
+		req.Type = packngo.GlobalIPv4
+	case infrastructurev1alpha3.IPReservationScopeMetro:
+		req.Metro = &location
+	default:
+		req.Facility = &location
+	}
+
+	return p.requestIP(projectID, &req)
+}
+
+// CreateFacilityIP reserves an ElasticIP dedicated to the control plane
+// machines placed in a facility other than the cluster one.
+func (p *PacketClient) CreateFacilityIP(owner IPOwner, projectID, facility string, meta *infrastructurev1alpha3.IPReservationMetadata) (packngo.IPAddressReservation, error) {
+	req := packngo.IPReservationRequest{
+		Type:                   packngo.PublicIPv4,
+		Quantity:               1,
+		Facility:               &facility,
+		FailOnApprovalRequired: true,
+		Tags:                   ownerIPTags(owner, generateFacilityElasticIPIdentifier(owner.Namespace, owner.Name, facility)),
+	}
+	if err := setIPReservationDetails(&req, meta, owner.Namespace, owner.Name, IPPurposeFacilityControlPlane); err != nil {
+		return packngo.IPAddressReservation{}, err
+	}
+
+	return p.requestIP(projectID, &req)
+}
+
+// ownerIPTags returns the tags identifying a new ip reservation of owner.
+func ownerIPTags(owner IPOwner, identifier string) []string {
+	if owner.UID == "" {
+		return []string{identifier}
+	}
+	return []string{identifier, GenerateClusterUIDTag(owner.UID)}
+}
+
+// setIPReservationDetails adds the user tags and description to an ip
+// reservation request.
+func setIPReservationDetails(req *packngo.IPReservationRequest, meta *infrastructurev1alpha3.IPReservationMetadata, namespace, clusterName, purpose string) error {
+	tags, description, err := IPReservationDetails(meta, namespace, clusterName, purpose)
+	if err != nil {
+		return err
+	}
+	req.Tags = append(req.Tags, tags...)
+	req.Description = description
+	return nil
+}
+
+func (p *PacketClient) requestIP(projectID string, req *packngo.IPReservationRequest) (packngo.IPAddressReservation, error) {
+	r, resp, err := p.ProjectIPs.Request(projectID, req)
+	if err != nil {
+		return packngo.IPAddressReservation{}, packeterrors.Wrap(err)
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return packngo.IPAddressReservation{}, packeterrors.New(packeterrors.ReasonQuotaExceeded,
+			fmt.Errorf("Could not create an Elastic IP due to quota limits on the account. Please contact Packet support."))
+	}
+
+	if net.ParseIP(r.Address) == nil {
+		return packngo.IPAddressReservation{}, fmt.Errorf("impossible to parse IP: %s. IP not valid.", r.Address)
+	}
+	return *r, nil
+}
+
+// GetIPByClusterIdentifier returns the ElasticIP reserved for the control
+// plane of the cluster. An ip tagged with the legacy identifier, which only
+// holds the cluster name, is claimed by retagging it for the namespace. An ip
+// reserved for another cluster with the same namespace and name is refused,
+// see VerifyIPOwner.
+func (p *PacketClient) GetIPByClusterIdentifier(owner IPOwner, projectID string) (packngo.IPAddressReservation, error) {
+	return p.getIPByTag(owner, projectID,
+		generateElasticIPIdentifier(owner.Namespace, owner.Name),
+		generateLegacyElasticIPIdentifier(owner.Name))
+}
+
+// GetIPByFacilityIdentifier returns the ElasticIP reserved for the control
+// plane machines placed in the given facility.
+func (p *PacketClient) GetIPByFacilityIdentifier(owner IPOwner, projectID, facility string) (packngo.IPAddressReservation, error) {
+	return p.getIPByTag(owner, projectID,
+		generateFacilityElasticIPIdentifier(owner.Namespace, owner.Name, facility),
+		generateLegacyFacilityElasticIPIdentifier(owner.Name, facility))
+}
+
+func (p *PacketClient) getIPByTag(owner IPOwner, projectID, tag, legacyTag string) (packngo.IPAddressReservation, error) {
+	var err error
+	var reservedIP packngo.IPAddressReservation
+
+	listOpts := &packngo.ListOptions{}
+	reservedIPs, _, err := p.ProjectIPs.List(projectID, listOpts)
+	if err != nil {
+		return reservedIP, packeterrors.Wrap(err)
+	}
+	for _, reservedIP := range reservedIPs {
+		if !ItemsInList(reservedIP.Tags, []string{tag}) {
+			continue
+		}
+		tags, err := VerifyIPOwner(reservedIP, owner)
+		if err != nil {
+			return reservedIP, err
+		}
+		// The ip was kept for the cluster after a previous deletion, the
+		// cluster takes it back.
+		tags = removeTag(tags, ParkedIPTag)
+		if !equalTags(tags, reservedIP.Tags) {
+			if err := p.updateIPTags(reservedIP.ID, tags); err != nil {
+				return reservedIP, fmt.Errorf("failed to claim ip reservation %s: %w", reservedIP.ID, err)
+			}
+			reservedIP.Tags = tags
+		}
+		return reservedIP, nil
+	}
+	for _, reservedIP := range reservedIPs {
+		if !ItemsInList(reservedIP.Tags, []string{legacyTag}) {
+			continue
+		}
+		// Claim the ip so that a cluster with the same name in another
+		// namespace does not find it anymore.
+		tags := []string{}
+		for _, v := range reservedIP.Tags {
+			if v == legacyTag {
+				v = tag
+			}
+			tags = append(tags, v)
+		}
+		if owner.UID != "" {
+			tags = append(tags, GenerateClusterUIDTag(owner.UID))
+		}
+		if err := p.updateIPTags(reservedIP.ID, tags); err != nil {
+			return reservedIP, fmt.Errorf("failed to claim ip reservation %s: %w", reservedIP.ID, err)
+		}
+		reservedIP.Tags = tags
+		return reservedIP, nil
+	}
+	return reservedIP, ErrControlPlanEndpointNotFound
+}
+
+// VerifyIPOwner checks that an ip reservation found by the identifier of
+// owner can be used by it, and returns its tags with the UID of owner. The ip
+// is refused when it is tagged with the UID of another cluster, unless that
+// cluster parked it on deletion or owner adopts existing ips. Reservations
+// made before the UID tag existed are claimed.
+func VerifyIPOwner(reservation packngo.IPAddressReservation, owner IPOwner) ([]string, error) {
+	tags := append([]string{}, reservation.Tags...)
+	if owner.UID == "" {
+		return tags, nil
+	}
+	uidTag := GenerateClusterUIDTag(owner.UID)
+	for i, tag := range tags {
+		if !strings.HasPrefix(tag, ClusterUIDTag+":") {
+			continue
+		}
+		if tag != uidTag && !ItemsInList(tags, []string{ParkedIPTag}) && !owner.AdoptExisting {
+			return nil, fmt.Errorf("ip reservation %s (%s) belongs to cluster %s/%s with uid %s, set adoptExistingIP to reuse it: %w",
+				reservation.ID, reservation.Address, owner.Namespace, owner.Name, strings.TrimPrefix(tag, ClusterUIDTag+":"), ErrIPOwnedByAnotherCluster)
+		}
+		tags[i] = uidTag
+		return tags, nil
+	}
+	return append(tags, uidTag), nil
+}
+
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AssignIP assigns a reserved ip to a device, unless it is assigned already,
+// and checks the assignment is listed with the ips of the device. While the
+// reservation of the ip propagates Packet can refuse the assignment, or not
+// list it yet: the errors wrapping ErrIPAssignmentPending go away by
+// themselves.
+func (p *PacketClient) AssignIP(deviceID, address string) error {
+	assigned, err := p.deviceHasIP(deviceID, address)
+	if err != nil || assigned {
+		return err
+	}
+
+	defer p.devices.invalidate(deviceID)
+	_, _, err = p.DeviceIPs.Assign(deviceID, &packngo.AddressStruct{Address: address})
+	if err = packeterrors.Wrap(err); err != nil {
+		var perr *packeterrors.PacketError
+		if errors.As(err, &perr) && (perr.StatusCode == http.StatusNotFound || perr.StatusCode == http.StatusUnprocessableEntity) {
+			return fmt.Errorf("failed to assign ip %s to device %s: %v: %w", address, deviceID, err, ErrIPAssignmentPending)
+		}
+		return fmt.Errorf("failed to assign ip %s to device %s: %w", address, deviceID, err)
+	}
+
+	assigned, err = p.deviceHasIP(deviceID, address)
+	if err != nil {
+		return err
+	}
+	if !assigned {
+		return fmt.Errorf("ip %s is not listed with the ips of device %s yet: %w", address, deviceID, ErrIPAssignmentPending)
+	}
+	return nil
+}
+
+// deviceHasIP tells whether address is assigned to a device.
+func (p *PacketClient) deviceHasIP(deviceID, address string) (bool, error) {
+	assignments, _, err := p.DeviceIPs.List(deviceID, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to list the ips of device %s: %w", deviceID, packeterrors.Wrap(err))
+	}
+	for _, assignment := range assignments {
+		if assignment.Address == address {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListClusterIPs returns the ip reservations of a project reserved by the
+// provider for a cluster.
+func (p *PacketClient) ListClusterIPs(projectID string) ([]ClusterIPReservation, error) {
+	ips, _, err := p.ProjectIPs.List(projectID, nil)
+	if err != nil {
+		return nil, packeterrors.Wrap(err)
+	}
+	reservations := []ClusterIPReservation{}
+	for _, ip := range ips {
+		if namespace, name, ok := ClusterFromIPTags(ip.Tags); ok {
+			reservations = append(reservations, ClusterIPReservation{IPAddressReservation: ip, ClusterNamespace: namespace, ClusterName: name})
+		}
+	}
+	return reservations, nil
+}
+
+// ParkClusterIPs tags the ip reservations of a cluster as parked, so that they
+// are kept after its deletion, until a new cluster with the same namespace and
+// name looks them up. It returns the number of reservations parked.
+func (p *PacketClient) ParkClusterIPs(namespace, clusterName, projectID string) (int, error) {
+	reservations, err := p.ListClusterIPs(projectID)
+	if err != nil {
+		return 0, err
+	}
+	parked := 0
+	for _, r := range reservations {
+		if r.ClusterNamespace != namespace || r.ClusterName != clusterName || ItemsInList(r.Tags, []string{ParkedIPTag}) {
+			continue
+		}
+		if err := p.updateIPTags(r.ID, append(append([]string{}, r.Tags...), ParkedIPTag)); err != nil {
+			return parked, fmt.Errorf("failed to park ip reservation %s: %w", r.ID, err)
+		}
+		parked++
+	}
+	return parked, nil
+}
+
+// ReleaseIP releases an ip reservation. A reservation already gone is not an
+// error.
+func (p *PacketClient) ReleaseIP(reservationID string) error {
+	_, err := p.ProjectIPs.Remove(reservationID)
+	if err = packeterrors.Wrap(err); err != nil && !packeterrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// updateIPTags replaces the tags of an ip reservation. packngo does not
+// expose an update call for ip reservations, so the request is made directly.
+func (p *PacketClient) updateIPTags(reservationID string, tags []string) error {
+	req, err := p.NewRequest("PATCH", fmt.Sprintf("/ips/%s", reservationID), map[string][]string{"tags": tags})
+	if err != nil {
+		return err
+	}
+	_, err = p.Do(req, nil)
+	return packeterrors.Wrap(err)
+}
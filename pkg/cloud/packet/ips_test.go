@@ -0,0 +1,376 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+func TestCreateIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipScope  infrastructurev1alpha3.IPReservationScope
+		location string
+		meta     *infrastructurev1alpha3.IPReservationMetadata
+		want     map[string]interface{}
+		wantTags []interface{}
+	}{
+		{
+			name:     "facility",
+			ipScope:  infrastructurev1alpha3.IPReservationScopeFacility,
+			location: "ewr1",
+			want:     map[string]interface{}{"type": "public_ipv4", "facility": "ewr1"},
+			wantTags: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name:     "metro",
+			ipScope:  infrastructurev1alpha3.IPReservationScopeMetro,
+			location: "ny",
+			want:     map[string]interface{}{"type": "public_ipv4", "metro": "ny"},
+			wantTags: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name:     "global with metadata",
+			ipScope:  infrastructurev1alpha3.IPReservationScopeGlobal,
+			location: "ignored",
+			meta:     &infrastructurev1alpha3.IPReservationMetadata{Tags: []string{"team:platform"}, Description: "{{ .Purpose }} of {{ .Cluster }}"},
+			want:     map[string]interface{}{"type": "global_ipv4", "details": "control-plane of capi"},
+			wantTags: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid", "team:platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("POST", "/projects/project/ips", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "reservation", "address": "147.75.1.1"}})
+
+			ip, err := c.CreateIP(IPOwner{Namespace: "default", Name: "capi", UID: "uid"}, "project", tt.ipScope, tt.location, tt.meta)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ip.Address).To(Equal("147.75.1.1"))
+			g.Expect(ip.ID).To(Equal("reservation"))
+
+			requests := api.requestsTo("POST", "/projects/project/ips")
+			g.Expect(requests).To(HaveLen(1))
+			for key, value := range tt.want {
+				g.Expect(requests[0].Body).To(HaveKeyWithValue(key, value))
+			}
+			g.Expect(requests[0].Body["tags"]).To(Equal(tt.wantTags))
+			if tt.ipScope == infrastructurev1alpha3.IPReservationScopeGlobal {
+				g.Expect(requests[0].Body).NotTo(HaveKey("facility"))
+				g.Expect(requests[0].Body).NotTo(HaveKey("metro"))
+			}
+		})
+	}
+}
+
+func TestCreateFacilityIP(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/ips", fakeResponse{status: http.StatusCreated, body: map[string]string{"address": "147.75.1.2"}})
+
+	owner := IPOwner{Namespace: "default", Name: "capi"}
+	ip, err := c.CreateFacilityIP(owner, "project", "sjc1", nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ip.Address).To(Equal("147.75.1.2"))
+
+	requests := api.requestsTo("POST", "/projects/project/ips")
+	g.Expect(requests[0].Body).To(HaveKeyWithValue("facility", "sjc1"))
+	g.Expect(requests[0].Body["tags"]).To(Equal([]interface{}{"cluster-api-provider-packet:cluster-id:default/capi:facility:sjc1"}))
+
+	_, err = c.CreateFacilityIP(owner, "project", "sjc1", &infrastructurev1alpha3.IPReservationMetadata{Description: "{{ .Owner }}"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCreateIPFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   fakeResponse
+		wantReason packeterrors.Reason
+	}{
+		{
+			name:       "quota exceeded",
+			response:   fakeResponse{status: http.StatusUnprocessableEntity, body: apiError("Quota exceeded for this project")},
+			wantReason: packeterrors.ReasonQuotaExceeded,
+		},
+		{
+			name:       "invalid address",
+			response:   fakeResponse{status: http.StatusCreated, body: map[string]string{"address": "invalid"}},
+			wantReason: packeterrors.ReasonUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("POST", "/projects/project/ips", tt.response)
+
+			_, err := c.CreateIP(IPOwner{Namespace: "default", Name: "capi"}, "project", infrastructurev1alpha3.IPReservationScopeFacility, "ewr1", nil)
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(packeterrors.ReasonForError(err)).To(Equal(tt.wantReason))
+		})
+	}
+}
+
+func TestGetIPByClusterIdentifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		ips       []map[string]interface{}
+		adopt     bool
+		wantID    string
+		wantErr   error
+		wantClaim []interface{}
+	}{
+		{
+			name: "current identifier",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:other/capi"}},
+				{"id": "ip-2", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"}},
+			},
+			wantID: "ip-2",
+		},
+		{
+			name: "legacy identifier is claimed",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"team:platform", "cluster-api-provider-packet:cluster-id:capi"}},
+			},
+			wantID:    "ip-1",
+			wantClaim: []interface{}{"team:platform", "cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name: "ip without uid is claimed",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi"}},
+			},
+			wantID:    "ip-1",
+			wantClaim: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name: "parked identifier is unparked",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid", "cluster-api-provider-packet:parked"}},
+			},
+			wantID:    "ip-1",
+			wantClaim: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name: "parked ip of a deleted cluster is taken over",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:old", "cluster-api-provider-packet:parked"}},
+			},
+			wantID:    "ip-1",
+			wantClaim: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name: "ip of a deleted cluster is refused",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:old"}},
+			},
+			wantErr: ErrIPOwnedByAnotherCluster,
+		},
+		{
+			name: "ip of a deleted cluster is adopted",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:old"}},
+			},
+			adopt:     true,
+			wantID:    "ip-1",
+			wantClaim: []interface{}{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:cluster-uid:uid"},
+		},
+		{
+			name: "not found",
+			ips: []map[string]interface{}{
+				{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi:facility:sjc1"}},
+			},
+			wantErr: ErrControlPlanEndpointNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": tt.ips}})
+			api.on("PATCH", "/ips/ip-1", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "ip-1"}})
+
+			ip, err := c.GetIPByClusterIdentifier(IPOwner{Namespace: "default", Name: "capi", UID: "uid", AdoptExisting: tt.adopt}, "project")
+			if tt.wantErr != nil {
+				g.Expect(errors.Is(err, tt.wantErr)).To(BeTrue())
+				g.Expect(api.requestsTo("PATCH", "/ips/ip-1")).To(BeEmpty())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ip.ID).To(Equal(tt.wantID))
+
+			claims := api.requestsTo("PATCH", "/ips/ip-1")
+			if tt.wantClaim == nil {
+				g.Expect(claims).To(BeEmpty())
+				return
+			}
+			g.Expect(claims).To(HaveLen(1))
+			g.Expect(claims[0].Body["tags"]).To(Equal(tt.wantClaim))
+		})
+	}
+}
+
+func TestGetIPByFacilityIdentifier(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]interface{}{
+		{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi"}},
+		{"id": "ip-2", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi:facility:sjc1"}},
+	}}})
+
+	owner := IPOwner{Namespace: "default", Name: "capi"}
+	ip, err := c.GetIPByFacilityIdentifier(owner, "project", "sjc1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ip.ID).To(Equal("ip-2"))
+
+	_, err = c.GetIPByFacilityIdentifier(owner, "project", "da11")
+	g.Expect(err).To(Equal(ErrControlPlanEndpointNotFound))
+}
+
+func TestAssignIP(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	noIPs := fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]string{}}}
+	assigned := fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]string{{"id": "assignment", "address": "147.75.1.1"}}}}
+	api.on("GET", "/devices/device/ips", noIPs, assigned)
+	api.on("POST", "/devices/device/ips", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "assignment"}})
+
+	g.Expect(c.AssignIP("device", "147.75.1.1")).To(Succeed())
+	g.Expect(api.requestsTo("POST", "/devices/device/ips")[0].Body).To(HaveKeyWithValue("address", "147.75.1.1"))
+	// the ip is not assigned again
+	g.Expect(c.AssignIP("device", "147.75.1.1")).To(Succeed())
+	g.Expect(api.requestsTo("POST", "/devices/device/ips")).To(HaveLen(1))
+
+	g.Expect(packeterrors.IsNotFound(c.AssignIP("unknown", "147.75.1.1"))).To(BeTrue())
+}
+
+func TestAssignIPPending(t *testing.T) {
+	noIPs := fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]string{}}}
+	created := fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "assignment"}}
+
+	tests := []struct {
+		name        string
+		assign      fakeResponse
+		wantPending bool
+	}{
+		{
+			name:        "reservation not found yet",
+			assign:      fakeResponse{status: http.StatusNotFound, body: apiError("Not found")},
+			wantPending: true,
+		},
+		{
+			name:        "address not assignable yet",
+			assign:      fakeResponse{status: http.StatusUnprocessableEntity, body: apiError("Address is not available")},
+			wantPending: true,
+		},
+		{
+			name:        "assignment not listed yet",
+			assign:      created,
+			wantPending: true,
+		},
+		{
+			name:   "forbidden",
+			assign: fakeResponse{status: http.StatusForbidden, body: apiError("You are not authorized")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("GET", "/devices/device/ips", noIPs)
+			api.on("POST", "/devices/device/ips", tt.assign)
+
+			err := c.AssignIP("device", "147.75.1.1")
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(errors.Is(err, ErrIPAssignmentPending)).To(Equal(tt.wantPending))
+		})
+	}
+}
+
+func TestListClusterIPs(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]interface{}{
+		{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi"}},
+		{"id": "ip-2", "tags": []string{"cluster-api-provider-packet:cluster-id:legacy"}},
+		{"id": "ip-3", "tags": []string{"team:platform"}},
+	}}})
+
+	reservations, err := c.ListClusterIPs("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reservations).To(HaveLen(2))
+	g.Expect(reservations[0].ClusterKey()).To(Equal("default/capi"))
+	g.Expect(reservations[1].ClusterKey()).To(Equal("legacy"))
+}
+
+func TestParkClusterIPs(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]interface{}{
+		{"id": "ip-1", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi"}},
+		{"id": "ip-2", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi:facility:sjc1"}},
+		{"id": "ip-3", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:parked"}},
+		{"id": "ip-4", "tags": []string{"cluster-api-provider-packet:cluster-id:other/capi"}},
+	}}})
+	api.on("PATCH", "/ips/ip-1", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "ip-1"}})
+	api.on("PATCH", "/ips/ip-2", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "ip-2"}})
+
+	parked, err := c.ParkClusterIPs("default", "capi", "project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(parked).To(Equal(2))
+	g.Expect(api.requestsTo("PATCH", "/ips/ip-1")[0].Body["tags"]).To(Equal([]interface{}{
+		"cluster-api-provider-packet:cluster-id:default/capi", "cluster-api-provider-packet:parked",
+	}))
+	g.Expect(api.requestsTo("PATCH", "/ips/ip-2")).To(HaveLen(1))
+	g.Expect(api.requestsTo("PATCH", "/ips/ip-3")).To(BeEmpty())
+	g.Expect(api.requestsTo("PATCH", "/ips/ip-4")).To(BeEmpty())
+}
+
+func TestReleaseIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeResponse
+		wantErr  bool
+	}{
+		{name: "released", response: fakeResponse{status: http.StatusNoContent}},
+		{name: "already gone", response: fakeResponse{status: http.StatusNotFound, body: apiError("Not found")}},
+		{name: "failure", response: fakeResponse{status: http.StatusForbidden, body: apiError("Forbidden")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on("DELETE", "/ips/ip-1", tt.response)
+
+			err := c.ReleaseIP("ip-1")
+			g.Expect(err != nil).To(Equal(tt.wantErr))
+		})
+	}
+}
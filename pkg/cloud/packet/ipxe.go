@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// ipxeShebang starts every iPXE script.
+const ipxeShebang = "#!ipxe"
+
+// ValidateBootProfile returns an ErrInvalidRequest when a boot profile sets
+// both or none of a script and a kernel.
+func ValidateBootProfile(profile infrastructurev1alpha3.PacketBootProfileSpec) error {
+	switch {
+	case profile.Script != "" && profile.Kernel != "":
+		return fmt.Errorf("the boot profile sets both a script and a kernel: %w", ErrInvalidRequest)
+	case profile.Script == "" && profile.Kernel == "":
+		return fmt.Errorf("the boot profile sets neither a script nor a kernel: %w", ErrInvalidRequest)
+	case profile.Script != "" && !strings.HasPrefix(profile.Script, ipxeShebang):
+		return fmt.Errorf("the boot profile script does not start with %s: %w", ipxeShebang, ErrInvalidRequest)
+	}
+	return nil
+}
+
+// IPXEScriptVariables returns the variables the boot profile of a
+// PacketMachine is rendered with.
+func IPXEScriptVariables(packetMachine *infrastructurev1alpha3.PacketMachine) map[string]string {
+	return map[string]string{
+		"namespace":   packetMachine.Namespace,
+		"name":        packetMachine.Name,
+		"cluster":     packetMachine.Labels[clusterv1.ClusterLabelName],
+		"facility":    packetMachine.Status.Facility,
+		"machineType": packetMachine.Spec.MachineType,
+	}
+}
+
+// RenderIPXEScript returns the iPXE script of a boot profile, its script or
+// the one booting its kernel, rendered with vars.
+func RenderIPXEScript(profile infrastructurev1alpha3.PacketBootProfileSpec, vars map[string]string) (string, error) {
+	if err := ValidateBootProfile(profile); err != nil {
+		return "", err
+	}
+
+	script := profile.Script
+	if script == "" {
+		b := &strings.Builder{}
+		b.WriteString(ipxeShebang + "\n")
+		fmt.Fprintf(b, "kernel %s", profile.Kernel)
+		if profile.Args != "" {
+			fmt.Fprintf(b, " %s", profile.Args)
+		}
+		b.WriteString("\n")
+		for _, initrd := range profile.Initrds {
+			fmt.Fprintf(b, "initrd %s\n", initrd)
+		}
+		b.WriteString("boot\n")
+		script = b.String()
+	}
+
+	tmpl, err := template.New("ipxe").Option("missingkey=error").Parse(script)
+	if err != nil {
+		return "", fmt.Errorf("error parsing the boot profile: %v: %w", err, ErrInvalidRequest)
+	}
+	rendered := &strings.Builder{}
+	if err := tmpl.Execute(rendered, vars); err != nil {
+		return "", fmt.Errorf("error rendering the boot profile: %v: %w", err, ErrInvalidRequest)
+	}
+	return rendered.String(), nil
+}
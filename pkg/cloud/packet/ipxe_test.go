@@ -0,0 +1,137 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestIPXEScriptVariables(t *testing.T) {
+	g := NewWithT(t)
+	packetMachine := &infrastructurev1alpha3.PacketMachine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "worker-0", Labels: map[string]string{clusterv1.ClusterLabelName: "capi"}},
+		Spec:       infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86"},
+		Status:     infrastructurev1alpha3.PacketMachineStatus{Facility: "ewr1"},
+	}
+
+	g.Expect(IPXEScriptVariables(packetMachine)).To(Equal(map[string]string{
+		"namespace":   "default",
+		"name":        "worker-0",
+		"cluster":     "capi",
+		"facility":    "ewr1",
+		"machineType": "c3.small.x86",
+	}))
+}
+
+func TestRenderIPXEScript(t *testing.T) {
+	vars := map[string]string{"namespace": "default", "name": "worker-0", "cluster": "capi"}
+	tests := []struct {
+		name    string
+		profile infrastructurev1alpha3.PacketBootProfileSpec
+		want    string
+		wantErr string
+	}{
+		{
+			name: "kernel",
+			profile: infrastructurev1alpha3.PacketBootProfileSpec{
+				Kernel:  "http://boot.example.net/vmlinuz",
+				Initrds: []string{"http://boot.example.net/initrd.img", "http://boot.example.net/{{ .cluster }}.img"},
+				Args:    "console=ttyS1,115200n8 hostname={{ .name }}",
+			},
+			want: "#!ipxe\nkernel http://boot.example.net/vmlinuz console=ttyS1,115200n8 hostname=worker-0\n" +
+				"initrd http://boot.example.net/initrd.img\ninitrd http://boot.example.net/capi.img\nboot\n",
+		},
+		{
+			name:    "kernel without args",
+			profile: infrastructurev1alpha3.PacketBootProfileSpec{Kernel: "http://boot.example.net/vmlinuz"},
+			want:    "#!ipxe\nkernel http://boot.example.net/vmlinuz\nboot\n",
+		},
+		{
+			name:    "script",
+			profile: infrastructurev1alpha3.PacketBootProfileSpec{Script: "#!ipxe\nchain http://matchbox.example.net/ipxe?name={{ .namespace }}-{{ .name }}\n"},
+			want:    "#!ipxe\nchain http://matchbox.example.net/ipxe?name=default-worker-0\n",
+		},
+		{
+			name:    "script and kernel",
+			profile: infrastructurev1alpha3.PacketBootProfileSpec{Script: "#!ipxe\nboot\n", Kernel: "http://boot.example.net/vmlinuz"},
+			wantErr: "the boot profile sets both a script and a kernel",
+		},
+		{
+			name:    "empty",
+			wantErr: "the boot profile sets neither a script nor a kernel",
+		},
+		{
+			name:    "not an ipxe script",
+			profile: infrastructurev1alpha3.PacketBootProfileSpec{Script: "boot\n"},
+			wantErr: "the boot profile script does not start with #!ipxe",
+		},
+		{
+			name:    "unknown variable",
+			profile: infrastructurev1alpha3.PacketBootProfileSpec{Kernel: "http://boot.example.net/vmlinuz", Args: "token={{ .token }}"},
+			wantErr: "error rendering the boot profile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			script, err := RenderIPXEScript(tt.profile, vars)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(script).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestNewDeviceBootProfile(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	machineScope := newTestMachineScope(t,
+		infrastructurev1alpha3.PacketMachineSpec{OS: "custom_ipxe", MachineType: "c3.small.x86", BillingCycle: "hourly", IPXEBootProfile: "flatcar"},
+		infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "ewr1"},
+		"#!/bin/sh\n")
+
+	scriptURL := "http://ipxe.example.net/ipxe/default/worker-0/uid"
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, IPXEScriptURL: scriptURL})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo("POST", "/projects/project/devices")[0].Body["ipxe_script_url"]).To(Equal(scriptURL))
+
+	// the url of the script is not drift
+	recorded, err := ParseDeviceRequest(machineScope.PacketMachine.Annotations[infrastructurev1alpha3.DeviceRequestAnnotation])
+	g.Expect(err).NotTo(HaveOccurred())
+	drift, err := DeviceRequestDrift(recorded, ExpectedDeviceRequest(machineScope, recorded))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drift).To(BeEmpty())
+
+	// the operating system boots the script
+	machineScope.PacketMachine.Spec.OS = "ubuntu_20_04"
+	_, err = c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, IPXEScriptURL: scriptURL})
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+}
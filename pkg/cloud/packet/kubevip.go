@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+const (
+	// DefaultKubeVIPImage is the kube-vip image of the clusters that set none.
+	DefaultKubeVIPImage = "ghcr.io/kube-vip/kube-vip:v0.4.0"
+
+	kubeVIPBGPInterface = "lo"
+	kubeVIPARPInterface = "bond0"
+	kubeVIPKubeconfig   = "/etc/kubernetes/admin.conf"
+)
+
+// KubeVIPMode returns the mode kube-vip runs in for a cluster: the one it
+// sets, else BGP when the cluster enables BGP and ARP otherwise.
+func KubeVIPMode(spec infrastructurev1alpha3.PacketClusterSpec) infrastructurev1alpha3.KubeVIPMode {
+	if spec.KubeVIP != nil && spec.KubeVIP.Mode != "" {
+		return spec.KubeVIP.Mode
+	}
+	if spec.BGP != nil {
+		return infrastructurev1alpha3.KubeVIPModeBGP
+	}
+	return infrastructurev1alpha3.KubeVIPModeARP
+}
+
+// KubeVIPManifest renders the kube-vip static pod manifest of the control
+// plane devices of a cluster, announcing address on port. In BGP mode kube-vip
+// reads the BGP neighbors of the device from the Packet API with apiKey.
+func KubeVIPManifest(spec infrastructurev1alpha3.PacketClusterSpec, address string, port int32, apiKey string) (string, error) {
+	if spec.KubeVIP == nil {
+		return "", nil
+	}
+	mode := KubeVIPMode(spec)
+	image := spec.KubeVIP.Image
+	if image == "" {
+		image = DefaultKubeVIPImage
+	}
+	iface := spec.KubeVIP.Interface
+	if iface == "" {
+		iface = kubeVIPARPInterface
+		if mode == infrastructurev1alpha3.KubeVIPModeBGP {
+			iface = kubeVIPBGPInterface
+		}
+	}
+	if port == 0 {
+		port = 6443
+	}
+
+	env := []corev1.EnvVar{
+		{Name: "address", Value: address},
+		{Name: "port", Value: strconv.Itoa(int(port))},
+		{Name: "vip_interface", Value: iface},
+		{Name: "cp_enable", Value: "true"},
+	}
+	switch mode {
+	case infrastructurev1alpha3.KubeVIPModeBGP:
+		asn := DefaultBGPLocalASN
+		if spec.BGP != nil && spec.BGP.LocalASN != 0 {
+			asn = int(spec.BGP.LocalASN)
+		}
+		env = append(env,
+			corev1.EnvVar{Name: "bgp_enable", Value: "true"},
+			corev1.EnvVar{Name: "bgp_as", Value: strconv.Itoa(asn)},
+			corev1.EnvVar{Name: "vip_packet", Value: "true"},
+			corev1.EnvVar{Name: "vip_packetproject", Value: spec.ProjectID},
+			corev1.EnvVar{Name: "PACKET_AUTH_TOKEN", Value: apiKey},
+		)
+	case infrastructurev1alpha3.KubeVIPModeARP:
+		env = append(env,
+			corev1.EnvVar{Name: "vip_arp", Value: "true"},
+			corev1.EnvVar{Name: "vip_leaderelection", Value: "true"},
+		)
+	default:
+		return "", fmt.Errorf("unknown kube-vip mode %q: %w", mode, ErrInvalidRequest)
+	}
+
+	hostPathFile := corev1.HostPathFile
+	pod := corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "kube-vip",
+			Namespace: metav1.NamespaceSystem,
+		},
+		Spec: corev1.PodSpec{
+			HostNetwork: true,
+			Containers: []corev1.Container{{
+				Name:  "kube-vip",
+				Image: image,
+				Args:  []string{"manager"},
+				Env:   env,
+				SecurityContext: &corev1.SecurityContext{
+					Capabilities: &corev1.Capabilities{
+						Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"},
+					},
+				},
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      "kubeconfig",
+					MountPath: kubeVIPKubeconfig,
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "kubeconfig",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Path: kubeVIPKubeconfig,
+						Type: &hostPathFile,
+					},
+				},
+			}},
+		},
+	}
+	manifest, err := yaml.Marshal(pod)
+	if err != nil {
+		return "", fmt.Errorf("error rendering the kube-vip manifest: %v", err)
+	}
+	return string(manifest), nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestKubeVIPManifest(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      infrastructurev1alpha3.PacketClusterSpec
+		port      int32
+		wantImage string
+		wantEnv   []corev1.EnvVar
+	}{
+		{
+			name:      "BGP when the cluster enables it",
+			spec:      infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", BGP: &infrastructurev1alpha3.BGPConfig{LocalASN: 65100}, KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{}},
+			wantImage: DefaultKubeVIPImage,
+			wantEnv: []corev1.EnvVar{
+				{Name: "address", Value: "147.75.0.1"},
+				{Name: "port", Value: "6443"},
+				{Name: "vip_interface", Value: "lo"},
+				{Name: "cp_enable", Value: "true"},
+				{Name: "bgp_enable", Value: "true"},
+				{Name: "bgp_as", Value: "65100"},
+				{Name: "vip_packet", Value: "true"},
+				{Name: "vip_packetproject", Value: "project"},
+				{Name: "PACKET_AUTH_TOKEN", Value: "token"},
+			},
+		},
+		{
+			name:      "ARP otherwise",
+			spec:      infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{Image: "kube-vip:test", Interface: "bond0.1000"}},
+			port:      443,
+			wantImage: "kube-vip:test",
+			wantEnv: []corev1.EnvVar{
+				{Name: "address", Value: "147.75.0.1"},
+				{Name: "port", Value: "443"},
+				{Name: "vip_interface", Value: "bond0.1000"},
+				{Name: "cp_enable", Value: "true"},
+				{Name: "vip_arp", Value: "true"},
+				{Name: "vip_leaderelection", Value: "true"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			manifest, err := KubeVIPManifest(tt.spec, "147.75.0.1", tt.port, "token")
+			g.Expect(err).NotTo(HaveOccurred())
+
+			var pod corev1.Pod
+			g.Expect(yaml.Unmarshal([]byte(manifest), &pod)).To(Succeed())
+			g.Expect(pod.Kind).To(Equal("Pod"))
+			g.Expect(pod.Namespace).To(Equal("kube-system"))
+			g.Expect(pod.Spec.HostNetwork).To(BeTrue())
+			g.Expect(pod.Spec.Containers).To(HaveLen(1))
+			g.Expect(pod.Spec.Containers[0].Image).To(Equal(tt.wantImage))
+			g.Expect(pod.Spec.Containers[0].Env).To(Equal(tt.wantEnv))
+		})
+	}
+
+	g := NewWithT(t)
+	manifest, err := KubeVIPManifest(infrastructurev1alpha3.PacketClusterSpec{}, "147.75.0.1", 6443, "token")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(manifest).To(BeEmpty())
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/packethost/packngo"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// LabelSync mirrors labels of the machines into tags of their devices, and
+// tags of the devices into labels of their PacketMachines. Both directions
+// only touch the labels and tags under their prefix, rendered as key=value
+// tags, so that the labels and tags owned by anything else are kept.
+type LabelSync struct {
+	// LabelPrefix selects the labels of the Machines and PacketMachines
+	// synced into device tags. Empty disables it.
+	LabelPrefix string
+	// TagPrefix selects the device tags synced into PacketMachine labels.
+	// Empty disables it.
+	TagPrefix string
+}
+
+// Validate checks that the prefixes do not overlap, otherwise labels and tags
+// would be synced back and forth, and that they stay out of the namespace of
+// the managed tags.
+func (s LabelSync) Validate() error {
+	for _, prefix := range []string{s.LabelPrefix, s.TagPrefix} {
+		if prefix != "" && (ManagedTag(prefix) || strings.HasPrefix(infrastructurev1alpha3.ManagedTagPrefix, prefix)) {
+			return fmt.Errorf("the prefix %q overlaps the %s namespace of the managed tags", prefix, infrastructurev1alpha3.ManagedTagPrefix)
+		}
+	}
+	if s.LabelPrefix == "" || s.TagPrefix == "" {
+		return nil
+	}
+	if strings.HasPrefix(s.LabelPrefix, s.TagPrefix) || strings.HasPrefix(s.TagPrefix, s.LabelPrefix) {
+		return fmt.Errorf("the label prefix %q and the tag prefix %q overlap", s.LabelPrefix, s.TagPrefix)
+	}
+	return nil
+}
+
+// DeviceTags returns the tags of a device with the ones under the label
+// prefix replaced by the labels, and whether they changed. The labels are
+// appended sorted after the other tags.
+func (s LabelSync) DeviceTags(tags []string, labels map[string]string) ([]string, bool) {
+	if s.LabelPrefix == "" {
+		return tags, false
+	}
+
+	synced := []string{}
+	current := map[string]bool{}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, s.LabelPrefix) {
+			current[tag] = true
+			continue
+		}
+		synced = append(synced, tag)
+	}
+
+	labelTags := []string{}
+	for key, value := range labels {
+		if strings.HasPrefix(key, s.LabelPrefix) {
+			labelTags = append(labelTags, key+"="+value)
+		}
+	}
+	sort.Strings(labelTags)
+
+	changed := len(labelTags) != len(current)
+	for _, tag := range labelTags {
+		changed = changed || !current[tag]
+	}
+	return append(synced, labelTags...), changed
+}
+
+// MachineLabels returns the labels of a PacketMachine with the ones under the
+// tag prefix replaced by the tags of its device, and whether they changed.
+// Tags that do not make a valid label are returned as invalid.
+func (s LabelSync) MachineLabels(labels map[string]string, tags []string) (map[string]string, bool, []string) {
+	if s.TagPrefix == "" {
+		return labels, false, nil
+	}
+
+	synced := map[string]string{}
+	for key, value := range labels {
+		if !strings.HasPrefix(key, s.TagPrefix) {
+			synced[key] = value
+		}
+	}
+
+	invalid := []string{}
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, s.TagPrefix) {
+			continue
+		}
+		key, value := tag, ""
+		if i := strings.Index(tag, "="); i >= 0 {
+			key, value = tag[:i], tag[i+1:]
+		}
+		if len(validation.IsQualifiedName(key)) != 0 || len(validation.IsValidLabelValue(value)) != 0 {
+			invalid = append(invalid, tag)
+			continue
+		}
+		synced[key] = value
+	}
+
+	changed := false
+	for key, value := range synced {
+		if old, ok := labels[key]; !ok || old != value {
+			changed = true
+		}
+	}
+	for key := range labels {
+		if _, ok := synced[key]; !ok {
+			changed = true
+		}
+	}
+	return synced, changed, invalid
+}
+
+// NodeLabels returns the labels, under infrastructurev1alpha3.NodeLabelPrefix,
+// describing where and how a device runs for the scheduler of the workload
+// cluster. The facts Packet does not report, or that do not make a valid
+// label value, are left out.
+func NodeLabels(device *packngo.Device) map[string]string {
+	facts := map[string]string{
+		"hardware-reservation": DeviceReservationID(device),
+		"lifecycle":            "on-demand",
+	}
+	if device.SpotInstance {
+		facts["lifecycle"] = "spot"
+	}
+	if device.Plan != nil {
+		facts["plan"] = device.Plan.Slug
+	}
+	if device.Metro != nil {
+		facts["metro"] = device.Metro.Code
+	}
+	if device.Facility != nil {
+		facts["facility"] = device.Facility.Code
+	}
+
+	labels := map[string]string{}
+	for name, value := range facts {
+		if value != "" && len(validation.IsValidLabelValue(value)) == 0 {
+			labels[infrastructurev1alpha3.NodeLabelPrefix+name] = value
+		}
+	}
+	return labels
+}
+
+// FormatLabels renders labels as comma separated key=value pairs, sorted.
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+)
+
+func TestLabelSyncDeviceTags(t *testing.T) {
+	sync := LabelSync{LabelPrefix: "metal.plural.sh/"}
+
+	tests := []struct {
+		name        string
+		sync        LabelSync
+		tags        []string
+		labels      map[string]string
+		want        []string
+		wantChanged bool
+	}{
+		{
+			name:        "labels added",
+			sync:        sync,
+			tags:        []string{"cluster-api-provider-packet:cluster-id:capi", "owner=infra"},
+			labels:      map[string]string{"metal.plural.sh/rack": "r12", "metal.plural.sh/asset": "42", "app": "web"},
+			want:        []string{"cluster-api-provider-packet:cluster-id:capi", "owner=infra", "metal.plural.sh/asset=42", "metal.plural.sh/rack=r12"},
+			wantChanged: true,
+		},
+		{
+			name:   "in sync",
+			sync:   sync,
+			tags:   []string{"metal.plural.sh/rack=r12", "owner=infra"},
+			labels: map[string]string{"metal.plural.sh/rack": "r12"},
+			want:   []string{"owner=infra", "metal.plural.sh/rack=r12"},
+		},
+		{
+			name:        "label changed",
+			sync:        sync,
+			tags:        []string{"metal.plural.sh/rack=r12"},
+			labels:      map[string]string{"metal.plural.sh/rack": "r13"},
+			want:        []string{"metal.plural.sh/rack=r13"},
+			wantChanged: true,
+		},
+		{
+			name:        "label removed",
+			sync:        sync,
+			tags:        []string{"metal.plural.sh/rack=r12", "owner=infra"},
+			labels:      map[string]string{},
+			want:        []string{"owner=infra"},
+			wantChanged: true,
+		},
+		{
+			name:   "disabled",
+			tags:   []string{"owner=infra"},
+			labels: map[string]string{"metal.plural.sh/rack": "r12"},
+			want:   []string{"owner=infra"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			tags, changed := tt.sync.DeviceTags(tt.tags, tt.labels)
+			g.Expect(tags).To(Equal(tt.want))
+			g.Expect(changed).To(Equal(tt.wantChanged))
+		})
+	}
+}
+
+func TestLabelSyncMachineLabels(t *testing.T) {
+	sync := LabelSync{TagPrefix: "inventory.plural.sh/"}
+
+	tests := []struct {
+		name        string
+		sync        LabelSync
+		labels      map[string]string
+		tags        []string
+		want        map[string]string
+		wantChanged bool
+		wantInvalid []string
+	}{
+		{
+			name:        "tags added",
+			sync:        sync,
+			labels:      map[string]string{"app": "web"},
+			tags:        []string{"inventory.plural.sh/owner=team-a", "inventory.plural.sh/audited", "other=tag"},
+			want:        map[string]string{"app": "web", "inventory.plural.sh/owner": "team-a", "inventory.plural.sh/audited": ""},
+			wantChanged: true,
+		},
+		{
+			name:   "in sync",
+			sync:   sync,
+			labels: map[string]string{"app": "web", "inventory.plural.sh/owner": "team-a"},
+			tags:   []string{"inventory.plural.sh/owner=team-a"},
+			want:   map[string]string{"app": "web", "inventory.plural.sh/owner": "team-a"},
+		},
+		{
+			name:        "tag removed",
+			sync:        sync,
+			labels:      map[string]string{"app": "web", "inventory.plural.sh/owner": "team-a"},
+			want:        map[string]string{"app": "web"},
+			wantChanged: true,
+		},
+		{
+			name:        "invalid labels",
+			sync:        sync,
+			labels:      map[string]string{},
+			tags:        []string{"inventory.plural.sh/owner=team a", "inventory.plural.sh/bad key=x"},
+			want:        map[string]string{},
+			wantInvalid: []string{"inventory.plural.sh/owner=team a", "inventory.plural.sh/bad key=x"},
+		},
+		{
+			name:   "disabled",
+			labels: map[string]string{"app": "web"},
+			tags:   []string{"inventory.plural.sh/owner=team-a"},
+			want:   map[string]string{"app": "web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			labels, changed, invalid := tt.sync.MachineLabels(tt.labels, tt.tags)
+			g.Expect(labels).To(Equal(tt.want))
+			g.Expect(changed).To(Equal(tt.wantChanged))
+			if tt.wantInvalid == nil {
+				g.Expect(invalid).To(BeEmpty())
+			} else {
+				g.Expect(invalid).To(Equal(tt.wantInvalid))
+			}
+		})
+	}
+}
+
+func TestLabelSyncValidate(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(LabelSync{LabelPrefix: "metal.plural.sh/", TagPrefix: "inventory.plural.sh/"}.Validate()).To(Succeed())
+	g.Expect(LabelSync{LabelPrefix: "metal.plural.sh/"}.Validate()).To(Succeed())
+	g.Expect(LabelSync{LabelPrefix: "metal.plural.sh/", TagPrefix: "metal.plural.sh/inventory-"}.Validate()).NotTo(Succeed())
+	g.Expect(LabelSync{LabelPrefix: "metal.plural.sh/", TagPrefix: "metal.plural.sh/"}.Validate()).NotTo(Succeed())
+	g.Expect(LabelSync{TagPrefix: "cluster-api-provider-packet:role"}.Validate()).NotTo(Succeed())
+	g.Expect(LabelSync{LabelPrefix: "cluster-api"}.Validate()).NotTo(Succeed())
+}
+
+func TestUpdateDeviceTags(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodPut, "/devices/device", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "device"}})
+
+	g.Expect(c.UpdateDeviceTags("device", []string{"owner=infra"})).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodPut, "/devices/device")[0].Body).To(HaveKeyWithValue("tags", []interface{}{"owner=infra"}))
+}
+
+func TestNodeLabels(t *testing.T) {
+	g := NewWithT(t)
+
+	labels := NodeLabels(&packngo.Device{
+		Plan:                &packngo.Plan{Slug: "c3.small.x86"},
+		Metro:               &packngo.Metro{Code: "da"},
+		Facility:            &packngo.Facility{Code: "da11"},
+		HardwareReservation: packngo.Href{Href: "/hardware-reservations/reservation"},
+	})
+	g.Expect(labels).To(Equal(map[string]string{
+		"device.packet.infrastructure.cluster.x-k8s.io/plan":                 "c3.small.x86",
+		"device.packet.infrastructure.cluster.x-k8s.io/metro":                "da",
+		"device.packet.infrastructure.cluster.x-k8s.io/facility":             "da11",
+		"device.packet.infrastructure.cluster.x-k8s.io/hardware-reservation": "reservation",
+		"device.packet.infrastructure.cluster.x-k8s.io/lifecycle":            "on-demand",
+	}))
+	g.Expect(FormatLabels(labels)).To(HavePrefix("device.packet.infrastructure.cluster.x-k8s.io/facility=da11,"))
+
+	// the facts Packet does not report are left out
+	g.Expect(NodeLabels(&packngo.Device{SpotInstance: true})).To(Equal(map[string]string{
+		"device.packet.infrastructure.cluster.x-k8s.io/lifecycle": "spot",
+	}))
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// LedgerService deletes the resources recorded in the cleanup ledger of the
+// clusters.
+type LedgerService interface {
+	ReleaseCreatedResource(projectID string, resource infrastructurev1alpha3.CreatedResource) error
+}
+
+// createdResourceTeardownOrder ranks the kinds of the ledger in the order
+// their resources are deleted: metal gateways route through the ip
+// reservations of their VRF, which are deleted before the VRF.
+var createdResourceTeardownOrder = map[infrastructurev1alpha3.CreatedResourceKind]int{
+	infrastructurev1alpha3.CreatedResourceMetalGateway:    0,
+	infrastructurev1alpha3.CreatedResourceIPReservation:   1,
+	infrastructurev1alpha3.CreatedResourceVRF:             2,
+	infrastructurev1alpha3.CreatedResourceInterconnection: 3,
+}
+
+// RecordCreatedResource adds a resource to the cleanup ledger of a cluster,
+// unless it is recorded already. It returns whether it was added.
+func RecordCreatedResource(status *infrastructurev1alpha3.PacketClusterStatus, resource infrastructurev1alpha3.CreatedResource) bool {
+	if resource.ID == "" {
+		return false
+	}
+	for _, recorded := range status.CreatedResources {
+		if recorded.Kind == resource.Kind && recorded.ID == resource.ID {
+			return false
+		}
+	}
+	status.CreatedResources = append(status.CreatedResources, resource)
+	return true
+}
+
+// ForgetCreatedResource removes a deleted resource from the cleanup ledger of
+// a cluster.
+func ForgetCreatedResource(status *infrastructurev1alpha3.PacketClusterStatus, kind infrastructurev1alpha3.CreatedResourceKind, id string) {
+	kept := status.CreatedResources[:0]
+	for _, recorded := range status.CreatedResources {
+		if recorded.Kind != kind || recorded.ID != id {
+			kept = append(kept, recorded)
+		}
+	}
+	status.CreatedResources = nil
+	if len(kept) > 0 {
+		status.CreatedResources = kept
+	}
+}
+
+// CreatedResourcesTeardown returns the resources of a cleanup ledger in the
+// order they are deleted, the ones of a kind in the order they were created.
+func CreatedResourcesTeardown(resources []infrastructurev1alpha3.CreatedResource) []infrastructurev1alpha3.CreatedResource {
+	ordered := append([]infrastructurev1alpha3.CreatedResource{}, resources...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return createdResourceTeardownOrder[ordered[i].Kind] < createdResourceTeardownOrder[ordered[j].Kind]
+	})
+	return ordered
+}
+
+// ReleaseCreatedResource deletes a resource of the cleanup ledger of a
+// cluster in projectID. Resources already gone are not an error. Parked ip
+// reservations are kept, they outlive their cluster.
+func (p *PacketClient) ReleaseCreatedResource(projectID string, resource infrastructurev1alpha3.CreatedResource) error {
+	switch resource.Kind {
+	case infrastructurev1alpha3.CreatedResourceIPReservation:
+		reservation, _, err := p.ProjectIPs.Get(resource.ID, nil)
+		if err = packeterrors.Wrap(err); err != nil {
+			if packeterrors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to get ip reservation %s: %w", resource.ID, err)
+		}
+		if ItemsInList(reservation.Tags, []string{ParkedIPTag}) {
+			return nil
+		}
+		if err := p.ReleaseIP(resource.ID); err != nil {
+			return fmt.Errorf("failed to release ip reservation %s: %w", resource.ID, err)
+		}
+		return nil
+	case infrastructurev1alpha3.CreatedResourceMetalGateway:
+		if err := p.deleteIfFound(path.Join("/metal-gateways", resource.ID)); err != nil {
+			return fmt.Errorf("failed to delete metal gateway %s: %w", resource.ID, err)
+		}
+		return nil
+	case infrastructurev1alpha3.CreatedResourceVRF:
+		return p.DeleteVRF(projectID, resource.ID)
+	case infrastructurev1alpha3.CreatedResourceInterconnection:
+		return p.DeleteInterconnection(resource.ID)
+	}
+	return fmt.Errorf("unknown kind %q of created resource %s: %w", resource.Kind, resource.ID, ErrInvalidRequest)
+}
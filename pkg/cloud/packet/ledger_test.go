@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestRecordCreatedResource(t *testing.T) {
+	g := NewWithT(t)
+	status := &infrastructurev1alpha3.PacketClusterStatus{}
+	eip := infrastructurev1alpha3.CreatedResource{Kind: infrastructurev1alpha3.CreatedResourceIPReservation, ID: "eip", FailureDomain: "ny"}
+	vrf := infrastructurev1alpha3.CreatedResource{Kind: infrastructurev1alpha3.CreatedResourceVRF, ID: "vrf", FailureDomain: "ny"}
+
+	g.Expect(RecordCreatedResource(status, eip)).To(BeTrue())
+	g.Expect(RecordCreatedResource(status, vrf)).To(BeTrue())
+	g.Expect(RecordCreatedResource(status, eip)).To(BeFalse())
+	g.Expect(RecordCreatedResource(status, infrastructurev1alpha3.CreatedResource{Kind: infrastructurev1alpha3.CreatedResourceVRF})).To(BeFalse())
+	g.Expect(status.CreatedResources).To(Equal([]infrastructurev1alpha3.CreatedResource{eip, vrf}))
+
+	ForgetCreatedResource(status, infrastructurev1alpha3.CreatedResourceVRF, "eip")
+	g.Expect(status.CreatedResources).To(Equal([]infrastructurev1alpha3.CreatedResource{eip, vrf}))
+	ForgetCreatedResource(status, infrastructurev1alpha3.CreatedResourceIPReservation, "eip")
+	g.Expect(status.CreatedResources).To(Equal([]infrastructurev1alpha3.CreatedResource{vrf}))
+	ForgetCreatedResource(status, infrastructurev1alpha3.CreatedResourceVRF, "vrf")
+	g.Expect(status.CreatedResources).To(BeNil())
+}
+
+func TestCreatedResourcesTeardown(t *testing.T) {
+	g := NewWithT(t)
+	resource := func(kind infrastructurev1alpha3.CreatedResourceKind, id string) infrastructurev1alpha3.CreatedResource {
+		return infrastructurev1alpha3.CreatedResource{Kind: kind, ID: id}
+	}
+	resources := []infrastructurev1alpha3.CreatedResource{
+		resource(infrastructurev1alpha3.CreatedResourceIPReservation, "eip"),
+		resource(infrastructurev1alpha3.CreatedResourceInterconnection, "connection"),
+		resource(infrastructurev1alpha3.CreatedResourceVRF, "vrf"),
+		resource(infrastructurev1alpha3.CreatedResourceIPReservation, "network"),
+		resource(infrastructurev1alpha3.CreatedResourceMetalGateway, "gateway"),
+	}
+
+	g.Expect(CreatedResourcesTeardown(resources)).To(Equal([]infrastructurev1alpha3.CreatedResource{
+		resource(infrastructurev1alpha3.CreatedResourceMetalGateway, "gateway"),
+		resource(infrastructurev1alpha3.CreatedResourceIPReservation, "eip"),
+		resource(infrastructurev1alpha3.CreatedResourceIPReservation, "network"),
+		resource(infrastructurev1alpha3.CreatedResourceVRF, "vrf"),
+		resource(infrastructurev1alpha3.CreatedResourceInterconnection, "connection"),
+	}))
+	// the ledger itself is left in creation order
+	g.Expect(resources[0].ID).To(Equal("eip"))
+}
+
+func TestReleaseCreatedResource(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/ips/eip", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "eip", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi"}}})
+	api.on(http.MethodDelete, "/ips/eip", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodGet, "/ips/parked", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "parked", "tags": []string{ParkedIPTag}}})
+	api.on(http.MethodDelete, "/metal-gateways/gateway", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodDelete, "/connections/connection", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodDelete, "/connections/failing", fakeResponse{status: http.StatusUnprocessableEntity, body: apiError("has active virtual circuits")})
+
+	release := func(kind infrastructurev1alpha3.CreatedResourceKind, id string) error {
+		return c.ReleaseCreatedResource("project", infrastructurev1alpha3.CreatedResource{Kind: kind, ID: id})
+	}
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceIPReservation, "eip")).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodDelete, "/ips/eip")).To(HaveLen(1))
+
+	// parked reservations outlive their cluster
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceIPReservation, "parked")).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodDelete, "/ips/parked")).To(BeEmpty())
+
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceMetalGateway, "gateway")).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodDelete, "/metal-gateways/gateway")).To(HaveLen(1))
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceInterconnection, "connection")).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodDelete, "/connections/connection")).To(HaveLen(1))
+
+	// resources already gone are not an error
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceIPReservation, "gone")).To(Succeed())
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceMetalGateway, "gone")).To(Succeed())
+	api.on(http.MethodGet, "/projects/project/metal-gateways", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"metal_gateways": []interface{}{}}})
+	api.on(http.MethodGet, "/vrfs/gone/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []interface{}{}}})
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceVRF, "gone")).To(Succeed())
+
+	g.Expect(release(infrastructurev1alpha3.CreatedResourceInterconnection, "failing")).To(MatchError(ContainSubstring("has active virtual circuits")))
+	g.Expect(release("Device", "device")).To(MatchError(ContainSubstring(`unknown kind "Device"`)))
+}
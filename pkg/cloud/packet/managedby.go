@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// DeviceManager returns the UID of the PacketCluster whose cluster UID tag a
+// device carries, empty when it carries none.
+func DeviceManager(device *packngo.Device) string {
+	for _, tag := range device.Tags {
+		if strings.HasPrefix(tag, ClusterUIDTag+":") {
+			return strings.TrimPrefix(tag, ClusterUIDTag+":")
+		}
+	}
+	return ""
+}
+
+// DeviceOwnership returns why the controller may not change a device for the
+// PacketCluster with UID clusterUID, empty when it may. clusterUID is the one
+// returned by ClusterUID, which a moved cluster keeps. Only strict ownership
+// leaves devices alone: the ones tagged for another cluster, and the ones
+// carrying no cluster UID tag, such as those provisioned manually or by a
+// previous version of the provider, are then only changed when adopt is set.
+func DeviceOwnership(device *packngo.Device, clusterUID string, adopt, strict bool) string {
+	switch manager := DeviceManager(device); {
+	case manager == clusterUID, adopt, !strict:
+		return ""
+	case manager != "":
+		return fmt.Sprintf("device %s is managed for the cluster with uid %s, set the %s annotation to let the controller manage it",
+			device.ID, manager, infrastructurev1alpha3.AdoptDeviceAnnotation)
+	}
+	return fmt.Sprintf("device %s does not carry the uid tag of the cluster, set the %s annotation to let the controller manage it",
+		device.ID, infrastructurev1alpha3.AdoptDeviceAnnotation)
+}
+
+// ManagedDeviceTags returns the tags of a device managed for the PacketCluster
+// with UID clusterUID: the cluster UID tag of another cluster is replaced.
+func ManagedDeviceTags(tags []string, clusterUID string) []string {
+	return append(withoutClusterUIDTags(tags), GenerateClusterUIDTag(clusterUID))
+}
+
+func withoutClusterUIDTags(tags []string) []string {
+	kept := []string{}
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, ClusterUIDTag+":") {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+)
+
+func TestDeviceOwnership(t *testing.T) {
+	g := NewWithT(t)
+	managed := &packngo.Device{ID: "managed", Tags: []string{"custom", GenerateClusterUIDTag("cluster-uid")}}
+	other := &packngo.Device{ID: "other", Tags: []string{GenerateClusterUIDTag("other-uid")}}
+	untagged := &packngo.Device{ID: "untagged", Tags: []string{GenerateMachineTag("machine-uid")}}
+
+	g.Expect(DeviceManager(managed)).To(Equal("cluster-uid"))
+	g.Expect(DeviceManager(untagged)).To(BeEmpty())
+
+	g.Expect(DeviceOwnership(managed, "cluster-uid", false, true)).To(BeEmpty())
+	g.Expect(DeviceOwnership(untagged, "cluster-uid", false, false)).To(BeEmpty())
+	g.Expect(DeviceOwnership(other, "cluster-uid", false, false)).To(BeEmpty())
+
+	// strict ownership waits for the adopt-device annotation
+	g.Expect(DeviceOwnership(untagged, "cluster-uid", false, true)).To(ContainSubstring("set the packetmachine.infrastructure.cluster.x-k8s.io/adopt-device annotation"))
+	g.Expect(DeviceOwnership(other, "cluster-uid", false, true)).To(ContainSubstring("managed for the cluster with uid other-uid"))
+	g.Expect(DeviceOwnership(untagged, "cluster-uid", true, true)).To(BeEmpty())
+	g.Expect(DeviceOwnership(other, "cluster-uid", true, true)).To(BeEmpty())
+}
+
+func TestManagedDeviceTags(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ManagedDeviceTags([]string{"custom"}, "uid")).To(Equal([]string{"custom", GenerateClusterUIDTag("uid")}))
+	g.Expect(ManagedDeviceTags([]string{GenerateClusterUIDTag("other"), "custom"}, "uid")).To(Equal([]string{"custom", GenerateClusterUIDTag("uid")}))
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// MetroMigration moves a cluster that only sets a facility to the metro of
+// that facility.
+type MetroMigration struct {
+	// Metro is the metro of the cluster facility, set as the cluster metro.
+	Metro string
+	// ClearFacility is true when the cluster facility can be unset, for the
+	// devices that do not set one to be placed anywhere in the metro. A
+	// control plane ip reserved in the facility keeps the cluster in it.
+	ClearFacility bool
+	// RecreateDevices are the hostnames, sorted, of the devices of the
+	// cluster outside of the metro. A device can not move, they have to be
+	// recreated for the cluster to be in the metro only.
+	RecreateDevices []string
+}
+
+// PlanMetroMigration returns the migration of a cluster to the metro of its
+// facility, given the metro of every facility and the devices of the
+// cluster. It returns false when the cluster does not only set a facility,
+// and an ErrInvalidRequest when the facility is not part of a metro.
+func PlanMetroMigration(spec infrastructurev1alpha3.PacketClusterSpec, facilityMetros map[string]string, devices []packngo.Device) (MetroMigration, bool, error) {
+	if spec.Facility == "" || spec.Metro != "" {
+		return MetroMigration{}, false, nil
+	}
+
+	metro, ok := facilityMetros[spec.Facility]
+	if !ok {
+		return MetroMigration{}, false, fmt.Errorf("facility %s is not part of a metro: %w", spec.Facility, ErrInvalidRequest)
+	}
+
+	ipScope, _ := IPReservationLocation(spec)
+	migration := MetroMigration{
+		Metro:           metro,
+		ClearFacility:   ipScope != infrastructurev1alpha3.IPReservationScopeFacility,
+		RecreateDevices: []string{},
+	}
+	for _, device := range devices {
+		if device.Facility == nil || strings.EqualFold(facilityMetros[device.Facility.Code], metro) {
+			continue
+		}
+		migration.RecreateDevices = append(migration.RecreateDevices, device.Hostname)
+	}
+	sort.Strings(migration.RecreateDevices)
+	return migration, true, nil
+}
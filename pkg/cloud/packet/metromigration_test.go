@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestPlanMetroMigration(t *testing.T) {
+	metros := map[string]string{"ewr1": "ny", "ny5": "ny", "sjc1": "sv"}
+	device := func(hostname, facility string) packngo.Device {
+		return packngo.Device{Hostname: hostname, Facility: &packngo.Facility{Code: facility}}
+	}
+	devices := []packngo.Device{
+		device("worker-b", "sjc1"),
+		device("control-plane", "ewr1"),
+		device("worker-a", "ny5"),
+		device("worker-c", "sjc1"),
+		{Hostname: "unknown"},
+	}
+
+	tests := []struct {
+		name        string
+		spec        infrastructurev1alpha3.PacketClusterSpec
+		want        MetroMigration
+		wantMigrate bool
+		wantErr     bool
+	}{
+		{
+			name:        "facility ip",
+			spec:        infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1"},
+			want:        MetroMigration{Metro: "ny", RecreateDevices: []string{"worker-b", "worker-c"}},
+			wantMigrate: true,
+		},
+		{
+			name: "global ip",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				Facility:           "ewr1",
+				IPReservationScope: infrastructurev1alpha3.IPReservationScopeGlobal,
+			},
+			want:        MetroMigration{Metro: "ny", ClearFacility: true, RecreateDevices: []string{"worker-b", "worker-c"}},
+			wantMigrate: true,
+		},
+		{
+			name: "metro already set",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1", Metro: "ny"},
+		},
+		{
+			name: "no facility",
+			spec: infrastructurev1alpha3.PacketClusterSpec{},
+		},
+		{
+			name:    "facility outside of any metro",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{Facility: "ams1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			migration, migrate, err := PlanMetroMigration(tt.spec, metros, devices)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue(), "unexpected error %v", err)
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(migrate).To(Equal(tt.wantMigrate))
+			g.Expect(migration).To(Equal(tt.want))
+		})
+	}
+}
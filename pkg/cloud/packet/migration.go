@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// TagMigration rewrites a tag written by a previous version of the provider
+// into the current tag scheme. It returns false when the tag is not a legacy
+// one it knows about.
+type TagMigration func(namespace, clusterName, tag string) (string, bool)
+
+// TagMigrations are applied, in order, to every tag of the devices and ip
+// reservations belonging to a cluster.
+var TagMigrations = []TagMigration{
+	migrateLegacyMachineUIDTag,
+	migrateLegacyRoleTag,
+}
+
+// IPTagMigrations are applied, after TagMigrations, to the tags of the ip
+// reservations only: the legacy ip identifier is also the cluster tag of the
+// devices.
+var IPTagMigrations = []TagMigration{
+	migrateLegacyElasticIPTag,
+}
+
+// migrateLegacyMachineUIDTag rewrites the v1alpha1 "cluster.k8s.io/machine-uid:<uid>"
+// tag into the current machine-uid tag.
+func migrateLegacyMachineUIDTag(_, _, tag string) (string, bool) {
+	prefix := AnnotationUID + ":"
+	if !strings.HasPrefix(tag, prefix) {
+		return tag, false
+	}
+	return GenerateMachineTag(strings.TrimPrefix(tag, prefix)), true
+}
+
+// migrateLegacyRoleTag moves the role tags of the devices into the namespace
+// of the managed tags.
+func migrateLegacyRoleTag(_, _, tag string) (string, bool) {
+	switch tag {
+	case infrastructurev1alpha3.LegacyControlPlaneTag:
+		return infrastructurev1alpha3.ControlPlaneTag, true
+	case infrastructurev1alpha3.LegacyWorkerTag:
+		return infrastructurev1alpha3.WorkerTag, true
+	}
+	return tag, false
+}
+
+// migrateLegacyElasticIPTag rewrites the ip identifiers holding only the
+// cluster name into the namespaced ones.
+func migrateLegacyElasticIPTag(namespace, clusterName, tag string) (string, bool) {
+	legacy := generateLegacyElasticIPIdentifier(clusterName)
+	switch {
+	case tag == legacy:
+		return generateElasticIPIdentifier(namespace, clusterName), true
+	case strings.HasPrefix(tag, legacy+":facility:"):
+		facility := strings.TrimPrefix(tag, legacy+":facility:")
+		return generateFacilityElasticIPIdentifier(namespace, clusterName, facility), true
+	}
+	return tag, false
+}
+
+// MigrateTags returns the tags rewritten to the current scheme, and whether
+// anything changed. Duplicates produced by the rewrite are dropped.
+func MigrateTags(namespace, clusterName string, tags []string) ([]string, bool) {
+	return migrateTags(TagMigrations, namespace, clusterName, tags)
+}
+
+// MigrateIPTags is MigrateTags for the tags of an ip reservation.
+func MigrateIPTags(namespace, clusterName string, tags []string) ([]string, bool) {
+	migrations := append(append([]TagMigration{}, TagMigrations...), IPTagMigrations...)
+	return migrateTags(migrations, namespace, clusterName, tags)
+}
+
+func migrateTags(migrations []TagMigration, namespace, clusterName string, tags []string) ([]string, bool) {
+	changed := false
+	seen := map[string]bool{}
+	migrated := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		for _, migrate := range migrations {
+			if t, ok := migrate(namespace, clusterName, tag); ok {
+				tag = t
+				changed = true
+			}
+		}
+		if seen[tag] {
+			changed = true
+			continue
+		}
+		seen[tag] = true
+		migrated = append(migrated, tag)
+	}
+	return migrated, changed
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestMigrateTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+		changed  bool
+	}{
+		{
+			name:     "current tags are left untouched",
+			tags:     []string{GenerateClusterTag("capi"), GenerateMachineTag("uid")},
+			expected: []string{GenerateClusterTag("capi"), GenerateMachineTag("uid")},
+			changed:  false,
+		},
+		{
+			name:     "legacy machine uid tag is rewritten",
+			tags:     []string{GenerateClusterTag("capi"), AnnotationUID + ":uid"},
+			expected: []string{GenerateClusterTag("capi"), GenerateMachineTag("uid")},
+			changed:  true,
+		},
+		{
+			name:     "legacy role tags are moved to the managed namespace",
+			tags:     []string{"team:platform", infrastructurev1alpha3.LegacyControlPlaneTag, GenerateClusterTag("capi")},
+			expected: []string{"team:platform", infrastructurev1alpha3.ControlPlaneTag, GenerateClusterTag("capi")},
+			changed:  true,
+		},
+		{
+			name:     "duplicates produced by the rewrite are dropped",
+			tags:     []string{GenerateMachineTag("uid"), AnnotationUID + ":uid"},
+			expected: []string{GenerateMachineTag("uid")},
+			changed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			tags, changed := MigrateTags("default", "capi", tt.tags)
+			g.Expect(changed).To(Equal(tt.changed))
+			g.Expect(tags).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestMigrateIPTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+		changed  bool
+	}{
+		{
+			name:     "current identifier is left untouched",
+			tags:     []string{generateElasticIPIdentifier("default", "capi")},
+			expected: []string{generateElasticIPIdentifier("default", "capi")},
+			changed:  false,
+		},
+		{
+			name:     "legacy identifier is namespaced",
+			tags:     []string{generateLegacyElasticIPIdentifier("capi")},
+			expected: []string{generateElasticIPIdentifier("default", "capi")},
+			changed:  true,
+		},
+		{
+			name:     "legacy facility identifier is namespaced",
+			tags:     []string{generateLegacyFacilityElasticIPIdentifier("capi", "ewr1")},
+			expected: []string{generateFacilityElasticIPIdentifier("default", "capi", "ewr1")},
+			changed:  true,
+		},
+		{
+			name:     "identifiers of other clusters are left untouched",
+			tags:     []string{generateLegacyElasticIPIdentifier("capi-2")},
+			expected: []string{generateLegacyElasticIPIdentifier("capi-2")},
+			changed:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			tags, changed := MigrateIPTags("default", "capi", tt.tags)
+			g.Expect(changed).To(Equal(tt.changed))
+			g.Expect(tags).To(Equal(tt.expected))
+		})
+	}
+}
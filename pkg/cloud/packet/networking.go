@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"net"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// ValidateClusterNetworking checks the networking fields of a cluster: the
+// ip reservation scope and endpoint strategy, the host firewall, the
+// interconnections and VRFs, and the dependencies between them. It is what
+// the PacketCluster admission webhook enforces. It returns an
+// ErrInvalidRequest for the first invalid field.
+func ValidateClusterNetworking(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	for _, validate := range []func() error{
+		func() error { return ValidateIPReservationScope(spec) },
+		func() error { return ValidateNetworkPolicy(spec.NetworkPolicy) },
+		func() error { return ValidateInterconnections(spec) },
+		func() error { return ValidateVRFs(spec) },
+		func() error { return ValidateNetworkingDependencies(spec) },
+	} {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateNetworkingDependencies checks the networking fields of a cluster
+// depending on, or excluding, one another. The fields are checked on their
+// own where they are reconciled. It returns an ErrInvalidRequest otherwise.
+func ValidateNetworkingDependencies(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	if spec.KubeVIP != nil && KubeVIPMode(spec) == infrastructurev1alpha3.KubeVIPModeBGP && (spec.BGP == nil || !spec.BGP.ControlPlaneSessions) {
+		return fmt.Errorf("kubeVIP: BGP mode requires bgp.controlPlaneSessions, kube-vip peers over the BGP sessions of the control plane devices: %w", ErrInvalidRequest)
+	}
+	if bgp := spec.BGP; bgp != nil && bgp.DeploymentType == infrastructurev1alpha3.BGPDeploymentTypeGlobal {
+		asn := bgp.LocalASN
+		if asn == 0 {
+			asn = DefaultBGPLocalASN
+		}
+		if privateASN(asn) {
+			return fmt.Errorf("bgp: the global deployment type requires a public localASN, %d is private: %w", asn, ErrInvalidRequest)
+		}
+	}
+
+	// a VLAN is routed by a single metal gateway
+	gateways := map[string]string{}
+	for _, vrf := range spec.VRFs {
+		networks := make([]*net.IPNet, 0, len(vrf.MetalGateways))
+		for _, gateway := range vrf.MetalGateways {
+			key := fmt.Sprintf("%s/%d", VRFMetro(spec, vrf), gateway.VLAN)
+			if other, ok := gateways[key]; ok && other != vrf.Name {
+				return fmt.Errorf("vrfs: VLAN %d has metal gateways of both %s and %s: %w", gateway.VLAN, other, vrf.Name, ErrInvalidRequest)
+			}
+			gateways[key] = vrf.Name
+
+			_, network, err := net.ParseCIDR(gateway.Network)
+			if err != nil {
+				continue
+			}
+			for _, other := range networks {
+				if other.Contains(network.IP) || network.Contains(other.IP) {
+					return fmt.Errorf("vrfs: networks %s and %s of the metal gateways of %s overlap: %w", other, network, vrf.Name, ErrInvalidRequest)
+				}
+			}
+			networks = append(networks, network)
+		}
+	}
+	return nil
+}
+
+// ValidateMachineNetworking checks the networking fields of a machine, and
+// without a nil cluster, that they depend on fields it declares. It returns
+// an ErrInvalidRequest otherwise.
+func ValidateMachineNetworking(machine infrastructurev1alpha3.PacketMachineSpec, cluster *infrastructurev1alpha3.PacketClusterSpec) error {
+	names := map[string]bool{}
+	for _, name := range machine.VRFs {
+		if names[name] {
+			return fmt.Errorf("vrfs: %s is listed twice: %w", name, ErrInvalidRequest)
+		}
+		names[name] = true
+	}
+	if cluster == nil {
+		return nil
+	}
+
+	declared := map[string]infrastructurev1alpha3.VRF{}
+	for _, vrf := range cluster.VRFs {
+		declared[vrf.Name] = vrf
+	}
+	for _, name := range machine.VRFs {
+		vrf, ok := declared[name]
+		if !ok {
+			return fmt.Errorf("vrfs: the cluster has no VRF %s: %w", name, ErrInvalidRequest)
+		}
+		if len(vrf.MetalGateways) == 0 {
+			return fmt.Errorf("vrfs: VRF %s has no metal gateway, the device would be attached to no VLAN: %w", name, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// privateASN reports whether asn is reserved for private use.
+func privateASN(asn int64) bool {
+	return (asn >= 64512 && asn <= 65534) || (asn >= 4200000000 && asn <= 4294967294)
+}
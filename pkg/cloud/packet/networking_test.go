@@ -0,0 +1,239 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestValidateNetworkingDependencies(t *testing.T) {
+	vrf := func(name, metro string, gateways ...infrastructurev1alpha3.VRFMetalGateway) infrastructurev1alpha3.VRF {
+		return infrastructurev1alpha3.VRF{Name: name, Metro: metro, LocalASN: 65000, IPRanges: []string{"10.10.0.0/16"}, MetalGateways: gateways}
+	}
+	gateway := func(vlan int32, network string) infrastructurev1alpha3.VRFMetalGateway {
+		return infrastructurev1alpha3.VRFMetalGateway{VLAN: vlan, Network: network}
+	}
+	sessions := &infrastructurev1alpha3.BGPConfig{ControlPlaneSessions: true}
+
+	tests := []struct {
+		name    string
+		spec    infrastructurev1alpha3.PacketClusterSpec
+		wantErr string
+	}{
+		{name: "none"},
+		{
+			name: "kube-vip ARP",
+			spec: infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{}},
+		},
+		{
+			name: "kube-vip BGP with control plane sessions",
+			spec: infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{}, BGP: sessions},
+		},
+		{
+			name:    "kube-vip BGP without BGP",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeBGP}},
+			wantErr: "kubeVIP: BGP mode requires bgp.controlPlaneSessions",
+		},
+		{
+			name:    "kube-vip BGP by default without control plane sessions",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{}, BGP: &infrastructurev1alpha3.BGPConfig{}},
+			wantErr: "kubeVIP: BGP mode requires bgp.controlPlaneSessions",
+		},
+		{
+			name: "kube-vip ARP with BGP",
+			spec: infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeARP}, BGP: &infrastructurev1alpha3.BGPConfig{}},
+		},
+		{
+			name: "BGP without kube-vip",
+			spec: infrastructurev1alpha3.PacketClusterSpec{BGP: &infrastructurev1alpha3.BGPConfig{}},
+		},
+		{
+			name: "global BGP with a public ASN",
+			spec: infrastructurev1alpha3.PacketClusterSpec{BGP: &infrastructurev1alpha3.BGPConfig{DeploymentType: infrastructurev1alpha3.BGPDeploymentTypeGlobal, LocalASN: 64496}},
+		},
+		{
+			name:    "global BGP with the default ASN",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{BGP: &infrastructurev1alpha3.BGPConfig{DeploymentType: infrastructurev1alpha3.BGPDeploymentTypeGlobal}},
+			wantErr: "65000 is private",
+		},
+		{
+			name:    "global BGP with a private 4-byte ASN",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{BGP: &infrastructurev1alpha3.BGPConfig{DeploymentType: infrastructurev1alpha3.BGPDeploymentTypeGlobal, LocalASN: 4200000001}},
+			wantErr: "4200000001 is private",
+		},
+		{
+			name: "local BGP with a private ASN",
+			spec: infrastructurev1alpha3.PacketClusterSpec{BGP: &infrastructurev1alpha3.BGPConfig{DeploymentType: infrastructurev1alpha3.BGPDeploymentTypeLocal, LocalASN: 64512}},
+		},
+		{
+			name: "metal gateways of distinct VLANs",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+				vrf("a", "", gateway(1000, "10.10.1.0/24")),
+				vrf("b", "", gateway(1001, "10.10.1.0/24")),
+			}},
+		},
+		{
+			name: "VLAN served by two VRFs",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+				vrf("a", "", gateway(1000, "10.10.1.0/24")),
+				vrf("b", "da", gateway(1000, "10.10.2.0/24")),
+			}},
+			wantErr: "VLAN 1000 has metal gateways of both a and b",
+		},
+		{
+			name: "same VLAN id in two metros",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+				vrf("a", "", gateway(1000, "10.10.1.0/24")),
+				vrf("b", "sv", gateway(1000, "10.10.2.0/24")),
+			}},
+		},
+		{
+			name: "overlapping networks",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+				vrf("a", "", gateway(1000, "10.10.0.0/22"), gateway(1001, "10.10.2.0/24")),
+			}},
+			wantErr: "networks 10.10.0.0/22 and 10.10.2.0/24 of the metal gateways of a overlap",
+		},
+		{
+			name: "overlapping networks, larger second",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+				vrf("a", "", gateway(1000, "10.10.2.0/24"), gateway(1001, "10.10.0.0/22")),
+			}},
+			wantErr: "overlap",
+		},
+		{
+			name: "adjacent networks",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+				vrf("a", "", gateway(1000, "10.10.0.0/24"), gateway(1001, "10.10.1.0/24")),
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateNetworkingDependencies(tt.spec)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestValidateClusterNetworking(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    infrastructurev1alpha3.PacketClusterSpec
+		wantErr string
+	}{
+		{name: "none"},
+		{
+			name: "all of them",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				Metro:            "da",
+				BGP:              &infrastructurev1alpha3.BGPConfig{ControlPlaneSessions: true},
+				KubeVIP:          &infrastructurev1alpha3.KubeVIPConfig{},
+				NetworkPolicy:    &infrastructurev1alpha3.NetworkPolicy{APIServerAllowedCIDRs: []string{"192.0.2.0/24"}},
+				Interconnections: []infrastructurev1alpha3.Interconnection{{Name: "aws", VLAN: 1000}},
+				VRFs: []infrastructurev1alpha3.VRF{{
+					Name: "private", LocalASN: 65000, IPRanges: []string{"10.10.0.0/16"},
+					MetalGateways: []infrastructurev1alpha3.VRFMetalGateway{{VLAN: 1000, Network: "10.10.1.0/24"}},
+				}},
+			},
+		},
+		{
+			name:    "ip reservation scope",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{ControlPlaneEndpointStrategy: infrastructurev1alpha3.ControlPlaneEndpointStrategyGlobalIP},
+			wantErr: "endpoint strategy requires",
+		},
+		{
+			name:    "network policy",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{NetworkPolicy: &infrastructurev1alpha3.NetworkPolicy{AllowedPorts: []int32{0}}},
+			wantErr: "networkPolicy.allowedPorts",
+		},
+		{
+			name:    "interconnections",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{Interconnections: []infrastructurev1alpha3.Interconnection{{Name: "aws", VLAN: 1000}}},
+			wantErr: "interconnections: aws needs a metro",
+		},
+		{
+			name:    "vrfs",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{VRFs: []infrastructurev1alpha3.VRF{{Name: "private", LocalASN: 65000, IPRanges: []string{"10.10.0.0/16"}}}},
+			wantErr: "vrfs: private needs a metro",
+		},
+		{
+			name:    "dependencies",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeBGP}},
+			wantErr: "kubeVIP: BGP mode requires",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateClusterNetworking(tt.spec)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestValidateMachineNetworking(t *testing.T) {
+	cluster := &infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{
+		{Name: "private", LocalASN: 65000, IPRanges: []string{"10.10.0.0/16"}, MetalGateways: []infrastructurev1alpha3.VRFMetalGateway{{VLAN: 1000, Network: "10.10.1.0/24"}}},
+		{Name: "unbound", LocalASN: 65000, IPRanges: []string{"10.20.0.0/16"}},
+	}}
+
+	tests := []struct {
+		name    string
+		vrfs    []string
+		cluster *infrastructurev1alpha3.PacketClusterSpec
+		wantErr string
+	}{
+		{name: "none", cluster: cluster},
+		{name: "declared", vrfs: []string{"private"}, cluster: cluster},
+		{name: "listed twice", vrfs: []string{"private", "private"}, wantErr: "vrfs: private is listed twice"},
+		{name: "without the cluster", vrfs: []string{"missing"}},
+		{name: "not declared", vrfs: []string{"missing"}, cluster: cluster, wantErr: "the cluster has no VRF missing"},
+		{name: "without metal gateway", vrfs: []string{"unbound"}, cluster: cluster, wantErr: "VRF unbound has no metal gateway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateMachineNetworking(infrastructurev1alpha3.PacketMachineSpec{VRFs: tt.vrfs}, tt.cluster)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/packethost/packngo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// NodeKeyService mints the API keys rendered into the userdata of the nodes
+// and revokes them.
+type NodeKeyService interface {
+	MintNodeAPIKey(projectID, description string, readOnly bool) (*packngo.APIKey, error)
+	RevokeNodeAPIKey(id string) error
+}
+
+// ValidateNodeCredentials checks that the keys minted for the nodes of a
+// cluster outlive what uses them. Without the cloud integration, the cluster
+// templates hand the key to the cloud controller manager, which needs it to
+// write for as long as the cluster runs.
+func ValidateNodeCredentials(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	policy := spec.NodeCredentials
+	switch {
+	case policy == nil:
+		return nil
+	case spec.CloudIntegration == nil && (policy.TTL != nil || policy.ReadOnly):
+		return fmt.Errorf("the cloud controller manager gets the node api key, it can not have a ttl or be read only without the cloud integration: %w", ErrInvalidRequest)
+	case policy.TTL == nil:
+		return nil
+	case policy.TTL.Duration <= 0:
+		return fmt.Errorf("the ttl of the node api keys must be positive, not %s: %w", policy.TTL.Duration, ErrInvalidRequest)
+	case spec.KubeVIP != nil && KubeVIPMode(spec) == infrastructurev1alpha3.KubeVIPModeBGP:
+		return fmt.Errorf("kube-vip reads the BGP neighbors with the node api key as long as the machine runs, it can not have a ttl: %w", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// NodeAPIKeyDescription returns the description of the API key minted for
+// the node of a machine, which tells what it was minted for in the console.
+func NodeAPIKeyDescription(namespace, name string, expiresAt *time.Time) string {
+	description := fmt.Sprintf("cluster-api-provider-packet node key of %s/%s", namespace, name)
+	if expiresAt != nil {
+		description += ", expires " + expiresAt.UTC().Format(time.RFC3339)
+	}
+	return description
+}
+
+// NodeAPIKeyExpiration returns when the API key minted now for a node under
+// policy gets revoked, nil when it lives as long as the machine.
+func NodeAPIKeyExpiration(policy *infrastructurev1alpha3.NodeCredentialsPolicy, now time.Time) *time.Time {
+	if policy == nil || policy.TTL == nil {
+		return nil
+	}
+	expiresAt := now.Add(policy.TTL.Duration)
+	return &expiresAt
+}
+
+// NodeAPIKeyRevocation returns how long the API key minted for the node of a
+// machine has left, zero once it is due for revocation. ok is false for the
+// machines without a key expiring.
+func NodeAPIKeyRevocation(status *infrastructurev1alpha3.NodeAPIKeyStatus, now time.Time) (left time.Duration, ok bool) {
+	if status == nil || status.ExpiresAt == nil {
+		return 0, false
+	}
+	if left = status.ExpiresAt.Sub(now); left < 0 {
+		left = 0
+	}
+	return left, true
+}
+
+// NewNodeAPIKeyStatus returns the status of a key minted to expire at
+// expiresAt, nil for never.
+func NewNodeAPIKeyStatus(key *packngo.APIKey, expiresAt *time.Time) *infrastructurev1alpha3.NodeAPIKeyStatus {
+	status := &infrastructurev1alpha3.NodeAPIKeyStatus{ID: key.ID}
+	if expiresAt != nil {
+		at := metav1.NewTime(*expiresAt)
+		status.ExpiresAt = &at
+	}
+	return status
+}
+
+// MintNodeAPIKey creates an API key of the project for a node. Its token is
+// only known from the response, it is never stored.
+func (p *PacketClient) MintNodeAPIKey(projectID, description string, readOnly bool) (*packngo.APIKey, error) {
+	key, _, err := p.APIKeys.Create(&packngo.APIKeyCreateRequest{
+		ProjectID:   projectID,
+		Description: description,
+		ReadOnly:    readOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint a node api key in project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	return key, nil
+}
+
+// RevokeNodeAPIKey deletes an API key minted for a node. Keys already gone
+// are not an error.
+func (p *PacketClient) RevokeNodeAPIKey(id string) error {
+	if err := p.deleteIfFound(path.Join("/api-keys", id)); err != nil {
+		return fmt.Errorf("failed to revoke node api key %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestValidateNodeCredentials(t *testing.T) {
+	ttl := &metav1.Duration{Duration: time.Hour}
+	integration := &infrastructurev1alpha3.CloudIntegration{}
+	tests := []struct {
+		name    string
+		spec    infrastructurev1alpha3.PacketClusterSpec
+		wantErr string
+	}{
+		{
+			name: "no node credentials",
+		},
+		{
+			name: "keys living as long as the machine",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				NodeCredentials: &infrastructurev1alpha3.NodeCredentialsPolicy{},
+				KubeVIP:         &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeBGP},
+			},
+		},
+		{
+			name: "read only keys",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				NodeCredentials:  &infrastructurev1alpha3.NodeCredentialsPolicy{ReadOnly: true},
+				KubeVIP:          &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeBGP},
+				CloudIntegration: integration,
+			},
+		},
+		{
+			name: "ttl",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				NodeCredentials:  &infrastructurev1alpha3.NodeCredentialsPolicy{TTL: ttl},
+				KubeVIP:          &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeARP},
+				CloudIntegration: integration,
+			},
+		},
+		{
+			name:    "read only keys handed to the cloud controller manager",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{NodeCredentials: &infrastructurev1alpha3.NodeCredentialsPolicy{ReadOnly: true}},
+			wantErr: "without the cloud integration",
+		},
+		{
+			name:    "ttl of keys handed to the cloud controller manager",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{NodeCredentials: &infrastructurev1alpha3.NodeCredentialsPolicy{TTL: ttl}},
+			wantErr: "without the cloud integration",
+		},
+		{
+			name: "zero ttl",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				NodeCredentials:  &infrastructurev1alpha3.NodeCredentialsPolicy{TTL: &metav1.Duration{}},
+				CloudIntegration: integration,
+			},
+			wantErr: "must be positive",
+		},
+		{
+			name: "ttl with kube-vip announcing over bgp",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				NodeCredentials:  &infrastructurev1alpha3.NodeCredentialsPolicy{TTL: ttl},
+				KubeVIP:          &infrastructurev1alpha3.KubeVIPConfig{},
+				BGP:              &infrastructurev1alpha3.BGPConfig{},
+				CloudIntegration: integration,
+			},
+			wantErr: "can not have a ttl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateNodeCredentials(tt.spec)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				g.Expect(err).To(MatchError(ContainSubstring(ErrInvalidRequest.Error())))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+func TestNodeAPIKeyLifetime(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	g.Expect(NodeAPIKeyExpiration(nil, now)).To(BeNil())
+	g.Expect(NodeAPIKeyExpiration(&infrastructurev1alpha3.NodeCredentialsPolicy{}, now)).To(BeNil())
+	expiresAt := NodeAPIKeyExpiration(&infrastructurev1alpha3.NodeCredentialsPolicy{TTL: &metav1.Duration{Duration: time.Hour}}, now)
+	g.Expect(*expiresAt).To(Equal(now.Add(time.Hour)))
+
+	g.Expect(NodeAPIKeyDescription("default", "cp-0", nil)).To(Equal("cluster-api-provider-packet node key of default/cp-0"))
+	g.Expect(NodeAPIKeyDescription("default", "cp-0", expiresAt)).To(Equal("cluster-api-provider-packet node key of default/cp-0, expires 2021-03-04T11:00:00Z"))
+
+	status := NewNodeAPIKeyStatus(&packngo.APIKey{ID: "key", Token: "secret"}, expiresAt)
+	g.Expect(status.ID).To(Equal("key"))
+	g.Expect(status.ExpiresAt.Time).To(BeTemporally("==", now.Add(time.Hour)))
+
+	left, ok := NodeAPIKeyRevocation(status, now.Add(20*time.Minute))
+	g.Expect(ok).To(BeTrue())
+	g.Expect(left).To(Equal(40 * time.Minute))
+	left, ok = NodeAPIKeyRevocation(status, now.Add(2*time.Hour))
+	g.Expect(ok).To(BeTrue())
+	g.Expect(left).To(BeZero())
+
+	// keys living as long as the machine are never due
+	_, ok = NodeAPIKeyRevocation(NewNodeAPIKeyStatus(&packngo.APIKey{ID: "key"}, nil), now)
+	g.Expect(ok).To(BeFalse())
+	_, ok = NodeAPIKeyRevocation(nil, now)
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestMintNodeAPIKey(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodPost, "/projects/project/api-keys", fakeResponse{status: http.StatusCreated, body: map[string]interface{}{"id": "key", "token": "secret"}})
+	api.on(http.MethodDelete, "/api-keys/key", fakeResponse{status: http.StatusNoContent})
+
+	key, err := c.MintNodeAPIKey("project", "node key", true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(key.ID).To(Equal("key"))
+	g.Expect(key.Token).To(Equal("secret"))
+	requests := api.requestsTo(http.MethodPost, "/projects/project/api-keys")
+	g.Expect(requests[0].Body).To(Equal(map[string]interface{}{"description": "node key", "read_only": true}))
+
+	g.Expect(c.RevokeNodeAPIKey("key")).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodDelete, "/api-keys/key")).To(HaveLen(1))
+	// keys already gone are not an error
+	g.Expect(c.RevokeNodeAPIKey("gone")).To(Succeed())
+
+	api.on(http.MethodPost, "/projects/other/api-keys", fakeResponse{status: http.StatusForbidden, body: apiError("You are not authorized to view this project")})
+	_, err = c.MintNodeAPIKey("other", "node key", false)
+	g.Expect(err).To(MatchError(ContainSubstring("failed to mint a node api key in project other")))
+}
+
+func TestNewDeviceNodeAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		oauth      bool
+		nodeAPIKey string
+		want       string
+		wantErr    error
+	}{
+		{
+			name: "controller key",
+			want: "token",
+		},
+		{
+			name:       "minted key",
+			nodeAPIKey: "minted",
+			want:       "minted",
+		},
+		{
+			name:       "minted key with oauth",
+			oauth:      true,
+			nodeAPIKey: "minted",
+			want:       "minted",
+		},
+		{
+			name:    "no key with oauth",
+			oauth:   true,
+			wantErr: ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, c := newFakeAPI(t)
+			api.on(http.MethodPost, "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+			machineScope := newTestMachineScope(t,
+				infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Facility: "ewr1"},
+				infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+				"#cloud-config\nruncmd:\n- echo {{ .apiKey }}\n")
+			machineScope.Machine.Labels = map[string]string{clusterv1.MachineControlPlaneLabelName: ""}
+			if tt.oauth {
+				// the OAuth clients have no API key
+				c.APIKey = ""
+			}
+
+			_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope, NodeAPIKey: tt.nodeAPIKey})
+			if tt.wantErr != nil {
+				g.Expect(errors.Is(err, tt.wantErr)).To(BeTrue(), "unexpected error %v", err)
+				g.Expect(api.requestsTo(http.MethodPost, "/projects/project/devices")).To(BeEmpty())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			userData := api.requestsTo(http.MethodPost, "/projects/project/devices")[0].Body["userdata"]
+			g.Expect(userData).To(Equal("#cloud-config\nruncmd:\n- echo " + tt.want + "\n"))
+		})
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oauthClientIDVarName         = "PACKET_OAUTH_CLIENT_ID"
+	oauthClientSecretVarName     = "PACKET_OAUTH_CLIENT_SECRET"
+	oauthSubjectTokenFileVarName = "PACKET_OAUTH_SUBJECT_TOKEN_FILE"
+
+	// DefaultOAuthTokenURL is the token endpoint of Equinix Identity.
+	DefaultOAuthTokenURL = "https://api.equinix.com/oauth2/v1/token"
+
+	// tokenExchangeGrantType is the grant of RFC 8693 token exchanges.
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// jwtTokenType is the type of the subject tokens exchanged, e.g. the
+	// projected service account token of the manager.
+	jwtTokenType = "urn:ietf:params:oauth:token-type:jwt"
+
+	// oauthRefreshSkew is how long before it expires a token is refreshed,
+	// for the requests in flight not to fail with it.
+	oauthRefreshSkew = time.Minute
+	// oauthDefaultTTL is how long a token answered without its lifetime is
+	// used before being refreshed.
+	oauthDefaultTTL = 5 * time.Minute
+)
+
+// OAuthConfig is how the clients get short lived access tokens for the API
+// instead of using a static API key: with the client credentials of
+// ClientID and ClientSecret, or by exchanging the token read from
+// SubjectTokenFile, as done for the projected service account tokens of
+// workload identity federation.
+type OAuthConfig struct {
+	// TokenURL is the token endpoint.
+	TokenURL string
+	// ClientID and ClientSecret are the client credentials.
+	ClientID     string
+	ClientSecret string
+	// SubjectTokenFile holds the token to exchange. It is read again on
+	// every refresh, as the kubelet rotates projected tokens.
+	SubjectTokenFile string
+	// Audience is the audience of the requested tokens, optional.
+	Audience string
+}
+
+// OAuthConfigFromEnv returns the OAuth configuration of the
+// PACKET_OAUTH_CLIENT_ID and PACKET_OAUTH_CLIENT_SECRET, or the
+// PACKET_OAUTH_SUBJECT_TOKEN_FILE environment variables, nil when none is
+// set.
+func OAuthConfigFromEnv(tokenURL, audience string) (*OAuthConfig, error) {
+	config := &OAuthConfig{
+		TokenURL:         tokenURL,
+		ClientID:         strings.TrimSpace(os.Getenv(oauthClientIDVarName)),
+		ClientSecret:     strings.TrimSpace(os.Getenv(oauthClientSecretVarName)),
+		SubjectTokenFile: strings.TrimSpace(os.Getenv(oauthSubjectTokenFileVarName)),
+		Audience:         audience,
+	}
+	if config.ClientID == "" && config.ClientSecret == "" && config.SubjectTokenFile == "" {
+		return nil, nil
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate returns an error unless the configuration has a token endpoint
+// and exactly one way of getting tokens.
+func (c *OAuthConfig) Validate() error {
+	u, err := url.Parse(c.TokenURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid OAuth token url %q, it must be an https URL", c.TokenURL)
+	}
+	clientCredentials := c.ClientID != "" || c.ClientSecret != ""
+	switch {
+	case clientCredentials && c.SubjectTokenFile != "":
+		return fmt.Errorf("%s and %s are mutually exclusive", oauthClientIDVarName, oauthSubjectTokenFileVarName)
+	case clientCredentials && (c.ClientID == "" || c.ClientSecret == ""):
+		return fmt.Errorf("%s and %s must be set together", oauthClientIDVarName, oauthClientSecretVarName)
+	case !clientCredentials && c.SubjectTokenFile == "":
+		return fmt.Errorf("either %s or %s is required", oauthClientIDVarName, oauthSubjectTokenFileVarName)
+	}
+	return nil
+}
+
+// credential identifies the configuration without holding its secrets.
+func (c *OAuthConfig) credential() string {
+	if c.SubjectTokenFile != "" {
+		return credentialID("oauth-exchange:" + c.TokenURL + ":" + c.SubjectTokenFile)
+	}
+	return credentialID("oauth:" + c.TokenURL + ":" + c.ClientID)
+}
+
+// OAuthTokenSource hands out the access token of an OAuthConfig, refreshing
+// it before it expires. It is shared by the clients of the credential.
+type OAuthTokenSource struct {
+	Config OAuthConfig
+
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	now    func() time.Time
+	// refreshing is closed once the refresh in flight is done, nil when
+	// none is.
+	refreshing chan struct{}
+}
+
+// NewOAuthTokenSource returns a token source of config, requesting its
+// tokens with httpClient.
+func NewOAuthTokenSource(config OAuthConfig, httpClient *http.Client) *OAuthTokenSource {
+	return &OAuthTokenSource{Config: config, httpClient: httpClient, now: time.Now}
+}
+
+// Token returns the current access token, a new one once it is about to
+// expire. When the refresh fails, the current token is returned until it
+// expires. A single refresh is in flight at a time, the token endpoint is
+// requested without holding the lock.
+func (s *OAuthTokenSource) Token(ctx context.Context) (string, error) {
+	for {
+		s.mu.Lock()
+		now := s.now()
+		if s.token != "" && now.Add(oauthRefreshSkew).Before(s.expiry) {
+			token := s.token
+			s.mu.Unlock()
+			return token, nil
+		}
+		refreshing := s.refreshing
+		if refreshing == nil {
+			break
+		}
+		if s.token != "" && now.Before(s.expiry) {
+			token := s.token
+			s.mu.Unlock()
+			return token, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	s.refreshing = done
+	s.mu.Unlock()
+
+	token, ttl, err := s.request(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshing = nil
+	close(done)
+	now := s.now()
+	if err != nil {
+		if s.token != "" && now.Before(s.expiry) {
+			return s.token, nil
+		}
+		return "", err
+	}
+	s.token, s.expiry = token, now.Add(ttl)
+	return s.token, nil
+}
+
+// invalidate drops token, the API refused it, for the next request to get
+// another one.
+func (s *OAuthTokenSource) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token, s.expiry = "", time.Time{}
+	}
+}
+
+// request requests a token from the token endpoint, and returns it with its
+// lifetime.
+func (s *OAuthTokenSource) request(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	if s.Config.SubjectTokenFile != "" {
+		subject, err := ioutil.ReadFile(s.Config.SubjectTokenFile)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read the subject token: %w", err)
+		}
+		form.Set("grant_type", tokenExchangeGrantType)
+		form.Set("subject_token", strings.TrimSpace(string(subject)))
+		form.Set("subject_token_type", jwtTokenType)
+	} else {
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", s.Config.ClientID)
+		form.Set("client_secret", s.Config.ClientSecret)
+	}
+	if s.Config.Audience != "" {
+		form.Set("audience", s.Config.Audience)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.Config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request an OAuth token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read the OAuth token: %w", err)
+	}
+
+	answer := struct {
+		AccessToken      string      `json:"access_token"`
+		ExpiresIn        interface{} `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}{}
+	if err := json.Unmarshal(body, &answer); err != nil && resp.StatusCode == http.StatusOK {
+		return "", 0, fmt.Errorf("failed to decode the OAuth token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || answer.AccessToken == "" {
+		message := strings.TrimSpace(answer.Error + " " + answer.ErrorDescription)
+		if message == "" {
+			message = resp.Status
+		}
+		return "", 0, fmt.Errorf("the OAuth token endpoint refused the request: %s", message)
+	}
+	return answer.AccessToken, tokenLifetime(answer.ExpiresIn), nil
+}
+
+// tokenLifetime returns the lifetime of an expires_in, a number of seconds
+// some endpoints answer as a string, oauthDefaultTTL when missing.
+func tokenLifetime(expiresIn interface{}) time.Duration {
+	seconds := 0.0
+	switch value := expiresIn.(type) {
+	case float64:
+		seconds = value
+	case string:
+		seconds, _ = strconv.ParseFloat(value, 64)
+	}
+	if seconds <= 0 {
+		return oauthDefaultTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// oauthTransport authenticates the requests it sends with the access token of
+// source instead of the API key packngo sets.
+type oauthTransport struct {
+	base   http.RoundTripper
+	source *OAuthTokenSource
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del("X-Auth-Token")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// revoked before it expired, the next request gets another one
+		t.source.invalidate(token)
+	}
+	return resp, err
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// fakeTokenEndpoint is an OAuth token endpoint handing out numbered tokens
+// living expiresIn, or failing with status when set.
+type fakeTokenEndpoint struct {
+	mu        sync.Mutex
+	expiresIn interface{}
+	status    int
+	forms     []url.Values
+}
+
+func newFakeTokenEndpoint(t *testing.T) (*fakeTokenEndpoint, *httptest.Server) {
+	endpoint := &fakeTokenEndpoint{expiresIn: "3600"}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		endpoint.mu.Lock()
+		defer endpoint.mu.Unlock()
+		endpoint.forms = append(endpoint.forms, r.PostForm)
+		w.Header().Set("Content-Type", "application/json")
+		if endpoint.status != 0 {
+			w.WriteHeader(endpoint.status)
+			fmt.Fprint(w, `{"error":"invalid_client","error_description":"unknown client"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%q}`, len(endpoint.forms), fmt.Sprint(endpoint.expiresIn))
+	}))
+	t.Cleanup(server.Close)
+	return endpoint, server
+}
+
+// form returns the form of the i-th token request.
+func (e *fakeTokenEndpoint) form(i int) url.Values {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.forms[i]
+}
+
+// set changes the answers of the endpoint.
+func (e *fakeTokenEndpoint) set(expiresIn interface{}, status int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expiresIn, e.status = expiresIn, status
+}
+
+func TestOAuthConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  OAuthConfig
+		wantErr string
+	}{
+		{
+			name:   "client credentials",
+			config: OAuthConfig{TokenURL: DefaultOAuthTokenURL, ClientID: "id", ClientSecret: "secret"},
+		},
+		{
+			name:   "token exchange",
+			config: OAuthConfig{TokenURL: DefaultOAuthTokenURL, SubjectTokenFile: "/var/run/secrets/tokens/metal"},
+		},
+		{
+			name:    "plain http",
+			config:  OAuthConfig{TokenURL: "http://api.equinix.com/oauth2/v1/token", ClientID: "id", ClientSecret: "secret"},
+			wantErr: "it must be an https URL",
+		},
+		{
+			name:    "secret missing",
+			config:  OAuthConfig{TokenURL: DefaultOAuthTokenURL, ClientID: "id"},
+			wantErr: "must be set together",
+		},
+		{
+			name:    "both",
+			config:  OAuthConfig{TokenURL: DefaultOAuthTokenURL, ClientID: "id", ClientSecret: "secret", SubjectTokenFile: "/token"},
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "none",
+			config:  OAuthConfig{TokenURL: DefaultOAuthTokenURL},
+			wantErr: "is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+		})
+	}
+}
+
+func TestOAuthConfigFromEnv(t *testing.T) {
+	g := NewWithT(t)
+	for _, name := range []string{oauthClientIDVarName, oauthClientSecretVarName, oauthSubjectTokenFileVarName} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	config, err := OAuthConfigFromEnv(DefaultOAuthTokenURL, "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(BeNil())
+
+	os.Setenv(oauthClientIDVarName, "id")
+	_, err = OAuthConfigFromEnv(DefaultOAuthTokenURL, "")
+	g.Expect(err).To(HaveOccurred())
+
+	os.Setenv(oauthClientSecretVarName, "secret")
+	config, err = OAuthConfigFromEnv(DefaultOAuthTokenURL, "metal")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(Equal(&OAuthConfig{TokenURL: DefaultOAuthTokenURL, ClientID: "id", ClientSecret: "secret", Audience: "metal"}))
+}
+
+func TestOAuthTokenSourceClientCredentials(t *testing.T) {
+	g := NewWithT(t)
+	endpoint, server := newFakeTokenEndpoint(t)
+	source := NewOAuthTokenSource(OAuthConfig{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret", Audience: "metal"}, server.Client())
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(token).To(Equal("token-1"))
+	g.Expect(endpoint.form(0).Get("grant_type")).To(Equal("client_credentials"))
+	g.Expect(endpoint.form(0).Get("client_id")).To(Equal("id"))
+	g.Expect(endpoint.form(0).Get("client_secret")).To(Equal("secret"))
+	g.Expect(endpoint.form(0).Get("audience")).To(Equal("metal"))
+
+	// the token is reused until it is about to expire
+	now = now.Add(58 * time.Minute)
+	g.Expect(source.Token(context.Background())).To(Equal("token-1"))
+	now = now.Add(time.Minute + time.Second)
+	g.Expect(source.Token(context.Background())).To(Equal("token-2"))
+
+	// a failed refresh keeps the current token until it expires
+	endpoint.set("3600", http.StatusUnauthorized)
+	now = now.Add(59*time.Minute + 30*time.Second)
+	g.Expect(source.Token(context.Background())).To(Equal("token-2"))
+	now = now.Add(time.Minute)
+	_, err = source.Token(context.Background())
+	g.Expect(err).To(MatchError(ContainSubstring("invalid_client unknown client")))
+}
+
+func TestOAuthTokenSourceConcurrentRefresh(t *testing.T) {
+	g := NewWithT(t)
+	requests := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		<-release
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+	}))
+	defer server.Close()
+	source := NewOAuthTokenSource(OAuthConfig{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret"}, server.Client())
+
+	tokens := make(chan string, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			token, _ := source.Token(context.Background())
+			tokens <- token
+		}()
+	}
+	<-requests
+
+	// the lock is not held while the token is requested
+	source.invalidate("unknown")
+
+	// a canceled caller stops waiting for the refresh in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := source.Token(ctx)
+	g.Expect(err).To(MatchError(context.Canceled))
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		g.Expect(<-tokens).To(Equal("token"))
+	}
+	// the callers shared a single request
+	g.Expect(requests).To(BeEmpty())
+}
+
+func TestOAuthTokenSourceExchange(t *testing.T) {
+	g := NewWithT(t)
+	endpoint, server := newFakeTokenEndpoint(t)
+	endpoint.set("", 0)
+	dir, err := ioutil.TempDir("", "oauth")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	g.Expect(ioutil.WriteFile(file, []byte("projected-1\n"), 0600)).To(Succeed())
+
+	source := NewOAuthTokenSource(OAuthConfig{TokenURL: server.URL, SubjectTokenFile: file}, server.Client())
+	now := time.Now()
+	source.now = func() time.Time { return now }
+	g.Expect(source.Token(context.Background())).To(Equal("token-1"))
+	g.Expect(endpoint.form(0).Get("grant_type")).To(Equal(tokenExchangeGrantType))
+	g.Expect(endpoint.form(0).Get("subject_token")).To(Equal("projected-1"))
+	g.Expect(endpoint.form(0).Get("subject_token_type")).To(Equal(jwtTokenType))
+	g.Expect(endpoint.form(0)).NotTo(HaveKey("client_secret"))
+
+	// without a lifetime the token is refreshed after oauthDefaultTTL, with
+	// the rotated subject token
+	g.Expect(ioutil.WriteFile(file, []byte("projected-2\n"), 0600)).To(Succeed())
+	now = now.Add(oauthDefaultTTL)
+	g.Expect(source.Token(context.Background())).To(Equal("token-2"))
+	g.Expect(endpoint.form(1).Get("subject_token")).To(Equal("projected-2"))
+}
+
+func TestClientPoolOAuth(t *testing.T) {
+	g := NewWithT(t)
+	api, fake := newFakeAPI(t)
+	api.on("GET", "/devices/device",
+		fakeResponse{status: http.StatusOK, body: map[string]string{"id": "device"}},
+		fakeResponse{status: http.StatusUnauthorized, body: apiError("token revoked")},
+		fakeResponse{status: http.StatusOK, body: map[string]string{"id": "device"}},
+	)
+	_, server := newFakeTokenEndpoint(t)
+
+	pool := NewClientPool(time.Hour, nil)
+	pool.DeviceCacheTTL = 0
+	pool.OAuth = &OAuthConfig{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret"}
+	c, err := pool.GetOAuth(*pool.OAuth, fake.BaseURL.String())
+	g.Expect(err).NotTo(HaveOccurred())
+	c.transport.(*rateTransport).base.(*oauthTransport).source.httpClient = server.Client()
+	g.Expect(c.Token()).To(BeEmpty())
+	g.Expect(c.credential()).To(Equal(pool.OAuth.credential()))
+
+	// the clients of the configuration are shared
+	again, err := pool.GetOAuth(*pool.OAuth, fake.BaseURL.String())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(again).To(BeIdenticalTo(c))
+
+	_, err = c.GetDevice("device")
+	g.Expect(err).NotTo(HaveOccurred())
+	// a refused token is dropped, the next request gets another one
+	_, err = c.GetDevice("device")
+	g.Expect(err).To(HaveOccurred())
+	_, err = c.GetDevice("device")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	requests := api.requestsTo("GET", "/devices/device")
+	g.Expect(requests).To(HaveLen(3))
+	g.Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer token-1"))
+	g.Expect(requests[0].Header.Get("X-Auth-Token")).To(BeEmpty())
+	g.Expect(requests[1].Header.Get("Authorization")).To(Equal("Bearer token-1"))
+	g.Expect(requests[2].Header.Get("Authorization")).To(Equal("Bearer token-2"))
+
+	_, err = pool.GetOAuth(OAuthConfig{TokenURL: server.URL}, "")
+	g.Expect(err).To(HaveOccurred())
+}
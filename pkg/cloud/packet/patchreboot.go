@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// DefaultPatchRebootCheckInterval is how often the nodes of a cluster are
+// checked for reboots when its policy sets no interval.
+const DefaultPatchRebootCheckInterval = 10 * time.Minute
+
+// RebootCandidate is a node of a cluster and the device it runs on.
+type RebootCandidate struct {
+	Node          string
+	DeviceID      string
+	FailureDomain string
+	// Required tells the node requires a reboot.
+	Required bool
+}
+
+// RebootRequiredAnnotation returns the annotation of the nodes requiring a
+// reboot under policy.
+func RebootRequiredAnnotation(policy *infrastructurev1alpha3.PatchRebootPolicy) string {
+	if policy.RebootRequiredAnnotation != "" {
+		return policy.RebootRequiredAnnotation
+	}
+	return infrastructurev1alpha3.RebootRequiredAnnotation
+}
+
+// PatchRebootCheckInterval returns how often the nodes are checked for
+// reboots under policy.
+func PatchRebootCheckInterval(policy *infrastructurev1alpha3.PatchRebootPolicy) time.Duration {
+	if policy.CheckInterval != nil && policy.CheckInterval.Duration > 0 {
+		return policy.CheckInterval.Duration
+	}
+	return DefaultPatchRebootCheckInterval
+}
+
+// NextRebootDomain returns the failure domain rebooted next, the first by
+// name with nodes requiring a reboot, empty when no node requires one.
+func NextRebootDomain(candidates []RebootCandidate) string {
+	domains := []string{}
+	for _, c := range candidates {
+		if c.Required {
+			domains = append(domains, c.FailureDomain)
+		}
+	}
+	if len(domains) == 0 {
+		return ""
+	}
+	sort.Strings(domains)
+	return domains[0]
+}
+
+// NodesToReboot returns the nodes of the failure domain of status requiring a
+// reboot and not rebooting yet, at most enough for maxUnavailable nodes of
+// the domain to be rebooting.
+func NodesToReboot(candidates []RebootCandidate, status *infrastructurev1alpha3.PatchRebootStatus, maxUnavailable int) []RebootCandidate {
+	rebooting := map[string]bool{}
+	for _, n := range status.Nodes {
+		rebooting[n.Name] = true
+	}
+	nodes := []RebootCandidate{}
+	for _, c := range candidates {
+		if len(rebooting)+len(nodes) >= maxUnavailable {
+			break
+		}
+		if c.Required && c.FailureDomain == status.FailureDomain && !rebooting[c.Node] {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// NodeRebooted reports whether a node runs a boot other than bootID and is
+// ready again.
+func NodeRebooted(node *corev1.Node, bootID string) bool {
+	return node.Status.NodeInfo.BootID != bootID && NodeReady(node)
+}
+
+// NodeReady reports whether the Ready condition of a node is true.
+func NodeReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
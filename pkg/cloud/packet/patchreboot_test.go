@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestPatchRebootPolicyDefaults(t *testing.T) {
+	g := NewWithT(t)
+
+	policy := &infrastructurev1alpha3.PatchRebootPolicy{}
+	g.Expect(RebootRequiredAnnotation(policy)).To(Equal(infrastructurev1alpha3.RebootRequiredAnnotation))
+	g.Expect(PatchRebootCheckInterval(policy)).To(Equal(DefaultPatchRebootCheckInterval))
+
+	policy = &infrastructurev1alpha3.PatchRebootPolicy{RebootRequiredAnnotation: "weave.works/reboot-required", CheckInterval: &metav1.Duration{Duration: time.Minute}}
+	g.Expect(RebootRequiredAnnotation(policy)).To(Equal("weave.works/reboot-required"))
+	g.Expect(PatchRebootCheckInterval(policy)).To(Equal(time.Minute))
+}
+
+func TestNextRebootDomain(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(NextRebootDomain(nil)).To(BeEmpty())
+	g.Expect(NextRebootDomain([]RebootCandidate{{Node: "a", FailureDomain: "da11"}})).To(BeEmpty())
+	g.Expect(NextRebootDomain([]RebootCandidate{
+		{Node: "a", FailureDomain: "da11"},
+		{Node: "b", FailureDomain: "dc13", Required: true},
+		{Node: "c", FailureDomain: "da12", Required: true},
+	})).To(Equal("da12"))
+}
+
+func TestNodesToReboot(t *testing.T) {
+	candidates := []RebootCandidate{
+		{Node: "a", FailureDomain: "da11", Required: true},
+		{Node: "b", FailureDomain: "da11"},
+		{Node: "c", FailureDomain: "da12", Required: true},
+		{Node: "d", FailureDomain: "da11", Required: true},
+	}
+
+	tests := []struct {
+		name           string
+		rebooting      []string
+		maxUnavailable int
+		want           []string
+	}{
+		{name: "one at a time", maxUnavailable: 1, want: []string{"a"}},
+		{name: "already rebooting", rebooting: []string{"a"}, maxUnavailable: 1, want: []string{}},
+		{name: "next one", rebooting: []string{"a"}, maxUnavailable: 2, want: []string{"d"}},
+		{name: "whole domain", maxUnavailable: 5, want: []string{"a", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			status := &infrastructurev1alpha3.PatchRebootStatus{FailureDomain: "da11"}
+			for _, name := range tt.rebooting {
+				status.Nodes = append(status.Nodes, infrastructurev1alpha3.RebootingNode{Name: name})
+			}
+			nodes := []string{}
+			for _, c := range NodesToReboot(candidates, status, tt.maxUnavailable) {
+				nodes = append(nodes, c.Node)
+			}
+			g.Expect(nodes).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestNodeRebooted(t *testing.T) {
+	g := NewWithT(t)
+	node := func(bootID string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{Status: corev1.NodeStatus{
+			NodeInfo:   corev1.NodeSystemInfo{BootID: bootID},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+		}}
+	}
+
+	g.Expect(NodeRebooted(node("before", corev1.ConditionTrue), "before")).To(BeFalse())
+	g.Expect(NodeRebooted(node("after", corev1.ConditionUnknown), "before")).To(BeFalse())
+	g.Expect(NodeRebooted(node("after", corev1.ConditionTrue), "before")).To(BeTrue())
+	g.Expect(NodeRebooted(&corev1.Node{Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{BootID: "after"}}}, "before")).To(BeFalse())
+
+	g.Expect(NodeReady(node("", corev1.ConditionTrue))).To(BeTrue())
+	g.Expect(NodeReady(node("", corev1.ConditionFalse))).To(BeFalse())
+	g.Expect(NodeReady(&corev1.Node{})).To(BeFalse())
+}
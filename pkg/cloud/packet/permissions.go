@@ -0,0 +1,284 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// The permissions the controllers need in the project of a cluster.
+const (
+	PermissionProjectAccess = "project-access"
+	PermissionDeviceWrite   = "device-write"
+	PermissionIPWrite       = "ip-write"
+	PermissionBGPConfig     = "bgp-config"
+)
+
+// KeyScope is what an API key gives access to.
+type KeyScope string
+
+const (
+	// KeyScopeUnknown is the scope of a key not probed yet.
+	KeyScopeUnknown KeyScope = ""
+	// KeyScopeUser keys act as their user, in every project of the
+	// organizations of the user, and can create projects.
+	KeyScopeUser KeyScope = "user"
+	// KeyScopeProject keys only access their project. They can neither list
+	// the keys of a user or the organizations, nor create projects.
+	KeyScopeProject KeyScope = "project"
+)
+
+var (
+	tokenPermission = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capp_packet_token_permission",
+		Help: "Whether a credential has a permission in a project: 1 granted, 0 missing. The project is empty for the permissions of the credential itself.",
+	}, []string{"credential", "project", "permission"})
+	tokenScope = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capp_packet_token_scope",
+		Help: "The scope of a credential, user or project, set to 1.",
+	}, []string{"credential", "scope"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(tokenPermission, tokenScope)
+}
+
+// TokenPermissions are the permissions an API key has, as far as the Packet
+// API lets them be probed without side effects.
+type TokenPermissions struct {
+	// KeyFound is false when the API key could not be found among the keys
+	// of its user or project. Its ReadOnly flag is then unknown and the key
+	// assumed to be writable.
+	KeyFound bool
+	// ReadOnly keys can not create resources. Packet has no finer grained
+	// scopes, devices and ip reservations are both writable or not.
+	ReadOnly bool
+	// ProjectAccess is false when the project can not be read with the key.
+	ProjectAccess bool
+	// BGPConfig is false when the BGP configuration of the project can not
+	// be read with the key.
+	BGPConfig bool
+	// Scope is whether the key is a user or a project key. Project keys can
+	// not list the keys of a user, which tells them apart even when the key
+	// itself is not found.
+	Scope KeyScope
+}
+
+// Granted returns whether each permission is granted. The project ones are
+// only set for the permissions of a project, where nothing is granted without
+// access to the project.
+func (p TokenPermissions) Granted(project bool) map[string]bool {
+	writable := !p.ReadOnly && (p.ProjectAccess || !project)
+	granted := map[string]bool{
+		PermissionDeviceWrite: writable,
+		PermissionIPWrite:     writable,
+	}
+	if project {
+		granted[PermissionProjectAccess] = p.ProjectAccess
+		granted[PermissionBGPConfig] = p.BGPConfig
+	}
+	return granted
+}
+
+// Missing returns the permissions of a project the key lacks, in a stable
+// order.
+func (p TokenPermissions) Missing() []string {
+	granted := p.Granted(true)
+	missing := []string{}
+	for _, permission := range []string{PermissionProjectAccess, PermissionDeviceWrite, PermissionIPWrite, PermissionBGPConfig} {
+		if !granted[permission] {
+			missing = append(missing, permission)
+		}
+	}
+	return missing
+}
+
+// PermissionChecker probes the permissions of the API key of a client. The
+// permissions of every project are cached for Interval so that reconciling
+// many clusters does not eat into the API rate limit, and so that a key
+// whose permissions change gets probed again.
+type PermissionChecker struct {
+	Client   *PacketClient
+	Interval time.Duration
+
+	mu       sync.Mutex
+	projects map[string]checkedPermissions
+	// scope is the scope of the key once probed, which spares the project
+	// keys the listing of the keys of their user.
+	scope KeyScope
+	now   func() time.Time
+}
+
+type checkedPermissions struct {
+	permissions TokenPermissions
+	checkedAt   time.Time
+}
+
+// NewPermissionChecker returns a PermissionChecker caching its results for
+// interval.
+func NewPermissionChecker(client *PacketClient, interval time.Duration) *PermissionChecker {
+	return &PermissionChecker{
+		Client:   client,
+		Interval: interval,
+		projects: map[string]checkedPermissions{},
+		now:      time.Now,
+	}
+}
+
+// CheckToken probes the permissions of the API key outside of any project,
+// as done when the controller starts.
+func (c *PermissionChecker) CheckToken() (TokenPermissions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	permissions := TokenPermissions{}
+	key, err := c.findKey("")
+	if err != nil {
+		return permissions, err
+	}
+	permissions.Scope = c.scope
+	if key != nil {
+		permissions.KeyFound = true
+		permissions.ReadOnly = key.ReadOnly
+	}
+	c.record("", permissions, false)
+	return permissions, nil
+}
+
+// Scope returns the scope of the API key, unknown until it was probed.
+func (c *PermissionChecker) Scope() KeyScope {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.scope
+}
+
+// Check returns the permissions of the API key in projectID, probed at most
+// once per Interval. Errors other than a denied access are returned, and not
+// cached.
+func (c *PermissionChecker) Check(projectID string) (TokenPermissions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if checked, ok := c.projects[projectID]; ok && now.Sub(checked.checkedAt) < c.Interval {
+		return checked.permissions, nil
+	}
+
+	permissions, err := c.probe(projectID)
+	if err != nil {
+		return permissions, err
+	}
+	c.projects[projectID] = checkedPermissions{permissions: permissions, checkedAt: now}
+	c.record(projectID, permissions, true)
+	return permissions, nil
+}
+
+func (c *PermissionChecker) probe(projectID string) (TokenPermissions, error) {
+	permissions := TokenPermissions{Scope: c.scope}
+
+	_, _, err := c.Client.Projects.Get(projectID, nil)
+	switch err = packeterrors.Wrap(err); {
+	case deniedOrMissing(err):
+		// nothing else can be probed in a project that can not be read
+		return permissions, nil
+	case err != nil:
+		return permissions, fmt.Errorf("failed to get project %s: %w", projectID, err)
+	}
+	permissions.ProjectAccess = true
+
+	key, err := c.findKey(projectID)
+	if err != nil {
+		return permissions, err
+	}
+	permissions.Scope = c.scope
+	if key != nil {
+		permissions.KeyFound = true
+		permissions.ReadOnly = key.ReadOnly
+	}
+
+	// a project without BGP enabled has no configuration to read
+	_, _, err = c.Client.BGPConfig.Get(projectID, nil)
+	switch err = packeterrors.Wrap(err); {
+	case err == nil || packeterrors.IsNotFound(err):
+		permissions.BGPConfig = true
+	case !packeterrors.IsForbidden(err):
+		return permissions, fmt.Errorf("failed to get the bgp configuration of project %s: %w", projectID, err)
+	}
+	return permissions, nil
+}
+
+// findKey looks the API key of the client up among the keys of its user, then
+// among the keys of projectID when it is a project key, recording the scope of
+// the key. It returns nil when the key is in neither.
+func (c *PermissionChecker) findKey(projectID string) (*packngo.APIKey, error) {
+	token := c.Client.Token()
+	var keys []packngo.APIKey
+	if c.scope != KeyScopeProject {
+		userKeys, _, err := c.Client.APIKeys.UserList(nil)
+		switch err = packeterrors.Wrap(err); {
+		case err == nil:
+			c.scope, keys = KeyScopeUser, userKeys
+		case deniedOrMissing(err):
+			// project keys can not list the keys of a user
+			c.scope = KeyScopeProject
+		default:
+			return nil, fmt.Errorf("failed to list the api keys of the user: %w", err)
+		}
+	}
+	if c.scope == KeyScopeProject && projectID != "" {
+		projectKeys, _, err := c.Client.APIKeys.ProjectList(projectID, nil)
+		if err = packeterrors.Wrap(err); err != nil && !deniedOrMissing(err) {
+			return nil, fmt.Errorf("failed to list the api keys of project %s: %w", projectID, err)
+		}
+		keys = projectKeys
+	}
+	for i := range keys {
+		// the clients authenticating with OAuth have no key to find
+		if token != "" && keys[i].Token == token {
+			return &keys[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// deniedOrMissing returns true when err is the API refusing access to a
+// resource, hidden as missing or not.
+func deniedOrMissing(err error) bool {
+	return packeterrors.IsForbidden(err) || packeterrors.IsNotFound(err)
+}
+
+func (c *PermissionChecker) record(projectID string, permissions TokenPermissions, project bool) {
+	credential := c.Client.credential()
+	for permission, granted := range permissions.Granted(project) {
+		value := 0.0
+		if granted {
+			value = 1
+		}
+		tokenPermission.WithLabelValues(credential, projectID, permission).Set(value)
+	}
+	if permissions.Scope != KeyScopeUnknown {
+		tokenScope.WithLabelValues(credential, string(permissions.Scope)).Set(1)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPermissionCheckerCheck(t *testing.T) {
+	userKeys := func(readOnly bool) fakeResponse {
+		return fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"api_keys": []map[string]interface{}{
+				{"id": "other", "token": "other", "read_only": false},
+				{"id": "key", "token": "token", "read_only": readOnly},
+			},
+		}}
+	}
+	forbidden := fakeResponse{status: http.StatusForbidden, body: apiError("You are not authorized to view this resource")}
+	project := fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "project"}}
+
+	tests := []struct {
+		name        string
+		responses   map[string]fakeResponse
+		want        TokenPermissions
+		wantMissing []string
+		wantErr     bool
+	}{
+		{
+			name: "writable user key",
+			responses: map[string]fakeResponse{
+				"GET /projects/project":            project,
+				"GET /user/api-keys":               userKeys(false),
+				"GET /projects/project/bgp-config": {status: http.StatusOK, body: map[string]interface{}{"status": "enabled"}},
+			},
+			want:        TokenPermissions{KeyFound: true, ProjectAccess: true, BGPConfig: true, Scope: KeyScopeUser},
+			wantMissing: []string{},
+		},
+		{
+			name: "read only user key",
+			responses: map[string]fakeResponse{
+				"GET /projects/project": project,
+				"GET /user/api-keys":    userKeys(true),
+			},
+			want:        TokenPermissions{KeyFound: true, ReadOnly: true, ProjectAccess: true, BGPConfig: true, Scope: KeyScopeUser},
+			wantMissing: []string{PermissionDeviceWrite, PermissionIPWrite},
+		},
+		{
+			name: "read only project key",
+			responses: map[string]fakeResponse{
+				"GET /projects/project":            project,
+				"GET /user/api-keys":               forbidden,
+				"GET /projects/project/api-keys":   userKeys(true),
+				"GET /projects/project/bgp-config": forbidden,
+			},
+			want:        TokenPermissions{KeyFound: true, ReadOnly: true, ProjectAccess: true, Scope: KeyScopeProject},
+			wantMissing: []string{PermissionDeviceWrite, PermissionIPWrite, PermissionBGPConfig},
+		},
+		{
+			name: "key not found",
+			responses: map[string]fakeResponse{
+				"GET /projects/project":          project,
+				"GET /user/api-keys":             forbidden,
+				"GET /projects/project/api-keys": forbidden,
+			},
+			want:        TokenPermissions{ProjectAccess: true, BGPConfig: true, Scope: KeyScopeProject},
+			wantMissing: []string{},
+		},
+		{
+			name: "project of another user",
+			responses: map[string]fakeResponse{
+				"GET /projects/project": forbidden,
+			},
+			want:        TokenPermissions{},
+			wantMissing: []string{PermissionProjectAccess, PermissionDeviceWrite, PermissionIPWrite, PermissionBGPConfig},
+		},
+		{
+			name: "api failure",
+			responses: map[string]fakeResponse{
+				"GET /projects/project": {status: http.StatusInternalServerError, body: apiError("internal error")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			api, client := newFakeAPI(t)
+			for route, response := range tt.responses {
+				parts := strings.SplitN(route, " ", 2)
+				api.on(parts[0], parts[1], response)
+			}
+
+			permissions, err := NewPermissionChecker(client, time.Minute).Check("project")
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(permissions).To(Equal(tt.want))
+			g.Expect(permissions.Missing()).To(Equal(tt.wantMissing))
+		})
+	}
+}
+
+func TestPermissionCheckerCachesResult(t *testing.T) {
+	g := NewWithT(t)
+	api, client := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "project"}})
+
+	now := time.Now()
+	checker := NewPermissionChecker(client, time.Minute)
+	checker.now = func() time.Time { return now }
+
+	_, err := checker.Check("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = checker.Check("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo(http.MethodGet, "/projects/project")).To(HaveLen(1))
+
+	now = now.Add(2 * time.Minute)
+	_, err = checker.Check("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo(http.MethodGet, "/projects/project")).To(HaveLen(2))
+}
+
+func TestPermissionCheckerCheckToken(t *testing.T) {
+	g := NewWithT(t)
+	api, client := newFakeAPI(t)
+	api.on(http.MethodGet, "/user/api-keys", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"api_keys": []map[string]interface{}{{"id": "key", "token": "token", "read_only": true}},
+	}})
+
+	permissions, err := NewPermissionChecker(client, time.Minute).CheckToken()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(permissions).To(Equal(TokenPermissions{KeyFound: true, ReadOnly: true, Scope: KeyScopeUser}))
+}
+
+func TestPermissionCheckerProjectKey(t *testing.T) {
+	g := NewWithT(t)
+	api, client := newFakeAPI(t)
+	api.on(http.MethodGet, "/user/api-keys", fakeResponse{status: http.StatusForbidden, body: apiError("You are not authorized to view this resource")})
+	api.on(http.MethodGet, "/projects/project", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "project"}})
+	api.on(http.MethodGet, "/projects/project/api-keys", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"api_keys": []map[string]interface{}{{"id": "key", "token": "token", "read_only": false}},
+	}})
+
+	checker := NewPermissionChecker(client, time.Minute)
+	g.Expect(checker.Scope()).To(Equal(KeyScopeUnknown))
+	permissions, err := checker.CheckToken()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(permissions).To(Equal(TokenPermissions{Scope: KeyScopeProject}))
+	g.Expect(checker.Scope()).To(Equal(KeyScopeProject))
+
+	// the keys of the user are not listed again once the key is known to be a project key
+	permissions, err = checker.Check("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(permissions).To(Equal(TokenPermissions{KeyFound: true, ProjectAccess: true, BGPConfig: true, Scope: KeyScopeProject}))
+	g.Expect(api.requestsTo(http.MethodGet, "/user/api-keys")).To(HaveLen(1))
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// planMigrationSkippedAnnotations are not copied to the templates created by
+// plan migrations, they describe the template they were cloned from.
+var planMigrationSkippedAnnotations = []string{
+	infrastructurev1alpha3.CapacityAnnotation,
+	infrastructurev1alpha3.CapacityCheckedAnnotation,
+	"kubectl.kubernetes.io/last-applied-configuration",
+}
+
+// PlanMigrationTemplateName returns the name of the PacketMachineTemplate a
+// plan migration of template to machineType creates: the name of template
+// suffixed with the machine type, the suffix of the migration that created
+// template, if any, replaced.
+func PlanMigrationTemplateName(template *infrastructurev1alpha3.PacketMachineTemplate, machineType string) string {
+	base := template.Name
+	if _, ok := template.Annotations[infrastructurev1alpha3.MigratedFromAnnotation]; ok {
+		base = strings.TrimSuffix(base, "-"+strings.ToLower(template.Spec.Template.Spec.MachineType))
+	}
+	suffix := "-" + strings.ToLower(machineType)
+	if max := validation.DNS1123SubdomainMaxLength - len(suffix); len(base) > max {
+		base = base[:max]
+	}
+	return base + suffix
+}
+
+// PlanMigrationTemplate returns the PacketMachineTemplate a plan migration of
+// template to machineType creates: a copy of template with the machine type,
+// owned by the owners of template.
+func PlanMigrationTemplate(template *infrastructurev1alpha3.PacketMachineTemplate, machineType string) *infrastructurev1alpha3.PacketMachineTemplate {
+	annotations := map[string]string{}
+	for key, value := range template.Annotations {
+		annotations[key] = value
+	}
+	for _, key := range planMigrationSkippedAnnotations {
+		delete(annotations, key)
+	}
+	annotations[infrastructurev1alpha3.MigratedFromAnnotation] = template.Name
+
+	labels := map[string]string{}
+	for key, value := range template.Labels {
+		labels[key] = value
+	}
+
+	migrated := &infrastructurev1alpha3.PacketMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       template.Namespace,
+			Name:            PlanMigrationTemplateName(template, machineType),
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: append([]metav1.OwnerReference{}, template.OwnerReferences...),
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	migrated.Spec.Template.Spec.MachineType = machineType
+	return migrated
+}
+
+// MarkPlanMigration reports on template the roll out of md, which references
+// it, to the machine type of its plan migration. The machines are migrated
+// once md has as many machines as it wants, all of them updated and
+// available.
+func MarkPlanMigration(template *infrastructurev1alpha3.PacketMachineTemplate, md *clusterv1.MachineDeployment) {
+	migration := template.Status.Migration
+	replicas := int32(1)
+	if md.Spec.Replicas != nil {
+		replicas = *md.Spec.Replicas
+	}
+	migration.Replicas = replicas
+	migration.UpdatedReplicas = md.Status.UpdatedReplicas
+
+	conditions.MarkTrue(template, infrastructurev1alpha3.MachineDeploymentUpdatedCondition)
+	if md.Status.UpdatedReplicas == replicas && md.Status.Replicas == replicas && md.Status.AvailableReplicas == replicas {
+		conditions.MarkTrue(template, infrastructurev1alpha3.MachinesMigratedCondition)
+		return
+	}
+	conditions.MarkFalse(template, infrastructurev1alpha3.MachinesMigratedCondition, infrastructurev1alpha3.RollingOutReason, clusterv1.ConditionSeverityInfo,
+		"%d of %d machines on %s", md.Status.UpdatedReplicas, replicas, migration.MachineType)
+}
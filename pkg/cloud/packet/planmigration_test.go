@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestPlanMigrationTemplate(t *testing.T) {
+	g := NewWithT(t)
+	template := &infrastructurev1alpha3.PacketMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "workers",
+			Labels:    map[string]string{clusterv1.ClusterLabelName: "capi"},
+			Annotations: map[string]string{
+				infrastructurev1alpha3.CapacityAnnotation:      "normal",
+				infrastructurev1alpha3.MaxHourlyCostAnnotation: "2",
+			},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Cluster", Name: "capi"}},
+		},
+		Spec: infrastructurev1alpha3.PacketMachineTemplateSpec{
+			Template: infrastructurev1alpha3.PacketMachineTemplateResource{
+				Spec: infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", BillingCycle: "hourly", MachineType: "c3.small.x86"},
+			},
+		},
+	}
+
+	migrated := PlanMigrationTemplate(template, "c3.medium.x86")
+	g.Expect(migrated.Name).To(Equal("workers-c3.medium.x86"))
+	g.Expect(migrated.Namespace).To(Equal("default"))
+	g.Expect(migrated.Labels).To(Equal(template.Labels))
+	g.Expect(migrated.Annotations).To(Equal(map[string]string{
+		infrastructurev1alpha3.MaxHourlyCostAnnotation: "2",
+		infrastructurev1alpha3.MigratedFromAnnotation:  "workers",
+	}))
+	g.Expect(migrated.OwnerReferences).To(Equal(template.OwnerReferences))
+	g.Expect(migrated.Spec.Template.Spec.MachineType).To(Equal("c3.medium.x86"))
+	g.Expect(migrated.Spec.Template.Spec.OS).To(Equal("ubuntu_20_04"))
+	g.Expect(template.Spec.Template.Spec.MachineType).To(Equal("c3.small.x86"))
+
+	// migrating again replaces the suffix
+	g.Expect(PlanMigrationTemplate(migrated, "m3.large.x86").Name).To(Equal("workers-m3.large.x86"))
+	g.Expect(PlanMigrationTemplate(migrated, "m3.large.x86").Annotations).To(HaveKeyWithValue(infrastructurev1alpha3.MigratedFromAnnotation, "workers-c3.medium.x86"))
+}
+
+func TestMarkPlanMigration(t *testing.T) {
+	g := NewWithT(t)
+	template := &infrastructurev1alpha3.PacketMachineTemplate{
+		Status: infrastructurev1alpha3.PacketMachineTemplateStatus{
+			Migration: &infrastructurev1alpha3.PlanMigrationStatus{MachineDeployment: "workers", FromMachineType: "c3.small.x86", MachineType: "c3.medium.x86"},
+		},
+	}
+	md := &clusterv1.MachineDeployment{
+		Spec:   clusterv1.MachineDeploymentSpec{Replicas: pointer.Int32Ptr(3)},
+		Status: clusterv1.MachineDeploymentStatus{Replicas: 4, UpdatedReplicas: 1, AvailableReplicas: 3},
+	}
+
+	MarkPlanMigration(template, md)
+	g.Expect(template.Status.Migration.Replicas).To(BeEquivalentTo(3))
+	g.Expect(template.Status.Migration.UpdatedReplicas).To(BeEquivalentTo(1))
+	g.Expect(conditions.IsTrue(template, infrastructurev1alpha3.MachineDeploymentUpdatedCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(template, infrastructurev1alpha3.MachinesMigratedCondition)).To(Equal(infrastructurev1alpha3.RollingOutReason))
+	g.Expect(conditions.GetMessage(template, infrastructurev1alpha3.MachinesMigratedCondition)).To(Equal("1 of 3 machines on c3.medium.x86"))
+
+	// the old machines must be gone
+	md.Status = clusterv1.MachineDeploymentStatus{Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 4}
+	MarkPlanMigration(template, md)
+	g.Expect(conditions.IsTrue(template, infrastructurev1alpha3.MachinesMigratedCondition)).To(BeFalse())
+
+	md.Status = clusterv1.MachineDeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}
+	MarkPlanMigration(template, md)
+	g.Expect(conditions.IsTrue(template, infrastructurev1alpha3.MachinesMigratedCondition)).To(BeTrue())
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plural registers workload clusters with the Plural console, and
+// renders the Secret its deployment agent reads the deploy token of the
+// cluster from.
+package plural
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// TokenVarName is the environment variable holding the access token of
+	// the Plural console.
+	TokenVarName = "PLURAL_CONSOLE_TOKEN"
+
+	// AgentNamespace is the namespace of the deployment agent in the
+	// workload clusters.
+	AgentNamespace = "plrl-deploy-operator"
+	// AgentSecretName is the Secret of the agent namespace holding the url
+	// of the console and the deploy token of the cluster.
+	AgentSecretName = "plural-deploy-token"
+
+	// OwnerTag is the tag of the registered clusters holding the UID of the
+	// PacketCluster they were registered for.
+	OwnerTag = "packet-cluster-uid"
+
+	requestTimeout = 30 * time.Second
+)
+
+// Client is a client of the GraphQL API of a Plural console.
+type Client struct {
+	// URL is the url of the console, e.g. https://console.example.plural.sh.
+	URL   string
+	Token string
+
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client of the console at url, authenticated with
+// token.
+func NewClient(url, token string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(url, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Tag is a tag of a cluster registered in the console.
+type Tag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ClusterAttributes are the attributes a cluster is registered with.
+type ClusterAttributes struct {
+	Name   string `json:"name"`
+	Handle string `json:"handle"`
+	Tags   []Tag  `json:"tags,omitempty"`
+}
+
+// Cluster is a cluster registered in the console.
+type Cluster struct {
+	ID          string `json:"id"`
+	Handle      string `json:"handle"`
+	DeployToken string `json:"deployToken"`
+	Tags        []Tag  `json:"tags,omitempty"`
+}
+
+const clusterFields = "id handle deployToken tags { name value }"
+
+// graphQLError is an error the GraphQL API answered with.
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// do runs query with variables, and decodes its data into result.
+func (c *Client) do(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.URL+"/gql", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling the Plural console: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading the answer of the Plural console: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the Plural console answered %s", resp.Status)
+	}
+
+	answer := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphQLError  `json:"errors"`
+	}{}
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return fmt.Errorf("error decoding the answer of the Plural console: %w", err)
+	}
+	if len(answer.Errors) > 0 {
+		messages := make([]string, 0, len(answer.Errors))
+		for _, e := range answer.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("the Plural console answered: %s", strings.Join(messages, "; "))
+	}
+	return json.Unmarshal(answer.Data, result)
+}
+
+// GetCluster returns the cluster registered with handle, nil when there is
+// none.
+func (c *Client) GetCluster(ctx context.Context, handle string) (*Cluster, error) {
+	result := struct {
+		Cluster *Cluster `json:"cluster"`
+	}{}
+	query := "query Cluster($handle: String) { cluster(handle: $handle) { " + clusterFields + " } }"
+	if err := c.do(ctx, query, map[string]interface{}{"handle": handle}, &result); err != nil {
+		// the console reports the unknown handles as errors
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return result.Cluster, nil
+}
+
+// CreateCluster registers a cluster.
+func (c *Client) CreateCluster(ctx context.Context, attributes ClusterAttributes) (*Cluster, error) {
+	result := struct {
+		CreateCluster *Cluster `json:"createCluster"`
+	}{}
+	query := "mutation CreateCluster($attributes: ClusterAttributes!) { createCluster(attributes: $attributes) { " + clusterFields + " } }"
+	if err := c.do(ctx, query, map[string]interface{}{"attributes": attributes}, &result); err != nil {
+		return nil, err
+	}
+	if result.CreateCluster == nil {
+		return nil, fmt.Errorf("the Plural console did not return cluster %s", attributes.Handle)
+	}
+	return result.CreateCluster, nil
+}
+
+// RegisterCluster returns the cluster registered with the handle of
+// attributes, registering it first when there is none. An existing cluster is
+// only returned when it carries the OwnerTag of attributes, not to hand the
+// deploy token of a cluster registered for something else over.
+func (c *Client) RegisterCluster(ctx context.Context, attributes ClusterAttributes) (*Cluster, error) {
+	cluster, err := c.GetCluster(ctx, attributes.Handle)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return c.CreateCluster(ctx, attributes)
+	}
+	if owner := tagValue(attributes.Tags, OwnerTag); owner == "" || tagValue(cluster.Tags, OwnerTag) != owner {
+		return nil, fmt.Errorf("handle %s is registered for another cluster", attributes.Handle)
+	}
+	return cluster, nil
+}
+
+// DeregisterCluster deletes the registered cluster with the given id. A
+// cluster already gone is not an error.
+func (c *Client) DeregisterCluster(ctx context.Context, id string) error {
+	result := struct {
+		DeleteCluster *struct {
+			ID string `json:"id"`
+		} `json:"deleteCluster"`
+	}{}
+	query := "mutation DeleteCluster($id: ID!) { deleteCluster(id: $id) { id } }"
+	if err := c.do(ctx, query, map[string]interface{}{"id": id}, &result); err != nil && !strings.Contains(err.Error(), "not found") {
+		return err
+	}
+	return nil
+}
+
+func tagValue(tags []Tag, name string) string {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// AgentManifests returns the manifests of the namespace of the deployment
+// agent and of the Secret holding the url of the console and the deploy
+// token of the cluster, for the agent to be installed with.
+func AgentManifests(consoleURL, deployToken string) (string, error) {
+	namespace := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: AgentNamespace},
+	}
+	secret := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: AgentNamespace, Name: AgentSecretName},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"consoleUrl":  strings.TrimSuffix(consoleURL, "/"),
+			"deployToken": deployToken,
+		},
+	}
+
+	manifests := []string{}
+	for _, object := range []interface{}{namespace, secret} {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return "", err
+		}
+		manifests = append(manifests, string(data))
+	}
+	return strings.Join(manifests, "---\n"), nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plural
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeConsole answers the queries it gets with the answers of their
+// operation, and records them.
+type fakeConsole struct {
+	answers map[string]string
+	queries []map[string]interface{}
+}
+
+func newFakeConsole(t *testing.T, answers map[string]string) (*fakeConsole, *Client) {
+	console := &fakeConsole{answers: answers}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/gql" || r.Header.Get("Authorization") != "Token token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		query := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&query)
+		console.queries = append(console.queries, query)
+		for operation, answer := range console.answers {
+			if strings.Contains(query["query"].(string), operation) {
+				_, _ = w.Write([]byte(answer))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(server.Close)
+	return console, NewClient(server.URL+"/", "token")
+}
+
+func TestRegisterClusterExisting(t *testing.T) {
+	g := NewWithT(t)
+	console, c := newFakeConsole(t, map[string]string{
+		"query Cluster": `{"data":{"cluster":{"id":"id","handle":"prod","deployToken":"deploy","tags":[{"name":"packet-cluster-uid","value":"uid"}]}}}`,
+	})
+
+	owner := []Tag{{Name: OwnerTag, Value: "uid"}}
+	cluster, err := c.RegisterCluster(context.Background(), ClusterAttributes{Name: "capi", Handle: "prod", Tags: owner})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cluster).To(Equal(&Cluster{ID: "id", Handle: "prod", DeployToken: "deploy", Tags: owner}))
+	g.Expect(console.queries).To(HaveLen(1))
+	g.Expect(console.queries[0]["variables"]).To(Equal(map[string]interface{}{"handle": "prod"}))
+
+	// a cluster registered for another PacketCluster is not handed over
+	_, err = c.RegisterCluster(context.Background(), ClusterAttributes{Name: "capi", Handle: "prod", Tags: []Tag{{Name: OwnerTag, Value: "other"}}})
+	g.Expect(err).To(MatchError("handle prod is registered for another cluster"))
+	_, err = c.RegisterCluster(context.Background(), ClusterAttributes{Name: "capi", Handle: "prod"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDeregisterCluster(t *testing.T) {
+	g := NewWithT(t)
+	console, c := newFakeConsole(t, map[string]string{
+		"mutation DeleteCluster": `{"data":{"deleteCluster":{"id":"id"}}}`,
+	})
+
+	g.Expect(c.DeregisterCluster(context.Background(), "id")).To(Succeed())
+	g.Expect(console.queries).To(HaveLen(1))
+	g.Expect(console.queries[0]["variables"]).To(Equal(map[string]interface{}{"id": "id"}))
+
+	console.answers["mutation DeleteCluster"] = `{"data":null,"errors":[{"message":"could not find resource: not found"}]}`
+	g.Expect(c.DeregisterCluster(context.Background(), "id")).To(Succeed())
+}
+
+func TestRegisterClusterNew(t *testing.T) {
+	g := NewWithT(t)
+	console, c := newFakeConsole(t, map[string]string{
+		"query Cluster":          `{"data":{"cluster":null},"errors":[{"message":"could not find resource: not found"}]}`,
+		"mutation CreateCluster": `{"data":{"createCluster":{"id":"id","handle":"prod","deployToken":"deploy"}}}`,
+	})
+
+	cluster, err := c.RegisterCluster(context.Background(), ClusterAttributes{Name: "capi", Handle: "prod", Tags: []Tag{{Name: "namespace", Value: "default"}}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cluster.ID).To(Equal("id"))
+	g.Expect(console.queries).To(HaveLen(2))
+	g.Expect(console.queries[1]["variables"]).To(Equal(map[string]interface{}{
+		"attributes": map[string]interface{}{
+			"name":   "capi",
+			"handle": "prod",
+			"tags":   []interface{}{map[string]interface{}{"name": "namespace", "value": "default"}},
+		},
+	}))
+}
+
+func TestRegisterClusterErrors(t *testing.T) {
+	g := NewWithT(t)
+	_, c := newFakeConsole(t, map[string]string{
+		"query Cluster":          `{"data":{"cluster":null}}`,
+		"mutation CreateCluster": `{"data":null,"errors":[{"message":"forbidden"},{"message":"handle taken"}]}`,
+	})
+
+	_, err := c.RegisterCluster(context.Background(), ClusterAttributes{Name: "capi", Handle: "prod"})
+	g.Expect(err).To(MatchError("the Plural console answered: forbidden; handle taken"))
+
+	c.Token = "wrong"
+	_, err = c.GetCluster(context.Background(), "prod")
+	g.Expect(err).To(MatchError(ContainSubstring("the Plural console answered 401")))
+}
+
+func TestAgentManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	manifests, err := AgentManifests("https://console.example.plural.sh/", "deploy")
+	g.Expect(err).NotTo(HaveOccurred())
+	documents := strings.Split(manifests, "---\n")
+	g.Expect(documents).To(HaveLen(2))
+	g.Expect(documents[0]).To(ContainSubstring("kind: Namespace"))
+
+	secret := &corev1.Secret{}
+	g.Expect(yaml.Unmarshal([]byte(documents[1]), secret)).To(Succeed())
+	g.Expect(secret.Namespace).To(Equal(AgentNamespace))
+	g.Expect(secret.Name).To(Equal(AgentSecretName))
+	g.Expect(secret.StringData).To(Equal(map[string]string{
+		"consoleUrl":  "https://console.example.plural.sh",
+		"deployToken": "deploy",
+	}))
+}
@@ -0,0 +1,376 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+	"github.com/prometheus/client_golang/prometheus"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DefaultRateWarningThreshold is the share of the rate limit window left
+// under which the clients of a ClientPool log a warning.
+const DefaultRateWarningThreshold = 0.1
+
+// HTTPOptions tunes the HTTP clients of the Packet clients, so that an API
+// slow to answer fails the reconciliations quickly instead of tying up the
+// workers of the controllers.
+type HTTPOptions struct {
+	// Timeout bounds every API request, reading the response included. 0
+	// disables it.
+	Timeout time.Duration
+	// DialTimeout bounds establishing a connection to the API.
+	DialTimeout time.Duration
+	// KeepAlive is the interval of the TCP keep-alive probes of the
+	// connections to the API.
+	KeepAlive time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake of a connection.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the headers of a response
+	// once the request is written. 0 disables it.
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is the number of idle connections kept open to the
+	// API, shared by the workers of the controllers.
+	MaxIdleConnsPerHost int
+}
+
+// DefaultHTTPOptions are the HTTP options of the clients of a ClientPool.
+var DefaultHTTPOptions = HTTPOptions{
+	Timeout:               time.Minute,
+	DialTimeout:           30 * time.Second,
+	KeepAlive:             30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	IdleConnTimeout:       90 * time.Second,
+	MaxIdleConnsPerHost:   10,
+}
+
+// transport returns a transport with the options, the settings of
+// http.DefaultTransport otherwise.
+func (o HTTPOptions) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: o.KeepAlive}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	transport.IdleConnTimeout = o.IdleConnTimeout
+	transport.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	return transport
+}
+
+var (
+	poolClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "capp_packet_client_pool_clients",
+		Help: "Number of Packet clients in the client pool.",
+	})
+	poolLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "capp_packet_client_pool_lookups_total",
+		Help: "Lookups of the client pool, by result: hit or miss.",
+	}, []string{"result"})
+	poolEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "capp_packet_client_pool_evictions_total",
+		Help: "Clients evicted from the client pool after being idle.",
+	})
+	apiRequestsRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capp_packet_api_requests_remaining",
+		Help: "Requests left to a credential in the current rate limit window of the Packet API.",
+	}, []string{"credential"})
+	apiRequestsLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capp_packet_api_requests_limit",
+		Help: "Requests allowed to a credential in a rate limit window of the Packet API.",
+	}, []string{"credential"})
+	apiRateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "capp_packet_api_rate_limit_reset_timestamp_seconds",
+		Help: "Unix time at which the current rate limit window of a credential of the Packet API resets.",
+	}, []string{"credential"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(poolClients, poolLookups, poolEvictions, apiRequestsRemaining, apiRequestsLimit, apiRateLimitReset)
+}
+
+// ClientPool shares the Packet clients of the credentials the controllers
+// work with, keyed by the digest of the API key and the API base url. The
+// clients of a credential, and the copies WithContext and WithHeaders make of
+// them, share their connections and their rate limit state. Clients not looked
+// up for IdleTimeout are evicted.
+type ClientPool struct {
+	// IdleTimeout is how long a client is kept without being looked up.
+	IdleTimeout time.Duration
+	// Headers are added to the requests of every client, see WithHeaders.
+	Headers http.Header
+	// RateWarningThreshold is the share of the rate limit window left under
+	// which a warning is logged, 0 disables the warnings.
+	RateWarningThreshold float64
+	// DeviceCacheTTL is how long the active devices read by a client are
+	// served from its cache, 0 disables the cache.
+	DeviceCacheTTL time.Duration
+	// HTTP tunes the HTTP clients of the clients created from then on.
+	HTTP HTTPOptions
+	// OAuth, when set, has GetClient return a client authenticating with the
+	// short lived access tokens of the configuration instead of an API key.
+	OAuth *OAuthConfig
+
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+	now     func() time.Time
+}
+
+type pooledClient struct {
+	client   *PacketClient
+	lastUsed time.Time
+}
+
+// NewClientPool returns an empty client pool.
+func NewClientPool(idleTimeout time.Duration, headers http.Header) *ClientPool {
+	return &ClientPool{
+		IdleTimeout:          idleTimeout,
+		Headers:              headers,
+		RateWarningThreshold: DefaultRateWarningThreshold,
+		DeviceCacheTTL:       DefaultDeviceCacheTTL,
+		HTTP:                 DefaultHTTPOptions,
+		clients:              map[string]*pooledClient{},
+		now:                  time.Now,
+	}
+}
+
+// GetClient returns the client of the OAuth configuration of the pool, or
+// else of the API key of the PACKET_API_KEY environment variable.
+func (p *ClientPool) GetClient() (*PacketClient, error) {
+	if p.OAuth != nil {
+		return p.GetOAuth(*p.OAuth, "")
+	}
+	token := os.Getenv(apiTokenVarName)
+	if token == "" {
+		return nil, fmt.Errorf("env var %s is required", apiTokenVarName)
+	}
+	return p.Get(token, "")
+}
+
+// Get returns the client of an API key, created on first use. An empty
+// baseURL is the default Packet API.
+func (p *ClientPool) Get(apiKey, baseURL string) (*PacketClient, error) {
+	apiKey = strings.TrimSpace(apiKey)
+	if apiKey == "" {
+		return nil, fmt.Errorf("an API key is required")
+	}
+	return p.get(credentialKey(apiKey, baseURL), func() (*PacketClient, error) {
+		return newCredentialClient(credentialID(apiKey), apiKey, baseURL, nil, p.Headers, p.RateWarningThreshold, p.DeviceCacheTTL, p.HTTP)
+	})
+}
+
+// GetOAuth returns the client of an OAuth configuration, created on first
+// use. Its clients share the access token, refreshed as it expires.
+func (p *ClientPool) GetOAuth(config OAuthConfig, baseURL string) (*PacketClient, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	credential := config.credential()
+	return p.get(credential+"@"+baseURL, func() (*PacketClient, error) {
+		tokenClient := &http.Client{Transport: p.HTTP.transport(), Timeout: p.HTTP.Timeout}
+		source := NewOAuthTokenSource(config, tokenClient)
+		return newCredentialClient(credential, "", baseURL, source, p.Headers, p.RateWarningThreshold, p.DeviceCacheTTL, p.HTTP)
+	})
+}
+
+// get returns the client of key, created with create on first use.
+func (p *ClientPool) get(key string, create func() (*PacketClient, error)) (*PacketClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pooled, ok := p.clients[key]; ok {
+		pooled.lastUsed = p.now()
+		poolLookups.WithLabelValues("hit").Inc()
+		return pooled.client, nil
+	}
+	poolLookups.WithLabelValues("miss").Inc()
+
+	c, err := create()
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = &pooledClient{client: c, lastUsed: p.now()}
+	poolClients.Set(float64(len(p.clients)))
+	return c, nil
+}
+
+// Start implements manager.Runnable, it evicts the idle clients.
+func (p *ClientPool) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(p.IdleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			p.evictIdle()
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica
+// has its own pool.
+func (p *ClientPool) NeedLeaderElection() bool {
+	return false
+}
+
+// evictIdle removes the clients not looked up for IdleTimeout and returns how
+// many were. The callers still holding them keep working with them.
+func (p *ClientPool) evictIdle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	evicted := 0
+	for key, pooled := range p.clients {
+		if p.now().Sub(pooled.lastUsed) >= p.IdleTimeout {
+			delete(p.clients, key)
+			evicted++
+		}
+	}
+	poolEvictions.Add(float64(evicted))
+	poolClients.Set(float64(len(p.clients)))
+	return evicted
+}
+
+// credentialKey identifies a credential without holding its API key.
+func credentialKey(apiKey, baseURL string) string {
+	return credentialID(apiKey) + "@" + baseURL
+}
+
+// credentialID is the short digest of an API key, safe to log and to use as a
+// metric label.
+func credentialID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// newCredentialClient creates the client of a credential, tracking its rate
+// limit state and caching its active devices for deviceCacheTTL. Its
+// connections are tuned by httpOptions. With a token source, the client
+// authenticates with its access tokens instead of apiKey.
+func newCredentialClient(credential, apiKey, baseURL string, source *OAuthTokenSource, headers http.Header, warningThreshold float64, deviceCacheTTL time.Duration, httpOptions HTTPOptions) (*PacketClient, error) {
+	rate := &APIRate{credential: credential, warningThreshold: warningThreshold}
+	var base http.RoundTripper = httpOptions.transport()
+	if source != nil {
+		base = &oauthTransport{base: base, source: source}
+	}
+	transport := &rateTransport{base: base, rate: rate}
+	httpClient := &http.Client{Transport: transport, Timeout: httpOptions.Timeout}
+
+	var c *packngo.Client
+	if baseURL == "" {
+		c = packngo.NewClientWithAuth(clientName, apiKey, httpClient)
+	} else {
+		var err error
+		if c, err = packngo.NewClientWithBaseURL(clientName, apiKey, httpClient, baseURL); err != nil {
+			return nil, err
+		}
+	}
+	client := &PacketClient{Client: c, transport: transport, timeout: httpOptions.Timeout, rate: rate, devices: newDeviceCache(deviceCacheTTL)}
+	if len(headers) > 0 {
+		return client.WithHeaders(headers)
+	}
+	return client, nil
+}
+
+// APIRate is the rate limit state of a credential, shared by its clients.
+type APIRate struct {
+	credential string
+	// warningThreshold is the share of the window left under which a
+	// warning is logged, once per window.
+	warningThreshold float64
+
+	mu     sync.RWMutex
+	rate   packngo.Rate
+	warned bool
+}
+
+// Get returns the rate limit state reported by the latest API response.
+func (r *APIRate) Get() packngo.Rate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rate
+}
+
+func (r *APIRate) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	rate := packngo.Rate{RequestLimit: limit, RequestsRemaining: remaining}
+	if reset, _ := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); reset != 0 {
+		rate.Reset = packngo.Timestamp{Time: time.Unix(reset, 0)}
+	}
+
+	r.mu.Lock()
+	r.rate = rate
+	warn := false
+	if r.low(rate) {
+		warn, r.warned = !r.warned, true
+	} else {
+		r.warned = false
+	}
+	r.mu.Unlock()
+
+	apiRequestsRemaining.WithLabelValues(r.credential).Set(float64(remaining))
+	if limit > 0 {
+		apiRequestsLimit.WithLabelValues(r.credential).Set(float64(limit))
+	}
+	if !rate.Reset.IsZero() {
+		apiRateLimitReset.WithLabelValues(r.credential).Set(float64(rate.Reset.Unix()))
+	}
+	if warn {
+		logf.Log.WithName("packet-client").Info("Packet API rate limit almost exhausted, reconciliations will start failing",
+			"credential", r.credential, "remaining", remaining, "limit", limit, "reset", rate.Reset.Time)
+	}
+}
+
+// low returns whether less than the warning threshold of the window of rate
+// is left. Without a known limit it never is.
+func (r *APIRate) low(rate packngo.Rate) bool {
+	if r.warningThreshold <= 0 || rate.RequestLimit <= 0 {
+		return false
+	}
+	return float64(rate.RequestsRemaining) < r.warningThreshold*float64(rate.RequestLimit)
+}
+
+// rateTransport records the rate limit state of the responses it gets.
+type rateTransport struct {
+	base http.RoundTripper
+	rate *APIRate
+}
+
+func (t *rateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.rate.update(resp.Header)
+	}
+	return resp, err
+}
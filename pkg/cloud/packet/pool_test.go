@@ -0,0 +1,178 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestClientPoolGet(t *testing.T) {
+	g := NewWithT(t)
+	pool := NewClientPool(time.Minute, nil)
+
+	const workers = 10
+	clients := make([]*PacketClient, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := pool.Get("token", "https://api.example.com/")
+			g.Expect(err).NotTo(HaveOccurred())
+			clients[i] = c
+		}(i)
+	}
+	wg.Wait()
+	for _, c := range clients {
+		g.Expect(c).To(BeIdenticalTo(clients[0]))
+	}
+	g.Expect(clients[0].APIKey).To(Equal("token"))
+	g.Expect(clients[0].BaseURL.String()).To(Equal("https://api.example.com/"))
+
+	other, err := pool.Get("other-token", "https://api.example.com/")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(other).NotTo(BeIdenticalTo(clients[0]))
+	otherURL, err := pool.Get("token", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(otherURL).NotTo(BeIdenticalTo(clients[0]))
+	g.Expect(pool.clients).To(HaveLen(3))
+
+	_, err = pool.Get(" ", "")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestClientPoolKeyHoldsNoAPIKey(t *testing.T) {
+	g := NewWithT(t)
+	key := credentialKey("secret-token", "https://api.example.com/")
+	g.Expect(key).NotTo(ContainSubstring("secret-token"))
+	g.Expect(key).To(HaveSuffix("@https://api.example.com/"))
+	g.Expect(credentialKey("secret-token", "")).NotTo(Equal(credentialKey("other-token", "")))
+}
+
+func TestClientPoolEvictIdle(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Now()
+	pool := NewClientPool(time.Hour, nil)
+	pool.now = func() time.Time { return now }
+
+	idle, err := pool.Get("idle", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	now = now.Add(40 * time.Minute)
+	_, err = pool.Get("busy", "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	now = now.Add(30 * time.Minute)
+	g.Expect(pool.evictIdle()).To(Equal(1))
+	g.Expect(pool.clients).To(HaveLen(1))
+
+	recreated, err := pool.Get("idle", "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(recreated).NotTo(BeIdenticalTo(idle))
+}
+
+func TestClientPoolSharedRate(t *testing.T) {
+	g := NewWithT(t)
+	api, fake := newFakeAPI(t)
+	api.on("GET", "/devices/device", fakeResponse{
+		status: http.StatusOK,
+		header: http.Header{"X-Ratelimit-Limit": {"100"}, "X-Ratelimit-Remaining": {"42"}},
+		body:   map[string]string{"id": "device"},
+	})
+
+	pool := NewClientPool(time.Hour, http.Header{"X-Gateway": {"capp"}})
+	c, err := pool.Get("token", fake.BaseURL.String())
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// the copies of the client share the rate limit state of the credential
+	copied, err := c.WithHeaders(http.Header{"X-Other": {"value"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = copied.GetDevice("device")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(c.rate.Get().RequestLimit).To(Equal(100))
+	g.Expect(c.rate.Get().RequestsRemaining).To(Equal(42))
+
+	_, err = c.GetDevice("device")
+	g.Expect(err).NotTo(HaveOccurred())
+	requests := api.requestsTo("GET", "/devices/device")
+	g.Expect(requests).To(HaveLen(2))
+	g.Expect(requests[1].Header.Get("X-Gateway")).To(Equal("capp"))
+}
+
+func TestClientPoolHTTPOptions(t *testing.T) {
+	g := NewWithT(t)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	pool := NewClientPool(time.Hour, nil)
+	pool.HTTP.Timeout = 100 * time.Millisecond
+	pool.HTTP.MaxIdleConnsPerHost = 20
+	c, err := pool.Get("token", server.URL+"/")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	transport := c.transport.(*rateTransport).base.(*http.Transport)
+	g.Expect(transport.MaxIdleConnsPerHost).To(Equal(20))
+	g.Expect(transport.TLSHandshakeTimeout).To(Equal(DefaultHTTPOptions.TLSHandshakeTimeout))
+	g.Expect(transport.ResponseHeaderTimeout).To(Equal(DefaultHTTPOptions.ResponseHeaderTimeout))
+
+	// the requests of the client and its copies give up on a hanging API
+	_, err = c.GetDevice("device")
+	g.Expect(err).To(HaveOccurred())
+	copied, err := c.WithHeaders(http.Header{"X-Other": {"value"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(copied.timeout).To(Equal(100 * time.Millisecond))
+	_, err = copied.GetDevice("device")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestAPIRateWarnsOncePerWindow(t *testing.T) {
+	g := NewWithT(t)
+	rate := &APIRate{credential: "credential", warningThreshold: 0.1}
+	header := func(remaining string) http.Header {
+		return http.Header{"X-Ratelimit-Limit": {"100"}, "X-Ratelimit-Remaining": {remaining}, "X-Ratelimit-Reset": {"1700000000"}}
+	}
+
+	rate.update(header("50"))
+	g.Expect(rate.warned).To(BeFalse())
+	g.Expect(rate.Get().Reset.Unix()).To(Equal(int64(1700000000)))
+
+	rate.update(header("9"))
+	g.Expect(rate.warned).To(BeTrue())
+	g.Expect(rate.low(rate.Get())).To(BeTrue())
+
+	// a new window clears the warning
+	rate.update(header("100"))
+	g.Expect(rate.warned).To(BeFalse())
+
+	// without a limit the remaining requests can not be compared
+	rate.update(http.Header{"X-Ratelimit-Remaining": {"1"}})
+	g.Expect(rate.warned).To(BeFalse())
+
+	disabled := &APIRate{credential: "credential"}
+	disabled.update(header("1"))
+	g.Expect(disabled.warned).To(BeFalse())
+}
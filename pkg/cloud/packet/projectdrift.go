@@ -0,0 +1,215 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// ProjectSettingsService reads the settings of a project the clusters in it
+// rely on.
+type ProjectSettingsService interface {
+	GetProjectSettings(projectID string) (*ProjectSettings, error)
+}
+
+// ProjectSettings are the settings of a project the clusters in it rely on
+// but the controller does not manage.
+type ProjectSettings struct {
+	// BGPConfig is nil when BGP is not enabled on the project.
+	BGPConfig      *packngo.BGPConfig
+	IPReservations []packngo.IPAddressReservation
+	SSHKeys        []packngo.SSHKey
+}
+
+// needsBGP returns whether the machines of a cluster announce addresses over
+// BGP.
+func needsBGP(spec infrastructurev1alpha3.PacketClusterSpec) bool {
+	return spec.BGP != nil || spec.KubeVIP != nil && KubeVIPMode(spec) == infrastructurev1alpha3.KubeVIPModeBGP
+}
+
+// ReliesOnProjectSettings returns whether a cluster relies on settings of its
+// project the controller does not manage, which are then verified.
+func ReliesOnProjectSettings(spec infrastructurev1alpha3.PacketClusterSpec) bool {
+	return needsBGP(spec) || spec.ProjectRequirements != nil
+}
+
+// ProjectIPTypeOf returns the type of an ip reservation, empty for the global
+// ones.
+func ProjectIPTypeOf(ip packngo.IPAddressReservation) infrastructurev1alpha3.ProjectIPType {
+	switch {
+	case ip.Global != nil && *ip.Global:
+		return ""
+	case ip.AddressFamily == 6:
+		return infrastructurev1alpha3.ProjectIPTypePublicIPv6
+	case ip.Public:
+		return infrastructurev1alpha3.ProjectIPTypePublicIPv4
+	default:
+		return infrastructurev1alpha3.ProjectIPTypePrivateIPv4
+	}
+}
+
+// inClusterLocation reports whether an ip reservation is in the metro, or
+// facility, of a cluster. Every reservation is for the clusters setting
+// neither.
+func inClusterLocation(ip packngo.IPAddressReservation, spec infrastructurev1alpha3.PacketClusterSpec) bool {
+	switch {
+	case spec.Metro != "":
+		return ip.Metro != nil && ip.Metro.Code == spec.Metro || ip.Facility != nil && ip.Facility.Metro != nil && ip.Facility.Metro.Code == spec.Metro
+	case spec.Facility != "":
+		return ip.Facility != nil && ip.Facility.Code == spec.Facility
+	}
+	return true
+}
+
+// ProjectSettingsDrift returns how the settings of the project of a cluster
+// differ from what the cluster relies on, in a stable order, empty when they
+// do not.
+func ProjectSettingsDrift(spec infrastructurev1alpha3.PacketClusterSpec, settings *ProjectSettings) []string {
+	drift := []string{}
+	if needsBGP(spec) && settings.BGPConfig == nil {
+		drift = append(drift, "BGP is not enabled on the project")
+	}
+
+	requirements := spec.ProjectRequirements
+	if requirements == nil {
+		return drift
+	}
+	types := map[infrastructurev1alpha3.ProjectIPType]bool{}
+	for _, ip := range settings.IPReservations {
+		if inClusterLocation(ip, spec) {
+			types[ProjectIPTypeOf(ip)] = true
+		}
+	}
+	for _, ipType := range requirements.IPTypes {
+		if !types[ipType] {
+			drift = append(drift, fmt.Sprintf("the project has no %s ip reservation in %s", ipType, clusterLocation(spec)))
+		}
+	}
+
+	labels := map[string]bool{}
+	for _, key := range settings.SSHKeys {
+		labels[key.Label] = true
+	}
+	missing := []string{}
+	for _, label := range requirements.SSHKeys {
+		if !labels[label] {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		drift = append(drift, fmt.Sprintf("the project has no SSH key labelled %s", strings.Join(missing, ", ")))
+	}
+	return drift
+}
+
+// clusterLocation returns the metro of a cluster, or its facility, for
+// messages.
+func clusterLocation(spec infrastructurev1alpha3.PacketClusterSpec) string {
+	switch {
+	case spec.Metro != "":
+		return "metro " + spec.Metro
+	case spec.Facility != "":
+		return "facility " + spec.Facility
+	}
+	return "any location"
+}
+
+// GetProjectSettings reads the BGP configuration, the ip reservations and the
+// SSH keys of a project.
+func (p *PacketClient) GetProjectSettings(projectID string) (*ProjectSettings, error) {
+	config, err := p.GetBGPConfig(projectID)
+	if err != nil {
+		return nil, err
+	}
+	ips, _, err := p.ProjectIPs.List(projectID, &packngo.ListOptions{Includes: []string{"facility", "metro"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the ip reservations of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	keys, _, err := p.SSHKeys.ProjectList(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the ssh keys of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	return &ProjectSettings{BGPConfig: config, IPReservations: ips, SSHKeys: keys}, nil
+}
+
+// ProjectDriftChecker verifies the settings of the projects of the clusters.
+// The result of every cluster is cached for Interval, or until its spec
+// changes, so that reconciling many clusters does not eat into the API rate
+// limit.
+type ProjectDriftChecker struct {
+	Client   ProjectSettingsService
+	Interval time.Duration
+
+	mu       sync.Mutex
+	clusters map[string]checkedDrift
+	now      func() time.Time
+}
+
+type checkedDrift struct {
+	generation int64
+	drift      []string
+	checkedAt  time.Time
+}
+
+// NewProjectDriftChecker returns a ProjectDriftChecker caching its results
+// for interval.
+func NewProjectDriftChecker(client ProjectSettingsService, interval time.Duration) *ProjectDriftChecker {
+	return &ProjectDriftChecker{
+		Client:   client,
+		Interval: interval,
+		clusters: map[string]checkedDrift{},
+		now:      time.Now,
+	}
+}
+
+// Check returns the drift of the project of the cluster identified by key,
+// as ProjectSettingsDrift, checked at most once per Interval for the
+// generation of its spec. Errors are not cached.
+func (c *ProjectDriftChecker) Check(key string, generation int64, spec infrastructurev1alpha3.PacketClusterSpec) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if checked, ok := c.clusters[key]; ok && checked.generation == generation && now.Sub(checked.checkedAt) < c.Interval {
+		return checked.drift, nil
+	}
+
+	settings, err := c.Client.GetProjectSettings(spec.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	drift := ProjectSettingsDrift(spec, settings)
+	c.clusters[key] = checkedDrift{generation: generation, drift: drift, checkedAt: now}
+	return drift, nil
+}
+
+// Forget drops the result cached for the cluster identified by key.
+func (c *ProjectDriftChecker) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clusters, key)
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestProjectIPTypeOf(t *testing.T) {
+	g := NewWithT(t)
+	global := true
+	ip := func(family int, public bool) packngo.IPAddressReservation {
+		return packngo.IPAddressReservation{IpAddressCommon: packngo.IpAddressCommon{AddressFamily: family, Public: public}}
+	}
+
+	g.Expect(ProjectIPTypeOf(ip(4, true))).To(Equal(infrastructurev1alpha3.ProjectIPTypePublicIPv4))
+	g.Expect(ProjectIPTypeOf(ip(4, false))).To(Equal(infrastructurev1alpha3.ProjectIPTypePrivateIPv4))
+	g.Expect(ProjectIPTypeOf(ip(6, true))).To(Equal(infrastructurev1alpha3.ProjectIPTypePublicIPv6))
+	globalIP := ip(4, true)
+	globalIP.Global = &global
+	g.Expect(ProjectIPTypeOf(globalIP)).To(BeEmpty())
+}
+
+func TestProjectSettingsDrift(t *testing.T) {
+	ip := func(family int, public bool, metro string) packngo.IPAddressReservation {
+		return packngo.IPAddressReservation{IpAddressCommon: packngo.IpAddressCommon{AddressFamily: family, Public: public, Metro: &packngo.Metro{Code: metro}}}
+	}
+	settings := &ProjectSettings{
+		BGPConfig:      &packngo.BGPConfig{ID: "config", Status: "enabled"},
+		IPReservations: []packngo.IPAddressReservation{ip(4, true, "sv"), ip(4, false, "sv"), ip(6, true, "da")},
+		SSHKeys:        []packngo.SSHKey{{Label: "ops"}, {Label: "ci"}},
+	}
+	requirements := &infrastructurev1alpha3.ProjectRequirements{
+		IPTypes: []infrastructurev1alpha3.ProjectIPType{infrastructurev1alpha3.ProjectIPTypePrivateIPv4},
+		SSHKeys: []string{"ops"},
+	}
+
+	tests := []struct {
+		name     string
+		spec     infrastructurev1alpha3.PacketClusterSpec
+		settings *ProjectSettings
+		want     []string
+	}{
+		{
+			name:     "nothing relied on",
+			settings: &ProjectSettings{},
+			want:     []string{},
+		},
+		{
+			name:     "settings in place",
+			spec:     infrastructurev1alpha3.PacketClusterSpec{Metro: "sv", BGP: &infrastructurev1alpha3.BGPConfig{}, ProjectRequirements: requirements},
+			settings: settings,
+			want:     []string{},
+		},
+		{
+			name:     "bgp disabled with kube-vip announcing over bgp",
+			spec:     infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{Mode: infrastructurev1alpha3.KubeVIPModeBGP}},
+			settings: &ProjectSettings{},
+			want:     []string{"BGP is not enabled on the project"},
+		},
+		{
+			name:     "kube-vip announcing over arp",
+			spec:     infrastructurev1alpha3.PacketClusterSpec{KubeVIP: &infrastructurev1alpha3.KubeVIPConfig{}},
+			settings: &ProjectSettings{},
+			want:     []string{},
+		},
+		{
+			name: "ip types missing in the metro",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "sv", ProjectRequirements: &infrastructurev1alpha3.ProjectRequirements{
+				IPTypes: []infrastructurev1alpha3.ProjectIPType{infrastructurev1alpha3.ProjectIPTypePublicIPv4, infrastructurev1alpha3.ProjectIPTypePublicIPv6},
+			}},
+			settings: settings,
+			want:     []string{"the project has no public_ipv6 ip reservation in metro sv"},
+		},
+		{
+			name: "ssh keys deleted",
+			spec: infrastructurev1alpha3.PacketClusterSpec{ProjectRequirements: &infrastructurev1alpha3.ProjectRequirements{
+				SSHKeys: []string{"oncall", "ops", "backup"},
+			}},
+			settings: settings,
+			want:     []string{"the project has no SSH key labelled backup, oncall"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(ProjectSettingsDrift(tt.spec, tt.settings)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestGetProjectSettings(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/bgp-config", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"id": "config", "status": "enabled"}})
+	api.on(http.MethodGet, "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"ip_addresses": []map[string]interface{}{{"id": "private", "address_family": 4, "public": false, "metro": map[string]string{"code": "sv"}}},
+	}})
+	api.on(http.MethodGet, "/projects/project/ssh-keys", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"ssh_keys": []map[string]string{{"id": "key", "label": "ops"}},
+	}})
+
+	settings, err := c.GetProjectSettings("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(settings.BGPConfig.ID).To(Equal("config"))
+	g.Expect(settings.IPReservations).To(HaveLen(1))
+	g.Expect(settings.IPReservations[0].Metro.Code).To(Equal("sv"))
+	g.Expect(settings.SSHKeys[0].Label).To(Equal("ops"))
+
+	_, err = c.GetProjectSettings("other")
+	g.Expect(err).To(MatchError(ContainSubstring("failed to list the ip reservations of project other")))
+}
+
+// fakeProjectSettings serves the settings of every project and counts the
+// reads.
+type fakeProjectSettings struct {
+	settings *ProjectSettings
+	err      error
+	reads    int
+}
+
+func (f *fakeProjectSettings) GetProjectSettings(projectID string) (*ProjectSettings, error) {
+	f.reads++
+	return f.settings, f.err
+}
+
+func TestProjectDriftChecker(t *testing.T) {
+	g := NewWithT(t)
+	service := &fakeProjectSettings{settings: &ProjectSettings{}}
+	checker := NewProjectDriftChecker(service, 10*time.Minute)
+	now := time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+	spec := infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", BGP: &infrastructurev1alpha3.BGPConfig{}}
+
+	drift, err := checker.Check("uid", 1, spec)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drift).To(Equal([]string{"BGP is not enabled on the project"}))
+
+	// the result is cached for the generation of the spec
+	service.settings = &ProjectSettings{BGPConfig: &packngo.BGPConfig{ID: "config"}}
+	drift, _ = checker.Check("uid", 1, spec)
+	g.Expect(drift).To(HaveLen(1))
+	g.Expect(service.reads).To(Equal(1))
+	drift, _ = checker.Check("uid", 2, spec)
+	g.Expect(drift).To(BeEmpty())
+	g.Expect(service.reads).To(Equal(2))
+
+	now = now.Add(10 * time.Minute)
+	_, _ = checker.Check("uid", 2, spec)
+	g.Expect(service.reads).To(Equal(3))
+
+	checker.Forget("uid")
+	_, _ = checker.Check("uid", 2, spec)
+	g.Expect(service.reads).To(Equal(4))
+
+	// errors are not cached
+	checker.Forget("uid")
+	service.err = errors.New("rate limited")
+	_, err = checker.Check("uid", 2, spec)
+	g.Expect(err).To(HaveOccurred())
+	service.err = nil
+	_, err = checker.Check("uid", 2, spec)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(service.reads).To(Equal(6))
+}
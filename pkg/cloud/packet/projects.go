@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// ProjectService creates the projects dedicated to a cluster and deletes them
+// with the cluster.
+type ProjectService interface {
+	EnsureClusterProject(organizationID, name string) (*packngo.Project, error)
+	DeleteClusterProject(projectID, name string) (int, error)
+}
+
+// DedicatedProjectName returns the name of the project dedicated to a
+// cluster. The name is how the controller recognizes the project as its own:
+// it adopts a project with that name left behind by a failed update of the
+// cluster, and only deletes projects with that name. The namespace and name
+// make it readable, the digest of clusterUID, see ClusterUID, makes it only
+// match the projects of the cluster: the namespace and name alone are
+// ambiguous once joined, and a deleted cluster with the same ones may have
+// left its project behind.
+func DedicatedProjectName(namespace, clusterName, clusterUID string) string {
+	sum := sha256.Sum256([]byte(clusterUID))
+	return fmt.Sprintf("capi-%s-%s-%s", namespace, clusterName, hex.EncodeToString(sum[:4]))
+}
+
+// ValidateProjectID checks that a cluster either sets its project or asks for
+// a dedicated one.
+func ValidateProjectID(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	if spec.ProjectID == "" && spec.DedicatedProject == nil {
+		return fmt.Errorf("projectID is required unless the cluster has a dedicated project: %w", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// ValidateDedicatedProject checks that the project of a cluster is set, or
+// that its dedicated project can be created with the organization the
+// controller defaults to.
+func ValidateDedicatedProject(spec infrastructurev1alpha3.PacketClusterSpec, defaultOrganizationID string) error {
+	project := spec.DedicatedProject
+	switch {
+	case project == nil:
+		return ValidateProjectID(spec)
+	case project.OrganizationID == "" && defaultOrganizationID == "":
+		return fmt.Errorf("the dedicated project requires an organization: %w", ErrInvalidRequest)
+	case spec.PersistElasticIPOnDelete:
+		return fmt.Errorf("the ip reservations of a dedicated project can not persist, they are released with the project: %w", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// EnsureClusterProject returns the project named name in an organization,
+// creating it when there is none.
+func (p *PacketClient) EnsureClusterProject(organizationID, name string) (*packngo.Project, error) {
+	projects, _, err := p.Projects.List(&packngo.ListOptions{Includes: []string{"organization"}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", packeterrors.Wrap(err))
+	}
+	for i := range projects {
+		if projects[i].Name == name && projects[i].Organization.ID == organizationID {
+			return &projects[i], nil
+		}
+	}
+
+	project, _, err := p.Projects.Create(&packngo.ProjectCreateRequest{Name: name, OrganizationID: organizationID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create project %s in organization %s: %w", name, organizationID, packeterrors.Wrap(err))
+	}
+	return project, nil
+}
+
+// DeleteClusterProject deletes the project dedicated to a cluster once its
+// devices are gone, releasing its ip reservations first. It returns the number
+// of devices still in the project, the project being deleted when there is
+// none. A project that is already gone is not an error, one with another name
+// than the dedicated one is never deleted.
+func (p *PacketClient) DeleteClusterProject(projectID, name string) (int, error) {
+	project, _, err := p.Projects.Get(projectID, nil)
+	if err = packeterrors.Wrap(err); err != nil {
+		if packeterrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get project %s: %w", projectID, err)
+	}
+	if project.Name != name {
+		return 0, fmt.Errorf("project %s is named %q, not %q, it was not created for the cluster: %w", projectID, project.Name, name, ErrInvalidRequest)
+	}
+
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the devices of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	if len(devices) > 0 {
+		return len(devices), nil
+	}
+
+	ips, _, err := p.ProjectIPs.List(projectID, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the ip reservations of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	for _, ip := range ips {
+		if err := p.ReleaseIP(ip.ID); err != nil {
+			return 0, fmt.Errorf("failed to release ip reservation %s: %w", ip.ID, err)
+		}
+	}
+
+	_, err = p.Projects.Delete(projectID)
+	if err = packeterrors.Wrap(err); err != nil && !packeterrors.IsNotFound(err) {
+		return 0, fmt.Errorf("failed to delete project %s: %w", projectID, err)
+	}
+	return 0, nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestValidateDedicatedProject(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       infrastructurev1alpha3.PacketClusterSpec
+		defaultOrg string
+		wantErr    bool
+	}{
+		{
+			name: "no dedicated project",
+			spec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+		},
+		{
+			name:    "no project",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{},
+			wantErr: true,
+		},
+		{
+			name: "organization of the cluster",
+			spec: infrastructurev1alpha3.PacketClusterSpec{DedicatedProject: &infrastructurev1alpha3.DedicatedProject{OrganizationID: "org"}},
+		},
+		{
+			name:       "organization of the controller",
+			spec:       infrastructurev1alpha3.PacketClusterSpec{DedicatedProject: &infrastructurev1alpha3.DedicatedProject{}},
+			defaultOrg: "org",
+		},
+		{
+			name:    "no organization",
+			spec:    infrastructurev1alpha3.PacketClusterSpec{DedicatedProject: &infrastructurev1alpha3.DedicatedProject{}},
+			wantErr: true,
+		},
+		{
+			name: "persisted ips",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				DedicatedProject:         &infrastructurev1alpha3.DedicatedProject{OrganizationID: "org"},
+				PersistElasticIPOnDelete: true,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateDedicatedProject(tt.spec, tt.defaultOrg)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+func TestDedicatedProjectName(t *testing.T) {
+	g := NewWithT(t)
+
+	name := DedicatedProjectName("default", "capi", "uid")
+	g.Expect(name).To(HavePrefix("capi-default-capi-"))
+	g.Expect(DedicatedProjectName("default", "capi", "uid")).To(Equal(name))
+	// a cluster recreated with the same namespace and name
+	g.Expect(DedicatedProjectName("default", "capi", "other")).NotTo(Equal(name))
+	// the namespace and name are ambiguous once joined
+	g.Expect(DedicatedProjectName("a-b", "c", "uid-1")).NotTo(Equal(DedicatedProjectName("a", "b-c", "uid-2")))
+}
+
+func TestEnsureClusterProject(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"projects": []map[string]interface{}{
+		{"id": "other-org", "name": "capi-default-capi", "organization": map[string]string{"id": "other"}},
+		{"id": "existing", "name": "capi-default-existing", "organization": map[string]string{"id": "org"}},
+	}}})
+	api.on(http.MethodPost, "/projects", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "created", "name": "capi-default-capi"}})
+
+	project, err := c.EnsureClusterProject("org", "capi-default-existing")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(project.ID).To(Equal("existing"))
+	g.Expect(api.requestsTo(http.MethodPost, "/projects")).To(BeEmpty())
+
+	project, err = c.EnsureClusterProject("org", "capi-default-capi")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(project.ID).To(Equal("created"))
+	body := api.requestsTo(http.MethodPost, "/projects")[0].Body
+	g.Expect(body).To(HaveKeyWithValue("name", "capi-default-capi"))
+	g.Expect(body).To(HaveKeyWithValue("organization_id", "org"))
+}
+
+func TestDeleteClusterProject(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "project", "name": "capi-default-capi"}})
+	api.on(http.MethodGet, "/projects/project/devices",
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"devices": []map[string]string{{"id": "device"}}}},
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"devices": []map[string]string{}}},
+	)
+	api.on(http.MethodGet, "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]string{{"id": "ip-1"}}}})
+	api.on(http.MethodDelete, "/ips/ip-1", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodDelete, "/projects/project", fakeResponse{status: http.StatusNoContent})
+
+	remaining, err := c.DeleteClusterProject("project", "capi-default-capi")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(remaining).To(Equal(1))
+	g.Expect(api.requestsTo(http.MethodDelete, "/projects/project")).To(BeEmpty())
+
+	remaining, err = c.DeleteClusterProject("project", "capi-default-capi")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(remaining).To(BeZero())
+	g.Expect(api.requestsTo(http.MethodDelete, "/ips/ip-1")).To(HaveLen(1))
+	g.Expect(api.requestsTo(http.MethodDelete, "/projects/project")).To(HaveLen(1))
+
+	// a project that is not the dedicated one is never deleted
+	_, err = c.DeleteClusterProject("project", "capi-default-other")
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+	g.Expect(api.requestsTo(http.MethodDelete, "/projects/project")).To(HaveLen(1))
+
+	// a project already gone
+	remaining, err = c.DeleteClusterProject("gone", "capi-default-capi")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(remaining).To(BeZero())
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+var (
+	// provisioningBuckets range from a minute to about 40 minutes, bare
+	// metal usually provisions in 5 to 15.
+	provisioningBuckets = prometheus.ExponentialBuckets(60, 1.5, 10)
+
+	deviceActiveSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "capp_device_active_seconds",
+		Help:    "Time from the creation request of a device to it becoming active, by facility and plan.",
+		Buckets: provisioningBuckets,
+	}, []string{"facility", "plan"})
+	nodeReadySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "capp_node_ready_seconds",
+		Help:    "Time from the creation request of a device to the node of its machine becoming ready, by facility and plan.",
+		Buckets: provisioningBuckets,
+	}, []string{"facility", "plan"})
+	provisioningSLOMissed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "capp_provisioning_slo_missed_total",
+		Help: "Machines whose node became ready later than the provisioning SLO, by facility and plan.",
+	}, []string{"facility", "plan"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(deviceActiveSeconds, nodeReadySeconds, provisioningSLOMissed)
+}
+
+// createRequested returns when the device of machine was last requested,
+// false when the timeline does not tell, e.g. for an adopted device.
+func createRequested(machine *infrastructurev1alpha3.PacketMachine) (time.Time, bool) {
+	timeline := machine.Status.Timeline
+	for i := len(timeline) - 1; i >= 0; i-- {
+		if timeline[i].Type == infrastructurev1alpha3.DeviceEventCreateRequested {
+			return timeline[i].Time.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RecordDeviceActive records, once per device, the time the device of
+// machine took to become active at now, in its status and in the
+// capp_device_active_seconds histogram.
+func RecordDeviceActive(machine *infrastructurev1alpha3.PacketMachine, now time.Time) {
+	durations := machine.Status.ProvisioningDurations
+	if durations != nil && durations.Active != nil {
+		return
+	}
+	requested, ok := createRequested(machine)
+	if !ok {
+		return
+	}
+	if durations == nil {
+		durations = &infrastructurev1alpha3.ProvisioningDurations{}
+		machine.Status.ProvisioningDurations = durations
+	}
+	d := now.Sub(requested).Round(time.Second)
+	durations.Active = &metav1.Duration{Duration: d}
+	deviceActiveSeconds.WithLabelValues(machine.Status.Facility, machine.Spec.MachineType).Observe(d.Seconds())
+}
+
+// RecordNodeReady records, once per device, the time the node of machine
+// took to become ready at now, in its status and in the
+// capp_node_ready_seconds histogram. It returns whether the node became ready
+// later than slo, when set.
+func RecordNodeReady(machine *infrastructurev1alpha3.PacketMachine, now time.Time, slo time.Duration) bool {
+	durations := machine.Status.ProvisioningDurations
+	if durations != nil && durations.NodeReady != nil {
+		return false
+	}
+	requested, ok := createRequested(machine)
+	if !ok {
+		return false
+	}
+	if durations == nil {
+		durations = &infrastructurev1alpha3.ProvisioningDurations{}
+		machine.Status.ProvisioningDurations = durations
+	}
+	d := now.Sub(requested).Round(time.Second)
+	durations.NodeReady = &metav1.Duration{Duration: d}
+	nodeReadySeconds.WithLabelValues(machine.Status.Facility, machine.Spec.MachineType).Observe(d.Seconds())
+	if slo > 0 && d > slo {
+		provisioningSLOMissed.WithLabelValues(machine.Status.Facility, machine.Spec.MachineType).Inc()
+		return true
+	}
+	return false
+}
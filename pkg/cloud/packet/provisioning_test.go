@@ -0,0 +1,64 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestRecordProvisioningDurations(t *testing.T) {
+	g := NewWithT(t)
+	requested := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	machine := &infrastructurev1alpha3.PacketMachine{
+		Spec: infrastructurev1alpha3.PacketMachineSpec{MachineType: "c3.small.x86"},
+		Status: infrastructurev1alpha3.PacketMachineStatus{
+			Facility: "ewr1",
+			Timeline: []infrastructurev1alpha3.DeviceEvent{
+				{Type: infrastructurev1alpha3.DeviceEventCreateRequested, Time: metav1.NewTime(requested.Add(-time.Hour))},
+				{Type: infrastructurev1alpha3.DeviceEventCreateRequested, Time: metav1.NewTime(requested)},
+				{Type: infrastructurev1alpha3.DeviceEventProvisioning, Time: metav1.NewTime(requested.Add(time.Minute))},
+			},
+		},
+	}
+
+	RecordDeviceActive(machine, requested.Add(8*time.Minute))
+	g.Expect(machine.Status.ProvisioningDurations.Active.Duration).To(Equal(8 * time.Minute))
+	g.Expect(machine.Status.ProvisioningDurations.NodeReady).To(BeNil())
+
+	// recorded once per device
+	RecordDeviceActive(machine, requested.Add(20*time.Minute))
+	g.Expect(machine.Status.ProvisioningDurations.Active.Duration).To(Equal(8 * time.Minute))
+
+	missed := testutil.ToFloat64(provisioningSLOMissed.WithLabelValues("ewr1", "c3.small.x86"))
+	g.Expect(RecordNodeReady(machine, requested.Add(11*time.Minute), 10*time.Minute)).To(BeTrue())
+	g.Expect(machine.Status.ProvisioningDurations.NodeReady.Duration).To(Equal(11 * time.Minute))
+	g.Expect(testutil.ToFloat64(provisioningSLOMissed.WithLabelValues("ewr1", "c3.small.x86"))).To(Equal(missed + 1))
+	g.Expect(RecordNodeReady(machine, requested.Add(30*time.Minute), 10*time.Minute)).To(BeFalse())
+
+	// adopted devices have no creation request
+	adopted := &infrastructurev1alpha3.PacketMachine{}
+	RecordDeviceActive(adopted, requested)
+	g.Expect(RecordNodeReady(adopted, requested, 0)).To(BeFalse())
+	g.Expect(adopted.Status.ProvisioningDurations).To(BeNil())
+}
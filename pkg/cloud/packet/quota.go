@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// QuotaUsage is what devices consume of the PacketResourceQuotas of their
+// namespace.
+type QuotaUsage struct {
+	Devices        int32
+	Cores          int32
+	MonthlyDevices int32
+}
+
+// MachineQuotaUsage returns what the device of a PacketMachine consumes, cores
+// being the CPU count of its machine type.
+func MachineQuotaUsage(spec infrastructurev1alpha3.PacketMachineSpec, cores int) QuotaUsage {
+	usage := QuotaUsage{Devices: 1, Cores: int32(cores)}
+	if spec.BillingCycle == "monthly" {
+		usage.MonthlyDevices = 1
+	}
+	return usage
+}
+
+// Add returns the sum of two usages.
+func (u QuotaUsage) Add(other QuotaUsage) QuotaUsage {
+	return QuotaUsage{
+		Devices:        u.Devices + other.Devices,
+		Cores:          u.Cores + other.Cores,
+		MonthlyDevices: u.MonthlyDevices + other.MonthlyDevices,
+	}
+}
+
+// ExceededQuota returns which limit of quota a device consuming requested
+// would exceed on top of used, empty when the device fits.
+func ExceededQuota(quota infrastructurev1alpha3.PacketResourceQuotaSpec, used, requested QuotaUsage) string {
+	total := used.Add(requested)
+	switch {
+	case quota.MaxDevices != nil && total.Devices > *quota.MaxDevices:
+		return fmt.Sprintf("%d devices used of the %d allowed", used.Devices, *quota.MaxDevices)
+	case quota.MaxCores != nil && total.Cores > *quota.MaxCores:
+		return fmt.Sprintf("%d cores used of the %d allowed, the device needs %d", used.Cores, *quota.MaxCores, requested.Cores)
+	case quota.MaxMonthlyDevices != nil && total.MonthlyDevices > *quota.MaxMonthlyDevices:
+		return fmt.Sprintf("%d monthly billed devices used of the %d allowed", used.MonthlyDevices, *quota.MaxMonthlyDevices)
+	}
+	return ""
+}
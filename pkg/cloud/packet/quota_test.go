@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestMachineQuotaUsage(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(MachineQuotaUsage(infrastructurev1alpha3.PacketMachineSpec{BillingCycle: "hourly"}, 8)).To(Equal(QuotaUsage{Devices: 1, Cores: 8}))
+	g.Expect(MachineQuotaUsage(infrastructurev1alpha3.PacketMachineSpec{BillingCycle: "monthly"}, 24)).To(Equal(QuotaUsage{Devices: 1, Cores: 24, MonthlyDevices: 1}))
+}
+
+func TestExceededQuota(t *testing.T) {
+	used := QuotaUsage{Devices: 3, Cores: 24, MonthlyDevices: 1}
+
+	tests := []struct {
+		name      string
+		quota     infrastructurev1alpha3.PacketResourceQuotaSpec
+		requested QuotaUsage
+		want      string
+	}{
+		{
+			name:      "no limit",
+			requested: QuotaUsage{Devices: 1, Cores: 8, MonthlyDevices: 1},
+		},
+		{
+			name:      "fits",
+			quota:     infrastructurev1alpha3.PacketResourceQuotaSpec{MaxDevices: pointer.Int32Ptr(4), MaxCores: pointer.Int32Ptr(32)},
+			requested: QuotaUsage{Devices: 1, Cores: 8},
+		},
+		{
+			name:      "devices",
+			quota:     infrastructurev1alpha3.PacketResourceQuotaSpec{MaxDevices: pointer.Int32Ptr(3)},
+			requested: QuotaUsage{Devices: 1, Cores: 8},
+			want:      "3 devices used of the 3 allowed",
+		},
+		{
+			name:      "cores",
+			quota:     infrastructurev1alpha3.PacketResourceQuotaSpec{MaxCores: pointer.Int32Ptr(30)},
+			requested: QuotaUsage{Devices: 1, Cores: 8},
+			want:      "24 cores used of the 30 allowed, the device needs 8",
+		},
+		{
+			name:      "monthly devices",
+			quota:     infrastructurev1alpha3.PacketResourceQuotaSpec{MaxDevices: pointer.Int32Ptr(10), MaxMonthlyDevices: pointer.Int32Ptr(1)},
+			requested: QuotaUsage{Devices: 1, Cores: 8, MonthlyDevices: 1},
+			want:      "1 monthly billed devices used of the 1 allowed",
+		},
+		{
+			name:      "hourly device with monthly devices exhausted",
+			quota:     infrastructurev1alpha3.PacketResourceQuotaSpec{MaxMonthlyDevices: pointer.Int32Ptr(1)},
+			requested: QuotaUsage{Devices: 1, Cores: 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(ExceededQuota(tt.quota, used, tt.requested)).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+const (
+	// registriesBoundary separates the parts of the multipart userdata the
+	// containerd configuration is added to, when neither the firewall nor
+	// the GPU driver were.
+	registriesBoundary = "capp-registries-boundary"
+
+	// containerdCertsDir is the config_path of the registries of containerd,
+	// holding a hosts.toml file per registry.
+	containerdCertsDir = "/etc/containerd/certs.d"
+
+	// defaultRegistry is the registry name containerd uses for every
+	// registry without a hosts.toml file of its own.
+	defaultRegistry = "_default"
+)
+
+// registryServers are the hosts serving the registries whose name is not
+// their host.
+var registryServers = map[string]string{
+	"docker.io": "registry-1.docker.io",
+}
+
+// validRegistryHost returns whether host is a host or host:port, as
+// containerd names registries.
+func validRegistryHost(host string) bool {
+	if host == "" || strings.ContainsAny(host, "/\\\"' \t\n") {
+		return false
+	}
+	u, err := url.Parse("//" + host)
+	return err == nil && u.Host == host && u.Hostname() != "" && u.User == nil
+}
+
+// ValidateRegistries returns an error when the registries of a cluster can
+// not be rendered into userdata.
+func ValidateRegistries(registries *infrastructurev1alpha3.RegistryConfig) error {
+	if registries == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, mirror := range registries.Mirrors {
+		if mirror.Registry != defaultRegistry && !validRegistryHost(mirror.Registry) {
+			return fmt.Errorf("invalid mirrored registry %q, it must be a host or host:port: %w", mirror.Registry, ErrInvalidRequest)
+		}
+		if seen[mirror.Registry] {
+			return fmt.Errorf("registry %s is mirrored twice: %w", mirror.Registry, ErrInvalidRequest)
+		}
+		seen[mirror.Registry] = true
+		if len(mirror.Endpoints) == 0 {
+			return fmt.Errorf("the mirror of registry %s has no endpoint: %w", mirror.Registry, ErrInvalidRequest)
+		}
+		for _, endpoint := range mirror.Endpoints {
+			u, err := url.Parse(endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !validRegistryHost(u.Host) ||
+				u.RawQuery != "" || u.Fragment != "" || strings.ContainsAny(endpoint, "\\\"' \t\n") {
+				return fmt.Errorf("invalid endpoint %q of the mirror of registry %s, it must be an http or https URL: %w", endpoint, mirror.Registry, ErrInvalidRequest)
+			}
+		}
+	}
+	for _, registry := range registries.InsecureRegistries {
+		if !validRegistryHost(registry) {
+			return fmt.Errorf("invalid insecure registry %q, it must be a host or host:port: %w", registry, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// RegistryTemplateValues returns the userdata template variables of the
+// registries of a cluster: registryMirrors, the mirrors, insecureRegistries
+// and containerdRegistryHosts, the contents of the containerd hosts.toml
+// files by path.
+func RegistryTemplateValues(registries *infrastructurev1alpha3.RegistryConfig) (map[string]interface{}, error) {
+	if registries == nil {
+		return nil, nil
+	}
+	if err := ValidateRegistries(registries); err != nil {
+		return nil, err
+	}
+	mirrors := registries.Mirrors
+	if mirrors == nil {
+		mirrors = []infrastructurev1alpha3.RegistryMirror{}
+	}
+	insecure := registries.InsecureRegistries
+	if insecure == nil {
+		insecure = []string{}
+	}
+	return map[string]interface{}{
+		"registryMirrors":         mirrors,
+		"insecureRegistries":      insecure,
+		"containerdRegistryHosts": ContainerdRegistryHosts(registries),
+	}, nil
+}
+
+// ContainerdRegistryHosts returns the containerd hosts.toml files, by path,
+// of the mirrors of registries and of the insecure registries that are not
+// mirrored.
+func ContainerdRegistryHosts(registries *infrastructurev1alpha3.RegistryConfig) map[string]string {
+	if registries == nil {
+		return nil
+	}
+	insecure := map[string]bool{}
+	for _, registry := range registries.InsecureRegistries {
+		insecure[registry] = true
+	}
+
+	files := map[string]string{}
+	for _, mirror := range registries.Mirrors {
+		files[path.Join(containerdCertsDir, mirror.Registry, "hosts.toml")] = containerdHostsTOML(mirror.Registry, mirror.Endpoints, insecure)
+	}
+	for _, registry := range registries.InsecureRegistries {
+		file := path.Join(containerdCertsDir, registry, "hosts.toml")
+		if _, ok := files[file]; !ok {
+			files[file] = containerdHostsTOML(registry, nil, insecure)
+		}
+	}
+	return files
+}
+
+// containerdHostsTOML returns the hosts.toml file of registry, pulled from
+// endpoints first.
+func containerdHostsTOML(registry string, endpoints []string, insecure map[string]bool) string {
+	toml := &strings.Builder{}
+	if registry != defaultRegistry {
+		server := registry
+		if s, ok := registryServers[registry]; ok {
+			server = s
+		}
+		fmt.Fprintf(toml, "server = %q\n", "https://"+server)
+		if insecure[registry] {
+			toml.WriteString("skip_verify = true\n")
+		}
+	}
+	for _, endpoint := range endpoints {
+		if toml.Len() > 0 {
+			toml.WriteString("\n")
+		}
+		fmt.Fprintf(toml, "[host.%q]\n", endpoint)
+		toml.WriteString("  capabilities = [\"pull\", \"resolve\"]\n")
+		if u, err := url.Parse(endpoint); err == nil && insecure[u.Host] {
+			toml.WriteString("  skip_verify = true\n")
+		}
+	}
+	return toml.String()
+}
+
+// InjectContainerdRegistries adds the containerd hosts.toml files of the
+// registries of a cluster to rendered userdata, unchanged unless they ask
+// for the containerd configuration. Cloud-init userdata becomes a multipart
+// with a script writing the files first, the userdata the firewall or the
+// GPU driver was added to gets one more part. An Ignition config gets the
+// files. Talos machine configurations have their own registry configuration
+// and are not supported.
+func InjectContainerdRegistries(userData string, format scope.BootstrapFormat, registries *infrastructurev1alpha3.RegistryConfig) (string, error) {
+	if registries == nil || !registries.ContainerdConfig {
+		return userData, nil
+	}
+	if err := ValidateRegistries(registries); err != nil {
+		return "", err
+	}
+	files := ContainerdRegistryHosts(registries)
+	if len(files) == 0 {
+		return userData, nil
+	}
+	paths := make([]string, 0, len(files))
+	for file := range files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+
+	switch format {
+	case scope.BootstrapFormatIgnition:
+		return injectIgnitionRegistries(userData, paths, files)
+	case scope.BootstrapFormatCloudConfig:
+		return injectCloudInitRegistries(userData, paths, files)
+	default:
+		return "", fmt.Errorf("the containerd registry configuration is not supported with %s userdata: %w", format, ErrInvalidRequest)
+	}
+}
+
+func injectCloudInitRegistries(userData string, paths []string, files map[string]string) (string, error) {
+	script := &strings.Builder{}
+	script.WriteString("#!/bin/sh\nset -e\n")
+	for _, file := range paths {
+		fmt.Fprintf(script, "mkdir -p '%s'\n", path.Dir(file))
+		fmt.Fprintf(script, "cat > '%s' <<'EOF'\n%sEOF\n", file, files[file])
+	}
+	part := cloudInitPart{"text/x-shellscript", "capp-registries.sh", script.String()}
+
+	// the files are written before the bootstrap commands pull any image
+	for _, boundary := range []string{firewallBoundary, gpuBoundary} {
+		parts, ok, err := cloudInitParts(userData, boundary)
+		if err != nil {
+			return "", fmt.Errorf("error reading the multipart userdata: %v: %w", err, ErrInvalidRequest)
+		}
+		if ok {
+			return cloudInitMultipart(boundary, append([]cloudInitPart{part}, parts...))
+		}
+	}
+
+	contentType := cloudInitContentType(userData)
+	if contentType == "" {
+		return "", fmt.Errorf("the containerd registry configuration can not be added to userdata that is not a cloud-config or a script: %w", ErrInvalidRequest)
+	}
+	if strings.Contains(userData, registriesBoundary) {
+		return "", fmt.Errorf("the userdata contains the %s boundary: %w", registriesBoundary, ErrInvalidRequest)
+	}
+	return cloudInitMultipart(registriesBoundary, []cloudInitPart{
+		part,
+		{contentType, "userdata", userData},
+	})
+}
+
+func injectIgnitionRegistries(userData string, paths []string, files map[string]string) (string, error) {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(userData), &config); err != nil {
+		return "", fmt.Errorf("the ignition config is not valid JSON: %v: %w", err, ErrInvalidRequest)
+	}
+	for _, file := range paths {
+		if err := appendIgnition(config, "storage", "files", ignitionFile(config, file, 0644, files[file])); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+func testRegistries() *infrastructurev1alpha3.RegistryConfig {
+	return &infrastructurev1alpha3.RegistryConfig{
+		Mirrors: []infrastructurev1alpha3.RegistryMirror{
+			{Registry: "docker.io", Endpoints: []string{"https://mirror.example.net:5000", "http://10.0.0.5"}},
+			{Registry: "_default", Endpoints: []string{"https://mirror.example.net:5000"}},
+		},
+		InsecureRegistries: []string{"mirror.example.net:5000", "registry.internal"},
+		ContainerdConfig:   true,
+	}
+}
+
+func TestValidateRegistries(t *testing.T) {
+	tests := []struct {
+		name       string
+		registries *infrastructurev1alpha3.RegistryConfig
+		wantErr    string
+	}{
+		{
+			name: "no registries",
+		},
+		{
+			name:       "valid",
+			registries: testRegistries(),
+		},
+		{
+			name: "registry url",
+			registries: &infrastructurev1alpha3.RegistryConfig{Mirrors: []infrastructurev1alpha3.RegistryMirror{
+				{Registry: "https://docker.io", Endpoints: []string{"https://mirror.example.net"}},
+			}},
+			wantErr: `invalid mirrored registry "https://docker.io"`,
+		},
+		{
+			name: "mirrored twice",
+			registries: &infrastructurev1alpha3.RegistryConfig{Mirrors: []infrastructurev1alpha3.RegistryMirror{
+				{Registry: "docker.io", Endpoints: []string{"https://mirror.example.net"}},
+				{Registry: "docker.io", Endpoints: []string{"https://mirror.example.org"}},
+			}},
+			wantErr: "registry docker.io is mirrored twice",
+		},
+		{
+			name: "no endpoint",
+			registries: &infrastructurev1alpha3.RegistryConfig{Mirrors: []infrastructurev1alpha3.RegistryMirror{
+				{Registry: "docker.io"},
+			}},
+			wantErr: "the mirror of registry docker.io has no endpoint",
+		},
+		{
+			name: "endpoint without scheme",
+			registries: &infrastructurev1alpha3.RegistryConfig{Mirrors: []infrastructurev1alpha3.RegistryMirror{
+				{Registry: "docker.io", Endpoints: []string{"mirror.example.net"}},
+			}},
+			wantErr: `invalid endpoint "mirror.example.net" of the mirror of registry docker.io`,
+		},
+		{
+			name: "endpoint with a quote",
+			registries: &infrastructurev1alpha3.RegistryConfig{Mirrors: []infrastructurev1alpha3.RegistryMirror{
+				{Registry: "docker.io", Endpoints: []string{`https://mirror.example.net/"`}},
+			}},
+			wantErr: "invalid endpoint",
+		},
+		{
+			name:       "insecure registry with a path",
+			registries: &infrastructurev1alpha3.RegistryConfig{InsecureRegistries: []string{"registry.internal/library"}},
+			wantErr:    `invalid insecure registry "registry.internal/library"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateRegistries(tt.registries)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestContainerdRegistryHosts(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ContainerdRegistryHosts(nil)).To(BeNil())
+	g.Expect(ContainerdRegistryHosts(testRegistries())).To(Equal(map[string]string{
+		"/etc/containerd/certs.d/docker.io/hosts.toml": `server = "https://registry-1.docker.io"
+
+[host."https://mirror.example.net:5000"]
+  capabilities = ["pull", "resolve"]
+  skip_verify = true
+
+[host."http://10.0.0.5"]
+  capabilities = ["pull", "resolve"]
+`,
+		"/etc/containerd/certs.d/_default/hosts.toml": `[host."https://mirror.example.net:5000"]
+  capabilities = ["pull", "resolve"]
+  skip_verify = true
+`,
+		"/etc/containerd/certs.d/mirror.example.net:5000/hosts.toml": `server = "https://mirror.example.net:5000"
+skip_verify = true
+`,
+		"/etc/containerd/certs.d/registry.internal/hosts.toml": `server = "https://registry.internal"
+skip_verify = true
+`,
+	}))
+}
+
+func TestRegistryTemplateValues(t *testing.T) {
+	g := NewWithT(t)
+
+	values, err := RegistryTemplateValues(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(values).To(BeNil())
+
+	values, err = RegistryTemplateValues(testRegistries())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(values).To(HaveKeyWithValue("registryMirrors", testRegistries().Mirrors))
+	g.Expect(values).To(HaveKeyWithValue("insecureRegistries", []string{"mirror.example.net:5000", "registry.internal"}))
+	g.Expect(values).To(HaveKeyWithValue("containerdRegistryHosts", ContainerdRegistryHosts(testRegistries())))
+
+	// the lists are empty, not missing, for templates to range over them
+	values, err = RegistryTemplateValues(&infrastructurev1alpha3.RegistryConfig{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(values).To(HaveKeyWithValue("registryMirrors", []infrastructurev1alpha3.RegistryMirror{}))
+	g.Expect(values).To(HaveKeyWithValue("insecureRegistries", []string{}))
+
+	_, err = RegistryTemplateValues(&infrastructurev1alpha3.RegistryConfig{InsecureRegistries: []string{""}})
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+}
+
+func TestInjectContainerdRegistries(t *testing.T) {
+	userData := "#cloud-config\nruncmd:\n- kubeadm join\n"
+
+	t.Run("disabled", func(t *testing.T) {
+		g := NewWithT(t)
+		registries := testRegistries()
+		registries.ContainerdConfig = false
+		injected, err := InjectContainerdRegistries(userData, scope.BootstrapFormatCloudConfig, registries)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(injected).To(Equal(userData))
+	})
+
+	t.Run("cloud-config", func(t *testing.T) {
+		g := NewWithT(t)
+		injected, err := InjectContainerdRegistries(userData, scope.BootstrapFormatCloudConfig, testRegistries())
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(injected).To(HavePrefix(`Content-Type: multipart/mixed; boundary="capp-registries-boundary"`))
+		filenames, contents := readMultipartUserData(g, injected)
+		g.Expect(filenames).To(Equal([]string{"capp-registries.sh", "userdata"}))
+		g.Expect(contents[0]).To(ContainSubstring("mkdir -p '/etc/containerd/certs.d/_default'\n"))
+		g.Expect(contents[0]).To(ContainSubstring("cat > '/etc/containerd/certs.d/docker.io/hosts.toml' <<'EOF'\nserver = \"https://registry-1.docker.io\"\n"))
+		g.Expect(contents[1]).To(Equal(userData))
+	})
+
+	t.Run("after firewall and gpu driver", func(t *testing.T) {
+		g := NewWithT(t)
+		injected, err := InjectFirewall(userData, scope.BootstrapFormatCloudConfig, "table inet capp_firewall {}\n")
+		g.Expect(err).NotTo(HaveOccurred())
+		injected, err = InjectGPUDriver(injected, scope.BootstrapFormatCloudConfig, &infrastructurev1alpha3.GPUSpec{Driver: infrastructurev1alpha3.GPUDriverNVIDIA})
+		g.Expect(err).NotTo(HaveOccurred())
+		injected, err = InjectContainerdRegistries(injected, scope.BootstrapFormatCloudConfig, testRegistries())
+		g.Expect(err).NotTo(HaveOccurred())
+
+		g.Expect(injected).To(HavePrefix(`Content-Type: multipart/mixed; boundary="capp-firewall-boundary"`))
+		filenames, _ := readMultipartUserData(g, injected)
+		g.Expect(filenames).To(Equal([]string{"capp-registries.sh", "capp-firewall.sh", "userdata", "capp-gpu-driver.sh"}))
+	})
+
+	t.Run("ignition", func(t *testing.T) {
+		g := NewWithT(t)
+		injected, err := InjectContainerdRegistries(`{"ignition":{"version":"3.3.0"}}`, scope.BootstrapFormatIgnition, testRegistries())
+		g.Expect(err).NotTo(HaveOccurred())
+
+		var config struct {
+			Storage struct {
+				Files []map[string]interface{} `json:"files"`
+			} `json:"storage"`
+		}
+		g.Expect(json.Unmarshal([]byte(injected), &config)).To(Succeed())
+		g.Expect(config.Storage.Files).To(HaveLen(4))
+		g.Expect(config.Storage.Files[0]).To(HaveKeyWithValue("path", "/etc/containerd/certs.d/_default/hosts.toml"))
+		g.Expect(config.Storage.Files[0]).To(HaveKeyWithValue("mode", float64(0644)))
+	})
+
+	t.Run("talos", func(t *testing.T) {
+		g := NewWithT(t)
+		_, err := InjectContainerdRegistries("machine:\n  type: worker\n", scope.BootstrapFormatTalos, testRegistries())
+		g.Expect(err).To(MatchError(ContainSubstring("the containerd registry configuration is not supported")))
+		g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+	})
+}
+
+func TestNewDeviceRegistries(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	registries := testRegistries()
+	registries.ContainerdConfig = false
+	machineScope := newTestMachineScope(t,
+		infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Facility: "ewr1"},
+		infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Registries: registries},
+		"#cloud-config\nruncmd:\n{{ range .registryMirrors }}- echo {{ .Registry }} {{ index .Endpoints 0 }}\n{{ end }}")
+
+	_, err := c.NewDevice(CreateDeviceRequest{MachineScope: machineScope})
+	g.Expect(err).NotTo(HaveOccurred())
+	userData := api.requestsTo("POST", "/projects/project/devices")[0].Body["userdata"]
+	g.Expect(userData).To(Equal("#cloud-config\nruncmd:\n- echo docker.io https://mirror.example.net:5000\n- echo _default https://mirror.example.net:5000\n"))
+}
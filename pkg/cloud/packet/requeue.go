@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"time"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+const (
+	// ActiveDeviceRequeue is how often an active device is checked, the
+	// default resync period of the controllers.
+	ActiveDeviceRequeue = 10 * time.Minute
+	// QueuedDeviceRequeue is how often a device waiting for its provisioning
+	// to start is checked.
+	QueuedDeviceRequeue = 30 * time.Second
+
+	// expectedProvisioningDuration is how long the provisioning of a device
+	// usually takes, from 0 to 100 percent.
+	expectedProvisioningDuration = 10 * time.Minute
+	// provisioningChecks is how many times the remaining provisioning time is
+	// split into.
+	provisioningChecks           = 10
+	minProvisioningDeviceRequeue = 5 * time.Second
+	maxProvisioningDeviceRequeue = time.Minute
+)
+
+// DeviceRequeue returns when to check a device again from its state and
+// provisioning progress. A provisioning device is checked more often as it
+// gets close to completion, so that its machine becomes ready soon after it
+// does, while a device far from it, or active, is checked seldom. It returns
+// 0 for the states that do not change by themselves.
+func DeviceRequeue(device *packngo.Device) time.Duration {
+	switch infrastructurev1alpha3.PacketResourceStatus(device.State) {
+	case infrastructurev1alpha3.PacketResourceStatusNew, infrastructurev1alpha3.PacketResourceStatusQueued:
+		return QueuedDeviceRequeue
+	case infrastructurev1alpha3.PacketResourceStatusProvisioning, infrastructurev1alpha3.PacketResourceStatusReinstalling:
+		remaining := float64(100-device.ProvisionPer) / 100
+		requeue := time.Duration(remaining * float64(expectedProvisioningDuration) / provisioningChecks)
+		switch {
+		case requeue < minProvisioningDeviceRequeue:
+			return minProvisioningDeviceRequeue
+		case requeue > maxProvisioningDeviceRequeue:
+			return maxProvisioningDeviceRequeue
+		}
+		return requeue.Round(time.Second)
+	case infrastructurev1alpha3.PacketResourceStatusRunning:
+		return ActiveDeviceRequeue
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+)
+
+func TestDeviceRequeue(t *testing.T) {
+	tests := []struct {
+		state    string
+		progress float32
+		want     time.Duration
+	}{
+		{state: "queued", want: QueuedDeviceRequeue},
+		{state: "provisioning", want: time.Minute},
+		{state: "provisioning", progress: 50, want: 30 * time.Second},
+		{state: "provisioning", progress: 80, want: 12 * time.Second},
+		{state: "reinstalling", progress: 95, want: 5 * time.Second},
+		{state: "active", progress: 100, want: ActiveDeviceRequeue},
+		{state: "failed"},
+	}
+
+	for _, tt := range tests {
+		g := NewWithT(t)
+		g.Expect(DeviceRequeue(&packngo.Device{State: tt.state, ProvisionPer: tt.progress})).To(Equal(tt.want), "%s at %.0f%%", tt.state, tt.progress)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultReservationClaimTTL is how long a machine holds the hardware
+// reservation it creates its device on.
+const DefaultReservationClaimTTL = 2 * time.Minute
+
+// deprovisioningClaimant holds the reservations whose device got deleted
+// until they are provisionable again. Machines are claimants by UID.
+const deprovisioningClaimant = "deprovisioning"
+
+// ReservationClaims coordinates the machines picking their device from
+// overlapping lists of hardware reservations. A machine claims a reservation
+// before creating its device on it, and the other machines skip it instead of
+// getting the creation rejected by the API. The claim of a reservation the
+// device got created on, or that the API reported in use, is kept for TTL:
+// long enough for the other machines to see the reservation provisioned. The
+// reservation of a deleted device is held until the API confirms it is done
+// deprovisioning. A nil ReservationClaims lets every machine claim every
+// reservation.
+type ReservationClaims struct {
+	TTL time.Duration
+
+	mu     sync.Mutex
+	claims map[string]reservationClaim
+	now    func() time.Time
+}
+
+// reservationClaim is the claim of claimant on a reservation, until
+// expires. The claims of deprovisioning reservations do not expire.
+type reservationClaim struct {
+	claimant string
+	expires  time.Time
+}
+
+// NewReservationClaims returns a ReservationClaims keeping claims for ttl.
+func NewReservationClaims(ttl time.Duration) *ReservationClaims {
+	return &ReservationClaims{
+		TTL:    ttl,
+		claims: map[string]reservationClaim{},
+		now:    time.Now,
+	}
+}
+
+// Claim claims a reservation for claimant, or renews its claim. It returns
+// false when another claimant holds it.
+func (c *ReservationClaims) Claim(reservationID, claimant string) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, claim := range c.claims {
+		if !claim.expires.IsZero() && !now.Before(claim.expires) {
+			delete(c.claims, id)
+		}
+	}
+	if claim, ok := c.claims[reservationID]; ok && claim.claimant != claimant {
+		return false
+	}
+	c.claims[reservationID] = reservationClaim{claimant: claimant, expires: now.Add(c.TTL)}
+	return true
+}
+
+// Release drops the claim of claimant on a reservation, e.g. when its device
+// could not be created on it for another reason than the reservation being in
+// use.
+func (c *ReservationClaims) Release(reservationID, claimant string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if claim, ok := c.claims[reservationID]; ok && claim.claimant == claimant {
+		delete(c.claims, reservationID)
+	}
+}
+
+// Deprovisioning holds a reservation whose device got deleted: Packet wipes
+// the server before the reservation takes a new device, and the creations in
+// the meantime fail. Claim refuses it until Provisionable is called.
+func (c *ReservationClaims) Deprovisioning(reservationID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.claims[reservationID] = reservationClaim{claimant: deprovisioningClaimant}
+}
+
+// IsDeprovisioning returns whether a reservation is held until it is done
+// deprovisioning.
+func (c *ReservationClaims) IsDeprovisioning(reservationID string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	claim, ok := c.claims[reservationID]
+	return ok && claim.claimant == deprovisioningClaimant
+}
+
+// Provisionable drops the hold of a deprovisioning reservation, once the API
+// confirmed it can take a new device.
+func (c *ReservationClaims) Provisionable(reservationID string) {
+	c.Release(reservationID, deprovisioningClaimant)
+}
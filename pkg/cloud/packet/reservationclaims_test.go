@@ -0,0 +1,68 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReservationClaims(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	claims := NewReservationClaims(2 * time.Minute)
+	claims.now = func() time.Time { return now }
+
+	g.Expect(claims.Claim("r1", "a")).To(BeTrue())
+	g.Expect(claims.Claim("r1", "b")).To(BeFalse())
+	g.Expect(claims.Claim("r2", "b")).To(BeTrue())
+	// claimants renew their own claims
+	g.Expect(claims.Claim("r1", "a")).To(BeTrue())
+
+	// only the claimant releases its claim
+	claims.Release("r1", "b")
+	g.Expect(claims.Claim("r1", "b")).To(BeFalse())
+	claims.Release("r1", "a")
+	g.Expect(claims.Claim("r1", "b")).To(BeTrue())
+
+	now = now.Add(2 * time.Minute)
+	g.Expect(claims.Claim("r2", "a")).To(BeTrue())
+
+	// deprovisioning reservations are held until provisionable, whatever
+	// the ttl
+	claims.Deprovisioning("r1")
+	g.Expect(claims.IsDeprovisioning("r1")).To(BeTrue())
+	g.Expect(claims.Claim("r1", "b")).To(BeFalse())
+	claims.Release("r1", "b")
+	now = now.Add(time.Hour)
+	g.Expect(claims.Claim("r1", "a")).To(BeFalse())
+	claims.Provisionable("r1")
+	g.Expect(claims.IsDeprovisioning("r1")).To(BeFalse())
+	g.Expect(claims.Claim("r1", "a")).To(BeTrue())
+	// a claim is not a deprovisioning hold
+	claims.Provisionable("r1")
+	g.Expect(claims.Claim("r1", "b")).To(BeFalse())
+
+	var disabled *ReservationClaims
+	g.Expect(disabled.Claim("r1", "a")).To(BeTrue())
+	g.Expect(disabled.Claim("r1", "b")).To(BeTrue())
+	disabled.Release("r1", "a")
+	disabled.Deprovisioning("r1")
+	g.Expect(disabled.IsDeprovisioning("r1")).To(BeFalse())
+}
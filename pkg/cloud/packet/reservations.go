@@ -0,0 +1,173 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/packethost/packngo"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+// NextAvailableReservation lets Packet pick any free hardware reservation of
+// the location of the device.
+const NextAvailableReservation = "next-available"
+
+// ReservationService lists the hardware reservations of a project.
+type ReservationService interface {
+	HardwareReservations(projectID string) ([]packngo.HardwareReservation, error)
+}
+
+// HardwareReservations returns the hardware reservations of a project, with
+// their facility.
+func (p *PacketClient) HardwareReservations(projectID string) ([]packngo.HardwareReservation, error) {
+	reservations, _, err := p.Client.HardwareReservations.List(projectID, &packngo.ListOptions{Includes: []string{"facility"}})
+	if err != nil {
+		return nil, packeterrors.Wrap(err)
+	}
+	return reservations, nil
+}
+
+// ReservationFailureDomains returns a failure domain for every facility
+// hosting reservations, restricted to the facilities of metro when it is set.
+// metros holds the metro of every facility and controlPlanes the control
+// plane machines of the cluster in every facility. The domains with free
+// reservations, or already hosting control plane machines, are suitable for
+// the control plane. Spare reservations are left out.
+func ReservationFailureDomains(reservations []packngo.HardwareReservation, metro string, metros map[string]string, controlPlanes map[string]int) clusterv1.FailureDomains {
+	total := map[string]int{}
+	free := map[string]int{}
+	for _, r := range reservations {
+		facility := r.Facility.Code
+		if facility == "" || r.Spare {
+			continue
+		}
+		if metro != "" && !strings.EqualFold(metros[facility], metro) {
+			continue
+		}
+		total[facility]++
+		if r.Provisionable {
+			free[facility]++
+		}
+	}
+
+	domains := clusterv1.FailureDomains{}
+	for facility, count := range total {
+		attributes := map[string]string{
+			"reservations":     strconv.Itoa(count),
+			"freeReservations": strconv.Itoa(free[facility]),
+		}
+		if m := metros[facility]; m != "" {
+			attributes["metro"] = m
+		}
+		domains[facility] = clusterv1.FailureDomainSpec{
+			ControlPlane: free[facility] > 0 || controlPlanes[facility] > 0,
+			Attributes:   attributes,
+		}
+	}
+	return domains
+}
+
+// ValidateReservationAffinities checks the reservation affinities of a
+// cluster. It returns an ErrInvalidRequest when a failure domain is declared
+// twice or a reservation belongs to two of them.
+func ValidateReservationAffinities(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	domains := map[string]bool{}
+	owners := map[string]string{}
+	for _, affinity := range spec.ReservationAffinities {
+		if domains[affinity.FailureDomain] {
+			return fmt.Errorf("reservationAffinities: failure domain %s is declared twice: %w", affinity.FailureDomain, ErrInvalidRequest)
+		}
+		domains[affinity.FailureDomain] = true
+		for _, id := range affinity.ReservationIDs {
+			if id == NextAvailableReservation {
+				return fmt.Errorf("reservationAffinities: failure domain %s can not list %s: %w", affinity.FailureDomain, NextAvailableReservation, ErrInvalidRequest)
+			}
+			if owner, ok := owners[id]; ok {
+				return fmt.Errorf("reservationAffinities: reservation %s belongs to failure domains %s and %s: %w", id, owner, affinity.FailureDomain, ErrInvalidRequest)
+			}
+			owners[id] = affinity.FailureDomain
+		}
+	}
+	return nil
+}
+
+// AffinityFailureDomains returns a failure domain, suitable for the control
+// plane, for every reservation affinity.
+func AffinityFailureDomains(affinities []infrastructurev1alpha3.ReservationAffinity) clusterv1.FailureDomains {
+	domains := clusterv1.FailureDomains{}
+	for _, affinity := range affinities {
+		domains[affinity.FailureDomain] = clusterv1.FailureDomainSpec{
+			ControlPlane: true,
+			Attributes:   map[string]string{"reservations": strconv.Itoa(len(affinity.ReservationIDs))},
+		}
+	}
+	return domains
+}
+
+// MachineReservationIDs returns, in the order they are tried, the hardware
+// reservations the device of a machine is created on. When the failure domain
+// of the machine has a reservation affinity, they are the reservations of the
+// machine belonging to the failure domain, or all of the failure domain ones
+// for next-available. A soft affinity falls back on the other reservations of
+// the machine. A hard affinity leaving no reservation returns an
+// ErrInvalidRequest. Machines without reservations are left alone.
+func MachineReservationIDs(machineScope *scope.MachineScope) ([]string, error) {
+	spec := machineScope.PacketMachine.Spec
+	ids := strings.Split(spec.HardwareReservationID, ",")
+	fd := machineScope.Machine.Spec.FailureDomain
+	if spec.HardwareReservationID == "" || fd == nil {
+		return ids, nil
+	}
+	var affinity *infrastructurev1alpha3.ReservationAffinity
+	for i, a := range machineScope.PacketCluster.Spec.ReservationAffinities {
+		if a.FailureDomain == *fd {
+			affinity = &machineScope.PacketCluster.Spec.ReservationAffinities[i]
+		}
+	}
+	if affinity == nil {
+		return ids, nil
+	}
+
+	picked := []string{}
+	if ItemsInList(ids, []string{NextAvailableReservation}) {
+		picked = append(picked, affinity.ReservationIDs...)
+	} else {
+		for _, id := range ids {
+			if ItemsInList(affinity.ReservationIDs, []string{id}) {
+				picked = append(picked, id)
+			}
+		}
+	}
+	if affinity.Type == infrastructurev1alpha3.ReservationAffinitySoft {
+		for _, id := range ids {
+			if !ItemsInList(picked, []string{id}) {
+				picked = append(picked, id)
+			}
+		}
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("none of the hardware reservations %s belongs to failure domain %s: %w", spec.HardwareReservationID, *fd, ErrInvalidRequest)
+	}
+	return picked, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestHardwareReservations(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/hardware-reservations", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"hardware_reservations": []map[string]interface{}{
+			{"id": "r1", "facility": map[string]string{"code": "ewr1"}, "provisionable": true},
+		},
+	}})
+
+	reservations, err := c.HardwareReservations("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(reservations).To(HaveLen(1))
+	g.Expect(reservations[0].Facility.Code).To(Equal("ewr1"))
+	g.Expect(reservations[0].Provisionable).To(BeTrue())
+
+	_, err = c.HardwareReservations("other")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestReservationFailureDomains(t *testing.T) {
+	g := NewWithT(t)
+	metros := map[string]string{"ewr1": "ny", "ny5": "ny", "sjc1": "sv"}
+	reservation := func(facility string, provisionable, spare bool) packngo.HardwareReservation {
+		return packngo.HardwareReservation{Facility: packngo.Facility{Code: facility}, Provisionable: provisionable, Spare: spare}
+	}
+	reservations := []packngo.HardwareReservation{
+		reservation("ewr1", true, false),
+		reservation("ewr1", false, false),
+		reservation("ny5", false, false),
+		reservation("ny5", true, true),
+		reservation("sjc1", true, false),
+		reservation("", true, false),
+	}
+
+	g.Expect(ReservationFailureDomains(reservations, "ny", metros, map[string]int{})).To(Equal(clusterv1.FailureDomains{
+		"ewr1": {ControlPlane: true, Attributes: map[string]string{"metro": "ny", "reservations": "2", "freeReservations": "1"}},
+		"ny5":  {ControlPlane: false, Attributes: map[string]string{"metro": "ny", "reservations": "1", "freeReservations": "0"}},
+	}))
+
+	// a facility hosting control plane machines stays a control plane
+	// domain once its reservations are used
+	domains := ReservationFailureDomains(reservations, "", metros, map[string]int{"ny5": 1})
+	g.Expect(domains).To(HaveLen(3))
+	g.Expect(domains["ny5"].ControlPlane).To(BeTrue())
+	g.Expect(domains["sjc1"].ControlPlane).To(BeTrue())
+
+	g.Expect(ReservationFailureDomains(nil, "", metros, nil)).To(BeEmpty())
+}
+
+func TestDeviceFacilityFailureDomain(t *testing.T) {
+	g := NewWithT(t)
+	machineScope := newTestMachineScope(t, infrastructurev1alpha3.PacketMachineSpec{}, infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1", FailureDomainsFromReservations: true}, "")
+	machineScope.PacketCluster.Status.FailureDomains = clusterv1.FailureDomains{"ny5": {ControlPlane: true}, "rack-a": {ControlPlane: true}}
+
+	// failure domains the cluster does not report are ignored
+	machineScope.Machine.Spec.FailureDomain = pointer.StringPtr("zone-a")
+	g.Expect(DeviceFacility(machineScope, "")).To(Equal("ewr1"))
+
+	machineScope.Machine.Spec.FailureDomain = pointer.StringPtr("ny5")
+	g.Expect(DeviceFacility(machineScope, "")).To(Equal("ny5"))
+
+	// the failure domains of the reservation affinities are not facilities
+	machineScope.PacketCluster.Spec.FailureDomainsFromReservations = false
+	machineScope.Machine.Spec.FailureDomain = pointer.StringPtr("rack-a")
+	g.Expect(DeviceFacility(machineScope, "")).To(Equal("ewr1"))
+
+	machineScope.PacketMachine.Spec.Facility = "sjc1"
+	g.Expect(DeviceFacility(machineScope, "")).To(Equal("sjc1"))
+}
+
+func TestValidateReservationAffinities(t *testing.T) {
+	g := NewWithT(t)
+	affinity := func(domain string, ids ...string) infrastructurev1alpha3.ReservationAffinity {
+		return infrastructurev1alpha3.ReservationAffinity{FailureDomain: domain, ReservationIDs: ids}
+	}
+
+	g.Expect(ValidateReservationAffinities(infrastructurev1alpha3.PacketClusterSpec{})).To(Succeed())
+	g.Expect(ValidateReservationAffinities(infrastructurev1alpha3.PacketClusterSpec{ReservationAffinities: []infrastructurev1alpha3.ReservationAffinity{
+		affinity("rack-a", "r1", "r2"), affinity("rack-b", "r3"),
+	}})).To(Succeed())
+	for _, affinities := range [][]infrastructurev1alpha3.ReservationAffinity{
+		{affinity("rack-a", "r1"), affinity("rack-a", "r2")},
+		{affinity("rack-a", "r1"), affinity("rack-b", "r1")},
+		{affinity("rack-a", NextAvailableReservation)},
+	} {
+		err := ValidateReservationAffinities(infrastructurev1alpha3.PacketClusterSpec{ReservationAffinities: affinities})
+		g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue(), "%v", affinities)
+	}
+
+	g.Expect(AffinityFailureDomains([]infrastructurev1alpha3.ReservationAffinity{affinity("rack-a", "r1", "r2")})).To(Equal(clusterv1.FailureDomains{
+		"rack-a": {ControlPlane: true, Attributes: map[string]string{"reservations": "2"}},
+	}))
+}
+
+func TestMachineReservationIDs(t *testing.T) {
+	affinities := []infrastructurev1alpha3.ReservationAffinity{
+		{FailureDomain: "rack-a", ReservationIDs: []string{"r1", "r2"}},
+		{FailureDomain: "rack-b", ReservationIDs: []string{"r3"}, Type: infrastructurev1alpha3.ReservationAffinitySoft},
+	}
+
+	tests := []struct {
+		name          string
+		reservations  string
+		failureDomain string
+		want          []string
+		wantErr       bool
+	}{
+		{name: "no reservations", failureDomain: "rack-a", want: []string{""}},
+		{name: "no failure domain", reservations: "r3,r1", want: []string{"r3", "r1"}},
+		{name: "failure domain without affinity", reservations: "r3,r1", failureDomain: "rack-c", want: []string{"r3", "r1"}},
+		{name: "hard", reservations: "r3,r2,r1", failureDomain: "rack-a", want: []string{"r2", "r1"}},
+		{name: "hard next available", reservations: NextAvailableReservation, failureDomain: "rack-a", want: []string{"r1", "r2"}},
+		{name: "hard without reservation of the domain", reservations: "r3", failureDomain: "rack-a", wantErr: true},
+		{name: "soft", reservations: "r1,r3", failureDomain: "rack-b", want: []string{"r3", "r1"}},
+		{name: "soft next available", reservations: NextAvailableReservation, failureDomain: "rack-b", want: []string{"r3", NextAvailableReservation}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			machineScope := newTestMachineScope(t, infrastructurev1alpha3.PacketMachineSpec{HardwareReservationID: tt.reservations},
+				infrastructurev1alpha3.PacketClusterSpec{ReservationAffinities: affinities}, "")
+			if tt.failureDomain != "" {
+				machineScope.Machine.Spec.FailureDomain = pointer.StringPtr(tt.failureDomain)
+			}
+			ids, err := MachineReservationIDs(machineScope)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ids).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// ScaleInCandidate is a Machine of a MachineSet, with what the scale in
+// preferences rank it on.
+type ScaleInCandidate struct {
+	Name                  string
+	Created               time.Time
+	Metro                 string
+	HardwareReservationID string
+}
+
+// ParseScaleInPolicy parses the value of the scale in policy annotation.
+func ParseScaleInPolicy(value string) ([]infrastructurev1alpha3.ScaleInPreference, error) {
+	policy := []infrastructurev1alpha3.ScaleInPreference{}
+	for _, item := range strings.Split(value, ",") {
+		preference := infrastructurev1alpha3.ScaleInPreference(strings.TrimSpace(item))
+		switch preference {
+		case infrastructurev1alpha3.ScaleInPreferDrainingMetro,
+			infrastructurev1alpha3.ScaleInPreferOnDemand,
+			infrastructurev1alpha3.ScaleInPreferOldest:
+			policy = append(policy, preference)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown scale in preference %q: %w", preference, ErrInvalidRequest)
+		}
+	}
+	return policy, nil
+}
+
+// RankScaleInCandidates sorts the candidates, the ones to delete first on
+// scale in first. The preferences of the policy are applied in order, each
+// one breaking the ties of the previous ones. The remaining ties are broken by
+// name so that the ranking is stable across reconciliations.
+func RankScaleInCandidates(candidates []ScaleInCandidate, policy []infrastructurev1alpha3.ScaleInPreference, drainingMetros []string) {
+	draining := map[string]bool{}
+	for _, m := range drainingMetros {
+		draining[m] = true
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		for _, preference := range policy {
+			switch preference {
+			case infrastructurev1alpha3.ScaleInPreferDrainingMetro:
+				if draining[a.Metro] != draining[b.Metro] {
+					return draining[a.Metro]
+				}
+			case infrastructurev1alpha3.ScaleInPreferOnDemand:
+				if (a.HardwareReservationID == "") != (b.HardwareReservationID == "") {
+					return a.HardwareReservationID == ""
+				}
+			case infrastructurev1alpha3.ScaleInPreferOldest:
+				if !a.Created.Equal(b.Created) {
+					return a.Created.Before(b.Created)
+				}
+			}
+		}
+		return a.Name < b.Name
+	})
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestParseScaleInPolicy(t *testing.T) {
+	g := NewWithT(t)
+
+	policy, err := ParseScaleInPolicy("PreferDrainingMetro, PreferOnDemand,PreferOldest")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(policy).To(Equal([]infrastructurev1alpha3.ScaleInPreference{
+		infrastructurev1alpha3.ScaleInPreferDrainingMetro,
+		infrastructurev1alpha3.ScaleInPreferOnDemand,
+		infrastructurev1alpha3.ScaleInPreferOldest,
+	}))
+
+	_, err = ParseScaleInPolicy("PreferNewest")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRankScaleInCandidates(t *testing.T) {
+	now := time.Now()
+	candidates := func() []ScaleInCandidate {
+		return []ScaleInCandidate{
+			{Name: "reserved-old", Created: now.Add(-3 * time.Hour), Metro: "ny", HardwareReservationID: "r1"},
+			{Name: "ondemand-new", Created: now.Add(-1 * time.Hour), Metro: "ny"},
+			{Name: "draining", Created: now.Add(-2 * time.Hour), Metro: "sv", HardwareReservationID: "r2"},
+			{Name: "ondemand-old", Created: now.Add(-3 * time.Hour), Metro: "ny"},
+		}
+	}
+	names := func(candidates []ScaleInCandidate) []string {
+		n := []string{}
+		for _, c := range candidates {
+			n = append(n, c.Name)
+		}
+		return n
+	}
+
+	tests := []struct {
+		name     string
+		policy   []infrastructurev1alpha3.ScaleInPreference
+		expected []string
+	}{
+		{
+			name:     "no policy sorts by name",
+			expected: []string{"draining", "ondemand-new", "ondemand-old", "reserved-old"},
+		},
+		{
+			name: "draining metro, then on demand, then oldest",
+			policy: []infrastructurev1alpha3.ScaleInPreference{
+				infrastructurev1alpha3.ScaleInPreferDrainingMetro,
+				infrastructurev1alpha3.ScaleInPreferOnDemand,
+				infrastructurev1alpha3.ScaleInPreferOldest,
+			},
+			expected: []string{"draining", "ondemand-old", "ondemand-new", "reserved-old"},
+		},
+		{
+			name: "oldest, then on demand",
+			policy: []infrastructurev1alpha3.ScaleInPreference{
+				infrastructurev1alpha3.ScaleInPreferOldest,
+				infrastructurev1alpha3.ScaleInPreferOnDemand,
+			},
+			expected: []string{"ondemand-old", "reserved-old", "draining", "ondemand-new"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			c := candidates()
+			RankScaleInCandidates(c, tt.policy, []string{"sv"})
+			g.Expect(names(c)).To(Equal(tt.expected))
+		})
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// BootstrapFormat is the format of the bootstrap data of a machine.
+type BootstrapFormat string
+
+const (
+	// BootstrapFormatCloudConfig is cloud-init userdata, as generated by the
+	// kubeadm and the k0s bootstrap providers.
+	BootstrapFormatCloudConfig BootstrapFormat = "cloud-config"
+	// BootstrapFormatIgnition is an Ignition config, as read by Flatcar.
+	BootstrapFormatIgnition BootstrapFormat = "ignition"
+	// BootstrapFormatTalos is a Talos machine configuration, as generated by
+	// the Talos bootstrap provider.
+	BootstrapFormatTalos BootstrapFormat = "talos"
+
+	// bootstrapFormatKey is the key of the format in the bootstrap data
+	// secret, set by the bootstrap providers implementing the newer contract.
+	bootstrapFormatKey = "format"
+)
+
+// BootstrapDataReady reports whether the bootstrap data of the machine can be
+// read: its Machine names the bootstrap data secret, and the secret exists
+// with a value. When it can not, the message tells what is missing.
+func (m *MachineScope) BootstrapDataReady(ctx context.Context) (bool, string, error) {
+	name := m.Machine.Spec.Bootstrap.DataSecretName
+	if name == nil {
+		return false, "the Machine has no bootstrap data secret yet", nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := m.client.Get(ctx, types.NamespacedName{Namespace: m.Namespace(), Name: *name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, fmt.Sprintf("bootstrap data secret %s does not exist yet", *name), nil
+		}
+		return false, "", fmt.Errorf("failed to get the bootstrap data secret %s: %w", *name, err)
+	}
+	if len(secret.Data["value"]) == 0 {
+		return false, fmt.Sprintf("bootstrap data secret %s has no value yet", *name), nil
+	}
+	return true, "", nil
+}
+
+// GetBootstrapData returns the bootstrap data from the secret in the
+// Machine's bootstrap.dataSecretName, with its format. The format is the one
+// the bootstrap provider set in the secret, or else detected from the data.
+func (m *MachineScope) GetBootstrapData() ([]byte, BootstrapFormat, error) {
+	secret, err := m.GetBootstrapDataSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	value, ok := secret.Data["value"]
+	if !ok {
+		return nil, "", errors.New("error retrieving bootstrap data: secret value key is missing")
+	}
+
+	if format := secret.Data[bootstrapFormatKey]; len(format) > 0 {
+		return value, BootstrapFormat(format), nil
+	}
+	return value, DetectBootstrapFormat(value), nil
+}
+
+// DetectBootstrapFormat guesses the format of bootstrap data from its
+// content. Anything that is neither an Ignition config nor a Talos machine
+// configuration is handed to cloud-init, which also runs scripts.
+func DetectBootstrapFormat(data []byte) BootstrapFormat {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("#")) {
+		return BootstrapFormatCloudConfig
+	}
+
+	var fields map[string]json.RawMessage
+	if bytes.HasPrefix(data, []byte("{")) {
+		if err := json.Unmarshal(data, &fields); err == nil && fields["ignition"] != nil {
+			return BootstrapFormatIgnition
+		}
+		return BootstrapFormatCloudConfig
+	}
+
+	// a talos machine configuration is a yaml document with a version, the
+	// machine and the cluster sections
+	if err := yaml.Unmarshal(firstYAMLDocument(data), &fields); err == nil &&
+		fields["version"] != nil && fields["machine"] != nil && fields["cluster"] != nil {
+		return BootstrapFormatTalos
+	}
+	return BootstrapFormatCloudConfig
+}
+
+// firstYAMLDocument returns the first document of a multi-document yaml.
+func firstYAMLDocument(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("---\n"))
+	if i := bytes.Index(data, []byte("\n---")); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+// ValidateBootstrapData checks that rendered bootstrap data is still in its
+// format, template variables inserted without quoting can break an Ignition
+// config or a Talos machine configuration. Other formats are not checked.
+func ValidateBootstrapData(data []byte, format BootstrapFormat) error {
+	switch format {
+	case BootstrapFormatIgnition:
+		if !json.Valid(data) {
+			return errors.New("the ignition config is not valid JSON")
+		}
+	case BootstrapFormatTalos:
+		var fields map[string]interface{}
+		if err := yaml.Unmarshal(firstYAMLDocument(data), &fields); err != nil {
+			return fmt.Errorf("the talos machine configuration is not valid YAML: %w", err)
+		}
+	}
+	return nil
+}
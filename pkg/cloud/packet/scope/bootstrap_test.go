@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const talosConfig = `version: v1alpha1
+machine:
+  type: worker
+  token: abcdef.0123456789abcdef
+cluster:
+  controlPlane:
+    endpoint: https://147.75.1.1:6443
+`
+
+func TestDetectBootstrapFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want BootstrapFormat
+	}{
+		{name: "cloud-config", data: "#cloud-config\nruncmd:\n- kubeadm join\n", want: BootstrapFormatCloudConfig},
+		{name: "shell script", data: "#!/bin/bash\nk0s install worker\n", want: BootstrapFormatCloudConfig},
+		{name: "ignition", data: `{"ignition":{"version":"3.1.0"}}`, want: BootstrapFormatIgnition},
+		{name: "json without ignition", data: `{"hostname":"worker-0"}`, want: BootstrapFormatCloudConfig},
+		{name: "talos", data: talosConfig, want: BootstrapFormatTalos},
+		{name: "talos multi-document", data: "---\n" + talosConfig + "---\napiVersion: v1alpha1\nkind: ExtensionServiceConfig\n", want: BootstrapFormatTalos},
+		{name: "yaml without the talos sections", data: "machine:\n  type: worker\n", want: BootstrapFormatCloudConfig},
+		{name: "empty", data: "", want: BootstrapFormatCloudConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(DetectBootstrapFormat([]byte(tt.data))).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestValidateBootstrapData(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		format  BootstrapFormat
+		wantErr bool
+	}{
+		{name: "valid ignition", data: `{"ignition":{"version":"3.1.0"}}`, format: BootstrapFormatIgnition},
+		{name: "invalid ignition", data: `{"ignition":{"version":"3.1.0"},"ca":-----BEGIN CERTIFICATE-----}`, format: BootstrapFormatIgnition, wantErr: true},
+		{name: "valid talos", data: talosConfig, format: BootstrapFormatTalos},
+		{name: "invalid talos", data: "version: v1alpha1\nmachine:\n  ca: -----BEGIN CERTIFICATE-----\nMIIB\n  key: [\n", format: BootstrapFormatTalos, wantErr: true},
+		{name: "cloud-config is not checked", data: "#cloud-config\n{{{", format: BootstrapFormatCloudConfig},
+		{name: "unknown formats are not checked", data: "{{{", format: BootstrapFormat("custom")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateBootstrapData([]byte(tt.data), tt.format)
+			g.Expect(err != nil).To(Equal(tt.wantErr), "unexpected error %v", err)
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"k8s.io/klog/v2/klogr"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -78,7 +79,28 @@ type ClusterScope struct {
 
 // Close closes the current scope persisting the cluster configuration and status.
 func (s *ClusterScope) Close() error {
-	return s.patchHelper.Patch(context.TODO(), s.PacketCluster)
+	// always update the readyCondition.
+	conditions.SetSummary(s.PacketCluster,
+		conditions.WithConditions(
+			infrav1.ProjectReadyCondition,
+			infrav1.EndpointReadyCondition,
+			infrav1.APIPermissionsVerifiedCondition,
+		),
+	)
+
+	return s.patchHelper.Patch(context.TODO(), s.PacketCluster,
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.EndpointReadyCondition,
+			infrav1.MaintenanceModeCondition,
+			infrav1.DNSRecordsReadyCondition,
+			infrav1.CloudIntegrationReadyCondition,
+			infrav1.MetroConfiguredCondition,
+			infrav1.DeviceCreationAllowedCondition,
+			infrav1.BGPConfiguredCondition,
+			infrav1.ProjectReadyCondition,
+		}},
+	)
 }
 
 // Name returns the cluster name.
@@ -95,3 +117,88 @@ func (s *ClusterScope) Namespace() string {
 func (s *ClusterScope) SetReady() {
 	s.PacketCluster.Status.Ready = true
 }
+
+// PacketMachines returns the PacketMachines of the cluster.
+func (s *ClusterScope) PacketMachines(ctx context.Context) ([]infrav1.PacketMachine, error) {
+	machines := &infrav1.PacketMachineList{}
+	if err := s.client.List(ctx, machines,
+		client.InNamespace(s.Namespace()),
+		client.MatchingLabels{clusterv1.ClusterLabelName: s.Name()}); err != nil {
+		return nil, errors.Wrap(err, "failed to list PacketMachines")
+	}
+	return machines.Items, nil
+}
+
+// MachineFacilities returns how many PacketMachines of the cluster are placed
+// in each facility. Only control plane machines are counted when controlPlane
+// is true, only workers otherwise. The machines whose placement is pending,
+// such as the one being placed, are not counted.
+func (s *ClusterScope) MachineFacilities(ctx context.Context, controlPlane bool) (map[string]int, error) {
+	machines := &infrav1.PacketMachineList{}
+	if err := s.client.List(ctx, machines,
+		client.InNamespace(s.Namespace()),
+		client.MatchingLabels{clusterv1.ClusterLabelName: s.Name()}); err != nil {
+		return nil, errors.Wrap(err, "failed to list PacketMachines")
+	}
+
+	counts := map[string]int{}
+	for _, m := range machines.Items {
+		if _, ok := m.Labels[clusterv1.MachineControlPlaneLabelName]; ok != controlPlane {
+			continue
+		}
+		if facility, ok := placedFacility(&m); ok {
+			counts[facility]++
+		}
+	}
+	return counts, nil
+}
+
+// NodeGroupFacilities returns how many PacketMachines of the node group of
+// packetMachine, itself left out, are placed in each facility. The node group
+// is the MachineDeployment or the MachineSet of the machine, told by the
+// labels Cluster API copies to the PacketMachines, or else its role.
+func (s *ClusterScope) NodeGroupFacilities(ctx context.Context, packetMachine *infrav1.PacketMachine) (map[string]int, error) {
+	selector := client.MatchingLabels{clusterv1.ClusterLabelName: s.Name()}
+	if name, ok := packetMachine.Labels[clusterv1.MachineDeploymentLabelName]; ok {
+		selector[clusterv1.MachineDeploymentLabelName] = name
+	} else if name, ok := packetMachine.Labels[clusterv1.MachineSetLabelName]; ok {
+		selector[clusterv1.MachineSetLabelName] = name
+	}
+	machines := &infrav1.PacketMachineList{}
+	if err := s.client.List(ctx, machines, client.InNamespace(s.Namespace()), selector); err != nil {
+		return nil, errors.Wrap(err, "failed to list PacketMachines")
+	}
+
+	_, controlPlane := packetMachine.Labels[clusterv1.MachineControlPlaneLabelName]
+	counts := map[string]int{}
+	for _, m := range machines.Items {
+		if _, ok := m.Labels[clusterv1.MachineControlPlaneLabelName]; ok != controlPlane || m.Name == packetMachine.Name {
+			continue
+		}
+		if facility, ok := placedFacility(&m); ok {
+			counts[facility]++
+		}
+	}
+	return counts, nil
+}
+
+// placedFacility returns the facility a PacketMachine is placed in, or is
+// bound to, false while its placement is pending.
+func placedFacility(m *infrav1.PacketMachine) (string, bool) {
+	if m.Status.Facility != "" {
+		return m.Status.Facility, true
+	}
+	return m.Spec.Facility, m.Spec.Facility != ""
+}
+
+// MachineFacility returns the facility a PacketMachine is, or is going to be,
+// placed in.
+func (s *ClusterScope) MachineFacility(m *infrav1.PacketMachine) string {
+	if m.Status.Facility != "" {
+		return m.Status.Facility
+	}
+	if m.Spec.Facility != "" {
+		return m.Spec.Facility
+	}
+	return s.PacketCluster.Spec.Facility
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake" //nolint:staticcheck
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestMachineFacilities(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	machine := func(name, specFacility, statusFacility string) *infrav1.PacketMachine {
+		return &infrav1.PacketMachine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: map[string]string{
+				clusterv1.ClusterLabelName:             "capi",
+				clusterv1.MachineControlPlaneLabelName: "",
+			}},
+			Spec:   infrav1.PacketMachineSpec{Facility: specFacility},
+			Status: infrav1.PacketMachineStatus{Facility: statusFacility},
+		}
+	}
+	packetCluster := &infrav1.PacketCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "capi"},
+		Spec:       infrav1.PacketClusterSpec{Facility: "ewr1"},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, packetCluster,
+		machine("placed", "", "sjc1"),
+		machine("bound", "ny5", ""),
+		// being placed, it does not count in the cluster facility
+		machine("pending", "", ""),
+	)
+	clusterScope, err := NewClusterScope(ClusterScopeParams{
+		Client:        c,
+		Cluster:       &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "capi"}},
+		PacketCluster: packetCluster,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	counts, err := clusterScope.MachineFacilities(context.Background(), true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(counts).To(Equal(map[string]int{"sjc1": 1, "ny5": 1}))
+
+	counts, err = clusterScope.MachineFacilities(context.Background(), false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(counts).To(BeEmpty())
+}
@@ -18,10 +18,13 @@ package scope
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
@@ -29,6 +32,8 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	bootstraputil "k8s.io/cluster-bootstrap/token/util"
 	"k8s.io/klog/v2/klogr"
 	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -37,7 +42,9 @@ import (
 	"sigs.k8s.io/cluster-api/controllers/remote"
 	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/secret"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	infrav1 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
@@ -46,6 +53,9 @@ import (
 const (
 	providerIDPrefix           = "equinixmetal"
 	deprecatedProviderIDPrefix = "packet"
+
+	// BootstrapCallbackTokenKey is the key of the bootstrap callback token in its secret.
+	BootstrapCallbackTokenKey = "token"
 )
 
 var (
@@ -58,7 +68,10 @@ var (
 
 // MachineScopeParams defines the input parameters used to create a new MachineScope.
 type MachineScopeParams struct {
-	Client        client.Client
+	Client client.Client
+	// Reader reads the ConfigMaps of the template values from the API server,
+	// the manager does not cache ConfigMaps. It defaults to Client.
+	Reader        client.Reader
 	Logger        logr.Logger
 	Cluster       *clusterv1.Cluster
 	Machine       *clusterv1.Machine
@@ -91,6 +104,12 @@ func NewMachineScope(ctx context.Context, params MachineScopeParams) (*MachineSc
 	if params.Logger == nil {
 		params.Logger = klogr.New()
 	}
+	if params.Reader == nil {
+		params.Reader = params.Client
+	}
+	if params.workloadClientGetter == nil {
+		params.workloadClientGetter = remote.NewClusterClient
+	}
 
 	providerIDPrefix, err := getProviderIDPrefix(ctx, params.Client, params.workloadClientGetter,
 		params.Cluster, params.Machine, params.PacketMachine)
@@ -103,10 +122,12 @@ func NewMachineScope(ctx context.Context, params MachineScopeParams) (*MachineSc
 		return nil, fmt.Errorf("failed to init patch helper: %w", err)
 	}
 	return &MachineScope{
-		Logger:           params.Logger,
-		client:           params.Client,
-		patchHelper:      helper,
-		providerIDPrefix: providerIDPrefix,
+		Logger:               params.Logger,
+		client:               params.Client,
+		reader:               params.Reader,
+		patchHelper:          helper,
+		providerIDPrefix:     providerIDPrefix,
+		workloadClientGetter: params.workloadClientGetter,
 
 		Cluster:       params.Cluster,
 		Machine:       params.Machine,
@@ -118,9 +139,11 @@ func NewMachineScope(ctx context.Context, params MachineScopeParams) (*MachineSc
 // MachineScope defines a scope defined around a machine and its cluster.
 type MachineScope struct {
 	logr.Logger
-	client           client.Client
-	patchHelper      *patch.Helper
-	providerIDPrefix string
+	client               client.Client
+	reader               client.Reader
+	patchHelper          *patch.Helper
+	providerIDPrefix     string
+	workloadClientGetter remote.ClusterClientGetter
 
 	Cluster       *clusterv1.Cluster
 	Machine       *clusterv1.Machine
@@ -130,7 +153,38 @@ type MachineScope struct {
 
 // Close the MachineScope by updating the machine spec, machine status.
 func (m *MachineScope) Close() error {
-	return m.patchHelper.Patch(context.TODO(), m.PacketMachine)
+	summaryConditions := []clusterv1.ConditionType{
+		infrav1.DeviceReadyCondition,
+		infrav1.NetworkConfiguredCondition,
+	}
+	// BootstrapSucceeded is only set when the bootstrap callback is enabled,
+	// UserDataVerified for the devices the userdata digest was recorded for,
+	// NodeJoined when the node readiness check is enabled.
+	for _, t := range []clusterv1.ConditionType{infrav1.BootstrapSucceededCondition, infrav1.UserDataVerifiedCondition, infrav1.NodeJoinedCondition} {
+		if conditions.Has(m.PacketMachine, t) {
+			summaryConditions = append(summaryConditions, t)
+		}
+	}
+
+	// always update the readyCondition; the summary is represented using the "1 of x completed" notation.
+	conditions.SetSummary(m.PacketMachine,
+		conditions.WithConditions(summaryConditions...),
+		conditions.WithStepCounterIf(m.PacketMachine.ObjectMeta.DeletionTimestamp.IsZero()),
+	)
+
+	return m.patchHelper.Patch(context.TODO(), m.PacketMachine,
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.DeviceReadyCondition,
+			infrav1.NetworkConfiguredCondition,
+			infrav1.BootstrapSucceededCondition,
+			infrav1.UserDataVerifiedCondition,
+			infrav1.DNSRecordsReadyCondition,
+			infrav1.DeviceRequestSyncedCondition,
+			infrav1.RescueModeCondition,
+			infrav1.NodeInitializedCondition,
+		}},
+	)
 }
 
 // Name returns the PacketMachine name
@@ -189,6 +243,20 @@ func (m *MachineScope) SetInstanceStatus(v infrav1.PacketResourceStatus) {
 	m.PacketMachine.Status.InstanceStatus = &v
 }
 
+// SetUserDataHash records in the status the sha256 digest of the userdata
+// the device was created with.
+func (m *MachineScope) SetUserDataHash(v string) {
+	m.PacketMachine.Status.UserDataHash = v
+}
+
+// SetDeviceRequest records the request the device was created with.
+func (m *MachineScope) SetDeviceRequest(v string) {
+	if m.PacketMachine.Annotations == nil {
+		m.PacketMachine.Annotations = map[string]string{}
+	}
+	m.PacketMachine.Annotations[infrav1.DeviceRequestAnnotation] = v
+}
+
 // SetReady sets the PacketMachine Ready Status
 func (m *MachineScope) SetReady() {
 	m.PacketMachine.Status.Ready = true
@@ -209,6 +277,21 @@ func (m *MachineScope) SetAddresses(addrs []corev1.NodeAddress) {
 	m.PacketMachine.Status.Addresses = addrs
 }
 
+// RecordDeviceEvent appends a step to the timeline of the device, unless it is
+// the last one recorded already. The oldest steps are dropped once the
+// timeline holds infrav1.MaxDeviceTimelineEvents.
+func (m *MachineScope) RecordDeviceEvent(eventType infrav1.DeviceEventType, message string) {
+	timeline := m.PacketMachine.Status.Timeline
+	if n := len(timeline); n > 0 && timeline[n-1].Type == eventType && timeline[n-1].Message == message {
+		return
+	}
+	timeline = append(timeline, infrav1.DeviceEvent{Type: eventType, Time: metav1.Now(), Message: message})
+	if len(timeline) > infrav1.MaxDeviceTimelineEvents {
+		timeline = timeline[len(timeline)-infrav1.MaxDeviceTimelineEvents:]
+	}
+	m.PacketMachine.Status.Timeline = timeline
+}
+
 // AdditionalTags returns Tags from the scope's PacketMachine. The returned value will never be nil.
 func (m *MachineScope) Tags() infrav1.Tags {
 	if m.PacketMachine.Spec.Tags == nil {
@@ -220,6 +303,12 @@ func (m *MachineScope) Tags() infrav1.Tags {
 
 // GetRawBootstrapData returns the bootstrap data from the secret in the Machine's bootstrap.dataSecretName.
 func (m *MachineScope) GetRawBootstrapData() ([]byte, error) {
+	value, _, err := m.GetBootstrapData()
+	return value, err
+}
+
+// GetBootstrapDataSecret returns the secret referenced by the Machine's bootstrap.dataSecretName.
+func (m *MachineScope) GetBootstrapDataSecret() (*corev1.Secret, error) {
 	if m.Machine.Spec.Bootstrap.DataSecretName == nil {
 		return nil, errors.New("error retrieving bootstrap data: linked Machine's bootstrap.dataSecretName is nil")
 	}
@@ -230,12 +319,247 @@ func (m *MachineScope) GetRawBootstrapData() ([]byte, error) {
 		return nil, fmt.Errorf("failed to retrieve bootstrap data secret for PacketMachine %s/%s: %w", m.Namespace(), m.Name(), err)
 	}
 
-	value, ok := secret.Data["value"]
-	if !ok {
-		return nil, errors.New("error retrieving bootstrap data: secret value key is missing")
+	return secret, nil
+}
+
+// GetBootstrapTokenExpiration returns when the bootstrap token the machine
+// joins the cluster with expires in the workload cluster. A nil time is
+// returned when the machine does not join through a KubeadmConfig bootstrap token.
+// A token already removed from the workload cluster, as the token cleaner
+// does once it expired, is reported expired with the zero time.
+func (m *MachineScope) GetBootstrapTokenExpiration(ctx context.Context) (*time.Time, error) {
+	configRef := m.Machine.Spec.Bootstrap.ConfigRef
+	if configRef == nil || configRef.Kind != "KubeadmConfig" {
+		return nil, nil
+	}
+
+	kubeadmConfig := new(bootstrapv1.KubeadmConfig)
+	if err := m.client.Get(ctx, client.ObjectKey{Namespace: m.Namespace(), Name: configRef.Name}, kubeadmConfig); err != nil {
+		return nil, fmt.Errorf("failed to get bootstrap resource: %w", err)
+	}
+
+	join := kubeadmConfig.Spec.JoinConfiguration
+	if join == nil || join.Discovery.BootstrapToken == nil {
+		return nil, nil
+	}
+
+	substrs := bootstraputil.BootstrapTokenRegexp.FindStringSubmatch(join.Discovery.BootstrapToken.Token)
+	if len(substrs) != 3 {
+		return nil, fmt.Errorf("the bootstrap token of KubeadmConfig %s/%s is not of the form %q", m.Namespace(), configRef.Name, bootstrapapi.BootstrapTokenPattern)
+	}
+
+	key, err := client.ObjectKeyFromObject(m.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key from cluster: %w", err)
+	}
+
+	workloadClient, err := m.workloadClientGetter(ctx, m.client, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workload cluster client: %w", err)
+	}
+
+	tokenSecret := &corev1.Secret{}
+	tokenKey := client.ObjectKey{
+		Namespace: metav1.NamespaceSystem,
+		Name:      bootstrapapi.BootstrapTokenSecretPrefix + substrs[1],
+	}
+	if err := workloadClient.Get(ctx, tokenKey, tokenSecret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return &time.Time{}, nil
+		}
+		return nil, fmt.Errorf("failed to query workload cluster for %s: %w", tokenKey.String(), err)
+	}
+
+	expiration, err := time.Parse(time.RFC3339, string(tokenSecret.Data[bootstrapapi.BootstrapTokenExpirationKey]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the expiration of bootstrap token %s: %w", tokenKey.String(), err)
 	}
 
-	return value, nil
+	return &expiration, nil
+}
+
+// GetNodeByProviderID returns the node of the workload cluster with
+// providerID. It returns nil when no node registered with it yet. The Machine
+// only references its node once its infrastructure is ready, so the node is
+// looked up by provider ID.
+func (m *MachineScope) GetNodeByProviderID(ctx context.Context, providerID string) (*corev1.Node, error) {
+	key, err := client.ObjectKeyFromObject(m.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key from cluster: %w", err)
+	}
+
+	workloadClient, err := m.workloadClientGetter(ctx, m.client, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workload cluster client: %w", err)
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := workloadClient.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("failed to list the nodes of the workload cluster: %w", err)
+	}
+	for i := range nodes.Items {
+		if nodes.Items[i].Spec.ProviderID == providerID {
+			return &nodes.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// RemoveNodeTaint removes the taints with key from the node of the machine in
+// the workload cluster. It returns whether the node had one.
+func (m *MachineScope) RemoveNodeTaint(ctx context.Context, nodeName, taintKey string) (bool, error) {
+	key, err := client.ObjectKeyFromObject(m.Cluster)
+	if err != nil {
+		return false, fmt.Errorf("failed to get key from cluster: %w", err)
+	}
+
+	workloadClient, err := m.workloadClientGetter(ctx, m.client, key, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get workload cluster client: %w", err)
+	}
+
+	node := &corev1.Node{}
+	if err := workloadClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return false, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	taints := []corev1.Taint{}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key != taintKey {
+			taints = append(taints, taint)
+		}
+	}
+	if len(taints) == len(node.Spec.Taints) {
+		return false, nil
+	}
+
+	nodePatch := client.MergeFrom(node.DeepCopy())
+	node.Spec.Taints = taints
+	if err := workloadClient.Patch(ctx, node, nodePatch); err != nil {
+		return false, fmt.Errorf("failed to remove taint %s from node %s: %w", taintKey, nodeName, err)
+	}
+	return true, nil
+}
+
+// SetNodeLabels replaces the labels under prefix of the node of the machine
+// in the workload cluster with labels. It returns whether the node changed.
+func (m *MachineScope) SetNodeLabels(ctx context.Context, nodeName, prefix string, labels map[string]string) (bool, error) {
+	key, err := client.ObjectKeyFromObject(m.Cluster)
+	if err != nil {
+		return false, fmt.Errorf("failed to get key from cluster: %w", err)
+	}
+
+	workloadClient, err := m.workloadClientGetter(ctx, m.client, key, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get workload cluster client: %w", err)
+	}
+
+	node := &corev1.Node{}
+	if err := workloadClient.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return false, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	nodePatch := client.MergeFrom(node.DeepCopy())
+	changed := false
+	for name := range node.Labels {
+		if _, ok := labels[name]; strings.HasPrefix(name, prefix) && !ok {
+			delete(node.Labels, name)
+			changed = true
+		}
+	}
+	for name, value := range labels {
+		if current, ok := node.Labels[name]; !ok || current != value {
+			if node.Labels == nil {
+				node.Labels = map[string]string{}
+			}
+			node.Labels[name] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if err := workloadClient.Patch(ctx, node, nodePatch); err != nil {
+		return false, fmt.Errorf("failed to label node %s: %w", nodeName, err)
+	}
+	return true, nil
+}
+
+// GetClusterCACertificate returns the PEM encoded certificate of the cluster
+// certificate authority. It returns nil when the CA secret does not exist.
+func (m *MachineScope) GetClusterCACertificate(ctx context.Context) ([]byte, error) {
+	key, err := client.ObjectKeyFromObject(m.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key from cluster: %w", err)
+	}
+
+	caSecret, err := secret.GetFromNamespacedName(ctx, m.client, key, secret.ClusterCA)
+	if err != nil {
+		var apiError *apierrors.StatusError
+		if errors.As(err, &apiError) && apierrors.IsNotFound(apiError) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve the CA secret of cluster %s: %w", key.String(), err)
+	}
+
+	return caSecret.Data[secret.TLSCrtDataName], nil
+}
+
+// BootstrapCallbackSecretName returns the name of the secret holding the
+// token a PacketMachine authenticates its bootstrap callback with.
+func BootstrapCallbackSecretName(packetMachineName string) string {
+	return fmt.Sprintf("%s-bootstrap-callback", packetMachineName)
+}
+
+// GetBootstrapCallbackToken returns the token the device authenticates its
+// bootstrap callback with. The token is generated on first use and stored in
+// a secret owned by the PacketMachine and labeled with its cluster.
+func (m *MachineScope) GetBootstrapCallbackToken(ctx context.Context) (string, error) {
+	key := types.NamespacedName{Namespace: m.Namespace(), Name: BootstrapCallbackSecretName(m.Name())}
+	tokenSecret := &corev1.Secret{}
+	err := m.client.Get(ctx, key, tokenSecret)
+	switch {
+	case err == nil:
+		// the secrets created before they were labeled get the label too
+		if tokenSecret.Labels[clusterv1.ClusterLabelName] != m.Cluster.Name {
+			base := client.MergeFrom(tokenSecret.DeepCopy())
+			if tokenSecret.Labels == nil {
+				tokenSecret.Labels = map[string]string{}
+			}
+			tokenSecret.Labels[clusterv1.ClusterLabelName] = m.Cluster.Name
+			if err := m.client.Patch(ctx, tokenSecret, base); err != nil {
+				return "", fmt.Errorf("failed to label bootstrap callback secret for PacketMachine %s/%s: %w", m.Namespace(), m.Name(), err)
+			}
+		}
+		return string(tokenSecret.Data[BootstrapCallbackTokenKey]), nil
+	case !apierrors.IsNotFound(err):
+		return "", fmt.Errorf("failed to retrieve bootstrap callback secret for PacketMachine %s/%s: %w", m.Namespace(), m.Name(), err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate bootstrap callback token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	tokenSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Labels: map[string]string{
+				clusterv1.ClusterLabelName: m.Cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(m.PacketMachine, infrav1.GroupVersion.WithKind("PacketMachine")),
+			},
+		},
+		Data: map[string][]byte{
+			BootstrapCallbackTokenKey: []byte(token),
+		},
+	}
+	if err := m.client.Create(ctx, tokenSecret); err != nil {
+		return "", fmt.Errorf("failed to create bootstrap callback secret for PacketMachine %s/%s: %w", m.Namespace(), m.Name(), err)
+	}
+	return token, nil
 }
 
 // getProviderIDPrefix attempts to determine what providerID prefix should be used for this PacketMachine based on the following precedence:
@@ -334,10 +658,6 @@ func providerIDFromKubeadmConfig(ctx context.Context, mgmtClient client.Client,
 // prefix should be used based on the deployed cloud provider. If it detects packet-ccm, then it should return "packet", if it detects
 // cloud-provider-equinix-metal, then it should return "equinixmetal", otherwise it should return "".
 func providerIDFromCloudProviderDeployments(ctx context.Context, mgmtClient client.Client, workloadClientGetter remote.ClusterClientGetter, cluster *clusterv1.Cluster) (string, error) {
-	if workloadClientGetter == nil {
-		workloadClientGetter = remote.NewClusterClient
-	}
-
 	key, err := client.ObjectKeyFromObject(cluster)
 	if err != nil {
 		return "", fmt.Errorf("failed to get key from cluster: %w", err)
@@ -21,12 +21,14 @@ import (
 	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/utils/pointer"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
@@ -495,3 +497,375 @@ func testNewMachineScopeCloudProviderDeployed(t *testing.T, deploymentName, expe
 	g.Expect(actualPacketMachine.Spec.ProviderID).NotTo(BeNil())
 	g.Expect(*actualPacketMachine.Spec.ProviderID).To(BeEquivalentTo(expectedProviderID))
 }
+
+func TestGetBootstrapTokenExpiration(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	namespace := util.RandomString(generatedNameLength)
+	expiration := time.Now().UTC().Add(10 * time.Minute).Truncate(time.Second)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(bootstrapv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	initialKubeadmConfig := &bootstrapv1.KubeadmConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      util.RandomString(generatedNameLength),
+		},
+		Spec: bootstrapv1.KubeadmConfigSpec{
+			JoinConfiguration: &kubeadmv1beta1.JoinConfiguration{
+				Discovery: kubeadmv1beta1.Discovery{
+					BootstrapToken: &kubeadmv1beta1.BootstrapTokenDiscovery{
+						Token: "abcdef.0123456789abcdef",
+					},
+				},
+			},
+		},
+	}
+
+	initialMachine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      util.RandomString(generatedNameLength),
+		},
+		Spec: clusterv1.MachineSpec{
+			Bootstrap: clusterv1.Bootstrap{
+				ConfigRef: &corev1.ObjectReference{
+					APIVersion: bootstrapv1.GroupVersion.String(),
+					Kind:       "KubeadmConfig",
+					Namespace:  namespace,
+					Name:       initialKubeadmConfig.Name,
+				},
+			},
+		},
+	}
+
+	initialPacketMachine := &infrav1.PacketMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      util.RandomString(generatedNameLength),
+		},
+		Spec: infrav1.PacketMachineSpec{
+			ProviderID: pointer.StringPtr("equinixmetal://" + util.RandomString(generatedNameLength)),
+		},
+	}
+
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: metav1.NamespaceSystem,
+			Name:      "bootstrap-token-abcdef",
+		},
+		Data: map[string][]byte{
+			"expiration": []byte(expiration.Format(time.RFC3339)),
+		},
+	}
+
+	fakeClient := fake.NewFakeClientWithScheme(scheme, initialPacketMachine.DeepCopy(), initialKubeadmConfig.DeepCopy())
+	fakeWorkloadClient := fake.NewFakeClient(tokenSecret)
+
+	machineScope, err := NewMachineScope(ctx, MachineScopeParams{
+		Client:        fakeClient,
+		Cluster:       new(clusterv1.Cluster),
+		Machine:       initialMachine.DeepCopy(),
+		PacketCluster: new(infrav1.PacketCluster),
+		PacketMachine: initialPacketMachine.DeepCopy(),
+		workloadClientGetter: func(_ context.Context, _ client.Client, _ client.ObjectKey, _ *runtime.Scheme) (client.Client, error) {
+			return fakeWorkloadClient, nil
+		},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	actual, err := machineScope.GetBootstrapTokenExpiration(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(actual).NotTo(BeNil())
+	g.Expect(actual.Equal(expiration)).To(BeTrue())
+
+	// A token the token cleaner already removed is expired
+	g.Expect(fakeWorkloadClient.Delete(ctx, tokenSecret)).To(Succeed())
+	actual, err = machineScope.GetBootstrapTokenExpiration(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(actual).NotTo(BeNil())
+	g.Expect(actual.After(time.Now())).To(BeFalse())
+
+	// Machines joining without a bootstrap token have nothing to check
+	machineScope.Machine.Spec.Bootstrap.ConfigRef = nil
+	actual, err = machineScope.GetBootstrapTokenExpiration(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(actual).To(BeNil())
+}
+
+func TestGetBootstrapCallbackToken(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	namespace := util.RandomString(generatedNameLength)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	newScope := func(c client.Client, name string) *MachineScope {
+		machineScope, err := NewMachineScope(ctx, MachineScopeParams{
+			Client:        c,
+			Cluster:       &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "capi"}},
+			Machine:       &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}},
+			PacketCluster: new(infrav1.PacketCluster),
+			PacketMachine: &infrav1.PacketMachine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+				Spec:       infrav1.PacketMachineSpec{ProviderID: pointer.StringPtr("equinixmetal://" + name)},
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		return machineScope
+	}
+
+	// a secret created before the secrets were labeled
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: BootstrapCallbackSecretName("existing")},
+		Data:       map[string][]byte{BootstrapCallbackTokenKey: []byte("token")},
+	}
+	fakeClient := fake.NewFakeClientWithScheme(scheme, existing)
+
+	token, err := newScope(fakeClient, "existing").GetBootstrapCallbackToken(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(token).To(Equal("token"))
+	secret := &corev1.Secret{}
+	g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: existing.Name}, secret)).To(Succeed())
+	g.Expect(secret.Labels).To(HaveKeyWithValue(clusterv1.ClusterLabelName, "capi"))
+
+	token, err = newScope(fakeClient, "new").GetBootstrapCallbackToken(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(token).To(HaveLen(64))
+	g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: BootstrapCallbackSecretName("new")}, secret)).To(Succeed())
+	g.Expect(secret.Labels).To(HaveKeyWithValue(clusterv1.ClusterLabelName, "capi"))
+	g.Expect(secret.OwnerReferences).To(HaveLen(1))
+}
+
+func TestBootstrapDataReady(t *testing.T) {
+	namespace := util.RandomString(generatedNameLength)
+	secret := func(value string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "bootstrap"},
+			Data:       map[string][]byte{"value": []byte(value)},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		secretName *string
+		secret     *corev1.Secret
+		want       bool
+		wantReason string
+	}{
+		{
+			name:       "no bootstrap data secret name",
+			wantReason: "the Machine has no bootstrap data secret yet",
+		},
+		{
+			name:       "missing secret",
+			secretName: pointer.StringPtr("bootstrap"),
+			wantReason: "bootstrap data secret bootstrap does not exist yet",
+		},
+		{
+			name:       "empty secret",
+			secretName: pointer.StringPtr("bootstrap"),
+			secret:     secret(""),
+			wantReason: "bootstrap data secret bootstrap has no value yet",
+		},
+		{
+			name:       "ready",
+			secretName: pointer.StringPtr("bootstrap"),
+			secret:     secret("#cloud-config"),
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			scheme := runtime.NewScheme()
+			g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+			g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			packetMachine := &infrav1.PacketMachine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "worker-0"},
+			}
+			objs := []runtime.Object{packetMachine.DeepCopy()}
+			if tt.secret != nil {
+				objs = append(objs, tt.secret)
+			}
+			machine := &clusterv1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "worker-0"},
+				Spec: clusterv1.MachineSpec{
+					Bootstrap: clusterv1.Bootstrap{DataSecretName: tt.secretName},
+				},
+			}
+
+			machineScope, err := NewMachineScope(ctx, MachineScopeParams{
+				Client:        fake.NewFakeClientWithScheme(scheme, objs...),
+				Cluster:       new(clusterv1.Cluster),
+				Machine:       machine,
+				PacketCluster: new(infrav1.PacketCluster),
+				PacketMachine: packetMachine,
+				workloadClientGetter: func(_ context.Context, _ client.Client, _ client.ObjectKey, _ *runtime.Scheme) (client.Client, error) {
+					return fake.NewFakeClient(), nil
+				},
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			ready, reason, err := machineScope.BootstrapDataReady(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ready).To(Equal(tt.want))
+			g.Expect(reason).To(Equal(tt.wantReason))
+		})
+	}
+}
+
+func TestGetTemplateValues(t *testing.T) {
+	namespace := util.RandomString(generatedNameLength)
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "registry"},
+		Data:       map[string]string{"mirror": "mirror.internal:5000"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "license"},
+		Data:       map[string][]byte{"key": []byte("s3cr3t")},
+	}
+	configMapRef := func(name, key string, optional bool) *corev1.ConfigMapKeySelector {
+		return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key, Optional: pointer.BoolPtr(optional)}
+	}
+	secretRef := func(name, key string) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	tests := []struct {
+		name       string
+		sources    []infrav1.TemplateValueSource
+		want       map[string]string
+		wantReason string
+	}{
+		{
+			name: "no template values",
+			want: map[string]string{},
+		},
+		{
+			name: "values",
+			sources: []infrav1.TemplateValueSource{
+				{Name: "registryMirror", ConfigMapKeyRef: configMapRef("registry", "mirror", false)},
+				{Name: "licenseKey", SecretKeyRef: secretRef("license", "key")},
+			},
+			want: map[string]string{"registryMirror": "mirror.internal:5000", "licenseKey": "s3cr3t"},
+		},
+		{
+			name: "missing optional values",
+			sources: []infrav1.TemplateValueSource{
+				{Name: "proxy", ConfigMapKeyRef: configMapRef("proxy", "url", true)},
+				{Name: "registryAuth", ConfigMapKeyRef: configMapRef("registry", "auth", true)},
+			},
+			want: map[string]string{"proxy": "", "registryAuth": ""},
+		},
+		{
+			name:       "missing object",
+			sources:    []infrav1.TemplateValueSource{{Name: "licenseKey", SecretKeyRef: secretRef("licence", "key")}},
+			wantReason: "Secret licence of template value licenseKey does not exist",
+		},
+		{
+			name:       "missing key",
+			sources:    []infrav1.TemplateValueSource{{Name: "registryAuth", ConfigMapKeyRef: configMapRef("registry", "auth", false)}},
+			wantReason: "ConfigMap registry of template value registryAuth has no key auth",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+
+			scheme := runtime.NewScheme()
+			g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+			g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+			packetMachine := &infrav1.PacketMachine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "worker-0"},
+				Spec:       infrav1.PacketMachineSpec{TemplateValuesFrom: tt.sources},
+			}
+			machineScope, err := NewMachineScope(ctx, MachineScopeParams{
+				Client:        fake.NewFakeClientWithScheme(scheme, packetMachine.DeepCopy(), configMap, secret),
+				Cluster:       new(clusterv1.Cluster),
+				Machine:       &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "worker-0"}},
+				PacketCluster: new(infrav1.PacketCluster),
+				PacketMachine: packetMachine,
+				workloadClientGetter: func(_ context.Context, _ client.Client, _ client.ObjectKey, _ *runtime.Scheme) (client.Client, error) {
+					return fake.NewFakeClient(), nil
+				},
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			values, reason, err := machineScope.GetTemplateValues(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(reason).To(Equal(tt.wantReason))
+			if tt.wantReason == "" {
+				g.Expect(values).To(Equal(tt.want))
+			}
+		})
+	}
+}
+
+func TestRecordDeviceEvent(t *testing.T) {
+	g := NewWithT(t)
+	machineScope := &MachineScope{PacketMachine: new(infrav1.PacketMachine)}
+
+	machineScope.RecordDeviceEvent(infrav1.DeviceEventCreateRequested, "")
+	machineScope.RecordDeviceEvent(infrav1.DeviceEventProvisioning, "")
+	// the steps observed again by later reconciliations are recorded once
+	machineScope.RecordDeviceEvent(infrav1.DeviceEventProvisioning, "")
+	machineScope.RecordDeviceEvent(infrav1.DeviceEventAddressAssigned, "10.0.0.1")
+	machineScope.RecordDeviceEvent(infrav1.DeviceEventAddressAssigned, "10.0.0.2")
+
+	timeline := machineScope.PacketMachine.Status.Timeline
+	g.Expect(timeline).To(HaveLen(4))
+	g.Expect(timeline[0].Type).To(Equal(infrav1.DeviceEventCreateRequested))
+	g.Expect(timeline[0].Time.IsZero()).To(BeFalse())
+	g.Expect(timeline[3].Message).To(Equal("10.0.0.2"))
+
+	for i := 0; i < infrav1.MaxDeviceTimelineEvents; i++ {
+		machineScope.RecordDeviceEvent(infrav1.DeviceEventReinstalling, fmt.Sprint(i))
+	}
+	timeline = machineScope.PacketMachine.Status.Timeline
+	g.Expect(timeline).To(HaveLen(infrav1.MaxDeviceTimelineEvents))
+	g.Expect(timeline[0].Message).To(Equal("0"))
+	g.Expect(timeline[len(timeline)-1].Message).To(Equal(fmt.Sprint(infrav1.MaxDeviceTimelineEvents - 1)))
+}
+
+func TestGetNodeByProviderID(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+		Spec:       corev1.NodeSpec{ProviderID: "equinixmetal://device"},
+	}
+	fakeWorkloadClient := fake.NewFakeClient(node, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+	machineScope := &MachineScope{
+		client:  fake.NewFakeClient(),
+		Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+		workloadClientGetter: func(_ context.Context, _ client.Client, _ client.ObjectKey, _ *runtime.Scheme) (client.Client, error) {
+			return fakeWorkloadClient, nil
+		},
+	}
+
+	actual, err := machineScope.GetNodeByProviderID(ctx, "equinixmetal://device")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(actual).NotTo(BeNil())
+	g.Expect(actual.Name).To(Equal("worker"))
+
+	// devices whose kubelet did not register have no node
+	actual, err = machineScope.GetNodeByProviderID(ctx, "equinixmetal://unregistered")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(actual).To(BeNil())
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scope
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+
+	infrav1 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// GetTemplateValues reads the values of the userdata template declared by the
+// TemplateValuesFrom of the PacketMachine, by name. When a ConfigMap, Secret
+// or key that is not optional does not exist, the message tells which one and
+// no values are returned. Missing optional ones are empty.
+func (m *MachineScope) GetTemplateValues(ctx context.Context) (map[string]string, string, error) {
+	values := map[string]string{}
+	for _, source := range m.PacketMachine.Spec.TemplateValuesFrom {
+		kind, name, key, optional := templateValueRef(source)
+		if kind == "" {
+			continue
+		}
+		data, found, err := m.templateValueData(ctx, kind, name)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get the %s %s of template value %s: %w", kind, name, source.Name, err)
+		}
+
+		value, ok := data[key]
+		switch {
+		case ok:
+			values[source.Name] = value
+		case optional:
+			values[source.Name] = ""
+		case !found:
+			return nil, fmt.Sprintf("%s %s of template value %s does not exist", kind, name, source.Name), nil
+		default:
+			return nil, fmt.Sprintf("%s %s of template value %s has no key %s", kind, name, source.Name, key), nil
+		}
+	}
+	return values, "", nil
+}
+
+// templateValueRef returns the kind, name and key of the object a template
+// value is read from, and whether it is optional.
+func templateValueRef(source infrav1.TemplateValueSource) (string, string, string, bool) {
+	switch {
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		return "ConfigMap", ref.Name, ref.Key, pointer.BoolPtrDerefOr(ref.Optional, false)
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		return "Secret", ref.Name, ref.Key, pointer.BoolPtrDerefOr(ref.Optional, false)
+	}
+	return "", "", "", false
+}
+
+// templateValueData returns the data of a ConfigMap or a Secret of the
+// namespace of the machine, and false when it does not exist.
+func (m *MachineScope) templateValueData(ctx context.Context, kind, name string) (map[string]string, bool, error) {
+	key := types.NamespacedName{Namespace: m.Namespace(), Name: name}
+	if kind == "ConfigMap" {
+		configMap := &corev1.ConfigMap{}
+		if err := m.reader.Get(ctx, key, configMap); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return configMap.Data, true, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := m.client.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	data := map[string]string{}
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data, true, nil
+}
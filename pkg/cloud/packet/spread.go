@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// SpreadFacility returns the facility among candidates a new machine of a
+// node group is placed in under constraints. counts holds the machines of the
+// node group in every facility, metros the metro of every facility and report
+// the capacity of plan.
+//
+// The locations, facilities or metros of candidates, are tried from the least
+// populated one, ties broken by the candidates order, as long as placing the
+// machine there keeps the skew within MaxSkew. Within a location, the least
+// populated facility with capacity is picked. It returns an ErrNoCapacity when
+// none has capacity, unless ScheduleAnyway lets the machine go to any
+// location with capacity.
+func SpreadFacility(constraints infrastructurev1alpha3.SpreadConstraints, candidates []string, counts map[string]int, metros map[string]string, report packngo.CapacityReport, plan string) (string, error) {
+	topology := constraints.TopologyKey
+	if topology == "" {
+		topology = infrastructurev1alpha3.SpreadTopologyFacility
+	}
+	locationOf := func(facility string) string {
+		if metro, ok := metros[facility]; ok && topology == infrastructurev1alpha3.SpreadTopologyMetro {
+			return strings.ToLower(metro)
+		}
+		return facility
+	}
+
+	// machines outside of the candidate locations do not count
+	locations := []string{}
+	machines := map[string]int{}
+	for _, facility := range candidates {
+		location := locationOf(facility)
+		if _, ok := machines[location]; !ok {
+			locations = append(locations, location)
+			machines[location] = 0
+		}
+	}
+	for facility, count := range counts {
+		if _, ok := machines[locationOf(facility)]; ok {
+			machines[locationOf(facility)] += count
+		}
+	}
+	if len(locations) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		return machines[locations[i]] < machines[locations[j]]
+	})
+	fewest := machines[locations[0]]
+
+	pick := func(location string) string {
+		selected := ""
+		for _, facility := range candidates {
+			if locationOf(facility) != location || capacityLevels[report[facility][plan].Level] == 0 {
+				continue
+			}
+			if selected == "" || counts[facility] < counts[selected] {
+				selected = facility
+			}
+		}
+		return selected
+	}
+
+	maxSkew := int(constraints.MaxSkew)
+	if maxSkew < 1 {
+		maxSkew = 1
+	}
+	for _, location := range locations {
+		if machines[location]+1-fewest > maxSkew {
+			break
+		}
+		if facility := pick(location); facility != "" {
+			return facility, nil
+		}
+	}
+	if constraints.WhenUnsatisfiable == infrastructurev1alpha3.ScheduleAnyway {
+		for _, location := range locations {
+			if facility := pick(location); facility != "" {
+				return facility, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s within a skew of %d has capacity for plan %s: %w",
+		strings.ToLower(string(topology)), maxSkew, plan, ErrNoCapacity)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestSpreadFacility(t *testing.T) {
+	plan := "c3.small.x86"
+	report := packngo.CapacityReport{
+		"ewr1": {plan: {Level: "normal"}},
+		"ny5":  {plan: {Level: "limited"}},
+		"sjc1": {plan: {Level: "unavailable"}},
+		"sv15": {plan: {Level: "normal"}},
+		"da11": {plan: {Level: "normal"}},
+	}
+	metros := map[string]string{"ewr1": "NY", "ny5": "NY", "sjc1": "SV", "sv15": "SV", "da11": "DA"}
+
+	tests := []struct {
+		name        string
+		constraints infrastructurev1alpha3.SpreadConstraints
+		candidates  []string
+		counts      map[string]int
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "least populated facility",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1},
+			candidates:  []string{"ewr1", "sv15", "da11"},
+			counts:      map[string]int{"ewr1": 2, "sv15": 1, "da11": 2},
+			want:        "sv15",
+		},
+		{
+			name:        "ties are broken by the candidates order",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1},
+			candidates:  []string{"da11", "ewr1"},
+			counts:      map[string]int{},
+			want:        "da11",
+		},
+		{
+			name:        "next facility within the skew when the least populated one has no capacity",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 2},
+			candidates:  []string{"sjc1", "ewr1", "da11"},
+			counts:      map[string]int{"sjc1": 1, "ewr1": 2, "da11": 3},
+			want:        "ewr1",
+		},
+		{
+			name:        "no facility within the skew has capacity",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1},
+			candidates:  []string{"sjc1", "ewr1"},
+			counts:      map[string]int{"sjc1": 1, "ewr1": 2},
+			wantErr:     true,
+		},
+		{
+			name:        "schedule anyway",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1, WhenUnsatisfiable: infrastructurev1alpha3.ScheduleAnyway},
+			candidates:  []string{"sjc1", "ewr1"},
+			counts:      map[string]int{"sjc1": 1, "ewr1": 2},
+			want:        "ewr1",
+		},
+		{
+			name:        "machines outside of the candidates do not count",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1},
+			candidates:  []string{"ewr1", "da11"},
+			counts:      map[string]int{"ewr1": 1, "sv15": 5},
+			want:        "da11",
+		},
+		{
+			name:        "balanced across metros",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1, TopologyKey: infrastructurev1alpha3.SpreadTopologyMetro},
+			candidates:  []string{"ewr1", "ny5", "sv15", "sjc1"},
+			counts:      map[string]int{"ewr1": 1, "ny5": 1, "sv15": 1},
+			want:        "sv15",
+		},
+		{
+			name:        "least populated facility with capacity of the metro",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 1, TopologyKey: infrastructurev1alpha3.SpreadTopologyMetro},
+			candidates:  []string{"ewr1", "ny5", "sv15"},
+			counts:      map[string]int{"ewr1": 1, "sv15": 2},
+			want:        "ny5",
+		},
+		{
+			name:        "no metro with capacity",
+			constraints: infrastructurev1alpha3.SpreadConstraints{MaxSkew: 3, TopologyKey: infrastructurev1alpha3.SpreadTopologyMetro},
+			candidates:  []string{"sjc1"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			facility, err := SpreadFacility(tt.constraints, tt.candidates, tt.counts, metros, report, plan)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrNoCapacity)).To(BeTrue(), "unexpected error %v", err)
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(facility).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+const (
+	MachineUIDTag = "cluster-api-provider-packet:machine-uid"
+	clusterIDTag  = "cluster-api-provider-packet:cluster-id"
+	AnnotationUID = "cluster.k8s.io/machine-uid"
+
+	// ProtectedReservationTag marks the hardware reservations whose devices
+	// are only deleted when their PacketMachine allows it.
+	ProtectedReservationTag = "protected"
+
+	// ParkedIPTag marks the ip reservations kept after the deletion of their
+	// cluster, for a new cluster with the same namespace and name to reuse.
+	ParkedIPTag = "cluster-api-provider-packet:parked"
+
+	// ClusterUIDTag prefixes the UID of the PacketCluster an ip reservation,
+	// interconnection or VRF belongs to, or whose controller manages a
+	// device.
+	ClusterUIDTag = "cluster-api-provider-packet:cluster-uid"
+
+	// APIServerFirewallTag prefixes the digest of the API server firewall
+	// rules a control plane device booted with.
+	APIServerFirewallTag = "cluster-api-provider-packet:apiserver-firewall"
+
+	// InterconnectionTag prefixes the name, within its cluster, of an
+	// interconnection the controller provisioned.
+	InterconnectionTag = "cluster-api-provider-packet:interconnection"
+
+	// VRFTag prefixes the name, within its cluster, of a VRF the controller
+	// provisioned.
+	VRFTag = "cluster-api-provider-packet:vrf"
+)
+
+// ManagedTag reports whether a tag is in the namespace of the tags the
+// provider manages.
+func ManagedTag(tag string) bool {
+	return strings.HasPrefix(tag, infrastructurev1alpha3.ManagedTagPrefix)
+}
+
+// ValidateUserTags returns an ErrInvalidRequest when one of the tags of a spec
+// is in the namespace of the tags the provider manages.
+func ValidateUserTags(tags []string) error {
+	for _, tag := range tags {
+		if ManagedTag(tag) {
+			return fmt.Errorf("tag %q is in the %s namespace managed by the provider: %w", tag, infrastructurev1alpha3.ManagedTagPrefix, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
+
+// TagService keeps the tags the provider identifies its resources with up to
+// date.
+type TagService interface {
+	MigrateClusterTags(namespace, clusterName, projectID string) (int, error)
+}
+
+func GenerateMachineTag(ID string) string {
+	return fmt.Sprintf("%s:%s", MachineUIDTag, ID)
+}
+
+func GenerateClusterTag(ID string) string {
+	return fmt.Sprintf("%s:%s", clusterIDTag, ID)
+}
+
+// GenerateClusterUIDTag returns the tag of the ip reservations and the
+// devices of the PacketCluster with the given UID.
+func GenerateClusterUIDTag(uid string) string {
+	return fmt.Sprintf("%s:%s", ClusterUIDTag, uid)
+}
+
+// ClusterUID returns the UID the Packet resources of a PacketCluster are
+// tagged with: the one recorded in its ClusterUIDAnnotation, which survives
+// clusterctl move, or else its own.
+func ClusterUID(packetCluster *infrastructurev1alpha3.PacketCluster) string {
+	if uid := packetCluster.Annotations[infrastructurev1alpha3.ClusterUIDAnnotation]; uid != "" {
+		return uid
+	}
+	return string(packetCluster.UID)
+}
+
+// RecordClusterUID sets the ClusterUIDAnnotation of a PacketCluster to its
+// UID, unless it is set already.
+func RecordClusterUID(packetCluster *infrastructurev1alpha3.PacketCluster) {
+	if packetCluster.Annotations[infrastructurev1alpha3.ClusterUIDAnnotation] != "" {
+		return
+	}
+	if packetCluster.Annotations == nil {
+		packetCluster.Annotations = map[string]string{}
+	}
+	packetCluster.Annotations[infrastructurev1alpha3.ClusterUIDAnnotation] = string(packetCluster.UID)
+}
+
+// GenerateAPIServerFirewallTag returns the tag of the control plane devices
+// booted with firewall rules restricting their API server.
+func GenerateAPIServerFirewallTag(rules string) string {
+	sum := sha256.Sum256([]byte(rules))
+	return fmt.Sprintf("%s:%s", APIServerFirewallTag, hex.EncodeToString(sum[:6]))
+}
+
+// GenerateInterconnectionTag returns the tag of the interconnection declared
+// with the given name.
+func GenerateInterconnectionTag(name string) string {
+	return fmt.Sprintf("%s:%s", InterconnectionTag, name)
+}
+
+// GenerateVRFTag returns the tag of the VRF declared with the given name.
+func GenerateVRFTag(name string) string {
+	return fmt.Sprintf("%s:%s", VRFTag, name)
+}
+
+// MigrateClusterTags retags the devices and ip reservations of a cluster that
+// still carry legacy tags. It returns the number of resources updated.
+func (p *PacketClient) MigrateClusterTags(namespace, clusterName, projectID string) (int, error) {
+	updated := 0
+	clusterTag := GenerateClusterTag(clusterName)
+
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return updated, fmt.Errorf("failed to list devices: %w", packeterrors.Wrap(err))
+	}
+	for _, dev := range devices {
+		if !ItemsInList(dev.Tags, []string{clusterTag}) {
+			continue
+		}
+		tags, changed := MigrateTags(namespace, clusterName, dev.Tags)
+		if !changed {
+			continue
+		}
+		if _, _, err := p.Devices.Update(dev.ID, &packngo.DeviceUpdateRequest{Tags: &tags}); err != nil {
+			return updated, fmt.Errorf("failed to retag device %s: %w", dev.ID, packeterrors.Wrap(err))
+		}
+		updated++
+	}
+
+	ips, _, err := p.ProjectIPs.List(projectID, nil)
+	if err != nil {
+		return updated, fmt.Errorf("failed to list ip reservations: %w", packeterrors.Wrap(err))
+	}
+	for _, ip := range ips {
+		if !ipBelongsToCluster(ip.Tags, namespace, clusterName) {
+			continue
+		}
+		tags, changed := MigrateIPTags(namespace, clusterName, ip.Tags)
+		if !changed {
+			continue
+		}
+		if err := p.updateIPTags(ip.ID, tags); err != nil {
+			return updated, fmt.Errorf("failed to retag ip reservation %s: %w", ip.ID, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// ipBelongsToCluster reports whether one of the tags identifies an ip
+// reservation of the cluster, either the cluster one or a per facility one,
+// with the current or the legacy identifier.
+func ipBelongsToCluster(tags []string, namespace, clusterName string) bool {
+	for _, identifier := range []string{
+		generateElasticIPIdentifier(namespace, clusterName),
+		generateLegacyElasticIPIdentifier(clusterName),
+	} {
+		for _, tag := range tags {
+			if tag == identifier || strings.HasPrefix(tag, identifier+":facility:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ControlPlaneIPTag returns the tag of the control plane ElasticIP of a
+// cluster, which the cloud controller manager looks the ip up with.
+func ControlPlaneIPTag(namespace, name string) string {
+	return generateElasticIPIdentifier(namespace, name)
+}
+
+// generateElasticIPIdentifier returns the tag identifying the ElasticIP of a
+// cluster. Cluster names are only unique within a namespace.
+func generateElasticIPIdentifier(namespace, name string) string {
+	return fmt.Sprintf("%s:%s/%s", clusterIDTag, namespace, name)
+}
+
+func generateFacilityElasticIPIdentifier(namespace, name, facility string) string {
+	return fmt.Sprintf("%s:facility:%s", generateElasticIPIdentifier(namespace, name), facility)
+}
+
+// generateLegacyElasticIPIdentifier returns the tag previous versions of the
+// provider identified the ElasticIP of a cluster with.
+func generateLegacyElasticIPIdentifier(name string) string {
+	return fmt.Sprintf("%s:%s", clusterIDTag, name)
+}
+
+func generateLegacyFacilityElasticIPIdentifier(name, facility string) string {
+	return fmt.Sprintf("%s:facility:%s", generateLegacyElasticIPIdentifier(name), facility)
+}
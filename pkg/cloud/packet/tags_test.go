@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestMigrateClusterTags(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"devices": []map[string]interface{}{
+		{"id": "legacy", "tags": []string{GenerateClusterTag("capi"), AnnotationUID + ":uid"}},
+		{"id": "current", "tags": []string{GenerateClusterTag("capi"), GenerateMachineTag("uid")}},
+		{"id": "other", "tags": []string{GenerateClusterTag("other"), AnnotationUID + ":uid"}},
+	}}})
+	api.on("PUT", "/devices/legacy", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "legacy"}})
+	api.on("GET", "/projects/project/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []map[string]interface{}{
+		{"id": "ip-legacy", "tags": []string{"cluster-api-provider-packet:cluster-id:capi:facility:sjc1"}},
+		{"id": "ip-current", "tags": []string{"cluster-api-provider-packet:cluster-id:default/capi"}},
+		{"id": "ip-other", "tags": []string{"cluster-api-provider-packet:cluster-id:other"}},
+	}}})
+	api.on("PATCH", "/ips/ip-legacy", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "ip-legacy"}})
+
+	updated, err := c.MigrateClusterTags("default", "capi", "project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(updated).To(Equal(2))
+
+	devices := api.requestsTo("PUT", "/devices/legacy")
+	g.Expect(devices).To(HaveLen(1))
+	g.Expect(devices[0].Body["tags"]).To(Equal([]interface{}{GenerateClusterTag("capi"), GenerateMachineTag("uid")}))
+	g.Expect(api.requestsTo("PUT", "/devices/other")).To(BeEmpty())
+
+	ips := api.requestsTo("PATCH", "/ips/ip-legacy")
+	g.Expect(ips).To(HaveLen(1))
+	g.Expect(ips[0].Body["tags"]).To(Equal([]interface{}{"cluster-api-provider-packet:cluster-id:default/capi:facility:sjc1"}))
+	g.Expect(api.requestsTo("PATCH", "/ips/ip-other")).To(BeEmpty())
+}
+
+func TestMigrateClusterTagsFailure(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("GET", "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"devices": []map[string]interface{}{
+		{"id": "legacy", "tags": []string{GenerateClusterTag("capi"), AnnotationUID + ":uid"}},
+	}}})
+	api.on("PUT", "/devices/legacy", fakeResponse{status: http.StatusForbidden, body: apiError("Forbidden")})
+
+	updated, err := c.MigrateClusterTags("default", "capi", "project")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(updated).To(BeZero())
+	g.Expect(api.requestsTo("GET", "/projects/project/ips")).To(BeEmpty())
+}
+
+func TestValidateUserTags(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ValidateUserTags(nil)).To(Succeed())
+	g.Expect(ValidateUserTags([]string{"team:platform", infrastructurev1alpha3.LegacyWorkerTag})).To(Succeed())
+	err := ValidateUserTags([]string{"team:platform", GenerateMachineTag("uid")})
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+	g.Expect(ManagedTag(infrastructurev1alpha3.WorkerTag)).To(BeTrue())
+}
+
+func TestClusterUID(t *testing.T) {
+	g := NewWithT(t)
+
+	packetCluster := &infrastructurev1alpha3.PacketCluster{}
+	packetCluster.UID = "uid"
+	g.Expect(ClusterUID(packetCluster)).To(Equal("uid"))
+
+	RecordClusterUID(packetCluster)
+	g.Expect(packetCluster.Annotations).To(HaveKeyWithValue(infrastructurev1alpha3.ClusterUIDAnnotation, "uid"))
+
+	// clusterctl move gives the PacketCluster a new UID, the recorded one
+	// is kept
+	packetCluster.UID = "moved"
+	RecordClusterUID(packetCluster)
+	g.Expect(ClusterUID(packetCluster)).To(Equal("uid"))
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// TemplateGranted reports whether one of grants, listed in the namespace of
+// the PacketMachineTemplate named name, allows the PacketMachines of
+// namespace to reference it.
+func TemplateGranted(grants []infrastructurev1alpha3.PacketMachineTemplateGrant, namespace, name string) bool {
+	for _, grant := range grants {
+		if !grantsTemplate(grant.Spec, name) {
+			continue
+		}
+		for _, from := range grant.Spec.From {
+			if from.Namespace == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func grantsTemplate(spec infrastructurev1alpha3.PacketMachineTemplateGrantSpec, name string) bool {
+	if len(spec.TemplateNames) == 0 {
+		return true
+	}
+	for _, templateName := range spec.TemplateNames {
+		if templateName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeTemplateSpec returns spec with the fields it leaves empty taken from
+// the spec of a referenced template. The template reference and the provider
+// id of the template are ignored: references are not followed further.
+func MergeTemplateSpec(spec, template infrastructurev1alpha3.PacketMachineSpec) (infrastructurev1alpha3.PacketMachineSpec, error) {
+	template.TemplateRef = nil
+	template.ProviderID = nil
+
+	fields, err := specFields(template)
+	if err != nil {
+		return spec, err
+	}
+	own, err := specFields(spec)
+	if err != nil {
+		return spec, err
+	}
+	for name, value := range own {
+		// the required strings are serialized even when empty
+		if value != "" {
+			fields[name] = value
+		}
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return spec, err
+	}
+	merged := infrastructurev1alpha3.PacketMachineSpec{}
+	err = json.Unmarshal(raw, &merged)
+	return merged, err
+}
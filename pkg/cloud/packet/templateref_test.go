@@ -0,0 +1,101 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestTemplateGranted(t *testing.T) {
+	grant := func(names []string, from ...string) infrastructurev1alpha3.PacketMachineTemplateGrant {
+		spec := infrastructurev1alpha3.PacketMachineTemplateGrantSpec{TemplateNames: names}
+		for _, namespace := range from {
+			spec.From = append(spec.From, infrastructurev1alpha3.TemplateGrantFrom{Namespace: namespace})
+		}
+		return infrastructurev1alpha3.PacketMachineTemplateGrant{Spec: spec}
+	}
+
+	tests := []struct {
+		name   string
+		grants []infrastructurev1alpha3.PacketMachineTemplateGrant
+		want   bool
+	}{
+		{
+			name: "no grant",
+		},
+		{
+			name:   "every template",
+			grants: []infrastructurev1alpha3.PacketMachineTemplateGrant{grant(nil, "other", "team-a")},
+			want:   true,
+		},
+		{
+			name:   "other namespace",
+			grants: []infrastructurev1alpha3.PacketMachineTemplateGrant{grant(nil, "team-b")},
+		},
+		{
+			name:   "named template",
+			grants: []infrastructurev1alpha3.PacketMachineTemplateGrant{grant([]string{"small", "large"}, "team-a")},
+			want:   true,
+		},
+		{
+			name: "other template",
+			grants: []infrastructurev1alpha3.PacketMachineTemplateGrant{
+				grant([]string{"small"}, "team-a"),
+				grant(nil, "team-b"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(TemplateGranted(tt.grants, "team-a", "large")).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestMergeTemplateSpec(t *testing.T) {
+	g := NewWithT(t)
+	template := infrastructurev1alpha3.PacketMachineSpec{
+		OS:           "ubuntu_20_04",
+		BillingCycle: "hourly",
+		MachineType:  "c3.small.x86",
+		Facility:     "ewr1",
+		Tags:         infrastructurev1alpha3.Tags{"catalog"},
+		ProviderID:   pointer.StringPtr("packet://template"),
+		TemplateRef:  &infrastructurev1alpha3.TemplateReference{Name: "base"},
+	}
+	spec := infrastructurev1alpha3.PacketMachineSpec{
+		MachineType: "m3.large.x86",
+		TemplateRef: &infrastructurev1alpha3.TemplateReference{Namespace: "catalog", Name: "small"},
+	}
+
+	merged, err := MergeTemplateSpec(spec, template)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(merged.OS).To(Equal("ubuntu_20_04"))
+	g.Expect(merged.BillingCycle).To(Equal("hourly"))
+	g.Expect(merged.MachineType).To(Equal("m3.large.x86"))
+	g.Expect(merged.Facility).To(Equal("ewr1"))
+	g.Expect(merged.Tags).To(Equal(infrastructurev1alpha3.Tags{"catalog"}))
+	g.Expect(merged.ProviderID).To(BeNil())
+	g.Expect(merged.TemplateRef).To(Equal(spec.TemplateRef))
+}
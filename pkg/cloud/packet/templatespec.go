@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// TemplateSpecChanges returns the JSON names of the fields of a
+// PacketMachineTemplate spec that differ between old and spec, sorted, among
+// the ones read when devices get created. Editing them in place would leave
+// the existing machines with devices that do not match their template: the
+// Cluster API only rolls machines out when their template is replaced.
+// The delete policy, only read when a machine is deleted, can be edited.
+func TemplateSpecChanges(old, spec infrastructurev1alpha3.PacketMachineSpec) ([]string, error) {
+	for _, s := range []*infrastructurev1alpha3.PacketMachineSpec{&old, &spec} {
+		s.DeviceDeletePolicy = ""
+		s.ProviderID = nil
+	}
+
+	from, err := specFields(old)
+	if err != nil {
+		return nil, err
+	}
+	to, err := specFields(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+	for name, value := range from {
+		if !reflect.DeepEqual(value, to[name]) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// specFields returns the fields of spec by JSON name, the empty optional
+// ones left out.
+func specFields(spec infrastructurev1alpha3.PacketMachineSpec) (map[string]interface{}, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(raw, &fields)
+	return fields, err
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestTemplateSpecChanges(t *testing.T) {
+	base := infrastructurev1alpha3.PacketMachineSpec{
+		OS:           "ubuntu_20_04",
+		BillingCycle: "hourly",
+		MachineType:  "c3.small.x86",
+		Facility:     "ewr1",
+		Tags:         infrastructurev1alpha3.Tags{"team-a"},
+	}
+
+	tests := []struct {
+		name   string
+		update func(*infrastructurev1alpha3.PacketMachineSpec)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			update: func(s *infrastructurev1alpha3.PacketMachineSpec) {},
+			want:   []string{},
+		},
+		{
+			name: "machine type and os",
+			update: func(s *infrastructurev1alpha3.PacketMachineSpec) {
+				s.MachineType = "m3.large.x86"
+				s.OS = "flatcar_stable"
+			},
+			want: []string{"OS", "machineType"},
+		},
+		{
+			name:   "field added",
+			update: func(s *infrastructurev1alpha3.PacketMachineSpec) { s.IPXEUrl = "https://boot.example.com" },
+			want:   []string{"ipxeURL"},
+		},
+		{
+			name:   "field removed",
+			update: func(s *infrastructurev1alpha3.PacketMachineSpec) { s.Tags = nil },
+			want:   []string{"tags"},
+		},
+		{
+			name: "delete policy",
+			update: func(s *infrastructurev1alpha3.PacketMachineSpec) {
+				s.DeviceDeletePolicy = infrastructurev1alpha3.DeviceDeletePolicyEndOfBillingHour
+			},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			spec := *base.DeepCopy()
+			tt.update(&spec)
+			changed, err := TemplateSpecChanges(base, spec)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(changed).To(Equal(tt.want))
+		})
+	}
+}
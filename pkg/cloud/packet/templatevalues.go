@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"regexp"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// templateValueName is the pattern of the names of the template values, usable
+// as {{ .values.<name> }}.
+var templateValueName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidateTemplateValuesFrom checks the declarations of the userdata template
+// values of a machine: unique valid names, each with exactly one reference
+// naming an object and a key. It returns an ErrInvalidRequest otherwise.
+func ValidateTemplateValuesFrom(sources []infrastructurev1alpha3.TemplateValueSource) error {
+	names := map[string]bool{}
+	for i, source := range sources {
+		if !templateValueName.MatchString(source.Name) {
+			return fmt.Errorf("templateValuesFrom[%d]: invalid name %q, expected %s: %w", i, source.Name, templateValueName, ErrInvalidRequest)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("templateValuesFrom[%d]: duplicate name %q: %w", i, source.Name, ErrInvalidRequest)
+		}
+		names[source.Name] = true
+
+		var object, key string
+		switch {
+		case source.ConfigMapKeyRef != nil && source.SecretKeyRef != nil:
+			return fmt.Errorf("templateValuesFrom[%d]: %s sets both configMapKeyRef and secretKeyRef: %w", i, source.Name, ErrInvalidRequest)
+		case source.ConfigMapKeyRef != nil:
+			object, key = source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key
+		case source.SecretKeyRef != nil:
+			object, key = source.SecretKeyRef.Name, source.SecretKeyRef.Key
+		default:
+			return fmt.Errorf("templateValuesFrom[%d]: %s sets neither configMapKeyRef nor secretKeyRef: %w", i, source.Name, ErrInvalidRequest)
+		}
+		if object == "" || key == "" {
+			return fmt.Errorf("templateValuesFrom[%d]: the reference of %s needs a name and a key: %w", i, source.Name, ErrInvalidRequest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestValidateTemplateValuesFrom(t *testing.T) {
+	configMapRef := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "registry"}, Key: "mirror"}
+	secretRef := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "license"}, Key: "key"}
+
+	tests := []struct {
+		name    string
+		sources []infrastructurev1alpha3.TemplateValueSource
+		wantErr string
+	}{
+		{
+			name: "valid",
+			sources: []infrastructurev1alpha3.TemplateValueSource{
+				{Name: "registryMirror", ConfigMapKeyRef: configMapRef},
+				{Name: "license_key", SecretKeyRef: secretRef},
+			},
+		},
+		{
+			name:    "invalid name",
+			sources: []infrastructurev1alpha3.TemplateValueSource{{Name: "registry-mirror", ConfigMapKeyRef: configMapRef}},
+			wantErr: `invalid name "registry-mirror"`,
+		},
+		{
+			name: "duplicate name",
+			sources: []infrastructurev1alpha3.TemplateValueSource{
+				{Name: "mirror", ConfigMapKeyRef: configMapRef},
+				{Name: "mirror", SecretKeyRef: secretRef},
+			},
+			wantErr: `templateValuesFrom[1]: duplicate name "mirror"`,
+		},
+		{
+			name:    "both references",
+			sources: []infrastructurev1alpha3.TemplateValueSource{{Name: "mirror", ConfigMapKeyRef: configMapRef, SecretKeyRef: secretRef}},
+			wantErr: "sets both",
+		},
+		{
+			name:    "no reference",
+			sources: []infrastructurev1alpha3.TemplateValueSource{{Name: "mirror"}},
+			wantErr: "sets neither",
+		},
+		{
+			name:    "no key",
+			sources: []infrastructurev1alpha3.TemplateValueSource{{Name: "mirror", SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "license"}}}},
+			wantErr: "needs a name and a key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateTemplateValuesFrom(tt.sources)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestNewDeviceTemplateValues(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on("POST", "/projects/project/devices", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "device"}})
+	machineScope := newTestMachineScope(t,
+		infrastructurev1alpha3.PacketMachineSpec{OS: "ubuntu_20_04", MachineType: "c3.small.x86", BillingCycle: "hourly", Facility: "ewr1"},
+		infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+		"#!/bin/sh\necho {{ .values.registryMirror }}\n")
+
+	_, err := c.NewDevice(CreateDeviceRequest{
+		MachineScope:   machineScope,
+		TemplateValues: map[string]string{"registryMirror": "mirror.internal:5000"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(api.requestsTo("POST", "/projects/project/devices")[0].Body).To(HaveKeyWithValue("userdata", "#!/bin/sh\necho mirror.internal:5000\n"))
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	"sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/scope"
+)
+
+const (
+	// redactedValue replaces the secrets of redacted userdata.
+	redactedValue = "<redacted>"
+
+	// maxUserDataDiffLines bounds the lines of a userdata diff.
+	maxUserDataDiffLines = 100
+)
+
+var (
+	// bootstrapTokenPattern matches kubeadm bootstrap tokens.
+	bootstrapTokenPattern = regexp.MustCompile(`\b[a-z0-9]{6}\.[a-z0-9]{16}\b`)
+	// privateKeyPattern matches PEM private keys, also percent encoded as in
+	// the data URLs of Ignition configs.
+	privateKeyPattern = regexp.MustCompile(`(?s)-----BEGIN(?: |%20)(?:[A-Z]+(?: |%20))*PRIVATE(?: |%20)KEY-----.*?-----END(?: |%20)(?:[A-Z]+(?: |%20))*PRIVATE(?: |%20)KEY-----`)
+)
+
+// userDataSecretVariables are the userdata template variables holding
+// secrets.
+var userDataSecretVariables = []string{"apiKey", "bootstrapCallbackToken", "kubeVIPManifestBase64"}
+
+// RedactUserData returns userData with its private keys, kubeadm bootstrap
+// tokens and the values of secrets redacted.
+func RedactUserData(userData string, secrets []string) string {
+	// the longest secrets first, for the ones containing others to be
+	// redacted whole
+	sorted := append([]string{}, secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, secret := range sorted {
+		if secret != "" {
+			userData = strings.ReplaceAll(userData, secret, redactedValue)
+		}
+	}
+	userData = privateKeyPattern.ReplaceAllString(userData, redactedValue)
+	return bootstrapTokenPattern.ReplaceAllString(userData, redactedValue)
+}
+
+// userDataSections returns the parts of the multipart userdata the
+// controller renders, and the userdata as a single part otherwise.
+func userDataSections(userData string) []cloudInitPart {
+	for _, boundary := range []string{firewallBoundary, gpuBoundary, registriesBoundary} {
+		if parts, ok, err := cloudInitParts(userData, boundary); err == nil && ok {
+			return parts
+		}
+	}
+	return []cloudInitPart{{filename: "userdata", content: userData}}
+}
+
+// UserDataDiff returns the lines removed from old, prefixed with -, and the
+// lines added in new, prefixed with +. The parts of multipart userdata are
+// compared with the part of the same file name, and the lines prefixed with
+// it. The diff is cut after maxUserDataDiffLines lines.
+func UserDataDiff(old, new string) []string {
+	oldSections := map[string]string{}
+	for _, part := range userDataSections(old) {
+		oldSections[part.filename] = part.content
+	}
+
+	diff := []string{}
+	seen := map[string]bool{}
+	add := func(filename, oldContent, newContent string) {
+		for _, line := range diffLines(splitLines(oldContent), splitLines(newContent)) {
+			diff = append(diff, filename+": "+line)
+		}
+	}
+	for _, part := range userDataSections(new) {
+		seen[part.filename] = true
+		add(part.filename, oldSections[part.filename], part.content)
+	}
+	for _, part := range userDataSections(old) {
+		if !seen[part.filename] {
+			add(part.filename, part.content, "")
+		}
+	}
+
+	if len(diff) > maxUserDataDiffLines {
+		more := len(diff) - maxUserDataDiffLines
+		diff = append(diff[:maxUserDataDiffLines], fmt.Sprintf("... %d more lines", more))
+	}
+	return diff
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the lines of a missing from b, prefixed with -, and the
+// lines of b missing from a, prefixed with +, in the order of the files.
+func diffLines(a, b []string) []string {
+	// the common first and last lines are left out of the longest common
+	// subsequence, most of the userdata usually is
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := []string{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+"+b[j])
+	}
+	return diff
+}
+
+// UserDataGroup returns the node group whose machines are expected to render
+// the same userdata: the MachineDeployment or the MachineSet of the machine,
+// told by the labels Cluster API sets, or else its role.
+func UserDataGroup(machineScope *scope.MachineScope) string {
+	labels := machineScope.Machine.Labels
+	group := "worker"
+	switch {
+	case machineScope.IsControlPlane():
+		group = "control-plane"
+	case labels[clusterv1.MachineDeploymentLabelName] != "":
+		group = "deployment/" + labels[clusterv1.MachineDeploymentLabelName]
+	case labels[clusterv1.MachineSetLabelName] != "":
+		group = "set/" + labels[clusterv1.MachineSetLabelName]
+	}
+	return fmt.Sprintf("%s/%s/%s", machineScope.Namespace(), machineScope.Cluster.Name, group)
+}
+
+// UserDataHistory remembers the redacted userdata last rendered for the
+// machines of every node group, to report what changed once a new
+// generation of machines renders another one, e.g. after the bootstrap
+// template of a MachineDeployment changed. A nil UserDataHistory remembers
+// nothing.
+type UserDataHistory struct {
+	mu     sync.Mutex
+	groups map[string]string
+}
+
+// NewUserDataHistory returns an empty UserDataHistory.
+func NewUserDataHistory() *UserDataHistory {
+	return &UserDataHistory{groups: map[string]string{}}
+}
+
+// Record records the redacted userdata rendered for a machine of group. It
+// returns the userdata rendered before it for the group, when another one.
+func (h *UserDataHistory) Record(group, userData string) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previous, ok := h.groups[group]
+	h.groups[group] = userData
+	return previous, ok && previous != userData
+}
+
+// recordRenderedUserData annotates the machine of req with the digest of its
+// redacted userdata and, when the userdata of its node group changed, logs
+// the diff and annotates the digest it changed from.
+func recordRenderedUserData(req CreateDeviceRequest, userData string, values map[string]interface{}) {
+	secrets := []string{}
+	for _, name := range userDataSecretVariables {
+		if secret, ok := values[name].(string); ok {
+			secrets = append(secrets, secret)
+		}
+	}
+	redacted := RedactUserData(userData, secrets)
+	hash := UserDataHash(redacted)
+
+	packetMachine := req.MachineScope.PacketMachine
+	if packetMachine.Annotations == nil {
+		packetMachine.Annotations = map[string]string{}
+	}
+	packetMachine.Annotations[infrastructurev1alpha3.RenderedUserDataHashAnnotation] = hash
+
+	group := UserDataGroup(req.MachineScope)
+	previous, changed := req.UserDataHistory.Record(group, redacted)
+	if !changed {
+		return
+	}
+	previousHash := UserDataHash(previous)
+	packetMachine.Annotations[infrastructurev1alpha3.UserDataChangedFromAnnotation] = previousHash
+	req.MachineScope.Info("Rendered userdata changed from the previous machine of the node group",
+		"group", group, "from", previousHash, "to", hash, "diff", UserDataDiff(previous, redacted))
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+// envsubstVariable matches the ${name} and $name variables. The braced form
+// also names the values of the templateValuesFrom, as ${values.<name>}.
+var envsubstVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.-]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// RenderUserData renders the bootstrap data userData with the template
+// variables vars, with engine. The go-template engine is the default.
+func RenderUserData(engine infrastructurev1alpha3.UserDataTemplateEngine, userData string, vars map[string]interface{}) (string, error) {
+	switch engine {
+	case infrastructurev1alpha3.UserDataTemplateEngineNone:
+		return userData, nil
+	case infrastructurev1alpha3.UserDataTemplateEngineEnvsubst:
+		return envsubst(userData, vars), nil
+	case "", infrastructurev1alpha3.UserDataTemplateEngineGoTemplate:
+	default:
+		return "", fmt.Errorf("unknown userdata template engine %q: %w", engine, ErrInvalidRequest)
+	}
+
+	tmpl, err := template.New("user-data").Parse(userData)
+	if err != nil {
+		return "", fmt.Errorf("error parsing userdata template: %v", err)
+	}
+	stringWriter := &strings.Builder{}
+	if err := tmpl.Execute(stringWriter, vars); err != nil {
+		return "", fmt.Errorf("error executing userdata template: %v", err)
+	}
+	return stringWriter.String(), nil
+}
+
+// envsubst substitutes the variables of userData named in vars. The other
+// ones, e.g. the variables of a shell script, are left untouched. Lists are
+// substituted comma separated.
+func envsubst(userData string, vars map[string]interface{}) string {
+	return envsubstVariable.ReplaceAllStringFunc(userData, func(match string) string {
+		groups := envsubstVariable.FindStringSubmatch(match)
+		name := groups[1]
+		if name == "" {
+			name = groups[2]
+		}
+
+		var value interface{} = vars[name]
+		if key := strings.TrimPrefix(name, "values."); key != name {
+			if values, ok := vars["values"].(map[string]string); ok {
+				if v, ok := values[key]; ok {
+					value = v
+				}
+			}
+		}
+		switch v := value.(type) {
+		case string:
+			return v
+		case []string:
+			return strings.Join(v, ",")
+		}
+		return match
+	})
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestRenderUserData(t *testing.T) {
+	vars := map[string]interface{}{
+		"kubernetesVersion":   "v1.20.4",
+		"clusterCACertHashes": []string{"sha256:a", "sha256:b"},
+		"values":              map[string]string{"mirror": "registry.internal"},
+	}
+
+	tests := []struct {
+		name     string
+		engine   infrastructurev1alpha3.UserDataTemplateEngine
+		userData string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "go template by default",
+			userData: "version={{ .kubernetesVersion }} mirror={{ .values.mirror }}",
+			want:     "version=v1.20.4 mirror=registry.internal",
+		},
+		{
+			name:     "invalid go template",
+			engine:   infrastructurev1alpha3.UserDataTemplateEngineGoTemplate,
+			userData: "{{ .kubernetesVersion",
+			wantErr:  true,
+		},
+		{
+			name:     "envsubst",
+			engine:   infrastructurev1alpha3.UserDataTemplateEngineEnvsubst,
+			userData: "version=$kubernetesVersion hashes=${clusterCACertHashes} mirror=${values.mirror} home=$HOME {{ .keep }} ${values.unknown}",
+			want:     "version=v1.20.4 hashes=sha256:a,sha256:b mirror=registry.internal home=$HOME {{ .keep }} ${values.unknown}",
+		},
+		{
+			name:     "none",
+			engine:   infrastructurev1alpha3.UserDataTemplateEngineNone,
+			userData: "{{ .kubernetesVersion }} $kubernetesVersion {{",
+			want:     "{{ .kubernetesVersion }} $kubernetesVersion {{",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := RenderUserData(tt.engine, tt.userData, vars)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+
+	_, err := RenderUserData("jinja", "", vars)
+	g := NewWithT(t)
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+}
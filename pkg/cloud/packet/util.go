@@ -17,22 +17,27 @@ limitations under the License.
 package packet
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/client-go/util/cert"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
 )
 
 const (
-	MachineUIDTag = "cluster-api-provider-packet:machine-uid"
-	clusterIDTag  = "cluster-api-provider-packet:cluster-id"
-	AnnotationUID = "cluster.k8s.io/machine-uid"
+	// IPPurposeControlPlane is the purpose of the control plane ip of a cluster.
+	IPPurposeControlPlane = "control-plane"
+	// IPPurposeFacilityControlPlane is the purpose of the ips reserved for the
+	// control plane machines placed in a facility other than the cluster one.
+	IPPurposeFacilityControlPlane = "facility-control-plane"
 )
 
-func GenerateMachineTag(ID string) string {
-	return fmt.Sprintf("%s:%s", MachineUIDTag, ID)
-}
-func GenerateClusterTag(ID string) string {
-	return fmt.Sprintf("%s:%s", clusterIDTag, ID)
-}
-
 // ItemsInList checks if all items are in the list
 func ItemsInList(list []string, items []string) bool {
 	// convert the items against which we are mapping into a map
@@ -54,3 +59,156 @@ func ItemsInList(list []string, items []string) bool {
 	}
 	return true
 }
+
+// LeastPopulatedFacility returns the facility among candidates hosting the
+// fewest machines according to counts. Ties are broken by the candidates order.
+func LeastPopulatedFacility(candidates []string, counts map[string]int) string {
+	selected := ""
+	for _, facility := range candidates {
+		if selected == "" || counts[facility] < counts[selected] {
+			selected = facility
+		}
+	}
+	return selected
+}
+
+// DeletionGracePeriod returns the deletion grace period annotated on a
+// Machine, zero when there is none.
+func DeletionGracePeriod(annotations map[string]string) (time.Duration, error) {
+	value, ok := annotations[infrastructurev1alpha3.DeletionGracePeriodAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		return 0, fmt.Errorf("invalid deletion grace period %q: %w", value, ErrInvalidRequest)
+	}
+	return grace, nil
+}
+
+// BillingHourEnd returns when a device created at created should be deleted
+// to not start a new billing hour: margin before the end of the billing hour
+// now falls in.
+func BillingHourEnd(created, now time.Time, margin time.Duration) time.Time {
+	hours := now.Sub(created) / time.Hour
+	if now.Sub(created)%time.Hour != 0 || hours == 0 {
+		hours++
+	}
+	return created.Add(hours * time.Hour).Add(-margin)
+}
+
+// CACertHashes returns the kubeadm discovery hashes of the certificates in a
+// PEM encoded CA bundle, in the "sha256:<hex>" form.
+func CACertHashes(caCertificate []byte) ([]string, error) {
+	certificates, err := cert.ParseCertsPEM(caCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(certificates))
+	for _, c := range certificates {
+		spkiHash := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		hashes = append(hashes, "sha256:"+hex.EncodeToString(spkiHash[:]))
+	}
+	return hashes, nil
+}
+
+// IPReservationLocation returns the scope the control plane ip of a cluster
+// is reserved with, and the facility or metro it is reserved in.
+func IPReservationLocation(spec infrastructurev1alpha3.PacketClusterSpec) (infrastructurev1alpha3.IPReservationScope, string) {
+	switch {
+	case spec.IPReservationScope == infrastructurev1alpha3.IPReservationScopeGlobal,
+		spec.IPReservationScope == "" && spec.ControlPlaneEndpointStrategy == infrastructurev1alpha3.ControlPlaneEndpointStrategyGlobalIP:
+		return infrastructurev1alpha3.IPReservationScopeGlobal, ""
+	case spec.IPReservationScope == infrastructurev1alpha3.IPReservationScopeMetro,
+		spec.IPReservationScope == "" && spec.Facility == "" && spec.Metro != "":
+		return infrastructurev1alpha3.IPReservationScopeMetro, spec.Metro
+	default:
+		return infrastructurev1alpha3.IPReservationScopeFacility, spec.Facility
+	}
+}
+
+// ValidateClusterLocation checks that a cluster is located in a facility or
+// a metro, and in a facility when its control plane ip is reserved in one. A
+// facility of the metro may be set along with it, as done while migrating a
+// cluster to its metro.
+func ValidateClusterLocation(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	ipScope, location := IPReservationLocation(spec)
+	switch {
+	case spec.Facility == "" && spec.Metro == "":
+		return fmt.Errorf("one of facility or metro is required: %w", ErrInvalidRequest)
+	case ipScope == infrastructurev1alpha3.IPReservationScopeFacility && location == "":
+		return fmt.Errorf("facility is required when the ip reservation scope is %s: %w", ipScope, ErrInvalidRequest)
+	}
+	return nil
+}
+
+// ValidateIPReservationScope checks that the ip reservation scope of a
+// cluster is consistent with its location and endpoint strategy.
+func ValidateIPReservationScope(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	ipScope, location := IPReservationLocation(spec)
+	switch {
+	case ipScope == infrastructurev1alpha3.IPReservationScopeMetro && location == "":
+		return fmt.Errorf("metro is required when the ip reservation scope is %s: %w", ipScope, ErrInvalidRequest)
+	case ipScope != infrastructurev1alpha3.IPReservationScopeGlobal && spec.ControlPlaneEndpointStrategy == infrastructurev1alpha3.ControlPlaneEndpointStrategyGlobalIP:
+		return fmt.Errorf("the %s endpoint strategy requires the %s ip reservation scope: %w",
+			spec.ControlPlaneEndpointStrategy, infrastructurev1alpha3.IPReservationScopeGlobal, ErrInvalidRequest)
+	case ipScope != infrastructurev1alpha3.IPReservationScopeFacility && spec.ControlPlaneEndpointStrategy == infrastructurev1alpha3.ControlPlaneEndpointStrategyElasticIPPerFacility:
+		return fmt.Errorf("the %s endpoint strategy requires the %s ip reservation scope: %w",
+			spec.ControlPlaneEndpointStrategy, infrastructurev1alpha3.IPReservationScopeFacility, ErrInvalidRequest)
+	}
+	return nil
+}
+
+// ipDescriptionData is what the description template of the ip reservations
+// is rendered with.
+type ipDescriptionData struct {
+	Cluster   string
+	Namespace string
+	Purpose   string
+}
+
+// ValidateIPReservationMetadata checks that the extra tags do not collide with
+// the ones the controllers identify the reservations with, and that the
+// description template can be rendered.
+func ValidateIPReservationMetadata(meta *infrastructurev1alpha3.IPReservationMetadata) error {
+	_, _, err := IPReservationDetails(meta, "", "", "")
+	return err
+}
+
+// IPReservationDetails returns the extra tags and the description of an ip
+// reservation of a cluster.
+func IPReservationDetails(meta *infrastructurev1alpha3.IPReservationMetadata, namespace, clusterName, purpose string) ([]string, string, error) {
+	if meta == nil {
+		return nil, "", nil
+	}
+	for _, tag := range meta.Tags {
+		if strings.HasPrefix(tag, "cluster-api-provider-packet:") {
+			return nil, "", fmt.Errorf("ip reservation tag %q uses a reserved prefix: %w", tag, ErrInvalidRequest)
+		}
+	}
+	if meta.Description == "" {
+		return meta.Tags, "", nil
+	}
+
+	tmpl, err := template.New("ip-description").Option("missingkey=error").Parse(meta.Description)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse ip reservation description: %v: %w", err, ErrInvalidRequest)
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, ipDescriptionData{Cluster: clusterName, Namespace: namespace, Purpose: purpose}); err != nil {
+		return nil, "", fmt.Errorf("failed to render ip reservation description: %v: %w", err, ErrInvalidRequest)
+	}
+	return meta.Tags, buf.String(), nil
+}
+
+// removeTag returns a copy of tags without tag.
+func removeTag(tags []string, tag string) []string {
+	kept := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != tag {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestLeastPopulatedFacility(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		counts     map[string]int
+		expected   string
+	}{
+		{
+			name:       "no candidates",
+			candidates: nil,
+			counts:     map[string]int{"ewr1": 1},
+			expected:   "",
+		},
+		{
+			name:       "empty counts picks the first candidate",
+			candidates: []string{"ewr1", "sjc1", "ams1"},
+			counts:     map[string]int{},
+			expected:   "ewr1",
+		},
+		{
+			name:       "picks the facility with the fewest machines",
+			candidates: []string{"ewr1", "sjc1", "ams1"},
+			counts:     map[string]int{"ewr1": 2, "sjc1": 1, "ams1": 2},
+			expected:   "sjc1",
+		},
+		{
+			name:       "ties are broken by the candidates order",
+			candidates: []string{"ewr1", "sjc1", "ams1"},
+			counts:     map[string]int{"ewr1": 1, "sjc1": 0, "ams1": 0},
+			expected:   "sjc1",
+		},
+		{
+			name:       "machines outside of the candidates are ignored",
+			candidates: []string{"ewr1", "sjc1"},
+			counts:     map[string]int{"ewr1": 1, "sjc1": 1, "ams1": 0},
+			expected:   "ewr1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(LeastPopulatedFacility(tt.candidates, tt.counts)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestDeletionGracePeriod(t *testing.T) {
+	g := NewWithT(t)
+
+	grace, err := DeletionGracePeriod(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(grace).To(BeZero())
+
+	grace, err = DeletionGracePeriod(map[string]string{infrastructurev1alpha3.DeletionGracePeriodAnnotation: "90m"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(grace).To(Equal(90 * time.Minute))
+
+	_, err = DeletionGracePeriod(map[string]string{infrastructurev1alpha3.DeletionGracePeriodAnnotation: "tomorrow"})
+	g.Expect(err).To(HaveOccurred())
+	_, err = DeletionGracePeriod(map[string]string{infrastructurev1alpha3.DeletionGracePeriodAnnotation: "-1h"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestBillingHourEnd(t *testing.T) {
+	g := NewWithT(t)
+
+	created := time.Date(2021, 3, 1, 10, 20, 0, 0, time.UTC)
+	margin := 5 * time.Minute
+
+	g.Expect(BillingHourEnd(created, created, margin)).To(Equal(time.Date(2021, 3, 1, 11, 15, 0, 0, time.UTC)))
+	g.Expect(BillingHourEnd(created, created.Add(30*time.Minute), margin)).To(Equal(time.Date(2021, 3, 1, 11, 15, 0, 0, time.UTC)))
+	g.Expect(BillingHourEnd(created, created.Add(2*time.Hour), margin)).To(Equal(time.Date(2021, 3, 1, 12, 15, 0, 0, time.UTC)))
+	g.Expect(BillingHourEnd(created, created.Add(2*time.Hour+time.Second), margin)).To(Equal(time.Date(2021, 3, 1, 13, 15, 0, 0, time.UTC)))
+}
+
+func TestValidateIPReservationScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    infrastructurev1alpha3.PacketClusterSpec
+		wantErr bool
+	}{
+		{
+			name: "default facility scope",
+			spec: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1"},
+		},
+		{
+			name: "metro scope with a metro",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				Metro:              "ny",
+				IPReservationScope: infrastructurev1alpha3.IPReservationScopeMetro,
+			},
+		},
+		{
+			name: "metro scope without a metro",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				Facility:           "ewr1",
+				IPReservationScope: infrastructurev1alpha3.IPReservationScopeMetro,
+			},
+			wantErr: true,
+		},
+		{
+			name: "global ip strategy defaults to the global scope",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				ControlPlaneEndpointStrategy: infrastructurev1alpha3.ControlPlaneEndpointStrategyGlobalIP,
+			},
+		},
+		{
+			name: "global ip strategy with a facility scope",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				ControlPlaneEndpointStrategy: infrastructurev1alpha3.ControlPlaneEndpointStrategyGlobalIP,
+				IPReservationScope:           infrastructurev1alpha3.IPReservationScopeFacility,
+			},
+			wantErr: true,
+		},
+		{
+			name: "per facility strategy with a metro scope",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				Metro:                        "ny",
+				ControlPlaneEndpointStrategy: infrastructurev1alpha3.ControlPlaneEndpointStrategyElasticIPPerFacility,
+				IPReservationScope:           infrastructurev1alpha3.IPReservationScopeMetro,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateIPReservationScope(tt.spec)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateClusterLocation(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      infrastructurev1alpha3.PacketClusterSpec
+		wantScope infrastructurev1alpha3.IPReservationScope
+		wantErr   string
+	}{
+		{
+			name:      "facility",
+			spec:      infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1"},
+			wantScope: infrastructurev1alpha3.IPReservationScopeFacility,
+		},
+		{
+			name:      "metro only defaults to the metro scope",
+			spec:      infrastructurev1alpha3.PacketClusterSpec{Metro: "ny"},
+			wantScope: infrastructurev1alpha3.IPReservationScopeMetro,
+		},
+		{
+			name:      "facility of the metro",
+			spec:      infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1", Metro: "ny"},
+			wantScope: infrastructurev1alpha3.IPReservationScopeFacility,
+		},
+		{
+			name:      "no location",
+			spec:      infrastructurev1alpha3.PacketClusterSpec{},
+			wantScope: infrastructurev1alpha3.IPReservationScopeFacility,
+			wantErr:   "one of facility or metro is required",
+		},
+		{
+			name: "facility scope without a facility",
+			spec: infrastructurev1alpha3.PacketClusterSpec{
+				Metro:              "ny",
+				IPReservationScope: infrastructurev1alpha3.IPReservationScopeFacility,
+			},
+			wantScope: infrastructurev1alpha3.IPReservationScopeFacility,
+			wantErr:   "facility is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ipScope, _ := IPReservationLocation(tt.spec)
+			g.Expect(ipScope).To(Equal(tt.wantScope))
+			err := ValidateClusterLocation(tt.spec)
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+		})
+	}
+}
+
+func TestIPReservationDetails(t *testing.T) {
+	g := NewWithT(t)
+
+	tags, description, err := IPReservationDetails(nil, "default", "capi", IPPurposeControlPlane)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(tags).To(BeEmpty())
+	g.Expect(description).To(BeEmpty())
+
+	meta := &infrastructurev1alpha3.IPReservationMetadata{
+		Tags:        []string{"team:platform"},
+		Description: "{{ .Purpose }} of {{ .Namespace }}/{{ .Cluster }}",
+	}
+	tags, description, err = IPReservationDetails(meta, "default", "capi", IPPurposeControlPlane)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(tags).To(Equal([]string{"team:platform"}))
+	g.Expect(description).To(Equal("control-plane of default/capi"))
+
+	g.Expect(ValidateIPReservationMetadata(meta)).To(Succeed())
+	g.Expect(ValidateIPReservationMetadata(&infrastructurev1alpha3.IPReservationMetadata{
+		Tags: []string{"cluster-api-provider-packet:cluster-id:other"},
+	})).NotTo(Succeed())
+	g.Expect(ValidateIPReservationMetadata(&infrastructurev1alpha3.IPReservationMetadata{
+		Description: "{{ .Cluster",
+	})).NotTo(Succeed())
+	g.Expect(ValidateIPReservationMetadata(&infrastructurev1alpha3.IPReservationMetadata{
+		Description: "{{ .Owner }}",
+	})).NotTo(Succeed())
+}
@@ -0,0 +1,368 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// metalGatewayReady is the state of the metal gateways routing their VLAN.
+const metalGatewayReady = "ready"
+
+// VRF is a VRF of a project. packngo does not expose VRFs, their IP
+// reservations nor metal gateways, so their requests are made directly.
+type VRF struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	LocalASN int64    `json:"local_asn"`
+	IPRanges []string `json:"ip_ranges"`
+	Tags     []string `json:"tags"`
+}
+
+// vrfIPReservation is an IP reservation of a VRF.
+type vrfIPReservation struct {
+	ID      string `json:"id"`
+	Network string `json:"network"`
+	CIDR    int    `json:"cidr"`
+}
+
+// metalGateway routes a VLAN through the IP reservation of a VRF.
+type metalGateway struct {
+	ID            string `json:"id"`
+	State         string `json:"state"`
+	IPReservation *struct {
+		ID string `json:"id"`
+	} `json:"ip_reservation"`
+	VirtualNetwork *struct {
+		ID    string `json:"id"`
+		VXLAN int    `json:"vxlan"`
+	} `json:"virtual_network"`
+	VRF *struct {
+		ID string `json:"id"`
+	} `json:"vrf"`
+}
+
+// VRFService manages the VRFs of a cluster, the IP reservations and metal
+// gateways binding them to its VLANs, and the VLANs of the devices attached
+// to them.
+type VRFService interface {
+	ClusterVRFs(projectID, clusterUID string) ([]VRF, error)
+	CreateVRF(projectID, clusterUID, clusterName, metro string, vrf infrastructurev1alpha3.VRF) (*VRF, error)
+	DeleteVRF(projectID, id string) error
+	EnsureVRFMetalGateway(projectID, clusterUID string, vrf *VRF, vlan *packngo.VirtualNetwork, network string) (infrastructurev1alpha3.VRFMetalGatewayStatus, error)
+	PruneVRFMetalGateways(projectID string, vrf *VRF, keep []string) error
+	AttachDeviceVLANs(dev *packngo.Device, vlans []*packngo.VirtualNetwork) error
+}
+
+// ValidateVRFs checks the VRFs of a cluster. It returns an ErrInvalidRequest
+// when one can not be provisioned as declared.
+func ValidateVRFs(spec infrastructurev1alpha3.PacketClusterSpec) error {
+	names := map[string]bool{}
+	for _, vrf := range spec.VRFs {
+		name := vrf.Name
+		if names[name] {
+			return fmt.Errorf("vrfs: %s is declared twice: %w", name, ErrInvalidRequest)
+		}
+		names[name] = true
+		if VRFMetro(spec, vrf) == "" {
+			return fmt.Errorf("vrfs: %s needs a metro, the cluster has none: %w", name, ErrInvalidRequest)
+		}
+		ranges := make([]*net.IPNet, 0, len(vrf.IPRanges))
+		for _, r := range vrf.IPRanges {
+			_, ipnet, err := net.ParseCIDR(r)
+			if err != nil {
+				return fmt.Errorf("vrfs: ip range %q of %s is not a CIDR: %w", r, name, ErrInvalidRequest)
+			}
+			ranges = append(ranges, ipnet)
+		}
+		vlans := map[int32]bool{}
+		for _, gateway := range vrf.MetalGateways {
+			if vlans[gateway.VLAN] {
+				return fmt.Errorf("vrfs: %s has two metal gateways for VLAN %d: %w", name, gateway.VLAN, ErrInvalidRequest)
+			}
+			vlans[gateway.VLAN] = true
+			ip, network, err := net.ParseCIDR(gateway.Network)
+			if err != nil || !ip.Equal(network.IP) {
+				return fmt.Errorf("vrfs: network %q of %s is not a network CIDR: %w", gateway.Network, name, ErrInvalidRequest)
+			}
+			if !networkWithin(network, ranges) {
+				return fmt.Errorf("vrfs: network %s of %s is outside of its ip ranges: %w", gateway.Network, name, ErrInvalidRequest)
+			}
+		}
+	}
+	return nil
+}
+
+// networkWithin reports whether network is within one of ranges.
+func networkWithin(network *net.IPNet, ranges []*net.IPNet) bool {
+	ones, _ := network.Mask.Size()
+	for _, r := range ranges {
+		rangeOnes, _ := r.Mask.Size()
+		if r.Contains(network.IP) && rangeOnes <= ones {
+			return true
+		}
+	}
+	return false
+}
+
+// VRFMetro returns the metro of a VRF of a cluster.
+func VRFMetro(spec infrastructurev1alpha3.PacketClusterSpec, vrf infrastructurev1alpha3.VRF) string {
+	if vrf.Metro != "" {
+		return vrf.Metro
+	}
+	return spec.Metro
+}
+
+// VRFName returns the name within its cluster of a VRF the controller
+// provisioned, empty for other ones.
+func VRFName(vrf VRF) string {
+	for _, tag := range vrf.Tags {
+		if name := strings.TrimPrefix(tag, VRFTag+":"); name != tag {
+			return name
+		}
+	}
+	return ""
+}
+
+// VRFRoutesPropagated reports whether every metal gateway of a VRF is ready.
+func VRFRoutesPropagated(status infrastructurev1alpha3.VRFStatus, gateways int) bool {
+	if len(status.MetalGateways) < gateways {
+		return false
+	}
+	for _, gateway := range status.MetalGateways {
+		if gateway.State != metalGatewayReady {
+			return false
+		}
+	}
+	return true
+}
+
+// ClusterVRFs returns the VRFs of a project the controller provisioned for
+// the PacketCluster with the given UID, the one returned by ClusterUID for
+// the VRFs of a moved cluster to be found.
+func (p *PacketClient) ClusterVRFs(projectID, clusterUID string) ([]VRF, error) {
+	list := struct {
+		VRFs []VRF `json:"vrfs"`
+	}{}
+	if _, err := p.DoRequest(http.MethodGet, path.Join("/projects", projectID, "vrfs"), nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the vrfs of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	clusterTag := GenerateClusterUIDTag(clusterUID)
+	owned := []VRF{}
+	for _, vrf := range list.VRFs {
+		if ItemsInList(vrf.Tags, []string{clusterTag}) {
+			owned = append(owned, vrf)
+		}
+	}
+	return owned, nil
+}
+
+// CreateVRF creates a VRF in metro for the PacketCluster with the given UID
+// and name.
+func (p *PacketClient) CreateVRF(projectID, clusterUID, clusterName, metro string, vrf infrastructurev1alpha3.VRF) (*VRF, error) {
+	req := map[string]interface{}{
+		"name":      fmt.Sprintf("%s-%s", clusterName, vrf.Name),
+		"metro":     metro,
+		"local_asn": vrf.LocalASN,
+		"ip_ranges": vrf.IPRanges,
+		"tags":      []string{GenerateClusterUIDTag(clusterUID), GenerateVRFTag(vrf.Name)},
+	}
+	created := &VRF{}
+	if _, err := p.DoRequest(http.MethodPost, path.Join("/projects", projectID, "vrfs"), req, created); err != nil {
+		return nil, fmt.Errorf("failed to create vrf %s: %w", req["name"], packeterrors.Wrap(err))
+	}
+	return created, nil
+}
+
+// DeleteVRF deletes a VRF, once its metal gateways and IP reservations are.
+// VRFs already gone are not an error.
+func (p *PacketClient) DeleteVRF(projectID, id string) error {
+	vrf := &VRF{ID: id}
+	if err := p.PruneVRFMetalGateways(projectID, vrf, nil); err != nil {
+		return err
+	}
+	reservations, err := p.vrfIPReservations(id)
+	if err != nil {
+		return err
+	}
+	for _, reservation := range reservations {
+		if err := p.deleteIfFound(path.Join("/ips", reservation.ID)); err != nil {
+			return fmt.Errorf("failed to delete the ip reservation %s of vrf %s: %w", reservation.ID, id, err)
+		}
+	}
+	if err := p.deleteIfFound(path.Join("/vrfs", id)); err != nil {
+		return fmt.Errorf("failed to delete vrf %s: %w", id, err)
+	}
+	return nil
+}
+
+// EnsureVRFMetalGateway reserves network in a VRF and creates the metal
+// gateway routing vlan through it, unless they exist.
+func (p *PacketClient) EnsureVRFMetalGateway(projectID, clusterUID string, vrf *VRF, vlan *packngo.VirtualNetwork, network string) (infrastructurev1alpha3.VRFMetalGatewayStatus, error) {
+	status := infrastructurev1alpha3.VRFMetalGatewayStatus{VLAN: int32(vlan.VXLAN)}
+	ip, ipnet, err := net.ParseCIDR(network)
+	if err != nil {
+		return status, fmt.Errorf("network %q of vrf %s is not a CIDR: %w", network, vrf.ID, ErrInvalidRequest)
+	}
+	cidr, _ := ipnet.Mask.Size()
+
+	reservations, err := p.vrfIPReservations(vrf.ID)
+	if err != nil {
+		return status, err
+	}
+	var reservation *vrfIPReservation
+	for i := range reservations {
+		if reservations[i].CIDR == cidr && ip.Equal(net.ParseIP(reservations[i].Network)) {
+			reservation = &reservations[i]
+			break
+		}
+	}
+	if reservation == nil {
+		req := map[string]interface{}{
+			"type":    "vrf",
+			"vrf_id":  vrf.ID,
+			"network": ip.String(),
+			"cidr":    cidr,
+			"tags":    []string{GenerateClusterUIDTag(clusterUID)},
+		}
+		reservation = &vrfIPReservation{}
+		if _, err := p.DoRequest(http.MethodPost, path.Join("/projects", projectID, "ips"), req, reservation); err != nil {
+			return status, fmt.Errorf("failed to reserve %s in vrf %s: %w", network, vrf.ID, packeterrors.Wrap(err))
+		}
+	}
+	status.IPReservationID = reservation.ID
+
+	gateways, err := p.metalGateways(projectID)
+	if err != nil {
+		return status, err
+	}
+	for _, gateway := range gateways {
+		if gateway.VirtualNetwork != nil && gateway.VirtualNetwork.ID == vlan.ID {
+			if gateway.IPReservation == nil || gateway.IPReservation.ID != reservation.ID {
+				return status, fmt.Errorf("vlan %d already has metal gateway %s for another network: %w", vlan.VXLAN, gateway.ID, ErrInvalidRequest)
+			}
+			status.ID = gateway.ID
+			status.State = gateway.State
+			return status, nil
+		}
+	}
+	req := map[string]string{
+		"virtual_network_id": vlan.ID,
+		"ip_reservation_id":  reservation.ID,
+	}
+	created := &metalGateway{}
+	if _, err := p.DoRequest(http.MethodPost, path.Join("/projects", projectID, "metal-gateways"), req, created); err != nil {
+		return status, fmt.Errorf("failed to create the metal gateway of vlan %d: %w", vlan.VXLAN, packeterrors.Wrap(err))
+	}
+	status.ID = created.ID
+	status.State = created.State
+	return status, nil
+}
+
+// PruneVRFMetalGateways deletes the metal gateways of a VRF other than the
+// ones in keep, and the IP reservations of their networks.
+func (p *PacketClient) PruneVRFMetalGateways(projectID string, vrf *VRF, keep []string) error {
+	gateways, err := p.metalGateways(projectID)
+	if err != nil {
+		return err
+	}
+	for _, gateway := range gateways {
+		if gateway.VRF == nil || gateway.VRF.ID != vrf.ID || ItemsInList(keep, []string{gateway.ID}) {
+			continue
+		}
+		if err := p.deleteIfFound(path.Join("/metal-gateways", gateway.ID)); err != nil {
+			return fmt.Errorf("failed to delete metal gateway %s: %w", gateway.ID, err)
+		}
+		if gateway.IPReservation == nil {
+			continue
+		}
+		if err := p.deleteIfFound(path.Join("/ips", gateway.IPReservation.ID)); err != nil {
+			return fmt.Errorf("failed to delete the ip reservation %s of metal gateway %s: %w", gateway.IPReservation.ID, gateway.ID, err)
+		}
+	}
+	return nil
+}
+
+// AttachDeviceVLANs attaches vlans to the bond0 port of a device, which
+// moves it to hybrid bonded mode. The VLANs already attached are skipped.
+func (p *PacketClient) AttachDeviceVLANs(dev *packngo.Device, vlans []*packngo.VirtualNetwork) error {
+	if len(vlans) == 0 {
+		return nil
+	}
+	bond, err := dev.GetPortByName("bond0")
+	if err != nil {
+		return fmt.Errorf("device %s has no bond0 port: %w", dev.ID, ErrInvalidRequest)
+	}
+	attached := map[string]bool{}
+	for _, vlan := range bond.AttachedVirtualNetworks {
+		attached[vlan.ID] = true
+		attached[path.Base(vlan.Href)] = true
+	}
+	for _, vlan := range vlans {
+		if attached[vlan.ID] {
+			continue
+		}
+		if _, _, err := p.Ports.Assign(bond.ID, vlan.ID); err != nil {
+			return fmt.Errorf("failed to attach vlan %d to device %s: %w", vlan.VXLAN, dev.ID, packeterrors.Wrap(err))
+		}
+	}
+	return nil
+}
+
+// vrfIPReservations returns the IP reservations of a VRF.
+func (p *PacketClient) vrfIPReservations(vrfID string) ([]vrfIPReservation, error) {
+	list := struct {
+		IPAddresses []vrfIPReservation `json:"ip_addresses"`
+	}{}
+	if _, err := p.DoRequest(http.MethodGet, path.Join("/vrfs", vrfID, "ips"), nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the ip reservations of vrf %s: %w", vrfID, packeterrors.Wrap(err))
+	}
+	return list.IPAddresses, nil
+}
+
+// metalGateways returns the metal gateways of a project.
+func (p *PacketClient) metalGateways(projectID string) ([]metalGateway, error) {
+	list := struct {
+		MetalGateways []metalGateway `json:"metal_gateways"`
+	}{}
+	apiPath := path.Join("/projects", projectID, "metal-gateways") + "?include=ip_reservation,virtual_network,vrf"
+	if _, err := p.DoRequest(http.MethodGet, apiPath, nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list the metal gateways of project %s: %w", projectID, packeterrors.Wrap(err))
+	}
+	return list.MetalGateways, nil
+}
+
+// deleteIfFound deletes the resource at apiPath. Resources already gone are
+// not an error.
+func (p *PacketClient) deleteIfFound(apiPath string) error {
+	if _, err := p.DoRequest(http.MethodDelete, apiPath, nil, nil); err != nil {
+		if err = packeterrors.Wrap(err); packeterrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestValidateVRFs(t *testing.T) {
+	vrf := func(gateways ...infrastructurev1alpha3.VRFMetalGateway) infrastructurev1alpha3.VRF {
+		return infrastructurev1alpha3.VRF{Name: "private", LocalASN: 65000, IPRanges: []string{"10.10.0.0/16"}, MetalGateways: gateways}
+	}
+	gateway := infrastructurev1alpha3.VRFMetalGateway{VLAN: 1000, Network: "10.10.1.0/24"}
+
+	tests := []struct {
+		name  string
+		spec  infrastructurev1alpha3.PacketClusterSpec
+		valid bool
+	}{
+		{name: "none", valid: true},
+		{name: "with metal gateway", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{vrf(gateway)}}, valid: true},
+		{name: "duplicate", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{vrf(), vrf()}}},
+		{name: "no metro", spec: infrastructurev1alpha3.PacketClusterSpec{Facility: "ewr1", VRFs: []infrastructurev1alpha3.VRF{vrf()}}},
+		{name: "invalid ip range", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{{Name: "private", LocalASN: 65000, IPRanges: []string{"10.10.0.0"}}}}},
+		{name: "duplicate vlan", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{vrf(gateway, infrastructurev1alpha3.VRFMetalGateway{VLAN: 1000, Network: "10.10.2.0/24"})}}},
+		{name: "host address", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{vrf(infrastructurev1alpha3.VRFMetalGateway{VLAN: 1000, Network: "10.10.1.1/24"})}}},
+		{name: "outside of the ip ranges", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{vrf(infrastructurev1alpha3.VRFMetalGateway{VLAN: 1000, Network: "10.11.0.0/24"})}}},
+		{name: "larger than the ip range", spec: infrastructurev1alpha3.PacketClusterSpec{Metro: "da", VRFs: []infrastructurev1alpha3.VRF{vrf(infrastructurev1alpha3.VRFMetalGateway{VLAN: 1000, Network: "10.0.0.0/8"})}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := ValidateVRFs(tt.spec)
+			if tt.valid {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+		})
+	}
+}
+
+func TestVRFRoutesPropagated(t *testing.T) {
+	g := NewWithT(t)
+	ready := infrastructurev1alpha3.VRFMetalGatewayStatus{VLAN: 1000, ID: "gw", State: "ready"}
+
+	g.Expect(VRFRoutesPropagated(infrastructurev1alpha3.VRFStatus{}, 0)).To(BeTrue())
+	g.Expect(VRFRoutesPropagated(infrastructurev1alpha3.VRFStatus{MetalGateways: []infrastructurev1alpha3.VRFMetalGatewayStatus{ready}}, 1)).To(BeTrue())
+	g.Expect(VRFRoutesPropagated(infrastructurev1alpha3.VRFStatus{MetalGateways: []infrastructurev1alpha3.VRFMetalGatewayStatus{ready}}, 2)).To(BeFalse())
+	g.Expect(VRFRoutesPropagated(infrastructurev1alpha3.VRFStatus{MetalGateways: []infrastructurev1alpha3.VRFMetalGatewayStatus{
+		ready, {VLAN: 1001, ID: "pending", State: "active"},
+	}}, 2)).To(BeFalse())
+}
+
+func TestClusterVRFs(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/vrfs", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"vrfs": []map[string]interface{}{
+			{"id": "owned", "tags": []string{GenerateClusterUIDTag("uid"), GenerateVRFTag("private")}},
+			{"id": "other", "tags": []string{GenerateClusterUIDTag("other"), GenerateVRFTag("private")}},
+			{"id": "manual"},
+		},
+	}})
+
+	vrfs, err := c.ClusterVRFs("project", "uid")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vrfs).To(HaveLen(1))
+	g.Expect(vrfs[0].ID).To(Equal("owned"))
+	g.Expect(VRFName(vrfs[0])).To(Equal("private"))
+}
+
+func TestCreateVRF(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodPost, "/projects/project/vrfs", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "created"}})
+
+	vrf, err := c.CreateVRF("project", "uid", "cluster", "da", infrastructurev1alpha3.VRF{Name: "private", LocalASN: 65000, IPRanges: []string{"10.10.0.0/16"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(vrf.ID).To(Equal("created"))
+
+	body := api.requestsTo(http.MethodPost, "/projects/project/vrfs")[0].Body
+	g.Expect(body).To(HaveKeyWithValue("name", "cluster-private"))
+	g.Expect(body).To(HaveKeyWithValue("metro", "da"))
+	g.Expect(body).To(HaveKeyWithValue("local_asn", BeNumerically("==", 65000)))
+	g.Expect(body["ip_ranges"]).To(ConsistOf("10.10.0.0/16"))
+	g.Expect(body["tags"]).To(ConsistOf(GenerateClusterUIDTag("uid"), GenerateVRFTag("private")))
+}
+
+func TestEnsureVRFMetalGateway(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	vrf := &VRF{ID: "vrf"}
+	vlan := &packngo.VirtualNetwork{ID: "vlan", VXLAN: 1000}
+	api.on(http.MethodGet, "/vrfs/vrf/ips",
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"ip_addresses": []map[string]interface{}{{"id": "other", "network": "10.10.2.0", "cidr": 24}},
+		}},
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"ip_addresses": []map[string]interface{}{{"id": "reservation", "network": "10.10.1.0", "cidr": 24}},
+		}},
+	)
+	api.on(http.MethodPost, "/projects/project/ips", fakeResponse{status: http.StatusCreated, body: map[string]interface{}{"id": "reservation", "network": "10.10.1.0", "cidr": 24}})
+	api.on(http.MethodGet, "/projects/project/metal-gateways",
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{"metal_gateways": []interface{}{}}},
+		fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+			"metal_gateways": []map[string]interface{}{
+				{
+					"id": "gateway", "state": "ready",
+					"ip_reservation":  map[string]string{"id": "reservation"},
+					"virtual_network": map[string]interface{}{"id": "vlan", "vxlan": 1000},
+				},
+				{
+					"id": "elsewhere", "state": "ready",
+					"ip_reservation":  map[string]string{"id": "elsewhere"},
+					"virtual_network": map[string]interface{}{"id": "vlan2", "vxlan": 1001},
+				},
+			},
+		}},
+	)
+	api.on(http.MethodPost, "/projects/project/metal-gateways", fakeResponse{status: http.StatusCreated, body: map[string]string{"id": "gateway", "state": "active"}})
+
+	// the network gets reserved and the metal gateway created
+	status, err := c.EnsureVRFMetalGateway("project", "uid", vrf, vlan, "10.10.1.0/24")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(status).To(Equal(infrastructurev1alpha3.VRFMetalGatewayStatus{VLAN: 1000, ID: "gateway", IPReservationID: "reservation", State: "active"}))
+
+	body := api.requestsTo(http.MethodPost, "/projects/project/ips")[0].Body
+	g.Expect(body).To(HaveKeyWithValue("type", "vrf"))
+	g.Expect(body).To(HaveKeyWithValue("vrf_id", "vrf"))
+	g.Expect(body).To(HaveKeyWithValue("network", "10.10.1.0"))
+	g.Expect(body).To(HaveKeyWithValue("cidr", BeNumerically("==", 24)))
+	body = api.requestsTo(http.MethodPost, "/projects/project/metal-gateways")[0].Body
+	g.Expect(body).To(HaveKeyWithValue("virtual_network_id", "vlan"))
+	g.Expect(body).To(HaveKeyWithValue("ip_reservation_id", "reservation"))
+
+	// existing ones are reported
+	status, err = c.EnsureVRFMetalGateway("project", "uid", vrf, vlan, "10.10.1.0/24")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(status.State).To(Equal("ready"))
+	g.Expect(api.requestsTo(http.MethodPost, "/projects/project/ips")).To(HaveLen(1))
+	g.Expect(api.requestsTo(http.MethodPost, "/projects/project/metal-gateways")).To(HaveLen(1))
+
+	// a vlan routed through another network is not taken over
+	_, err = c.EnsureVRFMetalGateway("project", "uid", vrf, &packngo.VirtualNetwork{ID: "vlan2", VXLAN: 1001}, "10.10.1.0/24")
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+}
+
+func TestDeleteVRF(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/metal-gateways", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"metal_gateways": []map[string]interface{}{
+			{"id": "gateway", "ip_reservation": map[string]string{"id": "reservation"}, "vrf": map[string]string{"id": "vrf"}},
+			{"id": "other", "ip_reservation": map[string]string{"id": "other"}, "vrf": map[string]string{"id": "other"}},
+			{"id": "public"},
+		},
+	}})
+	api.on(http.MethodDelete, "/metal-gateways/gateway", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodDelete, "/ips/reservation", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodGet, "/vrfs/vrf/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"ip_addresses": []map[string]interface{}{{"id": "leftover", "network": "10.10.3.0", "cidr": 24}},
+	}})
+	api.on(http.MethodDelete, "/ips/leftover", fakeResponse{status: http.StatusNoContent})
+	api.on(http.MethodDelete, "/vrfs/vrf", fakeResponse{status: http.StatusNoContent})
+
+	g.Expect(c.DeleteVRF("project", "vrf")).To(Succeed())
+	g.Expect(api.requestsTo(http.MethodDelete, "/metal-gateways/gateway")).To(HaveLen(1))
+	g.Expect(api.requestsTo(http.MethodDelete, "/metal-gateways/other")).To(BeEmpty())
+	g.Expect(api.requestsTo(http.MethodDelete, "/ips/reservation")).To(HaveLen(1))
+	g.Expect(api.requestsTo(http.MethodDelete, "/ips/leftover")).To(HaveLen(1))
+	g.Expect(api.requestsTo(http.MethodDelete, "/vrfs/vrf")).To(HaveLen(1))
+
+	api.on(http.MethodGet, "/vrfs/gone/ips", fakeResponse{status: http.StatusOK, body: map[string]interface{}{"ip_addresses": []interface{}{}}})
+	g.Expect(c.DeleteVRF("project", "gone")).To(Succeed())
+}
+
+func TestAttachDeviceVLANs(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodPost, "/ports/bond/assign", fakeResponse{status: http.StatusOK, body: map[string]string{"id": "bond"}})
+	dev := &packngo.Device{ID: "device", NetworkPorts: []packngo.Port{{
+		ID:                      "bond",
+		Name:                    "bond0",
+		AttachedVirtualNetworks: []packngo.VirtualNetwork{{Href: "/virtual-networks/attached"}},
+	}}}
+
+	err := c.AttachDeviceVLANs(dev, []*packngo.VirtualNetwork{{ID: "attached", VXLAN: 1000}, {ID: "new", VXLAN: 1001}})
+	g.Expect(err).NotTo(HaveOccurred())
+	requests := api.requestsTo(http.MethodPost, "/ports/bond/assign")
+	g.Expect(requests).To(HaveLen(1))
+	g.Expect(requests[0].Body).To(HaveKeyWithValue("vnid", "new"))
+
+	err = c.AttachDeviceVLANs(&packngo.Device{ID: "device"}, []*packngo.VirtualNetwork{{ID: "new"}})
+	g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/packethost/packngo"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	packeterrors "sigs.k8s.io/cluster-api-provider-packet/pkg/cloud/packet/errors"
+)
+
+// WarmPoolTag marks the devices of the warm pool of a PacketMachineTemplate,
+// as WarmPoolTag:<namespace>/<name>. The tag is removed when a machine claims
+// the device.
+const WarmPoolTag = "cluster-api-provider-packet:warm-pool"
+
+// WarmPoolService provisions the devices of the warm pools.
+type WarmPoolService interface {
+	ListWarmDevices(projectID string) ([]packngo.Device, error)
+	NewWarmDevice(req *packngo.DeviceCreateRequest) (*packngo.Device, error)
+	ClaimWarmDevice(req CreateDeviceRequest, device *packngo.Device) error
+}
+
+// GenerateWarmPoolTag returns the tag of the warm devices of a template.
+func GenerateWarmPoolTag(namespace, template string) string {
+	return fmt.Sprintf("%s:%s/%s", WarmPoolTag, namespace, template)
+}
+
+// WarmPoolTemplate returns the namespace/name of the template a device is
+// kept warm for, or false when the device is not part of a warm pool.
+func WarmPoolTemplate(device packngo.Device) (string, bool) {
+	for _, tag := range device.Tags {
+		if strings.HasPrefix(tag, WarmPoolTag+":") {
+			return strings.TrimPrefix(tag, WarmPoolTag+":"), true
+		}
+	}
+	return "", false
+}
+
+// WarmPoolSize returns the number of devices to keep warm for a template, as
+// set by its WarmPoolSizeAnnotation. It returns false when the annotation is
+// not set.
+func WarmPoolSize(annotations map[string]string) (int, bool, error) {
+	value, ok := annotations[infrastructurev1alpha3.WarmPoolSizeAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		return 0, false, fmt.Errorf("%s %q is not a number of devices: %w", infrastructurev1alpha3.WarmPoolSizeAnnotation, value, ErrInvalidRequest)
+	}
+	return size, true, nil
+}
+
+// WarmDeviceRequest returns the request creating a warm device for the
+// template namespace/name, with the base operating system of spec and no
+// userdata. Only the machines placed in a single facility or metro, on
+// demand, can be kept warm: it returns an ErrInvalidRequest otherwise.
+func WarmDeviceRequest(namespace, template string, spec infrastructurev1alpha3.PacketMachineSpec, clusterSpec infrastructurev1alpha3.PacketClusterSpec) (*packngo.DeviceCreateRequest, error) {
+	switch {
+	case spec.Device != nil:
+		return nil, fmt.Errorf("machines adopting a device can not be kept warm: %w", ErrInvalidRequest)
+	case spec.IPXEUrl != "", spec.IPXEBootProfile != "":
+		return nil, fmt.Errorf("machines booting an ipxe script can not be kept warm: %w", ErrInvalidRequest)
+	case spec.HardwareReservationID != "":
+		return nil, fmt.Errorf("machines on reserved hardware can not be kept warm: %w", ErrInvalidRequest)
+	case len(spec.Facilities) != 0, spec.Facility == infrastructurev1alpha3.FacilityAny, spec.SpreadConstraints != nil:
+		return nil, fmt.Errorf("machines whose facility is picked when they are created can not be kept warm: %w", ErrInvalidRequest)
+	}
+
+	req := &packngo.DeviceCreateRequest{
+		Hostname:     fmt.Sprintf("%s-warm-%s", template, rand.String(5)),
+		ProjectID:    clusterSpec.ProjectID,
+		Plan:         spec.MachineType,
+		OS:           DeviceOS(spec),
+		BillingCycle: spec.BillingCycle,
+		Tags:         []string{GenerateWarmPoolTag(namespace, template)},
+	}
+	switch {
+	case spec.Facility != "":
+		req.Facility = []string{spec.Facility}
+	case clusterSpec.Facility != "":
+		req.Facility = []string{clusterSpec.Facility}
+	case clusterSpec.Metro != "":
+		req.Metro = clusterSpec.Metro
+	default:
+		return nil, fmt.Errorf("machines without a facility or metro can not be kept warm: %w", ErrInvalidRequest)
+	}
+	return req, nil
+}
+
+// PlanWarmPool returns how many devices to create for a pool of size, and the
+// devices to delete from it, the most recently created first.
+func PlanWarmPool(devices []packngo.Device, size int) (int, []packngo.Device) {
+	if len(devices) <= size {
+		return size - len(devices), nil
+	}
+	sorted := append([]packngo.Device{}, devices...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Created > sorted[j].Created })
+	return 0, sorted[:len(devices)-size]
+}
+
+// ClaimableWarmDevice returns the first active device of the pool, nil when
+// none is ready yet.
+func ClaimableWarmDevice(devices []packngo.Device) *packngo.Device {
+	for i := range devices {
+		if infrastructurev1alpha3.PacketResourceStatus(devices[i].State) == infrastructurev1alpha3.PacketResourceStatusRunning {
+			return &devices[i]
+		}
+	}
+	return nil
+}
+
+// ListWarmDevices returns the devices of the project that are part of a warm
+// pool.
+func (p *PacketClient) ListWarmDevices(projectID string) ([]packngo.Device, error) {
+	devices, _, err := p.Devices.List(projectID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving devices: %w", packeterrors.Wrap(err))
+	}
+	warm := []packngo.Device{}
+	for _, device := range devices {
+		if _, ok := WarmPoolTemplate(device); ok {
+			warm = append(warm, device)
+		}
+	}
+	return warm, nil
+}
+
+// NewWarmDevice creates a device of a warm pool.
+func (p *PacketClient) NewWarmDevice(req *packngo.DeviceCreateRequest) (*packngo.Device, error) {
+	dev, _, err := p.Devices.Create(req)
+	return dev, packeterrors.Wrap(err)
+}
+
+// ClaimWarmDevice hands a warm device over to the machine of req: it leaves
+// its pool, is renamed after the machine and is adopted with the bootstrap
+// data of the machine.
+func (p *PacketClient) ClaimWarmDevice(req CreateDeviceRequest, device *packngo.Device) error {
+	hostname := req.hostname()
+	defer p.devices.invalidate(device.ID)
+	if _, _, err := p.Devices.Update(device.ID, &packngo.DeviceUpdateRequest{Hostname: &hostname}); err != nil {
+		return packeterrors.Wrap(err)
+	}
+
+	claimed := *device
+	claimed.Tags = []string{}
+	for _, tag := range device.Tags {
+		if !strings.HasPrefix(tag, WarmPoolTag+":") {
+			claimed.Tags = append(claimed.Tags, tag)
+		}
+	}
+	return p.AdoptDevice(req, &claimed)
+}
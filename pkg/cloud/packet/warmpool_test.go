@@ -0,0 +1,165 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package packet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/packethost/packngo"
+
+	infrastructurev1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+)
+
+func TestWarmPoolSize(t *testing.T) {
+	g := NewWithT(t)
+
+	size, ok, err := WarmPoolSize(map[string]string{infrastructurev1alpha3.WarmPoolSizeAnnotation: "3"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ok).To(BeTrue())
+	g.Expect(size).To(Equal(3))
+
+	_, ok, err = WarmPoolSize(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ok).To(BeFalse())
+
+	for _, value := range []string{"-1", "two"} {
+		_, _, err = WarmPoolSize(map[string]string{infrastructurev1alpha3.WarmPoolSizeAnnotation: value})
+		g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+	}
+}
+
+func TestWarmDeviceRequest(t *testing.T) {
+	spec := infrastructurev1alpha3.PacketMachineSpec{
+		OS:           "ubuntu_20_04",
+		MachineType:  "c3.small.x86",
+		BillingCycle: "hourly",
+	}
+
+	tests := []struct {
+		name         string
+		spec         func(*infrastructurev1alpha3.PacketMachineSpec)
+		clusterSpec  infrastructurev1alpha3.PacketClusterSpec
+		wantFacility []string
+		wantMetro    string
+		wantErr      bool
+	}{
+		{
+			name:         "facility of the machine",
+			spec:         func(s *infrastructurev1alpha3.PacketMachineSpec) { s.Facility = "ewr1" },
+			clusterSpec:  infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "sjc1"},
+			wantFacility: []string{"ewr1"},
+		},
+		{
+			name:         "facility of the cluster",
+			clusterSpec:  infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Facility: "sjc1"},
+			wantFacility: []string{"sjc1"},
+		},
+		{
+			name:        "metro of the cluster",
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Metro: "da"},
+			wantMetro:   "da",
+		},
+		{
+			name:        "no placement",
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project"},
+			wantErr:     true,
+		},
+		{
+			name:        "any facility",
+			spec:        func(s *infrastructurev1alpha3.PacketMachineSpec) { s.Facility = infrastructurev1alpha3.FacilityAny },
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Metro: "da"},
+			wantErr:     true,
+		},
+		{
+			name:        "reserved hardware",
+			spec:        func(s *infrastructurev1alpha3.PacketMachineSpec) { s.HardwareReservationID = "next-available" },
+			clusterSpec: infrastructurev1alpha3.PacketClusterSpec{ProjectID: "project", Metro: "da"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			machineSpec := spec
+			if tt.spec != nil {
+				tt.spec(&machineSpec)
+			}
+			req, err := WarmDeviceRequest("default", "workers", machineSpec, tt.clusterSpec)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrInvalidRequest)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(req.Hostname).To(HavePrefix("workers-warm-"))
+			g.Expect(req.ProjectID).To(Equal("project"))
+			g.Expect(req.Plan).To(Equal("c3.small.x86"))
+			g.Expect(req.OS).To(Equal("ubuntu_20_04"))
+			g.Expect(req.UserData).To(BeEmpty())
+			g.Expect(req.Tags).To(Equal([]string{"cluster-api-provider-packet:warm-pool:default/workers"}))
+			g.Expect(req.Facility).To(Equal(tt.wantFacility))
+			g.Expect(req.Metro).To(Equal(tt.wantMetro))
+		})
+	}
+}
+
+func TestPlanWarmPool(t *testing.T) {
+	g := NewWithT(t)
+	devices := []packngo.Device{
+		{ID: "old", Created: "2021-03-01T10:00:00Z"},
+		{ID: "new", Created: "2021-03-01T12:00:00Z"},
+		{ID: "mid", Created: "2021-03-01T11:00:00Z"},
+	}
+
+	create, remove := PlanWarmPool(devices, 5)
+	g.Expect(create).To(Equal(2))
+	g.Expect(remove).To(BeEmpty())
+
+	create, remove = PlanWarmPool(devices, 1)
+	g.Expect(create).To(BeZero())
+	g.Expect(remove).To(HaveLen(2))
+	g.Expect(remove[0].ID).To(Equal("new"))
+	g.Expect(remove[1].ID).To(Equal("mid"))
+}
+
+func TestClaimableWarmDevice(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(ClaimableWarmDevice([]packngo.Device{{ID: "a", State: "provisioning"}})).To(BeNil())
+	g.Expect(ClaimableWarmDevice([]packngo.Device{{ID: "a", State: "provisioning"}, {ID: "b", State: "active"}}).ID).To(Equal("b"))
+}
+
+func TestListWarmDevices(t *testing.T) {
+	g := NewWithT(t)
+	api, c := newFakeAPI(t)
+	api.on(http.MethodGet, "/projects/project/devices", fakeResponse{status: http.StatusOK, body: map[string]interface{}{
+		"devices": []map[string]interface{}{
+			{"id": "warm", "tags": []string{"cluster-api-provider-packet:warm-pool:default/workers"}},
+			{"id": "node", "tags": []string{"cluster-api-provider-packet:cluster-id:capi"}},
+		},
+	}})
+
+	devices, err := c.ListWarmDevices("project")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(devices).To(HaveLen(1))
+	g.Expect(devices[0].ID).To(Equal("warm"))
+	key, ok := WarmPoolTemplate(devices[0])
+	g.Expect(ok).To(BeTrue())
+	g.Expect(key).To(Equal("default/workers"))
+}